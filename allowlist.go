@@ -0,0 +1,23 @@
+package devicemgr
+
+// AllowlistConfig restricts which client networks reach the HTTP APIs. When Global is set every
+// request must come from one of its networks; each route rule further restricts the requests it
+// matches. Requests relayed by TrustedProxies are judged by the nearest untrusted address in
+// their X-Forwarded-For header. Networks are CIDRs ("10.20.0.0/16") or single addresses.
+type AllowlistConfig struct {
+	Global         []string         `json:"global,omitempty"`
+	Routes         []RouteAllowlist `json:"routes,omitempty"`
+	TrustedProxies []string         `json:"trustedProxies,omitempty"`
+}
+
+// RouteAllowlist limits requests under Path, a path prefix matched at segment boundaries, made
+// with one of Methods (every method when empty; "mutating" stands for POST, PUT, PATCH and
+// DELETE) to the networks in CIDRs.
+type RouteAllowlist struct {
+	Path    string   `json:"path"`
+	Methods []string `json:"methods,omitempty"`
+	CIDRs   []string `json:"cidrs"`
+}
+
+// Enabled reports whether the config restricts anything.
+func (c AllowlistConfig) Enabled() bool { return len(c.Global) > 0 || len(c.Routes) > 0 }
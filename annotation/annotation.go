@@ -0,0 +1,87 @@
+package annotation
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+var ErrNoteNotFound = errors.New("note not found")
+
+// Annotations are the operator-maintained notes, ticket links and labels of one device.
+type Annotations struct {
+	Device    dm.DeviceID       `json:"device"`
+	Notes     []Note            `json:"notes,omitempty"`   // oldest first
+	Tickets   []string          `json:"tickets,omitempty"` // ticket URLs or keys
+	Labels    map[string]string `json:"labels,omitempty"`
+	UpdatedAt time.Time         `json:"updatedAt,omitempty"`
+}
+
+// Note is a free-text note.
+type Note struct {
+	ID        string    `json:"id"`
+	Text      string    `json:"text"`
+	Author    string    `json:"author,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Empty reports whether a has nothing worth storing.
+func (a Annotations) Empty() bool {
+	return len(a.Notes) == 0 && len(a.Tickets) == 0 && len(a.Labels) == 0
+}
+
+// Store persists annotations per device.
+type Store interface {
+	// Get returns ok false when the device has no annotations.
+	Get(ctx context.Context, device dm.DeviceID) (a Annotations, ok bool, err error)
+	Put(ctx context.Context, a Annotations) error
+	Delete(ctx context.Context, device dm.DeviceID) error
+	// All returns the annotations of every annotated device.
+	All(ctx context.Context) (map[dm.DeviceID]Annotations, error)
+}
+
+// MemoryStore is a process-local Store.
+type MemoryStore struct {
+	mu  sync.RWMutex
+	ann map[dm.DeviceID]Annotations
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{ann: make(map[dm.DeviceID]Annotations)}
+}
+
+func (m *MemoryStore) Get(_ context.Context, device dm.DeviceID) (Annotations, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	a, ok := m.ann[device]
+	return a, ok, nil
+}
+
+func (m *MemoryStore) Put(_ context.Context, a Annotations) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ann[a.Device] = a
+	return nil
+}
+
+func (m *MemoryStore) Delete(_ context.Context, device dm.DeviceID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.ann, device)
+	return nil
+}
+
+func (m *MemoryStore) All(_ context.Context) (map[dm.DeviceID]Annotations, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[dm.DeviceID]Annotations, len(m.ann))
+	for id, a := range m.ann {
+		out[id] = a
+	}
+	return out, nil
+}
@@ -0,0 +1,180 @@
+package annotation
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// MaxNoteLength bounds the text of a note, in bytes.
+const MaxNoteLength = 4096
+
+// LabelPrefix marks device query fields matched against annotation labels, e.g. "label.site:lab".
+const LabelPrefix = "label."
+
+// Devices is the subset of manager.Manager used by Service.
+type Devices interface {
+	Device(ctx context.Context, id dm.DeviceID) (dm.DeviceState, error)
+}
+
+// Service edits device annotations. Edits are read-modify-write under one lock, so concurrent
+// edits through one Service never lose each other; edits through different replicas sharing a
+// Store can.
+type Service struct {
+	m     Devices
+	store Store
+	mu    sync.Mutex
+	now   func() time.Time
+}
+
+// NewService uses store for persistence; nil selects a MemoryStore.
+func NewService(m Devices, store Store) *Service {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Service{m: m, store: store, now: time.Now}
+}
+
+// Get returns a device's annotations; a device without any gets empty ones.
+func (s *Service) Get(ctx context.Context, device dm.DeviceID) (Annotations, error) {
+	if err := s.authorize(ctx, device); err != nil {
+		return Annotations{}, err
+	}
+	a, _, err := s.store.Get(ctx, device)
+	a.Device = device
+	return a, err
+}
+
+// Put replaces a device's ticket links and labels, keeping its notes. Label keys must not be
+// empty or contain whitespace or ":", so every label can be queried.
+func (s *Service) Put(ctx context.Context, device dm.DeviceID, tickets []string, labels map[string]string) (Annotations, error) {
+	for k := range labels {
+		if k == "" || strings.ContainsFunc(k, func(r rune) bool { return r == ':' || unicode.IsSpace(r) }) {
+			return Annotations{}, fmt.Errorf("label key %q: %w", k, dm.ErrInvalidParameter)
+		}
+	}
+	return s.edit(ctx, device, func(a *Annotations) error {
+		a.Tickets = slices.Clone(tickets)
+		a.Labels = maps.Clone(labels)
+		return nil
+	})
+}
+
+// AddNote appends a note; author is free text, as reported by the caller.
+func (s *Service) AddNote(ctx context.Context, device dm.DeviceID, author, text string) (Note, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || len(text) > MaxNoteLength {
+		return Note{}, fmt.Errorf("note text must be 1-%d bytes: %w", MaxNoteLength, dm.ErrInvalidParameter)
+	}
+	note := Note{ID: uuid.NewString(), Text: text, Author: author, CreatedAt: s.now().UTC()}
+	_, err := s.edit(ctx, device, func(a *Annotations) error {
+		a.Notes = append(slices.Clone(a.Notes), note)
+		return nil
+	})
+	return note, err
+}
+
+// DeleteNote removes one note.
+func (s *Service) DeleteNote(ctx context.Context, device dm.DeviceID, noteID string) error {
+	_, err := s.edit(ctx, device, func(a *Annotations) error {
+		i := slices.IndexFunc(a.Notes, func(n Note) bool { return n.ID == noteID })
+		if i < 0 {
+			return ErrNoteNotFound
+		}
+		a.Notes = slices.Delete(slices.Clone(a.Notes), i, i+1)
+		return nil
+	})
+	return err
+}
+
+// Delete removes all of a device's annotations.
+func (s *Service) Delete(ctx context.Context, device dm.DeviceID) error {
+	if err := s.authorize(ctx, device); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.Delete(ctx, device)
+}
+
+// All returns the annotations of every annotated device. It does not apply partner scope;
+// callers pair it with a scoped device list.
+func (s *Service) All(ctx context.Context) (map[dm.DeviceID]Annotations, error) {
+	return s.store.All(ctx)
+}
+
+// edit applies fn to the stored annotations and saves the result, deleting it when nothing is left.
+func (s *Service) edit(ctx context.Context, device dm.DeviceID, fn func(*Annotations) error) (Annotations, error) {
+	if err := s.authorize(ctx, device); err != nil {
+		return Annotations{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, _, err := s.store.Get(ctx, device)
+	if err != nil {
+		return Annotations{}, err
+	}
+	a.Device = device
+	if err := fn(&a); err != nil {
+		return Annotations{}, err
+	}
+	a.UpdatedAt = s.now().UTC()
+	if a.Empty() {
+		return a, s.store.Delete(ctx, device)
+	}
+	if err := s.store.Put(ctx, a); err != nil {
+		return Annotations{}, fmt.Errorf("save annotations: %w", err)
+	}
+	return a, nil
+}
+
+// authorize hides annotations of devices outside the caller's partner scope.
+func (s *Service) authorize(ctx context.Context, device dm.DeviceID) error {
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		_, err := s.m.Device(ctx, device)
+		return err
+	}
+	return nil
+}
+
+// SplitQuery separates the label terms of q (fields starting with LabelPrefix) from those the
+// device index answers.
+func SplitQuery(q runtime.DeviceQuery) (index, labels runtime.DeviceQuery) {
+	for _, t := range q {
+		if strings.HasPrefix(t.Field, LabelPrefix) {
+			labels = append(labels, t)
+		} else {
+			index = append(index, t)
+		}
+	}
+	return index, labels
+}
+
+// Match reports whether a carries every label term, compared as the device index compares
+// metadata: ignoring case, with a trailing "*" matching a prefix.
+func (a Annotations) Match(labels runtime.DeviceQuery) bool {
+	for _, t := range labels {
+		v, ok := a.Labels[strings.TrimPrefix(t.Field, LabelPrefix)]
+		if !ok {
+			return false
+		}
+		v, want := strings.ToLower(v), strings.ToLower(t.Value)
+		if prefix, ok := strings.CutSuffix(want, "*"); ok {
+			if !strings.HasPrefix(v, prefix) {
+				return false
+			}
+		} else if v != want {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package annotation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+type fakeDevices struct{}
+
+func (fakeDevices) Device(_ context.Context, id dm.DeviceID) (dm.DeviceState, error) {
+	if id != "mac:aa" {
+		return dm.DeviceState{}, dm.ErrDeviceNotFound
+	}
+	return dm.DeviceState{ID: id}, nil
+}
+
+func TestServiceEdits(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(fakeDevices{}, nil)
+	if a, err := svc.Get(ctx, "mac:aa"); err != nil || a.Device != "mac:aa" || !a.Empty() {
+		t.Fatalf("Get before edits: %+v %v", a, err)
+	}
+	a, err := svc.Put(ctx, "mac:aa", []string{"https://tickets/OPS-1"}, map[string]string{"site": "lab"})
+	if err != nil || a.Labels["site"] != "lab" || a.UpdatedAt.IsZero() {
+		t.Fatalf("Put: %+v %v", a, err)
+	}
+	note, err := svc.AddNote(ctx, "mac:aa", "alex", "  swapped PSU  ")
+	if err != nil || note.Text != "swapped PSU" || note.ID == "" {
+		t.Fatalf("AddNote: %+v %v", note, err)
+	}
+	// Put keeps notes
+	if a, _ = svc.Put(ctx, "mac:aa", nil, map[string]string{"site": "field"}); len(a.Notes) != 1 || a.Tickets != nil {
+		t.Fatalf("Put after note: %+v", a)
+	}
+	if err := svc.DeleteNote(ctx, "mac:aa", "nope"); !errors.Is(err, ErrNoteNotFound) {
+		t.Fatalf("DeleteNote unknown: %v", err)
+	}
+	if err := svc.DeleteNote(ctx, "mac:aa", note.ID); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := svc.All(ctx); len(all["mac:aa"].Notes) != 0 || all["mac:aa"].Labels["site"] != "field" {
+		t.Fatalf("All: %+v", all)
+	}
+	// emptied annotations are dropped from the store
+	if _, err := svc.Put(ctx, "mac:aa", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := svc.All(ctx); len(all) != 0 {
+		t.Fatalf("expected no stored annotations, got %+v", all)
+	}
+
+	for _, key := range []string{"", "a b", "a:b"} {
+		if _, err := svc.Put(ctx, "mac:aa", nil, map[string]string{key: "x"}); !errors.Is(err, dm.ErrInvalidParameter) {
+			t.Errorf("label key %q: %v", key, err)
+		}
+	}
+	if _, err := svc.AddNote(ctx, "mac:aa", "", " "); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Errorf("empty note: %v", err)
+	}
+	scoped := dm.WithPartners(ctx, []string{"comcast"})
+	if _, err := svc.AddNote(scoped, "mac:bb", "", "hidden"); !errors.Is(err, dm.ErrDeviceNotFound) {
+		t.Errorf("out of scope: %v", err)
+	}
+}
+
+func TestMatchLabels(t *testing.T) {
+	q, err := runtime.ParseDeviceQuery("model:XB7 label.site:LAB label.rack:a*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, labels := SplitQuery(q)
+	if len(index) != 1 || len(labels) != 2 {
+		t.Fatalf("SplitQuery: %v %v", index, labels)
+	}
+	a := Annotations{Labels: map[string]string{"site": "lab", "rack": "A12"}}
+	if !a.Match(labels) {
+		t.Fatal("expected a match")
+	}
+	a.Labels["rack"] = "b1"
+	if a.Match(labels) || (Annotations{}).Match(labels) {
+		t.Fatal("expected no match")
+	}
+}
@@ -0,0 +1,409 @@
+// Package apischema generates JSON Schema and TypeScript definitions for API payloads from the Go
+// types that encode them, so web dashboards can stay in sync with the server. It follows
+// encoding/json: field names come from json tags, omitempty fields are optional, embedded structs
+// are flattened and nil pointers encode as null.
+//
+// Check reports fields that break the API's JSON conventions. Every field needs an explicit
+// lowerCamelCase json name, so JavaScript callers never see Go-cased names.
+package apischema
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Payload is one API payload type, named as in the generated definitions.
+type Payload struct {
+	Name  string      // the definition name; the Go type name when empty
+	Value interface{} // a value of the type, such as jobs.Job{}
+}
+
+// Enum lists the values of a named string type, rendered as a TypeScript union and a JSON Schema
+// enum.
+type Enum struct {
+	Value  interface{} // a value of the type, such as dm.EventKind("")
+	Values []string
+}
+
+// Document is the set of definitions reachable from a list of payloads.
+type Document struct {
+	defs  map[string]*def
+	order []string // definition names, sorted
+	names map[reflect.Type]string
+	enums map[reflect.Type][]string
+}
+
+type def struct {
+	t      reflect.Type
+	fields []field // for structs
+	enum   []string
+}
+
+type field struct {
+	name     string // JSON name
+	goName   string // Owner.Field, for Check
+	tagged   bool
+	optional bool // omitempty
+	t        reflect.Type
+	asString bool // ",string"
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	rawType       = reflect.TypeOf(json.RawMessage(nil))
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textType      = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// New collects the definitions of payloads and every named struct or enum type they reach. Types
+// sharing a Go name across packages are prefixed with their package name ("JobsParamChange").
+func New(payloads []Payload, enums ...Enum) *Document {
+	d := &Document{defs: make(map[string]*def), names: make(map[reflect.Type]string), enums: make(map[reflect.Type][]string)}
+	for _, e := range enums {
+		d.enums[reflect.TypeOf(e.Value)] = e.Values
+	}
+	var found []reflect.Type
+	seen := make(map[reflect.Type]bool)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		t = deref(t)
+		if seen[t] {
+			return
+		}
+		switch {
+		case t == timeType || t == rawType:
+			return
+		case t.Kind() == reflect.Struct && !custom(t):
+			seen[t] = true
+			found = append(found, t)
+			for _, f := range d.fields(t) {
+				walk(f.t)
+			}
+		case t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map:
+			walk(t.Elem())
+		case d.enums[t] != nil:
+			seen[t] = true
+			found = append(found, t)
+		}
+	}
+	explicit := make(map[reflect.Type]string)
+	for _, p := range payloads {
+		t := deref(reflect.TypeOf(p.Value))
+		if p.Name != "" {
+			explicit[t] = p.Name
+		}
+		walk(t)
+	}
+	for t := range d.enums {
+		walk(t)
+	}
+	count := make(map[string]int)
+	for _, t := range found {
+		if explicit[t] == "" {
+			count[t.Name()]++
+		}
+	}
+	for _, t := range found {
+		name := explicit[t]
+		switch {
+		case name != "":
+		case t.Name() == "":
+			continue // anonymous structs are inlined
+		case count[t.Name()] > 1:
+			pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+			name = strings.ToUpper(pkg[:1]) + pkg[1:] + t.Name()
+		default:
+			name = t.Name()
+		}
+		d.names[t] = name
+		df := &def{t: t, enum: d.enums[t]}
+		if t.Kind() == reflect.Struct {
+			df.fields = d.fields(t)
+		}
+		d.defs[name] = df
+		d.order = append(d.order, name)
+	}
+	sort.Strings(d.order)
+	return d
+}
+
+// fields lists a struct's JSON fields in encoding order, flattening embedded structs.
+func (d *Document) fields(t reflect.Type) []field {
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" {
+			if et := deref(sf.Type); et.Kind() == reflect.Struct && !custom(et) {
+				out = append(out, d.fields(et)...)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		f := field{name: name, goName: t.Name() + "." + sf.Name, tagged: name != "", t: sf.Type}
+		if name == "" {
+			f.name = sf.Name
+		}
+		for _, o := range strings.Split(opts, ",") {
+			switch o {
+			case "omitempty":
+				f.optional = sf.Type.Kind() != reflect.Struct // encoding/json never omits a struct
+			case "string":
+				f.asString = true
+			}
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// Check reports the fields that break the API's JSON conventions: those without an explicit json
+// name, and names that are not lowerCamelCase.
+func (d *Document) Check() []string {
+	var problems []string
+	for _, name := range d.order {
+		for _, f := range d.defs[name].fields {
+			switch {
+			case !f.tagged:
+				problems = append(problems, fmt.Sprintf("%s: no json name (encodes as %q)", f.goName, f.name))
+			case !camel(f.name):
+				problems = append(problems, fmt.Sprintf("%s: json name %q is not lowerCamelCase", f.goName, f.name))
+			}
+		}
+	}
+	return problems
+}
+
+// ident reports whether s is a TypeScript identifier, which needs no quotes as a property name.
+func ident(s string) bool {
+	for i, r := range s {
+		if !(unicode.IsLetter(r) || r == '_' || r == '$' || i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func camel(s string) bool {
+	for i, r := range s {
+		if (i == 0 && !unicode.IsLower(r)) || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// JSONSchema renders the definitions as a JSON Schema (draft 2020-12) document whose $defs hold
+// one schema per type.
+func (d *Document) JSONSchema(id string) ([]byte, error) {
+	defs := make(map[string]interface{}, len(d.defs))
+	for name, df := range d.defs {
+		if df.enum != nil {
+			defs[name] = map[string]interface{}{"type": "string", "enum": df.enum}
+			continue
+		}
+		defs[name] = d.objectSchema(df.fields)
+	}
+	doc := map[string]interface{}{"$schema": "https://json-schema.org/draft/2020-12/schema", "$defs": defs}
+	if id != "" {
+		doc["$id"] = id
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func (d *Document) objectSchema(fields []field) map[string]interface{} {
+	props := make(map[string]interface{}, len(fields))
+	required := []string{}
+	for _, f := range fields {
+		s := d.schema(fieldType(f))
+		if f.asString {
+			s = map[string]interface{}{"type": "string"}
+		}
+		props[f.name] = s
+		if !f.optional {
+			required = append(required, f.name)
+		}
+	}
+	return map[string]interface{}{"type": "object", "properties": props, "required": required}
+}
+
+func (d *Document) schema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Pointer {
+		return map[string]interface{}{"anyOf": []interface{}{d.schema(t.Elem()), map[string]interface{}{"type": "null"}}}
+	}
+	if name, ok := d.names[t]; ok {
+		return map[string]interface{}{"$ref": "#/$defs/" + name}
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawType || t.Kind() == reflect.Interface || custom(t) && !t.Implements(textType):
+		return map[string]interface{}{}
+	case t.Implements(textType):
+		return map[string]interface{}{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s := map[string]interface{}{"type": "integer"}
+		if t == reflect.TypeOf(time.Duration(0)) {
+			s["description"] = "nanoseconds"
+		}
+		return s
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": d.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": d.schema(t.Elem())}
+	case reflect.Struct:
+		return d.objectSchema(d.fields(t))
+	}
+	return map[string]interface{}{}
+}
+
+// TypeScript renders the definitions as TypeScript declarations: an interface per struct and a
+// string union per enum.
+func (d *Document) TypeScript() []byte {
+	var b bytes.Buffer
+	b.WriteString("// Generated by devicemgr apischema; do not edit.\n")
+	for _, name := range d.order {
+		df := d.defs[name]
+		b.WriteString("\n")
+		if df.enum != nil {
+			quoted := make([]string, len(df.enum))
+			for i, v := range df.enum {
+				q, _ := json.Marshal(v)
+				quoted[i] = string(q)
+			}
+			fmt.Fprintf(&b, "export type %s = %s;\n", name, strings.Join(quoted, " | "))
+			continue
+		}
+		fmt.Fprintf(&b, "export interface %s ", name)
+		d.tsObject(&b, df.fields, "")
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
+
+func (d *Document) tsObject(b *bytes.Buffer, fields []field, indent string) {
+	b.WriteString("{\n")
+	for _, f := range fields {
+		name := f.name
+		if !ident(name) {
+			q, _ := json.Marshal(name)
+			name = string(q)
+		}
+		opt := ""
+		if f.optional {
+			opt = "?"
+		}
+		fmt.Fprintf(b, "%s  %s%s: ", indent, name, opt)
+		if f.asString {
+			b.WriteString("string")
+		} else {
+			d.tsType(b, fieldType(f), indent+"  ")
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString(indent + "}")
+}
+
+func (d *Document) tsType(b *bytes.Buffer, t reflect.Type, indent string) {
+	if t.Kind() == reflect.Pointer {
+		d.tsType(b, t.Elem(), indent)
+		b.WriteString(" | null")
+		return
+	}
+	if name, ok := d.names[t]; ok {
+		b.WriteString(name)
+		return
+	}
+	switch {
+	case t == timeType:
+		b.WriteString("string")
+		return
+	case t == rawType || t.Kind() == reflect.Interface || custom(t) && !t.Implements(textType):
+		b.WriteString("unknown")
+		return
+	case t.Implements(textType):
+		b.WriteString("string")
+		return
+	}
+	switch t.Kind() {
+	case reflect.String:
+		b.WriteString("string")
+	case reflect.Bool:
+		b.WriteString("boolean")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		b.WriteString("number")
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			b.WriteString("string")
+			return
+		}
+		elem := t.Elem()
+		if elem.Kind() == reflect.Pointer || (elem.Kind() == reflect.Struct && d.names[elem] == "" && elem != timeType) {
+			b.WriteString("Array<")
+			d.tsType(b, elem, indent)
+			b.WriteString(">")
+			return
+		}
+		d.tsType(b, elem, indent)
+		b.WriteString("[]")
+	case reflect.Map:
+		b.WriteString("Record<string, ")
+		d.tsType(b, t.Elem(), indent)
+		b.WriteString(">")
+	case reflect.Struct:
+		d.tsObject(b, d.fields(t), indent)
+	default:
+		b.WriteString("unknown")
+	}
+}
+
+// fieldType is the type a field is described as: an omitted nil pointer is never null.
+func fieldType(f field) reflect.Type {
+	if f.optional && f.t.Kind() == reflect.Pointer {
+		return f.t.Elem()
+	}
+	return f.t
+}
+
+func deref(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// custom reports whether t encodes itself, so its fields say nothing about its JSON.
+func custom(t reflect.Type) bool {
+	if t == timeType {
+		return false
+	}
+	return t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) ||
+		t.Implements(textType) || reflect.PointerTo(t).Implements(textType)
+}
@@ -0,0 +1,89 @@
+package apischema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type color string
+
+type base struct {
+	ID string `json:"id"`
+}
+
+type item struct {
+	Name string `json:"name"`
+}
+
+type order struct {
+	base
+	Items    []item            `json:"items"`
+	Color    color             `json:"color,omitempty"`
+	Parent   *order            `json:"parent"`
+	Note     *item             `json:"note,omitempty"`
+	At       time.Time         `json:"at,omitempty"` // never omitted
+	Labels   map[string]string `json:"labels,omitempty"`
+	Count    int64             `json:"count,string"`
+	Extra    interface{}       `json:"extra,omitempty"`
+	Internal string            `json:"-"`
+	Legacy   bool
+	snake    int
+}
+
+func TestTypeScript(t *testing.T) {
+	d := New([]Payload{{Name: "Order", Value: order{}}}, Enum{Value: color(""), Values: []string{"red", "blue"}})
+	want := `// Generated by devicemgr apischema; do not edit.
+
+export interface Order {
+  id: string;
+  items: item[];
+  color?: color;
+  parent: Order | null;
+  note?: item;
+  at: string;
+  labels?: Record<string, string>;
+  count: string;
+  extra?: unknown;
+  Legacy: boolean;
+}
+
+export type color = "red" | "blue";
+
+export interface item {
+  name: string;
+}
+`
+	if got := string(d.TypeScript()); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+	if p := d.Check(); len(p) != 1 || !strings.Contains(p[0], "order.Legacy") {
+		t.Fatalf("check %v", p)
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	b, err := New([]Payload{{Name: "Order", Value: order{}}}).JSONSchema("urn:test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		ID   string `json:"$id"`
+		Defs map[string]struct {
+			Properties map[string]map[string]interface{} `json:"properties"`
+			Required   []string                          `json:"required"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	o := doc.Defs["Order"]
+	if doc.ID != "urn:test" || strings.Join(o.Required, ",") != "id,items,parent,at,count,Legacy" {
+		t.Fatalf("schema %s", b)
+	}
+	if o.Properties["items"]["items"].(map[string]interface{})["$ref"] != "#/$defs/item" || o.Properties["at"]["format"] != "date-time" ||
+		o.Properties["color"]["type"] != "string" || len(o.Properties["parent"]["anyOf"].([]interface{})) != 2 {
+		t.Fatalf("properties %v", o.Properties)
+	}
+}
@@ -0,0 +1,16 @@
+package devicemgr
+
+// ApprovalConfig names the bulk jobs destructive enough to need a second person's approval before
+// they run: the job is held until an admin other than its submitter approves it. The zero value
+// holds none.
+type ApprovalConfig struct {
+	// Operations maps a job operation ("reboot", "factory-reset", "set", ...) to the number of
+	// devices a job of it may cover without approval; zero holds every job of the operation.
+	Operations map[string]int `json:"operations,omitempty"`
+}
+
+// Required reports whether a job of operation covering devices needs approval.
+func (c ApprovalConfig) Required(operation string, devices int) bool {
+	limit, ok := c.Operations[operation]
+	return ok && devices > limit
+}
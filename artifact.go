@@ -0,0 +1,60 @@
+package devicemgr
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultArtifactTTL is how long a Redis ArtifactStore keeps job artifacts when ArtifactConfig.TTL
+// is unset.
+const DefaultArtifactTTL = 7 * 24 * time.Hour
+
+// ArtifactConfig selects where bulk job artifacts are kept: an S3-compatible bucket when Bucket is
+// set, otherwise Redis when Cache.RedisURL is, otherwise memory.
+type ArtifactConfig struct {
+	Endpoint        string        `json:"endpoint"` // e.g. https://s3.us-east-1.amazonaws.com or a MinIO URL
+	Region          string        `json:"region"`   // us-east-1 when empty
+	Bucket          string        `json:"bucket"`
+	Prefix          string        `json:"prefix"` // key prefix within the bucket
+	AccessKeyID     string        `json:"accessKeyId"`
+	SecretAccessKey string        `json:"secretAccessKey"`
+	TTL             time.Duration `json:"-"` // Redis only; DefaultArtifactTTL when zero
+}
+
+// ArtifactStore holds the contents of job artifacts by key (<job>/<name>); their descriptions stay
+// with the jobs.
+type ArtifactStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Get fails with ErrArtifactNotFound for an unknown key.
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// MemoryArtifactStore is a process-local ArtifactStore.
+type MemoryArtifactStore struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+var _ ArtifactStore = (*MemoryArtifactStore)(nil)
+
+func NewMemoryArtifactStore() *MemoryArtifactStore {
+	return &MemoryArtifactStore{data: make(map[string][]byte)}
+}
+
+func (m *MemoryArtifactStore) Put(_ context.Context, key string, data []byte) error {
+	m.mu.Lock()
+	m.data[key] = append([]byte(nil), data...)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemoryArtifactStore) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.data[key]
+	if !ok {
+		return nil, ErrArtifactNotFound
+	}
+	return b, nil
+}
@@ -0,0 +1,181 @@
+package devicemgr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditRecord describes one state-changing or diagnostic action taken on a device.
+type AuditRecord struct {
+	Time     time.Time
+	Action   string // e.g. "reboot", "factory-reset", "ping", or "get", "set", "rpc" in operation history
+	DeviceID DeviceID
+	Actor    string   // authenticated caller (e.g. the token subject), when known
+	Approver string   // who approved the job the action ran in, for jobs held for approval
+	Role     Role     // caller's role when authorization is in use
+	Partners []string // caller's partner scope, if any
+	Detail   string
+	Override bool          // the device's maintenance window (force) or quarantine was overridden
+	Duration time.Duration // how long the action took
+	Err      error         // nil when the action succeeded
+}
+
+// AuditSink receives audit records. Implementations must be safe for concurrent use.
+type AuditSink interface {
+	Audit(AuditRecord)
+}
+
+type actorKey struct{}
+
+// WithActor returns a context naming the authenticated caller for audit records.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the caller named by WithActor, or "".
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+type approverKey struct{}
+
+// WithApprover returns a context naming who approved the work it carries, for audit records.
+func WithApprover(ctx context.Context, approver string) context.Context {
+	return context.WithValue(ctx, approverKey{}, approver)
+}
+
+// ApproverFromContext returns the approver named by WithApprover, or "".
+func ApproverFromContext(ctx context.Context) string {
+	approver, _ := ctx.Value(approverKey{}).(string)
+	return approver
+}
+
+// NewAuditRecord fills the caller fields of a record for action from ctx.
+func NewAuditRecord(ctx context.Context, action string, id DeviceID) AuditRecord {
+	r := AuditRecord{Time: time.Now(), Action: action, DeviceID: id, Actor: ActorFromContext(ctx), Approver: ApproverFromContext(ctx)}
+	r.Role, _ = RoleFromContext(ctx)
+	r.Partners, _ = PartnersFromContext(ctx)
+	r.Override = MaintenanceOverridden(ctx) || QuarantineOverridden(ctx)
+	return r
+}
+
+type auditJSON struct {
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"`
+	DeviceID   DeviceID  `json:"device"`
+	Actor      string    `json:"actor,omitempty"`
+	Approver   string    `json:"approver,omitempty"`
+	Role       string    `json:"role,omitempty"`
+	Partners   []string  `json:"partners,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+	Override   bool      `json:"override,omitempty"`
+	DurationMS int64     `json:"durationMs"`
+	OK         bool      `json:"ok"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes the record with its outcome as "ok" and "error".
+func (r AuditRecord) MarshalJSON() ([]byte, error) {
+	out := auditJSON{Time: r.Time, Action: r.Action, DeviceID: r.DeviceID, Actor: r.Actor, Approver: r.Approver, Partners: r.Partners,
+		Detail: r.Detail, Override: r.Override, DurationMS: r.Duration.Milliseconds(), OK: r.Err == nil}
+	if r.Role != RoleNone {
+		out.Role = r.Role.String()
+	}
+	if r.Err != nil {
+		out.Error = r.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes MarshalJSON's encoding; a failed record's Err carries only the message.
+func (r *AuditRecord) UnmarshalJSON(b []byte) error {
+	var in auditJSON
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	role, _ := ParseRole(in.Role)
+	*r = AuditRecord{Time: in.Time, Action: in.Action, DeviceID: in.DeviceID, Actor: in.Actor, Approver: in.Approver, Role: role, Partners: in.Partners,
+		Detail: in.Detail, Override: in.Override, Duration: time.Duration(in.DurationMS) * time.Millisecond}
+	if !in.OK {
+		r.Err = errors.New(in.Error)
+	}
+	return nil
+}
+
+// LogAudit writes audit records as single log lines.
+type LogAudit struct {
+	Logger *log.Logger // optional; defaults to log.Default()
+}
+
+func (l LogAudit) Audit(r AuditRecord) {
+	logger := l.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	outcome := "ok"
+	if r.Err != nil {
+		outcome = "error: " + r.Err.Error()
+	}
+	approver := ""
+	if r.Approver != "" {
+		approver = " approver=" + r.Approver
+	}
+	logger.Printf("audit action=%s device=%s actor=%s%s role=%s partners=%s detail=%q override=%t result=%s",
+		r.Action, r.DeviceID, r.Actor, approver, r.Role, strings.Join(r.Partners, ","), r.Detail, r.Override, outcome)
+}
+
+// DefaultOperationHistory is the number of records an operation log keeps per device when not configured.
+const DefaultOperationHistory = 100
+
+// OperationLog keeps the most recent audit records of each device, for the operation history API.
+type OperationLog interface {
+	Record(ctx context.Context, r AuditRecord) error
+	// Recent returns up to limit of the device's records, newest first; limit <= 0 returns all kept.
+	Recent(ctx context.Context, id DeviceID, limit int) ([]AuditRecord, error)
+}
+
+// MemoryOperationLog is a process-local OperationLog.
+type MemoryOperationLog struct {
+	max     int
+	mu      sync.Mutex
+	devices map[DeviceID][]AuditRecord // oldest first
+}
+
+// NewMemoryOperationLog keeps perDevice records per device; zero or less uses DefaultOperationHistory.
+func NewMemoryOperationLog(perDevice int) *MemoryOperationLog {
+	if perDevice <= 0 {
+		perDevice = DefaultOperationHistory
+	}
+	return &MemoryOperationLog{max: perDevice, devices: make(map[DeviceID][]AuditRecord)}
+}
+
+func (l *MemoryOperationLog) Record(_ context.Context, r AuditRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	recs := append(l.devices[r.DeviceID], r)
+	if len(recs) > l.max {
+		recs = append([]AuditRecord(nil), recs[len(recs)-l.max:]...)
+	}
+	l.devices[r.DeviceID] = recs
+	return nil
+}
+
+func (l *MemoryOperationLog) Recent(_ context.Context, id DeviceID, limit int) ([]AuditRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	recs := l.devices[id]
+	if limit <= 0 || limit > len(recs) {
+		limit = len(recs)
+	}
+	out := make([]AuditRecord, 0, limit)
+	for i := len(recs) - 1; i >= len(recs)-limit; i-- {
+		out = append(out, recs[i])
+	}
+	return out, nil
+}
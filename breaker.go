@@ -0,0 +1,154 @@
+package devicemgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting a device whose circuit breaker is open. It wraps
+// ErrDeviceOffline, so callers treating the device as unreachable need no extra case.
+var ErrCircuitOpen = fmt.Errorf("circuit open: %w", ErrDeviceOffline)
+
+// BreakerConfig tunes the per-device circuit breaker in front of parameter reads, writes and RPCs.
+// The zero value disables it; DefaultOptions enables DefaultBreakerConfig.
+type BreakerConfig struct {
+	Failures int           // failures, each within Window of the last, that open a circuit; 0 disables
+	Window   time.Duration // a failure later than this after the previous one starts a new count (1m)
+	Cooldown time.Duration // how long an open circuit fails fast before letting one probe through (30s)
+}
+
+// DefaultBreakerConfig opens a device's circuit after five failures at most a minute apart,
+// probing it every 30s.
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{Failures: 5, Window: time.Minute, Cooldown: 30 * time.Second}
+}
+
+// BreakerState is the state of one device's circuit.
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // calls proceed
+	BreakerOpen     BreakerState = "open"      // calls fail fast with ErrCircuitOpen
+	BreakerHalfOpen BreakerState = "half-open" // one probe is in flight; other calls fail fast
+)
+
+// Breaker tracks failing devices. Timeouts and offline reports count as failures; any other
+// outcome shows the device answered and closes its circuit. When it opens, calls fail fast until
+// Cooldown has passed, then a single probe decides whether it closes again or stays open.
+type Breaker struct {
+	cfg BreakerConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	devices map[DeviceID]*breakerEntry
+}
+
+type breakerEntry struct {
+	failures int
+	last     time.Time // of the latest failure
+	openedAt time.Time // zero while closed
+	probing  bool
+}
+
+// NewBreaker builds a Breaker; zero Window and Cooldown take the defaults.
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	def := DefaultBreakerConfig()
+	if cfg.Window <= 0 {
+		cfg.Window = def.Window
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = def.Cooldown
+	}
+	return &Breaker{cfg: cfg, now: time.Now, devices: make(map[DeviceID]*breakerEntry)}
+}
+
+// Allow reports whether a call to id may proceed, returning ErrCircuitOpen when it may not. Every
+// allowed call must be followed by Record.
+func (b *Breaker) Allow(id DeviceID) error {
+	if b == nil || b.cfg.Failures <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := b.devices[id]
+	if e == nil || e.openedAt.IsZero() {
+		return nil
+	}
+	if e.probing || b.now().Sub(e.openedAt) < b.cfg.Cooldown {
+		return fmt.Errorf("%s: %w", id, ErrCircuitOpen)
+	}
+	e.probing = true
+	return nil
+}
+
+// Record reports the outcome of a call Allow let through. context.Canceled leaves the circuit as
+// it was, for calls abandoned by their caller.
+func (b *Breaker) Record(id DeviceID, err error) {
+	if b == nil || b.cfg.Failures <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := b.devices[id]
+	switch {
+	case errors.Is(err, context.Canceled):
+		if e != nil {
+			e.probing = false
+		}
+	case !breakerFailure(err):
+		delete(b.devices, id)
+	default:
+		now := b.now()
+		if e == nil {
+			e = &breakerEntry{}
+			b.devices[id] = e
+		}
+		if now.Sub(e.last) > b.cfg.Window {
+			e.failures = 0
+		}
+		e.failures++
+		e.last = now
+		if e.probing || e.failures >= b.cfg.Failures {
+			e.openedAt, e.probing = now, false
+		}
+	}
+}
+
+// State returns id's circuit state.
+func (b *Breaker) State(id DeviceID) BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch e := b.devices[id]; {
+	case e == nil || e.openedAt.IsZero():
+		return BreakerClosed
+	case e.probing:
+		return BreakerHalfOpen
+	}
+	return BreakerOpen
+}
+
+// Open returns the devices whose circuit is open or half-open.
+func (b *Breaker) Open() []DeviceID {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []DeviceID
+	for id, e := range b.devices {
+		if !e.openedAt.IsZero() {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func breakerFailure(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrTimeout) || errors.Is(err, ErrDeviceOffline)
+}
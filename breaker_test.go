@@ -0,0 +1,67 @@
+package devicemgr
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker(BreakerConfig{Failures: 2, Window: time.Minute, Cooldown: 10 * time.Second})
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	fail := func(id DeviceID) {
+		t.Helper()
+		if err := b.Allow(id); err != nil {
+			t.Fatalf("allow %s: %v", id, err)
+		}
+		b.Record(id, context.DeadlineExceeded)
+	}
+
+	fail("mac:aa")
+	now = now.Add(2 * time.Minute)
+	fail("mac:aa") // the first failure is outside the window
+	if s := b.State("mac:aa"); s != BreakerClosed {
+		t.Fatalf("state %s after spread-out failures", s)
+	}
+	fail("mac:aa")
+	if err := b.Allow("mac:aa"); !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrDeviceOffline) {
+		t.Fatalf("open circuit allowed: %v", err)
+	}
+	if err := b.Allow("mac:bb"); err != nil {
+		t.Fatalf("other device blocked: %v", err)
+	}
+
+	// after the cooldown one probe goes through; a failed probe reopens the circuit
+	now = now.Add(10 * time.Second)
+	if err := b.Allow("mac:aa"); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if b.State("mac:aa") != BreakerHalfOpen || b.Allow("mac:aa") == nil {
+		t.Fatal("second call allowed while probing")
+	}
+	b.Record("mac:aa", ErrTimeout)
+	if b.State("mac:aa") != BreakerOpen || b.Allow("mac:aa") == nil {
+		t.Fatal("failed probe did not reopen the circuit")
+	}
+	// an abandoned probe leaves the circuit open; an answered one closes it
+	now = now.Add(10 * time.Second)
+	_ = b.Allow("mac:aa")
+	b.Record("mac:aa", context.Canceled)
+	if b.State("mac:aa") != BreakerOpen {
+		t.Fatalf("canceled probe changed the circuit to %s", b.State("mac:aa"))
+	}
+	if err := b.Allow("mac:aa"); err != nil {
+		t.Fatalf("probe after cancel: %v", err)
+	}
+	b.Record("mac:aa", ErrInvalidParameter)
+	if s := b.State("mac:aa"); s != BreakerClosed {
+		t.Fatalf("answered probe left state %s", s)
+	}
+
+	var off *Breaker
+	if err := off.Allow("mac:aa"); err != nil || NewBreaker(BreakerConfig{}).Allow("mac:aa") != nil {
+		t.Fatal("disabled breaker blocked a call")
+	}
+}
@@ -0,0 +1,13 @@
+package cache
+
+import "time"
+
+// Cache is the storage contract shared by the in-memory TTL cache and remote drivers.
+// Get reports the time the entry was stored so callers can tag freshness.
+type Cache[V any] interface {
+	Get(key string) (v V, storedAt time.Time, ok bool)
+	Set(key string, value V)
+	Delete(key string)
+	// SetTTL changes the entry lifetime; entries already stored older than it expire.
+	SetTTL(ttl time.Duration)
+}
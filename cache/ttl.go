@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TTL is a small in-memory cache whose entries expire after a fixed duration.
+// Expired entries are dropped lazily on access; there is no background sweeper.
+type TTL[V any] struct {
+	ttl atomic.Int64 // time.Duration
+	now func() time.Time
+
+	mu      sync.RWMutex
+	entries map[string]ttlEntry[V]
+}
+
+type ttlEntry[V any] struct {
+	value    V
+	storedAt time.Time
+}
+
+// NewTTL creates a cache with the supplied entry lifetime. A non-positive ttl disables caching.
+func NewTTL[V any](ttl time.Duration) *TTL[V] {
+	c := &TTL[V]{now: time.Now, entries: make(map[string]ttlEntry[V])}
+	c.SetTTL(ttl)
+	return c
+}
+
+// SetTTL changes the entry lifetime, also for entries already stored.
+func (c *TTL[V]) SetTTL(ttl time.Duration) { c.ttl.Store(int64(ttl)) }
+
+// Get returns the cached value and the time it was stored when present and not expired.
+func (c *TTL[V]) Get(key string) (v V, storedAt time.Time, ok bool) {
+	ttl := time.Duration(c.ttl.Load())
+	if ttl <= 0 {
+		return v, storedAt, false
+	}
+	c.mu.RLock()
+	e, found := c.entries[key]
+	c.mu.RUnlock()
+	if !found {
+		return v, storedAt, false
+	}
+	if c.now().Sub(e.storedAt) > ttl {
+		c.mu.Lock()
+		delete(c.entries, key)
+		c.mu.Unlock()
+		return v, storedAt, false
+	}
+	return e.value, e.storedAt, true
+}
+
+// Set stores value under key.
+func (c *TTL[V]) Set(key string, value V) {
+	if c.ttl.Load() <= 0 {
+		return
+	}
+	c.mu.Lock()
+	c.entries[key] = ttlEntry[V]{value: value, storedAt: c.now()}
+	c.mu.Unlock()
+}
+
+// Delete removes key if present.
+func (c *TTL[V]) Delete(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+// Len reports the number of stored (possibly expired) entries.
+func (c *TTL[V]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
@@ -0,0 +1,64 @@
+package devicemgr
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParameterCatalog describes the device data model so writes can be checked before they are sent;
+// schema.Catalog implements it.
+type ParameterCatalog interface {
+	// CheckSet returns the data type of p's parameter ("" when the catalog does not describe it),
+	// and an error wrapping ErrInvalidParameter when a device of model cannot take the write. An
+	// empty model skips model checks.
+	CheckSet(p SetParameter, model string) (dataType string, err error)
+}
+
+// ParameterDescriber is implemented by catalogs that also know parameters' units and enumerated
+// values, as schema.Catalog does. The Manager labels the values it reads with them and rejects
+// SETs of values outside a parameter's enumeration before contacting the device.
+type ParameterDescriber interface {
+	Describe(name string) (ParameterInfo, bool)
+}
+
+// ParameterInfo is what a ParameterDescriber knows about a parameter.
+type ParameterInfo struct {
+	Type string
+	Unit string            // such as "dBm" or "seconds"
+	Enum map[string]string // allowed values, in their string form, to their labels; empty allows any
+}
+
+// Label returns the label of v, "" when v is not enumerated.
+func (i ParameterInfo) Label(v interface{}) string { return i.Enum[EnumKey(v)] }
+
+// CheckEnum fails with ErrInvalidParameter when the enumeration does not allow v.
+func (i ParameterInfo) CheckEnum(v interface{}) error {
+	if len(i.Enum) == 0 || v == nil {
+		return nil
+	}
+	if _, ok := i.Enum[EnumKey(v)]; ok {
+		return nil
+	}
+	allowed := make([]string, 0, len(i.Enum))
+	for k := range i.Enum {
+		allowed = append(allowed, k)
+	}
+	sort.Strings(allowed)
+	return fmt.Errorf("%v is not one of %s: %w", v, strings.Join(allowed, ", "), ErrInvalidParameter)
+}
+
+// EnumKey is the string form of a JSON or WDMP value that enumerations are keyed by: the numbers 1
+// and 1.0 and the string "1" are all "1".
+func EnumKey(v interface{}) string {
+	switch n := v.(type) {
+	case string:
+		return n
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(n), 'f', -1, 32)
+	}
+	return fmt.Sprint(v)
+}
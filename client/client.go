@@ -0,0 +1,319 @@
+// Package client is a typed Go client for devicemgr's HTTP API, so other Go services can list
+// devices, read and write parameters, submit bulk jobs and follow device events without
+// hand-writing HTTP calls. Errors unwrap to the devicemgr sentinels (ErrDeviceNotFound,
+// ErrAccessDenied, ErrBackendUnavailable, ...) the server answered with, and transient failures
+// are retried with Config.Retry; mutations carry an Idempotency-Key so a retried one is applied
+// once.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/translate"
+)
+
+// Config configures a Client.
+type Config struct {
+	// BaseURL is the server's address, such as "http://devicemgr:8090"; for an embedded API it
+	// includes the mount prefix.
+	BaseURL    string
+	Auth       dm.AuthStrategy // optional; the Authorization header of every request
+	HTTPClient *http.Client    // optional; one with a 30s timeout when nil
+	// Retry retries transient failures: network errors, 429 and 5xx answers (waiting out their
+	// Retry-After). The zero policy makes one attempt; dm.DefaultRetryPolicy suits most callers.
+	Retry dm.RetryPolicy
+}
+
+// Client calls one devicemgr server. It is safe for concurrent use.
+type Client struct {
+	cfg  Config
+	base string
+}
+
+// New returns a Client for cfg.BaseURL.
+func New(cfg Config) (*Client, error) {
+	u, err := url.Parse(cfg.BaseURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("base URL %q: %w", cfg.BaseURL, dm.ErrInvalidParameter)
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{cfg: cfg, base: strings.TrimRight(cfg.BaseURL, "/")}, nil
+}
+
+// Error is a failed answer from the server. It unwraps to the devicemgr sentinel of its code, or
+// else matching its status, so callers can test it with errors.Is.
+type Error struct {
+	Status     int
+	Code       string        // the problem's code, such as dm.CodeDeviceOffline; empty from older servers
+	Message    string        // the server's "error" field, or the body's start
+	RetryAfter time.Duration // from a Retry-After header
+	// WDMP describes the device fault of a request a WDMP reply refused, in the server's
+	// language (see translate.ErrorCatalog to describe it in another).
+	WDMP *translate.ErrorDescription
+
+	notFound error // what a 404 means for the request
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("devicemgr: %d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	if e.Status == http.StatusTooManyRequests || e.Status >= 500 {
+		// a BackendError, so RetryPolicy honors the Retry-After
+		return &dm.BackendError{Backend: "devicemgr", Status: e.Status, RetryAfter: e.RetryAfter}
+	}
+	if err := dm.CodeError(e.Code); err != nil {
+		return err
+	}
+	switch e.Status {
+	case http.StatusBadRequest:
+		return dm.ErrInvalidParameter
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return dm.ErrAccessDenied
+	case http.StatusNotFound:
+		return e.notFound
+	case http.StatusConflict:
+		return dm.ErrConflict
+	case http.StatusGone:
+		return dm.ErrCursorExpired
+	case http.StatusPreconditionRequired:
+		return dm.ErrConfirmationRequired
+	case http.StatusGatewayTimeout:
+		return dm.ErrTimeout
+	}
+	return nil
+}
+
+// Device is a connected device as the server lists it.
+type Device struct {
+	ID          string                  `json:"id"`
+	Online      bool                    `json:"online"`
+	LastSeen    time.Time               `json:"lastSeen,omitempty"`
+	Annotations *annotation.Annotations `json:"annotations,omitempty"`
+}
+
+// ListDevices lists the connected devices the caller may see, matching query when set (e.g.
+// "model:XB7 firmware:1.2*", see GET /api/devices).
+func (c *Client) ListDevices(ctx context.Context, query string) ([]Device, error) {
+	q := url.Values{}
+	if query != "" {
+		q.Set("query", query)
+	}
+	var out struct {
+		Devices []Device `json:"devices"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/devices", q, nil, &out, dm.ErrDeviceNotFound); err != nil {
+		return nil, err
+	}
+	return out.Devices, nil
+}
+
+// GetParams reads names from a device through a translation service; empty selects the server's
+// default.
+func (c *Client) GetParams(ctx context.Context, id dm.DeviceID, service string, names ...string) (map[string]dm.ParameterValue, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("parameter names required: %w", dm.ErrInvalidParameter)
+	}
+	q := url.Values{"names": {strings.Join(names, ",")}}
+	if service != "" {
+		q.Set("service", service)
+	}
+	var out struct {
+		Parameters map[string]dm.ParameterValue `json:"parameters"`
+	}
+	if err := c.do(ctx, http.MethodGet, devicePath(id, "params"), q, nil, &out, dm.ErrDeviceNotFound); err != nil {
+		return nil, err
+	}
+	return out.Parameters, nil
+}
+
+// SetParams writes params to a device, returning the names the device reports applied.
+// opts.TestAndSet and opts.DryRun are passed on; a dry run returns no names.
+func (c *Client) SetParams(ctx context.Context, id dm.DeviceID, service string, params []dm.SetParameter, opts dm.SetOptions) ([]string, error) {
+	type param struct {
+		Name       string                 `json:"name"`
+		Value      interface{}            `json:"value,omitempty"`
+		DataType   string                 `json:"dataType,omitempty"`
+		Attributes map[string]interface{} `json:"attributes,omitempty"`
+	}
+	var body struct {
+		Parameters []param `json:"parameters"`
+		TestAndSet *struct {
+			OldCID string `json:"oldCid,omitempty"`
+			NewCID string `json:"newCid"`
+		} `json:"testAndSet,omitempty"`
+	}
+	for _, p := range params {
+		body.Parameters = append(body.Parameters, param{Name: p.Name, Value: p.Value, DataType: p.TypeHint, Attributes: p.Attributes})
+	}
+	if cas := opts.TestAndSet; cas != nil {
+		body.TestAndSet = &struct {
+			OldCID string `json:"oldCid,omitempty"`
+			NewCID string `json:"newCid"`
+		}{cas.OldCID, cas.NewCID}
+	}
+	q := url.Values{}
+	if service != "" {
+		q.Set("service", service)
+	}
+	if opts.DryRun {
+		q.Set("dryRun", "true")
+	}
+	var out struct {
+		Applied []string `json:"applied"`
+	}
+	if err := c.do(ctx, http.MethodPatch, devicePath(id, "params"), q, body, &out, dm.ErrDeviceNotFound); err != nil {
+		return nil, err
+	}
+	return out.Applied, nil
+}
+
+// SubmitJob starts a bulk job; it may be held for approval (jobs.StatusAwaitingApproval).
+func (c *Client) SubmitJob(ctx context.Context, spec jobs.Spec) (jobs.Job, error) {
+	var j jobs.Job
+	err := c.do(ctx, http.MethodPost, "/api/jobs", nil, spec, &j, jobs.ErrJobNotFound)
+	return j, err
+}
+
+// Job returns a job with its progress and results so far.
+func (c *Client) Job(ctx context.Context, id string) (jobs.Job, error) {
+	var j jobs.Job
+	err := c.do(ctx, http.MethodGet, "/api/jobs/"+url.PathEscape(id), nil, nil, &j, jobs.ErrJobNotFound)
+	return j, err
+}
+
+// CancelJob cancels a running or held job.
+func (c *Client) CancelJob(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/jobs/"+url.PathEscape(id), nil, nil, nil, jobs.ErrJobNotFound)
+}
+
+// WaitJob polls a job every interval (1s when zero) until it finishes or ctx is done, returning
+// its final state.
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (jobs.Job, error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		j, err := c.Job(ctx, id)
+		if err != nil || j.FinishedAt != nil {
+			return j, err
+		}
+		select {
+		case <-ctx.Done():
+			return j, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func devicePath(id dm.DeviceID, rest string) string {
+	return "/api/devices/" + url.PathEscape(string(id)) + "/" + rest
+}
+
+// do sends a request with in as its JSON body, decoding a successful answer into out (when not
+// nil), with retries. notFound is what a 404 unwraps to. Mutations get one Idempotency-Key for
+// every attempt.
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, in, out interface{}, notFound error) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	endpoint := c.base + path
+	if len(q) > 0 {
+		endpoint += "?" + q.Encode()
+	}
+	var key string
+	if method != http.MethodGet {
+		key = idempotencyKey()
+	}
+	return c.cfg.Retry.Do(ctx, func() error {
+		req, err := c.request(ctx, method, endpoint, body)
+		if err != nil {
+			return err
+		}
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		resp, err := c.cfg.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return responseError(resp, notFound)
+		}
+		if out == nil {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("devicemgr: decode %s %s: %w", method, path, err)
+		}
+		return nil
+	})
+}
+
+// request builds a request carrying the configured authorization.
+func (c *Client) request(ctx context.Context, method, endpoint string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.cfg.Auth != nil {
+		v, err := c.cfg.Auth.AuthorizationValue()
+		if err != nil {
+			return nil, fmt.Errorf("authorization: %w", err)
+		}
+		if v != "" {
+			req.Header.Set("Authorization", v)
+		}
+	}
+	return req, nil
+}
+
+// responseError reads a failed answer's error message.
+func responseError(resp *http.Response, notFound error) *Error {
+	e := &Error{Status: resp.StatusCode, notFound: notFound}
+	e.RetryAfter, _ = dm.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var msg struct {
+		Error string                      `json:"error"`
+		Code  string                      `json:"code"`
+		WDMP  *translate.ErrorDescription `json:"wdmp"`
+	}
+	if json.Unmarshal(b, &msg) == nil && msg.Error != "" {
+		e.Message, e.Code, e.WDMP = msg.Error, msg.Code, msg.WDMP
+	} else {
+		e.Message = strings.TrimSpace(string(b))
+	}
+	return e
+}
+
+func idempotencyKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
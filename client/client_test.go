@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/internal/server"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/loadgen"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// newServer runs the devicemgr API over a simulated fleet. The first PATCH answers 503 with a
+// Retry-After, and every request must carry the bearer token.
+func newServer(t *testing.T) (*Client, *manager.Manager, *loadgen.Fleet, *[]string) {
+	t.Helper()
+	fleet := loadgen.New(loadgen.Config{Devices: 20, Online: 1, Seed: 3})
+	backends := httptest.NewServer(fleet.Handler())
+	t.Cleanup(backends.Close)
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = backends.URL
+	opts.Tr1d1umBaseURL = backends.URL + loadgen.Tr1d1umPath
+	opts.BlizzardBaseURL = "ws://" + strings.TrimPrefix(backends.URL, "http://") + loadgen.BlizzardPath
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	if _, err := m.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	svc := jobs.NewService(ctx, jobs.Builders(m))
+	h, err := server.NewDiscoveryHandler(server.DiscoveryConfig{Manager: m, Jobs: svc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu      sync.Mutex
+		patches []string // Idempotency-Keys of the PATCH attempts
+	)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodPatch {
+			mu.Lock()
+			patches = append(patches, r.Header.Get("Idempotency-Key"))
+			first := len(patches) == 1
+			mu.Unlock()
+			if first {
+				w.Header().Set("Retry-After", "0")
+				http.Error(w, `{"error":"busy"}`, http.StatusServiceUnavailable)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(api.Close)
+	c, err := New(Config{BaseURL: api.URL + "/", Auth: dm.StaticAuth{Value: "Bearer t0ken"}, Retry: dm.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, m, fleet, &patches
+}
+
+func TestClientDevicesAndParams(t *testing.T) {
+	c, _, fleet, patches := newServer(t)
+	ctx := context.Background()
+	devices, err := c.ListDevices(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != len(fleet.Online()) || !devices[0].Online {
+		t.Fatalf("devices %+v", devices)
+	}
+	id := dm.DeviceID(devices[0].ID)
+
+	applied, err := c.SetParams(ctx, id, "", []dm.SetParameter{{Name: "Device.WiFi.SSID.1.SSID", Value: "office"}}, dm.SetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || len(*patches) != 2 || (*patches)[0] == "" || (*patches)[0] != (*patches)[1] {
+		t.Fatalf("applied %v after attempts with keys %v", applied, *patches)
+	}
+	values, err := c.GetParams(ctx, id, "", "Device.WiFi.SSID.1.SSID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := values["Device.WiFi.SSID.1.SSID"]; v.Value != "office" {
+		t.Fatalf("values %+v", values)
+	}
+
+	if _, err := c.GetParams(ctx, "not a device", "", "Device.X"); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("bad device ID: %v", err)
+	}
+	anon, _ := New(Config{BaseURL: c.base})
+	var apiErr *Error
+	if _, err := anon.ListDevices(ctx, ""); !errors.Is(err, dm.ErrAccessDenied) || !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated: %v", err)
+	}
+}
+
+func TestClientJobs(t *testing.T) {
+	c, _, fleet, _ := newServer(t)
+	ctx := context.Background()
+	online := fleet.Online()
+	spec := jobs.Spec{Operation: jobs.OperationSet, Devices: []dm.DeviceID{dm.DeviceID(online[0]), dm.DeviceID(online[1])},
+		Parameters: []jobs.Param{{Name: "Device.WiFi.SSID.1.SSID", Value: "batch"}}}
+	j, err := c.SubmitJob(ctx, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := c.WaitJob(ctx, j.ID, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Status != jobs.StatusSucceeded || done.Progress.Done != 2 {
+		t.Fatalf("job %+v", done)
+	}
+	if _, err := c.Job(ctx, "nope"); !errors.Is(err, jobs.ErrJobNotFound) {
+		t.Fatalf("missing job: %v", err)
+	}
+}
+
+func TestClientWatchEvents(t *testing.T) {
+	c, m, _, _ := newServer(t)
+	s := c.WatchEvents(context.Background(), WatchOptions{Kinds: []dm.EventKind{dm.EventOffline}})
+	defer s.Close()
+	// the stream subscribes asynchronously, so keep emitting until the offline event arrives;
+	// the online events must be filtered out
+	deadline := time.After(5 * time.Second)
+	for {
+		m.Emit(dm.Event{Kind: dm.EventOnline, DeviceID: "mac:5a1000000000", OccurredAt: time.Now()})
+		m.Emit(dm.Event{Kind: dm.EventOffline, DeviceID: "mac:5a1000000000", OccurredAt: time.Now()})
+		select {
+		case e, ok := <-s.C():
+			if !ok {
+				t.Fatalf("stream ended: %v", s.Err())
+			}
+			if e.Kind != dm.EventOffline || e.DeviceID != "mac:5a1000000000" {
+				t.Fatalf("unfiltered event %+v", e)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no event")
+		}
+	}
+}
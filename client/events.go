@@ -0,0 +1,160 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+)
+
+// WatchOptions filters WatchEvents. Empty fields match everything.
+type WatchOptions struct {
+	Kinds   []dm.EventKind
+	Devices []dm.DeviceID
+	Buffer  int // events queued for a slow reader before the stream waits (64)
+}
+
+// EventStream is a live device event feed; it is a dm.EventSubscription.
+type EventStream struct {
+	ch     chan dm.Event
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+var _ dm.EventSubscription = (*EventStream)(nil)
+
+// C delivers the events; it is closed when the stream ends.
+func (s *EventStream) C() <-chan dm.Event { return s.ch }
+
+// Close ends the stream.
+func (s *EventStream) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// Err reports why the stream ended: nil after Close or the context ending, otherwise the answer
+// that reconnecting cannot fix, such as an *Error for 401 or 403.
+func (s *EventStream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// WatchEvents follows GET /api/events until ctx is done or the stream is closed. A dropped
+// connection or 5xx answer is retried after Config.Retry's backoff (1s doubling to 30s when the
+// policy has none); the events sent while reconnecting are missed.
+func (c *Client) WatchEvents(ctx context.Context, opts WatchOptions) *EventStream {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+	q := url.Values{}
+	if len(opts.Kinds) > 0 {
+		kinds := make([]string, len(opts.Kinds))
+		for i, k := range opts.Kinds {
+			kinds[i] = string(k)
+		}
+		q.Set("kind", strings.Join(kinds, ","))
+	}
+	if len(opts.Devices) > 0 {
+		devices := make([]string, len(opts.Devices))
+		for i, d := range opts.Devices {
+			devices[i] = string(d)
+		}
+		q.Set("device", strings.Join(devices, ","))
+	}
+	endpoint := c.base + "/api/events"
+	if len(q) > 0 {
+		endpoint += "?" + q.Encode()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s := &EventStream{ch: make(chan dm.Event, opts.Buffer), cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		defer close(s.ch)
+		backoff := c.cfg.Retry
+		if backoff.Backoff <= 0 {
+			backoff = dm.RetryPolicy{Backoff: time.Second, MaxBackoff: 30 * time.Second, Jitter: 0.2}
+		}
+		for failures := 0; ; {
+			received, err := c.stream(ctx, endpoint, s.ch)
+			if ctx.Err() != nil {
+				return
+			}
+			var e *Error
+			if errors.As(err, &e) && e.Status < 500 && e.Status != http.StatusTooManyRequests {
+				s.mu.Lock()
+				s.err = err
+				s.mu.Unlock()
+				return
+			}
+			if received {
+				failures = 0
+			}
+			failures++
+			wait := backoff.Delay(failures)
+			if after, ok := dm.RetryAfter(err); ok && after > wait {
+				wait = after
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+	return s
+}
+
+// stream reads one connection's events into ch, reporting whether any arrived.
+func (c *Client) stream(ctx context.Context, endpoint string, ch chan<- dm.Event) (received bool, err error) {
+	req, err := c.request(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	// the stream outlives any client timeout
+	client := *c.cfg.HTTPClient
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, responseError(resp, dm.ErrInvalidParameter)
+	}
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue // event names, signatures, heartbeats and blank separators
+		}
+		e, err := events.DecodeJSON([]byte(data))
+		if err != nil {
+			continue
+		}
+		select {
+		case ch <- e:
+			received = true
+		case <-ctx.Done():
+			return received, ctx.Err()
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return received, err
+	}
+	return received, fmt.Errorf("devicemgr: event stream closed: %w", dm.ErrBackendUnavailable)
+}
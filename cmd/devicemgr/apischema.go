@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	api "github.com/xmidt-org/talaria/devicemgr/internal/http"
+)
+
+// apischemaCmd writes the API payload definitions (see GET /api/schema) as TypeScript or JSON
+// Schema, for web dashboards to generate their types from at build time. --check fails when a
+// payload breaks the JSON conventions instead.
+func apischemaCmd(args []string) error {
+	fs := flag.NewFlagSet("apischema", flag.ExitOnError)
+	format := fs.String("format", "typescript", "typescript or jsonschema")
+	out := fs.String("out", "", "file to write (default stdout)")
+	check := fs.Bool("check", false, "only report fields breaking the JSON conventions")
+	fs.Parse(args)
+	doc := api.APISchema()
+	if *check {
+		problems := doc.Check()
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, p)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("%d fields break the JSON conventions", len(problems))
+		}
+		return nil
+	}
+	var b []byte
+	switch *format {
+	case "typescript", "ts":
+		b = doc.TypeScript()
+	case "jsonschema", "json":
+		var err error
+		if b, err = doc.JSONSchema(""); err != nil {
+			return err
+		}
+		b = append(b, '\n')
+	default:
+		return errors.New("--format must be typescript or jsonschema")
+	}
+	if *out == "" {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(*out, b, 0o644)
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/selector"
+)
+
+// paramFlags collects repeated --param name=value flags.
+type paramFlags []string
+
+func (p *paramFlags) String() string     { return strings.Join(*p, ",") }
+func (p *paramFlags) Set(v string) error { *p = append(*p, v); return nil }
+
+// bulkSet applies the same parameter assignments to every device in an input file, either in
+// process or as a job on a running server (--server). Completed devices are appended to a state
+// file so an interrupted run can be resumed by re-running the same command.
+func bulkSet(args []string) error {
+	c := newCommand("bulk set")
+	var params paramFlags
+	c.fs.Var(&params, "param", "name=value or name:type=value assignment (repeatable)")
+	input := c.fs.String("input", "", "device list: CSV (first column) or JSONL ({\"device\":...})")
+	sel := c.fs.String("select", "", "select the devices by expression instead, e.g. 'model == XB7 && tag:pilot'")
+	service := c.fs.String("service", "", "translation service (default: first configured)")
+	concurrency := c.fs.Int("concurrency", jobs.DefaultConcurrency, "devices worked in parallel")
+	rate := c.fs.Int("rate", 0, "devices started per minute (default: unpaced)")
+	batchSize := c.fs.Int("batch-size", 0, "devices per batch (default: one batch)")
+	soak := c.fs.Duration("soak", 0, "pause after each batch before starting the next")
+	statePath := c.fs.String("state", "", "resumable state file (default: <input>.state)")
+	report := c.fs.String("report", "", "write failures as CSV to this file (default: stderr)")
+	server := c.fs.String("server", os.Getenv("DEVICEMGR_SERVER"), "submit to a devicemgr server's /api/jobs instead of running locally")
+	authorization := c.fs.String("authorization", os.Getenv("DEVICEMGR_AUTHORIZATION"), "Authorization header sent to --server")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if (*input == "") == (*sel == "") || len(params) == 0 {
+		return errors.New("usage: bulk set --input <file> | --select <expr> --param name=value [--param ...]")
+	}
+	if *sel != "" && *statePath == "" {
+		return errors.New("bulk set --select needs --state to record progress in")
+	}
+	assignments, err := parseAssignments(params)
+	if err != nil {
+		return err
+	}
+	var devices []dm.DeviceID
+	if *sel != "" {
+		devices, err = c.selectDevices(*sel, *server, *authorization)
+	} else {
+		devices, err = readDevices(*input)
+	}
+	if err != nil {
+		return err
+	}
+	if *statePath == "" {
+		*statePath = *input + ".state"
+	}
+	spec := jobs.Spec{Operation: jobs.OperationSet, Service: *service, Concurrency: *concurrency, Rate: *rate, BatchSize: *batchSize}
+	if *soak > 0 {
+		spec.Soak = soak.String()
+	}
+	for _, a := range assignments {
+		spec.Parameters = append(spec.Parameters, jobs.Param{Name: a.Name, Value: a.Value, DataType: a.TypeHint})
+	}
+	state, err := openState(*statePath, specFingerprint(spec))
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+
+	for _, id := range devices {
+		if !state.succeeded[id] {
+			spec.Devices = append(spec.Devices, id)
+		}
+	}
+	skipped := len(devices) - len(spec.Devices)
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "resuming: %d of %d devices already done (%s)\n", skipped, len(devices), *statePath)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	bar := newProgressBar(len(devices), skipped)
+	var failures []jobs.DeviceResult
+	record := func(r jobs.DeviceResult) error {
+		if !r.OK {
+			failures = append(failures, r)
+		}
+		bar.add(r.OK)
+		return state.record(r)
+	}
+	if len(spec.Devices) > 0 {
+		if *server != "" {
+			err = bulkRemote(ctx, *server, *authorization, spec, record)
+		} else {
+			err = c.bulkLocal(ctx, spec, record)
+		}
+	}
+	bar.finish()
+	if rerr := writeFailures(*report, failures); rerr != nil && err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d devices failed; re-run to retry them", len(failures), len(spec.Devices))
+	}
+	return nil
+}
+
+func (c *command) bulkLocal(ctx context.Context, spec jobs.Spec, record func(jobs.DeviceResult) error) error {
+	m, err := c.manager()
+	if err != nil {
+		return err
+	}
+	op, err := jobs.SetParameters(m)(spec)
+	if err != nil {
+		return err
+	}
+	cfg, err := spec.RunConfig()
+	if err != nil {
+		return err
+	}
+	var recordErr error
+	cfg.OnResult = func(r jobs.DeviceResult, _ jobs.Progress) {
+		if e := record(r); e != nil && recordErr == nil {
+			recordErr = e
+		}
+	}
+	_, err = jobs.Run(ctx, spec.Devices, op, cfg)
+	if recordErr != nil {
+		return recordErr
+	}
+	return err
+}
+
+// selectDevices resolves a selector expression with the server's inventory and annotation labels,
+// or without a server against a local poll.
+func (c *command) selectDevices(expr, server, authorization string) ([]dm.DeviceID, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	if server != "" {
+		var out struct {
+			Devices []dm.DeviceID `json:"devices"`
+		}
+		endpoint := strings.TrimRight(server, "/") + "/api/devices/select?" + url.Values{"selector": {expr}}.Encode()
+		if err := doJSON(ctx, http.MethodGet, endpoint, authorization, nil, &out); err != nil {
+			return nil, fmt.Errorf("select devices: %w", err)
+		}
+		return out.Devices, nil
+	}
+	parsed, err := selector.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	m, err := c.manager()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.Poll(ctx); err != nil {
+		return nil, err
+	}
+	return selector.Select(ctx, m.DeviceAdapter(), parsed, nil), nil
+}
+
+// bulkRemote submits spec to the server and follows the job until it finishes, recording results as they appear.
+func bulkRemote(ctx context.Context, server, authorization string, spec jobs.Spec, record func(jobs.DeviceResult) error) error {
+	base := strings.TrimRight(server, "/") + "/api/jobs"
+	body, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	var job jobs.Job
+	if err := doJSON(ctx, http.MethodPost, base, authorization, body, &job); err != nil {
+		return fmt.Errorf("submit job: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "job %s submitted\n", job.ID)
+	seen := 0
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		for ; seen < len(job.Results); seen++ {
+			if err := record(job.Results[seen]); err != nil {
+				return err
+			}
+		}
+		switch job.Status {
+		case jobs.StatusSucceeded, jobs.StatusFailed:
+			return nil
+		case jobs.StatusCanceled:
+			return fmt.Errorf("job %s was canceled", job.ID)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped following job %s (it keeps running on the server): %w", job.ID, ctx.Err())
+		case <-ticker.C:
+		}
+		if err := doJSON(ctx, http.MethodGet, base+"/"+job.ID, authorization, nil, &job); err != nil {
+			return fmt.Errorf("job status: %w", err)
+		}
+	}
+}
+
+func doJSON(ctx context.Context, method, url, authorization string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// readDevices reads device IDs from a CSV file (first column; a "device"/"id" header row is skipped)
+// or, for .jsonl/.ndjson files, from {"device": ...} (or "id"/"deviceId") objects.
+func readDevices(path string) ([]dm.DeviceID, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []dm.DeviceID
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		sc := bufio.NewScanner(f)
+		for line := 1; sc.Scan(); line++ {
+			text := strings.TrimSpace(sc.Text())
+			if text == "" {
+				continue
+			}
+			var row struct {
+				Device   string `json:"device"`
+				DeviceID string `json:"deviceId"`
+				ID       string `json:"id"`
+			}
+			if err := json.Unmarshal([]byte(text), &row); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			id := firstNonEmpty(row.Device, row.DeviceID, row.ID)
+			if id == "" {
+				return nil, fmt.Errorf("%s:%d: no device field", path, line)
+			}
+			out = append(out, dm.DeviceID(id))
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	default:
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		rows, err := r.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for i, row := range rows {
+			if len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+				continue
+			}
+			id := strings.TrimSpace(row[0])
+			if i == 0 {
+				switch strings.ToLower(id) {
+				case "device", "deviceid", "id":
+					continue
+				}
+			}
+			out = append(out, dm.DeviceID(id))
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s: no devices", path)
+	}
+	return out, nil
+}
+
+func firstNonEmpty(v ...string) string {
+	for _, s := range v {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// stateFile is an append-only JSONL log of device results; the last record per device wins. Its
+// first line records the fingerprint of the operation the results belong to.
+type stateFile struct {
+	f         *os.File
+	succeeded map[dm.DeviceID]bool
+}
+
+type stateHeader struct {
+	Spec string `json:"spec"`
+}
+
+// specFingerprint identifies what a bulk run does to each device: the operation, service and
+// parameters, but not the device list or concurrency, which may change between resumes.
+func specFingerprint(spec jobs.Spec) string {
+	b, _ := json.Marshal(struct {
+		Operation  string       `json:"operation"`
+		Service    string       `json:"service"`
+		Parameters []jobs.Param `json:"parameters"`
+	}{spec.Operation, spec.Service, spec.Parameters})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// openState loads the results recorded at path for the operation fingerprinted by spec. A state
+// file written for a different operation is refused rather than resumed, since its successes say
+// nothing about the new one.
+func openState(path, spec string) (*stateFile, error) {
+	s := &stateFile{succeeded: make(map[dm.DeviceID]bool)}
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	lines := bytes.Split(b, []byte("\n"))
+	fresh := len(bytes.TrimSpace(b)) == 0
+	if !fresh {
+		var h stateHeader
+		if json.Unmarshal(lines[0], &h) != nil || h.Spec != spec {
+			return nil, fmt.Errorf("state file %s belongs to a different operation; remove it or pass another --state to start fresh", path)
+		}
+		for _, line := range lines[1:] {
+			var r jobs.DeviceResult
+			if json.Unmarshal(line, &r) == nil && r.Device != "" {
+				s.succeeded[r.Device] = r.OK
+			}
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.f = f
+	if fresh {
+		if err := s.write(stateHeader{Spec: spec}); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *stateFile) record(r jobs.DeviceResult) error { return s.write(r) }
+
+func (s *stateFile) write(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(append(b, '\n'))
+	return err
+}
+
+func (s *stateFile) Close() error { return s.f.Close() }
+
+// writeFailures writes a device,error,finishedAt CSV to path, or to stderr when path is empty.
+func writeFailures(path string, failures []jobs.DeviceResult) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	var w io.Writer = os.Stderr
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"device", "error", "finishedAt"})
+	for _, r := range failures {
+		cw.Write([]string{string(r.Device), r.Error, r.FinishedAt.Format(time.RFC3339)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// progressBar renders a single-line progress bar on stderr when it is a terminal, and a line
+// per 10% otherwise so logs stay readable.
+type progressBar struct {
+	total, done, failed int
+	tty                 bool
+	lastDecile          int
+}
+
+func newProgressBar(total, done int) *progressBar {
+	fi, err := os.Stderr.Stat()
+	return &progressBar{total: total, done: done, tty: err == nil && fi.Mode()&os.ModeCharDevice != 0}
+}
+
+func (p *progressBar) add(ok bool) {
+	p.done++
+	if !ok {
+		p.failed++
+	}
+	if p.tty {
+		const width = 30
+		filled := width * p.done / p.total
+		fmt.Fprintf(os.Stderr, "\r[%s%s] %d/%d failed=%d", strings.Repeat("#", filled), strings.Repeat(".", width-filled), p.done, p.total, p.failed)
+		return
+	}
+	if d := 10 * p.done / p.total; d > p.lastDecile {
+		p.lastDecile = d
+		fmt.Fprintf(os.Stderr, "progress: %d/%d failed=%d\n", p.done, p.total, p.failed)
+	}
+}
+
+func (p *progressBar) finish() {
+	if p.tty {
+		fmt.Fprintln(os.Stderr)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+	"github.com/xmidt-org/talaria/devicemgr/policy"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// command holds the flags shared by the one-shot CLI commands.
+type command struct {
+	fs      *flag.FlagSet
+	config  *string
+	output  *string
+	timeout *time.Duration
+	out     io.Writer
+}
+
+func newCommand(name string) *command {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return &command{
+		fs:      fs,
+		config:  configFlag(fs),
+		output:  fs.String("o", "table", "output format: table or json"),
+		timeout: fs.Duration("timeout", 30*time.Second, "overall command timeout"),
+		out:     os.Stdout,
+	}
+}
+
+// parse parses flags and validates the output format.
+func (c *command) parse(args []string) error {
+	c.fs.Parse(args)
+	if *c.output != "table" && *c.output != "json" {
+		return fmt.Errorf("unknown output format %q", *c.output)
+	}
+	return nil
+}
+
+// manager builds a Manager that talks to the backends directly. Shared Redis state is ignored so a
+// one-shot command never takes part in the serve replicas' leader election.
+func (c *command) manager() (*manager.Manager, error) {
+	opts, err := loadOptions(*c.config)
+	if err != nil {
+		return nil, err
+	}
+	opts.Cache.RedisURL = ""
+	return manager.New(opts)
+}
+
+func (c *command) context() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := context.WithTimeout(ctx, *c.timeout)
+	return ctx, func() { cancel(); stop() }
+}
+
+// render writes v as indented JSON, or as a table of header + rows.
+func (c *command) render(v interface{}, header []string, rows [][]string) error {
+	if *c.output == "json" {
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	return tw.Flush()
+}
+
+func devicesList(args []string) error {
+	c := newCommand("devices list")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	m, err := c.manager()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	if _, err := m.Poll(ctx); err != nil {
+		return err
+	}
+	devices := m.ListDevices(ctx)
+	type device struct {
+		ID       string   `json:"id"`
+		Online   bool     `json:"online"`
+		Partners []string `json:"partners,omitempty"`
+	}
+	out := make([]device, 0, len(devices))
+	rows := make([][]string, 0, len(devices))
+	for _, d := range devices {
+		partners := dm.SplitPartners(d.Metadata[dm.MetadataPartnerIDs])
+		out = append(out, device{ID: string(d.ID), Online: d.Online, Partners: partners})
+		rows = append(rows, []string{string(d.ID), fmt.Sprint(d.Online), strings.Join(partners, ",")})
+	}
+	return c.render(out, []string{"DEVICE", "ONLINE", "PARTNERS"}, rows)
+}
+
+func getParams(args []string) error {
+	c := newCommand("get")
+	service := c.fs.String("service", "", "translation service (default: first configured)")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if c.fs.NArg() < 2 {
+		return errors.New("usage: get [flags] <device> <names...>")
+	}
+	m, err := c.manager()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	values, err := m.GetParameters(ctx, dm.DeviceID(c.fs.Arg(0)), *service, c.fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(values))
+	for n := range values {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	rows := make([][]string, 0, len(names))
+	for _, n := range names {
+		v := values[n]
+		rows = append(rows, []string{n, fmt.Sprint(v.Value), v.Type})
+	}
+	return c.render(map[string]interface{}{"parameters": values}, []string{"NAME", "VALUE", "TYPE"}, rows)
+}
+
+func setParams(args []string) error {
+	c := newCommand("set")
+	service := c.fs.String("service", "", "translation service (default: first configured)")
+	dryRun := c.fs.Bool("dry-run", false, "validate and show the SET without sending it")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if c.fs.NArg() < 2 {
+		return errors.New("usage: set [flags] <device> name=value...")
+	}
+	params, err := parseAssignments(c.fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+	m, err := c.manager()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	res, err := m.SetParameters(ctx, dm.DeviceID(c.fs.Arg(0)), *service, params, dm.SetOptions{DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+	if d := res.DryRun; d != nil {
+		rows := make([][]string, 0, len(d.Parameters))
+		for _, p := range d.Parameters {
+			rows = append(rows, []string{p.Name, fmt.Sprint(p.Value), p.DataType, p.Outcome, p.Reason})
+		}
+		if *c.output == "table" {
+			fmt.Fprintf(c.out, "dry run: valid=%t device=%s", d.Valid, d.Device)
+			if d.Reason != "" {
+				fmt.Fprintf(c.out, " (%s)", d.Reason)
+			}
+			fmt.Fprintf(c.out, "\nendpoint: %s\npayload: %s\n\n", d.Endpoint, d.Payload)
+		}
+		return c.render(d, []string{"NAME", "VALUE", "TYPE", "OUTCOME", "REASON"}, rows)
+	}
+	rows := make([][]string, 0, len(res.Applied))
+	for _, n := range res.Applied {
+		rows = append(rows, []string{n})
+	}
+	return c.render(map[string]interface{}{"applied": res.Applied}, []string{"APPLIED"}, rows)
+}
+
+// parseAssignments parses name=value or name:type=value arguments; the type is passed through as
+// the WDMP dataType hint.
+func parseAssignments(args []string) ([]dm.SetParameter, error) {
+	params := make([]dm.SetParameter, 0, len(args))
+	for _, a := range args {
+		name, value, ok := strings.Cut(a, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid assignment %q: want name=value", a)
+		}
+		p := dm.SetParameter{Name: name, Value: value}
+		if n, hint, ok := strings.Cut(name, ":"); ok {
+			p.Name, p.TypeHint = n, hint
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+func rpc(args []string) error {
+	c := newCommand("rpc")
+	service := c.fs.String("service", manager.DefaultRPCService, "device service behind the Blizzard gateway")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if c.fs.NArg() < 2 || c.fs.NArg() > 3 {
+		return errors.New("usage: rpc [flags] <device> <method> [params-json]")
+	}
+	call := runtime.BlizzardCall{Method: c.fs.Arg(1), Timeout: *c.timeout}
+	if c.fs.NArg() == 3 {
+		var params interface{}
+		if err := json.Unmarshal([]byte(c.fs.Arg(2)), &params); err != nil {
+			return fmt.Errorf("params: %w", err)
+		}
+		call.Params = params
+	}
+	m, err := c.manager()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	res, err := m.Call(ctx, dm.DeviceID(c.fs.Arg(0)), *service, call)
+	if err != nil {
+		return err
+	}
+	if res.Error != nil {
+		return fmt.Errorf("rpc error %d: %s", res.Error.Code, res.Error.Message)
+	}
+	// results are arbitrary JSON; the table format prints them verbatim
+	if *c.output == "table" {
+		_, err = fmt.Fprintln(c.out, string(res.Result))
+		return err
+	}
+	return c.render(res.Result, nil, nil)
+}
+
+func policyResolve(args []string) error {
+	c := newCommand("policy resolve")
+	model := c.fs.String("model", "", "device model (default: read "+manager.ModelParameter+")")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if c.fs.NArg() != 1 {
+		return errors.New("usage: policy resolve [flags] <device>")
+	}
+	m, err := c.manager()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	var fp *policy.FirmwarePolicy
+	if *model != "" {
+		fp, err = m.ResolveFirmware(ctx, *model)
+	} else {
+		fp, err = m.DeviceFirmware(ctx, dm.DeviceID(c.fs.Arg(0)))
+	}
+	if err != nil {
+		return err
+	}
+	return c.render(fp, []string{"ID", "VERSION", "MODEL", "DOWNLOAD URL"}, [][]string{{fp.ID, fp.Version, fp.Model, fp.DownloadURL}})
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/client"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+	"github.com/xmidt-org/talaria/devicemgr/translate"
+)
+
+func TestParseAssignments(t *testing.T) {
+	params, err := parseAssignments([]string{"Device.A=1", "Device.B:3=true", "Device.C=x=y"})
+	if err != nil {
+		t.Fatalf("parseAssignments: %v", err)
+	}
+	if params[0].Name != "Device.A" || params[0].Value != "1" || params[0].TypeHint != "" {
+		t.Fatalf("unexpected plain assignment: %+v", params[0])
+	}
+	if params[1].Name != "Device.B" || params[1].TypeHint != "3" || params[1].Value != "true" {
+		t.Fatalf("unexpected typed assignment: %+v", params[1])
+	}
+	if params[2].Value != "x=y" {
+		t.Fatalf("value should keep later '=': %+v", params[2])
+	}
+	if _, err := parseAssignments([]string{"Device.A"}); err == nil {
+		t.Fatal("expected error for missing '='")
+	}
+}
+
+func TestLoadOptionsFileAndEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devicemgr.json")
+	cfg := `{"talariaUrl":"http://t:6200","tr1d1umUrl":"http://file/api/v3","services":["config","iot"],"auth":{"tr1d1um":"Bearer abc"}}`
+	if err := os.WriteFile(path, []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DEVICEMGR_TR1D1UM_URL", "http://env/api/v3")
+	opts, err := loadOptions(path)
+	if err != nil {
+		t.Fatalf("loadOptions: %v", err)
+	}
+	if opts.TalariaBaseURL != "http://t:6200" || opts.Tr1d1umBaseURL != "http://env/api/v3" {
+		t.Fatalf("unexpected urls: %q %q", opts.TalariaBaseURL, opts.Tr1d1umBaseURL)
+	}
+	if len(opts.Services) != 2 {
+		t.Fatalf("services not loaded: %v", opts.Services)
+	}
+	if v, _ := opts.Auth.Tr1d1um.AuthorizationValue(); v != "Bearer abc" {
+		t.Fatalf("tr1d1um auth = %q", v)
+	}
+	if v, _ := opts.Auth.Talaria.AuthorizationValue(); v != defaultAuth {
+		t.Fatalf("talaria auth should default, got %q", v)
+	}
+}
+
+func TestLoadOptionsProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devicemgr.json")
+	if err := os.WriteFile(path, []byte(`{"profile":"dev","verbose":false,"timeouts":{"get":"20s"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := loadOptions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the file overrides the preset's verbose logging and read timeout only
+	if opts.Profile != dm.ProfileDev || opts.Verbose || opts.GetTimeout != 20*time.Second || opts.SetTimeout != 5*time.Second || !opts.HTTP.InsecureSkipVerify {
+		t.Fatalf("dev options %+v", opts)
+	}
+	t.Setenv("DEVICEMGR_PROFILE", "prod")
+	if opts, err := loadOptions(path); err != nil || opts.HTTP.InsecureSkipVerify || opts.SetTimeout != dm.DefaultSetTimeout {
+		t.Fatalf("env profile: %+v, %v", opts, err)
+	}
+	t.Setenv("DEVICEMGR_PROFILE", "qa")
+	if _, err := loadOptions(path); err == nil {
+		t.Fatal("unknown profile accepted")
+	}
+}
+
+func TestLoadOptionsPollIntervalSetsLease(t *testing.T) {
+	t.Setenv("DEVICEMGR_POLL_INTERVAL", "20s")
+	opts, err := loadOptions("")
+	if err != nil {
+		t.Fatalf("loadOptions: %v", err)
+	}
+	if opts.Polling.DeviceList != 20*time.Second || opts.Polling.Lease() != time.Minute {
+		t.Fatalf("interval %v lease %v", opts.Polling.DeviceList, opts.Polling.Lease())
+	}
+	t.Setenv("DEVICEMGR_POLL_INTERVAL", "soon")
+	if _, err := loadOptions(""); err == nil {
+		t.Fatal("invalid interval accepted")
+	}
+}
+
+func TestWatchStreamPrintsEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("kind") != "offline" {
+			t.Errorf("kind filter not forwarded: %q", r.URL.RawQuery)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": ping\n\nevent: offline\ndata: {\"kind\":\"offline\",\"deviceId\":\"mac:aa\",\"occurredAt\":\"2024-01-01T00:00:00Z\"}\n\n")
+	}))
+	defer srv.Close()
+	c := newCommand("watch")
+	if err := c.parse([]string{"-o", "json"}); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	c.out = &out
+	if err := c.stream(context.Background(), srv.URL+"/api/events?kind=offline", ""); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Fatalf("expected stream closed error, got %v", err)
+	}
+	if !strings.Contains(out.String(), `"deviceId":"mac:aa"`) {
+		t.Fatalf("event not printed: %q", out.String())
+	}
+}
+
+func TestReadDevicesAndResumeState(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "devices.csv")
+	os.WriteFile(csvPath, []byte("device,site\nmac:aa,lab\n\nmac:bb\n"), 0o600)
+	ids, err := readDevices(csvPath)
+	if err != nil || len(ids) != 2 || ids[0] != "mac:aa" || ids[1] != "mac:bb" {
+		t.Fatalf("csv devices = %v, %v", ids, err)
+	}
+	jsonlPath := filepath.Join(dir, "devices.jsonl")
+	os.WriteFile(jsonlPath, []byte(`{"device":"mac:aa"}`+"\n"+`{"id":"mac:cc"}`+"\n"), 0o600)
+	if ids, err = readDevices(jsonlPath); err != nil || len(ids) != 2 || ids[1] != "mac:cc" {
+		t.Fatalf("jsonl devices = %v, %v", ids, err)
+	}
+
+	statePath := filepath.Join(dir, "devices.state")
+	spec := specFingerprint(jobs.Spec{Operation: jobs.OperationSet, Parameters: []jobs.Param{{Name: "Device.X", Value: "1"}}})
+	st, err := openState(statePath, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.record(jobs.DeviceResult{Device: "mac:aa", OK: false, Error: "timeout"})
+	st.record(jobs.DeviceResult{Device: "mac:aa", OK: true})
+	st.record(jobs.DeviceResult{Device: "mac:bb", OK: false})
+	st.Close()
+	if st, err = openState(statePath, spec); err != nil {
+		t.Fatal(err)
+	}
+	if !st.succeeded["mac:aa"] || st.succeeded["mac:bb"] {
+		t.Fatalf("resume state = %v", st.succeeded)
+	}
+	st.Close()
+
+	// a different value, or a state file without a fingerprint, must not be resumed
+	other := specFingerprint(jobs.Spec{Operation: jobs.OperationSet, Parameters: []jobs.Param{{Name: "Device.X", Value: "2"}}})
+	if other == spec {
+		t.Fatal("fingerprint ignores parameter values")
+	}
+	if _, err := openState(statePath, other); err == nil || !strings.Contains(err.Error(), "different operation") {
+		t.Fatalf("mismatched state resumed: %v", err)
+	}
+	legacy := filepath.Join(dir, "legacy.state")
+	os.WriteFile(legacy, []byte(`{"device":"mac:aa","ok":true}`+"\n"), 0o600)
+	if _, err := openState(legacy, spec); err == nil {
+		t.Fatal("state without a fingerprint resumed")
+	}
+	if concurrency := specFingerprint(jobs.Spec{Operation: jobs.OperationSet, Concurrency: 8, Devices: []dm.DeviceID{"mac:zz"}, Parameters: []jobs.Param{{Name: "Device.X", Value: "1"}}}); concurrency != spec {
+		t.Fatal("fingerprint depends on concurrency or the device list")
+	}
+}
+
+func TestWatchConfigReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devicemgr.json")
+	write := func(cfg string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(cfg), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"services":["config"]}`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	loaded := make(chan dm.Options, 4)
+	go watchConfig(ctx, path, 10*time.Millisecond, func(o dm.Options) { loaded <- o })
+	time.Sleep(50 * time.Millisecond) // let the watcher record the initial version
+
+	// an unparsable file keeps the running configuration
+	write(`{"services":`)
+	write(`{"services":["config","wifi"],"corsOrigins":["https://ui.example"],"cache":{"paramTtl":"1m"}}`)
+	select {
+	case o := <-loaded:
+		if len(o.Services) != 2 || len(o.CORSOrigins) != 1 || o.Cache.ParamTTL != time.Minute {
+			t.Fatalf("reloaded %+v", o)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("config change not reloaded")
+	}
+}
+
+func TestExportDownload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "jsonl" || r.Header.Get("Authorization") != "Bearer t" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintln(w, `{"id":"mac:000000000001"}`)
+	}))
+	defer srv.Close()
+	c := newCommand("devices export")
+	var out bytes.Buffer
+	c.out = &out
+	if err := c.download(context.Background(), srv.URL+"/api/devices/export?format=jsonl", "Bearer t"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != `{"id":"mac:000000000001"}`+"\n" {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	if err := c.download(context.Background(), srv.URL+"/api/devices/export?format=csv", ""); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("expected a 400 error, got %v", err)
+	}
+}
+
+func TestExplainFault(t *testing.T) {
+	var out bytes.Buffer
+	err := &translate.StatusError{Status: 520, Fault: 9008, Message: "Parameter is not writable", Parameter: "Device.DeviceInfo.SerialNumber"}
+	explainFault(&out, fmt.Errorf("set: %w", err), "fr_FR.UTF-8")
+	if got := out.String(); !strings.Contains(got, "parameter_not_writable (9008): Le paramètre est en lecture seule.") || !strings.Contains(got, "parameter: Device.DeviceInfo.SerialNumber") || !strings.Contains(got, "remediation: Retirez") {
+		t.Fatalf("local fault:\n%s", got)
+	}
+
+	// a server's description is re-localized
+	out.Reset()
+	explainFault(&out, &client.Error{Status: 503, WDMP: &translate.ErrorDescription{Code: 9005, Name: "invalid_parameter_name", Message: "The device does not have a parameter by this name.", Language: "en"}}, "es")
+	if got := out.String(); !strings.Contains(got, "invalid_parameter_name (9005): El dispositivo no tiene") {
+		t.Fatalf("server fault:\n%s", got)
+	}
+
+	out.Reset()
+	explainFault(&out, dm.ErrDeviceNotFound, "en")
+	if out.Len() != 0 {
+		t.Fatalf("no fault explained as %q", out.String())
+	}
+}
+
+func TestStartupPreflight(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = down.URL
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	ctx := context.Background()
+	if err := startupPreflight(ctx, m, "warn"); err != nil {
+		t.Fatalf("warn: %v", err)
+	}
+	if err := startupPreflight(ctx, m, "strict"); err == nil || !strings.Contains(err.Error(), "1 checks failed") {
+		t.Fatalf("strict: %v", err)
+	}
+	if err := startupPreflight(ctx, m, "loud"); err == nil {
+		t.Fatal("unknown mode accepted")
+	}
+}
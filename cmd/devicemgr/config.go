@@ -0,0 +1,386 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/enrichment"
+	"github.com/xmidt-org/talaria/devicemgr/schema"
+)
+
+// defaultAuth is used for any backend without a configured Authorization value.
+const defaultAuth = "Basic dXNlcjpwYXNz"
+
+// fileConfig is the JSON config file (--config or DEVICEMGR_CONFIG). Environment variables
+// override file values so existing deployments keep working unchanged.
+type fileConfig struct {
+	Profile      string   `json:"profile"` // dev, stage or prod (default): the preset defaults start from
+	Verbose      *bool    `json:"verbose"` // log every backend request; on in the dev and stage profiles
+	TalariaURL   string   `json:"talariaUrl"`
+	Tr1d1umURL   string   `json:"tr1d1umUrl"` // should include /api/v3
+	XconfURL     string   `json:"xconfUrl"`
+	BlizzardURL  string   `json:"blizzardUrl"`
+	CodexURL     string   `json:"codexUrl"` // Gungnir
+	RedisURL     string   `json:"redisUrl"`
+	Services     []string `json:"services"`
+	MaxGetNames  int      `json:"maxGetNames"`  // parameter names per Tr1d1um GET before reads are chunked
+	Catalog      string   `json:"catalog"`      // parameter catalog file checking dry-run SETs; built-in when empty
+	PollInterval string   `json:"pollInterval"` // Go duration; device list poll and leadership lease cadence
+	OfflineAfter int      `json:"offlineAfter"` // consecutive missed polls before a device is offline
+	StatSuspects bool     `json:"statSuspects"`
+	CORSOrigins  []string `json:"corsOrigins"`   // browser origins allowed to call the API; empty allows any
+	ErrorLang    string   `json:"errorLanguage"` // language of the device fault descriptions in API errors
+	Auth         struct {
+		Talaria  string `json:"talaria"`
+		Tr1d1um  string `json:"tr1d1um"`
+		Xconf    string `json:"xconf"`
+		Blizzard string `json:"blizzard"`
+		Codex    string `json:"codex"`
+		Caduceus string `json:"caduceus"`
+	} `json:"auth"` // Authorization header values
+	MQTT        dm.MQTTConfig        `json:"mqtt"`
+	Traps       dm.TrapConfig        `json:"traps"` // trap ingestion bridge (DEVICEMGR_TRAP_ADDR)
+	Maintenance dm.MaintenanceConfig `json:"maintenance"`
+	Allowlist   dm.AllowlistConfig   `json:"allowlist"` // client networks allowed to reach the APIs
+	Metrics     dm.MetricsConfig     `json:"metrics"`   // label cardinality of /metrics
+	Redaction   dm.RedactionConfig   `json:"redaction"` // sensitive parameters masked in events and audit records
+	HTTP        struct {
+		MaxIdleConnsPerHost int    `json:"maxIdleConnsPerHost"`
+		MaxConnsPerHost     int    `json:"maxConnsPerHost"`
+		IdleConnTimeout     string `json:"idleConnTimeout"` // Go duration
+		DisableHTTP2        bool   `json:"disableHttp2"`
+		InsecureSkipVerify  *bool  `json:"insecureSkipVerify"` // on in the dev profile
+	} `json:"http"` // backend connection pool
+	JWT struct {
+		HMACSecret string `json:"hmacSecret"`
+		JWKSURL    string `json:"jwksUrl"`
+		Issuer     string `json:"issuer"`
+		Audience   string `json:"audience"`
+	} `json:"jwt"` // bearer token verification keys
+	USP struct {
+		EndpointID      string `json:"endpointId"`
+		ControllerTopic string `json:"controllerTopic"`
+		AgentTopic      string `json:"agentTopic"`
+		Timeout         string `json:"timeout"` // Go duration
+	} `json:"usp"` // TR-369 controller
+	Caduceus struct {
+		URL         string   `json:"url"`
+		CallbackURL string   `json:"callbackUrl"`
+		Secret      string   `json:"secret"`
+		Events      []string `json:"events"`
+		Duration    string   `json:"duration"` // Go duration
+	} `json:"caduceus"` // webhook event delivery (DEVICEMGR_CADUCEUS_ADDR)
+	Routing struct {
+		Enabled    bool   `json:"enabled"`
+		PetasosURL string `json:"petasosUrl"`
+		TTL        string `json:"ttl"` // Go duration
+		Failures   int    `json:"failures"`
+		Cooldown   string `json:"cooldown"` // Go duration
+		Predict    bool   `json:"predict"`  // place devices on talariaInstances instead of asking
+	} `json:"routing"` // Blizzard dials to the Talaria instance holding each device
+	Faults struct {
+		Enabled       bool     `json:"enabled"`
+		Latency       string   `json:"latency"` // Go duration
+		LatencyRate   float64  `json:"latencyRate"`
+		ErrorRate     float64  `json:"errorRate"`
+		ErrorStatus   int      `json:"errorStatus"`
+		MalformedRate float64  `json:"malformedRate"`
+		DropRate      float64  `json:"dropRate"`
+		Hosts         []string `json:"hosts"`
+	} `json:"faults"` // fault injection for resilience testing; never in production
+	Timeouts struct {
+		Get    string `json:"get"`
+		Set    string `json:"set"`
+		RPC    string `json:"rpc"`
+		Policy string `json:"policy"`
+	} `json:"timeouts"` // per-operation Go durations
+	RPC struct {
+		// CancelMethod is the JSON-RPC notification sent to a device when one of its calls is
+		// canceled or times out; empty sends none
+		CancelMethod string `json:"cancelMethod"`
+	} `json:"rpc"`
+	Retry struct {
+		MaxAttempts int     `json:"maxAttempts"`
+		Backoff     string  `json:"backoff"`    // Go duration
+		MaxBackoff  string  `json:"maxBackoff"` // Go duration
+		Jitter      float64 `json:"jitter"`
+		// MaxRetryAfter is the longest backend Retry-After waited out (Go duration)
+		MaxRetryAfter string `json:"maxRetryAfter"`
+	} `json:"retry"` // idempotent backend requests; unset fields keep the defaults
+	Breaker struct {
+		Failures int    `json:"failures"` // negative disables the breaker
+		Window   string `json:"window"`   // Go duration
+		Cooldown string `json:"cooldown"` // Go duration
+	} `json:"breaker"` // per-device circuit breaker; unset fields keep the defaults
+	Events struct {
+		DedupWindow string            `json:"dedupWindow"` // Go duration; negative disables
+		SigningKeys map[string]string `json:"signingKeys"` // SSE signing keys by ID
+		JournalSize int               `json:"journalSize"` // events kept for the change feed
+		Pipeline    []dm.EventStage   `json:"pipeline"`    // applied to every event before fan-out
+	} `json:"events"`
+	Cache struct {
+		ParamTTL     string `json:"paramTtl"`
+		PolicyTTL    string `json:"policyTtl"`
+		ConfigTTL    string `json:"configTtl"`
+		CIDParameter string `json:"cidParameter"` // configuration CID read by the config endpoint
+	} `json:"cache"` // Go durations; zero disables a cache
+	Quality struct {
+		Interval string   `json:"interval"` // Go duration; enables the collector
+		Devices  []string `json:"devices"`  // sampled every round; empty samples online devices at random
+		Sample   int      `json:"sample"`
+	} `json:"quality"` // Talaria connection quality scores
+	Stats struct {
+		Retention string `json:"retention"` // Go duration; samples kept for /api/stats/history
+	} `json:"stats"`
+	Enrichment struct {
+		URL           string `json:"url"`  // JSON inventory endpoint
+		File          string `json:"file"` // or a CSV inventory file
+		Authorization string `json:"authorization"`
+		Interval      string `json:"interval"` // Go duration
+	} `json:"enrichment"` // external inventory attributes merged into device metadata
+	ParameterACL map[string]dm.ParameterRule `json:"parameterAcl"` // by role name: parameters each role may read and write
+	Approvals    dm.ApprovalConfig           `json:"approvals"`    // bulk jobs held for a second admin's approval
+	Artifacts    struct {
+		dm.ArtifactConfig
+		TTL string `json:"ttl"` // Go duration; artifacts kept in Redis
+	} `json:"artifacts"` // bulk job artifact storage; an S3-compatible bucket when bucket is set
+	Notifications struct {
+		dm.NotificationConfig
+		OutageAfter string `json:"outageAfter"` // Go duration a backend fails before backend.outage
+		CheckEvery  string `json:"checkEvery"`  // Go duration between backend checks
+	} `json:"notifications"` // job, rollout and outage notifications
+	TalariaInstances []string           `json:"talariaInstances"` // Talaria instance base URLs polled instead of talariaUrl's device list
+	OperationWait    string             `json:"operationWait"`    // Go duration an exclusive device operation queues behind another; zero rejects it
+	DataModel        dm.DataModelConfig `json:"dataModel"`        // how devices' data-model versions are learned, for catalog version paths
+}
+
+// configFlag registers the shared --config flag on fs.
+func configFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", os.Getenv("DEVICEMGR_CONFIG"), "JSON config file")
+}
+
+// loadOptions builds Options from defaults, the optional config file and environment overrides.
+func loadOptions(path string) (dm.Options, error) {
+	cfg := fileConfig{TalariaURL: "http://talaria:6200"}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return dm.Options{}, fmt.Errorf("config: %w", err)
+		}
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return dm.Options{}, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	override(&cfg.Profile, "DEVICEMGR_PROFILE")
+	override(&cfg.TalariaURL, "DEVICEMGR_TALARIA_URL")
+	override(&cfg.Tr1d1umURL, "DEVICEMGR_TR1D1UM_URL")
+	override(&cfg.XconfURL, "DEVICEMGR_XCONF_URL")
+	override(&cfg.BlizzardURL, "DEVICEMGR_BLIZZARD_URL")
+	override(&cfg.CodexURL, "DEVICEMGR_CODEX_URL")
+	override(&cfg.RedisURL, "DEVICEMGR_REDIS_URL")
+	override(&cfg.MQTT.Broker, "DEVICEMGR_MQTT_BROKER")
+	override(&cfg.Caduceus.URL, "DEVICEMGR_CADUCEUS_URL")
+	override(&cfg.Caduceus.CallbackURL, "DEVICEMGR_CADUCEUS_CALLBACK_URL")
+	override(&cfg.Routing.PetasosURL, "DEVICEMGR_PETASOS_URL")
+	override(&cfg.PollInterval, "DEVICEMGR_POLL_INTERVAL")
+	override(&cfg.USP.EndpointID, "DEVICEMGR_USP_ENDPOINT_ID")
+	override(&cfg.JWT.HMACSecret, "DEVICEMGR_JWT_HMAC_SECRET")
+	override(&cfg.JWT.JWKSURL, "DEVICEMGR_JWKS_URL")
+	override(&cfg.JWT.Issuer, "DEVICEMGR_JWT_ISSUER")
+	override(&cfg.JWT.Audience, "DEVICEMGR_JWT_AUDIENCE")
+	override(&cfg.Artifacts.AccessKeyID, "DEVICEMGR_ARTIFACTS_ACCESS_KEY_ID")
+	override(&cfg.Artifacts.SecretAccessKey, "DEVICEMGR_ARTIFACTS_SECRET_ACCESS_KEY")
+
+	opts, err := dm.PresetOptions(cfg.Profile)
+	if err != nil {
+		return dm.Options{}, fmt.Errorf("config profile: %w", err)
+	}
+	if cfg.Verbose != nil {
+		opts.Verbose = *cfg.Verbose
+	}
+	opts.TalariaBaseURL = cfg.TalariaURL
+	opts.Tr1d1umBaseURL = cfg.Tr1d1umURL
+	opts.XconfAdminBaseURL = cfg.XconfURL
+	opts.BlizzardBaseURL = cfg.BlizzardURL
+	opts.CodexBaseURL = cfg.CodexURL
+	opts.Cache.RedisURL = cfg.RedisURL
+	opts.Services = cfg.Services
+	opts.MaxGetNames = cfg.MaxGetNames
+	opts.Cache.ConfigCIDParameter = cfg.Cache.CIDParameter
+	opts.CORSOrigins = cfg.CORSOrigins
+	opts.ErrorLanguage = cfg.ErrorLang
+	if cfg.OfflineAfter != 0 {
+		opts.Polling.OfflineAfter = cfg.OfflineAfter
+	}
+	opts.Polling.StatSuspects = cfg.StatSuspects
+	opts.Polling.Instances = cfg.TalariaInstances
+	opts.MQTT = cfg.MQTT
+	opts.Maintenance = cfg.Maintenance
+	opts.Allowlist = cfg.Allowlist
+	opts.Traps = cfg.Traps
+	opts.Metrics = cfg.Metrics
+	opts.Redaction = cfg.Redaction
+	opts.Approvals = cfg.Approvals
+	opts.DataModel = cfg.DataModel
+	opts.Artifacts = cfg.Artifacts.ArtifactConfig
+	opts.Notifications = cfg.Notifications.NotificationConfig
+	for name, rule := range cfg.ParameterACL {
+		role, ok := dm.ParseRole(name)
+		if !ok {
+			return dm.Options{}, fmt.Errorf("config parameterAcl: unknown role %q", name)
+		}
+		if opts.ParameterACL == nil {
+			opts.ParameterACL = make(map[dm.Role]dm.ParameterRule)
+		}
+		opts.ParameterACL[role] = rule
+	}
+	opts.RPCCancelMethod = cfg.RPC.CancelMethod
+	if cfg.Catalog != "" {
+		c, err := schema.Load(cfg.Catalog)
+		if err != nil {
+			return dm.Options{}, fmt.Errorf("config catalog: %w", err)
+		}
+		opts.Catalog = c
+	}
+	opts.Caduceus = dm.CaduceusConfig{URL: cfg.Caduceus.URL, CallbackURL: cfg.Caduceus.CallbackURL, Secret: cfg.Caduceus.Secret, Events: cfg.Caduceus.Events}
+	opts.Routing = dm.RoutingConfig{Enabled: cfg.Routing.Enabled || cfg.Routing.PetasosURL != "", PetasosURL: cfg.Routing.PetasosURL, Failures: cfg.Routing.Failures, Predict: cfg.Routing.Predict}
+	f := cfg.Faults
+	opts.Faults = dm.FaultConfig{Enabled: f.Enabled, LatencyRate: f.LatencyRate, ErrorRate: f.ErrorRate, ErrorStatus: f.ErrorStatus, MalformedRate: f.MalformedRate, DropRate: f.DropRate, Hosts: f.Hosts}
+	if cfg.PollInterval != "" {
+		d, err := time.ParseDuration(cfg.PollInterval)
+		if err != nil || d <= 0 {
+			return dm.Options{}, fmt.Errorf("config pollInterval: invalid duration %q", cfg.PollInterval)
+		}
+		opts.Polling.DeviceList = d
+	}
+	opts.USP = dm.USPConfig{EndpointID: cfg.USP.EndpointID, ControllerTopic: cfg.USP.ControllerTopic, AgentTopic: cfg.USP.AgentTopic}
+	if cfg.USP.Timeout != "" {
+		d, err := time.ParseDuration(cfg.USP.Timeout)
+		if err != nil {
+			return dm.Options{}, fmt.Errorf("config usp.timeout: %w", err)
+		}
+		opts.USP.Timeout = d
+	}
+	if cfg.Retry.MaxAttempts != 0 {
+		opts.Retry.MaxAttempts = cfg.Retry.MaxAttempts
+	}
+	if cfg.Breaker.Failures != 0 {
+		opts.Breaker.Failures = cfg.Breaker.Failures
+	}
+	if cfg.Retry.Jitter != 0 {
+		opts.Retry.Jitter = cfg.Retry.Jitter
+	}
+	for _, d := range []struct {
+		key string
+		val string
+		dst *time.Duration
+	}{
+		{"retry.backoff", cfg.Retry.Backoff, &opts.Retry.Backoff},
+		{"retry.maxBackoff", cfg.Retry.MaxBackoff, &opts.Retry.MaxBackoff},
+		{"retry.maxRetryAfter", cfg.Retry.MaxRetryAfter, &opts.Retry.MaxRetryAfter},
+		{"breaker.window", cfg.Breaker.Window, &opts.Breaker.Window},
+		{"breaker.cooldown", cfg.Breaker.Cooldown, &opts.Breaker.Cooldown},
+		{"cache.paramTtl", cfg.Cache.ParamTTL, &opts.Cache.ParamTTL},
+		{"cache.policyTtl", cfg.Cache.PolicyTTL, &opts.Cache.PolicyTTL},
+		{"cache.configTtl", cfg.Cache.ConfigTTL, &opts.Cache.ConfigTTL},
+		{"timeouts.get", cfg.Timeouts.Get, &opts.GetTimeout},
+		{"timeouts.set", cfg.Timeouts.Set, &opts.SetTimeout},
+		{"timeouts.rpc", cfg.Timeouts.RPC, &opts.RPCTimeout},
+		{"timeouts.policy", cfg.Timeouts.Policy, &opts.PolicyTimeout},
+		{"caduceus.duration", cfg.Caduceus.Duration, &opts.Caduceus.Duration},
+		{"routing.ttl", cfg.Routing.TTL, &opts.Routing.TTL},
+		{"routing.cooldown", cfg.Routing.Cooldown, &opts.Routing.Cooldown},
+		{"faults.latency", cfg.Faults.Latency, &opts.Faults.Latency},
+		{"quality.interval", cfg.Quality.Interval, &opts.Quality.Interval},
+		{"enrichment.interval", cfg.Enrichment.Interval, &opts.Enrichment.Interval},
+		{"artifacts.ttl", cfg.Artifacts.TTL, &opts.Artifacts.TTL},
+		{"notifications.outageAfter", cfg.Notifications.OutageAfter, &opts.Notifications.OutageAfter},
+		{"notifications.checkEvery", cfg.Notifications.CheckEvery, &opts.Notifications.CheckEvery},
+		{"operationWait", cfg.OperationWait, &opts.Serializer.Wait},
+	} {
+		if d.val == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.val)
+		if err != nil {
+			return dm.Options{}, fmt.Errorf("config %s: %w", d.key, err)
+		}
+		*d.dst = v
+	}
+	opts.Quality.Sample = cfg.Quality.Sample
+	switch e := cfg.Enrichment; {
+	case e.URL != "" && e.File != "":
+		return dm.Options{}, errors.New("config enrichment: set url or file, not both")
+	case e.URL != "":
+		var auth dm.AuthStrategy
+		if e.Authorization != "" {
+			auth = dm.StaticAuth{Value: e.Authorization}
+		}
+		opts.Enrichment.Source = enrichment.NewHTTPSource(e.URL, auth)
+	case e.File != "":
+		opts.Enrichment.Source = enrichment.NewCSVFile(e.File)
+	}
+	for _, v := range cfg.Quality.Devices {
+		id, err := dm.ParseDeviceID(v)
+		if err != nil {
+			return dm.Options{}, fmt.Errorf("config quality.devices: %w", err)
+		}
+		opts.Quality.Devices = append(opts.Quality.Devices, id)
+	}
+	if cfg.Events.DedupWindow != "" {
+		d, err := time.ParseDuration(cfg.Events.DedupWindow)
+		if err != nil {
+			return dm.Options{}, fmt.Errorf("config events.dedupWindow: %w", err)
+		}
+		opts.Events.DedupWindow = d
+	}
+	if cfg.Stats.Retention != "" {
+		d, err := time.ParseDuration(cfg.Stats.Retention)
+		if err != nil {
+			return dm.Options{}, fmt.Errorf("config stats.retention: %w", err)
+		}
+		opts.StatsRetention = d
+	}
+	opts.Events.SigningKeys = cfg.Events.SigningKeys
+	opts.Events.JournalSize = cfg.Events.JournalSize
+	opts.Events.Pipeline = cfg.Events.Pipeline
+	opts.HTTP.MaxIdleConnsPerHost = cfg.HTTP.MaxIdleConnsPerHost
+	opts.HTTP.MaxConnsPerHost = cfg.HTTP.MaxConnsPerHost
+	opts.HTTP.DisableHTTP2 = cfg.HTTP.DisableHTTP2
+	if cfg.HTTP.InsecureSkipVerify != nil {
+		opts.HTTP.InsecureSkipVerify = *cfg.HTTP.InsecureSkipVerify
+	}
+	if cfg.HTTP.IdleConnTimeout != "" {
+		d, err := time.ParseDuration(cfg.HTTP.IdleConnTimeout)
+		if err != nil {
+			return dm.Options{}, fmt.Errorf("config http.idleConnTimeout: %w", err)
+		}
+		opts.HTTP.IdleConnTimeout = d
+	}
+	opts.JWT = dm.JWTConfig{HMACSecret: cfg.JWT.HMACSecret, JWKSURL: cfg.JWT.JWKSURL, Issuer: cfg.JWT.Issuer, Audience: cfg.JWT.Audience}
+	opts.Auth.Talaria = authValue(cfg.Auth.Talaria)
+	opts.Auth.Tr1d1um = authValue(cfg.Auth.Tr1d1um)
+	opts.Auth.XconfAdmin = authValue(cfg.Auth.Xconf)
+	opts.Auth.Blizzard = authValue(cfg.Auth.Blizzard)
+	opts.Auth.Codex = authValue(cfg.Auth.Codex)
+	opts.Auth.Caduceus = authValue(cfg.Auth.Caduceus)
+	return opts, nil
+}
+
+func override(dst *string, env string) {
+	if v := os.Getenv(env); v != "" {
+		*dst = v
+	}
+}
+
+func authValue(v string) dm.AuthStrategy {
+	if v == "" {
+		v = defaultAuth
+	}
+	return dm.StaticAuth{Value: v}
+}
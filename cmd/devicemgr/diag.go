@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/diagnostics"
+)
+
+const diagUsage = "usage: diag speedtest|traceroute|wifiscan [flags] <device> [host]"
+
+// diag runs a device diagnostic through the configured Blizzard gateway (or MQTT broker), printing
+// progress to stderr and the normalized result to stdout.
+func diag(args []string) error {
+	if len(args) == 0 {
+		return errors.New(diagUsage)
+	}
+	kind, err := diagnostics.ParseKind(args[0])
+	if err != nil {
+		return err
+	}
+	c := newCommand("diag " + args[0])
+	*c.timeout = 3 * time.Minute // diagnostics run longer than the usual one-shot command
+	service := c.fs.String("service", "", "device service behind the gateway (default: manager default)")
+	server := c.fs.String("server", "", "speedtest: server to test against")
+	maxHops := c.fs.Int("max-hops", 0, "traceroute: maximum hops")
+	band := c.fs.String("band", "", "wifiscan: only networks on this band (2.4GHz, 5GHz, 6GHz)")
+	quiet := c.fs.Bool("q", false, "do not print progress")
+	if err := c.parse(args[1:]); err != nil {
+		return err
+	}
+	want := 1
+	if kind == diagnostics.Traceroute {
+		want = 2
+	}
+	if c.fs.NArg() != want {
+		return errors.New(diagUsage)
+	}
+	m, err := c.manager()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	var progress func(diagnostics.Progress)
+	if !*quiet {
+		progress = func(p diagnostics.Progress) {
+			fmt.Fprintf(os.Stderr, "%5.1f%% %s %s\n", p.Percent, p.Stage, p.Message)
+		}
+	}
+	runner := diagnostics.NewRunner(m, diagnostics.Config{Service: *service})
+	id := dm.DeviceID(c.fs.Arg(0))
+	switch kind {
+	case diagnostics.SpeedTest:
+		res, err := runner.SpeedTest(ctx, id, diagnostics.SpeedTestRequest{Server: *server}, progress)
+		if err != nil {
+			return err
+		}
+		return c.render(res, []string{"DOWNLOAD (Mbps)", "UPLOAD (Mbps)", "LATENCY (ms)", "JITTER (ms)", "SERVER"},
+			[][]string{{fmt.Sprintf("%.2f", res.DownloadMbps), fmt.Sprintf("%.2f", res.UploadMbps), fmt.Sprintf("%.1f", res.LatencyMs), fmt.Sprintf("%.1f", res.JitterMs), res.Server}})
+	case diagnostics.Traceroute:
+		res, err := runner.Traceroute(ctx, id, diagnostics.TracerouteRequest{Host: c.fs.Arg(1), MaxHops: *maxHops}, progress)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(res.Hops))
+		for _, h := range res.Hops {
+			rtts := make([]string, len(h.RTTsMs))
+			for i, v := range h.RTTsMs {
+				rtts[i] = fmt.Sprintf("%.1f", v)
+			}
+			addr := h.Address
+			if addr == "" {
+				addr = "*"
+			}
+			rows = append(rows, []string{fmt.Sprint(h.Number), addr, h.Host, strings.Join(rtts, " ")})
+		}
+		if err := c.render(res, []string{"HOP", "ADDRESS", "HOST", "RTT (ms)"}, rows); err != nil || *c.output == "json" {
+			return err
+		}
+		if !res.Reached {
+			fmt.Fprintf(c.out, "%s not reached\n", res.Host)
+		}
+		return nil
+	default:
+		res, err := runner.WiFiScan(ctx, id, diagnostics.WiFiScanRequest{Band: *band}, progress)
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(res.Networks))
+		for _, n := range res.Networks {
+			rows = append(rows, []string{n.SSID, n.BSSID, fmt.Sprint(n.Channel), n.Band, fmt.Sprintf("%.0f", n.SignalDBm), n.Security})
+		}
+		return c.render(res, []string{"SSID", "BSSID", "CHANNEL", "BAND", "SIGNAL (dBm)", "SECURITY"}, rows)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// doctor runs Manager.Preflight against the configured backends and prints its report, failing
+// when a check fails. Unlike the other one-shot commands it keeps the Redis URL, to check it too.
+func doctor(args []string) error {
+	c := newCommand("doctor")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	opts, err := loadOptions(*c.config)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	m, err := manager.New(opts)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	ctx, cancel := c.context()
+	defer cancel()
+	report := m.Preflight(ctx)
+	if err := c.renderPreflight(report); err != nil {
+		return err
+	}
+	if failed := report.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%d of %d checks failed", len(failed), len(report.Checks))
+	}
+	return nil
+}
+
+func (c *command) renderPreflight(report dm.PreflightReport) error {
+	rows := make([][]string, 0, len(report.Checks))
+	for _, ch := range report.Checks {
+		latency := ""
+		if ch.LatencyMS > 0 {
+			latency = (time.Duration(ch.LatencyMS) * time.Millisecond).String()
+		}
+		rows = append(rows, []string{ch.Backend, ch.Check, strings.ToUpper(ch.Status), latency, ch.Detail})
+	}
+	return c.render(report, []string{"BACKEND", "CHECK", "STATUS", "LATENCY", "DETAIL"}, rows)
+}
+
+// startupPreflight runs Manager.Preflight as serve starts: mode "warn" logs the checks that did
+// not pass, "strict" also refuses to start when one failed and "off" skips it.
+func startupPreflight(ctx context.Context, m *manager.Manager, mode string) error {
+	switch mode {
+	case "off":
+		return nil
+	case "warn", "strict":
+	default:
+		return fmt.Errorf("--preflight must be off, warn or strict, not %q", mode)
+	}
+	report := m.Preflight(ctx)
+	for _, ch := range report.Checks {
+		if ch.Status == dm.PreflightWarn || ch.Status == dm.PreflightFail {
+			log.Printf("preflight: %s %s %s: %s", ch.Backend, ch.Check, ch.Status, ch.Detail)
+		}
+	}
+	if failed := report.Failed(); len(failed) > 0 && mode == "strict" {
+		return fmt.Errorf("preflight: %d checks failed (run devicemgr doctor for the report)", len(failed))
+	}
+	return nil
+}
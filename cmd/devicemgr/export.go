@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/inventory"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// devicesCmd dispatches the devices verbs.
+func devicesCmd(args []string) error {
+	if len(args) > 0 && args[0] == "export" {
+		return devicesExport(args[1:])
+	}
+	return subcommand(args, "list", devicesList)
+}
+
+// devicesExport writes the inventory as CSV or JSON Lines, from a running server's
+// /api/devices/export (--server, which adds annotations) or by polling Talaria locally.
+func devicesExport(args []string) error {
+	c := newCommand("devices export")
+	server := c.fs.String("server", os.Getenv("DEVICEMGR_SERVER"), "devicemgr server base URL; exports its inventory")
+	authorization := c.fs.String("authorization", os.Getenv("DEVICEMGR_AUTHORIZATION"), "Authorization header sent to --server")
+	format := c.fs.String("format", inventory.FormatCSV, "csv or jsonl")
+	fields := c.fs.String("fields", "", "comma-separated fields (default "+strings.Join(inventory.DefaultFields, ",")+")")
+	query := c.fs.String("query", "", `device query, e.g. "model:XB7 firmware:1.2*"`)
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	if *server != "" {
+		q := url.Values{"format": {*format}}
+		if *fields != "" {
+			q.Set("fields", *fields)
+		}
+		if *query != "" {
+			q.Set("query", *query)
+		}
+		return c.download(ctx, strings.TrimRight(*server, "/")+"/api/devices/export?"+q.Encode(), *authorization)
+	}
+
+	selected, err := inventory.ParseFields(*fields)
+	if err != nil {
+		return err
+	}
+	out, err := inventory.NewWriter(c.out, *format, selected)
+	if err != nil {
+		return err
+	}
+	m, err := c.manager()
+	if err != nil {
+		return err
+	}
+	if _, err := m.Poll(ctx); err != nil {
+		return err
+	}
+	adapter := m.DeviceAdapter()
+	view := adapter.View()
+	ids := view.IDs()
+	if *query != "" {
+		q, err := runtime.ParseDeviceQuery(*query)
+		if err != nil {
+			return err
+		}
+		if _, labels := annotation.SplitQuery(q); len(labels) > 0 {
+			return errors.New("label terms need the annotations of a server: set --server")
+		}
+		if ids, err = adapter.Search(q); err != nil {
+			return err
+		}
+	}
+	for _, id := range ids {
+		status, _ := adapter.Status(id)
+		if err := out.Write(inventory.Device{ID: id, Status: string(status), LastSeen: view.PolledAt(), Metadata: view.Metadata(id)}); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// download copies the body of a GET of endpoint to c.out.
+func (c *command) download(ctx context.Context, endpoint, authorization string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, err = io.Copy(c.out, resp.Body)
+	return err
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/loadgen"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// loadgenCmd simulates a device fleet behind Talaria, Tr1d1um and Blizzard and drives operations
+// against it through an in-process Manager, reporting throughput and latencies. With
+// --simulate-only it just serves the fleet, for a separately run `devicemgr serve` to point at.
+func loadgenCmd(args []string) error {
+	fs := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	c := &command{fs: fs, config: configFlag(fs), output: fs.String("o", "table", "output format: table or json"), out: os.Stdout}
+	var cfg loadgen.Config
+	fs.IntVar(&cfg.Devices, "devices", loadgen.DefaultDevices, "simulated devices")
+	fs.Float64Var(&cfg.Online, "online", loadgen.DefaultOnline, "fraction of devices connected")
+	fs.Float64Var(&cfg.Churn, "churn", 0.01, "fraction of devices considered for a connection change every --churn-every")
+	fs.DurationVar(&cfg.ChurnEvery, "churn-every", loadgen.DefaultChurnEvery, "connection change cadence")
+	fs.DurationVar(&cfg.Latency, "latency", 20*time.Millisecond, "device answer latency")
+	fs.DurationVar(&cfg.Jitter, "jitter", 30*time.Millisecond, "random extra latency, up to")
+	fs.Float64Var(&cfg.ErrorRate, "error-rate", 0, "fraction of device answers failing")
+	fs.Int64Var(&cfg.Seed, "seed", 0, "random seed (0: from the clock)")
+	partners := fs.String("partners", "", "comma-separated partner IDs assigned round-robin")
+	models := fs.String("models", "", "comma-separated models assigned round-robin")
+	addr := fs.String("addr", "127.0.0.1:0", "simulator listen address")
+	simulateOnly := fs.Bool("simulate-only", false, "serve the simulated backends until interrupted without driving them")
+	var drive loadgen.DriveConfig
+	fs.Float64Var(&drive.Rate, "rate", 50, "operations per second (0: as fast as the workers can)")
+	fs.IntVar(&drive.Workers, "workers", 8, "concurrent operations")
+	fs.DurationVar(&drive.Duration, "duration", time.Minute, "how long to drive load")
+	fs.DurationVar(&drive.Timeout, "op-timeout", 10*time.Second, "per-operation timeout")
+	mix := fs.String("mix", "get=8,set=1,call=1", "operation weights")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	if *partners != "" {
+		cfg.Partners = strings.Split(*partners, ",")
+	}
+	if *models != "" {
+		cfg.Models = strings.Split(*models, ",")
+	}
+	var err error
+	if drive.Mix, err = parseMix(*mix); err != nil {
+		return err
+	}
+
+	fleet := loadgen.New(cfg)
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: fleet.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	defer srv.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go fleet.Run(done)
+	base := "http://" + ln.Addr().String()
+	urls := map[string]string{
+		"talariaUrl":  base,
+		"tr1d1umUrl":  base + loadgen.Tr1d1umPath,
+		"blizzardUrl": "ws://" + ln.Addr().String() + loadgen.BlizzardPath,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *simulateOnly {
+		b, _ := json.MarshalIndent(urls, "", "  ")
+		fmt.Fprintf(os.Stderr, "simulating %d devices; point devicemgr at:\n%s\n", len(fleet.Online()), b)
+		<-ctx.Done()
+		return nil
+	}
+
+	opts, err := loadOptions(*c.config)
+	if err != nil {
+		return err
+	}
+	opts.TalariaBaseURL, opts.Tr1d1umBaseURL, opts.BlizzardBaseURL = urls["talariaUrl"], urls["tr1d1umUrl"], urls["blizzardUrl"]
+	opts.Cache.RedisURL, opts.Polling.Instances = "", nil
+	mgr, err := manager.New(opts)
+	if err != nil {
+		return fmt.Errorf("failed to build manager: %w", err)
+	}
+	defer mgr.Close()
+	sub := mgr.Subscribe(1024)
+	defer sub.Close()
+	transitions := make(chan int)
+	go func() {
+		n := 0
+		for e := range sub.C() {
+			if e.Kind == dm.EventOnline || e.Kind == dm.EventOffline {
+				n++
+			}
+		}
+		transitions <- n
+	}()
+	if _, err := mgr.Poll(ctx); err != nil {
+		return fmt.Errorf("initial poll: %w", err)
+	}
+	polls := make(chan struct{})
+	go func() {
+		defer close(polls)
+		t := time.NewTicker(opts.Polling.DeviceList)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case <-t.C:
+				if _, err := mgr.Poll(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("poll: %v", err)
+				}
+			}
+		}
+	}()
+	rep, err := loadgen.Drive(ctx, mgr, fleet, drive)
+	if err != nil {
+		return err
+	}
+	stop()
+	<-polls
+	sub.Close()
+	out := struct {
+		loadgen.Report
+		Transitions int              `json:"transitions"` // online and offline events the Manager emitted
+		Fleet       loadgen.Counters `json:"fleet"`
+	}{Report: rep, Transitions: <-transitions, Fleet: fleet.Counters()}
+
+	ops := make([]string, 0, len(rep.ByOp))
+	for op := range rep.ByOp {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	ms := func(v float64) string { return strconv.FormatFloat(v, 'f', 1, 64) }
+	rows := make([][]string, 0, len(ops)+1)
+	for _, op := range ops {
+		o := rep.ByOp[op]
+		rows = append(rows, []string{op, strconv.Itoa(o.Count), strconv.Itoa(o.Errors), ms(o.P50), ms(o.P95), ms(o.P99), ms(o.Max)})
+	}
+	rows = append(rows, []string{"total", strconv.Itoa(rep.Operations), strconv.Itoa(rep.Errors), "", "", "", ""})
+	if err := c.render(out, []string{"OP", "COUNT", "ERRORS", "P50MS", "P95MS", "P99MS", "MAXMS"}, rows); err != nil {
+		return err
+	}
+	if *c.output == "table" {
+		fmt.Fprintf(c.out, "\n%.1f ops/s over %s; %d connectivity transitions; fleet online %d, %d connects, %d disconnects\n",
+			rep.Throughput, rep.Duration, out.Transitions, out.Fleet.Online, out.Fleet.Connects, out.Fleet.Disconnects)
+	}
+	return nil
+}
+
+// parseMix parses operation weights such as "get=8,set=1,call=1".
+func parseMix(s string) (map[string]int, error) {
+	mix := make(map[string]int)
+	for _, part := range strings.Split(s, ",") {
+		op, w, ok := strings.Cut(strings.TrimSpace(part), "=")
+		n, err := strconv.Atoi(w)
+		if !ok || err != nil || n < 0 {
+			return nil, fmt.Errorf("mix %q: want op=weight", part)
+		}
+		mix[op] = n
+	}
+	if len(mix) == 0 {
+		return nil, errors.New("mix: no operations")
+	}
+	return mix, nil
+}
@@ -1,71 +1,133 @@
 package main
 
 import (
-	"context"
-	"log"
+	"errors"
+	"fmt"
+	"io"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
-	dm "github.com/xmidt-org/talaria/devicemgr"
-	"github.com/xmidt-org/talaria/devicemgr/internal/server"
-	"github.com/xmidt-org/talaria/devicemgr/runtime"
+	"github.com/xmidt-org/talaria/devicemgr/client"
+	"github.com/xmidt-org/talaria/devicemgr/translate"
 )
 
-// devicemgr: pure discovery API server. It starts the /api/devices endpoint and waits for shutdown.
-func main() {
-	auth := dm.StaticAuth{Value: "Basic dXNlcjpwYXNz"}
-	deviceAdapter := runtime.NewDeviceAdapter("http://talaria:6200", auth)
+const usage = `usage: devicemgr <command> [flags] [args]
+
+commands:
+  serve                                   run the discovery API server (default)
+  devices list                            list connected devices
+  devices export [--format csv|jsonl] [--fields f,...] [--query q] [--server url]
+                                          export the device inventory
+  get [--service s] <device> <names...>   read parameters
+  set [--service s] <device> name=value... write parameters (name:type=value sets a WDMP data type)
+  rpc [--service s] <device> <method> [params-json]
+                                          issue a Blizzard JSON-RPC call
+  diag speedtest|traceroute|wifiscan [flags] <device> [host]
+                                          run a device diagnostic, streaming progress
+  policy resolve [--model m] <device>     resolve the device's firmware policy
+  bulk set --input <csv|jsonl> | --select <expr> --param name=value [--concurrency n] [--server url]
+                                          set parameters across many devices (resumable)
+  snapshot create|list|show|diff|restore|delete
+                                          manage parameter snapshots on a server (--server)
+  watch [--device ids] [--kind kinds] [--server url]
+                                          stream device events (locally or from a server)
+  loadgen [--devices n] [--churn f] [--rate n] [--duration d] [--mix get=8,set=1,call=1] [--simulate-only]
+                                          drive load against a simulated fleet
+  apischema [--format typescript|jsonschema] [--out file] [--check]
+                                          write the API payload definitions
+  doctor                                  check connectivity, credentials, TLS trust and clock
+                                          skew of the configured backends
+
+Every command accepts --config <file> (JSON, default $DEVICEMGR_CONFIG); the
+one-shot commands also accept -o table|json. Device faults are explained in the
+language of $DEVICEMGR_LANG (or $LANG).
+`
 
-	addr := os.Getenv("DEVICEMGR_DISCOVERY_ADDR")
-	if addr == "" {
-		addr = ":8090"
+// devicemgr: discovery API server and operations CLI.
+func main() {
+	args := os.Args[1:]
+	cmd := "serve"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		cmd, args = args[0], args[1:]
+	}
+	var err error
+	switch cmd {
+	case "serve":
+		err = serve(args)
+	case "devices":
+		err = devicesCmd(args)
+	case "get":
+		err = getParams(args)
+	case "set":
+		err = setParams(args)
+	case "rpc":
+		err = rpc(args)
+	case "diag":
+		err = diag(args)
+	case "bulk":
+		err = subcommand(args, "set", bulkSet)
+	case "snapshot":
+		err = snapshotCmd(args)
+	case "watch":
+		err = watch(args)
+	case "loadgen":
+		err = loadgenCmd(args)
+	case "apischema":
+		err = apischemaCmd(args)
+	case "doctor":
+		err = doctor(args)
+	case "policy":
+		err = subcommand(args, "resolve", policyResolve)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
 	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "devicemgr %s: %v\n", cmd, err)
+		explainFault(os.Stderr, err, cliLanguage())
+		os.Exit(1)
+	}
+}
 
-	// Initial poll to seed snapshot
-	if _, err := deviceAdapter.PollOnce(context.Background()); err != nil {
-		log.Printf("initial poll failed: %v", err)
+// subcommand dispatches a noun command ("devices list") that currently has a single verb.
+func subcommand(args []string, verb string, run func([]string) error) error {
+	if len(args) == 0 || args[0] != verb {
+		return fmt.Errorf("expected %q subcommand", verb)
 	}
+	return run(args[1:])
+}
 
-	// Periodic polling loop (default interval 15s, configurable via DEVICEMGR_POLL_INTERVAL seconds)
-	interval := 15 * time.Second
-	if v := os.Getenv("DEVICEMGR_POLL_INTERVAL"); v != "" {
-		if d, err := time.ParseDuration(v); err == nil && d > 0 {
-			interval = d
+// cliLanguage is the language device faults are explained in: $DEVICEMGR_LANG, else the locale.
+func cliLanguage() string {
+	for _, name := range []string{"DEVICEMGR_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			return v
 		}
 	}
-	ctxPoll, cancelPoll := context.WithCancel(context.Background())
-	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				if _, err := deviceAdapter.PollOnce(context.Background()); err != nil {
-					log.Printf("poll error: %v", err)
-				}
-			case <-ctxPoll.Done():
-				return
-			}
+	return translate.DefaultLanguage
+}
+
+// explainFault writes the name, message and remediation of the WDMP fault that failed err, one
+// the device reported to this process or a server's error body described, in lang.
+func explainFault(w io.Writer, err error, lang string) {
+	catalog := translate.DefaultErrorCatalog()
+	d, ok := catalog.DescribeError(err, lang)
+	var ce *client.Error
+	if !ok && errors.As(err, &ce) && ce.WDMP != nil {
+		d, ok = *ce.WDMP, true
+		if local, known := catalog.Describe(d.Code, lang); known {
+			d.Message, d.Remediation, d.Language = local.Message, local.Remediation, local.Language
 		}
-	}()
-	ctx, cancel := context.WithCancel(context.Background())
-	_, errCh, err := server.StartDiscoveryServer(ctx, server.DiscoveryConfig{ListenAddr: addr, DeviceAdapter: deviceAdapter})
-	if err != nil {
-		log.Fatalf("failed to start discovery API: %v", err)
 	}
-	go func() {
-		if err := <-errCh; err != nil {
-			log.Printf("discovery API error: %v", err)
-		}
-	}()
-
-	sigCh := make(chan os.Signal, 2)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	log.Printf("devicemgr discovery API running on %s (GET /api/devices)", addr)
-	<-sigCh
-	log.Printf("shutdown signal received; stopping server")
-	cancelPoll()
-	cancel()
+	if !ok {
+		return
+	}
+	fmt.Fprintf(w, "  %s (%d): %s\n", d.Name, d.Code, d.Message)
+	if d.Parameter != "" {
+		fmt.Fprintf(w, "  parameter: %s\n", d.Parameter)
+	}
+	if d.Remediation != "" {
+		fmt.Fprintf(w, "  remediation: %s\n", d.Remediation)
+	}
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// configCheckInterval is how often serve checks the config file for changes.
+const configCheckInterval = 5 * time.Second
+
+// watchConfig reloads Options from path on SIGHUP and whenever the file's modification time or
+// size changes (checked every interval), passing each successful load to apply until ctx ends.
+// A file that fails to load is logged and the running configuration kept.
+func watchConfig(ctx context.Context, path string, interval time.Duration, apply func(dm.Options)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := configStamp(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-ticker.C:
+			stamp := configStamp(path)
+			if stamp == last {
+				continue
+			}
+			last = stamp
+		}
+		opts, err := loadOptions(path)
+		if err != nil {
+			log.Printf("config reload: %v", err)
+			continue
+		}
+		apply(opts)
+	}
+}
+
+// configStamp identifies a version of the config file; "" when there is none.
+func configStamp(path string) string {
+	if path == "" {
+		return ""
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%d", fi.ModTime(), fi.Size())
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/cache"
+	"github.com/xmidt-org/talaria/devicemgr/diagnostics"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+	"github.com/xmidt-org/talaria/devicemgr/events/kafkasink"
+	"github.com/xmidt-org/talaria/devicemgr/events/natssink"
+	"github.com/xmidt-org/talaria/devicemgr/firmware"
+	api "github.com/xmidt-org/talaria/devicemgr/internal/http"
+	"github.com/xmidt-org/talaria/devicemgr/internal/server"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/k8slease"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+	"github.com/xmidt-org/talaria/devicemgr/notifications"
+	"github.com/xmidt-org/talaria/devicemgr/profiles"
+	"github.com/xmidt-org/talaria/devicemgr/quality"
+	"github.com/xmidt-org/talaria/devicemgr/redisstore"
+	"github.com/xmidt-org/talaria/devicemgr/s3store"
+	"github.com/xmidt-org/talaria/devicemgr/settings"
+	"github.com/xmidt-org/talaria/devicemgr/snapshot"
+)
+
+// serve runs the discovery API server: it starts the /api/devices endpoint, polls in the
+// background and waits for shutdown.
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := configFlag(fs)
+	preflight := fs.String("preflight", "warn", "backend checks at startup: off, warn (log failures) or strict (refuse to start)")
+	fs.Parse(args)
+	opts, err := loadOptions(*configPath)
+	if err != nil {
+		return err
+	}
+	if os.Getenv("DEVICEMGR_LEADER_ELECTION") == "k8s" {
+		name := os.Getenv("DEVICEMGR_LEASE_NAME")
+		if name == "" {
+			name = "devicemgr-poll"
+		}
+		elector, err := k8slease.New(k8slease.Config{Name: name, LeaseDuration: opts.Polling.Lease()})
+		if err != nil {
+			return fmt.Errorf("failed to build lease elector: %w", err)
+		}
+		opts.Elector = elector
+	}
+	mgr, err := manager.New(opts)
+	if err != nil {
+		return fmt.Errorf("failed to build manager: %w", err)
+	}
+	if err := startupPreflight(context.Background(), mgr, *preflight); err != nil {
+		return err
+	}
+	deviceAdapter := mgr.DeviceAdapter()
+
+	addr := os.Getenv("DEVICEMGR_DISCOVERY_ADDR")
+	if addr == "" {
+		addr = ":8090"
+	}
+
+	// Every long-running piece is a supervised component: each starts after the ones it depends
+	// on and stops before them, and a crashed loop or listener is restarted or shuts the server down
+	sup := dm.NewSupervisor(func(component string, err error) { log.Printf("%s: %v", component, err) })
+	restart := dm.RestartPolicy{Mode: dm.RestartOnFailure, MaxRestarts: 5}
+	var startup []string // components the initial poll waits for
+	var addErrs []error
+	add := func(c dm.Component) { addErrs = append(addErrs, sup.Add(c)) }
+	add(dm.Component{Name: "manager", Runner: dm.RunnerFuncs{StopFunc: func(context.Context) error { return mgr.Close() }}})
+
+	// Webhooks, event topic bindings and durable parameter watches survive restarts in Redis when
+	// shared state is configured
+	var subscriptions dm.SubscriptionStore
+	if rdb := mgr.Redis(); rdb != nil {
+		subscriptions = redisstore.NewSubscriptionStore(rdb, opts.Cache.RedisPrefix)
+		mgr.SetWatchStore(subscriptions)
+		mgr.SetQuarantineStore(subscriptions)
+	}
+	devicePartners := func(id dm.DeviceID) []string {
+		return dm.SplitPartners(deviceAdapter.View().Metadata(string(id))[dm.MetadataPartnerIDs])
+	}
+
+	// Optional event forwarding to Kafka or NATS
+	var topics *events.TopicBindings
+	if sink, err := eventSink(); err != nil {
+		return fmt.Errorf("failed to build event sink: %w", err)
+	} else if sink != nil {
+		enc, err := events.EncoderFor(os.Getenv("DEVICEMGR_EVENTS_FORMAT"))
+		if err != nil {
+			return err
+		}
+		topics = events.NewTopicBindings(subscriptions, devicePartners)
+		pub, err := events.NewPublisher(events.PublisherConfig{Sink: sink, Encoder: enc, Topic: os.Getenv("DEVICEMGR_EVENTS_TOPIC"), Bindings: topics})
+		if err != nil {
+			return fmt.Errorf("failed to build event publisher: %w", err)
+		}
+		// subscribe before the initial poll so seed events are forwarded; events stay held until the
+		// sink accepts them
+		sub := mgr.SubscribeAcked(4096)
+		add(dm.Component{Name: "event-sink", Runner: dm.RunnerFuncs{StopFunc: func(context.Context) error { return sink.Close() }}, DependsOn: []string{"manager"}})
+		add(dm.Component{Name: "event-publisher", Runner: dm.RunFunc(func(ctx context.Context) error {
+			if err := topics.Restore(ctx); err != nil {
+				log.Printf("%v", err)
+			}
+			if err := sub.Err(); err != nil {
+				// the sink fell too far behind; events after the held ones were not kept
+				log.Printf("event publisher: %v; resubscribing", err)
+				sub = mgr.SubscribeAcked(4096)
+			}
+			return pub.Run(ctx, sub)
+		}), DependsOn: []string{"event-sink"}, Restart: restart})
+		startup = append(startup, "event-publisher")
+	}
+
+	// Optional outbound webhooks
+	var webhooks *events.WebhookDispatcher
+	if os.Getenv("DEVICEMGR_WEBHOOKS") == "true" {
+		webhooks = events.NewWebhookDispatcher(events.WebhookConfig{DevicePartners: devicePartners, Store: subscriptions})
+		sub := mgr.Subscribe(256)
+		add(dm.Component{Name: "webhooks", Runner: dm.RunFunc(func(ctx context.Context) error {
+			if err := webhooks.Restore(ctx); err != nil {
+				log.Printf("%v", err)
+			}
+			return webhooks.Run(ctx, sub)
+		}), DependsOn: []string{"manager"}, Restart: restart})
+		startup = append(startup, "webhooks")
+	}
+
+	// Inventory attributes are loaded before the initial poll so the first snapshot carries them
+	add(dm.Component{Name: "initial-poll", DependsOn: append(startup, "manager"), Runner: dm.RunnerFuncs{StartFunc: func(ctx context.Context) error {
+		if err := mgr.RestoreQuarantines(ctx); err != nil {
+			log.Printf("%v", err)
+		}
+		if err := mgr.LoadEnrichment(ctx); err != nil {
+			log.Printf("enrichment: %v", err)
+		}
+		if _, err := mgr.Poll(ctx); err != nil {
+			log.Printf("initial poll failed: %v", err)
+		}
+		if err := mgr.RestoreWatches(ctx); err != nil {
+			log.Printf("%v", err)
+		}
+		return nil
+	}}})
+
+	// Periodic polling loop; the leadership lease is derived from the same interval. A reloaded
+	// interval arrives on intervals (the lease keeps the startup value).
+	intervals := make(chan time.Duration, 1)
+	add(dm.Component{Name: "poller", DependsOn: []string{"initial-poll"}, Restart: restart, Runner: dm.RunFunc(func(ctx context.Context) error {
+		mgr.RunPolling(ctx, opts.Polling.DeviceList, intervals, func(err error) { log.Printf("poll error: %v", err) })
+		return nil
+	})})
+	// Partner scoping and roles trust token claims only once the signature is verified
+	partnerClaim, roleClaim := os.Getenv("DEVICEMGR_PARTNER_CLAIM"), os.Getenv("DEVICEMGR_ROLE_CLAIM")
+	var verify func(token string) error
+	if partnerClaim != "" || roleClaim != "" {
+		if verify, err = api.NewJWTVerifier(opts.JWT, nil); err != nil {
+			return fmt.Errorf("token claims configured: %w (set DEVICEMGR_JWT_HMAC_SECRET or DEVICEMGR_JWKS_URL)", err)
+		}
+	}
+	var partners api.PartnerResolver
+	if partnerClaim != "" {
+		partners = api.JWTPartnerResolver(partnerClaim, verify)
+	}
+	var authz *api.Authorizer
+	if roleClaim != "" {
+		authz = &api.Authorizer{Resolve: api.JWTRoleResolver(roleClaim, nil, verify), Actor: api.JWTActorResolver("", verify)}
+	}
+	// Parameter snapshots, annotations and idempotent responses persist in Redis when shared state
+	// is configured
+	var snapshots snapshot.Store
+	var notes annotation.Store
+	var replays cache.Cache[api.IdempotentResponse]
+	if rdb := mgr.Redis(); rdb != nil {
+		snapshots = redisstore.NewParamSnapshotStore(rdb, opts.Cache.RedisPrefix)
+		notes = redisstore.NewAnnotationStore(rdb, opts.Cache.RedisPrefix)
+		replays = redisstore.NewCache[api.IdempotentResponse](rdb, opts.Cache.RedisPrefix, "idempotency", api.DefaultIdempotencyTTL)
+	}
+	api.SetAllowedOrigins(opts.CORSOrigins)
+	api.SetErrorLanguage(opts.ErrorLanguage)
+	allowlist, err := api.NewAllowlist(opts.Allowlist)
+	if err != nil {
+		return fmt.Errorf("failed to build allowlist: %w", err)
+	}
+	// bulk jobs and firmware rollouts run until shutdown, which cancels the ones in flight
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	add(dm.Component{Name: "jobs", DependsOn: []string{"manager"}, Runner: dm.RunnerFuncs{StopFunc: func(context.Context) error { cancel(); return nil }}})
+	jobSvc := jobs.NewService(ctx, jobs.Builders(mgr))
+	jobSvc.SetApprovals(opts.Approvals)
+	// job artifacts go to the configured bucket, or to Redis when shared state is configured
+	if opts.Artifacts.Bucket != "" {
+		store, err := s3store.New(opts.Artifacts, nil)
+		if err != nil {
+			return fmt.Errorf("failed to build artifact store: %w", err)
+		}
+		jobSvc.SetArtifacts(store)
+	} else if rdb := mgr.Redis(); rdb != nil {
+		jobSvc.SetArtifacts(redisstore.NewArtifactStore(rdb, opts.Cache.RedisPrefix, opts.Artifacts.TTL))
+	}
+	if len(opts.Notifications.Rules) > 0 {
+		notifier, err := notifications.New(opts.Notifications, nil)
+		if err != nil {
+			return fmt.Errorf("failed to build notifier: %w", err)
+		}
+		jobSvc.SetOnFinish(notifier.JobFinished)
+		add(dm.Component{Name: "notifier", DependsOn: []string{"manager"}, Restart: restart, Runner: dm.RunFunc(func(ctx context.Context) error { notifier.Run(ctx, mgr); return nil })})
+	}
+	var collector *quality.Collector
+	if opts.Quality.Interval > 0 {
+		collector = quality.NewCollector(mgr, opts.Quality, mgr.Registry())
+		add(dm.Component{Name: "quality", DependsOn: []string{"initial-poll"}, Restart: restart, Runner: dm.RunFunc(func(ctx context.Context) error { collector.Run(ctx); return nil })})
+	}
+	var assignments *settings.Service
+	if opts.XconfAdminBaseURL != "" {
+		assignments = settings.NewService(mgr)
+		add(dm.Component{Name: "settings-reconciler", DependsOn: []string{"initial-poll"}, Restart: restart, Runner: dm.RunFunc(func(ctx context.Context) error {
+			assignments.Run(ctx, opts.Polling.Settings, func(err error) { log.Printf("reconcile: %v", err) })
+			return nil
+		})})
+	}
+	legacy, err := api.ParseLegacyMode(os.Getenv("DEVICEMGR_LEGACY_API"))
+	if err != nil {
+		return err
+	}
+	srv, err := server.NewDiscoveryServer(server.DiscoveryConfig{
+		ListenAddr:    addr,
+		Manager:       mgr,
+		EnableGraphQL: os.Getenv("DEVICEMGR_GRAPHQL") == "true",
+		Partners:      partners,
+		Authz:         authz,
+		Allowlist:     allowlist,
+		Webhooks:      webhooks,
+		Topics:        topics,
+		SigningKeys:   opts.Events.SigningKeys,
+		Jobs:          jobSvc,
+		Plans:         jobs.NewPlanner(jobSvc, mgr),
+		Snapshots:     snapshot.NewService(mgr, snapshots),
+		Firmware:      firmware.NewService(ctx, mgr, firmware.Config{}),
+		Diagnostics:   diagnostics.NewRunner(mgr, diagnostics.Config{}),
+		Annotations:   annotation.NewService(mgr, notes),
+		Profiles:      profiles.NewService(mgr, nil),
+		Quality:       collector,
+		Settings:      assignments,
+		Idempotency:   api.NewIdempotency(replays),
+		LegacyAPI:     legacy,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build discovery API: %w", err)
+	}
+	add(dm.Component{Name: "discovery-api", Runner: dm.ServerRunner(srv), DependsOn: []string{"initial-poll", "jobs"}, Restart: restart})
+	// SIGHUP or an edited config file reloads the settings running components can adopt
+	add(dm.Component{Name: "config-watch", DependsOn: []string{"poller"}, Runner: dm.RunFunc(func(ctx context.Context) error {
+		watchConfig(ctx, *configPath, configCheckInterval, func(o dm.Options) {
+			if err := mgr.Reload(o); err != nil {
+				log.Printf("config reload: %v", err)
+				return
+			}
+			api.SetAllowedOrigins(o.CORSOrigins)
+			api.SetErrorLanguage(o.ErrorLanguage)
+			select {
+			case <-intervals:
+			default:
+			}
+			intervals <- o.Polling.DeviceList
+			log.Printf("config reloaded")
+		})
+		return nil
+	})})
+	// USP agents connect to their own listener; it carries no API credentials
+	if h := mgr.USPHandler(); h != nil {
+		add(listener("usp-listener", "DEVICEMGR_USP_ADDR", ":8091", h))
+	}
+	// Trap forwarders post to their own listener, authenticated by Traps.Token
+	if h := mgr.TrapHandler(); h != nil {
+		add(listener("trap-listener", "DEVICEMGR_TRAP_ADDR", ":8162", h))
+	}
+	// Caduceus delivers to its own listener, authenticated by the Caduceus.Secret signature
+	if h := mgr.CaduceusHandler(); h != nil {
+		add(listener("caduceus-listener", "DEVICEMGR_CADUCEUS_ADDR", ":8164", h))
+		add(dm.Component{Name: "caduceus-registration", DependsOn: []string{"caduceus-listener"}, Runner: dm.RunFunc(func(ctx context.Context) error {
+			mgr.RunCaduceus(ctx, func(err error) { log.Printf("caduceus registration: %v", err) })
+			return nil
+		})})
+	}
+	add(dm.Component{Name: "enrichment", DependsOn: []string{"initial-poll"}, Runner: dm.RunFunc(func(ctx context.Context) error {
+		mgr.RunEnrichment(ctx, func(err error) { log.Printf("enrichment: %v", err) })
+		return nil
+	})})
+	// pprof, expvar and the runtime dump listen only when DEVICEMGR_DEBUG_ADDR is set (e.g.
+	// localhost:6060), admin-authenticated when roles are configured
+	if os.Getenv("DEVICEMGR_DEBUG_ADDR") != "" {
+		add(listener("debug-listener", "DEVICEMGR_DEBUG_ADDR", "", allowlist.Wrap(server.DebugHandler(mgr, authz))))
+	}
+	if err := errors.Join(addErrs...); err != nil {
+		return err
+	}
+
+	if err := sup.Start(context.Background()); err != nil {
+		return err
+	}
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	log.Printf("devicemgr discovery API running on %s (GET /api/devices)", addr)
+	var failed error
+	select {
+	case <-sigCh:
+		log.Printf("shutdown signal received; stopping server")
+	case failed = <-sup.Exited():
+		log.Printf("%v; stopping server", failed)
+	}
+	stopCtx, stop := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer stop()
+	return errors.Join(failed, sup.Stop(stopCtx))
+}
+
+// shutdownTimeout bounds stopping every component, draining the HTTP listeners first.
+const shutdownTimeout = 10 * time.Second
+
+// listener is a supervised HTTP listener on the address in env (def when unset), restarted if it
+// breaks while serving.
+func listener(name, env, def string, h http.Handler) dm.Component {
+	addr := os.Getenv(env)
+	if addr == "" {
+		addr = def
+	}
+	srv := &http.Server{Addr: addr, Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	return dm.Component{Name: name, Runner: dm.ServerRunner(srv), DependsOn: []string{"manager"}, Restart: dm.RestartPolicy{Mode: dm.RestartOnFailure, MaxRestarts: 5}}
+}
+
+// eventSink builds the configured event sink (DEVICEMGR_KAFKA_BROKERS or DEVICEMGR_NATS_URL); nil when neither is set.
+func eventSink() (events.Sink, error) {
+	if brokers := os.Getenv("DEVICEMGR_KAFKA_BROKERS"); brokers != "" {
+		return kafkasink.New(kafkasink.Config{Brokers: strings.Split(brokers, ",")})
+	}
+	if url := os.Getenv("DEVICEMGR_NATS_URL"); url != "" {
+		return natssink.New(url)
+	}
+	return nil, nil
+}
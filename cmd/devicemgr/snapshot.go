@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xmidt-org/talaria/devicemgr/snapshot"
+)
+
+const snapshotUsage = `usage: devicemgr snapshot <verb> [flags] <device> ...
+  create [--name n] [--service s] <device> <paths...>
+  list <device>
+  show <device> <snapshot>
+  diff [--against <snapshot>|current] <device> <snapshot>
+  restore <device> <snapshot> [names...]
+  delete <device> <snapshot>`
+
+// snapshotCmd manages parameter snapshots stored by a running server (--server).
+func snapshotCmd(args []string) error {
+	if len(args) == 0 {
+		return errors.New(snapshotUsage)
+	}
+	verb := args[0]
+	c := newCommand("snapshot " + verb)
+	server := c.fs.String("server", os.Getenv("DEVICEMGR_SERVER"), "devicemgr server base URL")
+	authorization := c.fs.String("authorization", os.Getenv("DEVICEMGR_AUTHORIZATION"), "Authorization header sent to --server")
+	name := c.fs.String("name", "", "snapshot name (create)")
+	service := c.fs.String("service", "", "translation service (create)")
+	against := c.fs.String("against", snapshot.Current, "snapshot ID to compare with, or current (diff)")
+	if err := c.parse(args[1:]); err != nil {
+		return err
+	}
+	if *server == "" {
+		return errors.New("snapshots are stored by the server: set --server or DEVICEMGR_SERVER")
+	}
+	pos := c.fs.Args()
+	need := map[string]int{"create": 2, "list": 1, "show": 2, "diff": 2, "restore": 2, "delete": 2}
+	if min, ok := need[verb]; !ok || len(pos) < min {
+		return errors.New(snapshotUsage)
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	base := strings.TrimRight(*server, "/") + "/api/devices/" + url.PathEscape(pos[0]) + "/snapshots"
+	call := func(method, path string, body, out interface{}) error {
+		var b []byte
+		if body != nil {
+			var err error
+			if b, err = json.Marshal(body); err != nil {
+				return err
+			}
+		}
+		return doJSON(ctx, method, base+path, *authorization, b, out)
+	}
+
+	switch verb {
+	case "create":
+		var snap snapshot.Snapshot
+		req := map[string]interface{}{"name": *name, "service": *service, "paths": pos[1:]}
+		if err := call(http.MethodPost, "", req, &snap); err != nil {
+			return err
+		}
+		return c.render(snap, []string{"ID", "NAME", "PARAMETERS", "TAKEN"}, [][]string{{snap.ID, snap.Name, fmt.Sprint(snap.Count), snap.TakenAt.Format(time.RFC3339)}})
+	case "list":
+		var out struct {
+			Snapshots []snapshot.Snapshot `json:"snapshots"`
+		}
+		if err := call(http.MethodGet, "", nil, &out); err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(out.Snapshots))
+		for _, s := range out.Snapshots {
+			rows = append(rows, []string{s.ID, s.Name, fmt.Sprint(s.Count), s.TakenAt.Format(time.RFC3339), strings.Join(s.Paths, ",")})
+		}
+		return c.render(out, []string{"ID", "NAME", "PARAMETERS", "TAKEN", "PATHS"}, rows)
+	case "show":
+		var snap snapshot.Snapshot
+		if err := call(http.MethodGet, "/"+url.PathEscape(pos[1]), nil, &snap); err != nil {
+			return err
+		}
+		names := make([]string, 0, len(snap.Parameters))
+		for n := range snap.Parameters {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		rows := make([][]string, 0, len(names))
+		for _, n := range names {
+			rows = append(rows, []string{n, fmt.Sprint(snap.Parameters[n].Value), snap.Parameters[n].Type})
+		}
+		return c.render(snap, []string{"NAME", "VALUE", "TYPE"}, rows)
+	case "diff":
+		var out struct {
+			Changes []snapshot.Change `json:"changes"`
+		}
+		if err := call(http.MethodGet, "/"+url.PathEscape(pos[1])+"/diff?against="+url.QueryEscape(*against), nil, &out); err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(out.Changes))
+		for _, ch := range out.Changes {
+			rows = append(rows, []string{string(ch.Kind), ch.Name, fmt.Sprint(ch.From), fmt.Sprint(ch.To)})
+		}
+		return c.render(out, []string{"CHANGE", "NAME", "FROM", "TO"}, rows)
+	case "restore":
+		var out struct {
+			Applied []string `json:"applied"`
+		}
+		if err := call(http.MethodPost, "/"+url.PathEscape(pos[1])+"/restore", map[string]interface{}{"names": pos[2:]}, &out); err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(out.Applied))
+		for _, n := range out.Applied {
+			rows = append(rows, []string{n})
+		}
+		return c.render(out, []string{"APPLIED"}, rows)
+	default: // delete
+		return call(http.MethodDelete, "/"+url.PathEscape(pos[1]), nil, nil)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+)
+
+// watch prints device events as they happen, either from a running server's SSE endpoint
+// (--server) or by polling the backends locally.
+func watch(args []string) error {
+	c := newCommand("watch")
+	device := c.fs.String("device", "", "comma-separated device IDs to follow (default: all)")
+	kind := c.fs.String("kind", "", "comma-separated event kinds, e.g. online,offline (default: all)")
+	server := c.fs.String("server", os.Getenv("DEVICEMGR_SERVER"), "devicemgr server base URL; streams its /api/events")
+	authorization := c.fs.String("authorization", os.Getenv("DEVICEMGR_AUTHORIZATION"), "Authorization header sent to --server")
+	interval := c.fs.Duration("interval", 15*time.Second, "local polling interval when --server is not set")
+	if err := c.parse(args); err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	filter := events.ParseFilter(*kind, *device)
+	if *server != "" {
+		return c.watchRemote(ctx, *server, *authorization, *kind, *device)
+	}
+	return c.watchLocal(ctx, filter, *interval)
+}
+
+func (c *command) watchLocal(ctx context.Context, filter events.Filter, interval time.Duration) error {
+	m, err := c.manager()
+	if err != nil {
+		return err
+	}
+	sub := m.Subscribe(256)
+	defer sub.Close()
+	poll := func() {
+		if _, err := m.Poll(ctx); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "poll: %v\n", err)
+		}
+	}
+	go func() {
+		poll()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				poll()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-sub.C():
+			if filter.Match(e) {
+				c.printEvent(e)
+			}
+		}
+	}
+}
+
+// watchRemote follows the server's SSE stream (filtered server-side), reconnecting until interrupted.
+func (c *command) watchRemote(ctx context.Context, server, authorization, kind, device string) error {
+	q := url.Values{}
+	if kind != "" {
+		q.Set("kind", kind)
+	}
+	if device != "" {
+		q.Set("device", device)
+	}
+	endpoint := strings.TrimRight(server, "/") + "/api/events?" + q.Encode()
+	backoff := time.Second
+	for {
+		err := c.stream(ctx, endpoint, authorization)
+		if ctx.Err() != nil {
+			return nil
+		}
+		var fatal fatalError
+		if errors.As(err, &fatal) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "event stream: %v; reconnecting in %s\n", err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// fatalError marks stream failures that reconnecting cannot fix (e.g. 401/403).
+type fatalError struct{ error }
+
+func (c *command) stream(ctx context.Context, endpoint, authorization string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fatalError{err}
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("server returned %s", resp.Status)
+		if resp.StatusCode < 500 {
+			return fatalError{err}
+		}
+		return err
+	}
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue // event names, comments and blank separators
+		}
+		e, err := events.DecodeJSON([]byte(data))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping malformed event: %v\n", err)
+			continue
+		}
+		c.printEvent(e)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return errors.New("stream closed by server")
+}
+
+// printEvent writes one event per line: JSON lines with -o json, otherwise a readable row.
+func (c *command) printEvent(e dm.Event) {
+	if *c.output == "json" {
+		b, err := events.JSONEncoder{}.Encode(e)
+		if err == nil {
+			fmt.Fprintln(c.out, string(b))
+		}
+		return
+	}
+	fmt.Fprintf(c.out, "%s  %-12s  %s  %s\n", e.OccurredAt.Format(time.RFC3339), e.Kind, e.DeviceID, e.Source)
+}
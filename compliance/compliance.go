@@ -0,0 +1,200 @@
+// Package compliance reports how the fleet's firmware compares with what xconf's firmware rules
+// assign: which devices run the version their policy names, which are out of date and which
+// cannot be told, overall and per model.
+package compliance
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/firmware"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/policy"
+)
+
+// Device compliance statuses.
+const (
+	StatusCompliant = "compliant"
+	StatusOutOfDate = "out-of-date"
+	StatusUnknown   = "unknown" // no policy applies, or the running version is not known
+)
+
+// Where a device's running version came from.
+const (
+	SourceMetadata = "metadata" // Talaria's dm.MetadataFirmware
+	SourceDevice   = "device"   // read from the device's version parameter
+)
+
+// liveConcurrency bounds the parameter reads of a live report.
+const liveConcurrency = 16
+
+// Devices is the subset of manager.Manager used by Build.
+type Devices interface {
+	ListDevices(ctx context.Context) []dm.DeviceState
+	GetParameters(ctx context.Context, id dm.DeviceID, service string, names []string) (map[string]dm.ParameterValue, error)
+	ResolveFirmwareForDevices(ctx context.Context, devices []policy.DeviceContext) (map[dm.DeviceID]*policy.FirmwarePolicy, error)
+}
+
+// Options tune a report.
+type Options struct {
+	// Live reads the version parameter from devices whose metadata does not report their firmware.
+	Live             bool
+	VersionParameter string // firmware.DefaultVersionParameter when empty
+}
+
+// Entry is one device's line of the report.
+type Entry struct {
+	Device   dm.DeviceID `json:"device"`
+	Model    string      `json:"model,omitempty"`
+	Partner  string      `json:"partner,omitempty"`
+	Running  string      `json:"running,omitempty"`
+	Source   string      `json:"source,omitempty"`
+	Expected string      `json:"expected,omitempty"`
+	PolicyID string      `json:"policyId,omitempty"`
+	Rule     string      `json:"rule,omitempty"`
+	Status   string      `json:"status"`
+}
+
+// Counts tallies devices by status.
+type Counts struct {
+	Devices   int `json:"devices"`
+	Compliant int `json:"compliant"`
+	OutOfDate int `json:"outOfDate"`
+	Unknown   int `json:"unknown"`
+}
+
+func (c *Counts) add(status string) {
+	c.Devices++
+	switch status {
+	case StatusCompliant:
+		c.Compliant++
+	case StatusOutOfDate:
+		c.OutOfDate++
+	default:
+		c.Unknown++
+	}
+}
+
+// Report is the compliance of the devices visible to the caller.
+type Report struct {
+	GeneratedAt time.Time          `json:"generatedAt"`
+	Counts                         // overall
+	ByModel     map[string]*Counts `json:"byModel"` // devices without a model are counted under ""
+	Details     []Entry            `json:"details,omitempty"`
+}
+
+// Build resolves the policies of the devices visible to ctx in one pass and compares each with
+// the version the device runs. Versions compare case-insensitively.
+func Build(ctx context.Context, m Devices, opts Options) (*Report, error) {
+	if opts.VersionParameter == "" {
+		opts.VersionParameter = firmware.DefaultVersionParameter
+	}
+	devices := m.ListDevices(ctx)
+	entries := make([]Entry, len(devices))
+	contexts := make([]policy.DeviceContext, len(devices))
+	var missing []dm.DeviceID
+	index := make(map[dm.DeviceID]int, len(devices))
+	for i, d := range devices {
+		partners := dm.SplitPartners(d.Metadata[dm.MetadataPartnerIDs])
+		e := Entry{Device: d.ID, Model: d.Metadata[dm.MetadataModel], Running: d.Metadata[dm.MetadataFirmware]}
+		if len(partners) > 0 {
+			e.Partner = partners[0]
+		}
+		if e.Running != "" {
+			e.Source = SourceMetadata
+		} else if opts.Live {
+			missing = append(missing, d.ID)
+		}
+		entries[i], index[d.ID] = e, i
+	}
+	if len(missing) > 0 {
+		var mu sync.Mutex
+		_, err := jobs.Run(ctx, missing, func(ctx context.Context, id dm.DeviceID) error {
+			values, err := m.GetParameters(ctx, id, "", []string{opts.VersionParameter})
+			if err != nil {
+				return err
+			}
+			if v, _ := values[opts.VersionParameter].Value.(string); v != "" {
+				mu.Lock()
+				entries[index[id]].Running, entries[index[id]].Source = v, SourceDevice
+				mu.Unlock()
+			}
+			return nil
+		}, jobs.RunConfig{Concurrency: liveConcurrency})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, e := range entries {
+		contexts[i] = policy.DeviceContextOf(devices[i])
+		contexts[i].FirmwareVersion = e.Running
+	}
+	policies, err := m.ResolveFirmwareForDevices(ctx, contexts)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{GeneratedAt: time.Now().UTC(), ByModel: make(map[string]*Counts), Details: entries}
+	for i := range entries {
+		e := &entries[i]
+		e.Status = StatusUnknown
+		if fp := policies[e.Device]; fp != nil {
+			e.Expected, e.PolicyID, e.Rule = fp.Version, fp.ID, fp.Metadata["ruleName"]
+			if e.Running != "" && e.Expected != "" {
+				e.Status = StatusOutOfDate
+				if strings.EqualFold(e.Running, e.Expected) {
+					e.Status = StatusCompliant
+				}
+			}
+		}
+		r.Counts.add(e.Status)
+		c := r.ByModel[e.Model]
+		if c == nil {
+			c = &Counts{}
+			r.ByModel[e.Model] = c
+		}
+		c.add(e.Status)
+	}
+	sort.Slice(entries, func(i, k int) bool { return entries[i].Device < entries[k].Device })
+	return r, nil
+}
+
+// Filter keeps the details whose status is one of statuses; none keeps all. Counts are unchanged.
+func (r *Report) Filter(statuses ...string) {
+	if len(statuses) == 0 {
+		return
+	}
+	out := r.Details[:0]
+	for _, e := range r.Details {
+		for _, s := range statuses {
+			if e.Status == s {
+				out = append(out, e)
+				break
+			}
+		}
+	}
+	r.Details = out
+}
+
+// CSVHeader names the columns WriteCSV writes.
+var CSVHeader = []string{"device", "model", "partner", "running", "source", "expected", "policyId", "rule", "status"}
+
+// WriteCSV writes the report's details as CSV with CSVHeader.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CSVHeader); err != nil {
+		return err
+	}
+	for _, e := range r.Details {
+		if err := cw.Write([]string{string(e.Device), e.Model, e.Partner, e.Running, e.Source, e.Expected, e.PolicyID, e.Rule, e.Status}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,78 @@
+package compliance
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/policy"
+)
+
+type fakeDevices struct {
+	devices []dm.DeviceState
+	live    map[dm.DeviceID]string
+	reads   int
+}
+
+func (f *fakeDevices) ListDevices(context.Context) []dm.DeviceState { return f.devices }
+
+func (f *fakeDevices) GetParameters(_ context.Context, id dm.DeviceID, _ string, names []string) (map[string]dm.ParameterValue, error) {
+	f.reads++
+	return map[string]dm.ParameterValue{names[0]: {Name: names[0], Value: f.live[id]}}, nil
+}
+
+func (f *fakeDevices) ResolveFirmwareForDevices(_ context.Context, devices []policy.DeviceContext) (map[dm.DeviceID]*policy.FirmwarePolicy, error) {
+	out := make(map[dm.DeviceID]*policy.FirmwarePolicy)
+	for _, d := range devices {
+		if d.Model == "XB7" {
+			out[d.ID] = &policy.FirmwarePolicy{ID: "fw-7", Version: "XB7_7.1", Model: d.Model, Metadata: map[string]string{"ruleName": "XB7 prod"}}
+		}
+	}
+	return out, nil
+}
+
+func TestBuild(t *testing.T) {
+	dev := &fakeDevices{
+		devices: []dm.DeviceState{
+			{ID: "mac:0000000000a1", Metadata: map[string]string{dm.MetadataModel: "XB7", dm.MetadataFirmware: "xb7_7.1"}},
+			{ID: "mac:0000000000a2", Metadata: map[string]string{dm.MetadataModel: "XB7", dm.MetadataFirmware: "XB7_7.0"}},
+			{ID: "mac:0000000000a3", Metadata: map[string]string{dm.MetadataModel: "XB7"}},
+			{ID: "mac:0000000000b1", Metadata: map[string]string{dm.MetadataModel: "TG1682", dm.MetadataFirmware: "TG_1.0"}},
+		},
+		live: map[dm.DeviceID]string{"mac:0000000000a3": "XB7_7.1"},
+	}
+	r, err := Build(context.Background(), dev, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Compliant != 1 || r.OutOfDate != 1 || r.Unknown != 2 || dev.reads != 0 {
+		t.Fatalf("counts %+v after %d reads", r.Counts, dev.reads)
+	}
+	if xb7 := r.ByModel["XB7"]; xb7 == nil || xb7.Devices != 3 || xb7.Unknown != 1 {
+		t.Fatalf("XB7 counts %+v", xb7)
+	}
+
+	r, err = Build(context.Background(), dev, Options{Live: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Compliant != 2 || dev.reads != 1 || r.Details[2].Source != SourceDevice {
+		t.Fatalf("live counts %+v after %d reads: %+v", r.Counts, dev.reads, r.Details[2])
+	}
+
+	r.Filter(StatusOutOfDate)
+	if len(r.Details) != 1 || r.Details[0].Device != "mac:0000000000a2" || r.Details[0].Expected != "XB7_7.1" {
+		t.Fatalf("out-of-date details %+v", r.Details)
+	}
+	var buf bytes.Buffer
+	if err := r.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "device,model,partner,running,source,expected,policyId,rule,status\n" +
+		"mac:0000000000a2,XB7,,XB7_7.0,metadata,XB7_7.1,fw-7,XB7 prod,out-of-date\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("csv:\n%s", strings.TrimSpace(got))
+	}
+}
@@ -0,0 +1,77 @@
+package devicemgr
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MetadataDataModel is the device metadata key holding its TR-181 data-model version, such as
+// "2.12", when Talaria or an inventory (see EnrichmentConfig) reports it.
+const MetadataDataModel = "data-model-version"
+
+// DefaultDataModelProbes are the parameters read for a device's data-model version when
+// DataModelConfig.Probes is empty.
+var DefaultDataModelProbes = []string{"Device.RootDataModelVersion"}
+
+// DataModelConfig tells the Manager how to learn a device's data-model version, which the catalog
+// (see ParameterResolver) needs to translate parameter names that changed between versions. The
+// version comes from MetadataDataModel, else the first Firmware rule matching the device's
+// firmware, else the first Probes parameter the device answers; devices with none use the
+// catalog's current names.
+type DataModelConfig struct {
+	Firmware []FirmwareDataModel `json:"firmware,omitempty"`
+	Probes   []string            `json:"probes,omitempty"` // DefaultDataModelProbes when empty
+}
+
+// FirmwareDataModel assigns a data-model version to firmware versions matching Pattern, a
+// path.Match pattern such as "TG4482PC2_5.*".
+type FirmwareDataModel struct {
+	Pattern string `json:"pattern"`
+	Version string `json:"version"`
+}
+
+// ParameterResolver is implemented by catalogs that know the names parameters had in earlier
+// data-model versions, as schema.Catalog does. Callers then always use a parameter's current
+// name: the Manager sends each device the name its version uses and reports results under the
+// current names again.
+type ParameterResolver interface {
+	// Versioned reports whether name, or for a partial path any parameter under it, is named
+	// differently in some version.
+	Versioned(name string) bool
+	// DevicePath returns name as devices of version call it; an empty version is the current one.
+	DevicePath(name, version string) string
+	// CanonicalPath is the inverse of DevicePath: the current name of a device's path.
+	CanonicalPath(path, version string) string
+}
+
+// CompareVersions orders dotted version numbers such as "2.9" and "2.12" segment by segment,
+// returning -1, 0 or 1. Missing segments count as zero and non-numeric ones compare as text.
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xerr := strconv.ParseUint(x, 10, 64)
+		yn, yerr := strconv.ParseUint(y, 10, 64)
+		switch {
+		case xerr == nil && yerr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,19 @@
+package devicemgr
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want int
+	}{
+		{"2.9", "2.12", -1},
+		{"2.12", "2.12.0", 0},
+		{"2.14", "2.12", 1},
+		{"2.x", "2.y", -1},
+	} {
+		if got := CompareVersions(c.a, c.b); got != c.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package devicemgr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseDeviceID validates s and returns it in canonical form, so IDs that differ only in
+// formatting name the same device. Schemes match case-insensitively:
+//
+//	mac:AA-BB-CC-DD-EE-FF, AABB.CCDD.EEFF, aa:bb:cc:dd:ee:ff  ->  mac:aabbccddeeff
+//	uuid:<id>, dns:<name>                                      ->  lowercased
+//	serial:<number>                                            ->  kept as given
+//
+// A bare MAC address gets the mac: scheme, and USP endpoint IDs ("os::012345-001122334455")
+// are returned unchanged. Anything else fails with ErrInvalidParameter.
+func ParseDeviceID(s string) (DeviceID, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.ContainsAny(s, " \t\r\n/") {
+		return "", fmt.Errorf("device ID %q: %w", s, ErrInvalidParameter)
+	}
+	if strings.Contains(s, "::") {
+		return DeviceID(s), nil
+	}
+	if mac, ok := normalizeMAC(s); ok {
+		return DeviceID("mac:" + mac), nil
+	}
+	scheme, value, _ := strings.Cut(s, ":")
+	scheme = strings.ToLower(scheme)
+	if value == "" {
+		return "", fmt.Errorf("device ID %q: %w", s, ErrInvalidParameter)
+	}
+	switch scheme {
+	case "mac":
+		if mac, ok := normalizeMAC(value); ok {
+			return DeviceID("mac:" + mac), nil
+		}
+		return "", fmt.Errorf("device ID %q: MAC must be 12 hex digits: %w", s, ErrInvalidParameter)
+	case "uuid":
+		return DeviceID("uuid:" + strings.ToLower(value)), nil
+	case "dns":
+		if value = strings.ToLower(strings.TrimSuffix(value, ".")); value == "" {
+			return "", fmt.Errorf("device ID %q: %w", s, ErrInvalidParameter)
+		}
+		return DeviceID("dns:" + value), nil
+	case "serial":
+		return DeviceID("serial:" + value), nil
+	}
+	return "", fmt.Errorf("device ID %q: unknown scheme %q: %w", s, scheme, ErrInvalidParameter)
+}
+
+// Canonical returns id in the form ParseDeviceID produces, or id unchanged when it does not
+// parse. Adapters use it on IDs reported by backends, which are not rejected.
+func (id DeviceID) Canonical() DeviceID {
+	if c, err := ParseDeviceID(string(id)); err == nil {
+		return c
+	}
+	return id
+}
+
+// normalizeMAC strips ':', '-' and '.' separators from s and lowercases it, reporting whether
+// exactly 12 hex digits remain.
+func normalizeMAC(s string) (string, bool) {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == ':' || r == '-' || r == '.':
+		case r >= '0' && r <= '9', r >= 'a' && r <= 'f':
+			b.WriteRune(r)
+		case r >= 'A' && r <= 'F':
+			b.WriteRune(r + 'a' - 'A')
+		default:
+			return "", false
+		}
+	}
+	return b.String(), b.Len() == 12
+}
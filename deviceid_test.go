@@ -0,0 +1,37 @@
+package devicemgr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseDeviceID(t *testing.T) {
+	for in, want := range map[string]DeviceID{
+		"mac:aabbccddeeff":        "mac:aabbccddeeff",
+		"MAC:AA:BB:CC:DD:EE:FF":   "mac:aabbccddeeff",
+		"mac:aa-bb-cc-dd-ee-ff":   "mac:aabbccddeeff",
+		"mac:AABB.CCDD.EEFF":      "mac:aabbccddeeff",
+		" AA:BB:CC:DD:EE:FF ":     "mac:aabbccddeeff",
+		"112233445566":            "mac:112233445566",
+		"UUID:ABC-123":            "uuid:abc-123",
+		"dns:Device.Example.COM.": "dns:device.example.com",
+		"Serial:AbC123":           "serial:AbC123",
+		"os::012345-001122334455": "os::012345-001122334455",
+	} {
+		got, err := ParseDeviceID(in)
+		if err != nil || got != want {
+			t.Errorf("ParseDeviceID(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "mac:", "mac:aabbcc", "mac:aabbccddeegg", "imei:123", "serial:a b", "dns:.", "mac:aa/bb"} {
+		if _, err := ParseDeviceID(in); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("ParseDeviceID(%q) accepted: %v", in, err)
+		}
+	}
+	if got := DeviceID("MAC:AA:BB:CC:DD:EE:FF").Canonical(); got != "mac:aabbccddeeff" {
+		t.Errorf("Canonical = %q", got)
+	}
+	if got := DeviceID("mac:1122").Canonical(); got != "mac:1122" {
+		t.Errorf("unparseable ID changed to %q", got)
+	}
+}
@@ -0,0 +1,107 @@
+// Package diagnostics runs device diagnostics (speed test, traceroute, WiFi scan) as JSON-RPC
+// calls through the Blizzard gateway or MQTT, streams the progress notifications devices send while
+// a test runs, and normalizes the results firmware builds report in different shapes and units.
+package diagnostics
+
+import (
+	"fmt"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Kind names a diagnostic.
+type Kind string
+
+const (
+	SpeedTest  Kind = "speedtest"
+	Traceroute Kind = "traceroute"
+	WiFiScan   Kind = "wifiscan"
+)
+
+// Kinds lists the supported diagnostics.
+var Kinds = []Kind{SpeedTest, Traceroute, WiFiScan}
+
+// ParseKind validates a diagnostic name.
+func ParseKind(s string) (Kind, error) {
+	for _, k := range Kinds {
+		if string(k) == s {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("unknown diagnostic %q: %w", s, dm.ErrInvalidParameter)
+}
+
+// Progress is one progress report from a running diagnostic.
+type Progress struct {
+	Percent float64 `json:"percent"`
+	Stage   string  `json:"stage,omitempty"` // e.g. "download", "upload", "hop 3"
+	Message string  `json:"message,omitempty"`
+}
+
+// SpeedTestRequest parameterizes a speed test; zero values leave the choice to the device.
+type SpeedTestRequest struct {
+	Server          string `json:"server,omitempty"`
+	DurationSeconds int    `json:"durationSeconds,omitempty"`
+}
+
+// SpeedTestResult is a normalized speed test result.
+type SpeedTestResult struct {
+	DownloadMbps float64 `json:"downloadMbps"`
+	UploadMbps   float64 `json:"uploadMbps"`
+	LatencyMs    float64 `json:"latencyMs"`
+	JitterMs     float64 `json:"jitterMs,omitempty"`
+	Server       string  `json:"server,omitempty"`
+}
+
+// TracerouteRequest parameterizes a traceroute from the device.
+type TracerouteRequest struct {
+	Host    string `json:"host"` // required
+	MaxHops int    `json:"maxHops,omitempty"`
+}
+
+// Hop is one traceroute hop; a hop that did not answer has no address and no RTTs.
+type Hop struct {
+	Number  int       `json:"number"`
+	Host    string    `json:"host,omitempty"`
+	Address string    `json:"address,omitempty"`
+	RTTsMs  []float64 `json:"rttsMs,omitempty"`
+}
+
+// TracerouteResult is a normalized traceroute result.
+type TracerouteResult struct {
+	Host    string `json:"host"`
+	Hops    []Hop  `json:"hops"`
+	Reached bool   `json:"reached"`
+}
+
+// WiFiScanRequest parameterizes a WiFi scan; Band ("2.4GHz", "5GHz", "6GHz") limits the result.
+type WiFiScanRequest struct {
+	Band string `json:"band,omitempty"`
+}
+
+// Network is one access point seen by a WiFi scan.
+type Network struct {
+	SSID      string  `json:"ssid"`
+	BSSID     string  `json:"bssid,omitempty"`
+	Channel   int     `json:"channel,omitempty"`
+	Band      string  `json:"band,omitempty"`
+	SignalDBm float64 `json:"signalDbm"`
+	Security  string  `json:"security,omitempty"`
+}
+
+// WiFiScanResult lists the networks found, strongest signal first.
+type WiFiScanResult struct {
+	Networks []Network `json:"networks"`
+}
+
+// Result is the outcome of Runner.Run; exactly one of the typed results is set.
+type Result struct {
+	DeviceID   dm.DeviceID       `json:"deviceId"`
+	Kind       Kind              `json:"kind"`
+	StartedAt  time.Time         `json:"startedAt"`
+	DurationMs int64             `json:"durationMs"`
+	SpeedTest  *SpeedTestResult  `json:"speedTest,omitempty"`
+	Traceroute *TracerouteResult `json:"traceroute,omitempty"`
+	WiFiScan   *WiFiScanResult   `json:"wifiScan,omitempty"`
+}
@@ -0,0 +1,144 @@
+package diagnostics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+func TestNormalizeSpeedTest(t *testing.T) {
+	cases := map[string]SpeedTestResult{
+		`{"downloadMbps":100.5,"uploadMbps":"20","latencyMs":8,"jitterMs":1.5}`:  {DownloadMbps: 100.5, UploadMbps: 20, LatencyMs: 8, JitterMs: 1.5},
+		`{"download_bps":50000000,"upload_kbps":5000,"ping_us":9000}`:            {DownloadMbps: 50, UploadMbps: 5, LatencyMs: 9},
+		`{"download":1.2,"upload":0.5,"unit":"Gbps","rtt":3,"server":"s1"}`:      {DownloadMbps: 1200, UploadMbps: 500, LatencyMs: 3, Server: "s1"},
+		`{"downstream":"300","upstream":"30","Latency":"4.5","serverName":"s2"}`: {DownloadMbps: 300, UploadMbps: 30, LatencyMs: 4.5, Server: "s2"},
+	}
+	for in, want := range cases {
+		got, err := NormalizeSpeedTest(json.RawMessage(in))
+		if err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+		if *got != want {
+			t.Errorf("%s: got %+v, want %+v", in, *got, want)
+		}
+	}
+	if _, err := NormalizeSpeedTest(json.RawMessage(`[1,2]`)); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("expected ErrInvalidParameter, got %v", err)
+	}
+}
+
+func TestNormalizeTraceroute(t *testing.T) {
+	raw := `{"hops":[
+		{"ttl":1,"ip":"192.168.0.1","rtts":[1.1,"1.3"]},
+		{"ttl":2,"host":"*"},
+		{"ttl":3,"hostname":"dns.google","address":"8.8.8.8","rtt_ms":12}
+	]}`
+	got, err := NormalizeTraceroute("8.8.8.8", json.RawMessage(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Reached || len(got.Hops) != 3 {
+		t.Fatalf("unexpected result %+v", got)
+	}
+	if h := got.Hops[0]; h.Number != 1 || h.Address != "192.168.0.1" || len(h.RTTsMs) != 2 || h.RTTsMs[1] != 1.3 {
+		t.Errorf("hop 1: %+v", h)
+	}
+	if h := got.Hops[1]; h.Host != "" || h.Address != "" || h.RTTsMs != nil {
+		t.Errorf("hop 2: %+v", h)
+	}
+	if h := got.Hops[2]; h.Host != "dns.google" || len(h.RTTsMs) != 1 || h.RTTsMs[0] != 12 {
+		t.Errorf("hop 3: %+v", h)
+	}
+	got, err = NormalizeTraceroute("example.com", json.RawMessage(`{"route":[{"address":"10.0.0.1"}],"complete":false}`))
+	if err != nil || got.Reached || got.Hops[0].Number != 1 {
+		t.Fatalf("unexpected result %+v %v", got, err)
+	}
+}
+
+func TestNormalizeWiFiScan(t *testing.T) {
+	raw := `[
+		{"ssid":"a","bssid":"AA:BB:CC:00:00:01","channel":6,"signal":-70,"security":"WPA2"},
+		{"SSID":"b","mac":"aa:bb:cc:00:00:02","frequency":5180,"rssi":"-45"},
+		{"ssid":"c","band":"6G","signalStrength":-60}
+	]`
+	got, err := NormalizeWiFiScan("", json.RawMessage(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Network{
+		{SSID: "b", BSSID: "aa:bb:cc:00:00:02", Band: "5GHz", SignalDBm: -45},
+		{SSID: "c", Band: "6GHz", SignalDBm: -60},
+		{SSID: "a", BSSID: "aa:bb:cc:00:00:01", Channel: 6, Band: "2.4GHz", SignalDBm: -70, Security: "WPA2"},
+	}
+	if len(got.Networks) != len(want) {
+		t.Fatalf("got %+v", got.Networks)
+	}
+	for i := range want {
+		if got.Networks[i] != want[i] {
+			t.Errorf("network %d: got %+v, want %+v", i, got.Networks[i], want[i])
+		}
+	}
+	got, err = NormalizeWiFiScan("2.4", json.RawMessage(`{"networks":`+raw+`}`))
+	if err != nil || len(got.Networks) != 1 || got.Networks[0].SSID != "a" {
+		t.Fatalf("band filter: %+v %v", got, err)
+	}
+}
+
+type fakeCaller struct {
+	call  runtime.BlizzardCall
+	notes []runtime.RPCNotification
+	res   *runtime.BlizzardResult
+	err   error
+}
+
+func (f *fakeCaller) CallWithProgress(_ context.Context, _ dm.DeviceID, _ string, call runtime.BlizzardCall, progress func(runtime.RPCNotification)) (*runtime.BlizzardResult, error) {
+	f.call = call
+	if progress != nil {
+		for _, n := range f.notes {
+			progress(n)
+		}
+	}
+	return f.res, f.err
+}
+
+func TestRunner(t *testing.T) {
+	f := &fakeCaller{
+		notes: []runtime.RPCNotification{
+			{Method: "diagnostics.traceroute.progress", Params: json.RawMessage(`{"fraction":0.5,"phase":"hop 2"}`)},
+			{Method: "device.event", Params: json.RawMessage(`{"percent":99}`)},
+			{Method: "diagnostics.progress", Params: json.RawMessage(`{"percent":100}`)},
+		},
+		res: &runtime.BlizzardResult{Result: json.RawMessage(`{"hops":[{"ip":"1.1.1.1"}]}`)},
+	}
+	r := NewRunner(f, Config{})
+	var progress []Progress
+	res, err := r.Run(context.Background(), "mac:1122", Traceroute, json.RawMessage(`{"host":"1.1.1.1","maxHops":5}`), func(p Progress) { progress = append(progress, p) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Traceroute == nil || !res.Traceroute.Reached || res.Kind != Traceroute {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if f.call.Method != "diagnostics.traceroute" || f.call.Timeout != DefaultTracerouteTimeout || f.call.Params.(TracerouteRequest).MaxHops != 5 {
+		t.Fatalf("unexpected call %+v", f.call)
+	}
+	if len(progress) != 2 || progress[0] != (Progress{Percent: 50, Stage: "hop 2"}) || progress[1].Percent != 100 {
+		t.Fatalf("unexpected progress %+v", progress)
+	}
+
+	if _, err := r.Run(context.Background(), "mac:1122", Traceroute, nil, nil); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("missing host: %v", err)
+	}
+	f.res, f.err = nil, context.DeadlineExceeded
+	if _, err := r.WiFiScan(context.Background(), "mac:1122", WiFiScanRequest{}, nil); !errors.Is(err, dm.ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	f.res, f.err = &runtime.BlizzardResult{Error: &runtime.RPCError{Code: -32601, Message: "method not found"}}, nil
+	if _, err := r.SpeedTest(context.Background(), "mac:1122", SpeedTestRequest{}, nil); err == nil {
+		t.Fatal("expected rpc error")
+	}
+}
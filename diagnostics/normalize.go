@@ -0,0 +1,287 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// fields is a JSON object with keys folded to lower case without '_' and '-', so "download_mbps",
+// "downloadMbps" and "DownloadMBps" are the same field.
+type fields map[string]json.RawMessage
+
+func decodeFields(raw json.RawMessage) (fields, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+	f := make(fields, len(obj))
+	for k, v := range obj {
+		f[foldKey(k)] = v
+	}
+	return f, nil
+}
+
+func foldKey(k string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(k))
+}
+
+// number returns the first of names present as a number or numeric string.
+func (f fields) number(names ...string) (float64, bool) {
+	for _, n := range names {
+		raw, ok := f[n]
+		if !ok {
+			continue
+		}
+		var v float64
+		if json.Unmarshal(raw, &v) == nil {
+			return v, true
+		}
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			if v, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+				return v, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// str returns the first of names present as a string (numbers are formatted).
+func (f fields) str(names ...string) string {
+	for _, n := range names {
+		raw, ok := f[n]
+		if !ok {
+			continue
+		}
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			return s
+		}
+		var v float64
+		if json.Unmarshal(raw, &v) == nil {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+func (f fields) boolean(names ...string) (bool, bool) {
+	for _, n := range names {
+		var v bool
+		if raw, ok := f[n]; ok && json.Unmarshal(raw, &v) == nil {
+			return v, true
+		}
+	}
+	return false, false
+}
+
+// rate reads a throughput in Mbps from base+unit fields ("downloadKbps") or a bare base field
+// scaled by the object's "unit" field.
+func (f fields) rate(bases ...string) float64 {
+	units := []struct {
+		suffix string
+		scale  float64
+	}{{"gbps", 1000}, {"mbps", 1}, {"kbps", 1e-3}, {"bps", 1e-6}}
+	for _, b := range bases {
+		for _, u := range units {
+			if v, ok := f.number(b + u.suffix); ok {
+				return v * u.scale
+			}
+		}
+		if v, ok := f.number(b); ok {
+			for _, u := range units {
+				if strings.EqualFold(f.str("unit", "units"), u.suffix) {
+					return v * u.scale
+				}
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+// millis reads a duration in milliseconds from base+"ms", base+"us" or a bare base field (ms).
+func (f fields) millis(bases ...string) float64 {
+	for _, b := range bases {
+		if v, ok := f.number(b + "ms"); ok {
+			return v
+		}
+		if v, ok := f.number(b + "us"); ok {
+			return v / 1000
+		}
+		if v, ok := f.number(b); ok {
+			return v
+		}
+	}
+	return 0
+}
+
+// array returns the first of names present as a JSON array.
+func (f fields) array(names ...string) ([]json.RawMessage, bool) {
+	for _, n := range names {
+		var out []json.RawMessage
+		if raw, ok := f[n]; ok && json.Unmarshal(raw, &out) == nil {
+			return out, true
+		}
+	}
+	return nil, false
+}
+
+func invalid(kind Kind, err error) error {
+	return fmt.Errorf("%s result: %v: %w", kind, err, dm.ErrInvalidParameter)
+}
+
+// NormalizeSpeedTest converts a device's speed test result. Throughputs may be reported in Gbps,
+// Mbps, kbps or bps; latencies in ms or µs.
+func NormalizeSpeedTest(raw json.RawMessage) (*SpeedTestResult, error) {
+	f, err := decodeFields(raw)
+	if err != nil {
+		return nil, invalid(SpeedTest, err)
+	}
+	return &SpeedTestResult{
+		DownloadMbps: f.rate("download", "downloadspeed", "downstream", "down", "dl"),
+		UploadMbps:   f.rate("upload", "uploadspeed", "upstream", "up", "ul"),
+		LatencyMs:    f.millis("latency", "ping", "rtt"),
+		JitterMs:     f.millis("jitter"),
+		Server:       f.str("server", "servername", "serverhost", "host"),
+	}, nil
+}
+
+// NormalizeTraceroute converts a device's traceroute result for host. Hops may be numbered by
+// "hop", "ttl" or position and carry RTTs as a list or a single value.
+func NormalizeTraceroute(host string, raw json.RawMessage) (*TracerouteResult, error) {
+	f, err := decodeFields(raw)
+	if err != nil {
+		return nil, invalid(Traceroute, err)
+	}
+	list, _ := f.array("hops", "hop", "route", "results")
+	out := &TracerouteResult{Host: host, Hops: make([]Hop, 0, len(list))}
+	for i, item := range list {
+		hf, err := decodeFields(item)
+		if err != nil {
+			return nil, invalid(Traceroute, err)
+		}
+		h := Hop{Number: i + 1, Host: hf.str("host", "hostname", "name"), Address: hf.str("address", "ip", "addr")}
+		if n, ok := hf.number("number", "hop", "ttl", "index"); ok {
+			h.Number = int(n)
+		}
+		if h.Host == "*" {
+			h.Host = ""
+		}
+		if rtts, ok := hf.array("rttsms", "rtts", "times", "rtt"); ok {
+			for _, r := range rtts {
+				if v, ok := (fields{"v": r}).number("v"); ok {
+					h.RTTsMs = append(h.RTTsMs, v)
+				}
+			}
+		} else if v := hf.millis("rtt", "time"); v > 0 {
+			h.RTTsMs = []float64{v}
+		}
+		out.Hops = append(out.Hops, h)
+	}
+	if reached, ok := f.boolean("reached", "complete", "destinationreached"); ok {
+		out.Reached = reached
+	} else if n := len(out.Hops); n > 0 {
+		last := out.Hops[n-1]
+		out.Reached = last.Address == host || strings.EqualFold(last.Host, host)
+	}
+	return out, nil
+}
+
+// NormalizeWiFiScan converts a device's WiFi scan result, keeping only networks on band when set.
+// The result may be a bare array or an object holding one; signal is "signal", "rssi" or
+// "signalStrength" in dBm, and the band is derived from the frequency or channel when missing.
+func NormalizeWiFiScan(band string, raw json.RawMessage) (*WiFiScanResult, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err != nil {
+		f, err := decodeFields(raw)
+		if err != nil {
+			return nil, invalid(WiFiScan, err)
+		}
+		list, _ = f.array("networks", "aps", "accesspoints", "results", "neighbors")
+	}
+	band = NormalizeBand(band)
+	out := &WiFiScanResult{Networks: make([]Network, 0, len(list))}
+	for _, item := range list {
+		nf, err := decodeFields(item)
+		if err != nil {
+			return nil, invalid(WiFiScan, err)
+		}
+		n := Network{
+			SSID:     nf.str("ssid", "name"),
+			BSSID:    strings.ToLower(nf.str("bssid", "mac", "macaddress")),
+			Security: nf.str("security", "encryption", "securitymode", "auth"),
+		}
+		if v, ok := nf.number("channel"); ok {
+			n.Channel = int(v)
+		}
+		if v, ok := nf.number("signaldbm", "signal", "rssi", "signalstrength"); ok {
+			n.SignalDBm = v
+		}
+		n.Band = NormalizeBand(nf.str("band", "frequencyband", "operatingfrequencyband"))
+		if n.Band == "" {
+			if mhz, ok := nf.number("frequency", "freq", "frequencymhz"); ok {
+				n.Band = bandForFrequency(mhz)
+			} else if n.Channel >= 1 && n.Channel <= 14 {
+				n.Band = "2.4GHz"
+			}
+		}
+		if band != "" && n.Band != band {
+			continue
+		}
+		out.Networks = append(out.Networks, n)
+	}
+	sort.SliceStable(out.Networks, func(i, j int) bool { return out.Networks[i].SignalDBm > out.Networks[j].SignalDBm })
+	return out, nil
+}
+
+// NormalizeBand maps "2.4", "2.4G", "5ghz", "6 GHz" and similar to "2.4GHz", "5GHz" or "6GHz";
+// other values are returned unchanged.
+func NormalizeBand(b string) string {
+	s := strings.ToLower(strings.ReplaceAll(b, " ", ""))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "hz"), "g")
+	switch s {
+	case "2.4":
+		return "2.4GHz"
+	case "5":
+		return "5GHz"
+	case "6":
+		return "6GHz"
+	}
+	return b
+}
+
+func bandForFrequency(mhz float64) string {
+	switch {
+	case mhz >= 2400 && mhz < 2500:
+		return "2.4GHz"
+	case mhz >= 5150 && mhz < 5925:
+		return "5GHz"
+	case mhz >= 5925 && mhz < 7125:
+		return "6GHz"
+	}
+	return ""
+}
+
+// parseProgress reads a progress report from notification params. Percent may be a fraction
+// (0-1) when the device reports "fraction" instead of "percent".
+func parseProgress(params json.RawMessage) (Progress, bool) {
+	f, err := decodeFields(params)
+	if err != nil {
+		return Progress{}, false
+	}
+	var p Progress
+	pct, ok := f.number("percent", "progress", "pct", "percentage")
+	if frac, isFrac := f.number("fraction"); !ok && isFrac {
+		pct, ok = frac*100, true
+	}
+	p.Percent = pct
+	p.Stage = f.str("stage", "phase", "state", "status")
+	p.Message = f.str("message", "msg", "detail")
+	return p, ok || p.Stage != "" || p.Message != ""
+}
@@ -0,0 +1,172 @@
+package diagnostics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// Default device RPC methods and time limits.
+const (
+	DefaultProgressMethod = "diagnostics.progress"
+
+	DefaultSpeedTestTimeout  = 2 * time.Minute
+	DefaultTracerouteTimeout = time.Minute
+	DefaultWiFiScanTimeout   = 30 * time.Second
+)
+
+// DefaultMethods are the JSON-RPC methods invoked for each diagnostic.
+var DefaultMethods = map[Kind]string{
+	SpeedTest:  "diagnostics.speedtest",
+	Traceroute: "diagnostics.traceroute",
+	WiFiScan:   "diagnostics.wifiscan",
+}
+
+// Caller is the subset of manager.Manager used by Runner.
+type Caller interface {
+	CallWithProgress(ctx context.Context, id dm.DeviceID, service string, call runtime.BlizzardCall, progress func(runtime.RPCNotification)) (*runtime.BlizzardResult, error)
+}
+
+// Config selects the device service, methods and time limits; empty fields use the defaults.
+type Config struct {
+	Service string // device service behind the gateway; empty selects the manager default
+	Methods map[Kind]string
+	// ProgressMethod is the notification method carrying progress. Notifications named after the
+	// diagnostic's method plus ".progress" are accepted as well.
+	ProgressMethod string
+	Timeouts       map[Kind]time.Duration
+}
+
+// Runner runs diagnostics on devices.
+type Runner struct {
+	c   Caller
+	cfg Config
+}
+
+// NewRunner creates a Runner calling devices through c.
+func NewRunner(c Caller, cfg Config) *Runner {
+	methods := make(map[Kind]string, len(DefaultMethods))
+	for k, v := range DefaultMethods {
+		methods[k] = v
+	}
+	for k, v := range cfg.Methods {
+		if v != "" {
+			methods[k] = v
+		}
+	}
+	timeouts := map[Kind]time.Duration{SpeedTest: DefaultSpeedTestTimeout, Traceroute: DefaultTracerouteTimeout, WiFiScan: DefaultWiFiScanTimeout}
+	for k, v := range cfg.Timeouts {
+		if v > 0 {
+			timeouts[k] = v
+		}
+	}
+	cfg.Methods, cfg.Timeouts = methods, timeouts
+	if cfg.ProgressMethod == "" {
+		cfg.ProgressMethod = DefaultProgressMethod
+	}
+	return &Runner{c: c, cfg: cfg}
+}
+
+// SpeedTest runs a speed test on the device; progress (optional) receives progress reports.
+func (r *Runner) SpeedTest(ctx context.Context, id dm.DeviceID, req SpeedTestRequest, progress func(Progress)) (*SpeedTestResult, error) {
+	raw, err := r.call(ctx, id, SpeedTest, req, progress)
+	if err != nil {
+		return nil, err
+	}
+	return NormalizeSpeedTest(raw)
+}
+
+// Traceroute runs a traceroute from the device to req.Host.
+func (r *Runner) Traceroute(ctx context.Context, id dm.DeviceID, req TracerouteRequest, progress func(Progress)) (*TracerouteResult, error) {
+	if req.Host == "" {
+		return nil, fmt.Errorf("host required: %w", dm.ErrInvalidParameter)
+	}
+	raw, err := r.call(ctx, id, Traceroute, req, progress)
+	if err != nil {
+		return nil, err
+	}
+	return NormalizeTraceroute(req.Host, raw)
+}
+
+// WiFiScan scans for nearby WiFi networks.
+func (r *Runner) WiFiScan(ctx context.Context, id dm.DeviceID, req WiFiScanRequest, progress func(Progress)) (*WiFiScanResult, error) {
+	raw, err := r.call(ctx, id, WiFiScan, req, progress)
+	if err != nil {
+		return nil, err
+	}
+	return NormalizeWiFiScan(req.Band, raw)
+}
+
+// Run decodes params (a JSON request for kind; empty for defaults) and runs that diagnostic.
+func (r *Runner) Run(ctx context.Context, id dm.DeviceID, kind Kind, params json.RawMessage, progress func(Progress)) (*Result, error) {
+	decode := func(v interface{}) error {
+		if len(params) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(params, v); err != nil {
+			return fmt.Errorf("%s request: %v: %w", kind, err, dm.ErrInvalidParameter)
+		}
+		return nil
+	}
+	res := &Result{DeviceID: id, Kind: kind, StartedAt: time.Now()}
+	var err error
+	switch kind {
+	case SpeedTest:
+		var req SpeedTestRequest
+		if err = decode(&req); err == nil {
+			res.SpeedTest, err = r.SpeedTest(ctx, id, req, progress)
+		}
+	case Traceroute:
+		var req TracerouteRequest
+		if err = decode(&req); err == nil {
+			res.Traceroute, err = r.Traceroute(ctx, id, req, progress)
+		}
+	case WiFiScan:
+		var req WiFiScanRequest
+		if err = decode(&req); err == nil {
+			res.WiFiScan, err = r.WiFiScan(ctx, id, req, progress)
+		}
+	default:
+		_, err = ParseKind(string(kind))
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.DurationMs = time.Since(res.StartedAt).Milliseconds()
+	return res, nil
+}
+
+func (r *Runner) call(ctx context.Context, id dm.DeviceID, kind Kind, params interface{}, progress func(Progress)) (json.RawMessage, error) {
+	method := r.cfg.Methods[kind]
+	var onNote func(runtime.RPCNotification)
+	if progress != nil {
+		onNote = func(n runtime.RPCNotification) {
+			if n.Method != r.cfg.ProgressMethod && n.Method != method+".progress" {
+				return
+			}
+			if p, ok := parseProgress(n.Params); ok {
+				progress(p)
+			}
+		}
+	}
+	call := runtime.BlizzardCall{Method: method, Params: params, Timeout: r.cfg.Timeouts[kind]}
+	res, err := r.c.CallWithProgress(ctx, id, r.cfg.Service, call, onNote)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return nil, fmt.Errorf("%s on %s: %w", kind, id, dm.ErrTimeout)
+	case err != nil:
+		return nil, err
+	case res.Error != nil:
+		return nil, fmt.Errorf("%s rpc error %d: %s", kind, res.Error.Code, res.Error.Message)
+	}
+	// some firmware wraps the payload as {"result": {...}}
+	if f, err := decodeFields(res.Result); err == nil && len(f) == 1 && f["result"] != nil {
+		return f["result"], nil
+	}
+	return res.Result, nil
+}
@@ -0,0 +1,11 @@
+package devicemgr
+
+import "context"
+
+// Elector decides which replica performs singleton work such as polling Talaria and xconfadmin.
+// Campaign is invoked on every polling tick: it acquires or renews leadership and reports whether
+// this replica currently leads. Implementations must tolerate repeated calls.
+type Elector interface {
+	Campaign(ctx context.Context) (bool, error)
+	Resign(ctx context.Context) error
+}
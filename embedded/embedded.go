@@ -0,0 +1,253 @@
+// Package embedded runs devicemgr inside another Go service: New returns the API routes as an
+// http.Handler to mount on the service's own mux, together with the Manager behind them, instead
+// of running the standalone devicemgr serve command.
+package embedded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/cache"
+	"github.com/xmidt-org/talaria/devicemgr/diagnostics"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+	"github.com/xmidt-org/talaria/devicemgr/firmware"
+	api "github.com/xmidt-org/talaria/devicemgr/internal/http"
+	"github.com/xmidt-org/talaria/devicemgr/internal/server"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+	"github.com/xmidt-org/talaria/devicemgr/notifications"
+	"github.com/xmidt-org/talaria/devicemgr/profiles"
+	"github.com/xmidt-org/talaria/devicemgr/quality"
+	"github.com/xmidt-org/talaria/devicemgr/redisstore"
+	"github.com/xmidt-org/talaria/devicemgr/s3store"
+	"github.com/xmidt-org/talaria/devicemgr/settings"
+	"github.com/xmidt-org/talaria/devicemgr/snapshot"
+)
+
+// Request authorization hooks, the same the standalone server uses.
+type (
+	// Authorizer enforces the route roles (viewer, operator, admin); nil leaves every route open.
+	Authorizer = api.Authorizer
+	// RoleResolver returns the caller's role.
+	RoleResolver = api.RoleResolver
+	// ActorResolver names the caller in audit records.
+	ActorResolver = api.ActorResolver
+	// PartnerResolver returns the partners the caller is scoped to.
+	PartnerResolver = api.PartnerResolver
+	// LegacyMode selects how the unversioned /api routes are served beside /api/v1.
+	LegacyMode = api.LegacyMode
+)
+
+// The LegacyMode values.
+const (
+	LegacyServe      = api.LegacyServe
+	LegacyDeprecated = api.LegacyDeprecated
+	LegacyOff        = api.LegacyOff
+)
+
+// Config chooses how the API is mounted and which optional parts run.
+type Config struct {
+	// Prefix is the path the handler is mounted under, such as "/devicemgr"; routes are then
+	// /devicemgr/api/devices and so on. Mount the handler with the prefix as a subtree pattern
+	// (mux.Handle("/devicemgr/", h)). Empty serves the routes at /api.
+	Prefix string
+
+	Authz    *Authorizer     // optional
+	Partners PartnerResolver // optional; scopes every request to the partners returned
+
+	GraphQL  bool // mounts /api/graphql
+	Webhooks bool // mounts /api/webhooks and delivers device events to the hooks registered there
+
+	// LegacyAPI selects what becomes of the unversioned /api routes; they are served as before by
+	// default.
+	LegacyAPI LegacyMode
+
+	// Stores for parameter snapshots, annotations and profiles. Left nil, snapshots and
+	// annotations are kept in Redis when the Manager has shared state configured, and everything
+	// else in memory.
+	Snapshots   snapshot.Store
+	Annotations annotation.Store
+	Profiles    profiles.Store
+
+	// Report receives errors from the background work (polls, reconciles, component crashes);
+	// nil logs them with the standard logger.
+	Report func(component string, err error)
+}
+
+// Embedded is devicemgr mounted in another service. Serve Handler from the service's mux, and
+// Start it to poll Talaria and run the background work the routes rely on; Stop it at shutdown.
+// It is a dm.Runner, so a service with its own dm.Supervisor can add it as one component.
+type Embedded struct {
+	Manager *manager.Manager
+	Handler http.Handler
+
+	sup *dm.Supervisor
+}
+
+// New builds a Manager from opts and the API routes on top of it. Nothing runs until Start.
+// The USP, trap and Caduceus listeners of the standalone server are not part of Handler; mount
+// Manager.USPHandler, TrapHandler and CaduceusHandler separately when those are configured.
+func New(opts dm.Options, cfg Config) (*Embedded, error) {
+	report := cfg.Report
+	if report == nil {
+		report = func(component string, err error) { log.Printf("devicemgr %s: %v", component, err) }
+	}
+	allowlist, err := api.NewAllowlist(opts.Allowlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build allowlist: %w", err)
+	}
+	mgr, err := manager.New(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build manager: %w", err)
+	}
+	var replays cache.Cache[api.IdempotentResponse]
+	var subscriptions dm.SubscriptionStore
+	if rdb := mgr.Redis(); rdb != nil {
+		replays = redisstore.NewCache[api.IdempotentResponse](rdb, opts.Cache.RedisPrefix, "idempotency", api.DefaultIdempotencyTTL)
+		subscriptions = redisstore.NewSubscriptionStore(rdb, opts.Cache.RedisPrefix)
+		mgr.SetWatchStore(subscriptions)
+		mgr.SetQuarantineStore(subscriptions)
+		if cfg.Snapshots == nil {
+			cfg.Snapshots = redisstore.NewParamSnapshotStore(rdb, opts.Cache.RedisPrefix)
+		}
+		if cfg.Annotations == nil {
+			cfg.Annotations = redisstore.NewAnnotationStore(rdb, opts.Cache.RedisPrefix)
+		}
+	}
+
+	sup := dm.NewSupervisor(report)
+	restart := dm.RestartPolicy{Mode: dm.RestartOnFailure, MaxRestarts: 5}
+	var addErrs []error
+	add := func(c dm.Component) { addErrs = append(addErrs, sup.Add(c)) }
+	add(dm.Component{Name: "manager", Runner: dm.RunnerFuncs{StopFunc: func(context.Context) error { return mgr.Close() }}})
+
+	// bulk jobs and firmware rollouts run until Stop, which cancels the ones in flight
+	ctx, cancel := context.WithCancel(context.Background())
+	add(dm.Component{Name: "jobs", DependsOn: []string{"manager"}, Runner: dm.RunnerFuncs{StopFunc: func(context.Context) error { cancel(); return nil }}})
+
+	startup := []string{"manager"} // components the initial poll waits for
+	var webhooks *events.WebhookDispatcher
+	if cfg.Webhooks {
+		webhooks = events.NewWebhookDispatcher(events.WebhookConfig{DevicePartners: func(id dm.DeviceID) []string {
+			return dm.SplitPartners(mgr.DeviceAdapter().View().Metadata(string(id))[dm.MetadataPartnerIDs])
+		}, Store: subscriptions})
+		sub := mgr.Subscribe(256)
+		add(dm.Component{Name: "webhooks", Runner: dm.RunFunc(func(ctx context.Context) error {
+			if err := webhooks.Restore(ctx); err != nil {
+				report("webhooks", err)
+			}
+			return webhooks.Run(ctx, sub)
+		}), DependsOn: []string{"manager"}, Restart: restart})
+		startup = append(startup, "webhooks")
+	}
+	add(dm.Component{Name: "initial-poll", DependsOn: startup, Runner: dm.RunnerFuncs{StartFunc: func(ctx context.Context) error {
+		if err := mgr.RestoreQuarantines(ctx); err != nil {
+			report("initial-poll", err)
+		}
+		if err := mgr.LoadEnrichment(ctx); err != nil {
+			report("enrichment", err)
+		}
+		if _, err := mgr.Poll(ctx); err != nil {
+			report("initial-poll", err)
+		}
+		if err := mgr.RestoreWatches(ctx); err != nil {
+			report("initial-poll", err)
+		}
+		return nil
+	}}})
+	add(dm.Component{Name: "poller", DependsOn: []string{"initial-poll"}, Restart: restart, Runner: dm.RunFunc(func(ctx context.Context) error {
+		mgr.RunPolling(ctx, opts.Polling.DeviceList, nil, func(err error) { report("poller", err) })
+		return nil
+	})})
+	add(dm.Component{Name: "enrichment", DependsOn: []string{"initial-poll"}, Runner: dm.RunFunc(func(ctx context.Context) error {
+		mgr.RunEnrichment(ctx, func(err error) { report("enrichment", err) })
+		return nil
+	})})
+	var collector *quality.Collector
+	if opts.Quality.Interval > 0 {
+		collector = quality.NewCollector(mgr, opts.Quality, mgr.Registry())
+		add(dm.Component{Name: "quality", DependsOn: []string{"initial-poll"}, Restart: restart, Runner: dm.RunFunc(func(ctx context.Context) error { collector.Run(ctx); return nil })})
+	}
+	var assignments *settings.Service
+	if opts.XconfAdminBaseURL != "" {
+		assignments = settings.NewService(mgr)
+		add(dm.Component{Name: "settings-reconciler", DependsOn: []string{"initial-poll"}, Restart: restart, Runner: dm.RunFunc(func(ctx context.Context) error {
+			assignments.Run(ctx, opts.Polling.Settings, func(err error) { report("settings-reconciler", err) })
+			return nil
+		})})
+	}
+	if mgr.CaduceusHandler() != nil {
+		add(dm.Component{Name: "caduceus-registration", DependsOn: []string{"manager"}, Runner: dm.RunFunc(func(ctx context.Context) error {
+			mgr.RunCaduceus(ctx, func(err error) { report("caduceus-registration", err) })
+			return nil
+		})})
+	}
+
+	jobSvc := jobs.NewService(ctx, jobs.Builders(mgr))
+	jobSvc.SetApprovals(opts.Approvals)
+	// job artifacts go to the configured bucket, or to Redis when shared state is configured
+	if opts.Artifacts.Bucket != "" {
+		store, err := s3store.New(opts.Artifacts, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build artifact store: %w", err)
+		}
+		jobSvc.SetArtifacts(store)
+	} else if rdb := mgr.Redis(); rdb != nil {
+		jobSvc.SetArtifacts(redisstore.NewArtifactStore(rdb, opts.Cache.RedisPrefix, opts.Artifacts.TTL))
+	}
+	if len(opts.Notifications.Rules) > 0 {
+		notifier, err := notifications.New(opts.Notifications, func(err error) { report("notifier", err) })
+		if err != nil {
+			return nil, fmt.Errorf("failed to build notifier: %w", err)
+		}
+		jobSvc.SetOnFinish(notifier.JobFinished)
+		add(dm.Component{Name: "notifier", DependsOn: []string{"manager"}, Restart: restart, Runner: dm.RunFunc(func(ctx context.Context) error { notifier.Run(ctx, mgr); return nil })})
+	}
+	handler, err := server.NewDiscoveryHandler(server.DiscoveryConfig{
+		Manager:       mgr,
+		EnableGraphQL: cfg.GraphQL,
+		Partners:      cfg.Partners,
+		Authz:         cfg.Authz,
+		Allowlist:     allowlist,
+		Webhooks:      webhooks,
+		SigningKeys:   opts.Events.SigningKeys,
+		Jobs:          jobSvc,
+		Plans:         jobs.NewPlanner(jobSvc, mgr),
+		Snapshots:     snapshot.NewService(mgr, cfg.Snapshots),
+		Firmware:      firmware.NewService(ctx, mgr, firmware.Config{}),
+		Diagnostics:   diagnostics.NewRunner(mgr, diagnostics.Config{}),
+		Annotations:   annotation.NewService(mgr, cfg.Annotations),
+		Profiles:      profiles.NewService(mgr, cfg.Profiles),
+		Quality:       collector,
+		Settings:      assignments,
+		Idempotency:   api.NewIdempotency(replays),
+		PathPrefix:    cfg.Prefix,
+		LegacyAPI:     cfg.LegacyAPI,
+	})
+	if err == nil {
+		err = errors.Join(addErrs...)
+	}
+	if err != nil {
+		cancel()
+		_ = mgr.Close()
+		return nil, err
+	}
+	return &Embedded{Manager: mgr, Handler: handler, sup: sup}, nil
+}
+
+// Start seeds the device list with a first poll and starts the background work.
+func (e *Embedded) Start(ctx context.Context) error { return e.sup.Start(ctx) }
+
+// Stop stops the background work, cancels jobs in flight and closes the Manager.
+func (e *Embedded) Stop(ctx context.Context) error { return e.sup.Stop(ctx) }
+
+// Exited receives a background component failure devicemgr could not recover from.
+func (e *Embedded) Exited() <-chan error { return e.sup.Exited() }
+
+// Status reports the background components.
+func (e *Embedded) Status() []dm.ComponentStatus { return e.sup.Status() }
@@ -0,0 +1,80 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestEmbeddedUnderPrefix(t *testing.T) {
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v2/devices" {
+			_ = json.NewEncoder(w).Encode(map[string]any{"devices": []string{"mac:0000000000a1"}})
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer talaria.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = talaria.URL
+	e, err := New(opts, Config{Prefix: "/devicemgr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := e.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Stop(ctx)
+
+	mux := http.NewServeMux()
+	mux.Handle("/devicemgr/", e.Handler)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/devicemgr/api/devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Devices []struct {
+			ID string `json:"id"`
+		} `json:"devices"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || len(body.Devices) != 1 || body.Devices[0].ID != "mac:0000000000a1" {
+		t.Fatalf("devices %d %+v %v", resp.StatusCode, body, err)
+	}
+
+	resp, err = http.Post(srv.URL+"/devicemgr/api/jobs", "application/json", strings.NewReader(`{"operation":"reboot","devices":["mac:0000000000a1"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if loc := resp.Header.Get("Location"); resp.StatusCode != http.StatusAccepted || !strings.HasPrefix(loc, "/devicemgr/api/jobs/") {
+		t.Fatalf("submit %d, Location %q", resp.StatusCode, loc)
+	}
+
+	for _, path := range []string{"/api/devices", "/healthz"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want := map[string]int{"/api/devices": http.StatusNotFound, "/healthz": http.StatusNoContent}[path]; resp.StatusCode != want {
+			t.Fatalf("GET %s = %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+	for _, st := range e.Status() {
+		if st.State == dm.ComponentFailed {
+			t.Fatalf("component failed: %+v", st)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package devicemgr
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultEnrichmentInterval is how often an Enricher is reloaded when EnrichmentConfig.Interval is zero.
+const DefaultEnrichmentInterval = 15 * time.Minute
+
+// Enricher supplies business context for devices (account, subscriber, region, ...) from an
+// external inventory; package enrichment implements it over HTTP and CSV files.
+type Enricher interface {
+	// Load returns the attributes of every device the inventory knows, keyed by device ID.
+	Load(ctx context.Context) (map[DeviceID]map[string]string, error)
+}
+
+// EnrichmentConfig merges an Enricher's attributes into DeviceState.Metadata when Source is set.
+// Keys Talaria reports for a device take precedence, and MetadataPartnerIDs is never taken from
+// the inventory, so enrichment cannot widen partner scoping.
+type EnrichmentConfig struct {
+	Source   Enricher
+	Interval time.Duration // reload cadence; DefaultEnrichmentInterval when zero
+}
@@ -0,0 +1,164 @@
+// Package enrichment loads device business context (account, subscriber, region, ...) from
+// external inventories for devicemgr.EnrichmentConfig: an HTTP endpoint serving JSON, or a CSV
+// file.
+package enrichment
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// HTTPSource loads attributes with a GET of URL. The response is either an object keyed by device
+// ID, {"mac:112233445566": {"account": "A-17", "region": "east"}}, or an array of objects each with
+// an "id" field, [{"id": "mac:112233445566", "account": "A-17"}]. Non-string values are formatted
+// as text.
+type HTTPSource struct {
+	URL    string
+	Auth   dm.AuthStrategy // optional
+	Client *http.Client    // nil uses a client with a 30s timeout
+}
+
+// NewHTTPSource returns an HTTPSource for url.
+func NewHTTPSource(url string, auth dm.AuthStrategy) *HTTPSource {
+	return &HTTPSource{URL: url, Auth: auth, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Load implements devicemgr.Enricher.
+func (s *HTTPSource) Load(ctx context.Context) (map[dm.DeviceID]map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if s.Auth != nil {
+		if v, e := s.Auth.AuthorizationValue(); e == nil && v != "" {
+			req.Header.Set("Authorization", v)
+		}
+	}
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("inventory: %w", dm.ErrBackendUnavailable)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, dm.NewBackendError("inventory", resp)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("inventory: %w", err)
+	}
+	return decodeJSON(body)
+}
+
+func decodeJSON(body []byte) (map[dm.DeviceID]map[string]string, error) {
+	var rows []map[string]interface{}
+	if len(body) > 0 && body[0] == '[' {
+		if err := json.Unmarshal(body, &rows); err != nil {
+			return nil, fmt.Errorf("inventory: decode: %w", err)
+		}
+	} else {
+		var byID map[string]map[string]interface{}
+		if err := json.Unmarshal(body, &byID); err != nil {
+			return nil, fmt.Errorf("inventory: decode: %w", err)
+		}
+		for id, attrs := range byID {
+			if attrs == nil {
+				attrs = map[string]interface{}{}
+			}
+			attrs["id"] = id
+			rows = append(rows, attrs)
+		}
+	}
+	out := make(map[dm.DeviceID]map[string]string, len(rows))
+	for i, row := range rows {
+		raw, _ := row["id"].(string)
+		id, err := dm.ParseDeviceID(raw)
+		if err != nil {
+			return nil, fmt.Errorf("inventory: entry %d: %w", i, err)
+		}
+		attrs := make(map[string]string, len(row)-1)
+		for k, v := range row {
+			if k != "id" && v != nil {
+				if s, ok := v.(string); ok {
+					attrs[k] = s
+				} else {
+					attrs[k] = fmt.Sprint(v)
+				}
+			}
+		}
+		out[id] = attrs
+	}
+	return out, nil
+}
+
+// CSVFile loads attributes from a CSV file whose header names the columns. The device ID is in
+// the "id" or "deviceId" column (or the first one, when neither is named); every other non-empty
+// cell is an attribute named by its column. The file is read again on every Load, so it can be
+// replaced in place.
+type CSVFile struct {
+	Path string
+}
+
+// NewCSVFile returns a CSVFile reading path.
+func NewCSVFile(path string) *CSVFile { return &CSVFile{Path: path} }
+
+// Load implements devicemgr.Enricher.
+func (f *CSVFile) Load(context.Context) (map[dm.DeviceID]map[string]string, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r := csv.NewReader(file)
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = errors.New("missing header")
+		}
+		return nil, fmt.Errorf("%s: %w", f.Path, err)
+	}
+	idCol := 0
+	for i, name := range header {
+		header[i] = strings.TrimSpace(name)
+		if strings.EqualFold(header[i], "id") || strings.EqualFold(header[i], "deviceId") {
+			idCol = i
+		}
+	}
+	out := make(map[dm.DeviceID]map[string]string)
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Path, err)
+		}
+		line, _ := r.FieldPos(0)
+		id, err := dm.ParseDeviceID(rec[idCol])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", f.Path, line, err)
+		}
+		attrs := make(map[string]string, len(rec)-1)
+		for i, v := range rec {
+			if i != idCol && v != "" {
+				attrs[header[i]] = v
+			}
+		}
+		out[id] = attrs
+	}
+}
@@ -0,0 +1,70 @@
+package enrichment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestHTTPSource(t *testing.T) {
+	body := `{"MAC:11:22:33:44:55:66": {"account": "A-17", "tier": 3}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer inv" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	src := NewHTTPSource(srv.URL, dm.StaticAuth{Value: "Bearer inv"})
+	got, err := src.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := got["mac:112233445566"]; len(got) != 1 || a["account"] != "A-17" || a["tier"] != "3" {
+		t.Fatalf("object form: %v", got)
+	}
+
+	body = `[{"id": "mac:aabbccddeeff", "region": "east"}, {"id": "mac:000000000001"}]`
+	if got, err = src.Load(context.Background()); err != nil || len(got) != 2 || got["mac:aabbccddeeff"]["region"] != "east" {
+		t.Fatalf("array form: %v %v", got, err)
+	}
+	body = `[{"region": "east"}]`
+	if _, err := src.Load(context.Background()); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("entry without an ID: %v", err)
+	}
+	if _, err := NewHTTPSource(srv.URL, nil).Load(context.Background()); err == nil {
+		t.Fatal("expected the 401 to fail the load")
+	}
+}
+
+func TestCSVFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.csv")
+	csv := "account,deviceId,region\nA-17,AA-BB-CC-DD-EE-FF,east\nA-18,mac:000000000001,\n"
+	if err := os.WriteFile(path, []byte(csv), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewCSVFile(path).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := got["mac:aabbccddeeff"]; len(got) != 2 || a["account"] != "A-17" || a["region"] != "east" || a["deviceId"] != "" {
+		t.Fatalf("rows: %v", got)
+	}
+	if _, ok := got["mac:000000000001"]["region"]; ok {
+		t.Fatal("empty cells should be left out")
+	}
+
+	if err := os.WriteFile(path, []byte("id,account\nmac:1,A\nnot-a-device,B\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCSVFile(path).Load(context.Background()); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("bad ID: %v", err)
+	}
+}
@@ -1,18 +1,131 @@
 package devicemgr
 
-import "errors"
+import (
+	"errors"
+	"net/http"
+)
 
 var (
-	ErrDeviceNotFound          = errors.New("device not found")
-	ErrDeviceOffline           = errors.New("device offline")
-	ErrTimeout                 = errors.New("timeout")
-	ErrAccessDenied            = errors.New("access denied")
-	ErrInvalidParameter        = errors.New("invalid parameter")
-	ErrConflict                = errors.New("conflict")
-	ErrBackendUnavailable      = errors.New("backend unavailable")
-	ErrPolicyNotFound          = errors.New("policy not found")
-	ErrRuleConflict            = errors.New("rule conflict")
-	ErrUnsupportedStage        = errors.New("unsupported stage")
-	ErrChangeNotApproved       = errors.New("change not approved")
-	ErrInvalidTargetExpression = errors.New("invalid target expression")
+	ErrDeviceNotFound           = errors.New("device not found")
+	ErrDeviceOffline            = errors.New("device offline")
+	ErrTimeout                  = errors.New("timeout")
+	ErrAccessDenied             = errors.New("access denied")
+	ErrInvalidParameter         = errors.New("invalid parameter")
+	ErrConflict                 = errors.New("conflict")
+	ErrBackendUnavailable       = errors.New("backend unavailable")
+	ErrPolicyNotFound           = errors.New("policy not found")
+	ErrRuleConflict             = errors.New("rule conflict")
+	ErrUnsupportedStage         = errors.New("unsupported stage")
+	ErrChangeNotApproved        = errors.New("change not approved")
+	ErrInvalidTargetExpression  = errors.New("invalid target expression")
+	ErrConfirmationRequired     = errors.New("confirmation required")
+	ErrOutsideMaintenanceWindow = errors.New("outside maintenance window")
+	ErrSessionNotFound          = errors.New("session not found")
+	ErrCallNotFound             = errors.New("call not found")
+	ErrCanceled                 = errors.New("canceled")
+	ErrCursorExpired            = errors.New("cursor expired")
+	ErrArtifactNotFound         = errors.New("artifact not found")
+	ErrSubscriptionNotFound     = errors.New("subscription not found")
+	ErrQuarantined              = errors.New("device quarantined")
+	ErrQuarantineNotFound       = errors.New("quarantine not found")
+	ErrLockHeld                 = errors.New("configuration locked")
+	ErrLockNotFound             = errors.New("lock not found")
+)
+
+// Error codes name the sentinels in API error bodies, so clients branch on them rather than on
+// messages. Codes are stable: add new ones, never rename them.
+const (
+	CodeInternal                 = "internal"
+	CodeRateLimited              = "rate_limited"
+	CodeOperationConflict        = "operation_conflict"
+	CodeCircuitOpen              = "circuit_open"
+	CodeDeviceNotFound           = "device_not_found"
+	CodeDeviceOffline            = "device_offline"
+	CodeTimeout                  = "timeout"
+	CodeAccessDenied             = "access_denied"
+	CodeInvalidParameter         = "invalid_parameter"
+	CodeConflict                 = "conflict"
+	CodeBackendUnavailable       = "backend_unavailable"
+	CodePolicyNotFound           = "policy_not_found"
+	CodeRuleConflict             = "rule_conflict"
+	CodeUnsupportedStage         = "unsupported_stage"
+	CodeChangeNotApproved        = "change_not_approved"
+	CodeInvalidTargetExpression  = "invalid_target_expression"
+	CodeConfirmationRequired     = "confirmation_required"
+	CodeOutsideMaintenanceWindow = "outside_maintenance_window"
+	CodeSessionNotFound          = "session_not_found"
+	CodeCallNotFound             = "call_not_found"
+	CodeCanceled                 = "canceled"
+	CodeCursorExpired            = "cursor_expired"
+	CodeArtifactNotFound         = "artifact_not_found"
+	CodeSubscriptionNotFound     = "subscription_not_found"
+	CodeQuarantined              = "quarantined"
+	CodeQuarantineNotFound       = "quarantine_not_found"
+	CodeLockHeld                 = "lock_held"
+	CodeLockNotFound             = "lock_not_found"
 )
+
+// errorCodes maps sentinels to codes, the more specific before those they wrap.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrCircuitOpen, CodeCircuitOpen},
+	{ErrDeviceNotFound, CodeDeviceNotFound},
+	{ErrDeviceOffline, CodeDeviceOffline},
+	{ErrTimeout, CodeTimeout},
+	{ErrAccessDenied, CodeAccessDenied},
+	{ErrInvalidParameter, CodeInvalidParameter},
+	{ErrConflict, CodeConflict},
+	{ErrBackendUnavailable, CodeBackendUnavailable},
+	{ErrPolicyNotFound, CodePolicyNotFound},
+	{ErrRuleConflict, CodeRuleConflict},
+	{ErrUnsupportedStage, CodeUnsupportedStage},
+	{ErrChangeNotApproved, CodeChangeNotApproved},
+	{ErrInvalidTargetExpression, CodeInvalidTargetExpression},
+	{ErrConfirmationRequired, CodeConfirmationRequired},
+	{ErrOutsideMaintenanceWindow, CodeOutsideMaintenanceWindow},
+	{ErrSessionNotFound, CodeSessionNotFound},
+	{ErrCallNotFound, CodeCallNotFound},
+	{ErrCanceled, CodeCanceled},
+	{ErrCursorExpired, CodeCursorExpired},
+	{ErrArtifactNotFound, CodeArtifactNotFound},
+	{ErrSubscriptionNotFound, CodeSubscriptionNotFound},
+	{ErrQuarantined, CodeQuarantined},
+	{ErrQuarantineNotFound, CodeQuarantineNotFound},
+	{ErrLockHeld, CodeLockHeld},
+	{ErrLockNotFound, CodeLockNotFound},
+}
+
+// ErrorCode returns the code of the sentinel err matches: CodeRateLimited for a backend's 429,
+// CodeOperationConflict for an *OperationConflictError, CodeInternal for anything else.
+func ErrorCode(err error) string {
+	var be *BackendError
+	if errors.As(err, &be) && be.Status == http.StatusTooManyRequests {
+		return CodeRateLimited
+	}
+	var oc *OperationConflictError
+	if errors.As(err, &oc) {
+		return CodeOperationConflict
+	}
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return CodeInternal
+}
+
+// CodeError returns the sentinel of a code, nil for codes without one (CodeInternal,
+// CodeRateLimited and codes of other packages). CodeOperationConflict gives ErrConflict.
+func CodeError(code string) error {
+	if code == CodeOperationConflict {
+		return ErrConflict
+	}
+	for _, c := range errorCodes {
+		if c.code == code {
+			return c.err
+		}
+	}
+	return nil
+}
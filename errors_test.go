@@ -0,0 +1,34 @@
+package devicemgr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("get: %w", ErrDeviceNotFound), CodeDeviceNotFound},
+		{ErrCircuitOpen, CodeCircuitOpen},
+		{fmt.Errorf("poll: %w", &BackendError{Backend: "talaria", Status: 429}), CodeRateLimited},
+		{&BackendError{Backend: "talaria", Status: 503}, CodeBackendUnavailable},
+		{&OperationConflictError{DeviceID: "mac:aa"}, CodeOperationConflict},
+		{&MaintenanceWindowError{}, CodeOutsideMaintenanceWindow},
+		{errors.New("boom"), CodeInternal},
+	} {
+		if got := ErrorCode(c.err); got != c.want {
+			t.Errorf("%v: code %s, want %s", c.err, got, c.want)
+		}
+	}
+	for _, c := range errorCodes {
+		if got := CodeError(ErrorCode(c.err)); got != c.err {
+			t.Errorf("%s: CodeError gave %v", c.code, got)
+		}
+	}
+	if CodeError(CodeInternal) != nil || CodeError("job_not_found") != nil {
+		t.Error("codes without a sentinel should give nil")
+	}
+}
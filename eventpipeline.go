@@ -0,0 +1,36 @@
+package devicemgr
+
+// Event pipeline stage types (see EventStage).
+const (
+	StageEnrich    = "enrich"    // copies device metadata and fixed values into Tags
+	StagePartner   = "partner"   // tags the device's partner IDs as TagPartners
+	StageDrop      = "drop"      // drops the matching events
+	StageTransform = "transform" // sets, renames and removes members of object payloads
+)
+
+// TagPartners is the tag a partner stage writes: the device's partner IDs, comma separated.
+const TagPartners = "partners"
+
+// EventStage is one step of the event pipeline (EventsConfig.Pipeline). Stages run in order on
+// every event before the Manager fans it out, so subscribers, webhooks and the Kafka and NATS
+// publishers all see the same decorated events; the Manager's own consumers (the change feed and
+// parameter watches) included. A stage applies to the events its match fields select: all of
+// them when those are empty.
+type EventStage struct {
+	Type string `json:"type"` // StageEnrich, StagePartner, StageDrop or StageTransform
+
+	Kinds       []EventKind       `json:"kinds,omitempty"`
+	DeviceMatch string            `json:"deviceMatch,omitempty"` // a regular expression over device IDs
+	When        map[string]string `json:"when,omitempty"`        // tags, as earlier stages set them, to match exactly
+
+	// Metadata (enrich) lists the device metadata keys copied into tags of the same name; missing
+	// keys are skipped. Tags (enrich) are fixed tags, replacing ones of the same name.
+	Metadata []string          `json:"metadata,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+
+	// Set, Rename and Remove (transform) edit the top-level members of JSON object payloads, in
+	// that order; other payloads are left alone.
+	Set    map[string]interface{} `json:"set,omitempty"`
+	Rename map[string]string      `json:"rename,omitempty"` // old member name to new
+	Remove []string               `json:"remove,omitempty"`
+}
@@ -0,0 +1,418 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// DefaultDedupWindow is how far apart identical events from different sources may occur and still
+// be treated as one when BusConfig.DedupWindow is unset: two device list polls.
+const DefaultDedupWindow = 30 * time.Second
+
+// BusConfig tunes a Bus.
+type BusConfig struct {
+	// DedupWindow is how far apart in OccurredAt two identical events (same device, kind and
+	// payload) are treated as one; negative disables deduplication.
+	DedupWindow time.Duration
+	// Redactor masks sensitive parameter values in the payloads delivered; duplicates are still
+	// recognized by the original payloads.
+	Redactor *dm.Redactor
+	// Pipeline decorates, transforms and drops events once they are redacted; dropped events count
+	// for neither ordering nor deduplication.
+	Pipeline *Pipeline
+}
+
+// Bus fans events from several sources out to subscribers. Events are stamped with a bus-wide
+// sequence number and delivered to every subscriber in sequence order, so a device's events reach
+// all consumers in the same order. A connectivity event (online, offline, suspect) that occurred
+// before the device's last delivered one is dropped as stale, as is one repeating that last event
+// within DedupWindow (the same transition seen by polling and by MQTT). Other events are dropped
+// when an identical one for the device occurred within DedupWindow.
+type Bus struct {
+	window   time.Duration
+	redactor *dm.Redactor
+	pipeline *Pipeline
+	in       dm.EventSubscription
+
+	mu        sync.Mutex
+	seq       uint64
+	state     map[dm.DeviceID]seen // last connectivity event delivered per device
+	recent    map[string]time.Time // other events delivered within the window, by device and key
+	listeners []chan dm.Event
+	acked     []*AckedSubscription
+	closed    bool
+	done      chan struct{}
+}
+
+// seen records a delivered event.
+type seen struct {
+	key string
+	at  time.Time
+}
+
+// NewBus starts dispatching events from sources; Close stops it and closes the sources.
+func NewBus(cfg BusConfig, sources ...dm.EventSubscription) *Bus {
+	if cfg.DedupWindow == 0 {
+		cfg.DedupWindow = DefaultDedupWindow
+	}
+	b := &Bus{window: cfg.DedupWindow, redactor: cfg.Redactor, pipeline: cfg.Pipeline, in: Merge(256, sources...), state: make(map[dm.DeviceID]seen), recent: make(map[string]time.Time), done: make(chan struct{})}
+	go b.run()
+	return b
+}
+
+func (b *Bus) run() {
+	defer close(b.done)
+	sweep := time.NewTicker(b.sweepInterval())
+	defer sweep.Stop()
+	for {
+		select {
+		case e, ok := <-b.in.C():
+			if !ok {
+				b.closeListeners()
+				return
+			}
+			b.publish(e)
+		case now := <-sweep.C:
+			b.sweep(now)
+		}
+	}
+}
+
+func (b *Bus) sweepInterval() time.Duration {
+	if b.window > 0 {
+		return b.window
+	}
+	return time.Minute
+}
+
+// Publish delivers an event raised by the process itself rather than read from a source, such as
+// a drift found by reconciliation, under the same ordering and deduplication rules. Events
+// published after Close are dropped.
+func (b *Bus) Publish(e dm.Event) { b.publish(e) }
+
+// publish sequences e and delivers it unless it is stale or a duplicate.
+func (b *Bus) publish(e dm.Event) {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+	out, ok := b.pipeline.Apply(Redact(b.redactor, e))
+	if !ok {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.admit(e) {
+		return
+	}
+	b.seq++
+	out.Seq = b.seq
+	for _, ch := range b.listeners {
+		select {
+		case ch <- out:
+		default: /* drop if slow */
+		}
+	}
+	live := b.acked[:0]
+	for _, a := range b.acked {
+		if a.offer(out) {
+			live = append(live, a)
+		}
+	}
+	b.acked = live
+}
+
+// admit applies the ordering and deduplication rules, recording e when it is delivered.
+func (b *Bus) admit(e dm.Event) bool {
+	key := eventKey(e)
+	if connectivity(e.Kind) {
+		prev, ok := b.state[e.DeviceID]
+		if ok && (e.OccurredAt.Before(prev.at) || b.duplicate(prev, key, e.OccurredAt)) {
+			return false
+		}
+		b.state[e.DeviceID] = seen{key: key, at: e.OccurredAt}
+		return true
+	}
+	rk := string(e.DeviceID) + "|" + key
+	if at, ok := b.recent[rk]; ok && b.duplicate(seen{key: key, at: at}, key, e.OccurredAt) {
+		return false
+	}
+	b.recent[rk] = e.OccurredAt
+	return true
+}
+
+func (b *Bus) duplicate(prev seen, key string, at time.Time) bool {
+	d := at.Sub(prev.at)
+	if d < 0 {
+		d = -d
+	}
+	return b.window > 0 && prev.key == key && d <= b.window
+}
+
+// sweep forgets notifications older than the window. Each device's last connectivity event is
+// kept so stale transitions are recognized however long the device stays in one state.
+func (b *Bus) sweep(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for k, at := range b.recent {
+		if now.Sub(at) > b.window {
+			delete(b.recent, k)
+		}
+	}
+}
+
+func connectivity(k dm.EventKind) bool {
+	return k == dm.EventOnline || k == dm.EventOffline || k == dm.EventSuspect
+}
+
+// eventKey identifies an event for deduplication; the source and time are not part of it.
+func eventKey(e dm.Event) string {
+	payload, err := json.Marshal(e.Payload)
+	if err != nil {
+		payload = []byte(fmt.Sprintf("%v", e.Payload))
+	}
+	return string(e.Kind) + "|" + string(payload)
+}
+
+// Subscribe returns the bus events delivered after the call; a subscriber that falls buffer
+// events behind misses events rather than stalling the others.
+func (b *Bus) Subscribe(buffer int) dm.EventSubscription {
+	ch := make(chan dm.Event, buffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+	} else {
+		b.listeners = append(b.listeners, ch)
+	}
+	return &busSub{b: b, ch: ch}
+}
+
+// Subscribers counts the open subscriptions, acknowledged ones included.
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.listeners) + len(b.acked)
+}
+
+func (b *Bus) unsubscribe(ch chan dm.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, l := range b.listeners {
+		if l == ch {
+			b.listeners = append(b.listeners[:i:i], b.listeners[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
+
+func (b *Bus) closeListeners() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for _, ch := range b.listeners {
+		close(ch)
+	}
+	b.listeners = nil
+	for _, a := range b.acked {
+		a.close()
+	}
+	b.acked = nil
+}
+
+// Close closes the sources and, once their events are dispatched, every subscription.
+func (b *Bus) Close() error {
+	err := b.in.Close()
+	<-b.done
+	return err
+}
+
+type busSub struct {
+	b    *Bus
+	ch   chan dm.Event
+	once sync.Once
+}
+
+func (s *busSub) C() <-chan dm.Event { return s.ch }
+
+func (s *busSub) Close() error {
+	s.once.Do(func() { s.b.unsubscribe(s.ch) })
+	return nil
+}
+
+// ErrAckOverflow ends an acknowledged subscription whose consumer left more events unacknowledged
+// than its buffer holds. The held events are still delivered before the subscription closes; later
+// ones are not, so the consumer must resynchronize (with a new subscription).
+var ErrAckOverflow = errors.New("events: acknowledged subscription overflowed")
+
+// Acker is implemented by subscriptions whose events are held until acknowledged.
+type Acker interface {
+	// Ack releases every held event with a sequence number up to and including seq.
+	Ack(seq uint64)
+	// Nack redelivers every held event, oldest first, as when the consumer lost the events it had
+	// read but not acknowledged (a failed batch, a reconnect).
+	Nack()
+	// Err returns ErrAckOverflow once the subscription overflowed, or nil.
+	Err() error
+}
+
+// SubscribeAcked returns a subscription for consumers that must not lose events. Each event is
+// held from delivery until Ack releases it and redelivered after Nack, and up to buffer events
+// may be held at once, leaving the bus and other subscribers unaffected by a slow consumer. A
+// consumer that falls further behind is not silently skipped: the subscription delivers what it
+// holds, then closes and reports ErrAckOverflow from Err.
+func (b *Bus) SubscribeAcked(buffer int) *AckedSubscription {
+	if buffer <= 0 {
+		buffer = 1
+	}
+	a := &AckedSubscription{b: b, ch: make(chan dm.Event), limit: buffer, wake: make(chan struct{}, 1)}
+	b.mu.Lock()
+	if b.closed {
+		a.closed = true
+	} else {
+		b.acked = append(b.acked, a)
+	}
+	b.mu.Unlock()
+	go a.pump()
+	return a
+}
+
+// AckedSubscription is a Bus subscription with ack-based flow control; see Bus.SubscribeAcked.
+type AckedSubscription struct {
+	b     *Bus
+	ch    chan dm.Event // unbuffered, so every event sent has been read
+	limit int
+	wake  chan struct{} // tells pump the subscription changed
+
+	mu      sync.Mutex
+	held    []dm.Event // events not yet acknowledged, ascending by Seq
+	sent    uint64     // Seq of the last held event delivered; 0 before the first or after Nack
+	nacks   uint64     // Nack calls, so a send racing one is delivered again
+	closed  bool       // no further events are accepted; the held ones are still delivered
+	stopped bool       // Close: nothing more is delivered
+	err     error
+}
+
+func (a *AckedSubscription) C() <-chan dm.Event { return a.ch }
+
+// offer holds e for delivery, reporting false once the subscription no longer accepts events; the
+// bus calls it holding b.mu.
+func (a *AckedSubscription) offer(e dm.Event) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return false
+	}
+	if len(a.held) >= a.limit {
+		a.closed, a.err = true, fmt.Errorf("%w: %d events unacknowledged", ErrAckOverflow, len(a.held))
+		a.signal()
+		return false
+	}
+	a.held = append(a.held, e)
+	a.signal()
+	return true
+}
+
+// signal wakes pump; a.mu must be held.
+func (a *AckedSubscription) signal() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pump delivers the held events in order, closing the channel once the subscription is closed
+// and everything held has been delivered, or at once after Close.
+func (a *AckedSubscription) pump() {
+	defer close(a.ch)
+	for {
+		a.mu.Lock()
+		if a.stopped {
+			a.mu.Unlock()
+			return
+		}
+		i := sort.Search(len(a.held), func(i int) bool { return a.held[i].Seq > a.sent })
+		if i == len(a.held) {
+			closed := a.closed
+			a.mu.Unlock()
+			if closed {
+				return
+			}
+			<-a.wake
+			continue
+		}
+		e, nacks := a.held[i], a.nacks
+		a.mu.Unlock()
+		select {
+		case a.ch <- e:
+			a.mu.Lock()
+			if a.nacks == nacks {
+				a.sent = e.Seq
+			}
+			a.mu.Unlock()
+		case <-a.wake: // acknowledged, redelivered or closed meanwhile
+		}
+	}
+}
+
+func (a *AckedSubscription) Ack(seq uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for n < len(a.held) && a.held[n].Seq <= seq {
+		n++
+	}
+	a.held = a.held[n:]
+	a.signal()
+}
+
+func (a *AckedSubscription) Nack() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sent = 0
+	a.nacks++
+	a.signal()
+}
+
+func (a *AckedSubscription) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// Held returns the number of events not yet acknowledged, delivered or not.
+func (a *AckedSubscription) Held() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.held)
+}
+
+// close stops accepting events once the bus closes; the held ones are still delivered.
+func (a *AckedSubscription) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.closed = true
+	a.signal()
+}
+
+func (a *AckedSubscription) Close() error {
+	a.b.mu.Lock()
+	for i, s := range a.b.acked {
+		if s == a {
+			a.b.acked = append(a.b.acked[:i:i], a.b.acked[i+1:]...)
+			break
+		}
+	}
+	a.b.mu.Unlock()
+	a.mu.Lock()
+	a.closed, a.stopped = true, true
+	a.signal()
+	a.mu.Unlock()
+	return nil
+}
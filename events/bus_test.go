@@ -0,0 +1,192 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestBusOrdersAndDeduplicates(t *testing.T) {
+	poll, mqtt := &closingSub{ch: make(chan dm.Event, 8)}, &closingSub{ch: make(chan dm.Event, 8)}
+	b := NewBus(BusConfig{DedupWindow: time.Minute}, poll, mqtt)
+	sub := b.Subscribe(16)
+	at := time.Now()
+	next := func() dm.Event {
+		t.Helper()
+		select {
+		case e := <-sub.C():
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+		}
+		return dm.Event{}
+	}
+
+	mqtt.ch <- dm.Event{Kind: dm.EventOnline, DeviceID: "mac:aa", OccurredAt: at, Source: "mqtt-adapter"}
+	if e := next(); e.Seq != 1 || e.Kind != dm.EventOnline {
+		t.Fatalf("first event %+v", e)
+	}
+	// the poll sees the same transition shortly after
+	poll.ch <- dm.Event{Kind: dm.EventOnline, DeviceID: "mac:aa", OccurredAt: at.Add(10 * time.Second), Source: "synthetic-poll"}
+	// a transition that occurred before the one already delivered is stale
+	poll.ch <- dm.Event{Kind: dm.EventOffline, DeviceID: "mac:aa", OccurredAt: at.Add(-time.Second)}
+	mqtt.ch <- dm.Event{Kind: dm.EventOffline, DeviceID: "mac:aa", OccurredAt: at.Add(20 * time.Second)}
+	if e := next(); e.Seq != 2 || e.Kind != dm.EventOffline || !e.OccurredAt.Equal(at.Add(20*time.Second)) {
+		t.Fatalf("expected the fresh offline as seq 2, got %+v", e)
+	}
+	// reconnecting within the window is a new transition, not a duplicate of the first online
+	mqtt.ch <- dm.Event{Kind: dm.EventOnline, DeviceID: "mac:aa", OccurredAt: at.Add(30 * time.Second)}
+	if e := next(); e.Seq != 3 || e.Kind != dm.EventOnline {
+		t.Fatalf("reconnect %+v", e)
+	}
+
+	// notifications deduplicate on payload; other devices are independent
+	note := dm.Event{Kind: dm.EventNotification, DeviceID: "mac:aa", OccurredAt: at, Payload: map[string]any{"v": 1}}
+	mqtt.ch <- note
+	poll.ch <- note
+	mqtt.ch <- dm.Event{Kind: dm.EventNotification, DeviceID: "mac:aa", OccurredAt: at, Payload: map[string]any{"v": 2}}
+	mqtt.ch <- dm.Event{Kind: dm.EventNotification, DeviceID: "mac:bb", OccurredAt: at, Payload: map[string]any{"v": 2}}
+	var got []dm.Event
+	for i := 0; i < 3; i++ {
+		got = append(got, next())
+	}
+	for i, e := range got {
+		if e.Seq != uint64(4+i) {
+			t.Fatalf("event %d has seq %d", i, e.Seq)
+		}
+	}
+	select {
+	case e := <-sub.C():
+		t.Fatalf("duplicate delivered: %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.Close()
+	if _, ok := <-sub.C(); ok {
+		t.Fatal("subscription open after Close")
+	}
+	if _, ok := <-b.Subscribe(1).C(); ok {
+		t.Fatal("subscription to a closed bus is open")
+	}
+}
+
+func TestBusDedupDisabled(t *testing.T) {
+	src := &closingSub{ch: make(chan dm.Event, 2)}
+	b := NewBus(BusConfig{DedupWindow: -1}, src)
+	defer b.Close()
+	sub := b.Subscribe(4)
+	at := time.Now()
+	src.ch <- dm.Event{Kind: dm.EventOnline, DeviceID: "mac:aa", OccurredAt: at}
+	src.ch <- dm.Event{Kind: dm.EventOnline, DeviceID: "mac:aa", OccurredAt: at}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-sub.C():
+		case <-time.After(time.Second):
+			t.Fatalf("event %d dropped with deduplication disabled", i)
+		}
+	}
+}
+
+func TestBusRedacts(t *testing.T) {
+	src := &closingSub{ch: make(chan dm.Event, 3)}
+	b := NewBus(BusConfig{Redactor: dm.NewRedactor(dm.RedactionConfig{})}, src)
+	defer b.Close()
+	sub := b.Subscribe(4)
+	at := time.Now()
+	src.ch <- dm.Event{Kind: dm.EventNotification, DeviceID: "mac:aa", OccurredAt: at, Payload: `{"paramName":"Device.WiFi.AccessPoint.1.Security.KeyPassphrase","paramValue":"one"}`}
+	// a different secret is not a duplicate of the first, though both are delivered masked
+	src.ch <- dm.Event{Kind: dm.EventNotification, DeviceID: "mac:aa", OccurredAt: at, Payload: `{"paramName":"Device.WiFi.AccessPoint.1.Security.KeyPassphrase","paramValue":"two"}`}
+	src.ch <- dm.Event{Kind: dm.EventDrift, DeviceID: "mac:aa", OccurredAt: at, Payload: Drift{Parameter: "Device.WiFi.SSID.1.SSID", Expected: "home", Actual: "cafe"}}
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-sub.C():
+			if e.Payload != `{"paramName":"Device.WiFi.AccessPoint.1.Security.KeyPassphrase","paramValue":"[REDACTED]"}` {
+				t.Fatalf("event %d payload %v", i, e.Payload)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d not delivered", i)
+		}
+	}
+	select {
+	case e := <-sub.C():
+		if _, ok := e.Payload.(Drift); !ok {
+			t.Fatalf("a payload with nothing to mask should keep its type: %#v", e.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("drift not delivered")
+	}
+}
+
+func TestBusAckedSubscription(t *testing.T) {
+	src := &closingSub{ch: make(chan dm.Event, 8)}
+	b := NewBus(BusConfig{DedupWindow: -1}, src)
+	a := b.SubscribeAcked(3)
+	plain := b.Subscribe(8)
+	at := time.Now()
+	publish := func(payload int) {
+		src.ch <- dm.Event{Kind: dm.EventNotification, DeviceID: "mac:aa", OccurredAt: at, Payload: payload}
+		<-plain.C()
+	}
+	next := func() dm.Event {
+		t.Helper()
+		select {
+		case e := <-a.C():
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("no event delivered")
+		}
+		return dm.Event{}
+	}
+
+	// at the buffer limit every event is held and delivered
+	for i := 0; i < 3; i++ {
+		publish(i)
+	}
+	first, second := next(), next()
+	if first.Payload != 0 || second.Payload != 1 || a.Held() != 3 || a.Err() != nil {
+		t.Fatalf("delivered %+v %+v, held %d, err %v", first, second, a.Held(), a.Err())
+	}
+	a.Ack(first.Seq)
+	publish(3)
+	// a nack redelivers what is unacknowledged, oldest first
+	a.Nack()
+	var last dm.Event
+	for _, want := range []int{1, 2, 3} {
+		if last = next(); last.Payload != want {
+			t.Fatalf("redelivered %+v, want payload %d", last, want)
+		}
+	}
+	a.Ack(last.Seq)
+	if a.Held() != 0 {
+		t.Fatalf("held %d after acking everything", a.Held())
+	}
+
+	// falling behind by more than the buffer ends the subscription, once what it holds is delivered
+	for i := 4; i < 8; i++ {
+		publish(i)
+	}
+	for want := 4; want < 7; want++ {
+		if e := next(); e.Payload != want {
+			t.Fatalf("held event %+v, want payload %d", e, want)
+		}
+	}
+	if _, ok := <-a.C(); ok || !errors.Is(a.Err(), ErrAckOverflow) {
+		t.Fatalf("overflowed subscription still open, err %v", a.Err())
+	}
+	if n := b.Subscribers(); n != 1 {
+		t.Fatalf("%d subscribers after the overflow", n)
+	}
+
+	// closing the bus delivers the held events before closing the channel
+	c := b.SubscribeAcked(2)
+	publish(8)
+	b.Close()
+	if e, ok := <-c.C(); !ok || e.Payload != 8 {
+		t.Fatalf("held event lost on close: %+v %v", e, ok)
+	}
+	if _, ok := <-c.C(); ok || c.Err() != nil {
+		t.Fatalf("subscription open after close, err %v", c.Err())
+	}
+}
@@ -0,0 +1,58 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/wrpmsg"
+)
+
+// Encoder serializes an Event for an external transport.
+type Encoder interface {
+	Encode(dm.Event) ([]byte, error)
+	ContentType() string
+}
+
+// JSONEncoder writes events as Envelopes.
+type JSONEncoder struct{}
+
+func (JSONEncoder) ContentType() string { return "application/json" }
+
+func (JSONEncoder) Encode(e dm.Event) ([]byte, error) { return json.Marshal(NewEnvelope(e)) }
+
+// DecodeJSON parses an event produced by JSONEncoder; payloads decode as generic JSON values.
+func DecodeJSON(b []byte) (dm.Event, error) {
+	env, err := DecodeEnvelope(b)
+	if err != nil {
+		return dm.Event{}, err
+	}
+	return env.Event(), nil
+}
+
+// WRPEncoder wraps events in msgpack WRP SimpleEvent messages addressed the way Talaria
+// addresses device-status events (event:device-status/<device>/<kind>); the payload is the JSON encoding.
+type WRPEncoder struct {
+	Source string // WRP source; defaults to wrpmsg.DefaultSource
+}
+
+func (WRPEncoder) ContentType() string { return wrpmsg.ContentType }
+
+func (w WRPEncoder) Encode(e dm.Event) ([]byte, error) {
+	payload, err := JSONEncoder{}.Encode(e)
+	if err != nil {
+		return nil, err
+	}
+	return wrpmsg.Encode(wrpmsg.Event(w.Source, fmt.Sprintf("event:device-status/%s/%s", e.DeviceID, e.Kind), "application/json", payload))
+}
+
+// EncoderFor selects an encoder by name ("json" or "wrp"/"msgpack").
+func EncoderFor(name string) (Encoder, error) {
+	switch name {
+	case "", "json":
+		return JSONEncoder{}, nil
+	case "wrp", "msgpack":
+		return WRPEncoder{}, nil
+	}
+	return nil, fmt.Errorf("events: unknown encoding %q", name)
+}
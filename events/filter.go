@@ -0,0 +1,47 @@
+package events
+
+import (
+	"strings"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Filter selects events by kind and device; empty fields match everything.
+type Filter struct {
+	Kinds   []dm.EventKind
+	Devices []dm.DeviceID
+}
+
+// ParseFilter builds a Filter from comma-separated kind and device lists (as used by query
+// parameters and CLI flags).
+func ParseFilter(kinds, devices string) Filter {
+	var f Filter
+	for _, k := range strings.Split(kinds, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			f.Kinds = append(f.Kinds, dm.EventKind(k))
+		}
+	}
+	for _, d := range strings.Split(devices, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			f.Devices = append(f.Devices, dm.DeviceID(d))
+		}
+	}
+	return f
+}
+
+// Match reports whether e passes the filter.
+func (f Filter) Match(e dm.Event) bool {
+	return matchAny(f.Kinds, e.Kind) && matchAny(f.Devices, e.DeviceID)
+}
+
+func matchAny[T comparable](set []T, v T) bool {
+	if len(set) == 0 {
+		return true
+	}
+	for _, s := range set {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
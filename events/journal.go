@@ -0,0 +1,136 @@
+package events
+
+import (
+	"sort"
+	"sync"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// DefaultJournalSize is the number of events Journal keeps when NewJournal is given no size.
+const DefaultJournalSize = 10000
+
+// JournalEntry is an event recorded by a Journal.
+type JournalEntry struct {
+	dm.Event
+	// Partners are the device's partners when the event was recorded, so partner scoping still
+	// applies to a device gone from the device list by the time the entry is read.
+	Partners []string
+}
+
+// JournalConfig tunes a Journal.
+type JournalConfig struct {
+	Size   int    // events held (DefaultJournalSize)
+	Filter Filter // events recorded; others only advance the journal's position
+	// Partners, which may be nil, returns a device's partners as an event of the device is
+	// recorded; when it has none, the partners last returned for the device are kept instead.
+	Partners func(dm.DeviceID) []string
+}
+
+// Journal keeps the latest events of every device in bus sequence order, so a consumer can read
+// everything delivered after the last event it saw. It is bounded: once Size events are held the
+// oldest is evicted, and reading from before it reports the position as lost.
+type Journal struct {
+	cfg JournalConfig
+
+	mu      sync.RWMutex
+	entries []JournalEntry // ring buffer; start is the oldest
+	start   int
+	head    uint64                   // Seq of the newest event seen
+	lost    uint64                   // events up to this Seq are no longer held
+	known   map[dm.DeviceID][]string // each device's last known partners
+}
+
+func NewJournal(cfg JournalConfig) *Journal {
+	if cfg.Size <= 0 {
+		cfg.Size = DefaultJournalSize
+	}
+	return &Journal{cfg: cfg, known: make(map[dm.DeviceID][]string)}
+}
+
+// Add records e when it passes the filter. Events must carry increasing bus sequence numbers; a
+// gap in them, left by events the journal's subscription dropped, counts as lost.
+func (j *Journal) Add(e dm.Event) {
+	keep := j.cfg.Filter.Match(e)
+	var partners []string
+	if keep && j.cfg.Partners != nil {
+		partners = j.cfg.Partners(e.DeviceID)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if e.Seq <= j.head {
+		return
+	}
+	if e.Seq > j.head+1 {
+		j.lost = e.Seq - 1
+	}
+	j.head = e.Seq
+	if !keep {
+		return
+	}
+	if len(partners) > 0 {
+		j.known[e.DeviceID] = partners
+	} else {
+		partners = j.known[e.DeviceID]
+	}
+	entry := JournalEntry{Event: e, Partners: partners}
+	if len(j.entries) < j.cfg.Size {
+		j.entries = append(j.entries, entry)
+		return
+	}
+	j.lost = max(j.lost, j.entries[j.start].Seq)
+	j.entries[j.start] = entry
+	j.start = (j.start + 1) % j.cfg.Size
+}
+
+// Head returns the sequence number of the newest event seen, zero before the first.
+func (j *Journal) Head() uint64 {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.head
+}
+
+// JournalPage is a read from a Journal.
+type JournalPage struct {
+	Entries []JournalEntry
+	Next    uint64 // reading after this continues where the page ends
+	More    bool   // entries after the page are already held
+}
+
+// Since returns up to limit entries recorded after the event numbered after, oldest first; zero
+// limit returns them all. It reports ok false when events after that one are no longer held, so
+// the consumer has missed some; the page then starts from the oldest entry still held.
+func (j *Journal) Since(after uint64, limit int) (page JournalPage, ok bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	ok = after >= j.lost
+	after = max(after, j.lost)
+	n := len(j.entries)
+	at := func(i int) JournalEntry { return j.entries[(j.start+i)%n] }
+	first := sort.Search(n, func(i int) bool { return at(i).Seq > after })
+	count := n - first
+	page.Next = max(after, j.head)
+	if limit > 0 && count > limit {
+		count, page.More = limit, true
+	}
+	page.Entries = make([]JournalEntry, count)
+	for i := range page.Entries {
+		page.Entries[i] = at(first + i)
+	}
+	if page.More {
+		page.Next = page.Entries[count-1].Seq
+	}
+	return page, ok
+}
+
+// Run records events from sub until it is closed, acknowledging each once recorded when sub is
+// an Acker.
+func (j *Journal) Run(sub dm.EventSubscription) {
+	acker, _ := sub.(Acker)
+	for e := range sub.C() {
+		j.Add(e)
+		if acker != nil {
+			acker.Ack(e.Seq)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package events
+
+import (
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestJournal(t *testing.T) {
+	partners := map[dm.DeviceID][]string{"a": {"comcast"}}
+	j := NewJournal(JournalConfig{
+		Size:     2,
+		Filter:   Filter{Kinds: []dm.EventKind{dm.EventOnline, dm.EventOffline}},
+		Partners: func(id dm.DeviceID) []string { return partners[id] },
+	})
+	j.Add(dm.Event{Kind: dm.EventOnline, DeviceID: "a", Seq: 1})
+	j.Add(dm.Event{Kind: dm.EventNotification, DeviceID: "a", Seq: 2})
+	delete(partners, "a")
+	j.Add(dm.Event{Kind: dm.EventOffline, DeviceID: "a", Seq: 3})
+
+	page, ok := j.Since(0, 0)
+	if !ok || len(page.Entries) != 2 || page.Next != 3 || page.More {
+		t.Fatalf("since 0: %+v %v", page, ok)
+	}
+	if got := page.Entries[1].Partners; len(got) != 1 || got[0] != "comcast" {
+		t.Fatalf("last known partners not kept: %v", got)
+	}
+	if page, _ := j.Since(0, 1); len(page.Entries) != 1 || page.Next != 1 || !page.More {
+		t.Fatalf("limited: %+v", page)
+	}
+	if page, _ := j.Since(1, 0); len(page.Entries) != 1 || page.Entries[0].Seq != 3 {
+		t.Fatalf("since 1: %+v", page)
+	}
+
+	j.Add(dm.Event{Kind: dm.EventOnline, DeviceID: "b", Seq: 4})
+	if page, ok := j.Since(0, 0); ok || len(page.Entries) != 2 || page.Entries[0].Seq != 3 {
+		t.Fatalf("reading from before an evicted event should report it lost: %+v %v", page, ok)
+	}
+	if page, ok := j.Since(1, 0); !ok || len(page.Entries) != 2 {
+		t.Fatalf("since 1 after eviction: %+v %v", page, ok)
+	}
+	// a gap in the sequence means the subscription dropped events
+	j.Add(dm.Event{Kind: dm.EventOnline, DeviceID: "c", Seq: 7})
+	if _, ok := j.Since(4, 0); ok {
+		t.Fatal("a sequence gap should report the skipped events lost")
+	}
+	if page, ok := j.Since(6, 0); !ok || page.Next != 7 || len(page.Entries) != 1 {
+		t.Fatalf("since 6: %+v %v", page, ok)
+	}
+}
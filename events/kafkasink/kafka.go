@@ -0,0 +1,57 @@
+package kafkasink
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+)
+
+// Config configures a Kafka sink.
+type Config struct {
+	Brokers      []string      // required
+	BatchTimeout time.Duration // optional; producer-side linger, default 10ms (the Publisher already batches)
+	RequiredAcks kafka.RequiredAcks
+}
+
+// Sink publishes event batches to Kafka; messages are keyed by device ID so each device's
+// events land on one partition in order.
+type Sink struct {
+	w *kafka.Writer
+}
+
+// New creates a Kafka sink. Topics are taken per message.
+func New(cfg Config) (*Sink, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("kafkasink: brokers required")
+	}
+	if cfg.BatchTimeout <= 0 {
+		cfg.BatchTimeout = 10 * time.Millisecond
+	}
+	if cfg.RequiredAcks == 0 {
+		cfg.RequiredAcks = kafka.RequireAll
+	}
+	return &Sink{w: &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: cfg.BatchTimeout,
+		RequiredAcks: cfg.RequiredAcks,
+	}}, nil
+}
+
+func (s *Sink) Publish(ctx context.Context, msgs []events.Message) error {
+	out := make([]kafka.Message, len(msgs))
+	for i, m := range msgs {
+		out[i] = kafka.Message{
+			Topic:   m.Topic,
+			Key:     m.Key,
+			Value:   m.Value,
+			Headers: []kafka.Header{{Key: "content-type", Value: []byte(m.ContentType)}},
+		}
+	}
+	return s.w.WriteMessages(ctx, out...)
+}
+
+func (s *Sink) Close() error { return s.w.Close() }
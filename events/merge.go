@@ -0,0 +1,53 @@
+package events
+
+import (
+	"sync"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Merge fans several subscriptions into one. Closing the result closes every source; the merged
+// channel closes once all sources have.
+func Merge(buffer int, subs ...dm.EventSubscription) dm.EventSubscription {
+	if len(subs) == 1 {
+		return subs[0]
+	}
+	m := &merged{ch: make(chan dm.Event, buffer), subs: subs}
+	var wg sync.WaitGroup
+	for _, s := range subs {
+		wg.Add(1)
+		go func(s dm.EventSubscription) {
+			defer wg.Done()
+			for e := range s.C() {
+				m.ch <- e
+			}
+		}(s)
+	}
+	go func() {
+		wg.Wait()
+		close(m.ch)
+	}()
+	return m
+}
+
+type merged struct {
+	ch        chan dm.Event
+	subs      []dm.EventSubscription
+	closeOnce sync.Once
+}
+
+func (m *merged) C() <-chan dm.Event { return m.ch }
+
+func (m *merged) Close() error {
+	m.closeOnce.Do(func() {
+		for _, s := range m.subs {
+			_ = s.Close()
+		}
+		// drain so forwarders blocked on a full channel can observe their source closing
+		go func() {
+			for range m.ch {
+			}
+		}()
+	})
+	return nil
+}
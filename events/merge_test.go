@@ -0,0 +1,44 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+type closingSub struct{ ch chan dm.Event }
+
+func (s *closingSub) C() <-chan dm.Event { return s.ch }
+func (s *closingSub) Close() error       { close(s.ch); return nil }
+
+func TestMerge(t *testing.T) {
+	a, b := &closingSub{ch: make(chan dm.Event, 1)}, &closingSub{ch: make(chan dm.Event, 1)}
+	m := Merge(4, a, b)
+	a.ch <- dm.Event{DeviceID: "a"}
+	b.ch <- dm.Event{DeviceID: "b"}
+	seen := map[dm.DeviceID]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-m.C():
+			seen[e.DeviceID] = true
+		case <-time.After(time.Second):
+			t.Fatal("merged event not delivered")
+		}
+	}
+	if !seen["a"] || !seen["b"] {
+		t.Fatalf("seen %v", seen)
+	}
+	m.Close()
+	select {
+	case _, ok := <-m.C():
+		for ok {
+			_, ok = <-m.C()
+		}
+	case <-time.After(time.Second):
+		t.Fatal("merged channel not closed after Close")
+	}
+	if Merge(1, a) != dm.EventSubscription(a) {
+		t.Fatal("single subscription should be returned as is")
+	}
+}
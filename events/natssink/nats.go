@@ -0,0 +1,41 @@
+package natssink
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+)
+
+// Sink publishes event batches to NATS subjects (the message topic). Core NATS is
+// fire-and-forget, so a batch is confirmed with a server round trip (FlushWithContext).
+type Sink struct {
+	nc *nats.Conn
+}
+
+// New connects to the NATS server(s) at url (comma-separated list accepted).
+func New(url string, opts ...nats.Option) (*Sink, error) {
+	nc, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Sink{nc: nc}, nil
+}
+
+func (s *Sink) Publish(ctx context.Context, msgs []events.Message) error {
+	for _, m := range msgs {
+		msg := nats.NewMsg(m.Topic)
+		msg.Data = m.Value
+		msg.Header.Set("Content-Type", m.ContentType)
+		msg.Header.Set("Device-Id", string(m.Key))
+		if err := s.nc.PublishMsg(msg); err != nil {
+			return err
+		}
+	}
+	return s.nc.FlushWithContext(ctx)
+}
+
+func (s *Sink) Close() error {
+	s.nc.Close()
+	return nil
+}
@@ -0,0 +1,136 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Pipeline applies the stages of dm.EventsConfig.Pipeline to events. The nil Pipeline passes
+// every event through unchanged.
+type Pipeline struct {
+	stages   []stage
+	metadata func(dm.DeviceID) map[string]string
+}
+
+type stage struct {
+	dm.EventStage
+	device *regexp.Regexp
+}
+
+// NewPipeline compiles stages, returning nil when there are none. metadata looks up a device's
+// metadata for enrich and partner stages; without it they only add their fixed tags.
+func NewPipeline(stages []dm.EventStage, metadata func(dm.DeviceID) map[string]string) (*Pipeline, error) {
+	if len(stages) == 0 {
+		return nil, nil
+	}
+	p := &Pipeline{metadata: metadata}
+	for i, s := range stages {
+		switch s.Type {
+		case dm.StageEnrich, dm.StagePartner, dm.StageDrop, dm.StageTransform:
+		default:
+			return nil, fmt.Errorf("events: pipeline stage %d: unknown type %q", i, s.Type)
+		}
+		st := stage{EventStage: s}
+		if s.DeviceMatch != "" {
+			re, err := regexp.Compile(s.DeviceMatch)
+			if err != nil {
+				return nil, fmt.Errorf("events: pipeline stage %d: device matcher: %w", i, err)
+			}
+			st.device = re
+		}
+		p.stages = append(p.stages, st)
+	}
+	return p, nil
+}
+
+// Apply runs e through the stages, reporting false when a drop stage dropped it. e's tags are
+// copied before they are changed.
+func (p *Pipeline) Apply(e dm.Event) (dm.Event, bool) {
+	if p == nil {
+		return e, true
+	}
+	var md map[string]string // looked up once, on first use
+	copied := false
+	tag := func(k, v string) {
+		if !copied {
+			tags := make(map[string]string, len(e.Tags)+1)
+			for k, v := range e.Tags {
+				tags[k] = v
+			}
+			e.Tags, copied = tags, true
+		}
+		e.Tags[k] = v
+	}
+	metadata := func() map[string]string {
+		if md == nil && p.metadata != nil {
+			md = p.metadata(e.DeviceID)
+		}
+		return md
+	}
+	for _, s := range p.stages {
+		if !s.matches(e) {
+			continue
+		}
+		switch s.Type {
+		case dm.StageDrop:
+			return e, false
+		case dm.StageEnrich:
+			for _, k := range s.Metadata {
+				if v, ok := metadata()[k]; ok {
+					tag(k, v)
+				}
+			}
+			for k, v := range s.Tags {
+				tag(k, v)
+			}
+		case dm.StagePartner:
+			if ids := dm.SplitPartners(metadata()[dm.MetadataPartnerIDs]); len(ids) > 0 {
+				tag(dm.TagPartners, strings.Join(ids, ","))
+			}
+		case dm.StageTransform:
+			e = transform(s.EventStage, e)
+		}
+	}
+	return e, true
+}
+
+func (s stage) matches(e dm.Event) bool {
+	if !matchAny(s.Kinds, e.Kind) || (s.device != nil && !s.device.MatchString(string(e.DeviceID))) {
+		return false
+	}
+	for k, v := range s.When {
+		if got, ok := e.Tags[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// transform edits the members of an object payload; other payloads are returned as they are.
+func transform(s dm.EventStage, e dm.Event) dm.Event {
+	raw, ok := payloadJSON(e.Payload)
+	if !ok {
+		return e
+	}
+	var obj map[string]interface{}
+	if json.Unmarshal(raw, &obj) != nil || obj == nil {
+		return e
+	}
+	for k, v := range s.Set {
+		obj[k] = v
+	}
+	for from, to := range s.Rename {
+		if v, ok := obj[from]; ok {
+			delete(obj, from)
+			obj[to] = v
+		}
+	}
+	for _, k := range s.Remove {
+		delete(obj, k)
+	}
+	return withPayload(e, obj)
+}
@@ -0,0 +1,83 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestPipeline(t *testing.T) {
+	md := map[dm.DeviceID]map[string]string{
+		"mac:aa": {dm.MetadataModel: "TG4482", dm.MetadataPartnerIDs: "comcast,sky", "region": "east"},
+		"mac:bb": {dm.MetadataModel: "XB7"},
+	}
+	p, err := NewPipeline([]dm.EventStage{
+		{Type: dm.StageEnrich, Metadata: []string{dm.MetadataModel, "region"}, Tags: map[string]string{"env": "prod"}},
+		{Type: dm.StagePartner},
+		{Type: dm.StageDrop, Kinds: []dm.EventKind{dm.EventNotification}, When: map[string]string{dm.MetadataModel: "XB7"}},
+		{Type: dm.StageTransform, DeviceMatch: "^mac:aa", Set: map[string]interface{}{"site": "lab"}, Rename: map[string]string{"reason": "cause"}, Remove: []string{"debug"}},
+	}, func(id dm.DeviceID) map[string]string { return md[id] })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := dm.Event{Kind: dm.EventOffline, DeviceID: "mac:aa", Payload: `{"reason":"timeout","debug":true}`, Tags: map[string]string{"source": "poll"}}
+	out, ok := p.Apply(in)
+	if !ok {
+		t.Fatal("dropped")
+	}
+	want := map[string]string{"source": "poll", dm.MetadataModel: "TG4482", "region": "east", "env": "prod", dm.TagPartners: "comcast,sky"}
+	if len(out.Tags) != len(want) {
+		t.Fatalf("tags %v", out.Tags)
+	}
+	for k, v := range want {
+		if out.Tags[k] != v {
+			t.Fatalf("tags %v", out.Tags)
+		}
+	}
+	if len(in.Tags) != 1 {
+		t.Fatalf("the input's tags were changed: %v", in.Tags)
+	}
+	var payload map[string]interface{}
+	if s, ok := out.Payload.(string); !ok || json.Unmarshal([]byte(s), &payload) != nil || payload["cause"] != "timeout" || payload["site"] != "lab" || len(payload) != 2 {
+		t.Fatalf("payload %#v", out.Payload)
+	}
+
+	if _, ok := p.Apply(dm.Event{Kind: dm.EventNotification, DeviceID: "mac:bb"}); ok {
+		t.Fatal("expected the XB7 notification dropped")
+	}
+	out, ok = p.Apply(dm.Event{Kind: dm.EventOnline, DeviceID: "mac:bb", Payload: "plain"})
+	if !ok || out.Payload != "plain" || out.Tags[dm.MetadataModel] != "XB7" || out.Tags[dm.TagPartners] != "" {
+		t.Fatalf("got %+v %v", out, ok)
+	}
+
+	if _, err := NewPipeline([]dm.EventStage{{Type: "rewrite"}}, nil); err == nil {
+		t.Fatal("expected an unknown stage type refused")
+	}
+	if _, err := NewPipeline([]dm.EventStage{{Type: dm.StageDrop, DeviceMatch: "("}}, nil); err == nil {
+		t.Fatal("expected a bad device matcher refused")
+	}
+	if p, err := NewPipeline(nil, nil); p != nil || err != nil {
+		t.Fatalf("expected no pipeline, got %v %v", p, err)
+	}
+}
+
+func TestBusPipeline(t *testing.T) {
+	p, _ := NewPipeline([]dm.EventStage{
+		{Type: dm.StageDrop, Kinds: []dm.EventKind{dm.EventCrash}},
+		{Type: dm.StageEnrich, Tags: map[string]string{"cluster": "a"}},
+	}, nil)
+	b := NewBus(BusConfig{Pipeline: p})
+	defer b.Close()
+	sub := b.Subscribe(4)
+	b.Publish(dm.Event{Kind: dm.EventCrash, DeviceID: "mac:aa"})
+	b.Publish(dm.Event{Kind: dm.EventOnline, DeviceID: "mac:aa"})
+	e := <-sub.C()
+	if e.Kind != dm.EventOnline || e.Tags["cluster"] != "a" || e.Seq != 1 {
+		t.Fatalf("got %+v", e)
+	}
+	if env := NewEnvelope(e); env.Tags["cluster"] != "a" {
+		t.Fatalf("envelope tags %v", env.Tags)
+	}
+}
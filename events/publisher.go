@@ -0,0 +1,238 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Message is one serialized event handed to a Sink.
+type Message struct {
+	Topic       string
+	Key         []byte // device ID; keeps per-device ordering on partitioned transports
+	Value       []byte
+	ContentType string
+}
+
+// Sink delivers batches of messages to an external system (Kafka, NATS, ...).
+// Publish must either deliver the whole batch or return an error; the Publisher retries failed batches.
+type Sink interface {
+	Publish(ctx context.Context, msgs []Message) error
+	Close() error
+}
+
+// PublisherConfig configures a Publisher.
+type PublisherConfig struct {
+	Sink    Sink    // required
+	Encoder Encoder // optional; defaults to JSONEncoder
+	// Topic may contain {kind} and {device} placeholders; defaults to "devicemgr.events".
+	Topic string
+	// Bindings publish matching events to further topics as well; optional.
+	Bindings      *TopicBindings
+	BatchSize     int           // optional; default 100
+	FlushInterval time.Duration // optional; default 1s
+	MaxRetries    int           // optional; retries per batch after the first attempt (0 = 3, negative = none)
+	RetryBackoff  time.Duration // optional; initial backoff doubled per retry, default 200ms
+	Logger        *log.Logger   // optional; defaults to log.Default()
+}
+
+// Publisher forwards devicemgr events from subscriptions to a Sink in batches.
+type Publisher struct {
+	cfg PublisherConfig
+
+	published atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// PublisherStats reports delivery counters.
+type PublisherStats struct {
+	Published uint64
+	Dropped   uint64
+}
+
+// NewPublisher validates cfg and applies defaults.
+func NewPublisher(cfg PublisherConfig) (*Publisher, error) {
+	if cfg.Sink == nil {
+		return nil, errors.New("events: sink required")
+	}
+	if cfg.Encoder == nil {
+		cfg.Encoder = JSONEncoder{}
+	}
+	if cfg.Topic == "" {
+		cfg.Topic = "devicemgr.events"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 200 * time.Millisecond
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.Default()
+	}
+	return &Publisher{cfg: cfg}, nil
+}
+
+// Stats returns a snapshot of delivery counters.
+func (p *Publisher) Stats() PublisherStats {
+	return PublisherStats{Published: p.published.Load(), Dropped: p.dropped.Load()}
+}
+
+// Run consumes events from subs until ctx is canceled or every subscription channel closes,
+// flushing pending messages before returning. Subscriptions remain owned by the caller.
+//
+// Events from a subscription implementing Acker (Bus.SubscribeAcked) are acknowledged once their
+// batch is published, and such batches are retried until they succeed or ctx is canceled rather
+// than dropped after MaxRetries, leaving the subscription to hold later events meanwhile. Run
+// starts by redelivering what such a subscription holds, the events an earlier Run read but did
+// not publish, and returns the subscription's Err when it closes.
+func (p *Publisher) Run(ctx context.Context, subs ...dm.EventSubscription) error {
+	in := make(chan sourced, p.cfg.BatchSize)
+	var wg sync.WaitGroup
+	var ackers []Acker
+	for _, s := range subs {
+		wg.Add(1)
+		acker, _ := s.(Acker)
+		if acker != nil {
+			acker.Nack()
+			ackers = append(ackers, acker)
+		}
+		go func(c <-chan dm.Event) {
+			defer wg.Done()
+			for {
+				select {
+				case e, ok := <-c:
+					if !ok {
+						return
+					}
+					select {
+					case in <- sourced{e, acker}:
+					case <-ctx.Done():
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(s.C())
+	}
+	go func() { wg.Wait(); close(in) }()
+
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]Message, 0, p.cfg.BatchSize)
+	var acks []sourced // acknowledged once batch is published
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 || p.deliver(ctx, batch, len(acks) > 0) {
+			for _, a := range acks {
+				a.acker.Ack(a.Seq)
+			}
+		}
+		batch, acks = batch[:0], acks[:0]
+	}
+	for {
+		select {
+		case s, ok := <-in:
+			if !ok {
+				flush(context.Background())
+				errs := []error{ctx.Err()}
+				for _, a := range ackers {
+					errs = append(errs, a.Err())
+				}
+				return errors.Join(errs...)
+			}
+			e := s.Event
+			if s.acker != nil {
+				acks = append(acks, s)
+			}
+			msgs, err := p.messages(e)
+			if err != nil {
+				p.dropped.Add(1)
+				p.cfg.Logger.Printf("events: encode %s event for %s: %v", e.Kind, e.DeviceID, err)
+				continue
+			}
+			batch = append(batch, msgs...)
+			if len(batch) >= p.cfg.BatchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		case <-ctx.Done():
+			// best-effort final flush with a bounded deadline
+			fctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			flush(fctx)
+			cancel()
+			return ctx.Err()
+		}
+	}
+}
+
+// sourced is an event with the acknowledger of the subscription it came from, if any.
+type sourced struct {
+	dm.Event
+	acker Acker
+}
+
+// messages encodes e once for Topic and each further topic it is bound to.
+func (p *Publisher) messages(e dm.Event) ([]Message, error) {
+	b, err := p.cfg.Encoder.Encode(e)
+	if err != nil {
+		return nil, err
+	}
+	topic := expandTopic(p.cfg.Topic, e)
+	msgs := []Message{{Topic: topic, Key: []byte(e.DeviceID), Value: b, ContentType: p.cfg.Encoder.ContentType()}}
+	if p.cfg.Bindings != nil {
+		for _, t := range p.cfg.Bindings.topics(e) {
+			if t != topic && t != msgs[len(msgs)-1].Topic {
+				msgs = append(msgs, Message{Topic: t, Key: msgs[0].Key, Value: b, ContentType: msgs[0].ContentType})
+			}
+		}
+	}
+	return msgs, nil
+}
+
+// maxRetryBackoff caps the backoff between attempts of a batch that is retried until it succeeds.
+const maxRetryBackoff = 30 * time.Second
+
+// deliver publishes a batch with exponential backoff, reporting whether it was published. Batches
+// still failing after MaxRetries are dropped unless persistent, which retries until ctx is done.
+func (p *Publisher) deliver(ctx context.Context, batch []Message, persistent bool) bool {
+	msgs := append([]Message(nil), batch...)
+	backoff := p.cfg.RetryBackoff
+	var err error
+	attempts := 0
+retry:
+	for persistent || attempts <= p.cfg.MaxRetries {
+		if attempts > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				break retry
+			}
+			if backoff *= 2; backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+		}
+		attempts++
+		if err = p.cfg.Sink.Publish(ctx, msgs); err == nil {
+			p.published.Add(uint64(len(msgs)))
+			return true
+		}
+	}
+	p.dropped.Add(uint64(len(msgs)))
+	p.cfg.Logger.Printf("events: dropping batch of %d after %d attempts: %v", len(msgs), attempts, err)
+	return false
+}
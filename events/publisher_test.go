@@ -0,0 +1,197 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+type fakeSub struct{ ch chan dm.Event }
+
+func (f *fakeSub) C() <-chan dm.Event { return f.ch }
+func (f *fakeSub) Close() error       { return nil }
+
+type flakySink struct {
+	mu       sync.Mutex
+	failures int
+	batches  [][]Message
+}
+
+func (s *flakySink) Publish(ctx context.Context, msgs []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("broker unavailable")
+	}
+	s.batches = append(s.batches, append([]Message(nil), msgs...))
+	return nil
+}
+
+func (s *flakySink) Close() error { return nil }
+
+func TestPublisherBatchesAndRetries(t *testing.T) {
+	sink := &flakySink{failures: 1}
+	p, err := NewPublisher(PublisherConfig{Sink: sink, BatchSize: 2, FlushInterval: time.Hour, RetryBackoff: time.Millisecond, Topic: "dm.{kind}", Logger: log.New(io.Discard, "", 0)})
+	if err != nil {
+		t.Fatalf("new publisher: %v", err)
+	}
+	sub := &fakeSub{ch: make(chan dm.Event, 4)}
+	sub.ch <- dm.Event{Kind: dm.EventOnline, DeviceID: "mac:aa"}
+	sub.ch <- dm.Event{Kind: dm.EventOffline, DeviceID: "mac:bb"}
+	sub.ch <- dm.Event{Kind: dm.EventOnline, DeviceID: "mac:cc"}
+	close(sub.ch)
+	if err := p.Run(context.Background(), sub); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(sink.batches) != 2 || len(sink.batches[0]) != 2 || len(sink.batches[1]) != 1 {
+		t.Fatalf("unexpected batches: %+v", sink.batches)
+	}
+	first := sink.batches[0][0]
+	if first.Topic != "dm.online" || string(first.Key) != "mac:aa" {
+		t.Fatalf("unexpected message routing: %+v", first)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(first.Value, &decoded); err != nil || decoded["deviceId"] != "mac:aa" {
+		t.Fatalf("unexpected payload %s (%v)", first.Value, err)
+	}
+	if st := p.Stats(); st.Published != 3 || st.Dropped != 0 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+}
+
+func TestPublisherDropsAfterRetries(t *testing.T) {
+	sink := &flakySink{failures: 10}
+	p, _ := NewPublisher(PublisherConfig{Sink: sink, BatchSize: 1, MaxRetries: 2, RetryBackoff: time.Millisecond, Logger: log.New(io.Discard, "", 0)})
+	sub := &fakeSub{ch: make(chan dm.Event, 1)}
+	sub.ch <- dm.Event{Kind: dm.EventOnline, DeviceID: "mac:aa"}
+	close(sub.ch)
+	_ = p.Run(context.Background(), sub)
+	if st := p.Stats(); st.Dropped != 1 || sink.failures != 7 {
+		t.Fatalf("expected 3 attempts then drop, stats %+v failures left %d", st, sink.failures)
+	}
+}
+
+func TestWRPEncoder(t *testing.T) {
+	b, err := WRPEncoder{}.Encode(dm.Event{Kind: dm.EventOffline, DeviceID: "mac:112233445566", OccurredAt: time.Now()})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var msg wrp.Message
+	if err := wrp.NewDecoderBytes(b, wrp.Msgpack).Decode(&msg); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if msg.Type != wrp.SimpleEventMessageType || msg.Destination != "event:device-status/mac:112233445566/offline" {
+		t.Fatalf("unexpected wrp message: %+v", msg)
+	}
+}
+
+func TestPublisherAcksAndRetriesAckedSubscriptions(t *testing.T) {
+	sink := &flakySink{failures: 5}
+	p, _ := NewPublisher(PublisherConfig{Sink: sink, BatchSize: 2, MaxRetries: 1, RetryBackoff: time.Millisecond, Logger: log.New(io.Discard, "", 0)})
+	src := &closingSub{ch: make(chan dm.Event, 2)}
+	b := NewBus(BusConfig{}, src)
+	a := b.SubscribeAcked(4)
+	src.ch <- dm.Event{Kind: dm.EventOnline, DeviceID: "mac:aa"}
+	src.ch <- dm.Event{Kind: dm.EventOnline, DeviceID: "mac:bb"}
+	done := make(chan error)
+	go func() { done <- p.Run(context.Background(), a) }()
+	deadline := time.Now().Add(time.Second)
+	for a.Held() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("events never acknowledged; stats %+v", p.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	b.Close()
+	<-done
+	// five failures exceed MaxRetries, but the batch is retried rather than dropped
+	if st := p.Stats(); st.Published != 2 || st.Dropped != 0 || len(sink.batches) != 1 {
+		t.Fatalf("stats %+v batches %d", st, len(sink.batches))
+	}
+}
+
+func TestPublisherRedeliversUnacknowledged(t *testing.T) {
+	sink := &flakySink{}
+	p, _ := NewPublisher(PublisherConfig{Sink: sink, BatchSize: 2, RetryBackoff: time.Millisecond, Logger: log.New(io.Discard, "", 0)})
+	src := &closingSub{ch: make(chan dm.Event, 2)}
+	b := NewBus(BusConfig{}, src)
+	a := b.SubscribeAcked(4)
+	src.ch <- dm.Event{Kind: dm.EventOnline, DeviceID: "mac:aa"}
+	src.ch <- dm.Event{Kind: dm.EventOnline, DeviceID: "mac:bb"}
+	// an earlier consumer read an event and stopped before acknowledging it
+	if e := <-a.C(); e.DeviceID != "mac:aa" {
+		t.Fatalf("read %+v", e)
+	}
+	done := make(chan error)
+	go func() { done <- p.Run(context.Background(), a) }()
+	deadline := time.Now().Add(time.Second)
+	for a.Held() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("events never acknowledged; stats %+v", p.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	b.Close()
+	<-done
+	if st := p.Stats(); st.Published != 2 || len(sink.batches) != 1 || string(sink.batches[0][0].Key) != "mac:aa" {
+		t.Fatalf("stats %+v batches %v", st, sink.batches)
+	}
+}
+
+func TestPublisherTopicBindings(t *testing.T) {
+	store := dm.NewMemorySubscriptionStore()
+	ctx := context.Background()
+	bindings := NewTopicBindings(store, nil)
+	if _, err := bindings.Add(ctx, TopicBinding{Topic: "ops.{kind}", Events: []dm.EventKind{dm.EventOffline}, DeviceMatch: []string{"^mac:aa"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bindings.Add(ctx, TopicBinding{Topic: "dm.events"}); err != nil { // the default topic already carries it
+		t.Fatal(err)
+	}
+	if _, err := bindings.Add(ctx, TopicBinding{Topic: "scoped", Partners: []string{"comcast"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bindings.Add(ctx, TopicBinding{Topic: " "}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("expected ErrInvalidParameter for an empty topic, got %v", err)
+	}
+
+	restored := NewTopicBindings(store, nil)
+	if err := restored.Restore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.List(ctx); len(got) != 3 {
+		t.Fatalf("restored %+v", got)
+	}
+	if got := restored.List(dm.WithPartners(ctx, []string{"comcast"})); len(got) != 1 || got[0].Topic != "scoped" {
+		t.Fatalf("scoped list %+v", got)
+	}
+	sink := &flakySink{}
+	p, err := NewPublisher(PublisherConfig{Sink: sink, Topic: "dm.events", Bindings: restored, FlushInterval: time.Hour, Logger: log.New(io.Discard, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := &fakeSub{ch: make(chan dm.Event, 2)}
+	sub.ch <- dm.Event{Kind: dm.EventOffline, DeviceID: "mac:aa01"}
+	sub.ch <- dm.Event{Kind: dm.EventOffline, DeviceID: "mac:bb01"}
+	close(sub.ch)
+	if err := p.Run(ctx, sub); err != nil {
+		t.Fatal(err)
+	}
+	var topics []string
+	for _, m := range sink.batches[0] {
+		topics = append(topics, string(m.Key)+"@"+m.Topic)
+	}
+	if got := strings.Join(topics, " "); got != "mac:aa01@dm.events mac:aa01@ops.offline mac:bb01@dm.events" {
+		t.Fatalf("routed %s", got)
+	}
+}
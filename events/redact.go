@@ -0,0 +1,48 @@
+package events
+
+import (
+	"encoding/json"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Redact masks the sensitive parameter values in e's payload (see dm.Redactor.JSON). A payload
+// with nothing to mask is returned as is; a masked one becomes generic JSON values, or JSON text
+// again when the source delivered text.
+func Redact(r *dm.Redactor, e dm.Event) dm.Event {
+	if r == nil {
+		return e
+	}
+	raw, ok := payloadJSON(e.Payload)
+	if !ok {
+		return e
+	}
+	var v interface{}
+	if json.Unmarshal(raw, &v) != nil || !r.JSON(v) {
+		return e
+	}
+	return withPayload(e, v)
+}
+
+// withPayload replaces e's payload with v, a generic JSON value, as JSON text again when the
+// source delivered text.
+func withPayload(e dm.Event, v interface{}) dm.Event {
+	switch e.Payload.(type) {
+	case string, []byte, json.RawMessage:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return e
+		}
+		switch e.Payload.(type) {
+		case string:
+			e.Payload = string(b)
+		case []byte:
+			e.Payload = b
+		default:
+			e.Payload = json.RawMessage(b)
+		}
+	default:
+		e.Payload = v
+	}
+	return e
+}
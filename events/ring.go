@@ -0,0 +1,74 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// DefaultRingSize is the number of events Ring keeps per device when NewRing is given no size.
+const DefaultRingSize = 100
+
+// Ring keeps the most recent events of each device in memory, so recent history is available
+// without an external store.
+type Ring struct {
+	size int
+
+	mu       sync.RWMutex
+	byDevice map[dm.DeviceID][]dm.Event
+}
+
+func NewRing(size int) *Ring {
+	if size <= 0 {
+		size = DefaultRingSize
+	}
+	return &Ring{size: size, byDevice: make(map[dm.DeviceID][]dm.Event)}
+}
+
+// Add records e, evicting the device's oldest event once it holds size events.
+func (r *Ring) Add(e dm.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	evts := r.byDevice[e.DeviceID]
+	if len(evts) == r.size {
+		copy(evts, evts[1:])
+		evts = evts[:len(evts)-1]
+	}
+	r.byDevice[e.DeviceID] = append(evts, e)
+}
+
+// Since returns the device's recorded events that occurred at or after since, oldest first.
+func (r *Ring) Since(id dm.DeviceID, since time.Time) []dm.Event {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []dm.Event
+	for _, e := range r.byDevice[id] {
+		if !e.OccurredAt.Before(since) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Count returns how many recorded events of any device occurred at or after since and satisfy keep.
+func (r *Ring) Count(since time.Time, keep func(dm.Event) bool) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n := 0
+	for _, evts := range r.byDevice {
+		for _, e := range evts {
+			if !e.OccurredAt.Before(since) && keep(e) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Run records events from sub until it is closed.
+func (r *Ring) Run(sub dm.EventSubscription) {
+	for e := range sub.C() {
+		r.Add(e)
+	}
+}
@@ -0,0 +1,28 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(2)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		r.Add(dm.Event{Kind: dm.EventOnline, DeviceID: "a", OccurredAt: start.Add(time.Duration(i) * time.Second), Payload: i})
+	}
+	r.Add(dm.Event{Kind: dm.EventOffline, DeviceID: "b", OccurredAt: start})
+
+	got := r.Since("a", time.Time{})
+	if len(got) != 2 || got[0].Payload != 1 || got[1].Payload != 2 {
+		t.Fatalf("expected the two newest events, got %+v", got)
+	}
+	if got := r.Since("a", start.Add(2*time.Second)); len(got) != 1 || got[0].Payload != 2 {
+		t.Fatalf("since filter: %+v", got)
+	}
+	if got := r.Since("c", time.Time{}); len(got) != 0 {
+		t.Fatalf("unknown device: %+v", got)
+	}
+}
@@ -0,0 +1,219 @@
+package events
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// SchemaVersion is the version of the Envelope encoding described by Schema. Fields are only added
+// within a version; removing or retyping one starts a new version.
+const SchemaVersion = 1
+
+//go:embed schema/event.v1.json
+var schema []byte
+
+// Schema returns the JSON Schema (draft 2020-12) of the Envelope encoding.
+func Schema() []byte { return schema }
+
+// Envelope is the JSON encoding of an Event on external transports: SSE, Kafka, NATS and webhooks.
+// Payload is the event payload as its source produced it. The typed variant matching Kind is
+// decoded from it when the payload has a known shape, and is absent otherwise.
+type Envelope struct {
+	Version    int               `json:"version"`
+	Kind       dm.EventKind      `json:"kind"`
+	DeviceID   dm.DeviceID       `json:"deviceId"`
+	OccurredAt time.Time         `json:"occurredAt"` // UTC
+	Source     string            `json:"source,omitempty"`
+	Seq        uint64            `json:"seq,omitempty"`
+	Payload    interface{}       `json:"payload,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+
+	Connectivity *Connectivity `json:"connectivity,omitempty"` // online, suspect and offline
+	Notification *Notification `json:"notification,omitempty"`
+	Drift        *Drift        `json:"drift,omitempty"`
+}
+
+// Connectivity is the typed payload of online, suspect and offline events.
+type Connectivity struct {
+	From   string `json:"from,omitempty"` // the previous status, when the source tracks it
+	To     string `json:"to"`             // online, suspect or offline
+	Reason string `json:"reason,omitempty"`
+}
+
+// Notification is the typed payload of notification events.
+type Notification struct {
+	Method  string            `json:"method,omitempty"` // of a JSON-RPC (Blizzard) notification
+	Changes []ParameterChange `json:"changes,omitempty"`
+}
+
+// ParameterChange is one parameter value change reported by a notification.
+type ParameterChange struct {
+	Name         string      `json:"name"`
+	Value        interface{} `json:"value"`
+	DataType     string      `json:"dataType,omitempty"`
+	ChangeSource string      `json:"changeSource,omitempty"`
+}
+
+// Drift is the payload of drift events: a parameter's reported value differs from the one a
+// profile or policy expects.
+type Drift struct {
+	Parameter string      `json:"parameter"`
+	Expected  interface{} `json:"expected"`
+	Actual    interface{} `json:"actual"`
+	Profile   string      `json:"profile,omitempty"` // the profile or policy expecting Expected
+}
+
+// NewEnvelope encodes e at SchemaVersion.
+func NewEnvelope(e dm.Event) Envelope {
+	env := Envelope{Version: SchemaVersion, Kind: e.Kind, DeviceID: e.DeviceID, OccurredAt: e.OccurredAt.UTC(), Source: e.Source, Seq: e.Seq, Payload: e.Payload, Tags: e.Tags}
+	switch e.Kind {
+	case dm.EventOnline, dm.EventSuspect, dm.EventOffline:
+		c := &Connectivity{}
+		if s, ok := e.Payload.(string); ok {
+			c.Reason = s
+		} else if raw, ok := payloadJSON(e.Payload); ok {
+			_ = json.Unmarshal(raw, c)
+		}
+		if c.To == "" {
+			c.To = string(e.Kind)
+		}
+		env.Connectivity = c
+	case dm.EventNotification:
+		n := &Notification{Changes: ParameterChanges(e.Payload)}
+		if raw, ok := payloadJSON(e.Payload); ok {
+			var rpc struct {
+				Method string `json:"method"`
+			}
+			_ = json.Unmarshal(raw, &rpc)
+			n.Method = rpc.Method
+		}
+		if n.Method != "" || len(n.Changes) > 0 {
+			env.Notification = n
+		}
+	case dm.EventDrift:
+		var d Drift
+		if raw, ok := payloadJSON(e.Payload); ok && json.Unmarshal(raw, &d) == nil && d.Parameter != "" {
+			env.Drift = &d
+		}
+	}
+	return env
+}
+
+// Event returns the event the envelope encodes; payloads are generic JSON values.
+func (env Envelope) Event() dm.Event {
+	return dm.Event{Kind: env.Kind, DeviceID: env.DeviceID, OccurredAt: env.OccurredAt, Source: env.Source, Payload: env.Payload, Seq: env.Seq, Tags: env.Tags}
+}
+
+// DecodeEnvelope parses an envelope, rejecting ones from a newer SchemaVersion. Envelopes without
+// a version predate versioning and decode as version 1.
+func DecodeEnvelope(b []byte) (Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return Envelope{}, err
+	}
+	if env.Version > SchemaVersion {
+		return Envelope{}, fmt.Errorf("events: schema version %d is newer than %d", env.Version, SchemaVersion)
+	}
+	if env.Version == 0 {
+		env.Version = 1
+	}
+	return env, nil
+}
+
+// ParameterChanges extracts the parameter changes from a notification payload. It accepts:
+//   - a WebPA PARAM_NOTIFY ({"paramName","paramValue","paramType","changeSource"}), which may be
+//     nested under "notifyPayload";
+//   - a {"parameters":[{"name","value","dataType"}]} list;
+//   - a single {"name","value"} object.
+//
+// For a JSON-RPC notification the changes are read from its params.
+func ParameterChanges(payload interface{}) []ParameterChange {
+	raw, ok := payloadJSON(payload)
+	if !ok {
+		return nil
+	}
+	var body struct {
+		Method        string          `json:"method"`
+		Params        json.RawMessage `json:"params"`
+		ParamName     string          `json:"paramName"`
+		ParamValue    interface{}     `json:"paramValue"`
+		ParamType     json.RawMessage `json:"paramType"`
+		ChangeSource  string          `json:"changeSource"`
+		NotifyPayload *struct {
+			ParamName    string          `json:"paramName"`
+			ParamValue   interface{}     `json:"paramValue"`
+			ParamType    json.RawMessage `json:"paramType"`
+			ChangeSource string          `json:"changeSource"`
+		} `json:"notifyPayload"`
+		Name       string      `json:"name"`
+		Value      interface{} `json:"value"`
+		DataType   string      `json:"dataType"`
+		Parameters []struct {
+			Name     string      `json:"name"`
+			Value    interface{} `json:"value"`
+			DataType string      `json:"dataType"`
+		} `json:"parameters"`
+	}
+	if json.Unmarshal(raw, &body) != nil {
+		return nil
+	}
+	if body.Method != "" {
+		if len(body.Params) == 0 {
+			return nil
+		}
+		return ParameterChanges(body.Params)
+	}
+	var out []ParameterChange
+	switch {
+	case body.NotifyPayload != nil && body.NotifyPayload.ParamName != "":
+		n := body.NotifyPayload
+		out = append(out, ParameterChange{Name: n.ParamName, Value: n.ParamValue, DataType: wdmpType(n.ParamType), ChangeSource: n.ChangeSource})
+	case body.ParamName != "":
+		out = append(out, ParameterChange{Name: body.ParamName, Value: body.ParamValue, DataType: wdmpType(body.ParamType), ChangeSource: body.ChangeSource})
+	case body.Name != "":
+		out = append(out, ParameterChange{Name: body.Name, Value: body.Value, DataType: body.DataType})
+	}
+	for _, p := range body.Parameters {
+		if p.Name != "" {
+			out = append(out, ParameterChange{Name: p.Name, Value: p.Value, DataType: p.DataType})
+		}
+	}
+	return out
+}
+
+// payloadJSON returns payload as JSON text: strings and byte slices are taken to hold JSON already.
+func payloadJSON(payload interface{}) ([]byte, bool) {
+	switch p := payload.(type) {
+	case nil:
+		return nil, false
+	case string:
+		return []byte(p), true
+	case []byte:
+		return p, true
+	case json.RawMessage:
+		return p, true
+	}
+	raw, err := json.Marshal(payload)
+	return raw, err == nil
+}
+
+// wdmpTypes names the WDMP numeric data types.
+var wdmpTypes = []string{"string", "int", "unsignedInt", "boolean", "dateTime", "base64", "long", "unsignedLong", "float", "double", "byte"}
+
+// wdmpType renders a WDMP data type given as a number or a name.
+func wdmpType(raw json.RawMessage) string {
+	var n int
+	if json.Unmarshal(raw, &n) == nil {
+		if n >= 0 && n < len(wdmpTypes) {
+			return wdmpTypes[n]
+		}
+		return ""
+	}
+	var s string
+	_ = json.Unmarshal(raw, &s)
+	return s
+}
@@ -0,0 +1,117 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestEnvelopeVariants(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("EST", -5*3600))
+	transition := struct {
+		From   string `json:"from"`
+		To     string `json:"to"`
+		Reason string `json:"reason"`
+	}{"online", "suspect", "missed poll"}
+
+	got, err := JSONEncoder{}.Encode(dm.Event{Kind: dm.EventSuspect, DeviceID: "mac:aa", OccurredAt: at, Source: "talaria-poll", Payload: transition, Seq: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"version":1,"kind":"suspect","deviceId":"mac:aa","occurredAt":"2024-05-01T17:00:00Z","source":"talaria-poll","seq":7,` +
+		`"payload":{"from":"online","to":"suspect","reason":"missed poll"},"connectivity":{"from":"online","to":"suspect","reason":"missed poll"}}`
+	if string(got) != want {
+		t.Fatalf("encoding changed:\n got %s\nwant %s", got, want)
+	}
+
+	offline := NewEnvelope(dm.Event{Kind: dm.EventOffline, Payload: "read error"})
+	if c := offline.Connectivity; c == nil || c.To != "offline" || c.Reason != "read error" {
+		t.Fatalf("offline: %+v", c)
+	}
+
+	rpc := struct {
+		JSONRPC string          `json:"jsonrpc"`
+		Method  string          `json:"method"`
+		Params  json.RawMessage `json:"params"`
+	}{"2.0", "paramChanged", json.RawMessage(`{"paramName":"Device.X","paramValue":"1","paramType":1}`)}
+	n := NewEnvelope(dm.Event{Kind: dm.EventNotification, Payload: rpc}).Notification
+	if n == nil || n.Method != "paramChanged" || len(n.Changes) != 1 || n.Changes[0] != (ParameterChange{Name: "Device.X", Value: "1", DataType: "int"}) {
+		t.Fatalf("rpc notification: %+v", n)
+	}
+	n = NewEnvelope(dm.Event{Kind: dm.EventNotification, Payload: `{"notifyPayload":{"paramName":"Device.Y","paramValue":true,"changeSource":"ACS"}}`}).Notification
+	if n == nil || len(n.Changes) != 1 || n.Changes[0].Name != "Device.Y" || n.Changes[0].ChangeSource != "ACS" {
+		t.Fatalf("webpa notification: %+v", n)
+	}
+	if env := NewEnvelope(dm.Event{Kind: dm.EventNotification, Payload: "bare text"}); env.Notification != nil || env.Payload != "bare text" {
+		t.Fatalf("opaque notification: %+v", env)
+	}
+
+	d := NewEnvelope(dm.Event{Kind: dm.EventDrift, Payload: Drift{Parameter: "Device.WiFi.SSID.1.SSID", Expected: "home", Actual: "guest", Profile: "residential"}}).Drift
+	if d == nil || d.Parameter != "Device.WiFi.SSID.1.SSID" || d.Actual != "guest" {
+		t.Fatalf("drift: %+v", d)
+	}
+}
+
+func TestDecodeEnvelopeVersions(t *testing.T) {
+	env, err := DecodeEnvelope([]byte(`{"kind":"online","deviceId":"mac:aa","occurredAt":"2024-05-01T12:00:00Z"}`))
+	if err != nil || env.Version != 1 || env.Kind != dm.EventOnline {
+		t.Fatalf("unversioned: %+v %v", env, err)
+	}
+	if _, err := DecodeEnvelope([]byte(`{"version":2,"kind":"online"}`)); err == nil {
+		t.Fatal("accepted a newer schema version")
+	}
+}
+
+// TestSchemaMatchesEnvelope keeps the published schema and the Go types in step: every JSON field
+// is documented and every documented property exists.
+func TestSchemaMatchesEnvelope(t *testing.T) {
+	var doc struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+		Required   []string                   `json:"required"`
+		Defs       map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+			Required   []string                   `json:"required"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(Schema(), &doc); err != nil {
+		t.Fatalf("schema is not JSON: %v", err)
+	}
+	check := func(name string, typ reflect.Type, props map[string]json.RawMessage, required []string) {
+		fields := map[string]bool{}
+		for i := 0; i < typ.NumField(); i++ {
+			tag := strings.Split(typ.Field(i).Tag.Get("json"), ",")
+			fields[tag[0]] = len(tag) == 1 // without omitempty
+		}
+		for f, always := range fields {
+			if _, ok := props[f]; !ok {
+				t.Errorf("%s: field %q missing from the schema", name, f)
+			}
+			if always && !slices.Contains(required, f) {
+				t.Errorf("%s: field %q is always present but not required", name, f)
+			}
+		}
+		for p := range props {
+			if _, ok := fields[p]; !ok {
+				t.Errorf("%s: schema property %q has no field", name, p)
+			}
+		}
+	}
+	check("envelope", reflect.TypeOf(Envelope{}), doc.Properties, doc.Required)
+	for name, typ := range map[string]reflect.Type{
+		"connectivity":    reflect.TypeOf(Connectivity{}),
+		"notification":    reflect.TypeOf(Notification{}),
+		"parameterChange": reflect.TypeOf(ParameterChange{}),
+		"drift":           reflect.TypeOf(Drift{}),
+	} {
+		def, ok := doc.Defs[name]
+		if !ok {
+			t.Fatalf("schema has no %s definition", name)
+		}
+		check(name, typ, def.Properties, def.Required)
+	}
+}
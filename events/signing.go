@@ -0,0 +1,128 @@
+package events
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimestampSignatureHeader carries the HMAC-SHA256 signature of webhook deliveries made with a
+// registration's SigningKey, as SignTimestamped formats it.
+const TimestampSignatureHeader = "X-Devicemgr-Signature"
+
+// DefaultReplayWindow is how far a signature's timestamp may be from the verifier's clock when
+// Verify is given no window.
+const DefaultReplayWindow = 5 * time.Minute
+
+var (
+	ErrSignatureInvalid = errors.New("events: invalid signature")
+	ErrSignatureExpired = errors.New("events: signature outside the replay window")
+	ErrSignatureReplay  = errors.New("events: signature already seen")
+)
+
+// SignTimestamped signs body at t under key: "t=<unix seconds>,v1=<hex HMAC-SHA256 of
+// "<unix seconds>.<body>">". Binding the timestamp into the MAC lets receivers reject old
+// deliveries replayed by a third party.
+func SignTimestamped(key string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(timestampedMAC(key, ts, body))
+}
+
+func timestampedMAC(key, ts string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// Verify checks a SignTimestamped signature of body under key, and that its timestamp is within
+// window (DefaultReplayWindow when not positive) of now. Any v1 value may match, so a sender
+// rotating keys can list one per key.
+func Verify(key, signature string, body []byte, window time.Duration, now time.Time) error {
+	_, err := verify(key, signature, body, window, now)
+	return err
+}
+
+func verify(key, signature string, body []byte, window time.Duration, now time.Time) (time.Time, error) {
+	if window <= 0 {
+		window = DefaultReplayWindow
+	}
+	var ts string
+	var sigs [][]byte
+	for _, part := range strings.Split(signature, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			if b, err := hex.DecodeString(v); err == nil {
+				sigs = append(sigs, b)
+			}
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return time.Time{}, fmt.Errorf("malformed signature %q: %w", signature, ErrSignatureInvalid)
+	}
+	want := timestampedMAC(key, ts, body)
+	ok := false
+	for _, s := range sigs {
+		ok = ok || hmac.Equal(s, want)
+	}
+	if !ok {
+		return time.Time{}, ErrSignatureInvalid
+	}
+	at := time.Unix(sec, 0)
+	if d := now.Sub(at); d > window || d < -window {
+		return time.Time{}, fmt.Errorf("signed at %s: %w", at.UTC().Format(time.RFC3339), ErrSignatureExpired)
+	}
+	return at, nil
+}
+
+// ReplayGuard verifies signatures like Verify and also rejects a signature it has already
+// accepted within the window, so a delivery captured and resent quickly is refused too.
+type ReplayGuard struct {
+	Key    string
+	Window time.Duration // DefaultReplayWindow when not positive
+	now    func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time // accepted signature -> its timestamp
+}
+
+// NewReplayGuard returns a guard for signatures made with key.
+func NewReplayGuard(key string, window time.Duration) *ReplayGuard {
+	return &ReplayGuard{Key: key, Window: window, now: time.Now, seen: make(map[string]time.Time)}
+}
+
+// Verify checks signature over body, remembering it until it leaves the window.
+func (g *ReplayGuard) Verify(signature string, body []byte) error {
+	now := g.now()
+	at, err := verify(g.Key, signature, body, g.Window, now)
+	if err != nil {
+		return err
+	}
+	window := g.Window
+	if window <= 0 {
+		window = DefaultReplayWindow
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for s, t := range g.seen {
+		if now.Sub(t) > window {
+			delete(g.seen, s)
+		}
+	}
+	if _, dup := g.seen[signature]; dup {
+		return ErrSignatureReplay
+	}
+	g.seen[signature] = at
+	return nil
+}
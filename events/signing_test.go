@@ -0,0 +1,55 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyTimestampedSignature(t *testing.T) {
+	body := []byte(`{"kind":"online"}`)
+	at := time.Unix(1700000000, 0)
+	sig := SignTimestamped("k1", at, body)
+	if err := Verify("k1", sig, body, time.Minute, at.Add(30*time.Second)); err != nil {
+		t.Fatalf("valid signature: %v", err)
+	}
+	for name, c := range map[string]struct {
+		key, sig string
+		body     []byte
+		now      time.Time
+		want     error
+	}{
+		"other key":      {"k2", sig, body, at, ErrSignatureInvalid},
+		"altered body":   {"k1", sig, []byte(`{"kind":"offline"}`), at, ErrSignatureInvalid},
+		"malformed":      {"k1", "v1=00", body, at, ErrSignatureInvalid},
+		"too old":        {"k1", sig, body, at.Add(2 * time.Minute), ErrSignatureExpired},
+		"in the future":  {"k1", sig, body, at.Add(-2 * time.Minute), ErrSignatureExpired},
+		"rotated (ok)":   {"k1", "t=1700000000,v1=00," + sig[len("t=1700000000,"):], body, at, nil},
+		"retimed replay": {"k1", "t=1700000100" + sig[len("t=1700000000"):], body, at.Add(100 * time.Second), ErrSignatureInvalid},
+	} {
+		if err := Verify(c.key, c.sig, c.body, time.Minute, c.now); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", name, err, c.want)
+		}
+	}
+}
+
+func TestReplayGuard(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	g := NewReplayGuard("k1", time.Minute)
+	g.now = func() time.Time { return now }
+	body := []byte("e1")
+	sig := SignTimestamped("k1", now, body)
+	if err := g.Verify(sig, body); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Verify(sig, body); !errors.Is(err, ErrSignatureReplay) {
+		t.Fatalf("repeat: %v", err)
+	}
+	if err := g.Verify(SignTimestamped("k1", now, []byte("e2")), []byte("e2")); err != nil {
+		t.Fatalf("another event: %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if err := g.Verify(sig, body); !errors.Is(err, ErrSignatureExpired) {
+		t.Fatalf("after the window: %v", err)
+	}
+}
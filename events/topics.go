@@ -0,0 +1,230 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// TopicBinding routes the matching events to a further topic of a Publisher's sink, beside
+// PublisherConfig.Topic, so a consumer can be given its own Kafka topic or NATS subject at runtime.
+type TopicBinding struct {
+	ID          string         `json:"id"`
+	Topic       string         `json:"topic"`                 // may contain {kind} and {device} placeholders
+	Events      []dm.EventKind `json:"events,omitempty"`      // empty matches every kind
+	DeviceMatch []string       `json:"deviceMatch,omitempty"` // regular expressions over device IDs; empty matches all
+	Partners    []string       `json:"partners,omitempty"`    // registering caller's partner scope; empty is unscoped
+	Until       time.Time      `json:"until,omitempty"`       // binding expiry; zero never expires
+	CreatedAt   time.Time      `json:"createdAt"`
+}
+
+// TopicBindings is the registry of a Publisher's TopicBindings, persisted to a SubscriptionStore.
+// Partner-scoped bindings only receive events of devices sharing a partner, and are only visible
+// to callers in that scope.
+type TopicBindings struct {
+	store          dm.SubscriptionStore
+	devicePartners func(dm.DeviceID) []string
+	logger         *log.Logger
+	now            func() time.Time
+
+	mu       sync.RWMutex
+	bindings map[string]*binding
+}
+
+type binding struct {
+	TopicBinding
+	matches []*regexp.Regexp
+}
+
+// NewTopicBindings creates an empty registry kept in store; both arguments are optional. Without
+// devicePartners, partner-scoped bindings receive no events.
+func NewTopicBindings(store dm.SubscriptionStore, devicePartners func(dm.DeviceID) []string) *TopicBindings {
+	return &TopicBindings{store: store, devicePartners: devicePartners, logger: log.Default(), now: time.Now, bindings: make(map[string]*binding)}
+}
+
+// Add validates and stores a binding. The ID is assigned here.
+func (t *TopicBindings) Add(ctx context.Context, tb TopicBinding) (TopicBinding, error) {
+	tb.ID = uuid.NewString()
+	tb.CreatedAt = t.now()
+	b, err := newBinding(tb)
+	if err != nil {
+		return TopicBinding{}, err
+	}
+	if err := t.persist(ctx, tb); err != nil {
+		return TopicBinding{}, fmt.Errorf("topic binding: store: %w", err)
+	}
+	t.mu.Lock()
+	t.bindings[tb.ID] = b
+	t.mu.Unlock()
+	return tb, nil
+}
+
+// Remove deletes a binding. Bindings outside the caller's partner scope are reported as not found.
+func (t *TopicBindings) Remove(ctx context.Context, id string) error {
+	t.mu.Lock()
+	b, ok := t.bindings[id]
+	if ok && visible(ctx, b.Partners) {
+		delete(t.bindings, id)
+	} else {
+		ok = false
+	}
+	t.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("topic binding %s: %w", id, dm.ErrSubscriptionNotFound)
+	}
+	if t.store != nil {
+		if err := t.store.Delete(ctx, dm.SubscriptionTopic, id); err != nil {
+			t.logger.Printf("events: delete topic binding %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// List returns the unexpired bindings visible to the caller's partner scope ordered by creation time.
+func (t *TopicBindings) List(ctx context.Context) []TopicBinding {
+	now := t.now()
+	t.mu.RLock()
+	out := make([]TopicBinding, 0, len(t.bindings))
+	for _, b := range t.bindings {
+		if visible(ctx, b.Partners) && !expired(b.Until, now) {
+			out = append(out, b.TopicBinding)
+		}
+	}
+	t.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Renew moves a binding's expiry to until; zero never expires.
+func (t *TopicBindings) Renew(ctx context.Context, id string, until time.Time) (TopicBinding, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.bindings[id]
+	if !ok || !visible(ctx, b.Partners) {
+		return TopicBinding{}, fmt.Errorf("topic binding %s: %w", id, dm.ErrSubscriptionNotFound)
+	}
+	tb := b.TopicBinding
+	tb.Until = until
+	if err := t.persist(ctx, tb); err != nil {
+		return TopicBinding{}, fmt.Errorf("topic binding: store: %w", err)
+	}
+	b.Until = until
+	return tb, nil
+}
+
+// Restore adds the bindings of the store, as left by an earlier process, deleting those that
+// expired meanwhile.
+func (t *TopicBindings) Restore(ctx context.Context) error {
+	if t.store == nil {
+		return nil
+	}
+	subs, err := t.store.List(ctx, dm.SubscriptionTopic)
+	if err != nil {
+		return fmt.Errorf("topic bindings: restore: %w", err)
+	}
+	for _, s := range subs {
+		if s.Expired(t.now()) {
+			_ = t.store.Delete(ctx, s.Kind, s.ID)
+			continue
+		}
+		var tb TopicBinding
+		if err := json.Unmarshal(s.Spec, &tb); err != nil {
+			t.logger.Printf("events: restore topic binding %s: %v", s.ID, err)
+			continue
+		}
+		tb.ID, tb.Until = s.ID, s.Until
+		b, err := newBinding(tb)
+		if err != nil {
+			t.logger.Printf("events: restore topic binding %s: %v", s.ID, err)
+			continue
+		}
+		t.mu.Lock()
+		if _, ok := t.bindings[tb.ID]; !ok {
+			t.bindings[tb.ID] = b
+		}
+		t.mu.Unlock()
+	}
+	return nil
+}
+
+// topics returns the topics e is bound to, placeholders replaced; expired bindings are removed.
+func (t *TopicBindings) topics(e dm.Event) []string {
+	now := t.now()
+	var out, gone []string
+	t.mu.RLock()
+	for id, b := range t.bindings {
+		if expired(b.Until, now) {
+			gone = append(gone, id)
+			continue
+		}
+		if t.matches(b, e) {
+			out = append(out, expandTopic(b.Topic, e))
+		}
+	}
+	t.mu.RUnlock()
+	for _, id := range gone {
+		_ = t.Remove(context.Background(), id)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (t *TopicBindings) matches(b *binding, e dm.Event) bool {
+	if !matchAny(b.Events, e.Kind) {
+		return false
+	}
+	if len(b.matches) > 0 {
+		found := false
+		for _, re := range b.matches {
+			found = found || re.MatchString(string(e.DeviceID))
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(b.Partners) > 0 {
+		return t.devicePartners != nil && dm.PartnerAllowed(b.Partners, t.devicePartners(e.DeviceID))
+	}
+	return true
+}
+
+func (t *TopicBindings) persist(ctx context.Context, tb TopicBinding) error {
+	if t.store == nil {
+		return nil
+	}
+	spec, err := json.Marshal(tb)
+	if err != nil {
+		return err
+	}
+	return t.store.Put(ctx, dm.Subscription{Kind: dm.SubscriptionTopic, ID: tb.ID, Until: tb.Until, Spec: spec})
+}
+
+func newBinding(tb TopicBinding) (*binding, error) {
+	if strings.TrimSpace(tb.Topic) == "" {
+		return nil, fmt.Errorf("topic binding: topic required: %w", dm.ErrInvalidParameter)
+	}
+	b := &binding{TopicBinding: tb}
+	for _, expr := range tb.DeviceMatch {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("topic binding: device matcher %q: %v: %w", expr, err, dm.ErrInvalidParameter)
+		}
+		b.matches = append(b.matches, re)
+	}
+	return b, nil
+}
+
+func expandTopic(topic string, e dm.Event) string {
+	return strings.NewReplacer("{kind}", string(e.Kind), "{device}", string(e.DeviceID)).Replace(topic)
+}
+
+func expired(until, now time.Time) bool { return !until.IsZero() && now.After(until) }
@@ -0,0 +1,461 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// SignatureHeader carries the XMiDT-compatible payload signature: "sha1=<hex hmac>".
+const SignatureHeader = "X-Webpa-Signature"
+
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+	errWebhookURL      = errors.New("webhook: absolute http(s) url required")
+)
+
+// Webhook is a registration for outbound event delivery, modeled on the XMiDT webhook
+// registration (url + secret + event and device matchers + expiry).
+type Webhook struct {
+	ID          string         `json:"id"`
+	URL         string         `json:"url"`
+	ContentType string         `json:"contentType,omitempty"` // application/json (default) or application/msgpack (WRP)
+	Secret      string         `json:"secret,omitempty"`
+	SigningKey  string         `json:"signingKey,omitempty"`  // HMAC-SHA256 key for TimestampSignatureHeader
+	Events      []dm.EventKind `json:"events,omitempty"`      // empty matches every kind
+	DeviceMatch []string       `json:"deviceMatch,omitempty"` // regular expressions over device IDs; empty matches all
+	Partners    []string       `json:"partners,omitempty"`    // registering caller's partner scope; empty is unscoped
+	Until       time.Time      `json:"until,omitempty"`       // registration expiry; zero never expires
+	CreatedAt   time.Time      `json:"createdAt"`
+}
+
+// DeadLetter records an event that could not be delivered to a webhook.
+type DeadLetter struct {
+	WebhookID string    `json:"webhookId"`
+	Event     Envelope  `json:"event"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError"`
+	FailedAt  time.Time `json:"failedAt"`
+}
+
+// WebhookConfig configures a WebhookDispatcher.
+type WebhookConfig struct {
+	Client         *http.Client  // optional; 10s timeout client by default
+	MaxRetries     int           // optional; retries after the first attempt (0 = 3, negative = none)
+	RetryBackoff   time.Duration // optional; initial backoff doubled per retry, default 500ms
+	QueueSize      int           // optional; per-webhook pending events before dead-lettering, default 1000
+	MaxDeadLetters int           // optional; retained dead letters per webhook, default 100
+	// DevicePartners resolves a device's partners for partner-scoped registrations; when nil,
+	// scoped registrations receive no events.
+	DevicePartners func(dm.DeviceID) []string
+	// Store keeps registrations, secrets included, for Restore; optional, registrations are only
+	// kept in memory when nil.
+	Store  dm.SubscriptionStore
+	Logger *log.Logger // optional; defaults to log.Default()
+}
+
+// WebhookDispatcher delivers matching events to registered webhooks. Each registration has its
+// own worker and bounded queue so one slow receiver cannot stall the others.
+type WebhookDispatcher struct {
+	cfg WebhookConfig
+	now func() time.Time
+
+	mu    sync.RWMutex
+	hooks map[string]*hookWorker
+}
+
+type hookWorker struct {
+	hook    Webhook
+	until   time.Time // hook.Until as renewed; guarded by the dispatcher's mu
+	matches []*regexp.Regexp
+	queue   chan dm.Event
+	done    chan struct{}
+
+	mu          sync.Mutex
+	deadLetters []DeadLetter
+}
+
+// NewWebhookDispatcher applies defaults to cfg.
+func NewWebhookDispatcher(cfg WebhookConfig) *WebhookDispatcher {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 500 * time.Millisecond
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	if cfg.MaxDeadLetters <= 0 {
+		cfg.MaxDeadLetters = 100
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.Default()
+	}
+	return &WebhookDispatcher{cfg: cfg, now: time.Now, hooks: make(map[string]*hookWorker)}
+}
+
+// Register validates and stores a webhook, starting its delivery worker. The ID is assigned here.
+func (d *WebhookDispatcher) Register(h Webhook) (Webhook, error) {
+	h.ID = uuid.NewString()
+	h.CreatedAt = d.now()
+	w, err := d.worker(h)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if err := d.persist(context.Background(), h); err != nil {
+		return Webhook{}, fmt.Errorf("webhook: store registration: %w", err)
+	}
+	d.start(w)
+	return h, nil
+}
+
+// Restore registers the webhooks of cfg.Store, as left by an earlier process, deleting those that
+// expired meanwhile. Registrations already active are left alone.
+func (d *WebhookDispatcher) Restore(ctx context.Context) error {
+	if d.cfg.Store == nil {
+		return nil
+	}
+	subs, err := d.cfg.Store.List(ctx, dm.SubscriptionWebhook)
+	if err != nil {
+		return fmt.Errorf("webhook: restore: %w", err)
+	}
+	for _, s := range subs {
+		if s.Expired(d.now()) {
+			_ = d.cfg.Store.Delete(ctx, s.Kind, s.ID)
+			continue
+		}
+		var h Webhook
+		if err := json.Unmarshal(s.Spec, &h); err != nil {
+			d.cfg.Logger.Printf("events: restore webhook %s: %v", s.ID, err)
+			continue
+		}
+		h.ID, h.Until = s.ID, s.Until
+		w, err := d.worker(h)
+		if err != nil {
+			d.cfg.Logger.Printf("events: restore webhook %s: %v", s.ID, err)
+			continue
+		}
+		d.mu.RLock()
+		_, active := d.hooks[h.ID]
+		d.mu.RUnlock()
+		if !active {
+			d.start(w)
+		}
+	}
+	return nil
+}
+
+// Renew moves a webhook's expiry to until; zero never expires. Webhooks outside the caller's
+// partner scope are reported as not found.
+func (d *WebhookDispatcher) Renew(ctx context.Context, id string, until time.Time) (Webhook, error) {
+	d.mu.Lock()
+	w, ok := d.hooks[id]
+	if !ok || !visible(ctx, w.hook.Partners) {
+		d.mu.Unlock()
+		return Webhook{}, ErrWebhookNotFound
+	}
+	prev := w.until
+	w.until = until
+	h := w.hook
+	d.mu.Unlock()
+	h.Until = until
+	if err := d.persist(ctx, h); err != nil {
+		d.mu.Lock()
+		w.until = prev
+		d.mu.Unlock()
+		return Webhook{}, fmt.Errorf("webhook: store registration: %w", err)
+	}
+	h.Secret, h.SigningKey = "", ""
+	return h, nil
+}
+
+// worker validates h, returning its unstarted worker.
+func (d *WebhookDispatcher) worker(h Webhook) (*hookWorker, error) {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errWebhookURL
+	}
+	if h.ContentType == "" {
+		h.ContentType = "application/json"
+	}
+	if h.ContentType != "application/json" && h.ContentType != (WRPEncoder{}).ContentType() {
+		return nil, fmt.Errorf("webhook: unsupported content type %q", h.ContentType)
+	}
+	w := &hookWorker{hook: h, until: h.Until, queue: make(chan dm.Event, d.cfg.QueueSize), done: make(chan struct{})}
+	for _, expr := range h.DeviceMatch {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("webhook: device matcher %q: %w", expr, err)
+		}
+		w.matches = append(w.matches, re)
+	}
+	return w, nil
+}
+
+func (d *WebhookDispatcher) start(w *hookWorker) {
+	d.mu.Lock()
+	d.hooks[w.hook.ID] = w
+	d.mu.Unlock()
+	go d.work(w)
+}
+
+// persist writes h to cfg.Store, when there is one.
+func (d *WebhookDispatcher) persist(ctx context.Context, h Webhook) error {
+	if d.cfg.Store == nil {
+		return nil
+	}
+	spec, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return d.cfg.Store.Put(ctx, dm.Subscription{Kind: dm.SubscriptionWebhook, ID: h.ID, Until: h.Until, Spec: spec})
+}
+
+// Unregister stops delivery to a webhook and discards its dead letters. Webhooks outside the
+// caller's partner scope are reported as not found.
+func (d *WebhookDispatcher) Unregister(ctx context.Context, id string) error {
+	d.mu.Lock()
+	w, ok := d.hooks[id]
+	if ok && !visible(ctx, w.hook.Partners) {
+		ok = false
+	}
+	if ok {
+		delete(d.hooks, id)
+	}
+	d.mu.Unlock()
+	if !ok {
+		return ErrWebhookNotFound
+	}
+	close(w.done)
+	if d.cfg.Store != nil {
+		if err := d.cfg.Store.Delete(ctx, dm.SubscriptionWebhook, id); err != nil {
+			d.cfg.Logger.Printf("events: delete webhook %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// List returns the active registrations visible to the caller's partner scope ordered by
+// creation time, with secrets and signing keys redacted.
+func (d *WebhookDispatcher) List(ctx context.Context) []Webhook {
+	d.mu.RLock()
+	out := make([]Webhook, 0, len(d.hooks))
+	for _, w := range d.hooks {
+		if !visible(ctx, w.hook.Partners) {
+			continue
+		}
+		h := w.hook
+		h.Secret, h.SigningKey, h.Until = "", "", w.until
+		out = append(out, h)
+	}
+	d.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// DeadLetters returns the retained undeliverable events for a webhook, oldest first.
+func (d *WebhookDispatcher) DeadLetters(ctx context.Context, id string) ([]DeadLetter, error) {
+	d.mu.RLock()
+	w, ok := d.hooks[id]
+	d.mu.RUnlock()
+	if !ok || !visible(ctx, w.hook.Partners) {
+		return nil, ErrWebhookNotFound
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]DeadLetter(nil), w.deadLetters...), nil
+}
+
+// Dispatch enqueues e for every matching registration; expired registrations are removed.
+func (d *WebhookDispatcher) Dispatch(e dm.Event) {
+	now := d.now()
+	var gone []string
+	d.mu.RLock()
+	for id, w := range d.hooks {
+		if expired(w.until, now) {
+			gone = append(gone, id)
+			continue
+		}
+		if !d.matches(w, e) {
+			continue
+		}
+		select {
+		case w.queue <- e:
+		default:
+			d.deadLetter(w, e, 0, errors.New("delivery queue full"))
+		}
+	}
+	d.mu.RUnlock()
+	for _, id := range gone {
+		_ = d.Unregister(context.Background(), id)
+	}
+}
+
+// visible reports whether a registration is in the caller's partner scope. Unscoped registrations
+// are only visible to unscoped callers.
+func visible(ctx context.Context, partners []string) bool {
+	scope, ok := dm.PartnersFromContext(ctx)
+	if !ok {
+		return true
+	}
+	return len(partners) > 0 && dm.PartnerAllowed(scope, partners)
+}
+
+// Run dispatches events from subs until ctx is canceled or every subscription closes.
+func (d *WebhookDispatcher) Run(ctx context.Context, subs ...dm.EventSubscription) error {
+	var wg sync.WaitGroup
+	for _, s := range subs {
+		wg.Add(1)
+		go func(c <-chan dm.Event) {
+			defer wg.Done()
+			for {
+				select {
+				case e, ok := <-c:
+					if !ok {
+						return
+					}
+					d.Dispatch(e)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(s.C())
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (d *WebhookDispatcher) matches(w *hookWorker, e dm.Event) bool {
+	if !matchAny(w.hook.Events, e.Kind) {
+		return false
+	}
+	if len(w.matches) > 0 {
+		found := false
+		for _, re := range w.matches {
+			if re.MatchString(string(e.DeviceID)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(w.hook.Partners) > 0 {
+		if d.cfg.DevicePartners == nil {
+			return false
+		}
+		return dm.PartnerAllowed(w.hook.Partners, d.cfg.DevicePartners(e.DeviceID))
+	}
+	return true
+}
+
+func (d *WebhookDispatcher) work(w *hookWorker) {
+	var enc Encoder = JSONEncoder{}
+	if w.hook.ContentType != "application/json" {
+		enc = WRPEncoder{}
+	}
+	for {
+		select {
+		case <-w.done:
+			return
+		case e := <-w.queue:
+			body, err := enc.Encode(e)
+			if err != nil {
+				d.deadLetter(w, e, 0, err)
+				continue
+			}
+			d.deliver(w, e, body)
+		}
+	}
+}
+
+func (d *WebhookDispatcher) deliver(w *hookWorker, e dm.Event, body []byte) {
+	backoff := d.cfg.RetryBackoff
+	var err error
+	attempts := 0
+	for attempts <= d.cfg.MaxRetries {
+		if attempts > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-w.done:
+				d.deadLetter(w, e, attempts, err)
+				return
+			}
+			backoff *= 2
+		}
+		attempts++
+		if err = d.post(w.hook, e, body); err == nil {
+			return
+		}
+	}
+	d.deadLetter(w, e, attempts, err)
+}
+
+func (d *WebhookDispatcher) post(h Webhook, e dm.Event, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", h.ContentType)
+	req.Header.Set("X-Webpa-Device-Id", string(e.DeviceID))
+	req.Header.Set("X-Devicemgr-Event", string(e.Kind))
+	if h.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(h.Secret, body))
+	}
+	if h.SigningKey != "" {
+		req.Header.Set(TimestampSignatureHeader, SignTimestamped(h.SigningKey, d.now(), body))
+	}
+	resp, err := d.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (d *WebhookDispatcher) deadLetter(w *hookWorker, e dm.Event, attempts int, err error) {
+	msg := "unknown error"
+	if err != nil {
+		msg = err.Error()
+	}
+	dl := DeadLetter{WebhookID: w.hook.ID, Event: NewEnvelope(e), Attempts: attempts, LastError: msg, FailedAt: d.now()}
+	w.mu.Lock()
+	w.deadLetters = append(w.deadLetters, dl)
+	if over := len(w.deadLetters) - d.cfg.MaxDeadLetters; over > 0 {
+		w.deadLetters = append([]DeadLetter(nil), w.deadLetters[over:]...)
+	}
+	w.mu.Unlock()
+	d.cfg.Logger.Printf("events: webhook %s dead-lettered %s event for %s: %s", w.hook.ID, e.Kind, e.DeviceID, msg)
+}
+
+// Sign computes the XMiDT webhook signature ("sha1=<hex>") of body under secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(body)
+	return "sha1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,154 @@
+package events
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestWebhookDeliveryFiltersAndSigns(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	recv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign("s3cret", body) {
+			t.Errorf("bad signature %q", r.Header.Get(SignatureHeader))
+		}
+		if err := Verify("k1", r.Header.Get(TimestampSignatureHeader), body, time.Minute, time.Now()); err != nil {
+			t.Errorf("timestamped signature %q: %v", r.Header.Get(TimestampSignatureHeader), err)
+		}
+		mu.Lock()
+		got = append(got, r.Header.Get("X-Webpa-Device-Id")+"/"+r.Header.Get("X-Devicemgr-Event"))
+		mu.Unlock()
+	}))
+	defer recv.Close()
+
+	d := NewWebhookDispatcher(WebhookConfig{Logger: log.New(io.Discard, "", 0)})
+	if _, err := d.Register(Webhook{URL: recv.URL, Secret: "s3cret", SigningKey: "k1", Events: []dm.EventKind{dm.EventOffline}, DeviceMatch: []string{"^mac:aa"}}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	d.Dispatch(dm.Event{Kind: dm.EventOnline, DeviceID: "mac:aa01"})
+	d.Dispatch(dm.Event{Kind: dm.EventOffline, DeviceID: "mac:bb01"})
+	d.Dispatch(dm.Event{Kind: dm.EventOffline, DeviceID: "mac:aa02"})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := len(got)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 1 || got[0] != "mac:aa02/offline" {
+		t.Fatalf("unexpected deliveries: %v", got)
+	}
+	if hooks := d.List(context.Background()); len(hooks) != 1 || hooks[0].Secret != "" || hooks[0].SigningKey != "" {
+		t.Fatalf("expected one redacted registration, got %+v", hooks)
+	}
+}
+
+func TestWebhookDeadLetterAfterRetries(t *testing.T) {
+	var calls int
+	var mu sync.Mutex
+	recv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer recv.Close()
+	d := NewWebhookDispatcher(WebhookConfig{MaxRetries: 2, RetryBackoff: time.Millisecond, Logger: log.New(io.Discard, "", 0)})
+	h, _ := d.Register(Webhook{URL: recv.URL})
+	d.Dispatch(dm.Event{Kind: dm.EventOnline, DeviceID: "mac:aa"})
+
+	var dls []DeadLetter
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && len(dls) == 0 {
+		time.Sleep(5 * time.Millisecond)
+		dls, _ = d.DeadLetters(context.Background(), h.ID)
+	}
+	if len(dls) != 1 || dls[0].Attempts != 3 || dls[0].Event.DeviceID != "mac:aa" {
+		t.Fatalf("unexpected dead letters: %+v", dls)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 3 {
+		t.Fatalf("expected 3 delivery attempts, got %d", calls)
+	}
+	if err := d.Unregister(context.Background(), h.ID); err != nil {
+		t.Fatalf("unregister: %v", err)
+	}
+	if _, err := d.DeadLetters(context.Background(), h.ID); err != ErrWebhookNotFound {
+		t.Fatalf("expected ErrWebhookNotFound, got %v", err)
+	}
+}
+
+func TestWebhookRegisterValidation(t *testing.T) {
+	d := NewWebhookDispatcher(WebhookConfig{})
+	for _, h := range []Webhook{{URL: "ftp://x"}, {URL: "/relative"}, {URL: "http://x", DeviceMatch: []string{"("}}, {URL: "http://x", ContentType: "text/plain"}} {
+		if _, err := d.Register(h); err == nil {
+			t.Fatalf("expected error for %+v", h)
+		}
+	}
+}
+
+func TestWebhookRestoreAndRenew(t *testing.T) {
+	store := dm.NewMemorySubscriptionStore()
+	ctx := context.Background()
+	d := NewWebhookDispatcher(WebhookConfig{Store: store, Logger: log.New(io.Discard, "", 0)})
+	h, err := d.Register(Webhook{URL: "http://receiver.example/hook", Secret: "s3cret", Partners: []string{"comcast"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Put(ctx, dm.Subscription{Kind: dm.SubscriptionWebhook, ID: "old", Until: time.Now().Add(-time.Minute), Spec: []byte(`{"url":"http://receiver.example/old"}`)})
+
+	restored := NewWebhookDispatcher(WebhookConfig{Store: store, Logger: log.New(io.Discard, "", 0)})
+	if err := restored.Restore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	hooks := restored.List(ctx)
+	if len(hooks) != 1 || hooks[0].ID != h.ID || hooks[0].URL != h.URL || !hooks[0].CreatedAt.Equal(h.CreatedAt) {
+		t.Fatalf("restored %+v", hooks)
+	}
+	restored.mu.RLock()
+	secret := restored.hooks[h.ID].hook.Secret
+	restored.mu.RUnlock()
+	if secret != "s3cret" {
+		t.Fatalf("expected the secret restored, got %q", secret)
+	}
+	if subs, _ := store.List(ctx, dm.SubscriptionWebhook); len(subs) != 1 {
+		t.Fatalf("expected the expired registration deleted, got %+v", subs)
+	}
+
+	if _, err := restored.Renew(dm.WithPartners(ctx, []string{"other"}), h.ID, time.Time{}); err != ErrWebhookNotFound {
+		t.Fatalf("expected ErrWebhookNotFound out of scope, got %v", err)
+	}
+	until := time.Now().Add(time.Hour)
+	renewed, err := restored.Renew(dm.WithPartners(ctx, []string{"comcast"}), h.ID, until)
+	if err != nil || !renewed.Until.Equal(until) || renewed.Secret != "" {
+		t.Fatalf("renew %+v %v", renewed, err)
+	}
+	if subs, _ := store.List(ctx, dm.SubscriptionWebhook); len(subs) != 1 || !subs[0].Until.Equal(until) {
+		t.Fatalf("stored %+v", subs)
+	}
+	restored.now = func() time.Time { return until.Add(time.Second) }
+	restored.Dispatch(dm.Event{Kind: dm.EventOnline, DeviceID: "mac:aa"})
+	if len(restored.List(ctx)) != 0 {
+		t.Fatalf("expected the renewed registration to expire")
+	}
+	if subs, _ := store.List(ctx, dm.SubscriptionWebhook); len(subs) != 0 {
+		t.Fatalf("expected the expired registration deleted, got %+v", subs)
+	}
+}
@@ -0,0 +1,171 @@
+// Package faults injects failures for resilience testing: latency, 5xx responses and malformed
+// bodies on backend HTTP calls, and dropped or malformed frames on device websockets, at the rates
+// of a devicemgr.FaultConfig.
+package faults
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Header marks responses synthesized or altered by an Injector, naming the fault.
+const Header = "X-Devicemgr-Fault"
+
+// Fault kinds, as reported in Header and Counts.
+const (
+	Latency   = "latency"
+	Error     = "error"
+	Malformed = "malformed"
+	Drop      = "drop"
+)
+
+// Injector applies a FaultConfig. A nil Injector injects nothing, so callers need not check
+// whether faults are enabled.
+type Injector struct {
+	cfg    dm.FaultConfig
+	counts [4]atomic.Uint64 // by kinds index
+	// sample reports whether an event at rate is faulted; replaced in tests
+	sample func(rate float64) bool
+}
+
+var kinds = [...]string{Latency, Error, Malformed, Drop}
+
+// New returns an Injector for cfg, or nil when cfg is not enabled.
+func New(cfg dm.FaultConfig) (*Injector, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	for name, rate := range map[string]float64{"latency": cfg.LatencyRate, "error": cfg.ErrorRate, "malformed": cfg.MalformedRate, "drop": cfg.DropRate} {
+		if rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("%s rate %v outside [0, 1]: %w", name, rate, dm.ErrInvalidParameter)
+		}
+	}
+	if cfg.ErrorStatus == 0 {
+		cfg.ErrorStatus = http.StatusServiceUnavailable
+	}
+	if cfg.ErrorStatus < 100 || cfg.ErrorStatus > 599 {
+		return nil, fmt.Errorf("error status %d: %w", cfg.ErrorStatus, dm.ErrInvalidParameter)
+	}
+	return &Injector{cfg: cfg, sample: func(rate float64) bool { return rate > 0 && rand.Float64() < rate }}, nil
+}
+
+// Counts reports the faults injected so far by kind.
+func (i *Injector) Counts() map[string]uint64 {
+	out := make(map[string]uint64, len(kinds))
+	if i == nil {
+		return out
+	}
+	for k, name := range kinds {
+		out[name] = i.counts[k].Load()
+	}
+	return out
+}
+
+func (i *Injector) hit(kind string, rate float64) bool {
+	if !i.sample(rate) {
+		return false
+	}
+	i.counts[slices.Index(kinds[:], kind)].Add(1)
+	return true
+}
+
+// Transport wraps next (http.DefaultTransport when nil) so calls to the configured hosts are
+// delayed, failed or given malformed bodies; a nil Injector returns next unchanged.
+func (i *Injector) Transport(next http.RoundTripper) http.RoundTripper {
+	if i == nil {
+		return next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripper{i: i, next: next}
+}
+
+type roundTripper struct {
+	i    *Injector
+	next http.RoundTripper
+}
+
+func (t roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	i := t.i
+	if len(i.cfg.Hosts) > 0 && !slices.Contains(i.cfg.Hosts, req.URL.Host) {
+		return t.next.RoundTrip(req)
+	}
+	if i.hit(Latency, i.cfg.LatencyRate) {
+		timer := time.NewTimer(i.cfg.Latency)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+	if i.hit(Error, i.cfg.ErrorRate) {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		body := []byte(`{"message":"injected fault"}`)
+		return &http.Response{
+			Status:        strconv.Itoa(i.cfg.ErrorStatus) + " " + http.StatusText(i.cfg.ErrorStatus),
+			StatusCode:    i.cfg.ErrorStatus,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"application/json"}, Header: {Error}},
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || !i.hit(Malformed, i.cfg.MalformedRate) {
+		return resp, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	data = truncate(data)
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Del("Content-Length")
+	resp.Header.Set(Header, Malformed)
+	return resp, nil
+}
+
+// Frame filters an inbound websocket frame: it returns the frame to process, possibly delayed or
+// truncated, and false when the frame is to be dropped. A nil Injector passes frames through.
+func (i *Injector) Frame(data []byte) ([]byte, bool) {
+	if i == nil {
+		return data, true
+	}
+	if i.hit(Drop, i.cfg.DropRate) {
+		return nil, false
+	}
+	if i.hit(Latency, i.cfg.LatencyRate) {
+		time.Sleep(i.cfg.Latency)
+	}
+	if i.hit(Malformed, i.cfg.MalformedRate) {
+		return truncate(data), true
+	}
+	return data, true
+}
+
+// truncate keeps the first half of data, which breaks any JSON, protobuf or msgpack document
+// longer than a byte; an empty payload becomes a lone "{".
+func truncate(data []byte) []byte {
+	if len(data) < 2 {
+		return []byte("{")
+	}
+	return slices.Clone(data[:len(data)/2])
+}
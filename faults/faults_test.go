@@ -0,0 +1,98 @@
+package faults
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestTransport(t *testing.T) {
+	var calls int
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"parameters":[]}`))
+	}))
+	defer backend.Close()
+	host := backend.Listener.Addr().String()
+
+	get := func(i *Injector) (*http.Response, string) {
+		t.Helper()
+		c := &http.Client{Transport: i.Transport(nil)}
+		resp, err := c.Get(backend.URL)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	errs, _ := New(dm.FaultConfig{Enabled: true, ErrorRate: 1, ErrorStatus: http.StatusBadGateway, Hosts: []string{host}})
+	if resp, _ := get(errs); resp.StatusCode != http.StatusBadGateway || resp.Header.Get(Header) != Error || calls != 0 {
+		t.Fatalf("error fault: %d %q after %d calls", resp.StatusCode, resp.Header.Get(Header), calls)
+	}
+	if errs.Counts()[Error] != 1 {
+		t.Fatalf("counts %v", errs.Counts())
+	}
+
+	malformed, _ := New(dm.FaultConfig{Enabled: true, MalformedRate: 1})
+	if resp, body := get(malformed); resp.StatusCode != http.StatusOK || body != `{"parame` || resp.Header.Get(Header) != Malformed {
+		t.Fatalf("malformed fault: %d %q", resp.StatusCode, body)
+	}
+
+	other, _ := New(dm.FaultConfig{Enabled: true, ErrorRate: 1, Hosts: []string{"xconf:8080"}})
+	if resp, body := get(other); resp.StatusCode != http.StatusOK || body != `{"parameters":[]}` {
+		t.Fatalf("unlisted host faulted: %d %q", resp.StatusCode, body)
+	}
+
+	var none *Injector
+	if resp, _ := get(none); resp.StatusCode != http.StatusOK {
+		t.Fatalf("nil injector: %d", resp.StatusCode)
+	}
+}
+
+func TestTransportLatencyHonorsContext(t *testing.T) {
+	i, _ := New(dm.FaultConfig{Enabled: true, LatencyRate: 1, Latency: 1 << 40})
+	req := &http.Request{Method: http.MethodGet, URL: &url.URL{Scheme: "http", Host: "tr1d1um"}, Header: http.Header{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := i.Transport(nil).RoundTrip(req.WithContext(ctx)); !errors.Is(err, ctx.Err()) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+}
+
+func TestFrame(t *testing.T) {
+	drop, _ := New(dm.FaultConfig{Enabled: true, DropRate: 1})
+	if _, ok := drop.Frame([]byte(`{"id":"1"}`)); ok {
+		t.Fatal("frame kept")
+	}
+	malformed, _ := New(dm.FaultConfig{Enabled: true, MalformedRate: 1})
+	if data, ok := malformed.Frame([]byte(`{"id":"1"}`)); !ok || string(data) != `{"id"` {
+		t.Fatalf("malformed frame %q %v", data, ok)
+	}
+	var none *Injector
+	if data, ok := none.Frame([]byte("x")); !ok || string(data) != "x" {
+		t.Fatalf("nil injector altered the frame: %q", data)
+	}
+}
+
+func TestNewValidates(t *testing.T) {
+	if i, err := New(dm.FaultConfig{ErrorRate: 1}); i != nil || err != nil {
+		t.Fatalf("disabled: %v %v", i, err)
+	}
+	for _, cfg := range []dm.FaultConfig{
+		{Enabled: true, DropRate: 1.5},
+		{Enabled: true, ErrorRate: -0.1},
+		{Enabled: true, ErrorStatus: 999},
+	} {
+		if _, err := New(cfg); !errors.Is(err, dm.ErrInvalidParameter) {
+			t.Fatalf("%+v: %v", cfg, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Package firmware triggers firmware updates on devices and tracks each one through
+// pending → downloading → applying → rebooted → verified (or failed), combining periodic reads
+// of the device's download status and version with online/offline events.
+package firmware
+
+import (
+	"errors"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+var ErrUpdateNotFound = errors.New("firmware update not found")
+
+// State is the stage of a firmware update.
+type State string
+
+const (
+	StatePending     State = "pending"     // download parameters written
+	StateDownloading State = "downloading" // device reports the download in progress
+	StateApplying    State = "applying"    // download complete; image being applied
+	StateRebooted    State = "rebooted"    // device went offline and came back
+	StateVerified    State = "verified"    // device reports exactly the target version after the download
+	StateFailed      State = "failed"
+)
+
+var stateOrder = map[State]int{StatePending: 0, StateDownloading: 1, StateApplying: 2, StateRebooted: 3, StateVerified: 4}
+
+// Terminal reports whether no further transitions happen from s.
+func (s State) Terminal() bool { return s == StateVerified || s == StateFailed }
+
+// canAdvance reports whether an update in from may move to to: states only move forward and any
+// non-terminal state may fail.
+func canAdvance(from, to State) bool {
+	if from.Terminal() {
+		return false
+	}
+	if to == StateFailed {
+		return true
+	}
+	return stateOrder[to] > stateOrder[from]
+}
+
+// Request describes the image to install.
+type Request struct {
+	Version  string `json:"version"`            // expected version once installed
+	URL      string `json:"url"`                // download location (server or full URL)
+	Filename string `json:"filename,omitempty"` // image file name; defaults to the last URL path element
+}
+
+// Transition records entry into a state.
+type Transition struct {
+	State  State     `json:"state"`
+	At     time.Time `json:"at"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Update is one firmware update of one device.
+type Update struct {
+	ID          string       `json:"id"`
+	Device      dm.DeviceID  `json:"device"`
+	Request     Request      `json:"request"`
+	State       State        `json:"state"`
+	Detail      string       `json:"detail,omitempty"` // last status or error seen
+	Partners    []string     `json:"partners,omitempty"`
+	Forced      bool         `json:"forced,omitempty"` // started outside the maintenance window by an admin
+	CreatedAt   time.Time    `json:"createdAt"`
+	FinishedAt  *time.Time   `json:"finishedAt,omitempty"`
+	Transitions []Transition `json:"transitions"`
+
+	done chan struct{} // closed once tracking stops
+}
+
+// advance moves u to state if allowed, reporting whether it did.
+func (u *Update) advance(state State, detail string) bool {
+	if !canAdvance(u.State, state) {
+		return false
+	}
+	now := time.Now()
+	u.State, u.Detail = state, detail
+	u.Transitions = append(u.Transitions, Transition{State: state, At: now, Detail: detail})
+	if state.Terminal() {
+		u.FinishedAt = &now
+	}
+	return true
+}
+
+func (u *Update) clone() Update {
+	c := *u
+	c.Transitions = append([]Transition(nil), u.Transitions...)
+	return c
+}
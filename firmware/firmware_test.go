@@ -0,0 +1,193 @@
+package firmware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+type fakeDevices struct {
+	mu     sync.Mutex
+	values map[string]dm.ParameterValue
+	set    []dm.SetParameter
+	events chan dm.Event
+	window error // CheckMaintenance result
+
+	devices map[dm.DeviceID]map[string]dm.ParameterValue // per-device values overriding values
+	// flash, when set, makes a device report its status here after each SET, with the installed
+	// file name, less ".bin", as its version
+	flash   map[dm.DeviceID]string
+	emitted []dm.Event
+}
+
+type fakeSub struct{ ch chan dm.Event }
+
+func (s fakeSub) C() <-chan dm.Event { return s.ch }
+func (s fakeSub) Close() error       { return nil }
+
+func (f *fakeDevices) Device(_ context.Context, id dm.DeviceID) (dm.DeviceState, error) {
+	return dm.DeviceState{ID: id, Online: true}, nil
+}
+
+func (f *fakeDevices) RefreshParameters(_ context.Context, id dm.DeviceID, _ string, _ []string) (map[string]dm.ParameterValue, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values := f.values
+	if v, ok := f.devices[id]; ok {
+		values = v
+	}
+	out := make(map[string]dm.ParameterValue, len(values))
+	for k, v := range values {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (f *fakeDevices) SetParameters(_ context.Context, id dm.DeviceID, _ string, params []dm.SetParameter, _ dm.SetOptions) (*runtime.SetResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.set = params
+	if status, ok := f.flash[id]; ok {
+		if f.devices == nil {
+			f.devices = make(map[dm.DeviceID]map[string]dm.ParameterValue)
+		}
+		f.devices[id] = map[string]dm.ParameterValue{
+			DefaultStatusParameter:  {Value: status},
+			DefaultVersionParameter: {Value: strings.TrimSuffix(fmt.Sprint(params[1].Value), ".bin")},
+		}
+	}
+	return &runtime.SetResult{}, nil
+}
+
+func (f *fakeDevices) Subscribe(int) dm.EventSubscription { return fakeSub{f.events} }
+
+func (f *fakeDevices) CheckMaintenance(context.Context, dm.DeviceID) error { return f.window }
+
+func (f *fakeDevices) Exclusive(context.Context, dm.DeviceID, string, string) (func(), error) {
+	return func() {}, nil
+}
+
+func (f *fakeDevices) Emit(e dm.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.emitted = append(f.emitted, e)
+}
+
+func (f *fakeDevices) report(status, version string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values = map[string]dm.ParameterValue{
+		DefaultStatusParameter:  {Value: status},
+		DefaultVersionParameter: {Value: version},
+	}
+}
+
+func waitState(t *testing.T, svc *Service, id string, want State) Update {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		u, err := svc.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.State == want {
+			return u
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("state %s, want %s (%+v)", u.State, want, u.Transitions)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestUpdateLifecycle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dev := &fakeDevices{events: make(chan dm.Event, 4)}
+	dev.report("Not Started", "FW_1.0")
+	svc := NewService(ctx, dev, Config{PollInterval: 5 * time.Millisecond})
+
+	if _, err := svc.Start(ctx, "mac:aa", Request{Version: "FW_2.0"}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("expected ErrInvalidParameter, got %v", err)
+	}
+	u, err := svc.Start(ctx, "mac:aa", Request{Version: "FW_2.0", URL: "http://cdn/images/FW_2.0.bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.State != StatePending || len(dev.set) != 3 || dev.set[1].Value != "FW_2.0.bin" || dev.set[2].Value != true {
+		t.Fatalf("unexpected start %+v, set %+v", u, dev.set)
+	}
+	if _, err := svc.Start(ctx, "mac:aa", Request{Version: "FW_2.0", URL: "http://cdn/x"}); !errors.Is(err, dm.ErrConflict) {
+		t.Fatalf("expected ErrConflict for a second update, got %v", err)
+	}
+
+	dev.report("In Progress", "FW_2.0") // a matching version before the download completes does not verify
+	waitState(t, svc, u.ID, StateDownloading)
+	time.Sleep(20 * time.Millisecond)
+	if got, _ := svc.Get(ctx, u.ID); got.State != StateDownloading {
+		t.Fatalf("verified while downloading: %+v", got.Transitions)
+	}
+	dev.report("Completed", "FW_1.0")
+	waitState(t, svc, u.ID, StateApplying)
+	dev.report("Completed", "FW_1.0") // rebooting device keeps answering with the old image until it restarts
+	dev.events <- dm.Event{Kind: dm.EventOffline, DeviceID: "mac:aa"}
+	dev.events <- dm.Event{Kind: dm.EventOnline, DeviceID: "mac:aa"}
+	waitState(t, svc, u.ID, StateRebooted)
+	dev.report("Completed", "FW_2.0_PROD") // versions are compared exactly, not as substrings
+	time.Sleep(20 * time.Millisecond)
+	if got, _ := svc.Get(ctx, u.ID); got.State != StateRebooted {
+		t.Fatalf("verified on a different version: %+v", got.Transitions)
+	}
+	dev.report("Completed", " FW_2.0\n")
+	done := waitState(t, svc, u.ID, StateVerified)
+	if done.FinishedAt == nil || len(done.Transitions) != 5 {
+		t.Fatalf("unexpected final update %+v", done)
+	}
+	if list := svc.List(ctx, "mac:aa"); len(list) != 1 || list[0].ID != u.ID {
+		t.Fatalf("List = %+v", list)
+	}
+	if _, err := svc.Get(dm.WithPartners(ctx, []string{"other"}), u.ID); !errors.Is(err, ErrUpdateNotFound) {
+		t.Fatalf("unscoped update visible to a partner: %v", err)
+	}
+}
+
+func TestUpdateFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dev := &fakeDevices{events: make(chan dm.Event)}
+	dev.report("Failed", "FW_1.0")
+	svc := NewService(ctx, dev, Config{PollInterval: 5 * time.Millisecond})
+	u, err := svc.Start(ctx, "mac:aa", Request{Version: "FW_2.0", URL: "http://cdn/FW_2.0.bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := waitState(t, svc, u.ID, StateFailed); f.Detail != "Failed" {
+		t.Fatalf("detail = %q", f.Detail)
+	}
+
+	dev.report("In Progress", "FW_1.0")
+	timeoutSvc := NewService(ctx, dev, Config{PollInterval: 5 * time.Millisecond, Timeout: 30 * time.Millisecond})
+	u, err = timeoutSvc.Start(ctx, "mac:bb", Request{Version: "FW_2.0", URL: "http://cdn/FW_2.0.bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, timeoutSvc, u.ID, StateFailed)
+
+	dev.window = &dm.MaintenanceWindowError{DeviceID: "mac:cc"}
+	if _, err := svc.Start(ctx, "mac:cc", Request{Version: "FW_2.0", URL: "http://cdn/FW_2.0.bin"}); !errors.Is(err, dm.ErrOutsideMaintenanceWindow) {
+		t.Fatalf("expected ErrOutsideMaintenanceWindow, got %v", err)
+	}
+}
+
+func TestCanAdvance(t *testing.T) {
+	if canAdvance(StateApplying, StateDownloading) || canAdvance(StateVerified, StateFailed) || !canAdvance(StatePending, StateRebooted) || !canAdvance(StateDownloading, StateFailed) {
+		t.Fatal("unexpected transition rules")
+	}
+}
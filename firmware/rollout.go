@@ -0,0 +1,376 @@
+package firmware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+var ErrRolloutNotFound = errors.New("firmware rollout not found")
+
+// Rollout defaults.
+const (
+	DefaultRolloutBatchSize  = 10   // devices updated at once
+	DefaultMaxFailurePercent = 10.0 // failed share of the finished devices that stops a rollout
+)
+
+// RolloutState is the stage of a Rollout.
+type RolloutState string
+
+const (
+	RolloutRunning     RolloutState = "running"
+	RolloutPaused      RolloutState = "paused" // failures passed the threshold; Resume continues
+	RolloutRollingBack RolloutState = "rolling-back"
+	RolloutRolledBack  RolloutState = "rolled-back"
+	RolloutCompleted   RolloutState = "completed"
+)
+
+// What a rollout does once its failures pass RolloutSpec.MaxFailurePercent.
+const (
+	OnFailurePause    = "pause"
+	OnFailureRollback = "rollback" // reinstall RolloutSpec.Previous on the devices updated so far
+)
+
+// Outcome is where a device stands in a rollout.
+type Outcome string
+
+const (
+	OutcomePending        Outcome = "pending"
+	OutcomeHealthy        Outcome = "healthy" // verified on the target version and back online
+	OutcomeFailed         Outcome = "failed"
+	OutcomeRolledBack     Outcome = "rolled-back"
+	OutcomeRollbackFailed Outcome = "rollback-failed"
+)
+
+// RolloutSpec describes a firmware rollout across many devices.
+type RolloutSpec struct {
+	Devices []dm.DeviceID `json:"devices"`
+	Request Request       `json:"request"` // target image
+	// Previous is the image reinstalled when the rollout rolls back; required by OnFailureRollback.
+	Previous          *Request `json:"previous,omitempty"`
+	BatchSize         int      `json:"batchSize,omitempty"`         // DefaultRolloutBatchSize
+	MaxFailurePercent float64  `json:"maxFailurePercent,omitempty"` // DefaultMaxFailurePercent
+	OnFailure         string   `json:"onFailure,omitempty"`         // OnFailurePause (default) or OnFailureRollback
+	// HealthTimeout (a Go duration) is how long each device has to come back online running the
+	// target version; Config.Timeout when empty.
+	HealthTimeout string `json:"healthTimeout,omitempty"`
+	// Selector picks Devices by expression instead (see package selector); the API resolves it
+	// when the rollout starts.
+	Selector string `json:"selector,omitempty"`
+}
+
+// RolloutDevice is one device of a rollout.
+type RolloutDevice struct {
+	Device   dm.DeviceID `json:"device"`
+	Outcome  Outcome     `json:"outcome"`
+	Update   string      `json:"update,omitempty"`   // its firmware update, once started
+	Rollback string      `json:"rollback,omitempty"` // the update reinstalling RolloutSpec.Previous
+	Detail   string      `json:"detail,omitempty"`
+}
+
+// RolloutProgress counts a rollout's devices by outcome.
+type RolloutProgress struct {
+	Total          int `json:"total"`
+	Pending        int `json:"pending"`
+	Healthy        int `json:"healthy"`
+	Failed         int `json:"failed"`
+	RolledBack     int `json:"rolledBack,omitempty"`
+	RollbackFailed int `json:"rollbackFailed,omitempty"`
+}
+
+// Rollout updates devices batch by batch, checking each device's health, and stops when too many
+// fail.
+type Rollout struct {
+	ID         string          `json:"id"`
+	Spec       RolloutSpec     `json:"spec"`
+	State      RolloutState    `json:"state"`
+	Detail     string          `json:"detail,omitempty"` // why the rollout paused or rolled back
+	Partners   []string        `json:"partners,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+	Progress   RolloutProgress `json:"progress"`
+	Devices    []RolloutDevice `json:"devices"`
+
+	resume chan struct{}
+}
+
+// RolloutEvent is the payload of dm.EventRollout events, emitted as a rollout starts, pauses,
+// resumes, begins rolling back and finishes.
+type RolloutEvent struct {
+	Rollout  string          `json:"rollout"`
+	State    RolloutState    `json:"state"`
+	Detail   string          `json:"detail,omitempty"`
+	Progress RolloutProgress `json:"progress"`
+}
+
+func (r *Rollout) clone() Rollout {
+	c := *r
+	c.Devices = append([]RolloutDevice(nil), r.Devices...)
+	c.Progress = RolloutProgress{Total: len(r.Devices)}
+	for _, d := range r.Devices {
+		switch d.Outcome {
+		case OutcomePending:
+			c.Progress.Pending++
+		case OutcomeHealthy:
+			c.Progress.Healthy++
+		case OutcomeFailed:
+			c.Progress.Failed++
+		case OutcomeRolledBack:
+			c.Progress.RolledBack++
+		case OutcomeRollbackFailed:
+			c.Progress.RollbackFailed++
+		}
+	}
+	return c
+}
+
+// StartRollout updates spec's devices BatchSize at a time. A device is healthy once its update is
+// verified and the device is online again, within HealthTimeout; each batch finishes before the
+// next starts. When more than MaxFailurePercent of the devices finished so far are unhealthy, the
+// rollout pauses until Resume, or with OnFailureRollback reinstalls Previous on every device it
+// updated and stops. Devices are updated within the caller's partner scope and maintenance windows.
+func (s *Service) StartRollout(ctx context.Context, spec RolloutSpec) (Rollout, error) {
+	if len(spec.Devices) == 0 {
+		return Rollout{}, fmt.Errorf("devices required: %w", dm.ErrInvalidParameter)
+	}
+	if spec.Request.Version == "" || spec.Request.URL == "" {
+		return Rollout{}, fmt.Errorf("request version and url required: %w", dm.ErrInvalidParameter)
+	}
+	if spec.BatchSize < 0 || spec.MaxFailurePercent < 0 || spec.MaxFailurePercent > 100 {
+		return Rollout{}, fmt.Errorf("batchSize must not be negative and maxFailurePercent must be 0 to 100: %w", dm.ErrInvalidParameter)
+	}
+	switch spec.OnFailure {
+	case "", OnFailurePause:
+	case OnFailureRollback:
+		if spec.Previous == nil || spec.Previous.Version == "" || spec.Previous.URL == "" {
+			return Rollout{}, fmt.Errorf("rollback requires the previous version and url: %w", dm.ErrInvalidParameter)
+		}
+	default:
+		return Rollout{}, fmt.Errorf("onFailure %q: want %s or %s: %w", spec.OnFailure, OnFailurePause, OnFailureRollback, dm.ErrInvalidParameter)
+	}
+	health := s.cfg.Timeout
+	if spec.HealthTimeout != "" {
+		d, err := time.ParseDuration(spec.HealthTimeout)
+		if err != nil || d <= 0 {
+			return Rollout{}, fmt.Errorf("healthTimeout %q: %w", spec.HealthTimeout, dm.ErrInvalidParameter)
+		}
+		health = d
+	}
+	r := &Rollout{ID: uuid.NewString(), Spec: spec, State: RolloutRunning, CreatedAt: time.Now(), resume: make(chan struct{}, 1)}
+	for _, id := range spec.Devices {
+		r.Devices = append(r.Devices, RolloutDevice{Device: id, Outcome: OutcomePending})
+	}
+	runCtx := s.ctx
+	if scope, ok := dm.PartnersFromContext(ctx); ok {
+		r.Partners = scope
+		runCtx = dm.WithPartners(runCtx, scope)
+	}
+	if role, ok := dm.RoleFromContext(ctx); ok {
+		runCtx = dm.WithRole(runCtx, role)
+	}
+	s.mu.Lock()
+	s.rollouts[r.ID] = r
+	out := r.clone()
+	s.mu.Unlock()
+	s.emitRollout(out)
+	go s.runRollout(runCtx, r, health)
+	return out, nil
+}
+
+func (s *Service) runRollout(ctx context.Context, r *Rollout, health time.Duration) {
+	spec := r.Spec
+	size := spec.BatchSize
+	if size <= 0 {
+		size = DefaultRolloutBatchSize
+	}
+	limit := spec.MaxFailurePercent
+	if limit == 0 {
+		limit = DefaultMaxFailurePercent
+	}
+	var finished, failed int
+	for start := 0; start < len(r.Devices); start += size {
+		end := min(start+size, len(r.Devices))
+		batch := s.updateBatch(ctx, r, start, end, spec.Request, health, false)
+		if ctx.Err() != nil {
+			return
+		}
+		finished += end - start
+		failed += batch
+		if pct := float64(failed) * 100 / float64(finished); pct > limit {
+			detail := fmt.Sprintf("%d of %d devices failed their health check (%.1f%%, limit %.1f%%)", failed, finished, pct, limit)
+			if spec.OnFailure == OnFailureRollback {
+				s.rollBack(ctx, r, end, health, detail)
+				return
+			}
+			s.setRolloutState(r, RolloutPaused, detail)
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.resume:
+			}
+		}
+	}
+	s.setRolloutState(r, RolloutCompleted, "")
+}
+
+// rollBack reinstalls the previous image on the devices before end whose update was started.
+func (s *Service) rollBack(ctx context.Context, r *Rollout, end int, health time.Duration, detail string) {
+	s.setRolloutState(r, RolloutRollingBack, detail)
+	size := r.Spec.BatchSize
+	if size <= 0 {
+		size = DefaultRolloutBatchSize
+	}
+	for start := 0; start < end; start += size {
+		s.updateBatch(ctx, r, start, min(start+size, end), *r.Spec.Previous, health, true)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+	s.setRolloutState(r, RolloutRolledBack, detail)
+}
+
+// updateBatch installs req on devices start to end of r in parallel and returns how many were
+// unhealthy. Rolling back, it only touches devices whose rollout update was started.
+func (s *Service) updateBatch(ctx context.Context, r *Rollout, start, end int, req Request, health time.Duration, rollback bool) int {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed int
+	)
+	for i := start; i < end; i++ {
+		s.mu.RLock()
+		d := r.Devices[i]
+		s.mu.RUnlock()
+		if rollback && d.Update == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, device dm.DeviceID) {
+			defer wg.Done()
+			update, healthy, detail := s.checkedUpdate(ctx, device, req, health)
+			s.mu.Lock()
+			d := &r.Devices[i]
+			d.Detail = detail
+			switch {
+			case rollback:
+				d.Rollback, d.Outcome = update, OutcomeRolledBack
+				if !healthy {
+					d.Outcome = OutcomeRollbackFailed
+				}
+			default:
+				d.Update, d.Outcome = update, OutcomeHealthy
+				if !healthy {
+					d.Outcome = OutcomeFailed
+				}
+			}
+			s.mu.Unlock()
+			if !healthy {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}(i, d.Device)
+	}
+	wg.Wait()
+	return failed
+}
+
+// checkedUpdate installs req on device and waits up to health for the update to be verified and
+// the device to be online again.
+func (s *Service) checkedUpdate(ctx context.Context, device dm.DeviceID, req Request, health time.Duration) (update string, healthy bool, detail string) {
+	u, err := s.Start(ctx, device, req)
+	if err != nil {
+		return "", false, err.Error()
+	}
+	timer := time.NewTimer(health)
+	defer timer.Stop()
+	select {
+	case <-u.done:
+	case <-timer.C:
+		return u.ID, false, fmt.Sprintf("not verified within %s", health)
+	case <-ctx.Done():
+		return u.ID, false, ctx.Err().Error()
+	}
+	s.mu.RLock()
+	state, detail := s.updates[u.ID].State, s.updates[u.ID].Detail
+	s.mu.RUnlock()
+	if state != StateVerified {
+		return u.ID, false, detail
+	}
+	if d, err := s.m.Device(ctx, device); err != nil || !d.Online {
+		return u.ID, false, "not online after the update"
+	}
+	return u.ID, true, detail
+}
+
+// setRolloutState moves r to state and emits the change.
+func (s *Service) setRolloutState(r *Rollout, state RolloutState, detail string) {
+	s.mu.Lock()
+	r.State, r.Detail = state, detail
+	if state == RolloutCompleted || state == RolloutRolledBack {
+		now := time.Now()
+		r.FinishedAt = &now
+	}
+	out := r.clone()
+	s.mu.Unlock()
+	s.emitRollout(out)
+}
+
+func (s *Service) emitRollout(r Rollout) {
+	s.m.Emit(dm.Event{Kind: dm.EventRollout, OccurredAt: time.Now(), Source: "firmware",
+		Payload: RolloutEvent{Rollout: r.ID, State: r.State, Detail: r.Detail, Progress: r.Progress}})
+}
+
+// Resume continues a paused rollout visible to the caller with its next batch; its failures are
+// checked again after that batch. A rollout that is not paused is ErrConflict.
+func (s *Service) Resume(ctx context.Context, id string) (Rollout, error) {
+	s.mu.Lock()
+	r, ok := s.rollouts[id]
+	if !ok || !visible(ctx, r.Partners) {
+		s.mu.Unlock()
+		return Rollout{}, ErrRolloutNotFound
+	}
+	if r.State != RolloutPaused {
+		s.mu.Unlock()
+		return Rollout{}, fmt.Errorf("rollout %s is %s, not paused: %w", id, r.State, dm.ErrConflict)
+	}
+	r.State, r.Detail = RolloutRunning, "resumed"
+	r.resume <- struct{}{}
+	out := r.clone()
+	s.mu.Unlock()
+	s.emitRollout(out)
+	return out, nil
+}
+
+// GetRollout returns a rollout visible to the caller.
+func (s *Service) GetRollout(ctx context.Context, id string) (Rollout, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.rollouts[id]
+	if !ok || !visible(ctx, r.Partners) {
+		return Rollout{}, ErrRolloutNotFound
+	}
+	return r.clone(), nil
+}
+
+// ListRollouts returns the rollouts visible to the caller, newest first, without their devices.
+func (s *Service) ListRollouts(ctx context.Context) []Rollout {
+	s.mu.RLock()
+	out := []Rollout{}
+	for _, r := range s.rollouts {
+		if visible(ctx, r.Partners) {
+			c := r.clone()
+			c.Devices = nil
+			out = append(out, c)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, k int) bool { return out[i].CreatedAt.After(out[k].CreatedAt) })
+	return out
+}
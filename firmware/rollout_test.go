@@ -0,0 +1,113 @@
+package firmware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func waitRollout(t *testing.T, svc *Service, id string, want RolloutState) Rollout {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		r, err := svc.GetRollout(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.State == want {
+			return r
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rollout %s, want %s (%+v)", r.State, want, r.Devices)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+var rolloutDevices = []dm.DeviceID{"mac:1", "mac:2", "mac:3", "mac:4"}
+
+func TestRolloutPausesAndResumes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dev := &fakeDevices{events: make(chan dm.Event), flash: map[dm.DeviceID]string{"mac:1": "Completed", "mac:2": "Failed", "mac:3": "Completed", "mac:4": "Completed"}}
+	svc := NewService(ctx, dev, Config{PollInterval: 5 * time.Millisecond})
+
+	if _, err := svc.StartRollout(ctx, RolloutSpec{Devices: rolloutDevices, Request: Request{Version: "FW_2.0", URL: "http://cdn/FW_2.0.bin"}, OnFailure: OnFailureRollback}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("rollback without a previous image: %v", err)
+	}
+	r, err := svc.StartRollout(ctx, RolloutSpec{Devices: rolloutDevices, Request: Request{Version: "FW_2.0", URL: "http://cdn/FW_2.0.bin"}, BatchSize: 2, MaxFailurePercent: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paused := waitRollout(t, svc, r.ID, RolloutPaused)
+	if paused.Progress.Healthy != 1 || paused.Progress.Failed != 1 || paused.Progress.Pending != 2 {
+		t.Fatalf("paused after the first batch with %+v", paused.Progress)
+	}
+	if _, err := svc.Resume(dm.WithPartners(ctx, []string{"sky"}), r.ID); !errors.Is(err, ErrRolloutNotFound) {
+		t.Fatalf("scoped caller resumed an unscoped rollout: %v", err)
+	}
+	if _, err := svc.Resume(ctx, r.ID); err != nil {
+		t.Fatal(err)
+	}
+	done := waitRollout(t, svc, r.ID, RolloutCompleted) // 1 of 4 failed is within 30%
+	if done.Progress.Healthy != 3 || done.FinishedAt == nil {
+		t.Fatalf("completed with %+v", done.Progress)
+	}
+	if _, err := svc.Resume(ctx, r.ID); !errors.Is(err, dm.ErrConflict) {
+		t.Fatalf("resuming a completed rollout: %v", err)
+	}
+
+	dev.mu.Lock()
+	var states []RolloutState
+	for _, e := range dev.emitted {
+		if e.Kind == dm.EventRollout {
+			states = append(states, e.Payload.(RolloutEvent).State)
+		}
+	}
+	dev.mu.Unlock()
+	want := []RolloutState{RolloutRunning, RolloutPaused, RolloutRunning, RolloutCompleted}
+	if len(states) != len(want) {
+		t.Fatalf("events %v, want %v", states, want)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Fatalf("events %v, want %v", states, want)
+		}
+	}
+}
+
+func TestRolloutRollsBack(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dev := &fakeDevices{events: make(chan dm.Event), flash: map[dm.DeviceID]string{"mac:1": "Completed", "mac:2": "Failed"}}
+	svc := NewService(ctx, dev, Config{PollInterval: 5 * time.Millisecond})
+	r, err := svc.StartRollout(ctx, RolloutSpec{
+		Devices:       rolloutDevices,
+		Request:       Request{Version: "FW_2.0", URL: "http://cdn/FW_2.0.bin"},
+		Previous:      &Request{Version: "FW_1.0", URL: "http://cdn/FW_1.0.bin"},
+		BatchSize:     2,
+		OnFailure:     OnFailureRollback,
+		HealthTimeout: "1s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := waitRollout(t, svc, r.ID, RolloutRolledBack)
+	outcomes := map[dm.DeviceID]Outcome{}
+	for _, d := range done.Devices {
+		outcomes[d.Device] = d.Outcome
+	}
+	if outcomes["mac:1"] != OutcomeRolledBack || outcomes["mac:2"] != OutcomeRollbackFailed || outcomes["mac:3"] != OutcomePending || outcomes["mac:4"] != OutcomePending {
+		t.Fatalf("outcomes %v", outcomes)
+	}
+	u, err := svc.Get(ctx, done.Devices[0].Rollback)
+	if err != nil || u.Request.Version != "FW_1.0" || u.State != StateVerified {
+		t.Fatalf("rollback update %+v: %v", u, err)
+	}
+	if list := svc.ListRollouts(ctx); len(list) != 1 || list[0].Devices != nil {
+		t.Fatalf("ListRollouts = %+v", list)
+	}
+}
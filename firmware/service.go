@@ -0,0 +1,280 @@
+package firmware
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// RDK parameters used when Config leaves them empty.
+const (
+	DefaultURLParameter      = "Device.DeviceInfo.X_RDKCENTRAL-COM_FirmwareDownloadURL"
+	DefaultFilenameParameter = "Device.DeviceInfo.X_RDKCENTRAL-COM_FirmwareToDownload"
+	DefaultTriggerParameter  = "Device.DeviceInfo.X_RDKCENTRAL-COM_FirmwareDownloadNow"
+	DefaultStatusParameter   = "Device.DeviceInfo.X_RDKCENTRAL-COM_FirmwareDownloadStatus"
+	DefaultVersionParameter  = "Device.DeviceInfo.SoftwareVersion"
+)
+
+// Devices is the subset of manager.Manager used by Service.
+type Devices interface {
+	Device(ctx context.Context, id dm.DeviceID) (dm.DeviceState, error)
+	RefreshParameters(ctx context.Context, id dm.DeviceID, service string, names []string) (map[string]dm.ParameterValue, error)
+	SetParameters(ctx context.Context, id dm.DeviceID, service string, params []dm.SetParameter, opts dm.SetOptions) (*runtime.SetResult, error)
+	Subscribe(buffer int) dm.EventSubscription
+	CheckMaintenance(ctx context.Context, id dm.DeviceID) error
+	Exclusive(ctx context.Context, id dm.DeviceID, kind, detail string) (release func(), err error)
+	Emit(e dm.Event)
+}
+
+// Config selects the device parameters and tracking cadence.
+type Config struct {
+	URLParameter      string
+	FilenameParameter string
+	TriggerParameter  string // set to true to start the download
+	StatusParameter   string // "In Progress", "Completed", "Failed", ...
+	VersionParameter  string
+
+	PollInterval time.Duration // status/version reads; default 30s
+	Timeout      time.Duration // an update not verified by then fails; default 1h
+}
+
+// Service starts firmware updates and tracks them in memory.
+type Service struct {
+	m   Devices
+	cfg Config
+	ctx context.Context
+
+	mu       sync.RWMutex
+	updates  map[string]*Update
+	active   map[dm.DeviceID]chan dm.Event // events for the device's in-flight update
+	rollouts map[string]*Rollout
+}
+
+// NewService creates a Service whose trackers run until ctx is canceled.
+func NewService(ctx context.Context, m Devices, cfg Config) *Service {
+	cfg.URLParameter = orDefault(cfg.URLParameter, DefaultURLParameter)
+	cfg.FilenameParameter = orDefault(cfg.FilenameParameter, DefaultFilenameParameter)
+	cfg.TriggerParameter = orDefault(cfg.TriggerParameter, DefaultTriggerParameter)
+	cfg.StatusParameter = orDefault(cfg.StatusParameter, DefaultStatusParameter)
+	cfg.VersionParameter = orDefault(cfg.VersionParameter, DefaultVersionParameter)
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 30 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Hour
+	}
+	s := &Service{m: m, cfg: cfg, ctx: ctx, updates: make(map[string]*Update), active: make(map[dm.DeviceID]chan dm.Event), rollouts: make(map[string]*Rollout)}
+	sub := m.Subscribe(256)
+	go func() {
+		<-ctx.Done()
+		sub.Close()
+	}()
+	go s.dispatch(sub)
+	return s
+}
+
+func orDefault(v, d string) string {
+	if v == "" {
+		return d
+	}
+	return v
+}
+
+func (s *Service) dispatch(sub dm.EventSubscription) {
+	for e := range sub.C() {
+		s.mu.RLock()
+		ch, ok := s.active[e.DeviceID]
+		s.mu.RUnlock()
+		if ok {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+}
+
+// Start writes the download parameters to the device and begins tracking the update. A device has
+// at most one update in flight and the update holds the device exclusively until it finishes
+// (see manager.Manager.Exclusive), so starting one alongside another exclusive operation fails with
+// a *dm.OperationConflictError. Outside the device's maintenance window Start fails with
+// dm.ErrOutsideMaintenanceWindow.
+func (s *Service) Start(ctx context.Context, device dm.DeviceID, req Request) (Update, error) {
+	if req.Version == "" || req.URL == "" {
+		return Update{}, fmt.Errorf("version and url required: %w", dm.ErrInvalidParameter)
+	}
+	if req.Filename == "" {
+		req.Filename = path.Base(req.URL)
+	}
+	scope, scoped := dm.PartnersFromContext(ctx)
+	if scoped {
+		if _, err := s.m.Device(ctx, device); err != nil {
+			return Update{}, err
+		}
+	}
+	if err := s.m.CheckMaintenance(ctx, device); err != nil {
+		return Update{}, err
+	}
+	id := uuid.NewString()
+	release, err := s.m.Exclusive(ctx, device, dm.OperationFirmwareUpdate, id)
+	if err != nil {
+		return Update{}, err
+	}
+	events := make(chan dm.Event, 16)
+	s.mu.Lock()
+	if _, busy := s.active[device]; busy {
+		s.mu.Unlock()
+		release()
+		return Update{}, fmt.Errorf("firmware update already in progress on %s: %w", device, dm.ErrConflict)
+	}
+	s.active[device] = events // reserve before the SET so reboot events are not missed
+	s.mu.Unlock()
+
+	_, err = s.m.SetParameters(ctx, device, "", []dm.SetParameter{
+		{Name: s.cfg.URLParameter, Value: req.URL, TypeHint: "string"},
+		{Name: s.cfg.FilenameParameter, Value: req.Filename, TypeHint: "string"},
+		{Name: s.cfg.TriggerParameter, Value: true, TypeHint: "boolean"},
+	}, dm.SetOptions{})
+	if err != nil {
+		s.mu.Lock()
+		delete(s.active, device)
+		s.mu.Unlock()
+		release()
+		return Update{}, err
+	}
+	u := &Update{ID: id, Device: device, Request: req, Forced: dm.MaintenanceOverridden(ctx), CreatedAt: time.Now(), done: make(chan struct{})}
+	u.State = StatePending
+	u.Transitions = []Transition{{State: StatePending, At: u.CreatedAt}}
+	runCtx := s.ctx
+	if scoped {
+		u.Partners = scope
+		runCtx = dm.WithPartners(runCtx, scope)
+	}
+	s.mu.Lock()
+	s.updates[u.ID] = u
+	out := u.clone()
+	s.mu.Unlock()
+	go s.track(runCtx, u, events, release)
+	return out, nil
+}
+
+// track drives u until it reaches a terminal state, the timeout passes or the service stops, then
+// releases the device.
+func (s *Service) track(ctx context.Context, u *Update, events <-chan dm.Event, release func()) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.active, u.Device)
+		s.mu.Unlock()
+		release()
+		close(u.done)
+	}()
+	timeout := time.NewTimer(s.cfg.Timeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+	offline := false
+	for !s.state(u).Terminal() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout.C:
+			s.advance(u, StateFailed, fmt.Sprintf("timed out while %s", s.state(u)))
+		case e := <-events:
+			switch e.Kind {
+			case dm.EventOffline:
+				offline = true
+			case dm.EventOnline:
+				if offline {
+					s.advance(u, StateRebooted, "device reconnected")
+					s.poll(ctx, u)
+				}
+			}
+		case <-ticker.C:
+			s.poll(ctx, u)
+		}
+	}
+}
+
+// poll reads the download status and running version. Read errors are expected while the device
+// reboots and only update Detail.
+func (s *Service) poll(ctx context.Context, u *Update) {
+	values, err := s.m.RefreshParameters(ctx, u.Device, "", []string{s.cfg.StatusParameter, s.cfg.VersionParameter})
+	if err != nil {
+		s.mu.Lock()
+		u.Detail = err.Error()
+		s.mu.Unlock()
+		return
+	}
+	// the target version only counts once the download has completed: a device reporting it
+	// earlier was already running it, or answers from a stale image
+	if state := s.state(u); state == StateApplying || state == StateRebooted {
+		if v := values[s.cfg.VersionParameter].Value; v != nil && strings.TrimSpace(fmt.Sprint(v)) == strings.TrimSpace(u.Request.Version) {
+			s.advance(u, StateVerified, "running "+fmt.Sprint(v))
+			return
+		}
+	}
+	status, _ := values[s.cfg.StatusParameter].Value.(string)
+	switch normalized := strings.ToLower(status); {
+	case strings.Contains(normalized, "fail"):
+		s.advance(u, StateFailed, status)
+	case strings.Contains(normalized, "complete"):
+		s.advance(u, StateApplying, status)
+	case strings.Contains(normalized, "progress"), strings.Contains(normalized, "downloading"):
+		s.advance(u, StateDownloading, status)
+	}
+}
+
+func (s *Service) advance(u *Update, state State, detail string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u.advance(state, detail)
+}
+
+func (s *Service) state(u *Update) State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return u.State
+}
+
+// Get returns an update visible to the caller.
+func (s *Service) Get(ctx context.Context, id string) (Update, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.updates[id]
+	if !ok || !visible(ctx, u.Partners) {
+		return Update{}, ErrUpdateNotFound
+	}
+	return u.clone(), nil
+}
+
+// List returns the device's updates visible to the caller, newest first.
+func (s *Service) List(ctx context.Context, device dm.DeviceID) []Update {
+	s.mu.RLock()
+	out := []Update{}
+	for _, u := range s.updates {
+		if u.Device == device && visible(ctx, u.Partners) {
+			out = append(out, u.clone())
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, k int) bool { return out[i].CreatedAt.After(out[k].CreatedAt) })
+	return out
+}
+
+// visible reports whether the caller may see an update or rollout started with the given partner
+// scope.
+func visible(ctx context.Context, partners []string) bool {
+	scope, ok := dm.PartnersFromContext(ctx)
+	if !ok {
+		return true
+	}
+	return len(partners) > 0 && dm.PartnerAllowed(scope, partners)
+}
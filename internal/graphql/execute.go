@@ -0,0 +1,244 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Resolver produces the value of a field given its parent value and resolved arguments.
+type Resolver func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error)
+
+// FieldDef describes one field of an object type. Type names the object type of the
+// result (or of each element when the resolver returns a slice); empty means scalar.
+type FieldDef struct {
+	Type    string
+	Resolve Resolver
+}
+
+// Schema is a set of object types plus the name of the root query type.
+type Schema struct {
+	Query string
+	Types map[string]map[string]FieldDef
+}
+
+// Error is a GraphQL field or request error.
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// Response is the standard GraphQL response envelope.
+type Response struct {
+	Data   *Object `json:"data"`
+	Errors []Error `json:"errors,omitempty"`
+}
+
+// Object is a response object that preserves the field order of the query when marshaled.
+type Object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newObject() *Object { return &Object{values: map[string]interface{}{}} }
+
+func (o *Object) set(k string, v interface{}) {
+	if _, ok := o.values[k]; !ok {
+		o.keys = append(o.keys, k)
+	}
+	o.values[k] = v
+}
+
+// Get returns the value stored under key.
+func (o *Object) Get(key string) interface{} { return o.values[key] }
+
+// MarshalJSON writes fields in selection order.
+func (o *Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, _ := json.Marshal(k)
+		buf.Write(kb)
+		buf.WriteByte(':')
+		vb, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type execution struct {
+	schema *Schema
+	vars   map[string]interface{}
+	errors []Error
+}
+
+// Execute runs a parsed document against the schema. Field errors null the field and are
+// reported in Response.Errors; sibling fields still resolve.
+func (s *Schema) Execute(ctx context.Context, doc *Document, vars map[string]interface{}) Response {
+	ex := &execution{schema: s, vars: vars}
+	data := ex.object(ctx, s.Query, nil, doc.Selection, nil)
+	return Response{Data: data, Errors: ex.errors}
+}
+
+func (ex *execution) object(ctx context.Context, typeName string, source interface{}, sel []Field, path []interface{}) *Object {
+	fields := ex.schema.Types[typeName]
+	out := newObject()
+	for _, f := range sel {
+		fieldPath := append(append([]interface{}(nil), path...), f.Key())
+		if f.Name == "__typename" {
+			out.set(f.Key(), typeName)
+			continue
+		}
+		def, ok := fields[f.Name]
+		if !ok {
+			ex.fail(fieldPath, fmt.Errorf("unknown field %q on type %s", f.Name, typeName))
+			out.set(f.Key(), nil)
+			continue
+		}
+		args, err := ex.arguments(f.Arguments)
+		if err != nil {
+			ex.fail(fieldPath, err)
+			out.set(f.Key(), nil)
+			continue
+		}
+		v, err := def.Resolve(ctx, source, args)
+		if err != nil {
+			ex.fail(fieldPath, err)
+			out.set(f.Key(), nil)
+			continue
+		}
+		out.set(f.Key(), ex.complete(ctx, def.Type, v, f, fieldPath))
+	}
+	return out
+}
+
+func (ex *execution) complete(ctx context.Context, typeName string, v interface{}, f Field, path []interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Slice) && rv.IsNil() {
+		return nil
+	}
+	if typeName == "" {
+		if len(f.Selection) > 0 {
+			ex.fail(path, fmt.Errorf("field %q is a scalar and cannot have a selection", f.Name))
+			return nil
+		}
+		return v
+	}
+	if len(f.Selection) == 0 {
+		ex.fail(path, fmt.Errorf("field %q of type %s must have a selection", f.Name, typeName))
+		return nil
+	}
+	if rv.Kind() == reflect.Slice {
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = ex.object(ctx, typeName, rv.Index(i).Interface(), f.Selection, append(append([]interface{}(nil), path...), i))
+		}
+		return list
+	}
+	return ex.object(ctx, typeName, v, f.Selection, path)
+}
+
+func (ex *execution) arguments(in map[string]value) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(in))
+	for k, v := range in {
+		r, err := ex.resolve(v)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = r
+	}
+	return out, nil
+}
+
+func (ex *execution) resolve(v value) (interface{}, error) {
+	switch t := v.(type) {
+	case variableRef:
+		val, ok := ex.vars[string(t)]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s not provided", string(t))
+		}
+		return val, nil
+	case []value:
+		list := make([]interface{}, len(t))
+		for i, e := range t {
+			r, err := ex.resolve(e)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = r
+		}
+		return list, nil
+	case map[string]value:
+		obj := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			r, err := ex.resolve(e)
+			if err != nil {
+				return nil, err
+			}
+			obj[k] = r
+		}
+		return obj, nil
+	default:
+		return t, nil
+	}
+}
+
+func (ex *execution) fail(path []interface{}, err error) {
+	ex.errors = append(ex.errors, Error{Message: err.Error(), Path: path})
+}
+
+// StringArg returns a string argument or "" when absent.
+func StringArg(args map[string]interface{}, name string) string {
+	s, _ := args[name].(string)
+	return s
+}
+
+// StringListArg returns a list-of-strings argument; a single string is accepted as a one-element list.
+func StringListArg(args map[string]interface{}, name string) []string {
+	switch t := args[name].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		out := make([]string, 0, len(t))
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	case []string:
+		return t
+	}
+	return nil
+}
+
+// IntArg returns an integer argument (JSON variables decode as float64) and whether it was present.
+func IntArg(args map[string]interface{}, name string) (int, bool) {
+	switch t := args[name].(type) {
+	case int64:
+		return int(t), true
+	case float64:
+		return int(t), true
+	case int:
+		return t, true
+	}
+	return 0, false
+}
+
+// BoolArg returns a boolean argument and whether it was present.
+func BoolArg(args map[string]interface{}, name string) (bool, bool) {
+	b, ok := args[name].(bool)
+	return b, ok
+}
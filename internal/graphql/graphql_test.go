@@ -0,0 +1,84 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseAndExecute(t *testing.T) {
+	schema := &Schema{
+		Query: "Query",
+		Types: map[string]map[string]FieldDef{
+			"Query": {
+				"items": {Type: "Item", Resolve: func(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+					n, _ := IntArg(args, "limit")
+					return []string{"a", "b", "c"}[:n], nil
+				}},
+				"broken": {Resolve: func(ctx context.Context, _ interface{}, _ map[string]interface{}) (interface{}, error) {
+					return nil, errors.New("boom")
+				}},
+			},
+			"Item": {
+				"name": {Resolve: func(ctx context.Context, src interface{}, _ map[string]interface{}) (interface{}, error) {
+					return src, nil
+				}},
+			},
+		},
+	}
+	doc, err := Parse(`query Q($n: Int) { first: items(limit: $n) { name __typename } broken }`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	resp := schema.Execute(context.Background(), doc, map[string]interface{}{"n": float64(2)})
+	b, _ := json.Marshal(resp)
+	want := `{"data":{"first":[{"name":"a","__typename":"Item"},{"name":"b","__typename":"Item"}],"broken":null},"errors":[{"message":"boom","path":["broken"]}]}`
+	if string(b) != want {
+		t.Fatalf("unexpected response\n got %s\nwant %s", b, want)
+	}
+}
+
+func TestParseRejectsUnsupported(t *testing.T) {
+	for _, q := range []string{
+		`mutation { x }`,
+		`{ ...frag }`,
+		`{ a @include(if: true) }`,
+		`{ a `,
+		`{}`,
+		strings.Repeat("{ a ", MaxDepth+1) + strings.Repeat("}", MaxDepth+1),
+	} {
+		if _, err := Parse(q); err == nil {
+			t.Fatalf("expected error for %q", q)
+		}
+	}
+}
+
+func TestParseDepth(t *testing.T) {
+	doc, err := Parse(strings.Repeat("{ a ", MaxDepth) + strings.Repeat("}", MaxDepth))
+	if err != nil {
+		t.Fatalf("selections %d deep: %v", MaxDepth, err)
+	}
+	depth := 0
+	for sel := doc.Selection; len(sel) > 0; sel = sel[0].Selection {
+		depth++
+	}
+	if depth != MaxDepth {
+		t.Fatalf("parsed %d levels", depth)
+	}
+}
+
+func TestParseLiterals(t *testing.T) {
+	doc, err := Parse(`{ f(s: "x\"y", n: -3, fl: 1.5, b: true, l: ["a", "b"], o: {k: null}, e: ENUM) }`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	args := doc.Selection[0].Arguments
+	if args["s"] != `x"y` || args["n"] != int64(-3) || args["fl"] != 1.5 || args["b"] != true || args["e"] != "ENUM" {
+		t.Fatalf("unexpected args: %#v", args)
+	}
+	if l, ok := args["l"].([]value); !ok || len(l) != 2 {
+		t.Fatalf("unexpected list: %#v", args["l"])
+	}
+}
@@ -0,0 +1,347 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// This package implements the small subset of GraphQL needed by the devicemgr UI endpoint:
+// a single anonymous or named query operation with nested selection sets, aliases, field
+// arguments (scalar, list and object literals) and $variables. Fragments, directives,
+// mutations and subscriptions are rejected at parse time.
+
+// MaxDepth is how deeply selection sets may nest; deeper queries are rejected at parse time.
+const MaxDepth = 8
+
+// Field is one selected field in a query document.
+type Field struct {
+	Alias     string
+	Name      string
+	Arguments map[string]value
+	Selection []Field
+}
+
+// Key returns the response key for the field (alias when present).
+func (f Field) Key() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// Document is a parsed query operation.
+type Document struct {
+	Operation string
+	Selection []Field
+}
+
+// value is an unresolved argument literal; variable references are resolved at execution time.
+type value interface{}
+
+type variableRef string
+
+type parser struct {
+	src   string
+	pos   int
+	depth int // of the selection set being parsed
+}
+
+// Parse parses a query document.
+func Parse(query string) (*Document, error) {
+	p := &parser{src: query}
+	doc := &Document{}
+	p.skip()
+	if p.peekWord() != "" {
+		switch kw := p.word(); kw {
+		case "query":
+			p.skip()
+			if p.peekWord() != "" {
+				doc.Operation = p.word()
+			}
+			p.skip()
+			if p.peek() == '(' {
+				if err := p.skipVariableDefinitions(); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, fmt.Errorf("graphql: unsupported operation %q", kw)
+		}
+	}
+	sel, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	doc.Selection = sel
+	p.skip()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected trailing content")
+	}
+	return doc, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("graphql: offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// skip advances past whitespace, commas and comments (all insignificant in GraphQL).
+func (p *parser) skip() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == ',' || unicode.IsSpace(rune(c)):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) peek() byte {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) expect(c byte) error {
+	p.skip()
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func isNameStart(c byte) bool { return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+func isNameChar(c byte) bool  { return isNameStart(c) || (c >= '0' && c <= '9') }
+
+func (p *parser) peekWord() string {
+	end := p.pos
+	if end >= len(p.src) || !isNameStart(p.src[end]) {
+		return ""
+	}
+	for end < len(p.src) && isNameChar(p.src[end]) {
+		end++
+	}
+	return p.src[p.pos:end]
+}
+
+func (p *parser) word() string {
+	w := p.peekWord()
+	p.pos += len(w)
+	return w
+}
+
+// skipVariableDefinitions consumes "( $a: Type = default ... )"; types are not enforced.
+func (p *parser) skipVariableDefinitions() error {
+	depth := 0
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				p.pos++
+				return nil
+			}
+		}
+		p.pos++
+	}
+	return p.errorf("unterminated variable definitions")
+}
+
+func (p *parser) selectionSet() ([]Field, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	if p.depth++; p.depth > MaxDepth {
+		return nil, p.errorf("selections nest deeper than %d", MaxDepth)
+	}
+	defer func() { p.depth-- }()
+	var fields []Field
+	for {
+		p.skip()
+		switch c := p.peek(); {
+		case c == '}':
+			p.pos++
+			if len(fields) == 0 {
+				return nil, p.errorf("empty selection set")
+			}
+			return fields, nil
+		case c == '.':
+			return nil, p.errorf("fragments are not supported")
+		case c == '@':
+			return nil, p.errorf("directives are not supported")
+		case c == 0:
+			return nil, p.errorf("unterminated selection set")
+		}
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+}
+
+func (p *parser) field() (Field, error) {
+	var f Field
+	name := p.word()
+	if name == "" {
+		return f, p.errorf("expected field name")
+	}
+	p.skip()
+	if p.peek() == ':' {
+		p.pos++
+		p.skip()
+		f.Alias = name
+		if name = p.word(); name == "" {
+			return f, p.errorf("expected field name after alias")
+		}
+		p.skip()
+	}
+	f.Name = name
+	if p.peek() == '(' {
+		p.pos++
+		f.Arguments = map[string]value{}
+		for {
+			p.skip()
+			if p.peek() == ')' {
+				p.pos++
+				break
+			}
+			arg := p.word()
+			if arg == "" {
+				return f, p.errorf("expected argument name")
+			}
+			if err := p.expect(':'); err != nil {
+				return f, err
+			}
+			v, err := p.value()
+			if err != nil {
+				return f, err
+			}
+			f.Arguments[arg] = v
+		}
+		p.skip()
+	}
+	if p.peek() == '{' {
+		sel, err := p.selectionSet()
+		if err != nil {
+			return f, err
+		}
+		f.Selection = sel
+	}
+	return f, nil
+}
+
+func (p *parser) value() (value, error) {
+	p.skip()
+	c := p.peek()
+	switch {
+	case c == '$':
+		p.pos++
+		name := p.word()
+		if name == "" {
+			return nil, p.errorf("expected variable name")
+		}
+		return variableRef(name), nil
+	case c == '"':
+		return p.stringValue()
+	case c == '[':
+		p.pos++
+		var list []value
+		for {
+			p.skip()
+			if p.peek() == ']' {
+				p.pos++
+				return list, nil
+			}
+			if p.peek() == 0 {
+				return nil, p.errorf("unterminated list")
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+	case c == '{':
+		p.pos++
+		obj := map[string]value{}
+		for {
+			p.skip()
+			if p.peek() == '}' {
+				p.pos++
+				return obj, nil
+			}
+			key := p.word()
+			if key == "" {
+				return nil, p.errorf("expected object field name")
+			}
+			if err := p.expect(':'); err != nil {
+				return nil, err
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = v
+		}
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		lit := p.src[start:p.pos]
+		if i, err := strconv.ParseInt(lit, 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", lit)
+		}
+		return f, nil
+	case isNameStart(c):
+		switch w := p.word(); w {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		default:
+			return w, nil // enum value
+		}
+	}
+	return nil, p.errorf("unexpected character %q", c)
+}
+
+func (p *parser) stringValue() (value, error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos += 2
+			continue
+		case '"':
+			p.pos++
+			s, err := strconv.Unquote(p.src[start:p.pos])
+			if err != nil {
+				return nil, p.errorf("invalid string literal")
+			}
+			return s, nil
+		}
+		p.pos++
+	}
+	return nil, p.errorf("unterminated string")
+}
@@ -0,0 +1,163 @@
+package httpapi
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Allowlist enforces a dm.AllowlistConfig. A nil *Allowlist allows every request.
+type Allowlist struct {
+	global  []netip.Prefix
+	routes  []routeAllowlist
+	proxies []netip.Prefix
+}
+
+type routeAllowlist struct {
+	path    string
+	methods map[string]bool // nil matches every method
+	nets    []netip.Prefix
+}
+
+// NewAllowlist parses cfg, returning nil when it restricts nothing.
+func NewAllowlist(cfg dm.AllowlistConfig) (*Allowlist, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	a := &Allowlist{}
+	var err error
+	if a.global, err = parsePrefixes(cfg.Global); err != nil {
+		return nil, fmt.Errorf("allowlist global: %w", err)
+	}
+	if a.proxies, err = parsePrefixes(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("allowlist trustedProxies: %w", err)
+	}
+	for i, r := range cfg.Routes {
+		if !strings.HasPrefix(r.Path, "/") || len(r.CIDRs) == 0 {
+			return nil, fmt.Errorf("allowlist route %d: a path and cidrs are required: %w", i, dm.ErrInvalidParameter)
+		}
+		ra := routeAllowlist{path: strings.TrimSuffix(r.Path, "/")}
+		for _, m := range r.Methods {
+			if ra.methods == nil {
+				ra.methods = make(map[string]bool)
+			}
+			if strings.EqualFold(m, "mutating") {
+				for _, mm := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+					ra.methods[mm] = true
+				}
+				continue
+			}
+			ra.methods[strings.ToUpper(m)] = true
+		}
+		if ra.nets, err = parsePrefixes(r.CIDRs); err != nil {
+			return nil, fmt.Errorf("allowlist route %s: %w", r.Path, err)
+		}
+		a.routes = append(a.routes, ra)
+	}
+	return a, nil
+}
+
+func parsePrefixes(list []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("network %q: %w", s, dm.ErrInvalidParameter)
+			}
+			out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("network %q: %w", s, dm.ErrInvalidParameter)
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+// Wrap refuses, with 403, requests from clients outside the networks allowed for them.
+func (a *Allowlist) Wrap(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, ok := a.ClientAddr(r)
+		if !ok || !a.Allowed(client, r.Method, r.URL.Path) {
+			writeCORS(w, r)
+			writeError(w, fmt.Errorf("client %s is not allowed to %s %s: %w", client, r.Method, r.URL.Path, dm.ErrAccessDenied))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Allowed reports whether client may make a method request for path.
+func (a *Allowlist) Allowed(client netip.Addr, method, path string) bool {
+	if a == nil {
+		return true
+	}
+	client = client.Unmap()
+	if len(a.global) > 0 && !contains(a.global, client) {
+		return false
+	}
+	for _, ra := range a.routes {
+		if path != ra.path && !strings.HasPrefix(path, ra.path+"/") {
+			continue
+		}
+		if ra.methods != nil && !ra.methods[method] {
+			continue
+		}
+		if !contains(ra.nets, client) {
+			return false
+		}
+	}
+	return true
+}
+
+// ClientAddr returns the address a request is judged by: the peer's, or with a trusted proxy as
+// the peer, the last X-Forwarded-For address not itself a trusted proxy.
+func (a *Allowlist) ClientAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+	if a == nil || !contains(a.proxies, addr) {
+		return addr, true
+	}
+	forwarded := r.Header.Values("X-Forwarded-For")
+	if len(forwarded) == 0 {
+		return addr, true
+	}
+	hops := strings.Split(strings.Join(forwarded, ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		if addr = hop.Unmap(); !contains(a.proxies, addr) {
+			break
+		}
+	}
+	return addr, true // every hop a trusted proxy: the client is the first of them
+}
+
+func contains(nets []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range nets {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestAllowlist(t *testing.T) {
+	a, err := NewAllowlist(dm.AllowlistConfig{
+		Global:         []string{"10.0.0.0/8", "192.0.2.7"},
+		Routes:         []dm.RouteAllowlist{{Path: "/api/devices", Methods: []string{"mutating"}, CIDRs: []string{"10.1.0.0/16"}}},
+		TrustedProxies: []string{"10.9.9.9"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := a.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }))
+	cases := []struct {
+		name, method, path, remote, forwarded string
+		want                                  int
+	}{
+		{"read from the management network", http.MethodGet, "/api/devices/mac:0000000000a1", "10.2.3.4:5000", "", http.StatusNoContent},
+		{"single address", http.MethodGet, "/api/devices", "192.0.2.7:5000", "", http.StatusNoContent},
+		{"outside the global list", http.MethodGet, "/api/devices", "192.0.2.8:5000", "", http.StatusForbidden},
+		{"IPv4-mapped IPv6", http.MethodGet, "/api/devices", "[::ffff:10.2.3.4]:5000", "", http.StatusNoContent},
+		{"mutation from another subnet", http.MethodPost, "/api/devices/mac:0000000000a1/reboot", "10.2.3.4:5000", "", http.StatusForbidden},
+		{"mutation from the ops subnet", http.MethodPost, "/api/devices/mac:0000000000a1/reboot", "10.1.3.4:5000", "", http.StatusNoContent},
+		{"prefix at a segment boundary", http.MethodPost, "/api/devicesx", "10.2.3.4:5000", "", http.StatusNoContent},
+		{"through the proxy", http.MethodPost, "/api/devices/x", "10.9.9.9:5000", "203.0.113.1, 10.1.0.5", http.StatusNoContent},
+		{"proxy relaying an outsider", http.MethodGet, "/api/devices", "10.9.9.9:5000", "203.0.113.1", http.StatusForbidden},
+		{"spoofed header from an untrusted peer", http.MethodPost, "/api/devices/x", "10.2.3.4:5000", "10.1.0.5", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		req.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s: status %d, want %d", c.name, rec.Code, c.want)
+		}
+	}
+
+	if a, err := NewAllowlist(dm.AllowlistConfig{}); a != nil || err != nil {
+		t.Fatalf("empty config: %v %v", a, err)
+	}
+	if _, err := NewAllowlist(dm.AllowlistConfig{Global: []string{"10.0.0.0/33"}}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("bad CIDR: %v", err)
+	}
+}
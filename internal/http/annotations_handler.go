@@ -0,0 +1,118 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+)
+
+// GetAnnotationsHandler serves GET /api/devices/{id}/annotations.
+func GetAnnotationsHandler(svc *annotation.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		a, err := svc.Get(r.Context(), id)
+		if err != nil {
+			writeAnnotationError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, a)
+	}
+}
+
+// PutAnnotationsHandler serves PUT /api/devices/{id}/annotations {"tickets":[...],"labels":{...}},
+// replacing the device's tickets and labels.
+func PutAnnotationsHandler(svc *annotation.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var req struct {
+			Tickets []string          `json:"tickets"`
+			Labels  map[string]string `json:"labels"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		a, err := svc.Put(r.Context(), id, req.Tickets, req.Labels)
+		if err != nil {
+			writeAnnotationError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, a)
+	}
+}
+
+// DeleteAnnotationsHandler serves DELETE /api/devices/{id}/annotations, removing all of them.
+func DeleteAnnotationsHandler(svc *annotation.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		if err := svc.Delete(r.Context(), id); err != nil {
+			writeAnnotationError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// AddNoteHandler serves POST /api/devices/{id}/annotations/notes {"text","author"}.
+func AddNoteHandler(svc *annotation.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var req struct {
+			Text   string `json:"text"`
+			Author string `json:"author"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		note, err := svc.AddNote(r.Context(), id, req.Author, req.Text)
+		if err != nil {
+			writeAnnotationError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, note)
+	}
+}
+
+// DeleteNoteHandler serves DELETE /api/devices/{id}/annotations/notes/{nid}.
+func DeleteNoteHandler(svc *annotation.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		if err := svc.DeleteNote(r.Context(), id, r.PathValue("nid")); err != nil {
+			writeAnnotationError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeAnnotationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, annotation.ErrNoteNotFound) {
+		writeProblem(w, http.StatusNotFound, CodeNoteNotFound, err)
+		return
+	}
+	writeError(w, err)
+}
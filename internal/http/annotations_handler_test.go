@@ -0,0 +1,87 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+type annotatedDevices struct{}
+
+func (annotatedDevices) Device(_ context.Context, id dm.DeviceID) (dm.DeviceState, error) {
+	return dm.DeviceState{ID: id}, nil
+}
+
+func TestAnnotationsHandlers(t *testing.T) {
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"devices":[{"id":"mac:000000000001","hw-model":"XB7"},{"id":"mac:000000000002","hw-model":"XB7"}]}`))
+	}))
+	defer talaria.Close()
+	da := runtime.NewDeviceAdapter(talaria.URL, nil)
+	if _, err := da.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	svc := annotation.NewService(annotatedDevices{}, nil)
+	mux := http.NewServeMux()
+	quarantined := func(id dm.DeviceID) *dm.Quarantine {
+		if id == "mac:000000000002" {
+			return &dm.Quarantine{ID: dm.QuarantineID(id, ""), DeviceID: id, Reason: "INC-1"}
+		}
+		return nil
+	}
+	mux.Handle("GET /api/devices", AnnotatedDevicesHandler(da, svc, quarantined))
+	mux.Handle("GET /api/devices/{id}/annotations", GetAnnotationsHandler(svc))
+	mux.Handle("PUT /api/devices/{id}/annotations", PutAnnotationsHandler(svc))
+	mux.Handle("POST /api/devices/{id}/annotations/notes", AddNoteHandler(svc))
+	mux.Handle("DELETE /api/devices/{id}/annotations/notes/{nid}", DeleteNoteHandler(svc))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+
+	if rr := do("PUT", "/api/devices/MAC:00-00-00-00-00-01/annotations", `{"tickets":["OPS-7"],"labels":{"site":"lab"}}`); rr.Code != 200 {
+		t.Fatalf("PUT: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("PUT", "/api/devices/mac:000000000002/annotations", `{"labels":{"bad key":"x"}}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("PUT bad label: %d", rr.Code)
+	}
+	rr := do("POST", "/api/devices/mac:000000000001/annotations/notes", `{"text":"rebooted twice","author":"sam"}`)
+	var note annotation.Note
+	if rr.Code != http.StatusCreated || json.Unmarshal(rr.Body.Bytes(), &note) != nil || note.ID == "" {
+		t.Fatalf("POST note: %d %s", rr.Code, rr.Body)
+	}
+	var got annotation.Annotations
+	if rr := do("GET", "/api/devices/mac:000000000001/annotations", ""); json.Unmarshal(rr.Body.Bytes(), &got) != nil ||
+		got.Labels["site"] != "lab" || len(got.Notes) != 1 || got.Tickets[0] != "OPS-7" {
+		t.Fatalf("GET: %s", rr.Body)
+	}
+
+	var list struct {
+		Devices []DeviceInfo `json:"devices"`
+	}
+	rr = do("GET", "/api/devices?query=model:XB7+label.site:lab", "")
+	if json.Unmarshal(rr.Body.Bytes(), &list) != nil || len(list.Devices) != 1 || list.Devices[0].Annotations == nil ||
+		list.Devices[0].Annotations.Labels["site"] != "lab" {
+		t.Fatalf("label query: %s", rr.Body)
+	}
+	rr = do("GET", "/api/devices", "")
+	if json.Unmarshal(rr.Body.Bytes(), &list) != nil || len(list.Devices) != 2 || list.Devices[1].Annotations != nil ||
+		list.Devices[0].Quarantine != nil || list.Devices[1].Quarantine == nil || list.Devices[1].Quarantine.Reason != "INC-1" {
+		t.Fatalf("list: %s", rr.Body)
+	}
+
+	if rr := do("DELETE", "/api/devices/mac:000000000001/annotations/notes/"+note.ID, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("DELETE note: %d", rr.Code)
+	}
+	if rr := do("DELETE", "/api/devices/mac:000000000001/annotations/notes/"+note.ID, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("DELETE note again: %d", rr.Code)
+	}
+}
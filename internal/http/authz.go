@@ -0,0 +1,122 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// DefaultRoleClaim is the JWT claim consulted for role names when none is configured.
+const DefaultRoleClaim = "roles"
+
+// RoleResolver determines the caller's role for a request.
+type RoleResolver func(r *http.Request) (dm.Role, error)
+
+// AuthzPolicy decides whether a caller holding role may invoke a route requiring required.
+// It is the extension point for custom rules (per-device, per-time-of-day, external PDP, ...).
+type AuthzPolicy func(r *http.Request, role, required dm.Role) error
+
+var errForbidden = errors.New("insufficient role")
+
+// DefaultAuthzPolicy grants access when the caller's role is at least the required role.
+func DefaultAuthzPolicy(_ *http.Request, role, required dm.Role) error {
+	if role < required {
+		return errForbidden
+	}
+	return nil
+}
+
+// JWTRoleResolver maps the values of a bearer token claim to roles; the highest mapped role wins.
+// mapping keys are claim values (e.g. group names); nil maps the role names themselves
+// ("viewer", "operator", "admin"). verify checks the token as for JWTPartnerResolver.
+func JWTRoleResolver(claim string, mapping map[string]dm.Role, verify func(token string) error) RoleResolver {
+	if claim == "" {
+		claim = DefaultRoleClaim
+	}
+	return func(r *http.Request) (dm.Role, error) {
+		claims, err := bearerClaims(r, verify)
+		if err != nil {
+			return dm.RoleNone, err
+		}
+		best := dm.RoleNone
+		for _, v := range claimStrings(claims, claim) {
+			role, ok := mapping[v]
+			if mapping == nil {
+				role, ok = dm.ParseRole(v)
+			}
+			if ok && role > best {
+				best = role
+			}
+		}
+		return best, nil
+	}
+}
+
+// DefaultActorClaim is the JWT claim naming the caller in audit records when none is configured.
+const DefaultActorClaim = "sub"
+
+// ActorResolver names the caller of a request for audit records; "" when unknown.
+type ActorResolver func(r *http.Request) string
+
+// JWTActorResolver names callers by a claim of their bearer token (DefaultActorClaim when empty),
+// verified as for JWTRoleResolver.
+func JWTActorResolver(claim string, verify func(token string) error) ActorResolver {
+	if claim == "" {
+		claim = DefaultActorClaim
+	}
+	return func(r *http.Request) string {
+		claims, err := bearerClaims(r, verify)
+		if err != nil {
+			return ""
+		}
+		if v := claimStrings(claims, claim); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+}
+
+// Authorizer enforces role requirements on handlers.
+type Authorizer struct {
+	Resolve RoleResolver
+	Policy  AuthzPolicy   // optional; defaults to DefaultAuthzPolicy
+	Actor   ActorResolver // optional; names callers in audit records and operation history
+}
+
+// Require wraps next so it only runs for callers satisfying the required role. A nil Authorizer
+// disables enforcement (single-user / development deployments). The resolved role, and the actor
+// when Actor names one, are stored on the request context for downstream checks and audit records.
+func (a *Authorizer) Require(required dm.Role, next http.Handler) http.Handler {
+	if a == nil || a.Resolve == nil {
+		return next
+	}
+	policy := a.Policy
+	if policy == nil {
+		policy = DefaultAuthzPolicy
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		role, err := a.Resolve(r)
+		if err != nil {
+			writeCORS(w, r)
+			writeProblem(w, http.StatusUnauthorized, CodeUnauthenticated, err)
+			return
+		}
+		if err := policy(r, role, required); err != nil {
+			writeCORS(w, r)
+			writeProblem(w, http.StatusForbidden, dm.CodeAccessDenied, err)
+			return
+		}
+		ctx := dm.WithRole(r.Context(), role)
+		if a.Actor != nil {
+			if actor := a.Actor(r); actor != "" {
+				ctx = dm.WithActor(ctx, actor)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,80 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+func TestAuthorizerParamsRoutes(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPatch:
+			_ = json.NewEncoder(w).Encode(map[string]any{"parameters": map[string]any{"Device.X": map[string]any{}}})
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]any{"parameters": map[string]any{"Device.X": map[string]any{"value": "v"}}})
+		}
+	}))
+	defer backend.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = backend.URL
+	opts.Tr1d1umBaseURL = backend.URL
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+
+	authz := &Authorizer{Resolve: JWTRoleResolver("", map[string]dm.Role{"noc": dm.RoleViewer, "ops": dm.RoleOperator}, testVerify), Actor: JWTActorResolver("", testVerify)}
+	var seenRole dm.Role
+	var seenActor string
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/devices/{id}/params", authz.Require(dm.RoleViewer, GetParamsHandler(m)))
+	mux.Handle("PATCH /api/devices/{id}/params", authz.Require(dm.RoleOperator, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenRole, _ = dm.RoleFromContext(r.Context())
+		seenActor = dm.ActorFromContext(r.Context())
+		SetParamsHandler(m)(w, r)
+	})))
+
+	cases := []struct {
+		method string
+		groups []string
+		code   int
+	}{
+		{http.MethodGet, []string{"noc"}, http.StatusOK},
+		{http.MethodPatch, []string{"noc"}, http.StatusForbidden},
+		{http.MethodPatch, []string{"noc", "ops"}, http.StatusOK},
+		{http.MethodGet, []string{"unmapped"}, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		var body *strings.Reader
+		target := "/api/devices/mac:aabbccddeeff/params"
+		if c.method == http.MethodPatch {
+			body = strings.NewReader(`{"parameters":[{"name":"Device.X","value":"v"}]}`)
+		} else {
+			body = strings.NewReader("")
+			target += "?names=Device.X"
+		}
+		req := httptest.NewRequest(c.method, target, body).WithContext(context.Background())
+		req.Header.Set("Authorization", bearer(map[string]any{"roles": c.groups, "sub": "alice"}))
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != c.code {
+			t.Fatalf("%s as %v: expected %d got %d (%s)", c.method, c.groups, c.code, rr.Code, rr.Body.String())
+		}
+	}
+	if seenRole != dm.RoleOperator || seenActor != "alice" {
+		t.Fatalf("expected operator alice on context, got %v %q", seenRole, seenActor)
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/devices/mac:aabbccddeeff/params?names=Device.X", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rr.Code)
+	}
+}
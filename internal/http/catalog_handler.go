@@ -0,0 +1,69 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+	"github.com/xmidt-org/talaria/devicemgr/policy"
+)
+
+// ListCatalogHandler serves GET /api/catalog/{kind}, kind being environments, models or partners.
+func ListCatalogHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		kind, err := policy.ParseCatalogKind(r.PathValue("kind"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		list, err := m.Catalog(r.Context(), kind)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{string(kind): list})
+	}
+}
+
+// CreateCatalogEntryHandler serves POST /api/catalog/{kind} {"id":"PROD","description":"..."},
+// answering 201 with the entry as xconf stored it.
+func CreateCatalogEntryHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		kind, err := policy.ParseCatalogKind(r.PathValue("kind"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		var e policy.CatalogEntry
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		saved, err := m.CreateCatalogEntry(r.Context(), kind, e)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, saved)
+	}
+}
+
+// DeleteCatalogEntryHandler serves DELETE /api/catalog/{kind}/{id}.
+func DeleteCatalogEntryHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		kind, err := policy.ParseCatalogKind(r.PathValue("kind"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := m.DeleteCatalogEntry(r.Context(), kind, r.PathValue("id")); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,67 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var errNoBearer = errors.New("bearer token required")
+
+// bearerClaims decodes the claims of the request's bearer JWT once verify (see NewJWTVerifier)
+// accepts the raw token. A nil verify fails closed: claims are never read from an unverified token.
+func bearerClaims(r *http.Request, verify func(token string) error) (map[string]interface{}, error) {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return nil, errNoBearer
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	if verify == nil {
+		return nil, errNoVerifier
+	}
+	if err := verify(token); err != nil {
+		return nil, err
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed bearer token")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed token payload")
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+	return claims, nil
+}
+
+// claimStrings resolves a dotted claim path to its string values (a string or array of strings).
+func claimStrings(claims map[string]interface{}, path string) []string {
+	var cur interface{} = claims
+	for _, seg := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = obj[seg]
+	}
+	switch v := cur.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		var out []string
+		for _, e := range v {
+			if s, ok := e.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
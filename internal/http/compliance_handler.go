@@ -0,0 +1,57 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/compliance"
+)
+
+// FirmwareComplianceHandler serves GET /api/reports/firmware-compliance[?live=true&status=out-of-date&format=csv]:
+// fleet and per-model counts of compliant, out-of-date and unknown devices within the caller's
+// partner scope, with the per-device details. status (repeatable) limits the details, details=false
+// leaves them out, and format=csv downloads them as an attachment instead.
+func FirmwareComplianceHandler(m compliance.Devices) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		q := r.URL.Query()
+		var opts compliance.Options
+		if v := q.Get("live"); v != "" {
+			live, err := strconv.ParseBool(v)
+			if err != nil {
+				writeError(w, fmt.Errorf("live: %w", dm.ErrInvalidParameter))
+				return
+			}
+			opts.Live = live
+		}
+		for _, s := range q["status"] {
+			if s != compliance.StatusCompliant && s != compliance.StatusOutOfDate && s != compliance.StatusUnknown {
+				writeError(w, fmt.Errorf("unknown status %q: %w", s, dm.ErrInvalidParameter))
+				return
+			}
+		}
+		format := q.Get("format")
+		if format != "" && format != "json" && format != "csv" {
+			writeError(w, fmt.Errorf("unknown format %q: %w", format, dm.ErrInvalidParameter))
+			return
+		}
+		report, err := compliance.Build(r.Context(), m, opts)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		report.Filter(q["status"]...)
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="firmware-compliance.csv"`)
+			_ = report.WriteCSV(w)
+			return
+		}
+		if q.Get("details") == "false" {
+			report.Details = nil
+		}
+		writeJSON(w, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,15 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// DumpHandler serves GET /debug/dump: goroutine and memory counts, the outcome of the latest poll
+// and the open watches, event subscriptions and device connections (manager.RuntimeDump).
+func DumpHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.Dump())
+	}
+}
@@ -0,0 +1,54 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+func TestDumpHandler(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"parameters": map[string]any{"Device.X": map[string]any{}}})
+	}))
+	defer backend.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = backend.URL
+	opts.Tr1d1umBaseURL = backend.URL
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	defer m.Close()
+	w, err := m.ParamWatch(context.Background(), "mac:aabbccddeeff", []string{"Device.X"})
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	defer w.Close()
+
+	authz := &Authorizer{Resolve: JWTRoleResolver("", nil, testVerify)}
+	h := authz.Require(dm.RoleAdmin, DumpHandler(m))
+	for role, code := range map[string]int{"operator": http.StatusForbidden, "admin": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodGet, "/debug/dump", nil)
+		req.Header.Set("Authorization", bearer(map[string]any{"roles": role}))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != code {
+			t.Fatalf("%s: expected %d got %d (%s)", role, code, rr.Code, rr.Body.String())
+		}
+		if code != http.StatusOK {
+			continue
+		}
+		var dump manager.RuntimeDump
+		if err := json.Unmarshal(rr.Body.Bytes(), &dump); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if dump.Goroutines == 0 || dump.ParamWatches["mac:aabbccddeeff"] != 1 || dump.EventSubscribers == 0 {
+			t.Fatalf("dump: %+v", dump)
+		}
+	}
+}
@@ -2,9 +2,14 @@ package httpapi
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"slices"
+	"sync/atomic"
 	"time"
 
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
 	"github.com/xmidt-org/talaria/devicemgr/runtime"
 )
 
@@ -14,30 +19,139 @@ type DeviceInfo struct {
 	ID       string    `json:"id"`
 	Online   bool      `json:"online"`
 	LastSeen time.Time `json:"lastSeen,omitempty"`
+	// Annotations are the operator's notes, tickets and labels (AnnotatedDevicesHandler only).
+	Annotations *annotation.Annotations `json:"annotations,omitempty"`
+	// Quarantine is the quarantine in force on the device, if any (AnnotatedDevicesHandler only).
+	Quarantine *dm.Quarantine `json:"quarantine,omitempty"`
 }
 
-// DevicesHandler builds an HTTP handler serving current devices snapshot.
+// DevicesHandler builds an HTTP handler serving current devices snapshot. The list is streamed
+// rather than built in memory; with "Accept: application/x-ndjson" each device is written as a line
+// of its own, without the count and lastPoll envelope. When the request is partner-scoped (see
+// PartnerScope) only the caller's devices are listed. A "query" parameter such as
+// "model:XB7 firmware:1.2*" (see runtime.ParseDeviceQuery) lists only matching devices, answered
+// from the adapter's search index.
 func DevicesHandler(adapter *runtime.DeviceAdapter) http.HandlerFunc {
+	return AnnotatedDevicesHandler(adapter, nil, nil)
+}
+
+// AnnotatedDevicesHandler is DevicesHandler listing each device's annotations from notes, which
+// also answers "label.<key>:<value>" query terms, and the quarantine quarantined reports for it
+// (such as manager.Manager.QuarantineOf). Nil notes and quarantined behave as DevicesHandler.
+func AnnotatedDevicesHandler(adapter *runtime.DeviceAdapter, notes *annotation.Service, quarantined func(dm.DeviceID) *dm.Quarantine) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ids, last := adapter.Snapshot()
-		out := struct {
-			Devices  []DeviceInfo `json:"devices"`
-			Count    int          `json:"count"`
-			LastPoll time.Time    `json:"lastPoll"`
-		}{LastPoll: last}
-		out.Devices = make([]DeviceInfo, 0, len(ids))
-		for _, id := range ids {
-			out.Devices = append(out.Devices, DeviceInfo{ID: id, Online: true, LastSeen: last})
-		}
-		out.Count = len(out.Devices)
-		w.Header().Set("Content-Type", "application/json")
-		writeCORS(w)
-		json.NewEncoder(w).Encode(out)
+		sel, err := selectDevices(r, adapter, notes)
+		if err != nil {
+			writeCORS(w, r)
+			writeError(w, err)
+			return
+		}
+		last := sel.view.PolledAt()
+		ndjson := wantsNDJSON(r)
+		if ndjson {
+			w.Header().Set("Content-Type", ndjsonContentType)
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		writeCORS(w, r)
+		out := startArray(w, ndjson, `{"devices":`)
+		sel.each(func(id string, a *annotation.Annotations) bool {
+			info := DeviceInfo{ID: id, Online: true, LastSeen: last, Annotations: a}
+			if quarantined != nil {
+				info.Quarantine = quarantined(dm.DeviceID(id))
+			}
+			return out.Encode(info) == nil
+		})
+		lastPoll, _ := json.Marshal(last)
+		out.Close(fmt.Sprintf(`,"count":%d,"lastPoll":%s}`+"\n", out.Len(), lastPoll))
+	}
+}
+
+// deviceSelection is the devices a listing request selects with its query and partner scope.
+type deviceSelection struct {
+	view   *runtime.DeviceView
+	ids    []string
+	labels runtime.DeviceQuery
+	ann    map[dm.DeviceID]annotation.Annotations
+	scope  []string
+	scoped bool
+}
+
+// selectDevices resolves the request's "query" parameter against adapter's search index and the
+// labels of notes (optional).
+func selectDevices(r *http.Request, adapter *runtime.DeviceAdapter, notes *annotation.Service) (*deviceSelection, error) {
+	sel := &deviceSelection{view: adapter.View()}
+	sel.ids = sel.view.IDs()
+	sel.scope, sel.scoped = dm.PartnersFromContext(r.Context())
+	if raw := r.URL.Query().Get("query"); raw != "" {
+		q, err := runtime.ParseDeviceQuery(raw)
+		if err != nil {
+			return nil, err
+		}
+		var index runtime.DeviceQuery
+		index, sel.labels = annotation.SplitQuery(q)
+		if len(sel.labels) > 0 && notes == nil {
+			return nil, fmt.Errorf("label terms need annotations: %w", dm.ErrInvalidParameter)
+		}
+		if len(index) > 0 {
+			if sel.ids, err = adapter.Search(index); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if notes != nil {
+		var err error
+		if sel.ann, err = notes.All(r.Context()); err != nil {
+			return nil, err
+		}
 	}
+	return sel, nil
 }
 
-func writeCORS(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+// each calls fn for every selected device in ID order, with its annotations (nil when none),
+// until fn returns false.
+func (s *deviceSelection) each(fn func(id string, a *annotation.Annotations) bool) {
+	for _, id := range s.ids {
+		if s.scoped && !dm.PartnerAllowed(s.scope, dm.SplitPartners(s.view.Metadata(id)[dm.MetadataPartnerIDs])) {
+			continue
+		}
+		a, annotated := s.ann[dm.DeviceID(id)]
+		if len(s.labels) > 0 && !(annotated && a.Match(s.labels)) {
+			continue
+		}
+		var ap *annotation.Annotations
+		if annotated {
+			ap = &a
+		}
+		if !fn(id, ap) {
+			return
+		}
+	}
+}
+
+// allowedOrigins holds the origins set by SetAllowedOrigins; nil allows any.
+var allowedOrigins atomic.Pointer[[]string]
+
+// SetAllowedOrigins restricts the browser origins the API answers CORS requests from. Empty, or
+// a list containing "*", allows any origin. It may be called while serving, e.g. on config reload.
+func SetAllowedOrigins(origins []string) {
+	if len(origins) == 0 || slices.Contains(origins, "*") {
+		allowedOrigins.Store(nil)
+		return
+	}
+	origins = slices.Clone(origins)
+	allowedOrigins.Store(&origins)
+}
+
+func writeCORS(w http.ResponseWriter, r *http.Request) {
+	if allowed := allowedOrigins.Load(); allowed == nil {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Add("Vary", "Origin")
+		if origin := r.Header.Get("Origin"); origin != "" && slices.Contains(*allowed, origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+	}
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key, "+LockOwnerHeader)
 }
@@ -0,0 +1,46 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// Budgets for these benchmarks are listed in docs/performance.md.
+
+// discardResponse is a ResponseWriter that drops the body, so only the handler is measured.
+type discardResponse struct{ h http.Header }
+
+func (d *discardResponse) Header() http.Header         { return d.h }
+func (d *discardResponse) Write(p []byte) (int, error) { return io.Discard.Write(p) }
+func (d *discardResponse) WriteHeader(int)             {}
+
+// BenchmarkDevicesHandler measures serving a 10k-device snapshot.
+func BenchmarkDevicesHandler(b *testing.B) {
+	body := []byte(`{"devices":[`)
+	for i := 0; i < 10000; i++ {
+		if i > 0 {
+			body = append(body, ',')
+		}
+		body = append(body, fmt.Sprintf(`"mac:%012x"`, i)...)
+	}
+	body = append(body, "]}"...)
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(body) }))
+	defer talaria.Close()
+	da := runtime.NewDeviceAdapter(talaria.URL, nil)
+	if _, err := da.PollOnce(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+	h := DevicesHandler(da)
+	req := httptest.NewRequest("GET", "/api/devices", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h(&discardResponse{h: http.Header{}}, req)
+	}
+}
@@ -1,7 +1,11 @@
 package httpapi
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -48,3 +52,100 @@ func TestDevicesHandlerWithDevices(t *testing.T) {
 	// simulate update by calling private style: rely on poll not feasible, so skip deeper test
 	time.Sleep(10 * time.Millisecond)
 }
+
+func TestDevicesHandlerStreaming(t *testing.T) {
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"devices":["mac:2",{"id":"mac:1","partnerIDs":"comcast"},{"id":"mac:3","partnerIDs":"other"}]}`))
+	}))
+	defer talaria.Close()
+	da := runtime.NewDeviceAdapter(talaria.URL, nil)
+	if _, err := da.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	DevicesHandler(da)(rr, httptest.NewRequest("GET", "/api/devices", nil))
+	var out struct {
+		Devices  []DeviceInfo `json:"devices"`
+		Count    int          `json:"count"`
+		LastPoll time.Time    `json:"lastPoll"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatalf("%v: %s", err, rr.Body)
+	}
+	if out.Count != 3 || len(out.Devices) != 3 || out.Devices[0].ID != "mac:1" || out.LastPoll.IsZero() {
+		t.Fatalf("unexpected body %s", rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/devices", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	DevicesHandler(da)(rr, req.WithContext(dm.WithPartners(req.Context(), []string{"comcast"})))
+	lines := strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n")
+	if rr.Header().Get("Content-Type") != "application/x-ndjson" || len(lines) != 1 || !strings.Contains(lines[0], `"id":"mac:1"`) {
+		t.Fatalf("unexpected ndjson %q", rr.Body)
+	}
+}
+
+func TestAllowedOrigins(t *testing.T) {
+	defer SetAllowedOrigins(nil)
+	da := runtime.NewDeviceAdapter("http://example", dm.StaticAuth{Value: "Basic a"})
+	origin := func(from string) string {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/devices", nil)
+		req.Header.Set("Origin", from)
+		DevicesHandler(da)(rr, req)
+		return rr.Header().Get("Access-Control-Allow-Origin")
+	}
+	if got := origin("https://any.example"); got != "*" {
+		t.Fatalf("default allows %q", got)
+	}
+	SetAllowedOrigins([]string{"https://ui.example"})
+	if got := origin("https://ui.example"); got != "https://ui.example" {
+		t.Fatalf("allowed origin got %q", got)
+	}
+	if got := origin("https://other.example"); got != "" {
+		t.Fatalf("other origin got %q", got)
+	}
+}
+
+func TestDevicesHandlerQuery(t *testing.T) {
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"devices":[{"id":"mac:000000000001","hw-model":"XB7","fw-name":"1.2.3","partnerIDs":"comcast"},` +
+			`{"id":"mac:000000000002","hw-model":"XB7","fw-name":"1.3.0","partnerIDs":"other"},{"id":"mac:000000000003","hw-model":"XB6"}]}`))
+	}))
+	defer talaria.Close()
+	da := runtime.NewDeviceAdapter(talaria.URL, nil)
+	if _, err := da.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	list := func(query string, partners ...string) (int, []string) {
+		req := httptest.NewRequest("GET", "/api/devices?query="+query, nil)
+		if partners != nil {
+			req = req.WithContext(dm.WithPartners(req.Context(), partners))
+		}
+		rr := httptest.NewRecorder()
+		DevicesHandler(da)(rr, req)
+		var out struct {
+			Devices []DeviceInfo `json:"devices"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &out)
+		var ids []string
+		for _, d := range out.Devices {
+			ids = append(ids, d.ID)
+		}
+		return rr.Code, ids
+	}
+	if code, ids := list("model:XB7"); code != 200 || len(ids) != 2 {
+		t.Fatalf("model:XB7 got %d %v", code, ids)
+	}
+	if code, ids := list("model:XB7+firmware:1.2*"); code != 200 || len(ids) != 1 || ids[0] != "mac:000000000001" {
+		t.Fatalf("model and firmware got %d %v", code, ids)
+	}
+	if code, ids := list("model:XB7", "other"); code != 200 || len(ids) != 1 || ids[0] != "mac:000000000002" {
+		t.Fatalf("scoped got %d %v", code, ids)
+	}
+	if code, _ := list("XB7"); code != http.StatusBadRequest {
+		t.Fatalf("bad query got %d", code)
+	}
+}
@@ -0,0 +1,76 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/diagnostics"
+)
+
+// DiagnosticsHandler serves POST /api/devices/{id}/diagnostics/{kind} (speedtest, traceroute or
+// wifiscan) with the kind's request as the optional JSON body. The response is the normalized
+// result; with "Accept: text/event-stream" it is instead an SSE stream of "progress" events ended
+// by one "result" or "error" event. A run named with the CallHeader can be canceled with
+// DELETE /api/devices/{id}/rpc/{call}.
+func DiagnosticsHandler(runner *diagnostics.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		kind, err := diagnostics.ParseKind(r.PathValue("kind"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		params, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		if len(strings.TrimSpace(string(params))) == 0 {
+			params = nil
+		}
+		// diagnostics outlive the server's write timeout
+		rc := http.NewResponseController(w)
+		_ = rc.SetWriteDeadline(time.Time{})
+		ctx := callContext(r)
+		if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			res, err := runner.Run(ctx, id, kind, params, nil)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, res)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		var mu sync.Mutex // progress arrives on the caller's notification goroutine
+		send := func(event string, v interface{}) {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+			_ = rc.Flush()
+		}
+		res, err := runner.Run(ctx, id, kind, params, func(p diagnostics.Progress) { send("progress", p) })
+		if err != nil {
+			send("error", map[string]string{"error": err.Error(), "code": dm.ErrorCode(err)})
+			return
+		}
+		send("result", res)
+	}
+}
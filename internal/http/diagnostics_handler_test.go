@@ -0,0 +1,101 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/diagnostics"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// fakeDiagnosticsGateway answers diagnostic RPCs the way a Blizzard-connected device would: two
+// progress notifications, then the result.
+func fakeDiagnosticsGateway(t *testing.T) *httptest.Server {
+	results := map[string]string{
+		"diagnostics.speedtest": `{"download_kbps":93200,"upload_kbps":11800,"ping":12.5,"server":"speed.example.net"}`,
+		"diagnostics.wifiscan":  `{"result":{"aps":[{"ssid":"weak","rssi":-80,"freq":2437},{"ssid":"strong","rssi":-40,"channel":36}]}}`,
+	}
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer c.Close()
+		for {
+			var req struct {
+				ID     string `json:"id"`
+				Method string `json:"method"`
+			}
+			if err := c.ReadJSON(&req); err != nil {
+				return
+			}
+			for _, pct := range []int{50, 100} {
+				c.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "method": "diagnostics.progress", "params": map[string]interface{}{"percent": pct, "stage": "download"}})
+			}
+			c.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":"`+req.ID+`","result":`+results[req.Method]+`}`))
+		}
+	}))
+}
+
+func TestDiagnosticsHandler(t *testing.T) {
+	gw := fakeDiagnosticsGateway(t)
+	defer gw.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = "http://talaria.invalid"
+	opts.BlizzardBaseURL = "ws" + strings.TrimPrefix(gw.URL, "http")
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/devices/{id}/diagnostics/{kind}", DiagnosticsHandler(diagnostics.NewRunner(m, diagnostics.Config{})))
+
+	// synchronous: normalized result, strongest network first
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("POST", "/api/devices/mac:112233445566/diagnostics/wifiscan", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("wifiscan: %d %s", rec.Code, rec.Body)
+	}
+	var res diagnostics.Result
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.WiFiScan == nil || len(res.WiFiScan.Networks) != 2 || res.WiFiScan.Networks[0].SSID != "strong" || res.WiFiScan.Networks[1].Band != "2.4GHz" {
+		t.Fatalf("unexpected result %s", rec.Body)
+	}
+
+	// streaming: progress events, then the result
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/devices/mac:112233445566/diagnostics/speedtest", strings.NewReader(`{"server":"speed.example.net"}`))
+	req.Header.Set("Accept", "text/event-stream")
+	mux.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	if rec.Header().Get("Content-Type") != "text/event-stream" || strings.Count(body, "event: progress\n") != 2 {
+		t.Fatalf("unexpected stream %q", body)
+	}
+	i := strings.Index(body, "event: result\ndata: ")
+	if i < 0 {
+		t.Fatalf("no result event in %q", body)
+	}
+	res = diagnostics.Result{}
+	if err := json.Unmarshal([]byte(strings.SplitN(body[i+len("event: result\ndata: "):], "\n", 2)[0]), &res); err != nil {
+		t.Fatal(err)
+	}
+	if st := res.SpeedTest; st == nil || st.DownloadMbps != 93.2 || st.UploadMbps != 11.8 || st.LatencyMs != 12.5 {
+		t.Fatalf("unexpected speed test %+v", res.SpeedTest)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("POST", "/api/devices/mac:112233445566/diagnostics/nslookup", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown kind: %d", rec.Code)
+	}
+}
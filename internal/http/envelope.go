@@ -0,0 +1,271 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// APIVersion is the version of the routes under /api/v1.
+const APIVersion = "v1"
+
+// LegacyMode selects how Versioned serves the unversioned /api routes.
+type LegacyMode string
+
+const (
+	LegacyServe      LegacyMode = ""           // as before, without the envelope
+	LegacyDeprecated LegacyMode = "deprecated" // as before, with Deprecation and successor Link headers
+	LegacyOff        LegacyMode = "off"        // 410 Gone, naming the /api/v1 path
+)
+
+// Envelope is the body of every JSON response under /api/v1: the legacy route's body as Data, or
+// its error as Error.
+type Envelope struct {
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error *EnvelopeError  `json:"error,omitempty"`
+	Meta  EnvelopeMeta    `json:"meta"`
+}
+
+// EnvelopeError describes a failed request from its Problem. Details carries the Problem's
+// members beyond the standard ones, such as the holder of a device for a 409.
+type EnvelopeError struct {
+	Status  int                        `json:"status"`
+	Code    string                     `json:"code,omitempty"`
+	Message string                     `json:"message"`
+	Details map[string]json.RawMessage `json:"details,omitempty"`
+}
+
+// EnvelopeMeta describes a response. Pagination repeats a list's count, cursor and more fields.
+type EnvelopeMeta struct {
+	Version    string      `json:"version"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// Pagination is the paging state of a list response.
+type Pagination struct {
+	Count  *int   `json:"count,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+	More   bool   `json:"more,omitempty"`
+}
+
+// ParseLegacyMode reads a LegacyMode name: "" (or "serve"), "deprecated" or "off".
+func ParseLegacyMode(s string) (LegacyMode, error) {
+	switch m := LegacyMode(s); m {
+	case LegacyServe, LegacyDeprecated, LegacyOff:
+		return m, nil
+	case "serve":
+		return LegacyServe, nil
+	}
+	return "", fmt.Errorf("legacy API mode %q: want serve, deprecated or off: %w", s, dm.ErrInvalidParameter)
+}
+
+type versionKey struct{}
+
+// Versioned serves next's /api routes under /api/v1 too, with every JSON response in an Envelope.
+// Streams and other bodies that are not JSON (events, NDJSON, exports, artifacts), bodiless
+// responses and /api/v1/graphql, which has its own envelope, are passed through unchanged. legacy
+// selects what becomes of the unversioned paths.
+func Versioned(legacy LegacyMode, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, "/api/"+APIVersion+"/")
+		if !ok {
+			if rest, ok := strings.CutPrefix(r.URL.Path, "/api/"); ok {
+				successor := apiPath(r, "/api/"+APIVersion+"/"+rest)
+				switch legacy {
+				case LegacyDeprecated:
+					w.Header().Set("Deprecation", "true")
+					w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+				case LegacyOff:
+					writeCORS(w, r)
+					writeProblem(w, http.StatusGone, CodeRouteRetired, errors.New("unversioned API routes are retired; use "+successor))
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		v := r.Clone(context.WithValue(r.Context(), versionKey{}, APIVersion))
+		v.URL.Path = "/api/" + rest
+		v.URL.RawPath = ""
+		if rest == "graphql" {
+			next.ServeHTTP(w, v)
+			return
+		}
+		ew := &envelopeWriter{w: w}
+		next.ServeHTTP(ew, v)
+		ew.finish()
+	})
+}
+
+// envelopeWriter wraps a JSON response in an Envelope: successes are streamed into its data
+// while their paging fields are picked out, and errors are buffered to restructure them. Other
+// responses pass through.
+type envelopeWriter struct {
+	w      http.ResponseWriter
+	status int
+	mode   int
+	body   bytes.Buffer   // an error's body
+	wrote  bool           // a success's body was started
+	pw     *io.PipeWriter // feeds scanPagination
+	paging chan *Pagination
+}
+
+const (
+	modeUndecided = iota
+	modePass
+	modeStream
+	modeBuffer
+)
+
+func (e *envelopeWriter) Header() http.Header { return e.w.Header() }
+
+func (e *envelopeWriter) WriteHeader(status int) {
+	if e.mode != modeUndecided {
+		return
+	}
+	e.status = status
+	switch {
+	case !isJSON(e.w.Header().Get("Content-Type")), status == http.StatusNoContent, status == http.StatusNotModified:
+		e.mode = modePass
+	case status >= http.StatusBadRequest:
+		e.mode = modeBuffer
+		return
+	default:
+		e.mode = modeStream
+		e.w.Header().Del("Content-Length")
+		var pr *io.PipeReader
+		pr, e.pw = io.Pipe()
+		e.paging = make(chan *Pagination, 1)
+		go func() { e.paging <- scanPagination(pr) }()
+	}
+	e.w.WriteHeader(status)
+}
+
+func (e *envelopeWriter) Write(b []byte) (int, error) {
+	e.WriteHeader(http.StatusOK)
+	switch e.mode {
+	case modeBuffer:
+		return e.body.Write(b)
+	case modeStream:
+		if !e.wrote {
+			e.wrote = true
+			if _, err := io.WriteString(e.w, `{"data":`); err != nil {
+				return 0, err
+			}
+		}
+		_, _ = e.pw.Write(b)
+	}
+	return e.w.Write(b)
+}
+
+func (e *envelopeWriter) Flush() {
+	if f, ok := e.w.(http.Flusher); ok && (e.mode == modePass || e.mode == modeStream) {
+		f.Flush()
+	}
+}
+
+func (e *envelopeWriter) Unwrap() http.ResponseWriter { return e.w }
+
+// finish completes the Envelope.
+func (e *envelopeWriter) finish() {
+	meta := EnvelopeMeta{Version: APIVersion}
+	switch e.mode {
+	case modeStream:
+		if !e.wrote {
+			_, _ = io.WriteString(e.w, `{"data":null`)
+		}
+		e.pw.Close()
+		meta.Pagination = <-e.paging
+		b, _ := json.Marshal(meta)
+		_, _ = fmt.Fprintf(e.w, ",\"meta\":%s}\n", b)
+	case modeBuffer:
+		env := Envelope{Error: &EnvelopeError{Status: e.status, Message: http.StatusText(e.status)}, Meta: meta}
+		var fields map[string]json.RawMessage
+		_ = json.Unmarshal(e.body.Bytes(), &fields) // nil unless the body is an object
+		if msg, ok := fields["error"]; ok {
+			_ = json.Unmarshal(msg, &env.Error.Message)
+		}
+		if code, ok := fields["code"]; ok {
+			_ = json.Unmarshal(code, &env.Error.Code)
+		}
+		for _, member := range []string{"type", "title", "status", "detail", "code", "error"} {
+			delete(fields, member)
+		}
+		if len(fields) > 0 {
+			env.Error.Details = fields
+		}
+		e.w.Header().Del("Content-Length")
+		writeJSON(e.w, e.status, env)
+	}
+}
+
+func isJSON(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, ProblemContentType)
+}
+
+// scanPagination reads the top-level count, cursor and more fields of a JSON object without
+// holding the rest of it, nil when it has none. It drains r.
+func scanPagination(r *io.PipeReader) *Pagination {
+	defer io.Copy(io.Discard, r)
+	dec := json.NewDecoder(r)
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil
+	}
+	var p Pagination
+	found := false
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		var dst interface{}
+		switch key {
+		case "count":
+			dst = &p.Count
+		case "cursor":
+			dst = &p.Cursor
+		case "more":
+			dst = &p.More
+		}
+		if dst != nil {
+			if dec.Decode(dst) == nil {
+				found = true
+			}
+			continue
+		}
+		if skipValue(dec) != nil {
+			return nil
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &p
+}
+
+// skipValue reads past the next JSON value token by token.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
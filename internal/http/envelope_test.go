@@ -0,0 +1,78 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestVersioned(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/things", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", apiPath(r, "/api/things/1"))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"things": []string{"a", "b"}, "count": 2, "cursor": "c2", "more": true})
+	})
+	mux.HandleFunc("GET /api/things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, &dm.OperationConflictError{DeviceID: "mac:aa", Requested: dm.OperationReboot, Holder: dm.DeviceOperation{Kind: dm.OperationLogUpload, StartedAt: time.Now()}})
+	})
+	mux.HandleFunc("GET /api/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ndjsonContentType)
+		fmt.Fprintln(w, `{"id":"mac:aa"}`)
+	})
+	get := func(h http.Handler, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	h := MountAt("/dm", Versioned(LegacyServe, mux))
+
+	rec := get(h, "/dm/api/v1/things")
+	var list struct {
+		Data struct {
+			Things []string `json:"things"`
+		} `json:"data"`
+		Meta EnvelopeMeta `json:"meta"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("list %d %s: %v", rec.Code, rec.Body, err)
+	}
+	if p := list.Meta.Pagination; len(list.Data.Things) != 2 || list.Meta.Version != "v1" || p == nil || *p.Count != 2 || p.Cursor != "c2" || !p.More {
+		t.Fatalf("list %s", rec.Body)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/dm/api/v1/things/1" {
+		t.Fatalf("location %s", loc)
+	}
+
+	rec = get(h, "/dm/api/v1/things/1")
+	var failed Envelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &failed); err != nil || rec.Code != http.StatusConflict || failed.Data != nil {
+		t.Fatalf("error %d %s: %v", rec.Code, rec.Body, err)
+	}
+	if e := failed.Error; e.Status != http.StatusConflict || e.Code != dm.CodeOperationConflict || !strings.Contains(e.Message, "log-upload") || len(e.Details) != 1 || e.Details["holder"] == nil {
+		t.Fatalf("error %+v", e)
+	}
+
+	if rec = get(h, "/dm/api/v1/stream"); rec.Body.String() != "{\"id\":\"mac:aa\"}\n" {
+		t.Fatalf("stream %q", rec.Body)
+	}
+	if rec = get(h, "/dm/api/things"); strings.Contains(rec.Body.String(), `"data"`) || rec.Header().Get("Deprecation") != "" {
+		t.Fatalf("legacy %s", rec.Body)
+	}
+
+	rec = get(Versioned(LegacyDeprecated, mux), "/api/things")
+	if rec.Code != http.StatusOK || rec.Header().Get("Deprecation") != "true" || rec.Header().Get("Link") != `</api/v1/things>; rel="successor-version"` {
+		t.Fatalf("deprecated %d %v", rec.Code, rec.Header())
+	}
+	if rec = get(Versioned(LegacyOff, mux), "/api/things"); rec.Code != http.StatusGone || !strings.Contains(rec.Body.String(), "/api/v1/things") {
+		t.Fatalf("off %d %s", rec.Code, rec.Body)
+	}
+	if _, err := ParseLegacyMode("retired"); err == nil {
+		t.Fatal("unknown legacy mode accepted")
+	}
+}
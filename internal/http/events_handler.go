@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// EventsHeartbeat is the interval of SSE comment lines that keep idle connections open through proxies.
+var EventsHeartbeat = 15 * time.Second
+
+// EventSource supplies the events streamed by EventsHandler (a DeviceAdapter or a Manager, which
+// also carries MQTT-bridged events).
+type EventSource interface {
+	Subscribe(buffer int) dm.EventSubscription
+}
+
+// EventsHandler streams device events from source as Server-Sent Events (GET /api/events?kind=a,b&device=x,y).
+// Each event is sent with its kind as the SSE event name and the JSON encoding as data. Partner-scoped
+// callers only receive events for their devices, as known to adapter.
+//
+// With sign=<key ID> naming one of keys, each frame also carries a "signature:" field, before its
+// data, with events.SignTimestamped of the data under that key; clients verify it with
+// events.Verify. SSE clients ignore fields they do not know.
+func EventsHandler(adapter *runtime.DeviceAdapter, source EventSource, keys map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		filter := events.ParseFilter(r.URL.Query().Get("kind"), r.URL.Query().Get("device"))
+		var key string
+		if id := r.URL.Query().Get("sign"); id != "" {
+			k, ok := keys[id]
+			if !ok {
+				writeError(w, fmt.Errorf("unknown signing key %q: %w", id, dm.ErrInvalidParameter))
+				return
+			}
+			key = k
+		}
+		scope, scoped := dm.PartnersFromContext(r.Context())
+		rc := http.NewResponseController(w)
+		// streams outlive the server's write timeout
+		_ = rc.SetWriteDeadline(time.Time{})
+
+		sub := source.Subscribe(64)
+		defer sub.Close()
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		heartbeat := time.NewTicker(EventsHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			case e, ok := <-sub.C():
+				if !ok {
+					return
+				}
+				if !filter.Match(e) {
+					continue
+				}
+				if scoped && !dm.PartnerAllowed(scope, dm.SplitPartners(adapter.View().Metadata(string(e.DeviceID))[dm.MetadataPartnerIDs])) {
+					continue
+				}
+				data, err := events.JSONEncoder{}.Encode(e)
+				if err != nil {
+					continue
+				}
+				if key != "" {
+					fmt.Fprintf(w, "event: %s\nsignature: %s\ndata: %s\n\n", e.Kind, events.SignTimestamped(key, time.Now(), data), data)
+				} else {
+					fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Kind, data)
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// EventSchemaHandler serves GET /api/events/schema: the JSON Schema of the event encoding used by
+// every event transport (events.Schema).
+func EventSchemaHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		w.Header().Set("Content-Type", "application/schema+json")
+		_, _ = w.Write(events.Schema())
+	}
+}
@@ -0,0 +1,82 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/talaria/devicemgr/events"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+func TestEventsHandlerStreamsFilteredEvents(t *testing.T) {
+	var devices atomic.Value
+	devices.Store([]string{"mac:aa"})
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"devices": devices.Load()})
+	}))
+	defer talaria.Close()
+	da := runtime.NewDeviceAdapter(talaria.URL, nil)
+	if _, err := da.PollOnce(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	srv := httptest.NewServer(EventsHandler(da, da, map[string]string{"ops": "k1"}))
+	defer srv.Close()
+	if resp, err := http.Get(srv.URL + "?sign=other"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown signing key: %v %v", resp.Status, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?kind=offline&sign=ops", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content-type = %q", ct)
+	}
+
+	// mac:bb comes online (filtered out), mac:aa goes suspect (filtered out) and, missing from a
+	// second poll, offline
+	devices.Store([]string{"mac:bb"})
+	for i := 0; i < 2; i++ {
+		if _, err := da.PollOnce(context.Background()); err != nil {
+			t.Fatalf("poll: %v", err)
+		}
+	}
+	sc := bufio.NewScanner(resp.Body)
+	var name, sig string
+	for sc.Scan() {
+		line := sc.Text()
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			name = v
+			continue
+		}
+		if v, ok := strings.CutPrefix(line, "signature: "); ok {
+			sig = v
+			continue
+		}
+		if v, ok := strings.CutPrefix(line, "data: "); ok {
+			if err := events.Verify("k1", sig, []byte(v), 0, time.Now()); err != nil {
+				t.Fatalf("signature %q: %v", sig, err)
+			}
+			e, err := events.DecodeJSON([]byte(v))
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if name != "offline" || e.DeviceID != "mac:aa" {
+				t.Fatalf("unexpected event %s %+v", name, e)
+			}
+			return
+		}
+	}
+	t.Fatalf("stream ended without event: %v", sc.Err())
+}
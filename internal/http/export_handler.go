@@ -0,0 +1,50 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/inventory"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// ExportDevicesHandler serves GET /api/devices/export?format=csv|jsonl&fields=id,model,...,
+// streaming the devices GET /api/devices would list (honouring "query" and partner scope) as an
+// attachment. format defaults to csv and fields to inventory.DefaultFields; notes (optional)
+// supplies tickets and labels.
+func ExportDevicesHandler(adapter *runtime.DeviceAdapter, notes *annotation.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = inventory.FormatCSV
+		}
+		fields, err := inventory.ParseFields(r.URL.Query().Get("fields"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		sel, err := selectDevices(r, adapter, notes)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		out, err := inventory.NewWriter(w, format, fields)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", inventory.ContentType(format))
+		w.Header().Set("Content-Disposition", `attachment; filename="devices.`+format+`"`)
+		lastSeen := sel.view.PolledAt()
+		sel.each(func(id string, a *annotation.Annotations) bool {
+			status, _ := adapter.Status(id)
+			d := inventory.Device{ID: id, Status: string(status), LastSeen: lastSeen, Metadata: sel.view.Metadata(id)}
+			if a != nil {
+				d.Tickets, d.Labels = a.Tickets, a.Labels
+			}
+			return out.Write(d) == nil
+		})
+		_ = out.Flush()
+	}
+}
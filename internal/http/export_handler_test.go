@@ -0,0 +1,55 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+func TestExportDevicesHandler(t *testing.T) {
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"devices":[{"id":"mac:000000000001","hw-model":"XB7","partnerIDs":"comcast"},{"id":"mac:000000000002","hw-model":"XB6","partnerIDs":"sky"}]}`))
+	}))
+	defer talaria.Close()
+	da := runtime.NewDeviceAdapter(talaria.URL, nil)
+	if _, err := da.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	svc := annotation.NewService(annotatedDevices{}, nil)
+	if _, err := svc.Put(context.Background(), "mac:000000000002", []string{"OPS-1", "OPS-2"}, map[string]string{"site": "lab"}); err != nil {
+		t.Fatal(err)
+	}
+	export := func(query string, partners ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/devices/export?"+query, nil)
+		if partners != nil {
+			req = req.WithContext(dm.WithPartners(req.Context(), partners))
+		}
+		rr := httptest.NewRecorder()
+		ExportDevicesHandler(da, svc)(rr, req)
+		return rr
+	}
+
+	rr := export("fields=id,status,model,tickets,label.site")
+	want := "id,status,model,tickets,label.site\nmac:000000000001,online,XB7,,\nmac:000000000002,online,XB6,OPS-1;OPS-2,lab\n"
+	if rr.Code != 200 || rr.Body.String() != want || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("csv: %d %q", rr.Code, rr.Body)
+	}
+	rr = export("format=jsonl&fields=id,model&query=model:XB7")
+	if rr.Body.String() != `{"id":"mac:000000000001","model":"XB7"}`+"\n" || rr.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("jsonl: %q", rr.Body)
+	}
+	if rr = export("format=jsonl&fields=id", "sky"); rr.Body.String() != `{"id":"mac:000000000002"}`+"\n" {
+		t.Fatalf("scoped: %q", rr.Body)
+	}
+	for _, bad := range []string{"format=xml", "fields=id,bogus", "query=bogus"} {
+		if rr = export(bad); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d", bad, rr.Code)
+		}
+	}
+}
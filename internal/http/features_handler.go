@@ -0,0 +1,67 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// GetFeatureHandler serves GET /api/features/{id}, an xconf RFC feature with its rollout.
+func GetFeatureHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		ft, err := m.Feature(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, ft)
+	}
+}
+
+// FeatureRolloutHandler serves PUT /api/features/{id}/rollout {"percentage":25,"confirm":"<id>"}.
+// Lowering the percentage needs the confirmation.
+func FeatureRolloutHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var req struct {
+			Percentage *float64 `json:"percentage"`
+			Confirm    string   `json:"confirm"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Percentage == nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		ft, err := m.SetFeatureRollout(r.Context(), r.PathValue("id"), *req.Percentage, req.Confirm)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, ft)
+	}
+}
+
+// FeatureToggleHandler serves POST /api/features/{id}/enable and /disable; disable is the
+// fleet-wide kill switch and needs {"confirm":"<id>"}.
+func FeatureToggleHandler(m *manager.Manager, enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var req struct {
+			Confirm string `json:"confirm"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, dm.ErrInvalidParameter)
+				return
+			}
+		}
+		ft, err := m.SetFeatureEnabled(r.Context(), r.PathValue("id"), enabled, req.Confirm)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, ft)
+	}
+}
@@ -0,0 +1,141 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/firmware"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// StartFirmwareHandler serves POST /api/devices/{id}/firmware[?force=true] {"version","url","filename"};
+// force (admins only) overrides the device's maintenance window.
+func StartFirmwareHandler(svc *firmware.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var req firmware.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		ctx, err := maintenanceContext(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		u, err := svc.Start(ctx, id, req)
+		if err != nil {
+			writeFirmwareError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, u)
+	}
+}
+
+// ListFirmwareHandler serves GET /api/devices/{id}/firmware (the device's updates, newest first).
+func ListFirmwareHandler(svc *firmware.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"updates": svc.List(r.Context(), id)})
+	}
+}
+
+// GetFirmwareHandler serves GET /api/devices/{id}/firmware/{uid}.
+func GetFirmwareHandler(svc *firmware.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		u, err := svc.Get(r.Context(), r.PathValue("uid"))
+		if err == nil && u.Device != id {
+			err = firmware.ErrUpdateNotFound
+		}
+		if err != nil {
+			writeFirmwareError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, u)
+	}
+}
+
+// StartRolloutHandler serves POST /api/firmware/rollouts with a firmware.RolloutSpec body,
+// answering 202 with the rollout. A spec's selector is resolved as SubmitJobHandler does.
+func StartRolloutHandler(svc *firmware.Service, adapter *runtime.DeviceAdapter, notes *annotation.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var spec firmware.RolloutSpec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		if err := resolveSelector(r, adapter, notes, spec.Selector, &spec.Devices); err != nil {
+			writeError(w, err)
+			return
+		}
+		ro, err := svc.StartRollout(r.Context(), spec)
+		if err != nil {
+			writeFirmwareError(w, err)
+			return
+		}
+		w.Header().Set("Location", apiPath(r, "/api/firmware/rollouts/"+ro.ID))
+		writeJSON(w, http.StatusAccepted, ro)
+	}
+}
+
+// ListRolloutsHandler serves GET /api/firmware/rollouts (summaries without per-device outcomes).
+func ListRolloutsHandler(svc *firmware.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"rollouts": svc.ListRollouts(r.Context())})
+	}
+}
+
+// GetRolloutHandler serves GET /api/firmware/rollouts/{id} including per-device outcomes.
+func GetRolloutHandler(svc *firmware.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		ro, err := svc.GetRollout(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeFirmwareError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, ro)
+	}
+}
+
+// ResumeRolloutHandler serves POST /api/firmware/rollouts/{id}/resume for a paused rollout.
+func ResumeRolloutHandler(svc *firmware.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		ro, err := svc.Resume(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeFirmwareError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, ro)
+	}
+}
+
+func writeFirmwareError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, firmware.ErrUpdateNotFound):
+		writeProblem(w, http.StatusNotFound, CodeUpdateNotFound, err)
+	case errors.Is(err, firmware.ErrRolloutNotFound):
+		writeProblem(w, http.StatusNotFound, CodeRolloutNotFound, err)
+	default:
+		writeError(w, err)
+	}
+}
@@ -0,0 +1,249 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/internal/graphql"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+	"github.com/xmidt-org/talaria/devicemgr/policy"
+)
+
+// GraphQL schema served at /api/graphql (SDL for reference; resolvers below are authoritative):
+//
+//	type Query {
+//	  devices(online: Boolean, limit: Int, offset: Int): [Device]
+//	  device(id: ID!): Device
+//	}
+//	type Device {
+//	  id: ID!  online: Boolean!  source: String
+//	  parameters(names: [String!]!, service: String): [Parameter]
+//	  firmware(model: String): Firmware   # model defaults to Device.DeviceInfo.ModelName
+//	}
+//	type Parameter { name: String! value: JSON type: String retrievedAt: String freshness: String }
+//	type Firmware { id: ID version: String model: String downloadUrl: String }
+
+const (
+	// maxGraphQLBody bounds a query request, GET query strings included.
+	maxGraphQLBody = 64 << 10
+	// maxGraphQLDeviceReads is how many devices one query may read parameters or firmware of,
+	// each a backend request; larger fleets are paged with devices(limit:, offset:).
+	maxGraphQLDeviceReads = 100
+)
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQLHandler serves GraphQL queries over devices, parameters and firmware policy, resolved through the Manager.
+func GraphQLHandler(m *manager.Manager) http.HandlerFunc {
+	schema := deviceSchema(m)
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		var req graphqlRequest
+		switch r.Method {
+		case http.MethodOptions:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case http.MethodGet:
+			req.Query = r.URL.Query().Get("query")
+			if v := r.URL.Query().Get("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					writeGraphQLError(w, http.StatusBadRequest, "invalid variables: "+err.Error())
+					return
+				}
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBody)).Decode(&req); err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					writeGraphQLError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxGraphQLBody))
+					return
+				}
+				writeGraphQLError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if len(req.Query) > maxGraphQLBody {
+			writeGraphQLError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("query exceeds %d bytes", maxGraphQLBody))
+			return
+		}
+		doc, err := graphql.Parse(req.Query)
+		if err != nil {
+			writeGraphQLError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		ctx := context.WithValue(r.Context(), deviceReadsKey{}, &deviceReads{seen: map[dm.DeviceID]bool{}})
+		resp := schema.Execute(ctx, doc, req.Variables)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+type deviceReadsKey struct{}
+
+// deviceReads counts the devices a query has read from, against maxGraphQLDeviceReads.
+type deviceReads struct {
+	mu   sync.Mutex
+	seen map[dm.DeviceID]bool
+}
+
+// readDevice admits a backend read of id by the query in ctx; reads beyond the first
+// maxGraphQLDeviceReads devices fail, rereads of a device are free.
+func readDevice(ctx context.Context, id dm.DeviceID) error {
+	reads, ok := ctx.Value(deviceReadsKey{}).(*deviceReads)
+	if !ok {
+		return nil
+	}
+	reads.mu.Lock()
+	defer reads.mu.Unlock()
+	if !reads.seen[id] && len(reads.seen) >= maxGraphQLDeviceReads {
+		return fmt.Errorf("a query reads at most %d devices; page with devices(limit:, offset:)", maxGraphQLDeviceReads)
+	}
+	reads.seen[id] = true
+	return nil
+}
+
+func writeGraphQLError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(graphql.Response{Errors: []graphql.Error{{Message: msg}}})
+}
+
+func deviceSchema(m *manager.Manager) *graphql.Schema {
+	return &graphql.Schema{
+		Query: "Query",
+		Types: map[string]map[string]graphql.FieldDef{
+			"Query": {
+				"devices": {Type: "Device", Resolve: func(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+					devices := m.ListDevices(ctx)
+					if online, ok := graphql.BoolArg(args, "online"); ok {
+						filtered := devices[:0]
+						for _, d := range devices {
+							if d.Online == online {
+								filtered = append(filtered, d)
+							}
+						}
+						devices = filtered
+					}
+					if offset, ok := graphql.IntArg(args, "offset"); ok && offset > 0 {
+						devices = devices[min(offset, len(devices)):]
+					}
+					if limit, ok := graphql.IntArg(args, "limit"); ok && limit >= 0 && limit < len(devices) {
+						devices = devices[:limit]
+					}
+					return devices, nil
+				}},
+				"device": {Type: "Device", Resolve: func(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+					id := graphql.StringArg(args, "id")
+					if id == "" {
+						return nil, errors.New("argument id required")
+					}
+					d, err := m.Device(ctx, dm.DeviceID(id))
+					if err != nil {
+						return nil, err
+					}
+					return d, nil
+				}},
+			},
+			"Device": {
+				"id":     {Resolve: deviceField(func(d dm.DeviceState) interface{} { return string(d.ID) })},
+				"online": {Resolve: deviceField(func(d dm.DeviceState) interface{} { return d.Online })},
+				"source": {Resolve: deviceField(func(d dm.DeviceState) interface{} { return d.Source })},
+				"parameters": {Type: "Parameter", Resolve: func(ctx context.Context, src interface{}, args map[string]interface{}) (interface{}, error) {
+					d := src.(dm.DeviceState)
+					names := graphql.StringListArg(args, "names")
+					if len(names) == 0 {
+						return nil, errors.New("argument names required")
+					}
+					if err := readDevice(ctx, d.ID); err != nil {
+						return nil, err
+					}
+					values, err := m.GetParameters(ctx, d.ID, graphql.StringArg(args, "service"), names)
+					if err != nil {
+						return nil, err
+					}
+					out := make([]dm.ParameterValue, 0, len(names))
+					for _, n := range names {
+						if v, ok := values[n]; ok {
+							out = append(out, v)
+						}
+					}
+					return out, nil
+				}},
+				"firmware": {Type: "Firmware", Resolve: func(ctx context.Context, src interface{}, args map[string]interface{}) (interface{}, error) {
+					d := src.(dm.DeviceState)
+					if model := graphql.StringArg(args, "model"); model != "" {
+						return m.ResolveFirmware(ctx, model)
+					}
+					if err := readDevice(ctx, d.ID); err != nil {
+						return nil, err // the model is read from the device
+					}
+					fp, err := m.DeviceFirmware(ctx, d.ID)
+					if errors.Is(err, dm.ErrInvalidParameter) {
+						return nil, errors.New("device model unknown; pass model argument")
+					}
+					return fp, err
+				}},
+			},
+			"Parameter": {
+				"name":  {Resolve: paramField(func(p dm.ParameterValue) interface{} { return p.Name })},
+				"value": {Resolve: paramField(func(p dm.ParameterValue) interface{} { return p.Value })},
+				"type":  {Resolve: paramField(func(p dm.ParameterValue) interface{} { return p.Type })},
+				"retrievedAt": {Resolve: paramField(func(p dm.ParameterValue) interface{} {
+					if p.RetrievedAt.IsZero() {
+						return nil
+					}
+					return p.RetrievedAt.UTC().Format(time.RFC3339Nano)
+				})},
+				"freshness": {Resolve: paramField(func(p dm.ParameterValue) interface{} { return p.Freshness.String() })},
+				"unit":      {Resolve: paramField(func(p dm.ParameterValue) interface{} { return nonEmpty(p.Unit) })},
+				"label":     {Resolve: paramField(func(p dm.ParameterValue) interface{} { return nonEmpty(p.Label) })},
+			},
+			"Firmware": {
+				"id":          {Resolve: firmwareField(func(f *policy.FirmwarePolicy) interface{} { return f.ID })},
+				"version":     {Resolve: firmwareField(func(f *policy.FirmwarePolicy) interface{} { return f.Version })},
+				"model":       {Resolve: firmwareField(func(f *policy.FirmwarePolicy) interface{} { return f.Model })},
+				"downloadUrl": {Resolve: firmwareField(func(f *policy.FirmwarePolicy) interface{} { return f.DownloadURL })},
+			},
+		},
+	}
+}
+
+// nonEmpty resolves an empty string to null.
+func nonEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func deviceField(get func(dm.DeviceState) interface{}) graphql.Resolver {
+	return func(_ context.Context, src interface{}, _ map[string]interface{}) (interface{}, error) {
+		return get(src.(dm.DeviceState)), nil
+	}
+}
+
+func paramField(get func(dm.ParameterValue) interface{}) graphql.Resolver {
+	return func(_ context.Context, src interface{}, _ map[string]interface{}) (interface{}, error) {
+		return get(src.(dm.ParameterValue)), nil
+	}
+}
+
+func firmwareField(get func(*policy.FirmwarePolicy) interface{}) graphql.Resolver {
+	return func(_ context.Context, src interface{}, _ map[string]interface{}) (interface{}, error) {
+		return get(src.(*policy.FirmwarePolicy)), nil
+	}
+}
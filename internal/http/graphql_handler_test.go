@@ -0,0 +1,161 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+func TestGraphQLHandlerDevicesWithParameters(t *testing.T) {
+	var gets int
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v2/devices":
+			_ = json.NewEncoder(w).Encode(map[string]any{"devices": []string{"mac:aa", "mac:bb"}})
+		case strings.HasPrefix(r.URL.Path, "/api/v3/device/"):
+			gets++
+			_ = json.NewEncoder(w).Encode(map[string]any{"parameters": map[string]any{
+				"Device.X.Sample": map[string]any{"value": 7, "timestamp": time.Now().UnixMilli()},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer backend.Close()
+
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = backend.URL
+	opts.Tr1d1umBaseURL = backend.URL + "/api/v3"
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	if _, err := m.DeviceAdapter().PollOnce(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+
+	body := `{"query":"{ devices(limit: 1) { id parameters(names: [\"Device.X.Sample\"]) { name value } } missing: device(id: \"mac:zz\") { id } }"}`
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		GraphQLHandler(m)(rr, httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 got %d", rr.Code)
+		}
+		var out struct {
+			Data struct {
+				Devices []struct {
+					ID         string `json:"id"`
+					Parameters []struct {
+						Name  string  `json:"name"`
+						Value float64 `json:"value"`
+					} `json:"parameters"`
+				} `json:"devices"`
+			} `json:"data"`
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(out.Data.Devices) != 1 || out.Data.Devices[0].ID != "mac:aa" {
+			t.Fatalf("unexpected devices: %+v", out.Data.Devices)
+		}
+		if p := out.Data.Devices[0].Parameters; len(p) != 1 || p[0].Value != 7 {
+			t.Fatalf("unexpected parameters: %+v", p)
+		}
+		if len(out.Errors) != 1 || out.Errors[0].Message != dm.ErrDeviceNotFound.Error() {
+			t.Fatalf("expected device not found error, got %+v", out.Errors)
+		}
+	}
+	if gets != 1 {
+		t.Fatalf("expected second query served from cache, backend GETs=%d", gets)
+	}
+}
+
+func TestGraphQLHandlerParseError(t *testing.T) {
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = "http://example"
+	m, _ := manager.New(opts)
+	rr := httptest.NewRecorder()
+	GraphQLHandler(m)(rr, httptest.NewRequest(http.MethodGet, "/api/graphql?query=mutation+%7B+x+%7D", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 got %d", rr.Code)
+	}
+}
+
+func TestGraphQLHandlerLimits(t *testing.T) {
+	var gets atomic.Int32
+	ids := make([]string, maxGraphQLDeviceReads+5)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("mac:%012x", i)
+	}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v2/devices":
+			_ = json.NewEncoder(w).Encode(map[string]any{"devices": ids})
+		case strings.HasPrefix(r.URL.Path, "/api/v3/device/"):
+			gets.Add(1)
+			_ = json.NewEncoder(w).Encode(map[string]any{"parameters": map[string]any{"Device.X.Sample": map[string]any{"value": 7}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer backend.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = backend.URL
+	opts.Tr1d1umBaseURL = backend.URL + "/api/v3"
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if _, err := m.DeviceAdapter().PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	h := GraphQLHandler(m)
+	query := func(q string) (*httptest.ResponseRecorder, graphqlErrors) {
+		body, _ := json.Marshal(graphqlRequest{Query: q})
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest(http.MethodPost, "/api/graphql", bytes.NewReader(body)))
+		var out graphqlErrors
+		_ = json.Unmarshal(rr.Body.Bytes(), &out)
+		return rr, out
+	}
+
+	rr := httptest.NewRecorder()
+	h(rr, httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(`{"query":"`+strings.Repeat(" ", maxGraphQLBody)+`{ devices { id } }"}`)))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized body: %d", rr.Code)
+	}
+	if rr, _ := query(strings.Repeat("{ devices ", 20) + strings.Repeat("}", 20)); rr.Code != http.StatusBadRequest {
+		t.Fatalf("deep query: %d", rr.Code)
+	}
+
+	// parameters resolve for the first maxGraphQLDeviceReads devices only
+	rr, out := query(`{ devices { id parameters(names: ["Device.X.Sample"]) { value } } }`)
+	if rr.Code != http.StatusOK || len(out.Errors) != 5 || int(gets.Load()) != maxGraphQLDeviceReads {
+		t.Fatalf("fleet-wide parameters: %d, %d errors, %d GETs", rr.Code, len(out.Errors), gets.Load())
+	}
+	// the rest are paged in with offset
+	rr, out = query(fmt.Sprintf(`{ devices(offset: %d) { id parameters(names: ["Device.X.Sample"]) { value } } }`, maxGraphQLDeviceReads))
+	if rr.Code != http.StatusOK || len(out.Errors) != 0 || int(gets.Load()) != maxGraphQLDeviceReads+5 {
+		t.Fatalf("next page: %d, %+v, %d GETs", rr.Code, out.Errors, gets.Load())
+	}
+}
+
+type graphqlErrors struct {
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
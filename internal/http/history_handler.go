@@ -0,0 +1,103 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// HistoryHandler serves GET /api/devices/{id}/history[?window=24h], listing the device's events
+// oldest first in the same JSON shape as /api/events.
+func HistoryHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var window time.Duration
+		if v := r.URL.Query().Get("window"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				writeError(w, dm.ErrInvalidParameter)
+				return
+			}
+			window = d
+		}
+		history, err := m.History(r.Context(), id, window)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		out := make([]json.RawMessage, 0, len(history))
+		for _, e := range history {
+			b, err := events.JSONEncoder{}.Encode(e)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			out = append(out, b)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"deviceId": id, "events": out})
+	}
+}
+
+// DefaultOperationsLimit is the number of operations OperationsHandler returns without ?limit.
+const DefaultOperationsLimit = 50
+
+// OperationsHandler serves GET /api/devices/{id}/operations[?limit=50], the device's recent reads,
+// writes, RPCs and lifecycle operations newest first, each with its actor, time, duration and outcome.
+func OperationsHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		limit := DefaultOperationsLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				writeError(w, dm.ErrInvalidParameter)
+				return
+			}
+			limit = n
+		}
+		ops, err := m.Operations(r.Context(), id, limit)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"deviceId": id, "operations": ops})
+	}
+}
+
+// ChangesHandler serves GET /api/devices/changes[?since=<cursor>&limit=500], the device
+// additions, removals and status changes after the cursor, oldest first, with the cursor to pass
+// next. Without since it returns no changes and the current cursor, to take before reading the
+// device list; an expired cursor is 410 Gone, after which the client reads the full list again.
+func ChangesHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var limit int
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				writeError(w, dm.ErrInvalidParameter)
+				return
+			}
+			limit = n
+		}
+		feed, err := m.Changes(r.Context(), r.URL.Query().Get("since"), limit)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, feed)
+	}
+}
@@ -0,0 +1,158 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+func TestHistoryHandler(t *testing.T) {
+	now := time.Now()
+	codex := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[
+			{"dest":"event:device-status/mac:112233445566/offline","birth_date":%d,"partner_ids":["comcast"]},
+			{"dest":"event:device-status/mac:112233445566/online","birth_date":%d}
+		]`, now.Add(-2*time.Hour).Unix(), now.Add(-time.Hour).Unix())
+	}))
+	defer codex.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = "http://talaria.invalid"
+	opts.CodexBaseURL = codex.URL
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	get := func(query string, partners ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/devices/mac:112233445566/history"+query, nil)
+		req.SetPathValue("id", "mac:112233445566")
+		if partners != nil {
+			req = req.WithContext(dm.WithPartners(req.Context(), partners))
+		}
+		rr := httptest.NewRecorder()
+		HistoryHandler(m)(rr, req)
+		return rr
+	}
+	count := func(rr *httptest.ResponseRecorder) int {
+		var body struct {
+			Events []struct {
+				Kind string `json:"kind"`
+			} `json:"events"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return len(body.Events)
+	}
+
+	if rr := get(""); rr.Code != http.StatusOK || count(rr) != 2 {
+		t.Fatalf("unscoped: %d %s", rr.Code, rr.Body)
+	}
+	if rr := get("?window=90m"); rr.Code != http.StatusOK || count(rr) != 1 {
+		t.Fatalf("window: %d %s", rr.Code, rr.Body)
+	}
+	if rr := get("", "comcast"); rr.Code != http.StatusOK || count(rr) != 1 {
+		t.Fatalf("scoped: %d %s", rr.Code, rr.Body)
+	}
+	if rr := get("", "other"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 outside the partner scope, got %d", rr.Code)
+	}
+	if rr := get("?window=soon"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad window, got %d", rr.Code)
+	}
+}
+
+func TestOperationsHandler(t *testing.T) {
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			w.Write([]byte(`{"statusCode":200}`))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = "http://talaria.invalid"
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	ctx := dm.WithActor(dm.WithRole(context.Background(), dm.RoleOperator), "alice")
+	const id = "mac:112233445566"
+	if _, err := m.RefreshParameters(ctx, id, "", []string{"Device.X"}); err == nil {
+		t.Fatal("expected the read to fail")
+	}
+	if _, err := m.SetParameters(ctx, id, "", []dm.SetParameter{{Name: "Device.WiFi.SSID.1.KeyPassphrase", Value: "secret"}}, dm.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/devices/"+id+"/operations", nil)
+	req.SetPathValue("id", id)
+	rr := httptest.NewRecorder()
+	OperationsHandler(m)(rr, req)
+	var body struct {
+		Operations []struct {
+			Action string `json:"action"`
+			Actor  string `json:"actor"`
+			Role   string `json:"role"`
+			Detail string `json:"detail"`
+			OK     bool   `json:"ok"`
+			Error  string `json:"error"`
+		} `json:"operations"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("decode: %d %s", rr.Code, rr.Body)
+	}
+	ops := body.Operations
+	if len(ops) != 2 || ops[0].Action != "set" || !ops[0].OK || ops[0].Actor != "alice" || ops[0].Role != "operator" ||
+		ops[0].Detail != "Device.WiFi.SSID.1.KeyPassphrase" || ops[1].Action != "get" || ops[1].OK || ops[1].Error == "" {
+		t.Fatalf("operations: %s", rr.Body)
+	}
+	if strings.Contains(rr.Body.String(), "secret") {
+		t.Fatalf("set value leaked into the history: %s", rr.Body)
+	}
+}
+
+func TestChangesHandler(t *testing.T) {
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = "http://talaria.invalid"
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		ChangesHandler(m)(rr, httptest.NewRequest("GET", "/api/devices/changes"+query, nil))
+		return rr
+	}
+
+	rr := get("")
+	var feed manager.ChangeFeed
+	if err := json.Unmarshal(rr.Body.Bytes(), &feed); rr.Code != http.StatusOK || err != nil || feed.Cursor == "" {
+		t.Fatalf("initial: %d %s", rr.Code, rr.Body)
+	}
+	if rr := get("?since=" + feed.Cursor + "&limit=10"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"changes":[]`) {
+		t.Fatalf("no changes: %d %s", rr.Code, rr.Body)
+	}
+	for query, want := range map[string]int{
+		"?limit=0":              http.StatusBadRequest,
+		"?since=%25%25":         http.StatusBadRequest,
+		"?since=ZGVhZGJlZWY6MA": http.StatusGone, // another process's cursor
+	} {
+		if rr := get(query); rr.Code != want {
+			t.Errorf("%s: %d %s, want %d", query, rr.Code, rr.Body, want)
+		}
+	}
+}
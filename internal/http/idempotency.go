@@ -0,0 +1,152 @@
+package httpapi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/cache"
+)
+
+// IdempotencyHeader carries the client-chosen key of a request that may be retried.
+const IdempotencyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set to "true" on a response replayed for a retried request.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// DefaultIdempotencyTTL is how long responses are kept for replay.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// maxIdempotencyKey bounds the length of IdempotencyHeader.
+const maxIdempotencyKey = 255
+
+// IdempotentResponse is a response stored for replay, with the fingerprint of its request.
+type IdempotentResponse struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Idempotency makes mutating routes safe to retry. The first request carrying an Idempotency-Key
+// runs as usual and its response is stored; a retry with the same key, caller, route and body
+// gets the stored response instead of running again. Reusing a key for a different request is
+// rejected with 422, and a retry arriving while the original still runs gets 409. Responses with
+// a 5xx status are not stored, so such a request can be retried for real.
+type Idempotency struct {
+	store cache.Cache[IdempotentResponse]
+
+	mu       sync.Mutex
+	inflight map[string]bool // keys being served by this replica
+}
+
+// NewIdempotency keeps responses in store, or in memory for DefaultIdempotencyTTL when store is
+// nil. A shared store (redisstore.NewCache) lets every replica replay them.
+func NewIdempotency(store cache.Cache[IdempotentResponse]) *Idempotency {
+	if store == nil {
+		store = cache.NewTTL[IdempotentResponse](DefaultIdempotencyTTL)
+	}
+	return &Idempotency{store: store, inflight: make(map[string]bool)}
+}
+
+// Wrap applies idempotency keys to next; a nil Idempotency returns next unchanged.
+func (i *Idempotency) Wrap(next http.Handler) http.Handler {
+	if i == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyHeader)
+		if key == "" || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			writeCORS(w, r)
+			writeProblem(w, http.StatusBadRequest, CodeIdempotencyKey, errors.New(IdempotencyHeader+" longer than 255 bytes"))
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeCORS(w, r)
+			writeProblem(w, http.StatusBadRequest, dm.CodeInvalidParameter, fmt.Errorf("reading body: %w", err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		// the caller's credentials scope the key, so two clients choosing the same key never collide
+		scope := digest(r.Header.Get("Authorization"), r.Method, r.URL.Path, key)
+		fingerprint := digest(r.URL.RawQuery, string(body))
+
+		if prev, _, ok := i.store.Get(scope); ok {
+			writeCORS(w, r)
+			if prev.Fingerprint != fingerprint {
+				writeProblem(w, http.StatusUnprocessableEntity, CodeIdempotencyKey, errors.New(IdempotencyHeader+" reused for a different request"))
+				return
+			}
+			for k, v := range prev.Header {
+				w.Header()[k] = v
+			}
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			w.WriteHeader(prev.Status)
+			_, _ = w.Write(prev.Body)
+			return
+		}
+		i.mu.Lock()
+		busy := i.inflight[scope]
+		i.inflight[scope] = true
+		i.mu.Unlock()
+		if busy {
+			writeCORS(w, r)
+			writeProblem(w, http.StatusConflict, CodeIdempotencyKey, errors.New("a request with this "+IdempotencyHeader+" is in progress"))
+			return
+		}
+		defer func() {
+			i.mu.Lock()
+			delete(i.inflight, scope)
+			i.mu.Unlock()
+		}()
+
+		rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.status < http.StatusInternalServerError {
+			header := http.Header{}
+			if ct := w.Header().Get("Content-Type"); ct != "" {
+				header.Set("Content-Type", ct)
+			}
+			i.store.Set(scope, IdempotentResponse{Fingerprint: fingerprint, Status: rec.status, Header: header, Body: rec.body.Bytes()})
+		}
+	})
+}
+
+// digest hashes parts, separated so that no two part lists collide.
+func digest(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter copies the status and body written through it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recordingWriter) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recordingWriter) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
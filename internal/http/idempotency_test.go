@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdempotency(t *testing.T) {
+	var calls int
+	status := http.StatusAccepted
+	h := NewIdempotency(nil).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		writeJSON(w, status, map[string]any{"call": calls, "body": string(body)})
+	}))
+	send := func(key, auth, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/devices/mac:aabbccddeeff/reboot", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyHeader, key)
+		}
+		req.Header.Set("Authorization", auth)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := send("k1", "Bearer a", `{"delay":0}`)
+	retry := send("k1", "Bearer a", `{"delay":0}`)
+	if calls != 1 || retry.Code != first.Code || retry.Body.String() != first.Body.String() || retry.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatalf("retry not replayed: calls=%d %d %s", calls, retry.Code, retry.Body)
+	}
+	if ct := retry.Header().Get("Content-Type"); ct != first.Header().Get("Content-Type") {
+		t.Fatalf("replayed content type %q", ct)
+	}
+	if rr := send("k1", "Bearer a", `{"delay":5}`); rr.Code != http.StatusUnprocessableEntity || calls != 1 {
+		t.Fatalf("reused key: %d after %d calls", rr.Code, calls)
+	}
+	if send("k1", "Bearer b", `{"delay":0}`); calls != 2 {
+		t.Fatalf("another caller's key replayed: %d calls", calls)
+	}
+	send("", "Bearer a", `{}`)
+	if send("", "Bearer a", `{}`); calls != 4 {
+		t.Fatalf("unkeyed requests: %d calls", calls)
+	}
+
+	status = http.StatusServiceUnavailable
+	send("k2", "Bearer a", `{}`)
+	if send("k2", "Bearer a", `{}`); calls != 6 {
+		t.Fatalf("5xx replayed: %d calls", calls)
+	}
+	if rr := send(strings.Repeat("k", 256), "Bearer a", `{}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("long key: %d", rr.Code)
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	h := NewIdempotency(nil).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	req := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPatch, "/api/devices/mac:aabbccddeeff/params", strings.NewReader(`{}`))
+		r.Header.Set(IdempotencyHeader, "k")
+		return r
+	}
+	done := make(chan int)
+	go func() {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req())
+		done <- rr.Code
+	}()
+	<-started
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req())
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("concurrent retry: %d", rr.Code)
+	}
+	close(release)
+	if code := <-done; code != http.StatusNoContent {
+		t.Fatalf("original: %d", code)
+	}
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req())
+	if rr.Code != http.StatusNoContent || rr.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatalf("after completion: %d", rr.Code)
+	}
+}
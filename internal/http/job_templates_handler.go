@@ -0,0 +1,106 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// ListJobTemplatesHandler serves GET /api/job-templates.
+func ListJobTemplatesHandler(svc *jobs.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"templates": svc.Templates(r.Context())})
+	}
+}
+
+// SaveJobTemplateHandler serves PUT /api/job-templates/{name} with a jobs.Template body, answering
+// 201 with the saved template.
+func SaveJobTemplateHandler(svc *jobs.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var t jobs.Template
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		t.Name = r.PathValue("name")
+		saved, err := svc.SaveTemplate(r.Context(), t)
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, saved)
+	}
+}
+
+// GetJobTemplateHandler serves GET /api/job-templates/{name}.
+func GetJobTemplateHandler(svc *jobs.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		t, err := svc.Template(r.Context(), r.PathValue("name"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+	}
+}
+
+// DeleteJobTemplateHandler serves DELETE /api/job-templates/{name}, answering 204.
+func DeleteJobTemplateHandler(svc *jobs.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		if err := svc.DeleteTemplate(r.Context(), r.PathValue("name")); err != nil {
+			writeJobError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// runTemplateRequest is the body of POST /api/job-templates/{name}/run. Devices or Selector, when
+// set, replace the template's targets.
+type runTemplateRequest struct {
+	Variables map[string]string `json:"variables"`
+	Devices   []dm.DeviceID     `json:"devices"`
+	Selector  string            `json:"selector"`
+}
+
+// RunJobTemplateHandler serves POST /api/job-templates/{name}/run, submitting a job rendered from the
+// template with the body's variables and answering 202 with it, as POST /api/jobs does.
+func RunJobTemplateHandler(svc *jobs.Service, adapter *runtime.DeviceAdapter, notes *annotation.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var req runTemplateRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, dm.ErrInvalidParameter)
+				return
+			}
+		}
+		spec, err := svc.RenderTemplate(r.Context(), r.PathValue("name"), req.Variables)
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		if len(req.Devices) > 0 || req.Selector != "" {
+			spec.Devices, spec.Selector = req.Devices, req.Selector
+		}
+		if err := resolveSelector(r, adapter, notes, spec.Selector, &spec.Devices); err != nil {
+			writeError(w, err)
+			return
+		}
+		j, err := svc.Submit(r.Context(), spec)
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		w.Header().Set("Location", apiPath(r, "/api/jobs/"+j.ID))
+		writeJSON(w, http.StatusAccepted, j)
+	}
+}
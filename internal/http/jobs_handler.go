@@ -0,0 +1,147 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// SubmitJobHandler serves POST /api/jobs with a jobs.Spec body, answering 202 with the created job.
+// A spec's selector is resolved to its devices against adapter's inventory and the labels of
+// notes (optional) on submission.
+func SubmitJobHandler(svc *jobs.Service, adapter *runtime.DeviceAdapter, notes *annotation.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var spec jobs.Spec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		if err := resolveSelector(r, adapter, notes, spec.Selector, &spec.Devices); err != nil {
+			writeError(w, err)
+			return
+		}
+		j, err := svc.Submit(r.Context(), spec)
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		w.Header().Set("Location", apiPath(r, "/api/jobs/"+j.ID))
+		writeJSON(w, http.StatusAccepted, j)
+	}
+}
+
+// ListJobsHandler serves GET /api/jobs (summaries without per-device results).
+func ListJobsHandler(svc *jobs.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"jobs": svc.List(r.Context())})
+	}
+}
+
+// GetJobHandler serves GET /api/jobs/{id} including per-device results.
+func GetJobHandler(svc *jobs.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		j, err := svc.Get(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, j)
+	}
+}
+
+// CancelJobHandler serves DELETE /api/jobs/{id}, answering 202 with the job: it reaches
+// StatusCanceled once the device operations in flight return.
+func CancelJobHandler(svc *jobs.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		j, err := svc.Cancel(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, j)
+	}
+}
+
+// ApproveJobHandler serves POST /api/jobs/{id}/approve, answering 202 with the job once it has
+// been released to run.
+func ApproveJobHandler(svc *jobs.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		j, err := svc.Approve(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, j)
+	}
+}
+
+// RerunJobHandler serves POST /api/jobs/{id}/rerun, submitting the job again on the devices that
+// failed and answering 202 with the new job.
+func RerunJobHandler(svc *jobs.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		j, err := svc.Rerun(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		w.Header().Set("Location", apiPath(r, "/api/jobs/"+j.ID))
+		writeJSON(w, http.StatusAccepted, j)
+	}
+}
+
+// ListJobArtifactsHandler serves GET /api/jobs/{id}/artifacts: the descriptions of the job's
+// artifacts, the results.jsonl of a finished job among them.
+func ListJobArtifactsHandler(svc *jobs.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		list, err := svc.Artifacts(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"artifacts": list})
+	}
+}
+
+// GetJobArtifactHandler serves GET /api/jobs/{id}/artifacts/{name...}, downloading an artifact.
+func GetJobArtifactHandler(svc *jobs.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		a, b, err := svc.Artifact(r.Context(), r.PathValue("id"), r.PathValue("name"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", a.ContentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+path.Base(a.Name)+`"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(b)
+	}
+}
+
+func writeJobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrJobNotFound):
+		writeProblem(w, http.StatusNotFound, CodeJobNotFound, err)
+	case errors.Is(err, jobs.ErrTemplateNotFound):
+		writeProblem(w, http.StatusNotFound, CodeTemplateNotFound, err)
+	case errors.Is(err, dm.ErrArtifactNotFound):
+		writeProblem(w, http.StatusNotFound, dm.CodeArtifactNotFound, err)
+	default:
+		writeError(w, err)
+	}
+}
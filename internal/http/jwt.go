@@ -0,0 +1,283 @@
+package httpapi
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+var (
+	errNoVerifier   = errors.New("bearer token verification is not configured")
+	errBadSignature = errors.New("invalid token signature")
+)
+
+// jwksRefresh bounds how often an unknown key ID triggers a JWKS fetch; keys are also refetched
+// once they are older than jwksMaxAge.
+const (
+	jwksRefresh = time.Minute
+	jwksMaxAge  = time.Hour
+)
+
+// NewJWTVerifier returns a verifier for JWTRoleResolver and JWTPartnerResolver checking the
+// token's signature (HS* with cfg.HMACSecret, RS*/PS*/ES* with the keys published at cfg.JWKSURL),
+// its exp and nbf times and, when configured, its issuer and audience. client fetches the JWKS;
+// nil uses a 10s-timeout client.
+func NewJWTVerifier(cfg dm.JWTConfig, client *http.Client) (func(token string) error, error) {
+	if cfg.HMACSecret == "" && cfg.JWKSURL == "" {
+		return nil, errNoVerifier
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	v := &jwtVerifier{cfg: cfg, client: client, now: time.Now}
+	return v.verify, nil
+}
+
+type jwtVerifier struct {
+	cfg    dm.JWTConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey // by kid; "" holds a key published without one
+	fetchedAt time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func (v *jwtVerifier) verify(token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed bearer token")
+	}
+	var h jwtHeader
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return errors.New("malformed token header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errBadSignature
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch alg := h.Alg; {
+	case strings.HasPrefix(alg, "HS"):
+		if v.cfg.HMACSecret == "" {
+			return fmt.Errorf("token algorithm %s not accepted", alg)
+		}
+		newHash, ok := hashFor(alg)
+		if !ok {
+			return fmt.Errorf("token algorithm %s not supported", alg)
+		}
+		mac := hmac.New(newHash, []byte(v.cfg.HMACSecret))
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return errBadSignature
+		}
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"), strings.HasPrefix(alg, "ES"):
+		if v.cfg.JWKSURL == "" {
+			return fmt.Errorf("token algorithm %s not accepted", alg)
+		}
+		key, err := v.key(h.Kid)
+		if err != nil {
+			return err
+		}
+		if err := verifySignature(alg, key, signed, sig); err != nil {
+			return err
+		}
+	default:
+		// includes "none"
+		return fmt.Errorf("token algorithm %q not accepted", alg)
+	}
+	var claims struct {
+		Exp float64         `json:"exp"`
+		Nbf float64         `json:"nbf"`
+		Iss string          `json:"iss"`
+		Aud json.RawMessage `json:"aud"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return errors.New("malformed token claims")
+	}
+	now := float64(v.now().Unix())
+	if claims.Exp != 0 && now >= claims.Exp {
+		return errors.New("token expired")
+	}
+	if claims.Nbf != 0 && now < claims.Nbf {
+		return errors.New("token not yet valid")
+	}
+	if v.cfg.Issuer != "" && claims.Iss != v.cfg.Issuer {
+		return errors.New("token issuer not accepted")
+	}
+	if v.cfg.Audience != "" && !audienceContains(claims.Aud, v.cfg.Audience) {
+		return errors.New("token audience not accepted")
+	}
+	return nil
+}
+
+func decodeSegment(seg string, out interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func audienceContains(raw json.RawMessage, want string) bool {
+	var one string
+	if json.Unmarshal(raw, &one) == nil {
+		return one == want
+	}
+	var many []string
+	_ = json.Unmarshal(raw, &many)
+	for _, a := range many {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
+
+func hashFor(alg string) (func() hash.Hash, bool) {
+	switch alg[2:] {
+	case "256":
+		return sha256.New, true
+	case "384":
+		return sha512.New384, true
+	case "512":
+		return sha512.New, true
+	}
+	return nil, false
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	newHash, ok := hashFor(alg)
+	if !ok {
+		return fmt.Errorf("token algorithm %s not supported", alg)
+	}
+	h := newHash()
+	h.Write(signed)
+	digest := h.Sum(nil)
+	hashID := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}[alg[2:]]
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		var err error
+		switch alg[:2] {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(k, hashID, digest, sig)
+		case "PS":
+			err = rsa.VerifyPSS(k, hashID, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		default:
+			return errBadSignature
+		}
+		if err != nil {
+			return errBadSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(sig) != 2*size {
+			return errBadSignature
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errBadSignature
+		}
+		return nil
+	}
+	return errBadSignature
+}
+
+// key returns the JWKS key for kid, refetching the set when it is stale or lacks kid.
+func (v *jwtVerifier) key(kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := v.now()
+	key, ok := v.keys[kid]
+	age := now.Sub(v.fetchedAt)
+	if ok && age < jwksMaxAge {
+		return key, nil
+	}
+	if v.keys == nil || age >= jwksRefresh {
+		keys, err := v.fetchKeys()
+		if err != nil {
+			if ok {
+				// keep serving the known key while the JWKS endpoint is unavailable
+				return key, nil
+			}
+			return nil, fmt.Errorf("jwks: %w", err)
+		}
+		v.keys, v.fetchedAt = keys, now
+		if key, ok = keys[kid]; ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown token key %q", kid)
+}
+
+func (v *jwtVerifier) fetchKeys() (map[string]crypto.PublicKey, error) {
+	resp, err := v.client.Get(v.cfg.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			curve := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[k.Crv]
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if curve == nil || errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,124 @@
+package httpapi
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func jwtSegments(alg, kid string, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func signHS256(claims map[string]any, secret string) string {
+	signed := jwtSegments("HS256", "", claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTVerifierHMAC(t *testing.T) {
+	verify, err := NewJWTVerifier(dm.JWTConfig{HMACSecret: testSecret, Issuer: "themis", Audience: "devicemgr"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour).Unix()
+	valid := map[string]any{"iss": "themis", "aud": []string{"devicemgr"}, "exp": future}
+	if err := verify(signHS256(valid, testSecret)); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	signed := signHS256(valid, testSecret)
+	cases := map[string]string{
+		"wrong secret": signHS256(valid, "other"),
+		"forged claims": jwtSegments("HS256", "", map[string]any{"iss": "themis", "aud": "devicemgr", "roles": "admin"}) +
+			signed[strings.LastIndex(signed, "."):],
+		"alg none":  jwtSegments("none", "", valid) + ".",
+		"unsigned":  jwtSegments("HS256", "", valid) + ".",
+		"expired":   signHS256(map[string]any{"iss": "themis", "aud": "devicemgr", "exp": time.Now().Add(-time.Minute).Unix()}, testSecret),
+		"not yet":   signHS256(map[string]any{"iss": "themis", "aud": "devicemgr", "nbf": future}, testSecret),
+		"issuer":    signHS256(map[string]any{"iss": "other", "aud": "devicemgr"}, testSecret),
+		"audience":  signHS256(map[string]any{"iss": "themis", "aud": "other"}, testSecret),
+		"malformed": "abc",
+	}
+	for name, token := range cases {
+		if err := verify(token); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+	if _, err := NewJWTVerifier(dm.JWTConfig{}, nil); err == nil {
+		t.Fatal("verifier without keys built")
+	}
+}
+
+func TestJWTVerifierJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	fetches := 0
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]any{
+			{"kty": "RSA", "kid": "r1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "e1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		}})
+	}))
+	defer jwks.Close()
+	verify, err := NewJWTVerifier(dm.JWTConfig{JWKSURL: jwks.URL}, jwks.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]any{"sub": "ops"}
+
+	signed := jwtSegments("RS256", "r1", claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	if err := verify(signed + "." + b64(sig)); err != nil {
+		t.Fatalf("RS256: %v", err)
+	}
+
+	signed = jwtSegments("ES256", "e1", claims)
+	digest = sha256.Sum256([]byte(signed))
+	r, s, _ := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+	if err := verify(signed + "." + b64(append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...))); err != nil {
+		t.Fatalf("ES256: %v", err)
+	}
+	if fetches != 1 {
+		t.Fatalf("jwks fetched %d times, want 1", fetches)
+	}
+
+	// a token signed by the wrong key, or an HMAC token without a configured secret, is refused
+	signed = jwtSegments("ES256", "r1", claims)
+	if err := verify(signed + "." + b64(append(r.Bytes(), s.Bytes()...))); err == nil {
+		t.Fatal("ES256 token verified with RSA key")
+	}
+	if err := verify(signHS256(claims, "guess")); err == nil {
+		t.Fatal("HS256 token accepted without a secret")
+	}
+}
+
+func TestBearerClaimsFailClosed(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/devices", nil)
+	req.Header.Set("Authorization", bearer(map[string]any{"partner-id": "*"}))
+	if _, err := JWTPartnerResolver("", nil)(req); err == nil {
+		t.Fatal("claims read without a verifier")
+	}
+	if role, err := JWTRoleResolver("", nil, nil)(req); err == nil || role != dm.RoleNone {
+		t.Fatalf("role %v, err %v without a verifier", role, err)
+	}
+}
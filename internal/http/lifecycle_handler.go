@@ -0,0 +1,179 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// maintenanceContext applies ?force=true, which overrides the device's maintenance window and
+// requires the admin role; the override is recorded in the operation's audit record.
+func maintenanceContext(r *http.Request) (context.Context, error) {
+	if r.URL.Query().Get("force") != "true" {
+		return r.Context(), nil
+	}
+	if !dm.OverrideAllowed(r.Context()) {
+		return nil, fmt.Errorf("force requires the %s role: %w", dm.RoleAdmin, dm.ErrAccessDenied)
+	}
+	return dm.WithMaintenanceOverride(r.Context()), nil
+}
+
+// RebootHandler serves POST /api/devices/{id}/reboot[?force=true].
+func RebootHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		ctx, err := maintenanceContext(r)
+		if err == nil {
+			err = m.Reboot(ctx, id)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{"deviceId": id, "action": "reboot"})
+	}
+}
+
+// FactoryResetHandler serves POST /api/devices/{id}/factory-reset[?force=true] with {"confirm":"<device id>"}.
+func FactoryResetHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var req struct {
+			Confirm string `json:"confirm"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, dm.ErrInvalidParameter)
+				return
+			}
+		}
+		ctx, err := maintenanceContext(r)
+		if err == nil {
+			err = m.FactoryReset(ctx, id, req.Confirm)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{"deviceId": id, "action": "factory-reset"})
+	}
+}
+
+// PingHandler serves POST /api/devices/{id}/ping.
+func PingHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		res, err := m.Ping(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"deviceId":  res.DeviceID,
+			"via":       res.Via,
+			"latencyMs": res.Latency.Milliseconds(),
+			"upTime":    res.UpTime,
+		})
+	}
+}
+
+// LogUploadHandler serves POST /api/devices/{id}/logs/upload[?timeout=10m&poll=10s], answering
+// once the device finished uploading with the upload's status and location.
+func LogUploadHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var opts manager.LogUploadOptions
+		for name, dst := range map[string]*time.Duration{"timeout": &opts.Timeout, "poll": &opts.PollInterval} {
+			if v := r.URL.Query().Get(name); v != "" {
+				d, err := time.ParseDuration(v)
+				if err != nil || d <= 0 {
+					writeError(w, dm.ErrInvalidParameter)
+					return
+				}
+				*dst = d
+			}
+		}
+		// uploads outlive the server's write timeout
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		res, err := m.UploadLogs(r.Context(), id, opts)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+// MaintenanceHandler serves GET /api/devices/{id}/maintenance: the device's maintenance window
+// (null when unrestricted), whether it is open now and when it next opens.
+func MaintenanceHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		win, err := m.MaintenanceWindow(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		body := map[string]interface{}{"deviceId": id, "window": win, "open": true}
+		if now := time.Now(); win != nil {
+			body["open"] = win.Contains(now)
+			body["next"] = win.Next(now)
+		}
+		writeJSON(w, http.StatusOK, body)
+	}
+}
+
+// OperateHandler serves POST /api/devices/{id}/operate with {"command":"Device.Reboot()","args":{...}},
+// invoking a USP command on an agent addressed by its endpoint ID.
+func OperateHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var req struct {
+			Command string            `json:"command"`
+			Args    map[string]string `json:"args"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Command == "" {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		res, err := m.Operate(r.Context(), id, req.Command, req.Args)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"command":     res.Command,
+			"output":      res.Output,
+			"requestPath": res.RequestPath,
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+type recordingAudit struct {
+	mu      sync.Mutex
+	records []dm.AuditRecord
+}
+
+func (a *recordingAudit) Audit(r dm.AuditRecord) {
+	a.mu.Lock()
+	a.records = append(a.records, r)
+	a.mu.Unlock()
+}
+
+func TestLifecycleHandlers(t *testing.T) {
+	var sets []string
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPatch:
+			var body struct {
+				Parameters []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"parameters"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			for _, p := range body.Parameters {
+				sets = append(sets, p.Name+"="+p.Value)
+			}
+			w.Write([]byte(`{"statusCode":200}`))
+		case http.MethodGet:
+			w.Write([]byte(`{"parameters":{"Device.DeviceInfo.UpTime":{"value":"42"}}}`))
+		}
+	}))
+	defer tr1d1um.Close()
+	audit := &recordingAudit{}
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = "http://talaria.invalid"
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	opts.Audit = audit
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	post := func(h http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req.SetPathValue("id", "mac:112233445566")
+		rr := httptest.NewRecorder()
+		h(rr, req)
+		return rr
+	}
+	if rr := post(RebootHandler(m), ""); rr.Code != http.StatusAccepted {
+		t.Fatalf("reboot: %d %s", rr.Code, rr.Body)
+	}
+	if rr := post(FactoryResetHandler(m), `{"confirm":"mac:9999"}`); rr.Code != http.StatusPreconditionRequired {
+		t.Fatalf("expected 428 without a matching confirmation, got %d", rr.Code)
+	}
+	if rr := post(FactoryResetHandler(m), `{"confirm":"mac:112233445566"}`); rr.Code != http.StatusAccepted {
+		t.Fatalf("factory reset: %d %s", rr.Code, rr.Body)
+	}
+	rr := post(PingHandler(m), "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"upTime":"42"`) || !strings.Contains(rr.Body.String(), `"via":"wdmp"`) {
+		t.Fatalf("ping: %d %s", rr.Code, rr.Body)
+	}
+
+	want := []string{manager.DefaultRebootParameter + "=" + manager.DefaultRebootValue, manager.DefaultFactoryResetParameter + "=" + manager.DefaultFactoryResetValue}
+	if strings.Join(sets, " ") != strings.Join(want, " ") {
+		t.Fatalf("sets = %v, want %v", sets, want)
+	}
+	var actions []string
+	for _, r := range audit.records {
+		actions = append(actions, r.Action)
+	}
+	if strings.Join(actions, " ") != "reboot factory-reset factory-reset ping" {
+		t.Fatalf("audit actions = %v", actions)
+	}
+	if !errors.Is(audit.records[1].Err, dm.ErrConfirmationRequired) || audit.records[2].Err != nil {
+		t.Fatalf("audit outcomes: %+v", audit.records)
+	}
+}
+
+func TestLogUploadHandler(t *testing.T) {
+	var mu sync.Mutex
+	status, location, polls := "Complete", "https://logs.example.com/old.tgz", 0
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPatch:
+			status = "Triggered"
+			w.Write([]byte(`{"statusCode":200}`))
+		case http.MethodGet:
+			if status != "Complete" {
+				if polls++; polls > 1 {
+					status, location = "Complete", "https://logs.example.com/new.tgz"
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"parameters": map[string]interface{}{
+				manager.DefaultLogUploadStatusParameter:   map[string]string{"value": status},
+				manager.DefaultLogUploadLocationParameter: map[string]string{"value": location},
+			}})
+		}
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = "http://talaria.invalid"
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	opts.Audit = &recordingAudit{}
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	req := httptest.NewRequest("POST", "/?poll=10ms&timeout=5s", nil)
+	req.SetPathValue("id", "mac:112233445566")
+	rr := httptest.NewRecorder()
+	LogUploadHandler(m)(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"location":"https://logs.example.com/new.tgz"`) {
+		t.Fatalf("log upload: %d %s", rr.Code, rr.Body)
+	}
+
+	req = httptest.NewRequest("POST", "/?poll=soon", nil)
+	req.SetPathValue("id", "mac:112233445566")
+	rr = httptest.NewRecorder()
+	LogUploadHandler(m)(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad poll interval, got %d", rr.Code)
+	}
+}
+
+func TestMaintenanceWindowEnforced(t *testing.T) {
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"statusCode":200}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = "http://talaria.invalid"
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	opts.Audit = &recordingAudit{}
+	// a one-hour window opening two hours from now
+	opts.Maintenance.Devices = map[dm.DeviceID]dm.MaintenanceWindow{
+		"mac:112233445566": {Start: time.Now().UTC().Add(2 * time.Hour).Format("15:04"), Duration: "1h"},
+	}
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	do := func(h http.HandlerFunc, method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.SetPathValue("id", "mac:112233445566")
+		rr := httptest.NewRecorder()
+		h(rr, req)
+		return rr
+	}
+	if rr := do(RebootHandler(m), "POST", "/"); rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), dm.ErrOutsideMaintenanceWindow.Error()) {
+		t.Fatalf("expected 409 outside the window, got %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(RebootHandler(m), "POST", "/?force=true"); rr.Code != http.StatusAccepted {
+		t.Fatalf("forced reboot: %d %s", rr.Code, rr.Body)
+	}
+	// with authorization in use only admins may force, and the override is audited
+	as := func(role dm.Role, h http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/?force=true", nil)
+		req.SetPathValue("id", "mac:112233445566")
+		rr := httptest.NewRecorder()
+		h(rr, req.WithContext(dm.WithRole(req.Context(), role)))
+		return rr
+	}
+	if rr := as(dm.RoleOperator, RebootHandler(m)); rr.Code != http.StatusForbidden {
+		t.Fatalf("operator force: %d %s", rr.Code, rr.Body)
+	}
+	if rr := as(dm.RoleAdmin, RebootHandler(m)); rr.Code != http.StatusAccepted {
+		t.Fatalf("admin force: %d %s", rr.Code, rr.Body)
+	}
+	audit := opts.Audit.(*recordingAudit)
+	audit.mu.Lock()
+	last := audit.records[len(audit.records)-1]
+	audit.mu.Unlock()
+	if !last.Override || last.Role != dm.RoleAdmin || last.Err != nil {
+		t.Fatalf("forced reboot audit = %+v", last)
+	}
+	rr := do(MaintenanceHandler(m), "GET", "/")
+	var body struct {
+		Open   bool                  `json:"open"`
+		Next   time.Time             `json:"next"`
+		Window *dm.MaintenanceWindow `json:"window"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Open || body.Window == nil || time.Until(body.Next) < time.Hour {
+		t.Fatalf("unexpected maintenance %s", rr.Body)
+	}
+	if _, err := manager.New(dm.Options{TalariaBaseURL: "http://x", Maintenance: dm.MaintenanceConfig{Default: &dm.MaintenanceWindow{Start: "now"}}}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("expected invalid window to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+	"github.com/xmidt-org/talaria/devicemgr/policy"
+)
+
+// LintFirmwareRulesHandler serves GET /api/policy/firmware/lint: the findings of linting every
+// firmware rule, in evaluation order.
+func LintFirmwareRulesHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		rep, err := m.LintFirmwareRules(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rep)
+	}
+}
+
+// CheckFirmwareRuleHandler serves POST /api/policy/firmware/rules/check with an xconf firmware
+// rule, answering 200 with the findings that involve it, or 409 with them when saving it would
+// conflict with the rules in xconf.
+func CheckFirmwareRuleHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var rule policy.FirmwareRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		rep, err := m.CheckFirmwareRule(r.Context(), rule)
+		switch {
+		case errors.Is(err, dm.ErrRuleConflict):
+			writeProblemBody(w, struct {
+				Problem
+				Rules    int              `json:"rules"`
+				Findings []policy.Finding `json:"findings"`
+			}{NewProblem(http.StatusConflict, dm.CodeRuleConflict, err), rep.Rules, rep.Findings})
+		case err != nil:
+			writeError(w, err)
+		default:
+			writeJSON(w, http.StatusOK, rep)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// LockOwnerHeader names the configuration lock owner a request's SETs are made for.
+const LockOwnerHeader = "X-Devicemgr-Lock-Owner"
+
+// LockOwner applies the LockOwnerHeader of every request handled by next (dm.WithLockOwner), so
+// the owner of a configuration lock can keep changing the device through any route.
+func LockOwner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if owner := r.Header.Get(LockOwnerHeader); owner != "" {
+			r = r.WithContext(dm.WithLockOwner(r.Context(), owner))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// lockRequest is the body of a lock or renewal: the owner and the lease, a Go duration.
+type lockRequest struct {
+	Owner string `json:"owner"`
+	TTL   string `json:"ttl"`
+}
+
+func decodeLockRequest(r *http.Request) (string, time.Duration, error) {
+	var req lockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return "", 0, fmt.Errorf("invalid lock request: %v: %w", err, dm.ErrInvalidParameter)
+	}
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil {
+		return "", 0, fmt.Errorf("ttl %q: %w", req.TTL, dm.ErrInvalidParameter)
+	}
+	return req.Owner, ttl, nil
+}
+
+// GetLockHandler serves GET /api/devices/{id}/lock.
+func GetLockHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		l, err := m.Lock(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, l)
+	}
+}
+
+// AcquireLockHandler serves POST /api/devices/{id}/lock with {"owner", "ttl"}; a lock of another
+// owner is 409 lock_held, naming it.
+func AcquireLockHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		owner, ttl, err := decodeLockRequest(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		l, err := m.AcquireLock(r.Context(), id, owner, ttl)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, l)
+	}
+}
+
+// RenewLockHandler serves POST /api/devices/{id}/lock/renew with {"owner", "ttl"}.
+func RenewLockHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		owner, ttl, err := decodeLockRequest(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		l, err := m.RenewLock(r.Context(), id, owner, ttl)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, l)
+	}
+}
+
+// ReleaseLockHandler serves DELETE /api/devices/{id}/lock?owner=, releasing the owner's lock.
+func ReleaseLockHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		if err := m.ReleaseLock(r.Context(), id, r.URL.Query().Get("owner")); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ForceReleaseLockHandler serves POST /api/devices/{id}/lock/force-release, removing the lock
+// whoever holds it.
+func ForceReleaseLockHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		if err := m.ForceReleaseLock(r.Context(), id); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
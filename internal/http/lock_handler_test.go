@@ -0,0 +1,78 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+func TestLockHandlers(t *testing.T) {
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"statusCode":200}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = "http://talaria.invalid"
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	opts.Audit = &recordingAudit{}
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/devices/{id}/lock", GetLockHandler(m))
+	mux.Handle("POST /api/devices/{id}/lock", AcquireLockHandler(m))
+	mux.Handle("POST /api/devices/{id}/lock/renew", RenewLockHandler(m))
+	mux.Handle("DELETE /api/devices/{id}/lock", ReleaseLockHandler(m))
+	mux.Handle("POST /api/devices/{id}/lock/force-release", ForceReleaseLockHandler(m))
+	mux.Handle("PATCH /api/devices/{id}/params", SetParamsHandler(m))
+	h := LockOwner(mux)
+	do := func(method, target, owner, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if owner != "" {
+			req.Header.Set(LockOwnerHeader, owner)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	const dev = "/api/devices/mac:112233445566"
+	const set = `{"parameters":[{"name":"Device.WiFi.SSID.1.SSID","value":"x","dataType":"string"}]}`
+
+	if rr := do("POST", dev+"/lock", "", `{"owner":"ci","ttl":"soon"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad ttl: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("POST", dev+"/lock", "", `{"owner":"ci","ttl":"5m"}`); rr.Code != http.StatusOK {
+		t.Fatalf("lock: %d %s", rr.Code, rr.Body)
+	}
+	rr := do("PATCH", dev+"/params", "", set)
+	var p Problem
+	if rr.Code != http.StatusConflict || json.Unmarshal(rr.Body.Bytes(), &p) != nil || p.Code != dm.CodeLockHeld || p.Lock == nil || p.Lock.Owner != "ci" {
+		t.Fatalf("unowned set: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("PATCH", dev+"/params", "ci", set); rr.Code != http.StatusOK {
+		t.Fatalf("owner's set: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("POST", dev+"/lock", "", `{"owner":"other","ttl":"5m"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("foreign lock: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("POST", dev+"/lock/renew", "", `{"owner":"ci","ttl":"10m"}`); rr.Code != http.StatusOK {
+		t.Fatalf("renew: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("DELETE", dev+"/lock?owner=other", "", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("foreign release: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("POST", dev+"/lock/force-release", "", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("force release: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do("GET", dev+"/lock", "", ""); rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), dm.CodeLockNotFound) {
+		t.Fatalf("lock after release: %d %s", rr.Code, rr.Body)
+	}
+}
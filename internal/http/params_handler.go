@@ -0,0 +1,253 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+type setParamsRequest struct {
+	Parameters []struct {
+		Name       string                 `json:"name"`
+		Value      interface{}            `json:"value,omitempty"`
+		DataType   string                 `json:"dataType,omitempty"`
+		Attributes map[string]interface{} `json:"attributes,omitempty"`
+	} `json:"parameters"`
+	TestAndSet *struct {
+		OldCID string `json:"oldCid,omitempty"`
+		NewCID string `json:"newCid"`
+	} `json:"testAndSet,omitempty"`
+}
+
+// GetParamsHandler serves GET /api/devices/{id}/params?names=a,b[&service=svc].
+func GetParamsHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var names []string
+		for _, n := range strings.Split(r.URL.Query().Get("names"), ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				names = append(names, n)
+			}
+		}
+		if len(names) == 0 {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		service, err := m.ResolveService(r.URL.Query().Get("service"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		values, err := m.GetParameters(r.Context(), id, service, names)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"parameters": values})
+	}
+}
+
+// GetConfigHandler serves GET /api/devices/{id}/config?paths=Device.WiFi.,Device.Firewall.[&service=svc],
+// reading the subtrees through the configuration CID cache.
+func GetConfigHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var paths []string
+		for _, p := range strings.Split(r.URL.Query().Get("paths"), ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				paths = append(paths, p)
+			}
+		}
+		if len(paths) == 0 {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		doc, err := m.GetConfig(r.Context(), id, r.URL.Query().Get("service"), paths)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, doc)
+	}
+}
+
+// SetParamsHandler serves PATCH /api/devices/{id}/params; with ?dryRun=true it reports the
+// validated SET and its predicted outcome instead of sending it.
+func SetParamsHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		service, err := m.ResolveService(r.URL.Query().Get("service"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		var req setParamsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Parameters) == 0 {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		params := make([]dm.SetParameter, 0, len(req.Parameters))
+		for _, p := range req.Parameters {
+			params = append(params, dm.SetParameter{Name: p.Name, Value: p.Value, TypeHint: p.DataType, Attributes: p.Attributes})
+		}
+		var opts dm.SetOptions
+		if req.TestAndSet != nil {
+			opts.TestAndSet = &dm.CASCondition{OldCID: req.TestAndSet.OldCID, NewCID: req.TestAndSet.NewCID}
+		}
+		opts.DryRun = r.URL.Query().Get("dryRun") == "true"
+		res, err := m.SetParameters(r.Context(), id, service, params, opts)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if res.DryRun != nil {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"dryRun": res.DryRun})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"applied": res.Applied})
+	}
+}
+
+// WatchParamsHandler serves GET /api/devices/{id}/params/watch?names=a,b as Server-Sent Events: it
+// turns on value-change notifications for names and sends a "change" event per reported change
+// until the client disconnects, when the notifications are turned off again.
+func WatchParamsHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var names []string
+		for _, n := range strings.Split(r.URL.Query().Get("names"), ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				names = append(names, n)
+			}
+		}
+		if len(names) == 0 {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		watch, err := m.ParamWatch(r.Context(), id, names)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		defer watch.Close()
+		rc := http.NewResponseController(w)
+		_ = rc.SetWriteDeadline(time.Time{})
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		heartbeat := time.NewTicker(EventsHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			case c, ok := <-watch.C():
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(c)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers with a Problem for err, mapping devicemgr sentinel errors to HTTP statuses
+// and dm.ErrorCode codes. It relays a backend's Retry-After, and names the operation holding a
+// device for an *dm.OperationConflictError and the lock for a *dm.LockHeldError.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	code := dm.ErrorCode(err)
+	switch {
+	case errors.Is(err, dm.ErrDeviceNotFound), errors.Is(err, dm.ErrPolicyNotFound), errors.Is(err, dm.ErrSessionNotFound), errors.Is(err, dm.ErrCallNotFound),
+		errors.Is(err, dm.ErrSubscriptionNotFound), errors.Is(err, dm.ErrQuarantineNotFound), errors.Is(err, dm.ErrLockNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, dm.ErrInvalidParameter):
+		status = http.StatusBadRequest
+	case errors.Is(err, dm.ErrAccessDenied):
+		status = http.StatusForbidden
+	case errors.Is(err, dm.ErrConflict), errors.Is(err, dm.ErrRuleConflict), errors.Is(err, dm.ErrOutsideMaintenanceWindow), errors.Is(err, dm.ErrCanceled),
+		errors.Is(err, dm.ErrLockHeld):
+		status = http.StatusConflict
+	case errors.Is(err, dm.ErrQuarantined):
+		status = http.StatusLocked
+	case errors.Is(err, dm.ErrCursorExpired):
+		status = http.StatusGone
+	case errors.Is(err, dm.ErrConfirmationRequired):
+		status = http.StatusPreconditionRequired
+	case errors.Is(err, dm.ErrTimeout):
+		status = http.StatusGatewayTimeout
+	case errors.Is(err, dm.ErrBackendUnavailable), errors.Is(err, dm.ErrDeviceOffline):
+		status = http.StatusServiceUnavailable
+		if code == dm.CodeRateLimited {
+			status = http.StatusTooManyRequests
+		}
+		if after, ok := dm.RetryAfter(err); ok {
+			// pass the backend's hint on, rounded up to whole seconds
+			w.Header().Set("Retry-After", strconv.Itoa(int((after+time.Second-1)/time.Second)))
+		}
+	}
+	p := NewProblem(status, code, err)
+	var conflict *dm.OperationConflictError
+	if errors.As(err, &conflict) {
+		// name the holder so the caller can decide whether to wait or cancel it
+		p.Holder = &conflict.Holder
+	}
+	var held *dm.LockHeldError
+	if errors.As(err, &held) {
+		p.Lock = &held.Holder
+	}
+	p.WDMP = describeWDMP(err)
+	writeProblemBody(w, p)
+}
+
+// pathDeviceID canonicalizes the {id} path value with dm.ParseDeviceID, writing a 400 and
+// reporting false when it is not a valid device ID.
+func pathDeviceID(w http.ResponseWriter, r *http.Request) (dm.DeviceID, bool) {
+	id, err := dm.ParseDeviceID(r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return "", false
+	}
+	return id, true
+}
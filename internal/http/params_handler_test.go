@@ -0,0 +1,161 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+func TestWatchParamsHandler(t *testing.T) {
+	var mu sync.Mutex
+	var commands []string
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Command    string `json:"command"`
+			Parameters []struct {
+				Name       string                 `json:"name"`
+				Attributes map[string]interface{} `json:"attributes"`
+			} `json:"parameters"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		for _, p := range body.Parameters {
+			commands = append(commands, body.Command+" "+p.Name+" notify="+strings.TrimSpace(string(mustJSON(p.Attributes["notify"]))))
+		}
+		mu.Unlock()
+		w.Write([]byte(`{"statusCode":200}`))
+	}))
+	defer tr1d1um.Close()
+	// the device reports one watched and one unwatched change over Blizzard
+	upgrader := websocket.Upgrader{}
+	gw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		time.Sleep(50 * time.Millisecond)
+		c.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","method":"param.notify","params":{"notifyPayload":{"paramName":"Device.DeviceInfo.UpTime","paramValue":"7"}}}`))
+		c.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","method":"param.notify","params":{"parameters":[{"name":"Device.Time.Enable","value":true},{"name":"Device.WiFi.SSID.1.SSID","value":"home","dataType":"string"}]}}`))
+		c.ReadMessage()
+	}))
+	defer gw.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = "http://talaria.invalid"
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	opts.BlizzardBaseURL = "ws" + strings.TrimPrefix(gw.URL, "http")
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/devices/{id}/params/watch", WatchParamsHandler(m))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/devices/mac:112233445566/params/watch?names=Device.DeviceInfo.UpTime,Device.WiFi.", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	var changes []manager.ParamChange
+	sc := bufio.NewScanner(resp.Body)
+	for len(changes) < 2 && sc.Scan() {
+		if data, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+			var c manager.ParamChange
+			if err := json.Unmarshal([]byte(data), &c); err != nil {
+				t.Fatal(err)
+			}
+			changes = append(changes, c)
+		}
+	}
+	resp.Body.Close()
+	if len(changes) != 2 || changes[0].Name != "Device.DeviceInfo.UpTime" || changes[0].Value != "7" || changes[1].Name != "Device.WiFi.SSID.1.SSID" || changes[1].DataType != "string" {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+
+	// disconnecting turns notifications off again
+	want := []string{
+		"SET_ATTRIBUTES Device.DeviceInfo.UpTime notify=1", "SET_ATTRIBUTES Device.WiFi. notify=1",
+		"SET_ATTRIBUTES Device.DeviceInfo.UpTime notify=0", "SET_ATTRIBUTES Device.WiFi. notify=0",
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		got := strings.Join(commands, "|")
+		mu.Unlock()
+		if got == strings.Join(want, "|") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected commands %q", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/api/devices/mac:112233445566/params/watch", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("missing names: %d", rec.Code)
+	}
+}
+
+func mustJSON(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+func TestGetParamsHandlerCanonicalizesDeviceID(t *testing.T) {
+	var paths []string
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"parameters":{}}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = "http://talaria.invalid"
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/devices/{id}/params", GetParamsHandler(m))
+	for id, want := range map[string]int{"AA-BB-CC-DD-EE-FF": http.StatusOK, "mac:AABB.CCDD.EEFF": http.StatusOK, "mac:aabbcc": http.StatusBadRequest, "imei:1": http.StatusBadRequest} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/devices/"+id+"/params?names=Device.X", nil))
+		if rr.Code != want {
+			t.Fatalf("%s: status %d %s", id, rr.Code, rr.Body)
+		}
+	}
+	for _, p := range paths {
+		if p != "/device/mac:aabbccddeeff/config" {
+			t.Fatalf("backend request for %s", p)
+		}
+	}
+	if len(paths) != 2 {
+		t.Fatalf("expected 2 backend requests, got %v", paths)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/devices/mac:aabbccddeeff/params?names=Device.X&service=confg", nil))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "config") || len(paths) != 2 {
+		t.Fatalf("unknown service: %d %s", rr.Code, rr.Body)
+	}
+}
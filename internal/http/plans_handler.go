@@ -0,0 +1,67 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+)
+
+// CreatePlanHandler serves POST /api/plans with a jobs.PlanSpec body, answering 201 with the plan.
+func CreatePlanHandler(p *jobs.Planner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var spec jobs.PlanSpec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		plan, err := p.PlanChange(r.Context(), spec)
+		if err != nil {
+			writePlanError(w, err)
+			return
+		}
+		w.Header().Set("Location", apiPath(r, "/api/plans/"+plan.ID))
+		writeJSON(w, http.StatusCreated, plan)
+	}
+}
+
+// GetPlanHandler serves GET /api/plans/{id}.
+func GetPlanHandler(p *jobs.Planner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		plan, err := p.Get(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writePlanError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, plan)
+	}
+}
+
+// ApplyPlanHandler serves POST /api/plans/{id}/apply, answering 202 with the job writing the plan.
+func ApplyPlanHandler(p *jobs.Planner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		j, err := p.ApplyChange(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writePlanError(w, err)
+			return
+		}
+		w.Header().Set("Location", apiPath(r, "/api/jobs/"+j.ID))
+		writeJSON(w, http.StatusAccepted, j)
+	}
+}
+
+func writePlanError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrPlanNotFound):
+		writeProblem(w, http.StatusNotFound, CodePlanNotFound, err)
+	case errors.Is(err, jobs.ErrPlanApplied):
+		writeProblem(w, http.StatusConflict, CodePlanApplied, err)
+	default:
+		writeError(w, err)
+	}
+}
@@ -0,0 +1,33 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type prefixKey struct{}
+
+// MountAt serves next under prefix, such as "/devicemgr": the prefix is stripped before routing
+// and put back on the paths handlers return to clients, like Location headers. Requests outside
+// the prefix get 404. An empty prefix serves next as is.
+func MountAt(prefix string, next http.Handler) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return next
+	}
+	strip := http.StripPrefix(prefix, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		strip.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), prefixKey{}, prefix)))
+	})
+}
+
+// apiPath returns the API path as the client addresses it, under the MountAt prefix if any and
+// the version of a Versioned route.
+func apiPath(r *http.Request, path string) string {
+	prefix, _ := r.Context().Value(prefixKey{}).(string)
+	if v, ok := r.Context().Value(versionKey{}).(string); ok {
+		path = "/api/" + v + strings.TrimPrefix(path, "/api")
+	}
+	return prefix + path
+}
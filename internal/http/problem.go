@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/translate"
+)
+
+// ProblemContentType is the media type of the API's error bodies (RFC 7807).
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypePrefix prefixes a Problem's code to form its type URI.
+const ProblemTypePrefix = "urn:devicemgr:problem:"
+
+// Problem is the body of every API error: RFC 7807 problem details plus Code, the stable
+// machine-readable error code (dm.ErrorCode, or a component's own such as "job_not_found"), and
+// Error, the message error bodies carried before problem details.
+type Problem struct {
+	Type   string `json:"type"`  // ProblemTypePrefix + Code
+	Title  string `json:"title"` // the status text
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+	Error  string `json:"error"` // the same as Detail
+	// Holder is the operation holding the device of an operation_conflict.
+	Holder *dm.DeviceOperation `json:"holder,omitempty"`
+	// Lock is the configuration lock of another owner refusing a lock_held request.
+	Lock *dm.ConfigLock `json:"lock,omitempty"`
+	// WDMP describes the device fault of a request a WDMP reply refused (translate.StatusError),
+	// in the language set by SetErrorLanguage.
+	WDMP *translate.ErrorDescription `json:"wdmp,omitempty"`
+}
+
+// errorLanguage holds the language set by SetErrorLanguage.
+var errorLanguage atomic.Value
+
+// SetErrorLanguage sets the language of the WDMP fault descriptions in error bodies, a tag such
+// as "es" or "fr-CA" looked up in translate.DefaultErrorCatalog; empty is English.
+func SetErrorLanguage(lang string) {
+	errorLanguage.Store(lang)
+}
+
+// describeWDMP describes the WDMP fault in err's chain, or returns nil.
+func describeWDMP(err error) *translate.ErrorDescription {
+	lang, _ := errorLanguage.Load().(string)
+	d, ok := translate.DefaultErrorCatalog().DescribeError(err, lang)
+	if !ok {
+		return nil
+	}
+	return &d
+}
+
+// Codes of the components' own not-found and state errors.
+const (
+	CodeJobNotFound        = "job_not_found"
+	CodeTemplateNotFound   = "template_not_found"
+	CodePlanNotFound       = "plan_not_found"
+	CodePlanApplied        = "plan_applied"
+	CodeProfileNotFound    = "profile_not_found"
+	CodeNothingApplied     = "nothing_applied"
+	CodeSnapshotNotFound   = "snapshot_not_found"
+	CodeWebhookNotFound    = "webhook_not_found"
+	CodeNoteNotFound       = "note_not_found"
+	CodeUpdateNotFound     = "update_not_found"
+	CodeRolloutNotFound    = "rollout_not_found"
+	CodeAssignmentNotFound = "assignment_not_found"
+	CodeUnauthenticated    = "unauthenticated"
+	CodeIdempotencyKey     = "idempotency_key"
+	CodeRouteRetired       = "route_retired"
+)
+
+// NewProblem describes err, or the status alone when err is nil.
+func NewProblem(status int, code string, err error) Problem {
+	p := Problem{Type: ProblemTypePrefix + code, Title: http.StatusText(status), Status: status, Code: code}
+	if err != nil {
+		p.Detail, p.Error = err.Error(), err.Error()
+	}
+	return p
+}
+
+// writeProblem answers with a Problem for err.
+func writeProblem(w http.ResponseWriter, status int, code string, err error) {
+	writeProblemBody(w, NewProblem(status, code, err))
+}
+
+// writeProblemBody answers with body, a Problem or a struct embedding one with further members.
+func writeProblemBody(w http.ResponseWriter, body interface{ problem() Problem }) {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(body.problem().Status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (p Problem) problem() Problem { return p }
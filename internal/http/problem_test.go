@@ -0,0 +1,75 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/translate"
+)
+
+func TestWriteErrorProblem(t *testing.T) {
+	for _, c := range []struct {
+		err    error
+		status int
+		code   string
+		retry  string
+	}{
+		{fmt.Errorf("get: %w", dm.ErrDeviceNotFound), http.StatusNotFound, dm.CodeDeviceNotFound, ""},
+		{&dm.BackendError{Backend: "tr1d1um", Status: 503, RetryAfter: 1500 * time.Millisecond}, http.StatusServiceUnavailable, dm.CodeBackendUnavailable, "2"},
+		{&dm.BackendError{Backend: "tr1d1um", Status: 429, RetryAfter: time.Second}, http.StatusTooManyRequests, dm.CodeRateLimited, "1"},
+		{dm.ErrCircuitOpen, http.StatusServiceUnavailable, dm.CodeCircuitOpen, ""},
+		{errors.New("boom"), http.StatusInternalServerError, dm.CodeInternal, ""},
+	} {
+		rec := httptest.NewRecorder()
+		writeError(rec, c.err)
+		var p Problem
+		if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != c.status || rec.Header().Get("Content-Type") != ProblemContentType || rec.Header().Get("Retry-After") != c.retry {
+			t.Errorf("%v: %d %v", c.err, rec.Code, rec.Header())
+		}
+		if p.Status != c.status || p.Code != c.code || p.Type != ProblemTypePrefix+c.code || p.Title != http.StatusText(c.status) || p.Detail != c.err.Error() || p.Error != p.Detail {
+			t.Errorf("%v: problem %+v", c.err, p)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	writeJobError(rec, fmt.Errorf("job x: %w", jobs.ErrJobNotFound))
+	if !json.Valid(rec.Body.Bytes()) || rec.Code != http.StatusNotFound {
+		t.Fatalf("job error %d %s", rec.Code, rec.Body)
+	}
+	var p Problem
+	_ = json.Unmarshal(rec.Body.Bytes(), &p)
+	if p.Code != CodeJobNotFound {
+		t.Fatalf("job error code %q", p.Code)
+	}
+}
+
+func TestWriteErrorWDMPFault(t *testing.T) {
+	SetErrorLanguage("es")
+	defer SetErrorLanguage("")
+	err := &translate.StatusError{Status: 520, Fault: 9005, Message: "Invalid parameter name", Parameter: "Device.Bogus", Err: &dm.BackendError{Backend: "tr1d1um", Status: 520}}
+	rec := httptest.NewRecorder()
+	writeError(rec, fmt.Errorf("set: %w", err))
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != dm.CodeBackendUnavailable || p.WDMP == nil || p.WDMP.Name != "invalid_parameter_name" || p.WDMP.Language != "es" || p.WDMP.Parameter != "Device.Bogus" || p.WDMP.Remediation == "" {
+		t.Fatalf("problem %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	writeError(rec, dm.ErrDeviceNotFound)
+	if p := (Problem{}); json.Unmarshal(rec.Body.Bytes(), &p) != nil || p.WDMP != nil {
+		t.Fatalf("problem without a fault: %s", rec.Body)
+	}
+}
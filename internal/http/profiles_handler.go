@@ -0,0 +1,228 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/profiles"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// ListProfilesHandler serves GET /api/profiles (the latest version of each).
+func ListProfilesHandler(svc *profiles.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		list, err := svc.List(r.Context())
+		if err != nil {
+			writeProfileError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"profiles": list})
+	}
+}
+
+// SaveProfileHandler serves PUT /api/profiles/{name} {"description","service","parameters":[...]},
+// answering 201 with the new version.
+func SaveProfileHandler(svc *profiles.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var p profiles.Profile
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		p.Name = r.PathValue("name")
+		saved, err := svc.Save(r.Context(), p)
+		if err != nil {
+			writeProfileError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, saved)
+	}
+}
+
+// GetProfileHandler serves GET /api/profiles/{name}[?version=N], the latest version by default.
+func GetProfileHandler(svc *profiles.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		version, ok := profileVersion(w, r)
+		if !ok {
+			return
+		}
+		p, err := svc.Get(r.Context(), r.PathValue("name"), version)
+		if err != nil {
+			writeProfileError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	}
+}
+
+// ProfileVersionsHandler serves GET /api/profiles/{name}/versions, oldest first.
+func ProfileVersionsHandler(svc *profiles.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		versions, err := svc.Versions(r.Context(), r.PathValue("name"))
+		if err != nil {
+			writeProfileError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"versions": versions})
+	}
+}
+
+type applyGroupRequest struct {
+	Devices     []dm.DeviceID `json:"devices"`
+	Version     int           `json:"version"`
+	Concurrency int           `json:"concurrency"`
+}
+
+// ApplyProfileGroupHandler serves POST /api/profiles/{name}/apply[?query=model:XB7]
+// {"devices":[...],"version":N,"concurrency":N}. Without devices, the group is every device the
+// query selects (within the caller's partner scope). It answers with the per-device results.
+func ApplyProfileGroupHandler(svc *profiles.Service, adapter *runtime.DeviceAdapter, notes *annotation.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var req applyGroupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		devices := req.Devices
+		if len(devices) == 0 {
+			if r.URL.Query().Get("query") == "" {
+				writeError(w, fmt.Errorf("devices or query required: %w", dm.ErrInvalidParameter))
+				return
+			}
+			sel, err := selectDevices(r, adapter, notes)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			sel.each(func(id string, _ *annotation.Annotations) bool {
+				devices = append(devices, dm.DeviceID(id))
+				return true
+			})
+			if len(devices) == 0 {
+				writeJSON(w, http.StatusOK, map[string]interface{}{"results": []interface{}{}})
+				return
+			}
+		}
+		results, err := svc.ApplyGroup(r.Context(), devices, r.PathValue("name"), req.Version, req.Concurrency)
+		if err != nil {
+			writeProfileError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+	}
+}
+
+// DeviceProfilesHandler serves GET /api/devices/{id}/profiles: the profile in effect and the history.
+func DeviceProfilesHandler(svc *profiles.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		st, err := svc.Status(r.Context(), id)
+		if err != nil {
+			writeProfileError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, st)
+	}
+}
+
+// RenderProfileHandler serves GET /api/devices/{id}/profiles/{name}/render[?version=N], the values
+// the profile would write to the device.
+func RenderProfileHandler(svc *profiles.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		version, ok := profileVersion(w, r)
+		if !ok {
+			return
+		}
+		params, err := svc.Render(r.Context(), id, r.PathValue("name"), version)
+		if err != nil {
+			writeProfileError(w, err)
+			return
+		}
+		values := make(map[string]profiles.Value, len(params))
+		for _, p := range params {
+			values[p.Name] = profiles.Value{Value: p.Value, DataType: p.TypeHint}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"values": values})
+	}
+}
+
+// ApplyProfileHandler serves POST /api/devices/{id}/profiles/{name}/apply[?version=N].
+func ApplyProfileHandler(svc *profiles.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		version, ok := profileVersion(w, r)
+		if !ok {
+			return
+		}
+		a, err := svc.Apply(r.Context(), id, r.PathValue("name"), version)
+		if err != nil {
+			writeProfileError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, a)
+	}
+}
+
+// RollbackProfileHandler serves POST /api/devices/{id}/profiles/rollback.
+func RollbackProfileHandler(svc *profiles.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		a, err := svc.Rollback(r.Context(), id)
+		if err != nil {
+			writeProfileError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, a)
+	}
+}
+
+func profileVersion(w http.ResponseWriter, r *http.Request) (int, bool) {
+	raw := r.URL.Query().Get("version")
+	if raw == "" {
+		return 0, true
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 1 {
+		writeError(w, fmt.Errorf("version %q: %w", raw, dm.ErrInvalidParameter))
+		return 0, false
+	}
+	return v, true
+}
+
+func writeProfileError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, profiles.ErrProfileNotFound):
+		writeProblem(w, http.StatusNotFound, CodeProfileNotFound, err)
+	case errors.Is(err, profiles.ErrNothingApplied):
+		writeProblem(w, http.StatusConflict, CodeNothingApplied, err)
+	default:
+		writeError(w, err)
+	}
+}
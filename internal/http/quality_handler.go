@@ -0,0 +1,59 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/quality"
+)
+
+// QualityHandler serves GET /api/quality[?limit=20&below=80]: the sampled devices' connection
+// quality scores, worst first, within the caller's partner scope.
+func QualityHandler(c *quality.Collector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		q := r.URL.Query()
+		limit, below := 0, 101
+		for _, p := range []struct {
+			key string
+			dst *int
+		}{{"limit", &limit}, {"below", &below}} {
+			if v := q.Get(p.key); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n <= 0 {
+					writeError(w, dm.ErrInvalidParameter)
+					return
+				}
+				*p.dst = n
+			}
+		}
+		scores := c.Scores(r.Context())
+		out := make([]quality.Score, 0, len(scores))
+		for _, s := range scores {
+			if s.Score >= below || (limit > 0 && len(out) == limit) {
+				break // worst first
+			}
+			out = append(out, s)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"sampled": len(scores), "devices": out})
+	}
+}
+
+// DeviceQualityHandler serves GET /api/devices/{id}/quality, the device's latest score; a device
+// not yet sampled is sampled now.
+func DeviceQualityHandler(c *quality.Collector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		s, err := c.Score(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s)
+	}
+}
@@ -0,0 +1,134 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// QuarantineOverride applies ?overrideQuarantine=true to every request handled by next, so an
+// admin may change a quarantined device through any route; the manager refuses the override to
+// other roles (dm.OverrideAllowed) and records it in the operation's audit record.
+func QuarantineOverride(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("overrideQuarantine") == "true" {
+			r = r.WithContext(dm.WithQuarantineOverride(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// quarantineRequest is the body placing a quarantine: its target, reason and expiry, an until
+// or a ttl, one of which is required.
+type quarantineRequest struct {
+	expiry
+	DeviceID dm.DeviceID `json:"deviceId"`
+	Group    string      `json:"group"`
+	Reason   string      `json:"reason"`
+}
+
+func (req quarantineRequest) quarantine() (dm.Quarantine, error) {
+	if req.Until.IsZero() && req.TTL == "" {
+		return dm.Quarantine{}, fmt.Errorf("quarantine: until or ttl required: %w", dm.ErrInvalidParameter)
+	}
+	until, err := req.resolve()
+	if err != nil {
+		return dm.Quarantine{}, err
+	}
+	return dm.Quarantine{DeviceID: req.DeviceID, Group: req.Group, Reason: req.Reason, Until: until}, nil
+}
+
+// ListQuarantinesHandler serves GET /api/quarantines, the quarantines in force.
+func ListQuarantinesHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"quarantines": m.Quarantines(r.Context())})
+	}
+}
+
+// QuarantineHandler serves POST /api/quarantines with {"deviceId" or "group", "reason", "until"
+// or "ttl"}.
+func QuarantineHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var req quarantineRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, fmt.Errorf("invalid quarantine: %v: %w", err, dm.ErrInvalidParameter))
+			return
+		}
+		q, err := req.quarantine()
+		if err == nil {
+			q, err = m.Quarantine(r.Context(), q)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, q)
+	}
+}
+
+// ReleaseQuarantineHandler serves DELETE /api/quarantines/{qid}.
+func ReleaseQuarantineHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		if err := m.Release(r.Context(), r.PathValue("qid")); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeviceQuarantineHandler serves the quarantine of one device: GET /api/devices/{id}/quarantine
+// (the quarantine in force, its own or its group's), POST with {"reason", "until" or "ttl"} to
+// place it and DELETE to lift the device's own.
+func DeviceQuarantineHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if _, scoped := dm.PartnersFromContext(r.Context()); scoped {
+				if _, err := m.Device(r.Context(), id); err != nil {
+					writeError(w, err)
+					return
+				}
+			}
+			q := m.QuarantineOf(id)
+			if q == nil {
+				writeError(w, fmt.Errorf("device %s: %w", id, dm.ErrQuarantineNotFound))
+				return
+			}
+			writeJSON(w, http.StatusOK, q)
+		case http.MethodDelete:
+			if err := m.Release(r.Context(), dm.QuarantineID(id, "")); err != nil {
+				writeError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			var req quarantineRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, fmt.Errorf("invalid quarantine: %v: %w", err, dm.ErrInvalidParameter))
+				return
+			}
+			req.DeviceID, req.Group = id, ""
+			q, err := req.quarantine()
+			if err == nil {
+				q, err = m.Quarantine(r.Context(), q)
+			}
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusCreated, q)
+		}
+	}
+}
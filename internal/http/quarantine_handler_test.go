@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+func TestQuarantineHandlers(t *testing.T) {
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"statusCode":200}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = "http://talaria.invalid"
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	opts.Audit = &recordingAudit{}
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/quarantines", ListQuarantinesHandler(m))
+	mux.Handle("POST /api/quarantines", QuarantineHandler(m))
+	mux.Handle("DELETE /api/quarantines/{qid}", ReleaseQuarantineHandler(m))
+	mux.Handle("/api/devices/{id}/quarantine", DeviceQuarantineHandler(m))
+	mux.Handle("POST /api/devices/{id}/reboot", RebootHandler(m))
+	h := QuarantineOverride(mux)
+	do := func(role dm.Role, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if role != dm.RoleNone {
+			req = req.WithContext(dm.WithRole(req.Context(), role))
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do(dm.RoleNone, "POST", "/api/devices/mac:112233445566/quarantine", `{"reason":"INC-7"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("quarantine without expiry: %d %s", rr.Code, rr.Body)
+	}
+	rr := do(dm.RoleNone, "POST", "/api/devices/mac:112233445566/quarantine", `{"reason":"INC-7","ttl":"1h"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("quarantine: %d %s", rr.Code, rr.Body)
+	}
+	var q dm.Quarantine
+	if err := json.Unmarshal(rr.Body.Bytes(), &q); err != nil || q.ID != "device:mac:112233445566" || q.Reason != "INC-7" {
+		t.Fatalf("quarantine body %s", rr.Body)
+	}
+	if rr := do(dm.RoleNone, "POST", "/api/devices/mac:112233445566/reboot", ""); rr.Code != http.StatusLocked || !strings.Contains(rr.Body.String(), dm.CodeQuarantined) {
+		t.Fatalf("reboot while quarantined: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(dm.RoleOperator, "POST", "/api/devices/mac:112233445566/reboot?overrideQuarantine=true", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("operator override: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(dm.RoleAdmin, "POST", "/api/devices/mac:112233445566/reboot?overrideQuarantine=true", ""); rr.Code != http.StatusAccepted {
+		t.Fatalf("admin override: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(dm.RoleNone, "GET", "/api/devices/mac:112233445566/quarantine", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "INC-7") {
+		t.Fatalf("device quarantine: %d %s", rr.Code, rr.Body)
+	}
+
+	if rr := do(dm.RoleNone, "POST", "/api/quarantines", `{"group":"comcast","until":"2000-01-01T00:00:00Z"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("quarantine in the past: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(dm.RoleNone, "POST", "/api/quarantines", `{"group":"comcast","ttl":"30m"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("group quarantine: %d %s", rr.Code, rr.Body)
+	}
+	rr = do(dm.RoleNone, "GET", "/api/quarantines", "")
+	var list struct {
+		Quarantines []dm.Quarantine `json:"quarantines"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list.Quarantines) != 2 {
+		t.Fatalf("list: %s", rr.Body)
+	}
+	if rr := do(dm.RoleNone, "DELETE", "/api/quarantines/group:comcast", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("release group: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(dm.RoleNone, "DELETE", "/api/devices/mac:112233445566/quarantine", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("release device: %d %s", rr.Code, rr.Body)
+	}
+	if rr := do(dm.RoleNone, "GET", "/api/devices/mac:112233445566/quarantine", ""); rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), dm.CodeQuarantineNotFound) {
+		t.Fatalf("released device quarantine: %d %s", rr.Code, rr.Body)
+	}
+}
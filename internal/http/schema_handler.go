@@ -0,0 +1,121 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/apischema"
+	"github.com/xmidt-org/talaria/devicemgr/compliance"
+	"github.com/xmidt-org/talaria/devicemgr/diagnostics"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+	"github.com/xmidt-org/talaria/devicemgr/firmware"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+	"github.com/xmidt-org/talaria/devicemgr/policy"
+	"github.com/xmidt-org/talaria/devicemgr/profiles"
+	"github.com/xmidt-org/talaria/devicemgr/quality"
+	"github.com/xmidt-org/talaria/devicemgr/settings"
+	"github.com/xmidt-org/talaria/devicemgr/snapshot"
+	"github.com/xmidt-org/talaria/devicemgr/whatif"
+)
+
+// Payloads are the named types the API's handlers encode and decode. Add a type here when a
+// handler starts answering with it; a test checks every type reached follows the JSON conventions.
+var Payloads = []apischema.Payload{
+	{Value: DeviceInfo{}},
+	{Value: dm.ParameterValue{}},
+	{Value: dm.DeviceOperation{}},
+	{Value: annotation.Annotations{}},
+	{Value: annotation.Note{}},
+	{Value: manager.FleetStats{}},
+	{Value: manager.StatsSample{}},
+	{Value: manager.TalariaStats{}},
+	{Value: manager.ChangeFeed{}},
+	{Value: manager.LogUpload{}},
+	{Value: jobs.Spec{}},
+	{Value: jobs.Job{}},
+	{Value: jobs.Template{}},
+	{Value: jobs.PlanSpec{}},
+	{Value: jobs.Plan{}},
+	{Value: jobs.Artifact{}},
+	{Value: firmware.Request{}},
+	{Value: firmware.Update{}},
+	{Value: firmware.RolloutSpec{}},
+	{Value: firmware.Rollout{}},
+	{Name: "Event", Value: events.Envelope{}},
+	{Value: events.Webhook{}},
+	{Value: events.DeadLetter{}},
+	{Value: events.TopicBinding{}},
+	{Value: manager.WatchRegistration{}},
+	{Value: SubscriptionInfo{}},
+	{Value: dm.Quarantine{}},
+	{Value: dm.ConfigLock{}},
+	{Value: snapshot.Snapshot{}},
+	{Value: snapshot.Comparison{}},
+	{Value: profiles.Profile{}},
+	{Value: profiles.Status{}},
+	{Value: settings.Assignment{}},
+	{Value: settings.Status{}},
+	{Value: quality.Score{}},
+	{Value: diagnostics.Result{}},
+	{Value: policy.LintReport{}},
+	{Value: policy.FirmwarePolicy{}},
+	{Value: compliance.Report{}},
+	{Value: whatif.Result{}},
+	{Value: Envelope{}},
+	{Value: Problem{}},
+}
+
+// Enums are the API's string enumerations, rendered as TypeScript unions.
+var Enums = []apischema.Enum{
+	{Value: dm.EventKind(""), Values: []string{string(dm.EventOnline), string(dm.EventOffline), string(dm.EventSuspect),
+		string(dm.EventNotification), string(dm.EventCrash), string(dm.EventDrift), string(dm.EventRollout)}},
+	{Value: jobs.Status(""), Values: []string{string(jobs.StatusPending), string(jobs.StatusAwaitingApproval), string(jobs.StatusRunning),
+		string(jobs.StatusSucceeded), string(jobs.StatusFailed), string(jobs.StatusCanceled)}},
+	{Value: firmware.State(""), Values: []string{string(firmware.StatePending), string(firmware.StateDownloading), string(firmware.StateApplying),
+		string(firmware.StateRebooted), string(firmware.StateVerified), string(firmware.StateFailed)}},
+	{Value: firmware.RolloutState(""), Values: []string{string(firmware.RolloutRunning), string(firmware.RolloutPaused),
+		string(firmware.RolloutRollingBack), string(firmware.RolloutRolledBack), string(firmware.RolloutCompleted)}},
+	{Value: firmware.Outcome(""), Values: []string{string(firmware.OutcomePending), string(firmware.OutcomeHealthy), string(firmware.OutcomeFailed),
+		string(firmware.OutcomeRolledBack), string(firmware.OutcomeRollbackFailed)}},
+	{Value: dm.Freshness(0), Values: []string{dm.FreshRealTime.String(), dm.FreshRecentCache.String(), dm.FreshStale.String()}},
+	{Value: dm.SubscriptionKind(""), Values: []string{string(dm.SubscriptionWebhook), string(dm.SubscriptionTopic), string(dm.SubscriptionParamWatch)}},
+	{Value: manager.ChangeType(""), Values: []string{string(manager.ChangeAdded), string(manager.ChangeRemoved), string(manager.ChangeUpdated)}},
+}
+
+var (
+	schemaOnce sync.Once
+	schemaDoc  *apischema.Document
+)
+
+// APISchema returns the definitions of Payloads and Enums.
+func APISchema() *apischema.Document {
+	schemaOnce.Do(func() { schemaDoc = apischema.New(Payloads, Enums...) })
+	return schemaDoc
+}
+
+// APISchemaHandler serves GET /api/schema: the JSON Schema of the API payloads, or with
+// "?format=typescript" their TypeScript definitions.
+func APISchemaHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		switch r.URL.Query().Get("format") {
+		case "", "jsonschema":
+			b, err := APISchema().JSONSchema("")
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/schema+json")
+			_, _ = w.Write(b)
+		case "typescript":
+			w.Header().Set("Content-Type", "application/typescript")
+			_, _ = w.Write(APISchema().TypeScript())
+		default:
+			writeError(w, fmt.Errorf("format must be jsonschema or typescript: %w", dm.ErrInvalidParameter))
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPISchemaFollowsConventions(t *testing.T) {
+	for _, p := range APISchema().Check() {
+		t.Error(p)
+	}
+}
+
+func TestAPISchemaHandler(t *testing.T) {
+	srv := httptest.NewServer(APISchemaHandler())
+	defer srv.Close()
+	get := func(query string) (*http.Response, string) {
+		resp, err := http.Get(srv.URL + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp, string(b)
+	}
+
+	resp, body := get("")
+	var doc struct {
+		Defs map[string]json.RawMessage `json:"$defs"`
+	}
+	if resp.Header.Get("Content-Type") != "application/schema+json" || json.Unmarshal([]byte(body), &doc) != nil {
+		t.Fatalf("json schema: %s %.200s", resp.Header.Get("Content-Type"), body)
+	}
+	for _, name := range []string{"Job", "Event", "ParameterValue", "DeviceInfo", "Freshness"} {
+		if doc.Defs[name] == nil {
+			t.Errorf("no %s definition", name)
+		}
+	}
+
+	_, body = get("?format=typescript")
+	for _, want := range []string{"export interface Job {", "  status: JobsStatus;", `export type Freshness = "realtime" | "recent_cache" | "stale";`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("typescript lacks %q", want)
+		}
+	}
+	if resp, _ := get("?format=xml"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown format: %s", resp.Status)
+	}
+}
@@ -0,0 +1,66 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+	"github.com/xmidt-org/talaria/devicemgr/selector"
+)
+
+// SelectDevicesHandler serves GET /api/devices/select?selector=<expression> (see package
+// selector): the IDs of the devices a job or rollout with that selector would target.
+func SelectDevicesHandler(adapter *runtime.DeviceAdapter, notes *annotation.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		devices, err := selectTargets(r, adapter, notes, r.URL.Query().Get("selector"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"devices": devices, "count": len(devices)})
+	}
+}
+
+// selectTargets evaluates a selector expression against the inventory, with the annotation
+// labels of notes when it is set.
+func selectTargets(r *http.Request, adapter *runtime.DeviceAdapter, notes *annotation.Service, raw string) ([]dm.DeviceID, error) {
+	expr, err := selector.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	var labels map[dm.DeviceID]map[string]string
+	if notes != nil {
+		all, err := notes.All(r.Context())
+		if err != nil {
+			return nil, err
+		}
+		labels = make(map[dm.DeviceID]map[string]string, len(all))
+		for id, a := range all {
+			labels[id] = a.Labels
+		}
+	}
+	return selector.Select(r.Context(), adapter, expr, labels), nil
+}
+
+// resolveSelector fills devices from a spec's selector, which must not be combined with an
+// explicit device list.
+func resolveSelector(r *http.Request, adapter *runtime.DeviceAdapter, notes *annotation.Service, raw string, devices *[]dm.DeviceID) error {
+	if raw == "" {
+		return nil
+	}
+	if len(*devices) > 0 {
+		return fmt.Errorf("devices and selector are exclusive: %w", dm.ErrInvalidParameter)
+	}
+	selected, err := selectTargets(r, adapter, notes, raw)
+	if err != nil {
+		return err
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("selector %q matches no devices: %w", raw, dm.ErrInvalidParameter)
+	}
+	*devices = selected
+	return nil
+}
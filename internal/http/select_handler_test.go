@@ -0,0 +1,47 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+func TestSelectDevicesHandler(t *testing.T) {
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"devices":[{"id":"mac:000000000001","hw-model":"XB7","partnerIDs":"comcast"},{"id":"mac:000000000002","hw-model":"XB7","partnerIDs":"sky"}]}`))
+	}))
+	defer talaria.Close()
+	da := runtime.NewDeviceAdapter(talaria.URL, nil)
+	if _, err := da.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	svc := annotation.NewService(annotatedDevices{}, nil)
+	if _, err := svc.Put(context.Background(), "mac:000000000002", nil, map[string]string{"pilot": "yes"}); err != nil {
+		t.Fatal(err)
+	}
+	get := func(expr string) (*httptest.ResponseRecorder, []dm.DeviceID) {
+		rr := httptest.NewRecorder()
+		SelectDevicesHandler(da, svc)(rr, httptest.NewRequest("GET", "/api/devices/select?"+url.Values{"selector": {expr}}.Encode(), nil))
+		var body struct {
+			Devices []dm.DeviceID `json:"devices"`
+		}
+		json.NewDecoder(rr.Body).Decode(&body)
+		return rr, body.Devices
+	}
+	if rr, ids := get(`model == XB7 && tag:pilot`); rr.Code != 200 || len(ids) != 1 || ids[0] != "mac:000000000002" {
+		t.Fatalf("tagged: %d %v", rr.Code, ids)
+	}
+	if rr, ids := get(`model == XB7`); rr.Code != 200 || len(ids) != 2 {
+		t.Fatalf("all XB7: %d %v", rr.Code, ids)
+	}
+	if rr, _ := get(`model ==`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("malformed selector: %d", rr.Code)
+	}
+}
@@ -0,0 +1,186 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// SessionHeader names the RPC session an /rpc call reuses.
+const SessionHeader = "X-Devicemgr-Session"
+
+// CallHeader names an /rpc or diagnostics call so DELETE /api/devices/{id}/rpc/{call} can cancel
+// it while it waits for the device.
+const CallHeader = "X-Devicemgr-Call"
+
+// OpenSessionHandler serves POST /api/devices/{id}/sessions [{"service":"config","ttl":"10m"}],
+// answering 201 with the session and its token.
+func OpenSessionHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var req struct {
+			Service string `json:"service"`
+			TTL     string `json:"ttl"` // Go duration
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, dm.ErrInvalidParameter)
+				return
+			}
+		}
+		var ttl time.Duration
+		if req.TTL != "" {
+			d, err := time.ParseDuration(req.TTL)
+			if err != nil {
+				writeError(w, fmt.Errorf("ttl: %w", dm.ErrInvalidParameter))
+				return
+			}
+			ttl = d
+		}
+		s, err := m.OpenSession(r.Context(), id, req.Service, ttl)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, s)
+	}
+}
+
+// SessionHandler serves GET /api/devices/{id}/sessions/{token}.
+func SessionHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		s, err := m.Session(r.Context(), id, r.PathValue("token"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s)
+	}
+}
+
+// CloseSessionHandler serves DELETE /api/devices/{id}/sessions/{token}.
+func CloseSessionHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		if err := m.CloseSession(r.Context(), id, r.PathValue("token")); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RPCHandler serves POST /api/devices/{id}/rpc {"method":"...","params":{...},"service":"config","timeout":"30s"},
+// answering with the JSON-RPC result or error. With the SessionHeader set the call goes through that
+// session's connection, and service is the session's; otherwise a connection is opened for the call.
+// A call named with the CallHeader that is canceled answers 409.
+func RPCHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var req struct {
+			Method  string          `json:"method"`
+			Params  json.RawMessage `json:"params,omitempty"`
+			Service string          `json:"service"`
+			Timeout string          `json:"timeout"` // Go duration
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method == "" {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		call := runtime.BlizzardCall{Method: req.Method}
+		if len(req.Params) > 0 {
+			call.Params = req.Params
+		}
+		if req.Timeout != "" {
+			d, err := time.ParseDuration(req.Timeout)
+			if err != nil {
+				writeError(w, fmt.Errorf("timeout: %w", dm.ErrInvalidParameter))
+				return
+			}
+			call.Timeout = d
+		}
+		var res *runtime.BlizzardResult
+		var err error
+		ctx := callContext(r)
+		if token := r.Header.Get(SessionHeader); token != "" {
+			res, err = m.CallSession(ctx, id, token, call)
+		} else {
+			res, err = m.Call(ctx, id, req.Service, call)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		body := map[string]interface{}{"result": res.Result}
+		if res.Error != nil {
+			body = map[string]interface{}{"error": res.Error}
+		}
+		writeJSON(w, http.StatusOK, body)
+	}
+}
+
+// InFlightCallsHandler serves GET /api/devices/{id}/rpc, listing the device's calls still
+// waiting for a reply.
+func InFlightCallsHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		calls, err := m.InFlightCalls(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"calls": calls})
+	}
+}
+
+// CancelCallHandler serves DELETE /api/devices/{id}/rpc/{call}, canceling the call named by the
+// CallHeader it was made with, or by the ID GET /api/devices/{id}/rpc lists.
+func CancelCallHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		if err := m.CancelCall(r.Context(), id, r.PathValue("call")); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// callContext names the request's RPC with its CallHeader, when set.
+func callContext(r *http.Request) context.Context {
+	if callID := r.Header.Get(CallHeader); callID != "" {
+		return manager.WithCallID(r.Context(), callID)
+	}
+	return r.Context()
+}
@@ -0,0 +1,86 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/settings"
+)
+
+// ListSettingsAssignmentsHandler serves GET /api/settings/assignments.
+func ListSettingsAssignmentsHandler(svc *settings.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"assignments": svc.List(r.Context())})
+	}
+}
+
+// AssignSettingsHandler serves PUT /api/settings/assignments/{name} {"profile","group","service"},
+// binding an xconf settings profile to the devices matching group; answers 201.
+func AssignSettingsHandler(svc *settings.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var a settings.Assignment
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		a.Name = r.PathValue("name")
+		saved, err := svc.Assign(r.Context(), a)
+		if err != nil {
+			writeSettingsError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, saved)
+	}
+}
+
+// SettingsAssignmentHandler serves GET /api/settings/assignments/{name}: the assignment with each
+// device's reconciliation state.
+func SettingsAssignmentHandler(svc *settings.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		st, err := svc.Status(r.Context(), r.PathValue("name"))
+		if err != nil {
+			writeSettingsError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, st)
+	}
+}
+
+// UnassignSettingsHandler serves DELETE /api/settings/assignments/{name}.
+func UnassignSettingsHandler(svc *settings.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		if err := svc.Unassign(r.Context(), r.PathValue("name")); err != nil {
+			writeSettingsError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ReconcileSettingsHandler serves POST /api/settings/assignments/{name}/reconcile, running a
+// reconciliation round now and returning the resulting status.
+func ReconcileSettingsHandler(svc *settings.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		st, err := svc.Reconcile(r.Context(), r.PathValue("name"))
+		if err != nil {
+			writeSettingsError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, st)
+	}
+}
+
+func writeSettingsError(w http.ResponseWriter, err error) {
+	if errors.Is(err, settings.ErrAssignmentNotFound) {
+		writeProblem(w, http.StatusNotFound, CodeAssignmentNotFound, err)
+		return
+	}
+	writeError(w, err)
+}
@@ -0,0 +1,190 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/snapshot"
+)
+
+type captureRequest struct {
+	Name    string   `json:"name"`
+	Service string   `json:"service"`
+	Paths   []string `json:"paths"`
+}
+
+// CaptureSnapshotHandler serves POST /api/devices/{id}/snapshots {"name","service","paths":["Device.WiFi."]}.
+func CaptureSnapshotHandler(svc *snapshot.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var req captureRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		snap, err := svc.Capture(r.Context(), id, req.Name, req.Service, req.Paths)
+		if err != nil {
+			writeSnapshotError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, snap)
+	}
+}
+
+// ListSnapshotsHandler serves GET /api/devices/{id}/snapshots (metadata only).
+func ListSnapshotsHandler(svc *snapshot.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		list, err := svc.List(r.Context(), id)
+		if err != nil {
+			writeSnapshotError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"snapshots": list})
+	}
+}
+
+// GetSnapshotHandler serves GET /api/devices/{id}/snapshots/{sid}.
+func GetSnapshotHandler(svc *snapshot.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		snap, err := svc.Get(r.Context(), id, r.PathValue("sid"))
+		if err != nil {
+			writeSnapshotError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, snap)
+	}
+}
+
+// DeleteSnapshotHandler serves DELETE /api/devices/{id}/snapshots/{sid}.
+func DeleteSnapshotHandler(svc *snapshot.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		if err := svc.Delete(r.Context(), id, r.PathValue("sid")); err != nil {
+			writeSnapshotError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DiffSnapshotHandler serves GET /api/devices/{id}/snapshots/{sid}/diff?against=<sid|current> (default current).
+func DiffSnapshotHandler(svc *snapshot.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		against := r.URL.Query().Get("against")
+		if against == "" {
+			against = snapshot.Current
+		}
+		changes, err := svc.Diff(r.Context(), id, r.PathValue("sid"), against)
+		if err != nil {
+			writeSnapshotError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"from": r.PathValue("sid"), "to": against, "changes": changes})
+	}
+}
+
+// RestoreSnapshotHandler serves POST /api/devices/{id}/snapshots/{sid}/restore {"names":[...]} (empty restores all).
+func RestoreSnapshotHandler(svc *snapshot.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var req struct {
+			Names []string `json:"names"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, dm.ErrInvalidParameter)
+				return
+			}
+		}
+		res, err := svc.Restore(r.Context(), id, r.PathValue("sid"), req.Names)
+		if err != nil {
+			writeSnapshotError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"applied": res.Applied})
+	}
+}
+
+// CompareDevicesHandler serves GET /api/devices/{id}/compare?other=<device>&paths=Device.WiFi.,...[&service=svc]
+// or ?snapshot=<sid>[&other=<snapshot's device>], with an optional &ignore=<names or partial paths>.
+func CompareDevicesHandler(svc *snapshot.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		q := r.URL.Query()
+		other := id
+		if q.Get("other") != "" {
+			var err error
+			if other, err = dm.ParseDeviceID(q.Get("other")); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+		var (
+			c   snapshot.Comparison
+			err error
+		)
+		if sid := q.Get("snapshot"); sid != "" {
+			c, err = svc.CompareSnapshot(r.Context(), id, other, sid, splitList(q.Get("ignore")))
+		} else {
+			c, err = svc.CompareDevices(r.Context(), id, other, q.Get("service"), splitList(q.Get("paths")), splitList(q.Get("ignore")))
+		}
+		if err != nil {
+			writeSnapshotError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, c)
+	}
+}
+
+// splitList parses a comma-separated query value, dropping empty entries.
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func writeSnapshotError(w http.ResponseWriter, err error) {
+	if errors.Is(err, snapshot.ErrSnapshotNotFound) {
+		writeProblem(w, http.StatusNotFound, CodeSnapshotNotFound, err)
+		return
+	}
+	writeError(w, err)
+}
@@ -0,0 +1,51 @@
+package httpapi
+
+import (
+	"net/http"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// StatsHandler serves GET /api/stats: fleet counts by status, model and firmware, connectivity
+// churn over the last hour and backend health, limited to the caller's partner scope.
+func StatsHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		writeJSON(w, http.StatusOK, m.Stats(r.Context()))
+	}
+}
+
+// StatsHistoryHandler serves GET /api/stats/history[?window=24h&step=5m]: the fleet's device counts
+// by status after each poll and the transitions between polls, oldest first, limited to the
+// caller's partner scope. With step, the samples are merged into one per step.
+func StatsHistoryHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var window, step time.Duration
+		for _, q := range []struct {
+			name string
+			into *time.Duration
+		}{{"window", &window}, {"step", &step}} {
+			if v := r.URL.Query().Get(q.name); v != "" {
+				d, err := time.ParseDuration(v)
+				if err != nil || d <= 0 {
+					writeError(w, dm.ErrInvalidParameter)
+					return
+				}
+				*q.into = d
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"samples": m.StatsHistory(r.Context(), window, step)})
+	}
+}
+
+// TalariaStatsHandler serves GET /api/stats/talaria: device counts by Talaria instance with each
+// one's share, deviation from the mean and draining flag, and the fleet's skew.
+func TalariaStatsHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		writeJSON(w, http.StatusOK, m.TalariaStats(r.Context()))
+	}
+}
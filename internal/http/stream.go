@@ -0,0 +1,71 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ndjsonContentType is the newline-delimited JSON media type selected with the Accept header.
+const ndjsonContentType = "application/x-ndjson"
+
+// wantsNDJSON reports whether the request asks for newline-delimited JSON.
+func wantsNDJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), ndjsonContentType)
+}
+
+// arrayStream writes a JSON array element by element through a buffer, so large lists are never
+// held in memory as a whole. In NDJSON mode every element is a line of its own and the prefix and
+// suffix are omitted.
+type arrayStream struct {
+	w      *bufio.Writer
+	ndjson bool
+	n      int
+	err    error
+}
+
+// startArray writes prefix (up to and excluding the array's "[") and opens the array.
+func startArray(w io.Writer, ndjson bool, prefix string) *arrayStream {
+	s := &arrayStream{w: bufio.NewWriterSize(w, 32<<10), ndjson: ndjson}
+	if !ndjson {
+		_, s.err = s.w.WriteString(prefix + "[")
+	}
+	return s
+}
+
+// Encode appends v to the array.
+func (s *arrayStream) Encode(v interface{}) error {
+	if s.err != nil {
+		return s.err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		s.err = err
+		return err
+	}
+	if s.n > 0 && !s.ndjson {
+		s.w.WriteByte(',')
+	}
+	s.w.Write(data)
+	if s.ndjson {
+		s.w.WriteByte('\n')
+	}
+	s.n++
+	return nil
+}
+
+// Len returns the number of elements written.
+func (s *arrayStream) Len() int { return s.n }
+
+// Close closes the array, writes suffix and flushes.
+func (s *arrayStream) Close(suffix string) error {
+	if s.err != nil {
+		return s.err
+	}
+	if !s.ndjson {
+		s.w.WriteString("]" + suffix)
+	}
+	return s.w.Flush()
+}
@@ -0,0 +1,277 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// Subscriptions are the registries behind /api/subscriptions; nil ones are left out.
+type Subscriptions struct {
+	Webhooks *events.WebhookDispatcher
+	Topics   *events.TopicBindings
+	Manager  *manager.Manager // its WatchRegistrations
+}
+
+// SubscriptionInfo describes a registration of any kind; exactly one of Webhook, Topic and
+// ParamWatch is set, after Kind.
+type SubscriptionInfo struct {
+	Kind       dm.SubscriptionKind        `json:"kind"`
+	ID         string                     `json:"id"`
+	Until      time.Time                  `json:"until,omitempty"`
+	CreatedAt  time.Time                  `json:"createdAt"`
+	Webhook    *events.Webhook            `json:"webhook,omitempty"`
+	Topic      *events.TopicBinding       `json:"topic,omitempty"`
+	ParamWatch *manager.WatchRegistration `json:"paramWatch,omitempty"`
+}
+
+func webhookInfo(h events.Webhook) SubscriptionInfo {
+	return SubscriptionInfo{Kind: dm.SubscriptionWebhook, ID: h.ID, Until: h.Until, CreatedAt: h.CreatedAt, Webhook: &h}
+}
+
+func topicInfo(b events.TopicBinding) SubscriptionInfo {
+	return SubscriptionInfo{Kind: dm.SubscriptionTopic, ID: b.ID, Until: b.Until, CreatedAt: b.CreatedAt, Topic: &b}
+}
+
+func watchInfo(reg manager.WatchRegistration) SubscriptionInfo {
+	return SubscriptionInfo{Kind: dm.SubscriptionParamWatch, ID: reg.ID, Until: reg.Until, CreatedAt: reg.CreatedAt, ParamWatch: &reg}
+}
+
+// expiry is the expiry members of a registration or renewal body: an absolute until or a ttl from
+// now (a Go duration), which wins.
+type expiry struct {
+	Until time.Time `json:"until"`
+	TTL   string    `json:"ttl"`
+}
+
+func (e expiry) resolve() (time.Time, error) {
+	if e.TTL == "" {
+		return e.Until, nil
+	}
+	d, err := time.ParseDuration(e.TTL)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf("ttl %q: %w", e.TTL, dm.ErrInvalidParameter)
+	}
+	return time.Now().Add(d), nil
+}
+
+// ListSubscriptionsHandler serves GET /api/subscriptions?kind=: the webhooks, topic bindings and
+// parameter watches in the caller's partner scope ordered by creation time, optionally of one kind.
+// Secrets are redacted.
+func ListSubscriptionsHandler(s Subscriptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		kind := dm.SubscriptionKind(r.URL.Query().Get("kind"))
+		switch kind {
+		case "", dm.SubscriptionWebhook, dm.SubscriptionTopic, dm.SubscriptionParamWatch:
+		default:
+			writeError(w, fmt.Errorf("kind %q: want webhook, topic or param-watch: %w", kind, dm.ErrInvalidParameter))
+			return
+		}
+		out := []SubscriptionInfo{}
+		if s.Webhooks != nil && (kind == "" || kind == dm.SubscriptionWebhook) {
+			for _, h := range s.Webhooks.List(r.Context()) {
+				out = append(out, webhookInfo(h))
+			}
+		}
+		if s.Topics != nil && (kind == "" || kind == dm.SubscriptionTopic) {
+			for _, b := range s.Topics.List(r.Context()) {
+				out = append(out, topicInfo(b))
+			}
+		}
+		if s.Manager != nil && (kind == "" || kind == dm.SubscriptionParamWatch) {
+			for _, reg := range s.Manager.Watches(r.Context()) {
+				out = append(out, watchInfo(reg))
+			}
+		}
+		sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+		writeJSON(w, http.StatusOK, map[string]interface{}{"subscriptions": out, "count": len(out)})
+	}
+}
+
+// RenewSubscriptionHandler serves POST /api/subscriptions/{id}/renew, moving the expiry of the
+// registration with that ID, whatever its kind, to the body's until or ttl. A body with neither
+// makes it never expire.
+func RenewSubscriptionHandler(s Subscriptions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var req expiry
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, fmt.Errorf("invalid renewal: %v: %w", err, dm.ErrInvalidParameter))
+				return
+			}
+		}
+		until, err := req.resolve()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		id := r.PathValue("id")
+		if s.Webhooks != nil {
+			h, err := s.Webhooks.Renew(r.Context(), id, until)
+			if err == nil {
+				writeJSON(w, http.StatusOK, webhookInfo(h))
+				return
+			}
+			if !errors.Is(err, events.ErrWebhookNotFound) {
+				writeError(w, err)
+				return
+			}
+		}
+		if s.Topics != nil {
+			b, err := s.Topics.Renew(r.Context(), id, until)
+			if err == nil {
+				writeJSON(w, http.StatusOK, topicInfo(b))
+				return
+			}
+			if !errors.Is(err, dm.ErrSubscriptionNotFound) {
+				writeError(w, err)
+				return
+			}
+		}
+		if s.Manager != nil {
+			reg, err := s.Manager.RenewWatch(r.Context(), id, until)
+			if err == nil {
+				writeJSON(w, http.StatusOK, watchInfo(reg))
+				return
+			}
+			if !errors.Is(err, dm.ErrSubscriptionNotFound) {
+				writeError(w, err)
+				return
+			}
+		}
+		writeError(w, fmt.Errorf("subscription %s: %w", id, dm.ErrSubscriptionNotFound))
+	}
+}
+
+// AddTopicBindingHandler serves POST /api/topics. The binding inherits the caller's partner scope.
+func AddTopicBindingHandler(t *events.TopicBindings) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var req struct {
+			events.TopicBinding
+			TTL string `json:"ttl"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, fmt.Errorf("invalid binding: %v: %w", err, dm.ErrInvalidParameter))
+			return
+		}
+		b := req.TopicBinding
+		var err error
+		if b.Until, err = (expiry{Until: b.Until, TTL: req.TTL}).resolve(); err != nil {
+			writeError(w, err)
+			return
+		}
+		b.Partners = nil
+		if scope, ok := dm.PartnersFromContext(r.Context()); ok {
+			b.Partners = scope
+		}
+		b, err = t.Add(r.Context(), b)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, b)
+	}
+}
+
+// ListTopicBindingsHandler serves GET /api/topics, listing the bindings in the caller's partner scope.
+func ListTopicBindingsHandler(t *events.TopicBindings) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"topics": t.List(r.Context())})
+	}
+}
+
+// DeleteTopicBindingHandler serves DELETE /api/topics/{id}; bindings outside the caller's partner scope are 404.
+func DeleteTopicBindingHandler(t *events.TopicBindings) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		if err := t.Remove(r.Context(), r.PathValue("id")); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RegisterWatchHandler serves POST /api/devices/{id}/params/watches with {"names": [...], "until"
+// or "ttl"}, registering a durable manager.WatchRegistration.
+func RegisterWatchHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		var req struct {
+			expiry
+			Names []string `json:"names"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, fmt.Errorf("invalid registration: %v: %w", err, dm.ErrInvalidParameter))
+			return
+		}
+		until, err := req.resolve()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		reg, err := m.RegisterWatch(r.Context(), id, req.Names, until)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, reg)
+	}
+}
+
+// ListWatchesHandler serves GET /api/devices/{id}/params/watches, the device's registrations in
+// the caller's partner scope.
+func ListWatchesHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		out := []manager.WatchRegistration{}
+		for _, reg := range m.Watches(r.Context()) {
+			if reg.DeviceID == id {
+				out = append(out, reg)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"watches": out})
+	}
+}
+
+// DeleteWatchHandler serves DELETE /api/devices/{id}/params/watches/{watch}.
+func DeleteWatchHandler(m *manager.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		id, ok := pathDeviceID(w, r)
+		if !ok {
+			return
+		}
+		wid := r.PathValue("watch")
+		for _, reg := range m.Watches(r.Context()) {
+			if reg.ID == wid && reg.DeviceID == id {
+				if err := m.UnregisterWatch(r.Context(), wid); err != nil {
+					writeError(w, err)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		writeError(w, fmt.Errorf("param watch %s: %w", wid, dm.ErrSubscriptionNotFound))
+	}
+}
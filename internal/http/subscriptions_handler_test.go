@@ -0,0 +1,77 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+)
+
+func TestSubscriptionHandlers(t *testing.T) {
+	s := Subscriptions{
+		Webhooks: events.NewWebhookDispatcher(events.WebhookConfig{Logger: log.New(io.Discard, "", 0)}),
+		Topics:   events.NewTopicBindings(nil, nil),
+	}
+	rr := httptest.NewRecorder()
+	RegisterWebhookHandler(s.Webhooks)(rr, httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(`{"url":"http://hooks.example/x","ttl":"1h"}`)))
+	var hook events.Webhook
+	if err := json.Unmarshal(rr.Body.Bytes(), &hook); err != nil || rr.Code != http.StatusCreated || time.Until(hook.Until) < 59*time.Minute {
+		t.Fatalf("register webhook: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	AddTopicBindingHandler(s.Topics)(rr, httptest.NewRequest(http.MethodPost, "/api/topics", strings.NewReader(`{"topic":"ops.{kind}","events":["offline"]}`)))
+	var topic events.TopicBinding
+	if err := json.Unmarshal(rr.Body.Bytes(), &topic); err != nil || rr.Code != http.StatusCreated || !topic.Until.IsZero() {
+		t.Fatalf("add topic binding: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	AddTopicBindingHandler(s.Topics)(rr, httptest.NewRequest(http.MethodPost, "/api/topics", strings.NewReader(`{"topic":"x","ttl":"soon"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad ttl: %d", rr.Code)
+	}
+
+	list := func(query string) []SubscriptionInfo {
+		rr := httptest.NewRecorder()
+		ListSubscriptionsHandler(s)(rr, httptest.NewRequest(http.MethodGet, "/api/subscriptions"+query, nil))
+		var out struct {
+			Subscriptions []SubscriptionInfo `json:"subscriptions"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &out)
+		return out.Subscriptions
+	}
+	if got := list(""); len(got) != 2 || got[0].Kind != dm.SubscriptionWebhook || got[0].Webhook == nil || got[1].Kind != dm.SubscriptionTopic || got[1].Topic == nil {
+		t.Fatalf("listed %+v", got)
+	}
+	if got := list("?kind=topic"); len(got) != 1 || got[0].ID != topic.ID {
+		t.Fatalf("listed topics %+v", got)
+	}
+
+	renew := func(id, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/subscriptions/"+id+"/renew", strings.NewReader(body))
+		req.SetPathValue("id", id)
+		RenewSubscriptionHandler(s)(rr, req)
+		return rr
+	}
+	rr = renew(topic.ID, `{"ttl":"2h"}`)
+	var info SubscriptionInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil || rr.Code != http.StatusOK || info.Kind != dm.SubscriptionTopic || time.Until(info.Until) < 119*time.Minute {
+		t.Fatalf("renew topic: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr = renew(hook.ID, `{}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"kind":"webhook"`) {
+		t.Fatalf("renew webhook: %d %s", rr.Code, rr.Body.String())
+	}
+	if got := list("?kind=webhook"); len(got) != 1 || !got[0].Until.IsZero() {
+		t.Fatalf("expected the webhook to never expire, got %+v", got)
+	}
+	if rr = renew("unknown", `{"ttl":"1h"}`); rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), dm.CodeSubscriptionNotFound) {
+		t.Fatalf("renew unknown: %d %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,54 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// DefaultPartnerClaim is the JWT claim carrying partner IDs in XMiDT (themis) issued tokens.
+const DefaultPartnerClaim = "partner-id"
+
+var errNoPartners = errors.New("no partner scope in credentials")
+
+// PartnerResolver extracts the caller's partner IDs from a request.
+type PartnerResolver func(r *http.Request) ([]string, error)
+
+// JWTPartnerResolver reads partner IDs from a bearer token claim. claim may be a dotted path
+// (e.g. "allowedResources.allowedPartners") and defaults to DefaultPartnerClaim. verify checks
+// the token (see NewJWTVerifier); a nil verify rejects every request.
+func JWTPartnerResolver(claim string, verify func(token string) error) PartnerResolver {
+	if claim == "" {
+		claim = DefaultPartnerClaim
+	}
+	return func(r *http.Request) ([]string, error) {
+		claims, err := bearerClaims(r, verify)
+		if err != nil {
+			return nil, err
+		}
+		partners := claimStrings(claims, claim)
+		if len(partners) == 0 {
+			return nil, errNoPartners
+		}
+		return partners, nil
+	}
+}
+
+// PartnerScope scopes each request to the partners returned by resolve; requests whose
+// credentials carry no partner scope are rejected with 401. CORS preflights pass through.
+func PartnerScope(resolve PartnerResolver, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		partners, err := resolve(r)
+		if err != nil {
+			writeCORS(w, r)
+			writeProblem(w, http.StatusUnauthorized, CodeUnauthenticated, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(dm.WithPartners(r.Context(), partners)))
+	})
+}
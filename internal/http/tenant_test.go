@@ -0,0 +1,81 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// testSecret signs the tokens built by bearer; testVerify accepts them.
+const testSecret = "test-secret"
+
+var testVerify, _ = NewJWTVerifier(dm.JWTConfig{HMACSecret: testSecret}, nil)
+
+func bearer(claims map[string]any) string {
+	return "Bearer " + signHS256(claims, testSecret)
+}
+
+func TestPartnerScopedDeviceList(t *testing.T) {
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"devices": []map[string]any{
+			{"id": "mac:aa", "partnerIDs": []string{"comcast"}},
+			{"id": "mac:bb", "partnerIDs": []string{"sky", "comcast"}},
+			{"id": "mac:cc", "partnerId": "sky"},
+			{"id": "mac:dd"},
+		}})
+	}))
+	defer talaria.Close()
+	da := runtime.NewDeviceAdapter(talaria.URL, nil)
+	if _, err := da.PollOnce(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	h := PartnerScope(JWTPartnerResolver("", testVerify), DevicesHandler(da))
+
+	cases := []struct {
+		auth string
+		code int
+		want int
+	}{
+		{bearer(map[string]any{"partner-id": "sky"}), http.StatusOK, 2},
+		{bearer(map[string]any{"partner-id": []string{"comcast"}}), http.StatusOK, 2},
+		{bearer(map[string]any{"partner-id": "*"}), http.StatusOK, 4},
+		{bearer(map[string]any{"sub": "nobody"}), http.StatusUnauthorized, 0},
+		{"Basic dXNlcjpwYXNz", http.StatusUnauthorized, 0},
+		// a wildcard scope in a token that is not signed with the configured key
+		{"Bearer " + jwtSegments("none", "", map[string]any{"partner-id": "*"}) + ".", http.StatusUnauthorized, 0},
+		{"Bearer " + signHS256(map[string]any{"partner-id": "*"}, "forged"), http.StatusUnauthorized, 0},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/devices", nil)
+		req.Header.Set("Authorization", c.auth)
+		h.ServeHTTP(rr, req)
+		if rr.Code != c.code {
+			t.Fatalf("auth %q: expected %d got %d", c.auth, c.code, rr.Code)
+		}
+		if c.code != http.StatusOK {
+			continue
+		}
+		var out struct {
+			Count int `json:"count"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &out)
+		if out.Count != c.want {
+			t.Fatalf("auth %q: expected %d devices got %d", c.auth, c.want, out.Count)
+		}
+	}
+}
+
+func TestJWTPartnerResolverNestedClaim(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", bearer(map[string]any{"allowedResources": map[string]any{"allowedPartners": []string{"a", "b"}}}))
+	got, err := JWTPartnerResolver("allowedResources.allowedPartners", testVerify)(req)
+	if err != nil || len(got) != 2 || got[0] != "a" {
+		t.Fatalf("unexpected partners %v err %v", got, err)
+	}
+}
@@ -0,0 +1,85 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+)
+
+// RegisterWebhookHandler serves POST /api/webhooks. The registration inherits the caller's partner
+// scope; a ttl member sets its expiry from now.
+func RegisterWebhookHandler(d *events.WebhookDispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var req struct {
+			events.Webhook
+			TTL string `json:"ttl"` // Go duration; overrides until
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, http.StatusBadRequest, dm.CodeInvalidParameter, fmt.Errorf("invalid registration: %w", err))
+			return
+		}
+		h := req.Webhook
+		var err error
+		if h.Until, err = (expiry{Until: h.Until, TTL: req.TTL}).resolve(); err != nil {
+			writeError(w, err)
+			return
+		}
+		h.Partners = nil
+		if scope, ok := dm.PartnersFromContext(r.Context()); ok {
+			h.Partners = scope
+		}
+		reg, err := d.Register(h)
+		if err != nil {
+			writeProblem(w, http.StatusBadRequest, dm.CodeInvalidParameter, err)
+			return
+		}
+		reg.Secret = ""
+		writeJSON(w, http.StatusCreated, reg)
+	}
+}
+
+// ListWebhooksHandler serves GET /api/webhooks, listing the registrations in the caller's partner scope.
+func ListWebhooksHandler(d *events.WebhookDispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"webhooks": d.List(r.Context())})
+	}
+}
+
+// DeleteWebhookHandler serves DELETE /api/webhooks/{id}; webhooks outside the caller's partner scope are 404.
+func DeleteWebhookHandler(d *events.WebhookDispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		if err := d.Unregister(r.Context(), r.PathValue("id")); err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeadLettersHandler serves GET /api/webhooks/{id}/deadletters, scoped like DeleteWebhookHandler.
+func DeadLettersHandler(d *events.WebhookDispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		dls, err := d.DeadLetters(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"deadLetters": dls})
+	}
+}
+
+func writeWebhookError(w http.ResponseWriter, err error) {
+	if errors.Is(err, events.ErrWebhookNotFound) {
+		writeProblem(w, http.StatusNotFound, CodeWebhookNotFound, err)
+		return
+	}
+	writeError(w, err)
+}
@@ -0,0 +1,83 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+)
+
+func TestWebhookHandlersPartnerScope(t *testing.T) {
+	d := events.NewWebhookDispatcher(events.WebhookConfig{Logger: log.New(io.Discard, "", 0)})
+	scoped := func(req *http.Request, partners ...string) *http.Request {
+		if len(partners) == 0 {
+			return req
+		}
+		return req.WithContext(dm.WithPartners(req.Context(), partners))
+	}
+	register := func(partners ...string) string {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(`{"url":"http://hooks.example/x","partners":["*"]}`))
+		RegisterWebhookHandler(d)(rr, scoped(req, partners...))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("register: %d %s", rr.Code, rr.Body.String())
+		}
+		var h events.Webhook
+		_ = json.Unmarshal(rr.Body.Bytes(), &h)
+		return h.ID
+	}
+	comcast, sky, unscoped := register("comcast"), register("sky"), register()
+	list := func(partners ...string) []string {
+		rr := httptest.NewRecorder()
+		ListWebhooksHandler(d)(rr, scoped(httptest.NewRequest(http.MethodGet, "/api/webhooks", nil), partners...))
+		var out struct {
+			Webhooks []events.Webhook `json:"webhooks"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &out)
+		var ids []string
+		for _, h := range out.Webhooks {
+			ids = append(ids, h.ID)
+		}
+		return ids
+	}
+	if got := list("comcast"); len(got) != 1 || got[0] != comcast {
+		t.Fatalf("comcast sees %v", got)
+	}
+	if got := list("*"); len(got) != 2 {
+		t.Fatalf("wildcard sees %v, want the two partner hooks", got)
+	}
+	if got := list(); len(got) != 3 {
+		t.Fatalf("unscoped sees %v", got)
+	}
+
+	call := func(method, path, id string, h http.HandlerFunc, partners ...string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.SetPathValue("id", id)
+		h(rr, scoped(req, partners...))
+		return rr.Code
+	}
+	for _, id := range []string{sky, unscoped} {
+		if code := call(http.MethodGet, "/api/webhooks/"+id+"/deadletters", id, DeadLettersHandler(d), "comcast"); code != http.StatusNotFound {
+			t.Fatalf("comcast dead letters of %s: %d", id, code)
+		}
+		if code := call(http.MethodDelete, "/api/webhooks/"+id, id, DeleteWebhookHandler(d), "comcast"); code != http.StatusNotFound {
+			t.Fatalf("comcast delete of %s: %d", id, code)
+		}
+	}
+	if code := call(http.MethodGet, "/api/webhooks/"+comcast+"/deadletters", comcast, DeadLettersHandler(d), "comcast"); code != http.StatusOK {
+		t.Fatalf("own dead letters: %d", code)
+	}
+	if code := call(http.MethodDelete, "/api/webhooks/"+comcast, comcast, DeleteWebhookHandler(d), "comcast"); code != http.StatusNoContent {
+		t.Fatalf("own delete: %d", code)
+	}
+	if got := list(); len(got) != 2 {
+		t.Fatalf("refused deletes removed hooks: %v", got)
+	}
+}
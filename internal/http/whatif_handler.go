@@ -0,0 +1,31 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/whatif"
+)
+
+// WhatIfHandler serves POST /api/policy/whatif with a proposed change,
+// {"firmware":{"rules":[...],"configs":[...],"deleteRules":["id"],"deleteConfigs":["id"]},"profiles":[...]}:
+// the devices visible to the caller that would be assigned other firmware, the settings
+// assignments the profiles would change, and lint findings of the changed rules. Nothing is
+// saved. s may be nil when settings assignments are not managed.
+func WhatIfHandler(m whatif.Devices, s whatif.Settings) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeCORS(w, r)
+		var c whatif.Change
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			writeError(w, dm.ErrInvalidParameter)
+			return
+		}
+		res, err := whatif.Simulate(r.Context(), m, s, c)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	api "github.com/xmidt-org/talaria/devicemgr/internal/http"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// DebugHandler serves the runtime diagnostics: net/http/pprof under /debug/pprof/, expvar at
+// /debug/vars and the manager's goroutine and connection dump at /debug/dump (full goroutine
+// stacks are at /debug/pprof/goroutine?debug=2). Every route requires the admin role; without an
+// Authorizer the handler is open, so serve it on a listener only operators can reach.
+func DebugHandler(m *manager.Manager, authz *api.Authorizer) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	if m != nil {
+		mux.Handle("GET /debug/dump", api.DumpHandler(m))
+	}
+	return authz.Require(dm.RoleAdmin, mux)
+}
@@ -7,51 +7,74 @@ import (
 	"net/http"
 	"time"
 
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/diagnostics"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+	"github.com/xmidt-org/talaria/devicemgr/firmware"
 	api "github.com/xmidt-org/talaria/devicemgr/internal/http"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+	"github.com/xmidt-org/talaria/devicemgr/metrics"
+	"github.com/xmidt-org/talaria/devicemgr/profiles"
+	"github.com/xmidt-org/talaria/devicemgr/quality"
 	"github.com/xmidt-org/talaria/devicemgr/runtime"
+	"github.com/xmidt-org/talaria/devicemgr/settings"
+	"github.com/xmidt-org/talaria/devicemgr/snapshot"
+	"github.com/xmidt-org/talaria/devicemgr/whatif"
 )
 
 // DiscoveryConfig configures the discovery (device listing) HTTP server.
 type DiscoveryConfig struct {
-	ListenAddr    string                 // address to bind (e.g. :8090)
-	DeviceAdapter *runtime.DeviceAdapter // required
-	Logger        *log.Logger            // optional; defaults to log.Default()
-	ReadTimeout   time.Duration          // optional
-	WriteTimeout  time.Duration          // optional
-	IdleTimeout   time.Duration          // optional
+	ListenAddr    string                    // address to bind (e.g. :8090)
+	DeviceAdapter *runtime.DeviceAdapter    // required unless Manager is set
+	Manager       *manager.Manager          // optional; supplies DeviceAdapter when nil
+	EnableGraphQL bool                      // mount /api/graphql (requires Manager)
+	Partners      api.PartnerResolver       // optional; scopes every request to the caller's partners
+	Authz         *api.Authorizer           // optional; enforces viewer/operator/admin roles per route
+	Allowlist     *api.Allowlist            // optional; refuses clients outside the allowed networks
+	Webhooks      *events.WebhookDispatcher // optional; mounts /api/webhooks registration routes
+	Topics        *events.TopicBindings     // optional; mounts /api/topics event topic binding routes
+	SigningKeys   map[string]string         // optional; HMAC-SHA256 keys by ID for /api/events?sign=<ID>
+	Jobs          *jobs.Service             // optional; mounts /api/jobs bulk job routes
+	Plans         *jobs.Planner             // optional; mounts /api/plans change plan routes
+	Snapshots     *snapshot.Service         // optional; mounts /api/devices/{id}/snapshots routes
+	Firmware      *firmware.Service         // optional; mounts /api/devices/{id}/firmware routes
+	Diagnostics   *diagnostics.Runner       // optional; mounts /api/devices/{id}/diagnostics/{kind}
+	Annotations   *annotation.Service       // optional; mounts /api/devices/{id}/annotations and lists them in /api/devices
+	Profiles      *profiles.Service         // optional; mounts /api/profiles and /api/devices/{id}/profiles routes
+	Quality       *quality.Collector        // optional; mounts /api/quality and /api/devices/{id}/quality
+	Settings      *settings.Service         // optional; mounts /api/settings/assignments routes
+	Idempotency   *api.Idempotency          // optional; Idempotency-Key replay store, in memory by default
+	PathPrefix    string                    // optional; serves the routes under it, e.g. "/devicemgr" for /devicemgr/api/devices
+	LegacyAPI     api.LegacyMode            // optional; how the unversioned /api routes are served beside /api/v1
+	Logger        *log.Logger               // optional; defaults to log.Default()
+	ReadTimeout   time.Duration             // optional
+	WriteTimeout  time.Duration             // optional
+	IdleTimeout   time.Duration             // optional
 }
 
 var ErrNilAdapter = errors.New("discovery server: device adapter is nil")
 
+var ErrNilManager = errors.New("discovery server: graphql requires a manager")
+
 // StartDiscoveryServer starts an HTTP server exposing /api/devices using the provided adapter.
 // It returns the *http.Server, a channel that will receive a terminal error (if any), and an error for immediate startup issues.
 // The server stops when the supplied context is canceled.
 func StartDiscoveryServer(ctx context.Context, cfg DiscoveryConfig) (*http.Server, <-chan error, error) {
-	if cfg.DeviceAdapter == nil {
-		return nil, nil, ErrNilAdapter
-	}
-	if cfg.ListenAddr == "" {
-		cfg.ListenAddr = ":8090"
-	}
-	if cfg.Logger == nil {
-		cfg.Logger = log.Default()
+	srv, err := NewDiscoveryServer(cfg)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	mux := http.NewServeMux()
-	mux.HandleFunc("/api/devices", api.DevicesHandler(cfg.DeviceAdapter))
-
-	srv := &http.Server{
-		Addr:         cfg.ListenAddr,
-		Handler:      mux,
-		ReadTimeout:  durationOr(cfg.ReadTimeout, 10*time.Second),
-		WriteTimeout: durationOr(cfg.WriteTimeout, 10*time.Second),
-		IdleTimeout:  durationOr(cfg.IdleTimeout, 60*time.Second),
+	logger := cfg.Logger
+	if logger == nil {
+		logger = log.Default()
 	}
 
 	errCh := make(chan error, 1)
 
 	go func() {
-		cfg.Logger.Printf("discovery API listening on %s (GET /api/devices)", cfg.ListenAddr)
+		logger.Printf("discovery API listening on %s (GET /api/devices)", srv.Addr)
 		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			errCh <- err
 		}
@@ -69,6 +92,219 @@ func StartDiscoveryServer(ctx context.Context, cfg DiscoveryConfig) (*http.Serve
 	return srv, errCh, nil
 }
 
+// NewDiscoveryServer builds the discovery API server without starting it, for callers that
+// manage its lifecycle themselves (dm.ServerRunner).
+func NewDiscoveryServer(cfg DiscoveryConfig) (*http.Server, error) {
+	handler, err := NewDiscoveryHandler(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ListenAddr == "" {
+		cfg.ListenAddr = ":8090"
+	}
+	return &http.Server{
+		Addr:         cfg.ListenAddr,
+		Handler:      handler,
+		ReadTimeout:  durationOr(cfg.ReadTimeout, 10*time.Second),
+		WriteTimeout: durationOr(cfg.WriteTimeout, 10*time.Second),
+		IdleTimeout:  durationOr(cfg.IdleTimeout, 60*time.Second),
+	}, nil
+}
+
+// NewDiscoveryHandler returns the discovery API routes as a handler, to serve from a server of
+// the caller's own. ListenAddr and the timeouts do not apply.
+func NewDiscoveryHandler(cfg DiscoveryConfig) (http.Handler, error) {
+	if cfg.DeviceAdapter == nil && cfg.Manager != nil {
+		cfg.DeviceAdapter = cfg.Manager.DeviceAdapter()
+	}
+	if cfg.DeviceAdapter == nil {
+		return nil, ErrNilAdapter
+	}
+	if cfg.EnableGraphQL && cfg.Manager == nil {
+		return nil, ErrNilManager
+	}
+
+	if cfg.Idempotency == nil {
+		cfg.Idempotency = api.NewIdempotency(nil)
+	}
+	idem := cfg.Idempotency
+
+	mux := http.NewServeMux()
+	var quarantined func(dm.DeviceID) *dm.Quarantine
+	if cfg.Manager != nil {
+		quarantined = cfg.Manager.QuarantineOf
+	}
+	mux.Handle("/api/devices", cfg.Authz.Require(dm.RoleViewer, api.AnnotatedDevicesHandler(cfg.DeviceAdapter, cfg.Annotations, quarantined)))
+	mux.Handle("GET /api/devices/export", cfg.Authz.Require(dm.RoleViewer, api.ExportDevicesHandler(cfg.DeviceAdapter, cfg.Annotations)))
+	mux.Handle("GET /api/devices/select", cfg.Authz.Require(dm.RoleViewer, api.SelectDevicesHandler(cfg.DeviceAdapter, cfg.Annotations)))
+	var eventSource api.EventSource = cfg.DeviceAdapter
+	if cfg.Manager != nil {
+		eventSource = cfg.Manager
+	}
+	mux.Handle("GET /api/events", cfg.Authz.Require(dm.RoleViewer, api.EventsHandler(cfg.DeviceAdapter, eventSource, cfg.SigningKeys)))
+	mux.Handle("GET /api/events/schema", cfg.Authz.Require(dm.RoleViewer, api.EventSchemaHandler()))
+	mux.Handle("GET /api/schema", cfg.Authz.Require(dm.RoleViewer, api.APISchemaHandler()))
+	if cfg.EnableGraphQL {
+		mux.Handle("/api/graphql", cfg.Authz.Require(dm.RoleViewer, api.GraphQLHandler(cfg.Manager)))
+	}
+	if cfg.Manager != nil {
+		mux.Handle("GET /api/stats", cfg.Authz.Require(dm.RoleViewer, api.StatsHandler(cfg.Manager)))
+		mux.Handle("GET /api/stats/history", cfg.Authz.Require(dm.RoleViewer, api.StatsHistoryHandler(cfg.Manager)))
+		mux.Handle("GET /api/stats/talaria", cfg.Authz.Require(dm.RoleViewer, api.TalariaStatsHandler(cfg.Manager)))
+		mux.Handle("GET /api/reports/firmware-compliance", cfg.Authz.Require(dm.RoleViewer, api.FirmwareComplianceHandler(cfg.Manager)))
+		mux.Handle("GET /api/policy/firmware/lint", cfg.Authz.Require(dm.RoleViewer, api.LintFirmwareRulesHandler(cfg.Manager)))
+		mux.Handle("POST /api/policy/firmware/rules/check", cfg.Authz.Require(dm.RoleOperator, api.CheckFirmwareRuleHandler(cfg.Manager)))
+		var sim whatif.Settings // a nil *settings.Service must stay a nil interface
+		if cfg.Settings != nil {
+			sim = cfg.Settings
+		}
+		mux.Handle("POST /api/policy/whatif", cfg.Authz.Require(dm.RoleOperator, api.WhatIfHandler(cfg.Manager, sim)))
+		mux.Handle("GET /api/catalog/{kind}", cfg.Authz.Require(dm.RoleViewer, api.ListCatalogHandler(cfg.Manager)))
+		mux.Handle("POST /api/catalog/{kind}", cfg.Authz.Require(dm.RoleAdmin, idem.Wrap(api.CreateCatalogEntryHandler(cfg.Manager))))
+		mux.Handle("DELETE /api/catalog/{kind}/{id}", cfg.Authz.Require(dm.RoleAdmin, api.DeleteCatalogEntryHandler(cfg.Manager)))
+		mux.Handle("GET /api/features/{id}", cfg.Authz.Require(dm.RoleViewer, api.GetFeatureHandler(cfg.Manager)))
+		mux.Handle("PUT /api/features/{id}/rollout", cfg.Authz.Require(dm.RoleAdmin, api.FeatureRolloutHandler(cfg.Manager)))
+		mux.Handle("POST /api/features/{id}/enable", cfg.Authz.Require(dm.RoleAdmin, idem.Wrap(api.FeatureToggleHandler(cfg.Manager, true))))
+		mux.Handle("POST /api/features/{id}/disable", cfg.Authz.Require(dm.RoleAdmin, idem.Wrap(api.FeatureToggleHandler(cfg.Manager, false))))
+		mux.Handle("GET /metrics", cfg.Authz.Require(dm.RoleViewer, cfg.Manager.Metrics()))
+		mux.Handle("GET /api/devices/{id}/params", cfg.Authz.Require(dm.RoleViewer, api.GetParamsHandler(cfg.Manager)))
+		mux.Handle("PATCH /api/devices/{id}/params", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.SetParamsHandler(cfg.Manager))))
+		mux.Handle("GET /api/devices/{id}/config", cfg.Authz.Require(dm.RoleViewer, api.GetConfigHandler(cfg.Manager)))
+		mux.Handle("GET /api/devices/{id}/params/watch", cfg.Authz.Require(dm.RoleOperator, api.WatchParamsHandler(cfg.Manager)))
+		mux.Handle("GET /api/devices/{id}/params/watches", cfg.Authz.Require(dm.RoleViewer, api.ListWatchesHandler(cfg.Manager)))
+		mux.Handle("POST /api/devices/{id}/params/watches", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.RegisterWatchHandler(cfg.Manager))))
+		mux.Handle("DELETE /api/devices/{id}/params/watches/{watch}", cfg.Authz.Require(dm.RoleOperator, api.DeleteWatchHandler(cfg.Manager)))
+		mux.Handle("GET /api/devices/{id}/lock", cfg.Authz.Require(dm.RoleViewer, api.GetLockHandler(cfg.Manager)))
+		mux.Handle("POST /api/devices/{id}/lock", cfg.Authz.Require(dm.RoleOperator, api.AcquireLockHandler(cfg.Manager)))
+		mux.Handle("POST /api/devices/{id}/lock/renew", cfg.Authz.Require(dm.RoleOperator, api.RenewLockHandler(cfg.Manager)))
+		mux.Handle("DELETE /api/devices/{id}/lock", cfg.Authz.Require(dm.RoleOperator, api.ReleaseLockHandler(cfg.Manager)))
+		mux.Handle("POST /api/devices/{id}/lock/force-release", cfg.Authz.Require(dm.RoleAdmin, api.ForceReleaseLockHandler(cfg.Manager)))
+		mux.Handle("GET /api/quarantines", cfg.Authz.Require(dm.RoleViewer, api.ListQuarantinesHandler(cfg.Manager)))
+		mux.Handle("POST /api/quarantines", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.QuarantineHandler(cfg.Manager))))
+		mux.Handle("DELETE /api/quarantines/{qid}", cfg.Authz.Require(dm.RoleAdmin, api.ReleaseQuarantineHandler(cfg.Manager)))
+		mux.Handle("GET /api/devices/{id}/quarantine", cfg.Authz.Require(dm.RoleViewer, api.DeviceQuarantineHandler(cfg.Manager)))
+		mux.Handle("POST /api/devices/{id}/quarantine", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.DeviceQuarantineHandler(cfg.Manager))))
+		mux.Handle("DELETE /api/devices/{id}/quarantine", cfg.Authz.Require(dm.RoleAdmin, api.DeviceQuarantineHandler(cfg.Manager)))
+		mux.Handle("GET /api/devices/changes", cfg.Authz.Require(dm.RoleViewer, api.ChangesHandler(cfg.Manager)))
+		mux.Handle("GET /api/devices/{id}/history", cfg.Authz.Require(dm.RoleViewer, api.HistoryHandler(cfg.Manager)))
+		mux.Handle("GET /api/devices/{id}/operations", cfg.Authz.Require(dm.RoleViewer, api.OperationsHandler(cfg.Manager)))
+		mux.Handle("POST /api/devices/{id}/reboot", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.RebootHandler(cfg.Manager))))
+		mux.Handle("POST /api/devices/{id}/factory-reset", cfg.Authz.Require(dm.RoleAdmin, idem.Wrap(api.FactoryResetHandler(cfg.Manager))))
+		mux.Handle("POST /api/devices/{id}/ping", cfg.Authz.Require(dm.RoleViewer, api.PingHandler(cfg.Manager)))
+		mux.Handle("POST /api/devices/{id}/rpc", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.RPCHandler(cfg.Manager))))
+		mux.Handle("GET /api/devices/{id}/rpc", cfg.Authz.Require(dm.RoleOperator, api.InFlightCallsHandler(cfg.Manager)))
+		mux.Handle("DELETE /api/devices/{id}/rpc/{call}", cfg.Authz.Require(dm.RoleOperator, api.CancelCallHandler(cfg.Manager)))
+		mux.Handle("POST /api/devices/{id}/sessions", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.OpenSessionHandler(cfg.Manager))))
+		mux.Handle("GET /api/devices/{id}/sessions/{token}", cfg.Authz.Require(dm.RoleOperator, api.SessionHandler(cfg.Manager)))
+		mux.Handle("DELETE /api/devices/{id}/sessions/{token}", cfg.Authz.Require(dm.RoleOperator, api.CloseSessionHandler(cfg.Manager)))
+		mux.Handle("GET /api/devices/{id}/maintenance", cfg.Authz.Require(dm.RoleViewer, api.MaintenanceHandler(cfg.Manager)))
+		mux.Handle("POST /api/devices/{id}/logs/upload", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.LogUploadHandler(cfg.Manager))))
+		mux.Handle("POST /api/devices/{id}/operate", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.OperateHandler(cfg.Manager))))
+	}
+
+	if cfg.Webhooks != nil {
+		mux.Handle("GET /api/webhooks", cfg.Authz.Require(dm.RoleViewer, api.ListWebhooksHandler(cfg.Webhooks)))
+		mux.Handle("POST /api/webhooks", cfg.Authz.Require(dm.RoleOperator, api.RegisterWebhookHandler(cfg.Webhooks)))
+		mux.Handle("DELETE /api/webhooks/{id}", cfg.Authz.Require(dm.RoleOperator, api.DeleteWebhookHandler(cfg.Webhooks)))
+		mux.Handle("GET /api/webhooks/{id}/deadletters", cfg.Authz.Require(dm.RoleViewer, api.DeadLettersHandler(cfg.Webhooks)))
+	}
+
+	if cfg.Topics != nil {
+		mux.Handle("GET /api/topics", cfg.Authz.Require(dm.RoleViewer, api.ListTopicBindingsHandler(cfg.Topics)))
+		mux.Handle("POST /api/topics", cfg.Authz.Require(dm.RoleOperator, api.AddTopicBindingHandler(cfg.Topics)))
+		mux.Handle("DELETE /api/topics/{id}", cfg.Authz.Require(dm.RoleOperator, api.DeleteTopicBindingHandler(cfg.Topics)))
+	}
+
+	if subs := (api.Subscriptions{Webhooks: cfg.Webhooks, Topics: cfg.Topics, Manager: cfg.Manager}); subs != (api.Subscriptions{}) {
+		mux.Handle("GET /api/subscriptions", cfg.Authz.Require(dm.RoleViewer, api.ListSubscriptionsHandler(subs)))
+		mux.Handle("POST /api/subscriptions/{id}/renew", cfg.Authz.Require(dm.RoleOperator, api.RenewSubscriptionHandler(subs)))
+	}
+
+	if cfg.Jobs != nil {
+		mux.Handle("GET /api/jobs", cfg.Authz.Require(dm.RoleViewer, api.ListJobsHandler(cfg.Jobs)))
+		mux.Handle("POST /api/jobs", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.SubmitJobHandler(cfg.Jobs, cfg.DeviceAdapter, cfg.Annotations))))
+		mux.Handle("GET /api/jobs/{id}", cfg.Authz.Require(dm.RoleViewer, api.GetJobHandler(cfg.Jobs)))
+		mux.Handle("DELETE /api/jobs/{id}", cfg.Authz.Require(dm.RoleOperator, api.CancelJobHandler(cfg.Jobs)))
+		mux.Handle("POST /api/jobs/{id}/approve", cfg.Authz.Require(dm.RoleAdmin, idem.Wrap(api.ApproveJobHandler(cfg.Jobs))))
+		mux.Handle("POST /api/jobs/{id}/rerun", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.RerunJobHandler(cfg.Jobs))))
+		mux.Handle("GET /api/jobs/{id}/artifacts", cfg.Authz.Require(dm.RoleViewer, api.ListJobArtifactsHandler(cfg.Jobs)))
+		mux.Handle("GET /api/jobs/{id}/artifacts/{name...}", cfg.Authz.Require(dm.RoleViewer, api.GetJobArtifactHandler(cfg.Jobs)))
+		mux.Handle("GET /api/job-templates", cfg.Authz.Require(dm.RoleViewer, api.ListJobTemplatesHandler(cfg.Jobs)))
+		mux.Handle("PUT /api/job-templates/{name}", cfg.Authz.Require(dm.RoleOperator, api.SaveJobTemplateHandler(cfg.Jobs)))
+		mux.Handle("GET /api/job-templates/{name}", cfg.Authz.Require(dm.RoleViewer, api.GetJobTemplateHandler(cfg.Jobs)))
+		mux.Handle("DELETE /api/job-templates/{name}", cfg.Authz.Require(dm.RoleOperator, api.DeleteJobTemplateHandler(cfg.Jobs)))
+		mux.Handle("POST /api/job-templates/{name}/run", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.RunJobTemplateHandler(cfg.Jobs, cfg.DeviceAdapter, cfg.Annotations))))
+	}
+	if cfg.Plans != nil {
+		mux.Handle("POST /api/plans", cfg.Authz.Require(dm.RoleOperator, api.CreatePlanHandler(cfg.Plans)))
+		mux.Handle("GET /api/plans/{id}", cfg.Authz.Require(dm.RoleViewer, api.GetPlanHandler(cfg.Plans)))
+		mux.Handle("POST /api/plans/{id}/apply", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.ApplyPlanHandler(cfg.Plans))))
+	}
+
+	if cfg.Snapshots != nil {
+		mux.Handle("GET /api/devices/{id}/snapshots", cfg.Authz.Require(dm.RoleViewer, api.ListSnapshotsHandler(cfg.Snapshots)))
+		mux.Handle("POST /api/devices/{id}/snapshots", cfg.Authz.Require(dm.RoleOperator, api.CaptureSnapshotHandler(cfg.Snapshots)))
+		mux.Handle("GET /api/devices/{id}/snapshots/{sid}", cfg.Authz.Require(dm.RoleViewer, api.GetSnapshotHandler(cfg.Snapshots)))
+		mux.Handle("DELETE /api/devices/{id}/snapshots/{sid}", cfg.Authz.Require(dm.RoleOperator, api.DeleteSnapshotHandler(cfg.Snapshots)))
+		mux.Handle("GET /api/devices/{id}/snapshots/{sid}/diff", cfg.Authz.Require(dm.RoleViewer, api.DiffSnapshotHandler(cfg.Snapshots)))
+		mux.Handle("POST /api/devices/{id}/snapshots/{sid}/restore", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.RestoreSnapshotHandler(cfg.Snapshots))))
+		mux.Handle("GET /api/devices/{id}/compare", cfg.Authz.Require(dm.RoleViewer, api.CompareDevicesHandler(cfg.Snapshots)))
+	}
+
+	if cfg.Profiles != nil {
+		mux.Handle("GET /api/profiles", cfg.Authz.Require(dm.RoleViewer, api.ListProfilesHandler(cfg.Profiles)))
+		mux.Handle("PUT /api/profiles/{name}", cfg.Authz.Require(dm.RoleOperator, api.SaveProfileHandler(cfg.Profiles)))
+		mux.Handle("GET /api/profiles/{name}", cfg.Authz.Require(dm.RoleViewer, api.GetProfileHandler(cfg.Profiles)))
+		mux.Handle("GET /api/profiles/{name}/versions", cfg.Authz.Require(dm.RoleViewer, api.ProfileVersionsHandler(cfg.Profiles)))
+		mux.Handle("POST /api/profiles/{name}/apply", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.ApplyProfileGroupHandler(cfg.Profiles, cfg.DeviceAdapter, cfg.Annotations))))
+		mux.Handle("GET /api/devices/{id}/profiles", cfg.Authz.Require(dm.RoleViewer, api.DeviceProfilesHandler(cfg.Profiles)))
+		mux.Handle("GET /api/devices/{id}/profiles/{name}/render", cfg.Authz.Require(dm.RoleViewer, api.RenderProfileHandler(cfg.Profiles)))
+		mux.Handle("POST /api/devices/{id}/profiles/{name}/apply", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.ApplyProfileHandler(cfg.Profiles))))
+		mux.Handle("POST /api/devices/{id}/profiles/rollback", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.RollbackProfileHandler(cfg.Profiles))))
+	}
+
+	if cfg.Settings != nil {
+		mux.Handle("GET /api/settings/assignments", cfg.Authz.Require(dm.RoleViewer, api.ListSettingsAssignmentsHandler(cfg.Settings)))
+		mux.Handle("PUT /api/settings/assignments/{name}", cfg.Authz.Require(dm.RoleOperator, api.AssignSettingsHandler(cfg.Settings)))
+		mux.Handle("GET /api/settings/assignments/{name}", cfg.Authz.Require(dm.RoleViewer, api.SettingsAssignmentHandler(cfg.Settings)))
+		mux.Handle("DELETE /api/settings/assignments/{name}", cfg.Authz.Require(dm.RoleOperator, api.UnassignSettingsHandler(cfg.Settings)))
+		mux.Handle("POST /api/settings/assignments/{name}/reconcile", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.ReconcileSettingsHandler(cfg.Settings))))
+	}
+	if cfg.Quality != nil {
+		mux.Handle("GET /api/quality", cfg.Authz.Require(dm.RoleViewer, api.QualityHandler(cfg.Quality)))
+		mux.Handle("GET /api/devices/{id}/quality", cfg.Authz.Require(dm.RoleViewer, api.DeviceQualityHandler(cfg.Quality)))
+	}
+
+	if cfg.Firmware != nil {
+		mux.Handle("GET /api/devices/{id}/firmware", cfg.Authz.Require(dm.RoleViewer, api.ListFirmwareHandler(cfg.Firmware)))
+		mux.Handle("POST /api/devices/{id}/firmware", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.StartFirmwareHandler(cfg.Firmware))))
+		mux.Handle("GET /api/devices/{id}/firmware/{uid}", cfg.Authz.Require(dm.RoleViewer, api.GetFirmwareHandler(cfg.Firmware)))
+		mux.Handle("POST /api/firmware/rollouts", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.StartRolloutHandler(cfg.Firmware, cfg.DeviceAdapter, cfg.Annotations))))
+		mux.Handle("GET /api/firmware/rollouts", cfg.Authz.Require(dm.RoleViewer, api.ListRolloutsHandler(cfg.Firmware)))
+		mux.Handle("GET /api/firmware/rollouts/{id}", cfg.Authz.Require(dm.RoleViewer, api.GetRolloutHandler(cfg.Firmware)))
+		mux.Handle("POST /api/firmware/rollouts/{id}/resume", cfg.Authz.Require(dm.RoleOperator, api.ResumeRolloutHandler(cfg.Firmware)))
+	}
+
+	if cfg.Diagnostics != nil {
+		mux.Handle("POST /api/devices/{id}/diagnostics/{kind}", cfg.Authz.Require(dm.RoleOperator, idem.Wrap(api.DiagnosticsHandler(cfg.Diagnostics))))
+	}
+
+	if cfg.Annotations != nil {
+		mux.Handle("GET /api/devices/{id}/annotations", cfg.Authz.Require(dm.RoleViewer, api.GetAnnotationsHandler(cfg.Annotations)))
+		mux.Handle("PUT /api/devices/{id}/annotations", cfg.Authz.Require(dm.RoleOperator, api.PutAnnotationsHandler(cfg.Annotations)))
+		mux.Handle("DELETE /api/devices/{id}/annotations", cfg.Authz.Require(dm.RoleOperator, api.DeleteAnnotationsHandler(cfg.Annotations)))
+		mux.Handle("POST /api/devices/{id}/annotations/notes", cfg.Authz.Require(dm.RoleOperator, api.AddNoteHandler(cfg.Annotations)))
+		mux.Handle("DELETE /api/devices/{id}/annotations/notes/{nid}", cfg.Authz.Require(dm.RoleOperator, api.DeleteNoteHandler(cfg.Annotations)))
+	}
+
+	var handler http.Handler = api.LockOwner(api.QuarantineOverride(mux))
+	if cfg.Partners != nil {
+		handler = api.PartnerScope(cfg.Partners, handler)
+	}
+	handler = metrics.Trace(cfg.Allowlist.Wrap(handler))
+	return api.MountAt(cfg.PathPrefix, api.Versioned(cfg.LegacyAPI, handler)), nil
+}
+
 func durationOr(v time.Duration, d time.Duration) time.Duration {
 	if v <= 0 {
 		return d
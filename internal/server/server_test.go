@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	api "github.com/xmidt-org/talaria/devicemgr/internal/http"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+func TestDiscoveryHandlerRPCIdempotency(t *testing.T) {
+	talaria := httptest.NewServer(http.NotFoundHandler())
+	defer talaria.Close()
+	var calls atomic.Int32
+	upgrader := websocket.Upgrader{}
+	gw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			var req struct {
+				ID string `json:"id"`
+			}
+			if c.ReadJSON(&req) != nil {
+				return
+			}
+			calls.Add(1)
+			c.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":"`+req.ID+`","result":"rebooting"}`))
+		}
+	}))
+	defer gw.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = talaria.URL
+	opts.BlizzardBaseURL = "ws://" + strings.TrimPrefix(gw.URL, "http://")
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	h, err := NewDiscoveryHandler(DiscoveryConfig{Manager: m})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/devices/mac:aabbccddeeff/rpc", strings.NewReader(`{"method":"reboot"}`))
+		req.Header.Set(api.IdempotencyHeader, "retry-1")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	first := send()
+	if first.Code != http.StatusOK {
+		t.Fatalf("rpc: %d %s", first.Code, first.Body)
+	}
+	retry := send()
+	if calls.Load() != 1 || retry.Header().Get(api.IdempotentReplayedHeader) != "true" || retry.Body.String() != first.Body.String() {
+		t.Fatalf("retried rpc not replayed: %d calls, %d %s", calls.Load(), retry.Code, retry.Body)
+	}
+}
@@ -0,0 +1,176 @@
+// Package inventory writes device inventories as CSV or JSON Lines for inventory systems and
+// spreadsheets.
+package inventory
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Export formats.
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Field prefixes selecting one metadata key or annotation label, e.g. "meta.serial" or "label.site".
+const (
+	MetaPrefix  = "meta."
+	LabelPrefix = "label."
+)
+
+// Fields lists the named columns. Any metadata key or label can be selected with MetaPrefix or
+// LabelPrefix.
+var Fields = []string{"id", "status", "lastSeen", "model", "firmware", "partners", "tickets"}
+
+// DefaultFields are exported when none are selected.
+var DefaultFields = []string{"id", "status", "lastSeen", "model", "firmware", "partners"}
+
+// Device is one inventory row.
+type Device struct {
+	ID       string
+	Status   string
+	LastSeen time.Time
+	Metadata map[string]string
+	Tickets  []string
+	Labels   map[string]string
+}
+
+// ParseFields parses a comma-separated field list; empty selects DefaultFields.
+func ParseFields(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultFields, nil
+	}
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		known := slices.Contains(Fields, f) ||
+			(strings.HasPrefix(f, MetaPrefix) && len(f) > len(MetaPrefix)) ||
+			(strings.HasPrefix(f, LabelPrefix) && len(f) > len(LabelPrefix))
+		if !known {
+			return nil, fmt.Errorf("unknown export field %q (want one of %s, %s<key> or %s<key>): %w",
+				f, strings.Join(Fields, ", "), MetaPrefix, LabelPrefix, dm.ErrInvalidParameter)
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// ContentType returns the media type of format.
+func ContentType(format string) string {
+	if format == FormatJSONL {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Writer writes devices in one format, buffering output until Flush.
+type Writer struct {
+	format string
+	fields []string
+	bw     *bufio.Writer
+	csv    *csv.Writer
+}
+
+// NewWriter returns a Writer for format; CSV output starts with a header row of the field names.
+func NewWriter(w io.Writer, format string, fields []string) (*Writer, error) {
+	out := &Writer{format: format, fields: fields, bw: bufio.NewWriterSize(w, 32<<10)}
+	switch format {
+	case FormatCSV:
+		out.csv = csv.NewWriter(out.bw)
+		if err := out.csv.Write(fields); err != nil {
+			return nil, err
+		}
+	case FormatJSONL:
+	default:
+		return nil, fmt.Errorf("unknown export format %q (want %s or %s): %w", format, FormatCSV, FormatJSONL, dm.ErrInvalidParameter)
+	}
+	return out, nil
+}
+
+// Write writes one device.
+func (w *Writer) Write(d Device) error {
+	if w.csv != nil {
+		row := make([]string, len(w.fields))
+		for i, f := range w.fields {
+			switch v := value(d, f).(type) {
+			case []string:
+				row[i] = strings.Join(v, ";")
+			case string:
+				row[i] = v
+			}
+		}
+		return w.csv.Write(row)
+	}
+	// fields in the selected order rather than encoding/json's sorted map keys
+	w.bw.WriteByte('{')
+	for i, f := range w.fields {
+		if i > 0 {
+			w.bw.WriteByte(',')
+		}
+		k, _ := json.Marshal(f)
+		v, err := json.Marshal(value(d, f))
+		if err != nil {
+			return err
+		}
+		w.bw.Write(k)
+		w.bw.WriteByte(':')
+		w.bw.Write(v)
+	}
+	w.bw.WriteString("}\n")
+	return nil
+}
+
+// Flush writes any buffered output.
+func (w *Writer) Flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return w.bw.Flush()
+}
+
+// value returns field f of d: a string, or a []string for list fields.
+func value(d Device, f string) interface{} {
+	switch f {
+	case "id":
+		return d.ID
+	case "status":
+		return d.Status
+	case "lastSeen":
+		if d.LastSeen.IsZero() {
+			return ""
+		}
+		return d.LastSeen.UTC().Format(time.RFC3339)
+	case "model":
+		return d.Metadata[dm.MetadataModel]
+	case "firmware":
+		return d.Metadata[dm.MetadataFirmware]
+	case "partners":
+		return nonNil(dm.SplitPartners(d.Metadata[dm.MetadataPartnerIDs]))
+	case "tickets":
+		return nonNil(d.Tickets)
+	}
+	if k, ok := strings.CutPrefix(f, MetaPrefix); ok {
+		return d.Metadata[k]
+	}
+	return d.Labels[strings.TrimPrefix(f, LabelPrefix)]
+}
+
+// nonNil keeps empty lists encoding as [] rather than null.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
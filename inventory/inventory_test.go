@@ -0,0 +1,68 @@
+package inventory
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+var testDevice = Device{
+	ID:       "mac:000000000001",
+	Status:   "online",
+	LastSeen: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	Metadata: map[string]string{dm.MetadataModel: "XB7", dm.MetadataPartnerIDs: "comcast,sky", "serial": "S1"},
+	Labels:   map[string]string{"site": "lab, east"},
+}
+
+func TestParseFields(t *testing.T) {
+	if f, err := ParseFields(""); err != nil || !slices.Equal(f, DefaultFields) {
+		t.Fatalf("default: %v %v", f, err)
+	}
+	if f, err := ParseFields("id, meta.serial,label.site"); err != nil || !slices.Equal(f, []string{"id", "meta.serial", "label.site"}) {
+		t.Fatalf("got %v %v", f, err)
+	}
+	for _, bad := range []string{"id,nope", "meta.", "id,,model"} {
+		if _, err := ParseFields(bad); !errors.Is(err, dm.ErrInvalidParameter) {
+			t.Errorf("%q: %v", bad, err)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	fields := []string{"id", "lastSeen", "partners", "tickets", "meta.serial", "label.site", "firmware"}
+	var csv strings.Builder
+	w, err := NewWriter(&csv, FormatCSV, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(testDevice); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "id,lastSeen,partners,tickets,meta.serial,label.site,firmware\n" +
+		"mac:000000000001,2024-05-01T12:00:00Z,comcast;sky,,S1,\"lab, east\",\n"
+	if csv.String() != want {
+		t.Fatalf("csv:\n%s", csv.String())
+	}
+
+	var jsonl strings.Builder
+	if w, err = NewWriter(&jsonl, FormatJSONL, fields); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(testDevice)
+	w.Flush()
+	want = `{"id":"mac:000000000001","lastSeen":"2024-05-01T12:00:00Z","partners":["comcast","sky"],"tickets":[],"meta.serial":"S1","label.site":"lab, east","firmware":""}` + "\n"
+	if jsonl.String() != want {
+		t.Fatalf("jsonl:\n%s", jsonl.String())
+	}
+
+	if _, err := NewWriter(&jsonl, "xml", fields); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("unknown format: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// ResultsArtifact is the artifact every finished job gets: its DeviceResults, one JSON object per
+// line.
+const ResultsArtifact = "results.jsonl"
+
+// Artifact describes a file attached to a job, such as the per-device results, a diagnostic
+// output or a log bundle. Device artifacts are named <device>/<name>.
+type Artifact struct {
+	Name        string      `json:"name"`
+	Device      dm.DeviceID `json:"device,omitempty"` // the device it was reported for, if any
+	ContentType string      `json:"contentType"`
+	Size        int         `json:"size"`
+	CreatedAt   time.Time   `json:"createdAt"`
+}
+
+// artifactSink stores an artifact of the job an Operation is working for.
+type artifactSink func(ctx context.Context, device dm.DeviceID, name, contentType string, data []byte) error
+
+type artifactKey struct{}
+
+type deviceKey struct{}
+
+// ReportArtifact attaches data to the job the Operation is running for, as an artifact of the
+// device it is working on named <device>/<name>. Name must not contain "/"; an empty content type
+// is application/octet-stream. Outside a Service job it does nothing.
+func ReportArtifact(ctx context.Context, name, contentType string, data []byte) error {
+	sink, ok := ctx.Value(artifactKey{}).(artifactSink)
+	if !ok {
+		return nil
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("artifact name %q: %w", name, dm.ErrInvalidParameter)
+	}
+	device, _ := ctx.Value(deviceKey{}).(dm.DeviceID)
+	return sink(ctx, device, name, contentType, data)
+}
+
+// SetArtifacts stores job artifacts in store from then on instead of memory.
+func (s *Service) SetArtifacts(store dm.ArtifactStore) {
+	s.mu.Lock()
+	s.artifacts = store
+	s.mu.Unlock()
+}
+
+// putArtifact stores data and adds its description to j, replacing one of the same name.
+func (s *Service) putArtifact(ctx context.Context, j *Job, device dm.DeviceID, name, contentType string, data []byte) error {
+	if device != "" {
+		name = string(device) + "/" + name
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	s.mu.RLock()
+	store := s.artifacts
+	s.mu.RUnlock()
+	if err := store.Put(ctx, j.ID+"/"+name, data); err != nil {
+		return fmt.Errorf("storing artifact %s: %w", name, err)
+	}
+	a := Artifact{Name: name, Device: device, ContentType: contentType, Size: len(data), CreatedAt: time.Now()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range j.Artifacts {
+		if j.Artifacts[i].Name == name {
+			j.Artifacts[i] = a
+			return nil
+		}
+	}
+	j.Artifacts = append(j.Artifacts, a)
+	sort.Slice(j.Artifacts, func(i, k int) bool { return j.Artifacts[i].Name < j.Artifacts[k].Name })
+	return nil
+}
+
+// putResults stores ResultsArtifact for a finished job. The results stay on the job should the
+// store fail, so the error is dropped.
+func (s *Service) putResults(ctx context.Context, j *Job) {
+	s.mu.RLock()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range j.Results {
+		_ = enc.Encode(r)
+	}
+	s.mu.RUnlock()
+	_ = s.putArtifact(ctx, j, "", ResultsArtifact, "application/x-ndjson", buf.Bytes())
+}
+
+// Artifacts lists the artifacts of a job visible to the caller, by name.
+func (s *Service) Artifacts(ctx context.Context, id string) ([]Artifact, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	j, ok := s.jobs[id]
+	if !ok || !visible(ctx, j.Partners) {
+		return nil, ErrJobNotFound
+	}
+	return append([]Artifact{}, j.Artifacts...), nil
+}
+
+// Artifact returns the description and contents of a job's artifact.
+func (s *Service) Artifact(ctx context.Context, id, name string) (Artifact, []byte, error) {
+	s.mu.RLock()
+	j, ok := s.jobs[id]
+	if !ok || !visible(ctx, j.Partners) {
+		s.mu.RUnlock()
+		return Artifact{}, nil, ErrJobNotFound
+	}
+	var a Artifact
+	for _, c := range j.Artifacts {
+		if c.Name == name {
+			a = c
+		}
+	}
+	store := s.artifacts
+	s.mu.RUnlock()
+	if a.Name == "" {
+		return Artifact{}, nil, fmt.Errorf("job %s artifact %s: %w", id, name, dm.ErrArtifactNotFound)
+	}
+	b, err := store.Get(ctx, id+"/"+name)
+	if err != nil {
+		return Artifact{}, nil, fmt.Errorf("job %s artifact %s: %w", id, name, err)
+	}
+	return a, b, nil
+}
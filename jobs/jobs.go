@@ -0,0 +1,225 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// DefaultConcurrency is the number of devices worked in parallel when a job does not say.
+const DefaultConcurrency = 10
+
+// Operation applies a job's work to one device.
+type Operation func(ctx context.Context, id dm.DeviceID) error
+
+// Status is the lifecycle state of a Job.
+type Status string
+
+const (
+	StatusPending          Status = "pending"
+	StatusAwaitingApproval Status = "awaiting-approval" // held until a second admin approves it
+	StatusRunning          Status = "running"
+	StatusSucceeded        Status = "succeeded" // every device succeeded
+	StatusFailed           Status = "failed"    // finished with at least one device failure
+	StatusCanceled         Status = "canceled"
+)
+
+// Param is one parameter assignment in a job spec.
+type Param struct {
+	Name     string      `json:"name"`
+	Value    interface{} `json:"value"`
+	DataType string      `json:"dataType,omitempty"`
+}
+
+// Spec describes a bulk job.
+type Spec struct {
+	Operation   string        `json:"operation"` // registered operation name, e.g. "set"
+	Devices     []dm.DeviceID `json:"devices"`
+	Parameters  []Param       `json:"parameters,omitempty"`
+	Service     string        `json:"service,omitempty"` // translation service for parameter operations
+	Concurrency int           `json:"concurrency,omitempty"`
+	// Disruptive operations (reboot) outside a device's maintenance window fail unless Force (admins only)
+	// overrides the window or Defer waits for it to open.
+	Force bool   `json:"force,omitempty"`
+	Defer bool   `json:"defer,omitempty"`
+	Plan  string `json:"plan,omitempty"` // the plan an apply-plan job executes
+	// Pacing spares the backends and regional networks during large campaigns: Rate caps the
+	// devices started per minute, and BatchSize works the devices in batches, waiting Soak (a Go
+	// duration) after each batch finishes before starting the next.
+	Rate      int    `json:"rate,omitempty"`
+	BatchSize int    `json:"batchSize,omitempty"`
+	Soak      string `json:"soak,omitempty"`
+	// Confirm must repeat the operation name for operations that cannot be undone (factory-reset).
+	Confirm string `json:"confirm,omitempty"`
+	// Selector picks Devices by expression instead (see package selector); the API resolves it on
+	// submission.
+	Selector string `json:"selector,omitempty"`
+	// Template and RerunOf record where a job came from: the template it was rendered from, or the
+	// job whose failed devices it runs again.
+	Template string `json:"template,omitempty"`
+	RerunOf  string `json:"rerunOf,omitempty"`
+}
+
+// DeviceResult is the outcome of a job on one device.
+type DeviceResult struct {
+	Device     dm.DeviceID `json:"device"`
+	OK         bool        `json:"ok"`
+	Error      string      `json:"error,omitempty"`
+	Detail     string      `json:"detail,omitempty"` // set by the operation through ReportDetail
+	FinishedAt time.Time   `json:"finishedAt"`
+}
+
+// Progress counts devices processed so far.
+type Progress struct {
+	Total     int `json:"total"`
+	Done      int `json:"done"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped,omitempty"`
+	Remaining int `json:"remaining"`
+}
+
+type detailKey struct{}
+
+// ReportDetail records a short outcome (such as an upload location) for the device an Operation is
+// working on; it appears as DeviceResult.Detail. Outside Run it does nothing.
+func ReportDetail(ctx context.Context, detail string) {
+	if p, ok := ctx.Value(detailKey{}).(*string); ok {
+		*p = detail
+	}
+}
+
+// RunConfig configures Run.
+type RunConfig struct {
+	Concurrency int                          // optional; DefaultConcurrency when <= 0
+	Skip        func(dm.DeviceID) bool       // optional; devices to leave untouched (e.g. already done when resuming)
+	OnResult    func(DeviceResult, Progress) // optional; called serially after each device
+
+	Rate      int           // optional; devices started per minute, unpaced when <= 0
+	BatchSize int           // optional; devices per batch, a single batch when <= 0
+	Soak      time.Duration // optional; pause after each batch but the last
+}
+
+// RunConfig returns the Run configuration for the spec's concurrency and pacing. A negative rate
+// or batch size, or a malformed soak, is ErrInvalidParameter.
+func (spec Spec) RunConfig() (RunConfig, error) {
+	cfg := RunConfig{Concurrency: spec.Concurrency, Rate: spec.Rate, BatchSize: spec.BatchSize}
+	if spec.Rate < 0 || spec.BatchSize < 0 {
+		return RunConfig{}, fmt.Errorf("rate and batchSize must not be negative: %w", dm.ErrInvalidParameter)
+	}
+	if spec.Soak != "" {
+		d, err := time.ParseDuration(spec.Soak)
+		if err != nil || d < 0 {
+			return RunConfig{}, fmt.Errorf("soak %q: %w", spec.Soak, dm.ErrInvalidParameter)
+		}
+		cfg.Soak = d
+	}
+	return cfg, nil
+}
+
+// Run applies op to every device with bounded concurrency and returns the per-device results in
+// completion order. With cfg.Rate set, devices start no faster than that per minute; with
+// cfg.BatchSize set, each batch finishes, and cfg.Soak passes, before the next batch starts.
+// Devices not yet started when ctx is canceled are left out; Run then returns ctx.Err().
+func Run(ctx context.Context, devices []dm.DeviceID, op Operation, cfg RunConfig) ([]DeviceResult, error) {
+	n := cfg.Concurrency
+	if n <= 0 {
+		n = DefaultConcurrency
+	}
+	prog := Progress{Total: len(devices)}
+	var todo []dm.DeviceID
+	for _, id := range devices {
+		if cfg.Skip != nil && cfg.Skip(id) {
+			prog.Skipped++
+			continue
+		}
+		todo = append(todo, id)
+	}
+	prog.Remaining = len(todo)
+
+	var (
+		mu      sync.Mutex
+		results = make([]DeviceResult, 0, len(todo))
+		wg      sync.WaitGroup
+		work    = make(chan dm.DeviceID)
+		batch   sync.WaitGroup // devices of the current batch still running
+	)
+	for i := 0; i < n && i < len(todo); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range work {
+				r := DeviceResult{Device: id, OK: true}
+				opCtx := context.WithValue(context.WithValue(ctx, detailKey{}, &r.Detail), deviceKey{}, id)
+				if err := op(opCtx, id); err != nil {
+					r.OK, r.Error = false, err.Error()
+				}
+				r.FinishedAt = time.Now()
+				mu.Lock()
+				results = append(results, r)
+				prog.Done++
+				prog.Remaining--
+				if !r.OK {
+					prog.Failed++
+				}
+				if cfg.OnResult != nil {
+					cfg.OnResult(r, prog)
+				}
+				mu.Unlock()
+				batch.Done()
+			}
+		}()
+	}
+	var interval time.Duration
+	if cfg.Rate > 0 {
+		interval = time.Minute / time.Duration(cfg.Rate)
+	}
+	size := cfg.BatchSize
+	if size <= 0 {
+		size = len(todo)
+	}
+	var next time.Time // earliest start of the next device under Rate
+dispatch:
+	for i, id := range todo {
+		if i > 0 && i%size == 0 {
+			batch.Wait()
+			if !sleepCtx(ctx, cfg.Soak) {
+				break
+			}
+		}
+		if !sleepCtx(ctx, time.Until(next)) {
+			break
+		}
+		if ctx.Err() != nil {
+			break // a worker and ctx.Done may be ready together
+		}
+		batch.Add(1)
+		select {
+		case work <- id:
+		case <-ctx.Done():
+			batch.Done()
+			break dispatch
+		}
+		next = time.Now().Add(interval)
+	}
+	close(work)
+	wg.Wait()
+	return results, ctx.Err()
+}
+
+// sleepCtx waits for d, reporting false when ctx is done first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
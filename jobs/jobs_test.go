@@ -0,0 +1,393 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestRunBoundsConcurrencyAndSkips(t *testing.T) {
+	var inFlight, peak int32
+	op := func(ctx context.Context, id dm.DeviceID) error {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		if id == "mac:bad" {
+			return errors.New("boom")
+		}
+		return nil
+	}
+	devices := []dm.DeviceID{"mac:1", "mac:2", "mac:3", "mac:4", "mac:bad", "mac:done"}
+	var last Progress
+	results, err := Run(context.Background(), devices, op, RunConfig{
+		Concurrency: 2,
+		Skip:        func(id dm.DeviceID) bool { return id == "mac:done" },
+		OnResult:    func(_ DeviceResult, p Progress) { last = p },
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(results) != 5 || peak > 2 {
+		t.Fatalf("results=%d peak=%d", len(results), peak)
+	}
+	if last.Done != 5 || last.Failed != 1 || last.Skipped != 1 || last.Remaining != 0 {
+		t.Fatalf("unexpected progress %+v", last)
+	}
+}
+
+func TestRunReportDetail(t *testing.T) {
+	op := func(ctx context.Context, id dm.DeviceID) error {
+		ReportDetail(ctx, "logs/"+string(id))
+		return nil
+	}
+	results, err := Run(context.Background(), []dm.DeviceID{"mac:1", "mac:2"}, op, RunConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Detail != "logs/"+string(r.Device) {
+			t.Fatalf("unexpected detail %+v", r)
+		}
+	}
+	ReportDetail(context.Background(), "ignored") // outside Run
+}
+
+func TestDeferToWindow(t *testing.T) {
+	var calls int32
+	op := deferToWindow(func(ctx context.Context, id dm.DeviceID) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return &dm.MaintenanceWindowError{DeviceID: id, Next: time.Now().Add(20 * time.Millisecond)}
+		}
+		return nil
+	})
+	results, err := Run(context.Background(), []dm.DeviceID{"mac:1"}, op, RunConfig{})
+	if err != nil || !results[0].OK || calls != 2 {
+		t.Fatalf("results=%+v calls=%d err=%v", results, calls, err)
+	}
+}
+
+func TestServiceJobLifecycleAndScope(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc := NewService(ctx, map[string]Builder{"noop": func(Spec) (Operation, error) {
+		return func(ctx context.Context, id dm.DeviceID) error {
+			if scope, _ := dm.PartnersFromContext(ctx); len(scope) != 1 || scope[0] != "sky" {
+				return errors.New("scope not propagated")
+			}
+			return nil
+		}, nil
+	}})
+	if _, err := svc.Submit(ctx, Spec{Operation: "reboot", Devices: []dm.DeviceID{"mac:1"}}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("unknown operation should be invalid, got %v", err)
+	}
+	sky := dm.WithPartners(ctx, []string{"sky"})
+	j, err := svc.Submit(sky, Spec{Operation: "noop", Devices: []dm.DeviceID{"mac:1", "mac:2"}})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, err := svc.Get(sky, j.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got.Status == StatusSucceeded && len(got.Results) == 2 {
+			break
+		}
+		if got.Status == StatusFailed || time.Now().After(deadline) {
+			t.Fatalf("job did not succeed: %+v", got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := svc.Get(dm.WithPartners(ctx, []string{"comcast"}), j.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("other partner should not see job, got %v", err)
+	}
+	if n := len(svc.List(ctx)); n != 1 {
+		t.Fatalf("unscoped list = %d", n)
+	}
+}
+
+func TestServiceForceRequiresAdmin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	overrides := make(chan dm.AuditRecord, 1)
+	svc := NewService(ctx, map[string]Builder{"noop": func(Spec) (Operation, error) {
+		return func(ctx context.Context, id dm.DeviceID) error {
+			overrides <- dm.NewAuditRecord(ctx, "noop", id)
+			return nil
+		}, nil
+	}})
+	spec := Spec{Operation: "noop", Devices: []dm.DeviceID{"mac:1"}, Force: true}
+	if _, err := svc.Submit(dm.WithRole(ctx, dm.RoleOperator), spec); !errors.Is(err, dm.ErrAccessDenied) {
+		t.Fatalf("operator force: %v", err)
+	}
+	if _, err := svc.Submit(dm.WithRole(ctx, dm.RoleAdmin), spec); err != nil {
+		t.Fatalf("admin force: %v", err)
+	}
+	select {
+	case rec := <-overrides:
+		if !rec.Override || rec.Role != dm.RoleAdmin {
+			t.Fatalf("operation ran without the override or role: %+v", rec)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("forced job did not run")
+	}
+}
+
+func TestServiceCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan struct{}, 1)
+	svc := NewService(ctx, map[string]Builder{"block": func(Spec) (Operation, error) {
+		return func(ctx context.Context, id dm.DeviceID) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		}, nil
+	}})
+	j, err := svc.Submit(ctx, Spec{Operation: "block", Devices: []dm.DeviceID{"mac:0000000000a1", "mac:0000000000a2"}, Concurrency: 1})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	<-started
+	if _, err := svc.Cancel(dm.WithPartners(ctx, []string{"sky"}), j.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("scoped caller canceled an unscoped job: %v", err)
+	}
+	if _, err := svc.Cancel(ctx, j.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, _ := svc.Get(ctx, j.ID)
+		if got.Status == StatusCanceled {
+			if len(got.Results) != 1 || got.Results[0].OK {
+				t.Fatalf("the second device should not start: %+v", got.Results)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job not canceled: %+v", got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := svc.Cancel(ctx, j.ID); !errors.Is(err, dm.ErrConflict) {
+		t.Fatalf("canceling a finished job: %v", err)
+	}
+}
+
+func TestServiceApproval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var runs int32
+	records := make(chan dm.AuditRecord, 4)
+	svc := NewService(ctx, map[string]Builder{"noop": func(Spec) (Operation, error) {
+		return func(ctx context.Context, id dm.DeviceID) error {
+			atomic.AddInt32(&runs, 1)
+			records <- dm.NewAuditRecord(ctx, "noop", id)
+			return nil
+		}, nil
+	}})
+	svc.SetApprovals(dm.ApprovalConfig{Operations: map[string]int{"noop": 1}})
+	alice, bob := dm.WithActor(ctx, "alice"), dm.WithActor(ctx, "bob")
+
+	if _, err := svc.Submit(ctx, Spec{Operation: "noop", Devices: []dm.DeviceID{"mac:1", "mac:2"}}); !errors.Is(err, dm.ErrAccessDenied) {
+		t.Fatalf("unidentified submission of a job needing approval: %v", err)
+	}
+
+	small, err := svc.Submit(alice, Spec{Operation: "noop", Devices: []dm.DeviceID{"mac:1"}})
+	if err != nil || small.Status == StatusAwaitingApproval {
+		t.Fatalf("a job within the limit should run: %+v %v", small, err)
+	}
+	if rec := <-records; rec.Actor != "alice" || rec.Approver != "" {
+		t.Fatalf("job operation audited as %+v", rec)
+	}
+	j, err := svc.Submit(alice, Spec{Operation: "noop", Devices: []dm.DeviceID{"mac:1", "mac:2"}})
+	if err != nil || j.Status != StatusAwaitingApproval || j.Approval == nil || j.Approval.SubmittedBy != "alice" {
+		t.Fatalf("a job over the limit should be held: %+v %v", j, err)
+	}
+	if _, err := svc.Approve(alice, j.ID); !errors.Is(err, dm.ErrAccessDenied) {
+		t.Fatalf("self-approval: %v", err)
+	}
+	if _, err := svc.Approve(ctx, j.ID); !errors.Is(err, dm.ErrAccessDenied) {
+		t.Fatalf("anonymous approval: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("held job ran before approval: %d runs", n)
+	}
+	approved, err := svc.Approve(bob, j.ID)
+	if err != nil || approved.Approval.ApprovedBy != "bob" || approved.Approval.ApprovedAt == nil {
+		t.Fatalf("Approve: %+v %v", approved, err)
+	}
+	if _, err := svc.Approve(bob, j.ID); !errors.Is(err, dm.ErrConflict) {
+		t.Fatalf("approving twice: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, _ := svc.Get(ctx, j.ID)
+		if got.Status == StatusSucceeded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("approved job did not run: %+v", got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for i := 0; i < 2; i++ {
+		if rec := <-records; rec.Actor != "alice" || rec.Approver != "bob" {
+			t.Fatalf("approved job operation audited as %+v", rec)
+		}
+	}
+
+	held, _ := svc.Submit(alice, Spec{Operation: "noop", Devices: []dm.DeviceID{"mac:1", "mac:2"}})
+	if c, err := svc.Cancel(ctx, held.ID); err != nil || c.Status != StatusCanceled {
+		t.Fatalf("Cancel held job: %+v %v", c, err)
+	}
+	if _, err := svc.Approve(bob, held.ID); !errors.Is(err, dm.ErrConflict) {
+		t.Fatalf("approving a canceled job: %v", err)
+	}
+}
+
+func TestRunPacesBatchesAndRate(t *testing.T) {
+	var inFlight, peak int32
+	var mu sync.Mutex
+	starts := map[dm.DeviceID]time.Time{}
+	op := func(ctx context.Context, id dm.DeviceID) error {
+		mu.Lock()
+		starts[id] = time.Now()
+		mu.Unlock()
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		return nil
+	}
+	devices := []dm.DeviceID{"mac:1", "mac:2", "mac:3", "mac:4"}
+	cfg, err := Spec{BatchSize: 2, Soak: "50ms"}.RunConfig()
+	if err != nil {
+		t.Fatalf("RunConfig: %v", err)
+	}
+	if _, err := Run(context.Background(), devices, op, cfg); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if peak > 2 {
+		t.Fatalf("batch of 2 ran %d devices at once", peak)
+	}
+	if gap := starts["mac:3"].Sub(starts["mac:2"]); gap < 50*time.Millisecond {
+		t.Fatalf("second batch started %v after the first, before the soak", gap)
+	}
+
+	start := time.Now()
+	if _, err := Run(context.Background(), devices, op, RunConfig{Rate: 3000}); err != nil { // one every 20ms
+		t.Fatalf("Run: %v", err)
+	}
+	if took := time.Since(start); took < 60*time.Millisecond {
+		t.Fatalf("4 devices at 3000/min took %v", took)
+	}
+
+	for _, spec := range []Spec{{Rate: -1}, {BatchSize: -1}, {Soak: "soon"}} {
+		if _, err := spec.RunConfig(); !errors.Is(err, dm.ErrInvalidParameter) {
+			t.Fatalf("%+v: %v", spec, err)
+		}
+	}
+}
+
+func TestServiceArtifacts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc := NewService(ctx, map[string]Builder{"diag": func(Spec) (Operation, error) {
+		return func(ctx context.Context, id dm.DeviceID) error {
+			if err := ReportArtifact(ctx, "bad/name", "", nil); !errors.Is(err, dm.ErrInvalidParameter) {
+				return errors.New("slash in name accepted")
+			}
+			return ReportArtifact(ctx, "diag.json", "application/json", []byte(`{"device":"`+string(id)+`"}`))
+		}, nil
+	}})
+	if err := ReportArtifact(ctx, "outside.txt", "", []byte("x")); err != nil {
+		t.Fatalf("outside a job: %v", err)
+	}
+	j, err := svc.Submit(ctx, Spec{Operation: "diag", Devices: []dm.DeviceID{"mac:1", "mac:2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, _ := svc.Get(ctx, j.ID)
+		if got.FinishedAt != nil {
+			if got.Status != StatusSucceeded {
+				t.Fatalf("job failed: %+v", got)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish: %+v", got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	list, err := svc.Artifacts(ctx, j.ID)
+	if err != nil || len(list) != 3 || list[0].Name != "mac:1/diag.json" || list[0].Device != "mac:1" || list[2].Name != ResultsArtifact {
+		t.Fatalf("artifacts %+v %v", list, err)
+	}
+	a, b, err := svc.Artifact(ctx, j.ID, "mac:2/diag.json")
+	if err != nil || a.ContentType != "application/json" || string(b) != `{"device":"mac:2"}` {
+		t.Fatalf("artifact %+v %q %v", a, b, err)
+	}
+	_, b, err = svc.Artifact(ctx, j.ID, ResultsArtifact)
+	if err != nil || strings.Count(string(b), "\n") != 2 || !strings.Contains(string(b), `"device":"mac:1"`) {
+		t.Fatalf("results %q %v", b, err)
+	}
+	if _, _, err := svc.Artifact(ctx, j.ID, "missing"); !errors.Is(err, dm.ErrArtifactNotFound) {
+		t.Fatalf("expected artifact not found, got %v", err)
+	}
+	if _, err := svc.Artifacts(dm.WithPartners(ctx, []string{"sky"}), j.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("scoped caller should not see unscoped job, got %v", err)
+	}
+	if got := svc.List(ctx); len(got) != 1 || got[0].Artifacts != nil {
+		t.Fatalf("list should leave out artifacts: %+v", got)
+	}
+}
+
+func TestServiceOnFinish(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc := NewService(ctx, map[string]Builder{"noop": func(Spec) (Operation, error) {
+		return func(context.Context, dm.DeviceID) error { return nil }, nil
+	}})
+	svc.SetApprovals(dm.ApprovalConfig{Operations: map[string]int{"noop": 1}})
+	finished := make(chan Job, 2)
+	svc.SetOnFinish(func(j Job) { finished <- j })
+
+	j, _ := svc.Submit(ctx, Spec{Operation: "noop", Devices: []dm.DeviceID{"mac:1"}})
+	select {
+	case got := <-finished:
+		if got.ID != j.ID || got.Status != StatusSucceeded || got.FinishedAt == nil {
+			t.Fatalf("finished %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("job did not report finishing")
+	}
+	held, _ := svc.Submit(dm.WithActor(ctx, "alice"), Spec{Operation: "noop", Devices: []dm.DeviceID{"mac:1", "mac:2"}})
+	if _, err := svc.Cancel(ctx, held.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-finished; got.ID != held.ID || got.Status != StatusCanceled {
+		t.Fatalf("canceled held job %+v", got)
+	}
+}
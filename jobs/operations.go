@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// Operation names registered by Builders.
+const (
+	OperationSet          = "set"           // writes Spec.Parameters to every device
+	OperationUploadLogs   = "upload-logs"   // triggers a log upload; the detail is the upload location
+	OperationReboot       = "reboot"        // reboots, subject to maintenance windows
+	OperationFactoryReset = "factory-reset" // erases configuration; Spec.Confirm must repeat the name
+)
+
+// Builders returns the operations backed by m, keyed by operation name.
+func Builders(m *manager.Manager) map[string]Builder {
+	return map[string]Builder{OperationSet: SetParameters(m), OperationUploadLogs: UploadLogs(m), OperationReboot: Reboot(m), OperationFactoryReset: FactoryReset(m)}
+}
+
+// SetParameters builds the "set" operation: one SET of Spec.Parameters per device.
+func SetParameters(m *manager.Manager) Builder {
+	return func(spec Spec) (Operation, error) {
+		if len(spec.Parameters) == 0 {
+			return nil, fmt.Errorf("parameters required: %w", dm.ErrInvalidParameter)
+		}
+		params := make([]dm.SetParameter, 0, len(spec.Parameters))
+		for _, p := range spec.Parameters {
+			if p.Name == "" {
+				return nil, fmt.Errorf("parameter name required: %w", dm.ErrInvalidParameter)
+			}
+			params = append(params, dm.SetParameter{Name: p.Name, Value: p.Value, TypeHint: p.DataType})
+		}
+		return func(ctx context.Context, id dm.DeviceID) error {
+			_, err := m.SetParameters(ctx, id, spec.Service, params, dm.SetOptions{})
+			return err
+		}, nil
+	}
+}
+
+// UploadLogs builds the "upload-logs" operation: Manager.UploadLogs on each device.
+func UploadLogs(m *manager.Manager) Builder {
+	return func(spec Spec) (Operation, error) {
+		return func(ctx context.Context, id dm.DeviceID) error {
+			res, err := m.UploadLogs(ctx, id, manager.LogUploadOptions{})
+			if err != nil {
+				return err
+			}
+			ReportDetail(ctx, res.Location)
+			return nil
+		}, nil
+	}
+}
+
+// Reboot builds the "reboot" operation: Manager.Reboot on each device.
+func Reboot(m *manager.Manager) Builder {
+	return func(spec Spec) (Operation, error) {
+		return m.Reboot, nil
+	}
+}
+
+// FactoryReset builds the "factory-reset" operation: Manager.FactoryReset on each device. The job's
+// Confirm stands in for the per-device confirmation.
+func FactoryReset(m *manager.Manager) Builder {
+	return func(spec Spec) (Operation, error) {
+		if spec.Confirm != OperationFactoryReset {
+			return nil, fmt.Errorf("confirm must repeat %q: %w", OperationFactoryReset, dm.ErrConfirmationRequired)
+		}
+		return func(ctx context.Context, id dm.DeviceID) error {
+			return m.FactoryReset(ctx, id, string(id))
+		}, nil
+	}
+}
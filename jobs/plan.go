@@ -0,0 +1,240 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+var (
+	ErrPlanNotFound = errors.New("plan not found")
+	ErrPlanApplied  = errors.New("plan already applied")
+)
+
+// OperationApplyPlan names the jobs started by Planner.ApplyChange. It is not a Builder, so it
+// cannot be submitted directly.
+const OperationApplyPlan = "apply-plan"
+
+// Devices is the subset of manager.Manager used by Planner.
+type Devices interface {
+	RefreshParameters(ctx context.Context, id dm.DeviceID, service string, names []string) (map[string]dm.ParameterValue, error)
+	SetParameters(ctx context.Context, id dm.DeviceID, service string, params []dm.SetParameter, opts dm.SetOptions) (*runtime.SetResult, error)
+}
+
+// PlanSpec is the desired state of a parameter change: the values Parameters should have on Devices.
+type PlanSpec struct {
+	Devices     []dm.DeviceID `json:"devices"`
+	Parameters  []Param       `json:"parameters"`
+	Service     string        `json:"service,omitempty"`
+	Concurrency int           `json:"concurrency,omitempty"` // devices read (and later written) in parallel
+}
+
+// ParamChange is one parameter whose current value differs from the desired one.
+type ParamChange struct {
+	Name     string      `json:"name"`
+	Current  interface{} `json:"current"`
+	Desired  interface{} `json:"desired"`
+	DataType string      `json:"dataType,omitempty"`
+}
+
+// DevicePlan is the diff for one device. A device that could not be read has Error set and is left
+// out when the plan is applied.
+type DevicePlan struct {
+	Device  dm.DeviceID   `json:"device"`
+	Changes []ParamChange `json:"changes,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// PlanSummary counts a plan's devices by outcome.
+type PlanSummary struct {
+	Devices int `json:"devices"`
+	Changed int `json:"changed"` // devices with at least one change
+	InSync  int `json:"inSync"`
+	Failed  int `json:"failed"` // devices that could not be read
+	Changes int `json:"changes"`
+}
+
+// Plan is a stored diff of desired against current parameter values, ready to apply.
+type Plan struct {
+	ID        string       `json:"id"`
+	Spec      PlanSpec     `json:"spec"`
+	Partners  []string     `json:"partners,omitempty"` // planner's partner scope; empty is unscoped
+	CreatedAt time.Time    `json:"createdAt"`
+	Summary   PlanSummary  `json:"summary"`
+	Devices   []DevicePlan `json:"devices"`
+	Job       string       `json:"job,omitempty"` // the apply-plan job, once applied
+}
+
+// Planner produces and applies parameter change plans: PlanChange reads every device and records
+// what would change, and ApplyChange writes exactly those changes as a job. Plans are kept in
+// memory and can be applied once.
+type Planner struct {
+	jobs *Service
+	m    Devices
+
+	mu    sync.Mutex
+	plans map[string]*Plan
+}
+
+// NewPlanner applies plans as jobs of svc.
+func NewPlanner(svc *Service, m Devices) *Planner {
+	return &Planner{jobs: svc, m: m, plans: make(map[string]*Plan)}
+}
+
+// PlanChange reads the spec's parameters from every device and stores the differences from the
+// desired values as a new plan. Devices are read within the caller's partner scope.
+func (p *Planner) PlanChange(ctx context.Context, spec PlanSpec) (Plan, error) {
+	if len(spec.Devices) == 0 {
+		return Plan{}, fmt.Errorf("devices required: %w", dm.ErrInvalidParameter)
+	}
+	if len(spec.Parameters) == 0 {
+		return Plan{}, fmt.Errorf("parameters required: %w", dm.ErrInvalidParameter)
+	}
+	names := make([]string, 0, len(spec.Parameters))
+	for _, param := range spec.Parameters {
+		if param.Name == "" || strings.HasSuffix(param.Name, ".") {
+			return Plan{}, fmt.Errorf("full parameter name required, got %q: %w", param.Name, dm.ErrInvalidParameter)
+		}
+		names = append(names, param.Name)
+	}
+
+	var mu sync.Mutex
+	diffs := make(map[dm.DeviceID]DevicePlan, len(spec.Devices))
+	_, err := Run(ctx, spec.Devices, func(ctx context.Context, id dm.DeviceID) error {
+		d := DevicePlan{Device: id}
+		current, err := p.m.RefreshParameters(ctx, id, spec.Service, names)
+		if err != nil {
+			d.Error = err.Error()
+		} else {
+			d.Changes = diffParams(spec.Parameters, current)
+		}
+		mu.Lock()
+		diffs[id] = d
+		mu.Unlock()
+		return err
+	}, RunConfig{Concurrency: spec.Concurrency})
+	if err != nil {
+		return Plan{}, err
+	}
+
+	plan := &Plan{ID: uuid.NewString(), Spec: spec, CreatedAt: time.Now()}
+	if scope, ok := dm.PartnersFromContext(ctx); ok {
+		plan.Partners = scope
+	}
+	for _, id := range spec.Devices {
+		d, ok := diffs[id]
+		if !ok {
+			continue // listed twice; Run worked it once
+		}
+		delete(diffs, id)
+		plan.Devices = append(plan.Devices, d)
+		plan.Summary.Devices++
+		switch {
+		case d.Error != "":
+			plan.Summary.Failed++
+		case len(d.Changes) == 0:
+			plan.Summary.InSync++
+		default:
+			plan.Summary.Changed++
+			plan.Summary.Changes += len(d.Changes)
+		}
+	}
+	p.mu.Lock()
+	p.plans[plan.ID] = plan
+	p.mu.Unlock()
+	return *plan, nil
+}
+
+// diffParams returns the desired parameters whose current value differs, compared as text since
+// WDMP reports most values as strings.
+func diffParams(desired []Param, current map[string]dm.ParameterValue) []ParamChange {
+	var out []ParamChange
+	for _, param := range desired {
+		cur, ok := current[param.Name]
+		if ok && cur.Value != nil && fmt.Sprint(cur.Value) == fmt.Sprint(param.Value) {
+			continue
+		}
+		out = append(out, ParamChange{Name: param.Name, Current: cur.Value, Desired: param.Value, DataType: param.DataType})
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Name < out[k].Name })
+	return out
+}
+
+// Get returns a plan visible to the caller.
+func (p *Planner) Get(ctx context.Context, id string) (Plan, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	plan, ok := p.plans[id]
+	if !ok || !visible(ctx, plan.Partners) {
+		return Plan{}, ErrPlanNotFound
+	}
+	return *plan, nil
+}
+
+// ApplyChange starts a job writing the plan's changes to the devices that have any. Before its
+// SET, each device is read again: a device whose values moved since the plan was made fails with
+// the parameters that changed rather than being overwritten blindly.
+func (p *Planner) ApplyChange(ctx context.Context, id string) (Job, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	plan, ok := p.plans[id]
+	if !ok || !visible(ctx, plan.Partners) {
+		return Job{}, ErrPlanNotFound
+	}
+	if plan.Job != "" {
+		return Job{}, fmt.Errorf("%w by job %s", ErrPlanApplied, plan.Job)
+	}
+	changes := make(map[dm.DeviceID][]ParamChange)
+	var devices []dm.DeviceID
+	for _, d := range plan.Devices {
+		if d.Error == "" && len(d.Changes) > 0 {
+			changes[d.Device] = d.Changes
+			devices = append(devices, d.Device)
+		}
+	}
+	if len(devices) == 0 {
+		return Job{}, fmt.Errorf("plan %s has no changes: %w", id, dm.ErrInvalidParameter)
+	}
+	service := plan.Spec.Service
+	j, err := p.jobs.start(ctx, Spec{Operation: OperationApplyPlan, Devices: devices, Service: service, Concurrency: plan.Spec.Concurrency, Plan: id},
+		func(ctx context.Context, device dm.DeviceID) error {
+			planned := changes[device]
+			names := make([]string, len(planned))
+			params := make([]dm.SetParameter, len(planned))
+			for i, c := range planned {
+				names[i] = c.Name
+				params[i] = dm.SetParameter{Name: c.Name, Value: c.Desired, TypeHint: c.DataType}
+			}
+			current, err := p.m.RefreshParameters(ctx, device, service, names)
+			if err != nil {
+				return err
+			}
+			var moved []string
+			for _, c := range planned {
+				if fmt.Sprint(current[c.Name].Value) != fmt.Sprint(c.Current) {
+					moved = append(moved, c.Name)
+				}
+			}
+			if len(moved) > 0 {
+				return fmt.Errorf("changed since the plan was made: %s", strings.Join(moved, ", "))
+			}
+			if _, err := p.m.SetParameters(ctx, device, service, params, dm.SetOptions{}); err != nil {
+				return err
+			}
+			ReportDetail(ctx, fmt.Sprintf("%d parameters set", len(params)))
+			return nil
+		})
+	if err != nil {
+		return Job{}, err
+	}
+	plan.Job = j.ID
+	return j, nil
+}
@@ -0,0 +1,118 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// fakeDevices holds parameter values per device and records SETs.
+type fakeDevices struct {
+	mu     sync.Mutex
+	values map[dm.DeviceID]map[string]interface{}
+	sets   map[dm.DeviceID][]dm.SetParameter
+}
+
+func (f *fakeDevices) RefreshParameters(ctx context.Context, id dm.DeviceID, service string, names []string) (map[string]dm.ParameterValue, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values, ok := f.values[id]
+	if !ok {
+		return nil, dm.ErrDeviceNotFound
+	}
+	out := make(map[string]dm.ParameterValue)
+	for _, n := range names {
+		if v, ok := values[n]; ok {
+			out[n] = dm.ParameterValue{Name: n, Value: v}
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeDevices) SetParameters(ctx context.Context, id dm.DeviceID, service string, params []dm.SetParameter, opts dm.SetOptions) (*runtime.SetResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sets[id] = append(f.sets[id], params...)
+	for _, p := range params {
+		f.values[id][p.Name] = p.Value
+	}
+	return &runtime.SetResult{}, nil
+}
+
+func (f *fakeDevices) set(id dm.DeviceID, name string, v interface{}) {
+	f.mu.Lock()
+	f.values[id][name] = v
+	f.mu.Unlock()
+}
+
+func TestPlannerPlanAndApply(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	devices := &fakeDevices{
+		values: map[dm.DeviceID]map[string]interface{}{
+			"mac:1": {"Device.A": "1", "Device.B": "x"},
+			"mac:2": {"Device.A": "2", "Device.B": "y"},
+			"mac:3": {"Device.A": "2", "Device.B": "x"},
+			"mac:4": {"Device.A": "1", "Device.B": "x"},
+		},
+		sets: make(map[dm.DeviceID][]dm.SetParameter),
+	}
+	p := NewPlanner(NewService(ctx, nil), devices)
+	spec := PlanSpec{
+		Devices:    []dm.DeviceID{"mac:1", "mac:2", "mac:3", "mac:4", "mac:gone"},
+		Parameters: []Param{{Name: "Device.A", Value: 2}, {Name: "Device.B", Value: "x"}},
+	}
+	plan, err := p.PlanChange(ctx, spec)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if want := (PlanSummary{Devices: 5, Changed: 3, InSync: 1, Failed: 1, Changes: 3}); plan.Summary != want {
+		t.Fatalf("summary %+v, want %+v", plan.Summary, want)
+	}
+	if d := plan.Devices[1]; d.Device != "mac:2" || len(d.Changes) != 1 || d.Changes[0].Name != "Device.B" || d.Changes[0].Current != "y" {
+		t.Fatalf("mac:2 plan: %+v", d)
+	}
+	if _, err := p.Get(dm.WithPartners(ctx, []string{"sky"}), plan.ID); !errors.Is(err, ErrPlanNotFound) {
+		t.Fatalf("scoped caller saw an unscoped plan: %v", err)
+	}
+
+	devices.set("mac:4", "Device.A", "3") // drifts between plan and apply
+	j, err := p.ApplyChange(ctx, plan.ID)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if j.Spec.Operation != OperationApplyPlan || j.Spec.Plan != plan.ID || len(j.Spec.Devices) != 3 {
+		t.Fatalf("job spec: %+v", j.Spec)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for j.Status != StatusFailed {
+		if j.Status == StatusSucceeded || time.Now().After(deadline) {
+			t.Fatalf("job: %+v", j)
+		}
+		time.Sleep(5 * time.Millisecond)
+		j, _ = p.jobs.Get(ctx, j.ID)
+	}
+	for _, r := range j.Results {
+		if (r.Device == "mac:4") == r.OK || (r.Device == "mac:4" && !strings.Contains(r.Error, "Device.A")) {
+			t.Fatalf("result: %+v", r)
+		}
+	}
+	if got := devices.sets["mac:2"]; len(got) != 1 || got[0].Name != "Device.B" {
+		t.Fatalf("mac:2 sets: %+v", got)
+	}
+	if got := devices.sets["mac:3"]; len(got) != 0 {
+		t.Fatalf("in-sync device was written: %+v", got)
+	}
+	if _, err := p.ApplyChange(ctx, plan.ID); !errors.Is(err, ErrPlanApplied) {
+		t.Fatalf("second apply: %v", err)
+	}
+	if _, err := p.PlanChange(ctx, PlanSpec{Devices: spec.Devices, Parameters: []Param{{Name: "Device."}}}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("partial path: %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// Builder validates a spec and returns the per-device operation for it.
+type Builder func(spec Spec) (Operation, error)
+
+// Job is a submitted bulk job and its progress.
+type Job struct {
+	ID         string         `json:"id"`
+	Spec       Spec           `json:"spec"`
+	Status     Status         `json:"status"`
+	Partners   []string       `json:"partners,omitempty"` // submitter's partner scope; empty is unscoped
+	CreatedAt  time.Time      `json:"createdAt"`
+	StartedAt  *time.Time     `json:"startedAt,omitempty"`
+	FinishedAt *time.Time     `json:"finishedAt,omitempty"`
+	Progress   Progress       `json:"progress"`
+	Results    []DeviceResult `json:"results,omitempty"`
+	Approval   *Approval      `json:"approval,omitempty"` // set on jobs held for approval
+	Artifacts  []Artifact     `json:"artifacts,omitempty"`
+}
+
+// Approval records who submitted a held job and who let it run.
+type Approval struct {
+	SubmittedBy string     `json:"submittedBy,omitempty"`
+	ApprovedBy  string     `json:"approvedBy,omitempty"`
+	ApprovedAt  *time.Time `json:"approvedAt,omitempty"`
+}
+
+// Service runs bulk jobs in the background and keeps them in memory for inspection.
+type Service struct {
+	builders map[string]Builder
+	ctx      context.Context
+
+	mu        sync.RWMutex
+	approvals dm.ApprovalConfig
+	artifacts dm.ArtifactStore
+	jobs      map[string]*Job
+	cancels   map[string]context.CancelFunc // jobs not yet finished
+	held      map[string]heldJob            // jobs awaiting approval
+	templates map[string]Template
+	onFinish  func(Job)
+}
+
+// heldJob is what a job awaiting approval runs once approved.
+type heldJob struct {
+	ctx context.Context
+	op  Operation
+}
+
+// NewService creates a Service whose jobs run until ctx is canceled, keeping their artifacts in
+// memory. Builders are keyed by Spec.Operation.
+func NewService(ctx context.Context, builders map[string]Builder) *Service {
+	return &Service{builders: builders, ctx: ctx, artifacts: dm.NewMemoryArtifactStore(), jobs: make(map[string]*Job), cancels: make(map[string]context.CancelFunc), held: make(map[string]heldJob), templates: make(map[string]Template)}
+}
+
+// SetApprovals holds the jobs cfg names for approval from then on; see Approve.
+func (s *Service) SetApprovals(cfg dm.ApprovalConfig) {
+	s.mu.Lock()
+	s.approvals = cfg
+	s.mu.Unlock()
+}
+
+// SetOnFinish calls fn with every job once it has finished, canceled ones included, from then on.
+func (s *Service) SetOnFinish(fn func(Job)) {
+	s.mu.Lock()
+	s.onFinish = fn
+	s.mu.Unlock()
+}
+
+// finished passes a finished job to the SetOnFinish callback; callers must not hold s.mu.
+func (s *Service) finished(j Job) {
+	s.mu.RLock()
+	fn := s.onFinish
+	s.mu.RUnlock()
+	if fn != nil {
+		fn(j)
+	}
+}
+
+// Submit validates spec and starts the job. The caller's partner scope (if any) applies to every device
+// operation and limits who can see the job.
+func (s *Service) Submit(ctx context.Context, spec Spec) (Job, error) {
+	build, ok := s.builders[spec.Operation]
+	if !ok {
+		return Job{}, fmt.Errorf("unknown operation %q: %w", spec.Operation, dm.ErrInvalidParameter)
+	}
+	if len(spec.Devices) == 0 {
+		return Job{}, fmt.Errorf("devices required: %w", dm.ErrInvalidParameter)
+	}
+	if spec.Force && !dm.OverrideAllowed(ctx) {
+		return Job{}, fmt.Errorf("force requires the %s role: %w", dm.RoleAdmin, dm.ErrAccessDenied)
+	}
+	if role, ok := dm.RoleFromContext(ctx); ok && role < dm.RoleAdmin && spec.Operation == OperationFactoryReset {
+		// like POST /api/devices/{id}/factory-reset
+		return Job{}, fmt.Errorf("%s requires the %s role: %w", OperationFactoryReset, dm.RoleAdmin, dm.ErrAccessDenied)
+	}
+	if _, err := spec.RunConfig(); err != nil {
+		return Job{}, err
+	}
+	op, err := build(spec)
+	if err != nil {
+		return Job{}, err
+	}
+	return s.start(ctx, spec, op)
+}
+
+// start records a job for spec and runs op on its devices in the background, or holds it for
+// approval when the service's approvals name it. A job needing approval from an unidentified
+// submitter is ErrAccessDenied, as nobody could tell its approver apart from its submitter.
+func (s *Service) start(ctx context.Context, spec Spec, op Operation) (Job, error) {
+	j := &Job{ID: uuid.NewString(), Spec: spec, Status: StatusPending, CreatedAt: time.Now(), Progress: Progress{Total: len(spec.Devices), Remaining: len(spec.Devices)}}
+	runCtx := s.ctx
+	submitter := dm.ActorFromContext(ctx)
+	if submitter != "" {
+		// audit and operation history records of the job's operations name the submitter
+		runCtx = dm.WithActor(runCtx, submitter)
+	}
+	if scope, ok := dm.PartnersFromContext(ctx); ok {
+		j.Partners = scope
+		runCtx = dm.WithPartners(runCtx, scope)
+	}
+	if role, ok := dm.RoleFromContext(ctx); ok {
+		// audit records of the job's operations carry the submitter's role
+		runCtx = dm.WithRole(runCtx, role)
+	}
+	if spec.Force {
+		runCtx = dm.WithMaintenanceOverride(runCtx)
+	} else if spec.Defer {
+		op = deferToWindow(op)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	held := s.approvals.Required(spec.Operation, len(spec.Devices))
+	if held && submitter == "" {
+		return Job{}, fmt.Errorf("%s on %d devices requires approval, and so an identified submitter: %w", spec.Operation, len(spec.Devices), dm.ErrAccessDenied)
+	}
+	runCtx, cancel := context.WithCancel(runCtx)
+	s.jobs[j.ID] = j
+	s.cancels[j.ID] = cancel
+	if held {
+		j.Status = StatusAwaitingApproval
+		j.Approval = &Approval{SubmittedBy: submitter}
+		s.held[j.ID] = heldJob{ctx: runCtx, op: op}
+		return j.snapshot(), nil
+	}
+	go s.run(runCtx, j, op)
+	return j.snapshot(), nil
+}
+
+// Approve starts a job awaiting approval. The approver must be identified and must not be the
+// job's submitter, so a destructive job always involves two people; otherwise the approval is
+// ErrAccessDenied. A job not awaiting approval is ErrConflict.
+func (s *Service) Approve(ctx context.Context, id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok || !visible(ctx, j.Partners) {
+		return Job{}, ErrJobNotFound
+	}
+	h, ok := s.held[id]
+	if !ok {
+		return Job{}, fmt.Errorf("job %s is %s, not awaiting approval: %w", id, j.Status, dm.ErrConflict)
+	}
+	approver := dm.ActorFromContext(ctx)
+	switch {
+	case approver == "":
+		return Job{}, fmt.Errorf("approving job %s requires an identified caller: %w", id, dm.ErrAccessDenied)
+	case approver == j.Approval.SubmittedBy:
+		return Job{}, fmt.Errorf("job %s must be approved by someone other than its submitter: %w", id, dm.ErrAccessDenied)
+	}
+	delete(s.held, id)
+	now := time.Now()
+	j.Approval.ApprovedBy, j.Approval.ApprovedAt = approver, &now
+	j.Status = StatusPending
+	go s.run(dm.WithApprover(h.ctx, approver), j, h.op)
+	return j.snapshot(), nil
+}
+
+func (s *Service) run(ctx context.Context, j *Job, op Operation) {
+	s.mu.Lock()
+	now := time.Now()
+	j.Status, j.StartedAt = StatusRunning, &now
+	s.mu.Unlock()
+	cfg, _ := j.Spec.RunConfig() // checked by Submit
+	cfg.OnResult = func(r DeviceResult, p Progress) {
+		s.mu.Lock()
+		j.Results = append(j.Results, r)
+		j.Progress = p
+		s.mu.Unlock()
+	}
+	var sink artifactSink = func(ctx context.Context, device dm.DeviceID, name, contentType string, data []byte) error {
+		return s.putArtifact(ctx, j, device, name, contentType, data)
+	}
+	_, err := Run(context.WithValue(ctx, artifactKey{}, sink), j.Spec.Devices, op, cfg)
+	// the job's context may be canceled by now
+	s.putResults(context.WithoutCancel(ctx), j)
+	s.mu.Lock()
+	if cancel, ok := s.cancels[j.ID]; ok {
+		cancel()
+		delete(s.cancels, j.ID)
+	}
+	done := time.Now()
+	j.FinishedAt = &done
+	switch {
+	case err != nil:
+		j.Status = StatusCanceled
+	case j.Progress.Failed > 0:
+		j.Status = StatusFailed
+	default:
+		j.Status = StatusSucceeded
+	}
+	snap := j.snapshot()
+	s.mu.Unlock()
+	s.finished(snap)
+}
+
+// deferToWindow retries op on devices outside their maintenance window once the window opens.
+// A deferred device keeps its worker while it waits.
+func deferToWindow(op Operation) Operation {
+	return func(ctx context.Context, id dm.DeviceID) error {
+		for {
+			err := op(ctx, id)
+			var outside *dm.MaintenanceWindowError
+			if !errors.As(err, &outside) || outside.Next.IsZero() {
+				return err
+			}
+			ReportDetail(ctx, "deferred until "+outside.Next.Format(time.RFC3339))
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(time.Until(outside.Next)):
+			}
+		}
+	}
+}
+
+// Get returns a job visible to the caller.
+func (s *Service) Get(ctx context.Context, id string) (Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	j, ok := s.jobs[id]
+	if !ok || !visible(ctx, j.Partners) {
+		return Job{}, ErrJobNotFound
+	}
+	return j.snapshot(), nil
+}
+
+// Cancel stops a job visible to the caller: devices not yet started are left out, and the
+// operations in flight see their context canceled. The job ends as StatusCanceled once they
+// return, or at once when it is awaiting approval; a job that has already finished is ErrConflict.
+func (s *Service) Cancel(ctx context.Context, id string) (Job, error) {
+	var ended *Job // a held job, which never runs to report itself
+	defer func() {
+		if ended != nil {
+			s.finished(*ended)
+		}
+	}()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok || !visible(ctx, j.Partners) {
+		return Job{}, ErrJobNotFound
+	}
+	cancel, ok := s.cancels[id]
+	if !ok {
+		return Job{}, fmt.Errorf("job %s already %s: %w", id, j.Status, dm.ErrConflict)
+	}
+	cancel()
+	delete(s.cancels, id)
+	if _, ok := s.held[id]; ok {
+		delete(s.held, id)
+		now := time.Now()
+		j.Status, j.FinishedAt = StatusCanceled, &now
+		snap := j.snapshot()
+		ended = &snap
+	}
+	return j.snapshot(), nil
+}
+
+// List returns the jobs visible to the caller, newest first, without per-device results and
+// artifacts.
+func (s *Service) List(ctx context.Context) []Job {
+	s.mu.RLock()
+	out := make([]Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		if visible(ctx, j.Partners) {
+			c := j.snapshot()
+			c.Results, c.Artifacts = nil, nil
+			out = append(out, c)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, k int) bool { return out[i].CreatedAt.After(out[k].CreatedAt) })
+	return out
+}
+
+// snapshot copies j; callers hold s.mu.
+func (j *Job) snapshot() Job {
+	c := *j
+	c.Results = append([]DeviceResult(nil), j.Results...)
+	c.Artifacts = append([]Artifact(nil), j.Artifacts...)
+	if j.Approval != nil {
+		a := *j.Approval
+		c.Approval = &a
+	}
+	return c
+}
+
+// visible reports whether the caller may see a job or plan submitted with the given partner scope.
+func visible(ctx context.Context, partners []string) bool {
+	scope, ok := dm.PartnersFromContext(ctx)
+	if !ok {
+		return true
+	}
+	return len(partners) > 0 && dm.PartnerAllowed(scope, partners)
+}
@@ -0,0 +1,204 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+var ErrTemplateNotFound = errors.New("job template not found")
+
+// Template is a saved, reusable job: its Spec gives the operation, parameters, pacing and target
+// selector. The spec's devices, parameter names and string values, service, soak and selector are
+// Go templates over the variables, e.g. {"name": "Device.WiFi.SSID.1.SSID", "value": "{{.ssid}}"};
+// Variables holds their defaults, and a variable without one must be supplied on every run.
+type Template struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Spec        Spec              `json:"spec"`
+	Variables   map[string]string `json:"variables,omitempty"`
+	Partners    []string          `json:"partners,omitempty"` // saver's partner scope; empty is unscoped
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+}
+
+// SaveTemplate validates t and stores it under its name, replacing an earlier one the caller can
+// see; a name taken by a template the caller cannot see is ErrConflict.
+func (s *Service) SaveTemplate(ctx context.Context, t Template) (Template, error) {
+	if t.Name == "" || strings.ContainsAny(t.Name, "/ ") {
+		return Template{}, fmt.Errorf("template name %q: %w", t.Name, dm.ErrInvalidParameter)
+	}
+	if _, ok := s.builders[t.Spec.Operation]; !ok {
+		return Template{}, fmt.Errorf("template %s: unknown operation %q: %w", t.Name, t.Spec.Operation, dm.ErrInvalidParameter)
+	}
+	if err := t.Spec.each(func(field, text string) error {
+		_, err := parseTemplate(field, text)
+		return err
+	}); err != nil {
+		return Template{}, fmt.Errorf("template %s: %v: %w", t.Name, err, dm.ErrInvalidParameter)
+	}
+	t.Partners = nil
+	if scope, ok := dm.PartnersFromContext(ctx); ok {
+		t.Partners = scope
+	}
+	now := time.Now()
+	t.CreatedAt, t.UpdatedAt = now, now
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.templates[t.Name]; ok {
+		if !visible(ctx, old.Partners) {
+			return Template{}, fmt.Errorf("template name %s is taken: %w", t.Name, dm.ErrConflict)
+		}
+		t.CreatedAt = old.CreatedAt
+	}
+	s.templates[t.Name] = t
+	return t, nil
+}
+
+// Template returns a template visible to the caller.
+func (s *Service) Template(ctx context.Context, name string) (Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.templates[name]
+	if !ok || !visible(ctx, t.Partners) {
+		return Template{}, ErrTemplateNotFound
+	}
+	return t, nil
+}
+
+// Templates returns the templates visible to the caller, by name.
+func (s *Service) Templates(ctx context.Context) []Template {
+	s.mu.RLock()
+	out := []Template{}
+	for _, t := range s.templates {
+		if visible(ctx, t.Partners) {
+			out = append(out, t)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, k int) bool { return out[i].Name < out[k].Name })
+	return out
+}
+
+// DeleteTemplate removes a template visible to the caller.
+func (s *Service) DeleteTemplate(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.templates[name]
+	if !ok || !visible(ctx, t.Partners) {
+		return ErrTemplateNotFound
+	}
+	delete(s.templates, name)
+	return nil
+}
+
+// RenderTemplate returns the spec of a run of the named template with vars over its defaults,
+// ready for Submit once its selector, if any, is resolved. A variable neither supplied nor
+// defaulted is ErrInvalidParameter.
+func (s *Service) RenderTemplate(ctx context.Context, name string, vars map[string]string) (Spec, error) {
+	t, err := s.Template(ctx, name)
+	if err != nil {
+		return Spec{}, err
+	}
+	data := make(map[string]string, len(t.Variables)+len(vars))
+	for k, v := range t.Variables {
+		data[k] = v
+	}
+	for k, v := range vars {
+		data[k] = v
+	}
+	spec := t.Spec
+	spec.Devices = append([]dm.DeviceID(nil), t.Spec.Devices...)
+	spec.Parameters = append([]Param(nil), t.Spec.Parameters...)
+	if err := spec.render(data); err != nil {
+		return Spec{}, fmt.Errorf("template %s: %v: %w", name, err, dm.ErrInvalidParameter)
+	}
+	spec.Template = name
+	return spec, nil
+}
+
+// each calls fn with every templated field of spec and its text.
+func (spec *Spec) each(fn func(field, text string) error) error {
+	return spec.walk(func(field string, text *string) error { return fn(field, *text) })
+}
+
+// render executes every templated field of spec over data in place.
+func (spec *Spec) render(data map[string]string) error {
+	return spec.walk(func(field string, text *string) error {
+		t, err := parseTemplate(field, *text)
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, data); err != nil {
+			return err
+		}
+		*text = b.String()
+		return nil
+	})
+}
+
+func (spec *Spec) walk(fn func(field string, text *string) error) error {
+	for i := range spec.Devices {
+		id := string(spec.Devices[i])
+		if err := fn(fmt.Sprintf("devices[%d]", i), &id); err != nil {
+			return err
+		}
+		spec.Devices[i] = dm.DeviceID(id)
+	}
+	for i := range spec.Parameters {
+		p := &spec.Parameters[i]
+		if err := fn(fmt.Sprintf("parameters[%d].name", i), &p.Name); err != nil {
+			return err
+		}
+		if v, ok := p.Value.(string); ok {
+			if err := fn(fmt.Sprintf("parameters[%d].value", i), &v); err != nil {
+				return err
+			}
+			p.Value = v
+		}
+	}
+	for field, text := range map[string]*string{"service": &spec.Service, "soak": &spec.Soak, "selector": &spec.Selector} {
+		if err := fn(field, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseTemplate(field, text string) (*template.Template, error) {
+	return template.New(field).Option("missingkey=error").Parse(text)
+}
+
+// Rerun submits a finished job again on just the devices that failed, with the caller's
+// permissions. A job still running or awaiting approval, or without failed devices, is
+// ErrConflict; apply-plan jobs cannot be rerun since their plan is spent.
+func (s *Service) Rerun(ctx context.Context, id string) (Job, error) {
+	prev, err := s.Get(ctx, id)
+	if err != nil {
+		return Job{}, err
+	}
+	switch {
+	case prev.FinishedAt == nil:
+		return Job{}, fmt.Errorf("job %s is %s, not finished: %w", id, prev.Status, dm.ErrConflict)
+	case prev.Spec.Operation == OperationApplyPlan:
+		return Job{}, fmt.Errorf("job %s applied plan %s, which cannot be applied again: %w", id, prev.Spec.Plan, dm.ErrConflict)
+	}
+	spec := prev.Spec
+	spec.Devices, spec.Selector, spec.RerunOf = nil, "", id
+	for _, r := range prev.Results {
+		if !r.OK {
+			spec.Devices = append(spec.Devices, r.Device)
+		}
+	}
+	if len(spec.Devices) == 0 {
+		return Job{}, fmt.Errorf("job %s has no failed devices: %w", id, dm.ErrConflict)
+	}
+	return s.Submit(ctx, spec)
+}
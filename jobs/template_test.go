@@ -0,0 +1,118 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func waitFinished(t *testing.T, svc *Service, ctx context.Context, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		j, err := svc.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.FinishedAt != nil {
+			return j
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish: %+v", j)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServiceTemplates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc := NewService(ctx, map[string]Builder{OperationSet: func(Spec) (Operation, error) {
+		return func(context.Context, dm.DeviceID) error { return nil }, nil
+	}})
+	tmpl := Template{
+		Name:      "ssid",
+		Spec:      Spec{Operation: OperationSet, Parameters: []Param{{Name: "Device.WiFi.SSID.{{.index}}.SSID", Value: "{{.ssid}}"}, {Name: "Device.X", Value: 1.0}}, Selector: `model == "{{.model}}"`, Rate: 60},
+		Variables: map[string]string{"index": "1"},
+	}
+	if _, err := svc.SaveTemplate(ctx, Template{Name: "bad name", Spec: tmpl.Spec}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("expected invalid name, got %v", err)
+	}
+	if _, err := svc.SaveTemplate(ctx, Template{Name: "broken", Spec: Spec{Operation: OperationSet, Selector: "{{.x"}}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("expected unparsable template, got %v", err)
+	}
+	sky := dm.WithPartners(ctx, []string{"sky"})
+	if _, err := svc.SaveTemplate(sky, tmpl); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SaveTemplate(dm.WithPartners(ctx, []string{"comcast"}), tmpl); !errors.Is(err, dm.ErrConflict) {
+		t.Fatalf("another partner's template name should conflict, got %v", err)
+	}
+	if _, err := svc.RenderTemplate(sky, "ssid", nil); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("missing variables should be invalid, got %v", err)
+	}
+	spec, err := svc.RenderTemplate(sky, "ssid", map[string]string{"ssid": "lab", "model": "XB7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Parameters[0].Name != "Device.WiFi.SSID.1.SSID" || spec.Parameters[0].Value != "lab" || spec.Parameters[1].Value != 1.0 || spec.Selector != `model == "XB7"` || spec.Rate != 60 || spec.Template != "ssid" {
+		t.Fatalf("rendered %+v", spec)
+	}
+	if saved, _ := svc.Template(sky, "ssid"); saved.Spec.Parameters[0].Value != "{{.ssid}}" {
+		t.Fatalf("rendering changed the saved template: %+v", saved)
+	}
+	if got := svc.Templates(dm.WithPartners(ctx, []string{"comcast"})); len(got) != 0 {
+		t.Fatalf("other partner sees %+v", got)
+	}
+	if err := svc.DeleteTemplate(sky, "ssid"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Template(sky, "ssid"); !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("expected deleted, got %v", err)
+	}
+}
+
+func TestServiceRerunFailedDevices(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	release := make(chan struct{})
+	svc := NewService(ctx, map[string]Builder{"flaky": func(Spec) (Operation, error) {
+		return func(ctx context.Context, id dm.DeviceID) error {
+			<-release
+			if id == "mac:2" || id == "mac:3" {
+				return errors.New("unreachable")
+			}
+			return nil
+		}, nil
+	}})
+	j, err := svc.Submit(ctx, Spec{Operation: "flaky", Devices: []dm.DeviceID{"mac:1", "mac:2", "mac:3"}, Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Rerun(ctx, j.ID); !errors.Is(err, dm.ErrConflict) {
+		t.Fatalf("running job should not rerun, got %v", err)
+	}
+	close(release)
+	waitFinished(t, svc, ctx, j.ID)
+	again, err := svc.Rerun(ctx, j.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Spec.RerunOf != j.ID || len(again.Spec.Devices) != 2 || again.Spec.Devices[0] == "mac:1" || again.Spec.Devices[1] == "mac:1" {
+		t.Fatalf("rerun %+v", again.Spec)
+	}
+	if _, err := svc.Rerun(ctx, "missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	ok, err := svc.Submit(ctx, Spec{Operation: "flaky", Devices: []dm.DeviceID{"mac:1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFinished(t, svc, ctx, ok.ID)
+	if _, err := svc.Rerun(ctx, ok.ID); !errors.Is(err, dm.ErrConflict) {
+		t.Fatalf("job without failures should not rerun, got %v", err)
+	}
+}
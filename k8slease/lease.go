@@ -0,0 +1,249 @@
+package k8slease
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// In-cluster service account files mounted into every pod.
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	microTime         = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// Config configures a Lease elector. Empty fields are resolved from the in-cluster environment.
+type Config struct {
+	Name          string        // required; Lease object name
+	Namespace     string        // optional; defaults to the pod's service account namespace
+	Identity      string        // optional; defaults to the hostname (pod name)
+	LeaseDuration time.Duration // optional; default 45s
+	APIServer     string        // optional; defaults to https://$KUBERNETES_SERVICE_HOST:$KUBERNETES_SERVICE_PORT
+	TokenFile     string        // optional; service account token, re-read on every request (bound tokens rotate)
+	Client        *http.Client  // optional; defaults to a client trusting the service account CA
+}
+
+// Elector implements devicemgr.Elector on a coordination.k8s.io/v1 Lease, following the
+// client-go leaderelection protocol: the holder renews spec.renewTime and other candidates
+// take over (optimistically, via resourceVersion) once the lease has not been renewed for
+// leaseDurationSeconds.
+type Elector struct {
+	cfg Config
+	url string
+	now func() time.Time
+}
+
+var _ dm.Elector = (*Elector)(nil)
+
+type lease struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Metadata   leaseMeta `json:"metadata"`
+	Spec       leaseSpec `json:"spec"`
+}
+
+type leaseMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// New validates cfg and fills defaults from the pod environment.
+func New(cfg Config) (*Elector, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("k8slease: lease name required")
+	}
+	if cfg.Namespace == "" {
+		b, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("k8slease: namespace: %w", err)
+		}
+		cfg.Namespace = strings.TrimSpace(string(b))
+	}
+	if cfg.Identity == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("k8slease: identity: %w", err)
+		}
+		cfg.Identity = host
+	}
+	if cfg.LeaseDuration <= 0 {
+		cfg.LeaseDuration = 45 * time.Second
+	}
+	if cfg.APIServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("k8slease: not running in a cluster and no APIServer configured")
+		}
+		cfg.APIServer = "https://" + net.JoinHostPort(host, port)
+	}
+	if cfg.TokenFile == "" {
+		cfg.TokenFile = serviceAccountDir + "/token"
+	}
+	if cfg.Client == nil {
+		client, err := inClusterClient()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Client = client
+	}
+	url := fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", strings.TrimRight(cfg.APIServer, "/"), cfg.Namespace)
+	return &Elector{cfg: cfg, url: url, now: time.Now}, nil
+}
+
+func inClusterClient() (*http.Client, error) {
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("k8slease: service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("k8slease: service account CA contains no certificates")
+	}
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}},
+	}, nil
+}
+
+// Campaign creates the Lease, renews it, or takes it over once expired; it reports whether
+// this identity holds the Lease afterwards. Losing an optimistic-concurrency race is not an error.
+func (e *Elector) Campaign(ctx context.Context) (bool, error) {
+	now := e.now()
+	cur, status, err := e.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	stamp := now.UTC().Format(microTime)
+	if status == http.StatusNotFound {
+		l := lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   leaseMeta{Name: e.cfg.Name, Namespace: e.cfg.Namespace},
+			Spec:       e.spec(stamp, stamp, 0),
+		}
+		return e.write(ctx, http.MethodPost, e.url, l)
+	}
+	held := cur.Spec.HolderIdentity == e.cfg.Identity
+	if !held && cur.Spec.HolderIdentity != "" && !e.expired(cur.Spec, now) {
+		return false, nil
+	}
+	next := *cur
+	if held {
+		next.Spec = e.spec(cur.Spec.AcquireTime, stamp, cur.Spec.LeaseTransitions)
+	} else {
+		next.Spec = e.spec(stamp, stamp, cur.Spec.LeaseTransitions+1)
+	}
+	return e.write(ctx, http.MethodPut, e.url+"/"+e.cfg.Name, next)
+}
+
+// Resign clears the holder so another replica can take over without waiting for expiry.
+func (e *Elector) Resign(ctx context.Context) error {
+	cur, status, err := e.get(ctx)
+	if err != nil || status == http.StatusNotFound || cur.Spec.HolderIdentity != e.cfg.Identity {
+		return err
+	}
+	next := *cur
+	next.Spec.HolderIdentity = ""
+	next.Spec.LeaseDurationSeconds = 1
+	next.Spec.RenewTime = e.now().UTC().Format(microTime)
+	_, err = e.write(ctx, http.MethodPut, e.url+"/"+e.cfg.Name, next)
+	return err
+}
+
+func (e *Elector) spec(acquired, renewed string, transitions int) leaseSpec {
+	return leaseSpec{
+		HolderIdentity:       e.cfg.Identity,
+		LeaseDurationSeconds: int(e.cfg.LeaseDuration / time.Second),
+		AcquireTime:          acquired,
+		RenewTime:            renewed,
+		LeaseTransitions:     transitions,
+	}
+}
+
+func (e *Elector) expired(s leaseSpec, now time.Time) bool {
+	renewed, err := time.Parse(time.RFC3339Nano, s.RenewTime)
+	if err != nil {
+		return true
+	}
+	return now.After(renewed.Add(time.Duration(s.LeaseDurationSeconds) * time.Second))
+}
+
+func (e *Elector) get(ctx context.Context) (*lease, int, error) {
+	resp, err := e.do(ctx, http.MethodGet, e.url+"/"+e.cfg.Name, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var l lease
+		if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+			return nil, 0, fmt.Errorf("k8slease: decode lease: %w", err)
+		}
+		return &l, resp.StatusCode, nil
+	case http.StatusNotFound:
+		return nil, resp.StatusCode, nil
+	}
+	return nil, 0, statusError(resp)
+}
+
+// write creates or updates the Lease; a 409 means another candidate won the race.
+func (e *Elector) write(ctx context.Context, method, url string, l lease) (bool, error) {
+	body, err := json.Marshal(l)
+	if err != nil {
+		return false, err
+	}
+	resp, err := e.do(ctx, method, url, body)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return true, nil
+	case http.StatusConflict:
+		return false, nil
+	}
+	return false, statusError(resp)
+}
+
+func (e *Elector) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token, err := os.ReadFile(e.cfg.TokenFile); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	return e.cfg.Client.Do(req)
+}
+
+func statusError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("k8slease: api server returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
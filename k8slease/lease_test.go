@@ -0,0 +1,111 @@
+package k8slease
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLeaseAPI stores a single Lease and enforces resourceVersion on updates like the API server.
+type fakeLeaseAPI struct {
+	mu      sync.Mutex
+	lease   *lease
+	version int
+}
+
+func (f *fakeLeaseAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		if f.lease == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(f.lease)
+	case http.MethodPost, http.MethodPut:
+		var l lease
+		json.NewDecoder(r.Body).Decode(&l)
+		if r.Method == http.MethodPost && f.lease != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if r.Method == http.MethodPut && (f.lease == nil || l.Metadata.ResourceVersion != f.lease.Metadata.ResourceVersion) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.version++
+		l.Metadata.ResourceVersion = strconv.Itoa(f.version)
+		f.lease = &l
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(l)
+	}
+}
+
+func newTestElector(t *testing.T, srv *httptest.Server, identity string, now *time.Time) *Elector {
+	t.Helper()
+	e, err := New(Config{Name: "poll", Namespace: "ns", Identity: identity, LeaseDuration: 10 * time.Second, APIServer: srv.URL, TokenFile: "/nonexistent", Client: srv.Client()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	e.now = func() time.Time { return *now }
+	return e
+}
+
+func TestLeaseElection(t *testing.T) {
+	api := &fakeLeaseAPI{}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := newTestElector(t, srv, "a", &now)
+	b := newTestElector(t, srv, "b", &now)
+	ctx := context.Background()
+
+	if ok, err := a.Campaign(ctx); err != nil || !ok {
+		t.Fatalf("a should create and hold the lease: %v %v", ok, err)
+	}
+	if ok, err := b.Campaign(ctx); err != nil || ok {
+		t.Fatalf("b should not lead while a's lease is fresh: %v %v", ok, err)
+	}
+	now = now.Add(5 * time.Second)
+	if ok, _ := a.Campaign(ctx); !ok {
+		t.Fatal("a should renew")
+	}
+	now = now.Add(11 * time.Second)
+	if ok, err := b.Campaign(ctx); err != nil || !ok {
+		t.Fatalf("b should take over the expired lease: %v %v", ok, err)
+	}
+	if api.lease.Spec.HolderIdentity != "b" || api.lease.Spec.LeaseTransitions != 1 {
+		t.Fatalf("unexpected lease after takeover: %+v", api.lease.Spec)
+	}
+	if ok, _ := a.Campaign(ctx); ok {
+		t.Fatal("a should have lost leadership")
+	}
+	if err := b.Resign(ctx); err != nil {
+		t.Fatalf("Resign: %v", err)
+	}
+	if ok, _ := a.Campaign(ctx); !ok {
+		t.Fatal("a should acquire a resigned lease immediately")
+	}
+}
+
+func TestLeaseConflictIsNotLeader(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer srv.Close()
+	now := time.Now()
+	e := newTestElector(t, srv, "a", &now)
+	if ok, err := e.Campaign(context.Background()); ok || err != nil {
+		t.Fatalf("lost create race should report follower without error: %v %v", ok, err)
+	}
+}
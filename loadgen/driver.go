@@ -0,0 +1,191 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// Operations Drive mixes.
+const (
+	OpGet  = "get"
+	OpSet  = "set"
+	OpCall = "call"
+)
+
+// Target is what Drive exercises; *manager.Manager implements it.
+type Target interface {
+	GetParameters(ctx context.Context, id dm.DeviceID, service string, names []string) (map[string]dm.ParameterValue, error)
+	SetParameters(ctx context.Context, id dm.DeviceID, service string, params []dm.SetParameter, opts dm.SetOptions) (*runtime.SetResult, error)
+	Call(ctx context.Context, id dm.DeviceID, service string, call runtime.BlizzardCall) (*runtime.BlizzardResult, error)
+}
+
+// DriveConfig paces Drive. Mix weighs the operations, e.g. {"get": 8, "set": 1, "call": 1}; empty
+// only reads.
+type DriveConfig struct {
+	Rate     float64 // operations per second across all workers; 0 runs as fast as the workers can
+	Workers  int     // concurrent operations (8)
+	Duration time.Duration
+	Mix      map[string]int
+	Timeout  time.Duration // per operation (10s)
+}
+
+// Report summarizes a Drive run.
+type Report struct {
+	Duration   string              `json:"duration"`
+	Operations int                 `json:"operations"`
+	Errors     int                 `json:"errors"`
+	Throughput float64             `json:"throughput"` // operations per second
+	ByOp       map[string]OpReport `json:"byOp"`
+}
+
+// OpReport summarizes one operation's latencies, in milliseconds.
+type OpReport struct {
+	Count  int     `json:"count"`
+	Errors int     `json:"errors"`
+	P50    float64 `json:"p50"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+	Max    float64 `json:"max"`
+}
+
+type sample struct {
+	op      string
+	latency time.Duration
+	err     error
+}
+
+// Drive issues operations against t on the fleet's connected devices for cfg.Duration, or until
+// ctx is done, and reports their outcomes. Devices that disconnect while being operated on count
+// as errors, as they would in production.
+func Drive(ctx context.Context, t Target, f *Fleet, cfg DriveConfig) (Report, error) {
+	if cfg.Duration <= 0 {
+		return Report{}, fmt.Errorf("drive duration required: %w", dm.ErrInvalidParameter)
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 8
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	var ops []string // one entry per weight unit
+	for _, op := range []string{OpGet, OpSet, OpCall} {
+		for i := 0; i < cfg.Mix[op]; i++ {
+			ops = append(ops, op)
+		}
+	}
+	for op := range cfg.Mix {
+		if op != OpGet && op != OpSet && op != OpCall {
+			return Report{}, fmt.Errorf("unknown operation %q: %w", op, dm.ErrInvalidParameter)
+		}
+	}
+	if len(ops) == 0 {
+		ops = []string{OpGet}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+	start := time.Now()
+	tokens := make(chan struct{})
+	go func() {
+		defer close(tokens)
+		var tick <-chan time.Time
+		if cfg.Rate > 0 {
+			t := time.NewTicker(time.Duration(float64(time.Second) / cfg.Rate))
+			defer t.Stop()
+			tick = t.C
+		}
+		for {
+			if tick != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-tick:
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case tokens <- struct{}{}:
+			}
+		}
+	}()
+
+	var (
+		mu      sync.Mutex
+		samples []sample
+		wg      sync.WaitGroup
+	)
+	for w := 0; w < cfg.Workers; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for range tokens {
+				id := f.pick(rng)
+				if id == "" {
+					continue
+				}
+				op := ops[rng.Intn(len(ops))]
+				opCtx, opCancel := context.WithTimeout(context.WithoutCancel(ctx), cfg.Timeout)
+				began := time.Now()
+				err := do(opCtx, t, op, id, rng)
+				opCancel()
+				mu.Lock()
+				samples = append(samples, sample{op: op, latency: time.Since(began), err: err})
+				mu.Unlock()
+			}
+		}(f.cfg.Seed + int64(w))
+	}
+	wg.Wait()
+	return report(samples, time.Since(start)), nil
+}
+
+func do(ctx context.Context, t Target, op string, id dm.DeviceID, rng *rand.Rand) error {
+	switch op {
+	case OpSet:
+		_, err := t.SetParameters(ctx, id, "", []dm.SetParameter{{Name: "Device.WiFi.SSID.1.SSID", Value: fmt.Sprintf("loadgen-%d", rng.Intn(1000))}}, dm.SetOptions{})
+		return err
+	case OpCall:
+		res, err := t.Call(ctx, id, "", runtime.BlizzardCall{Method: "loadgen.ping", Params: map[string]int{"n": rng.Intn(1000)}})
+		if err == nil && res.Error != nil {
+			err = fmt.Errorf("rpc error %d: %s", res.Error.Code, res.Error.Message)
+		}
+		return err
+	}
+	_, err := t.GetParameters(ctx, id, "", []string{"Device.DeviceInfo.SoftwareVersion", "Device.WiFi.SSID.1.SSID"})
+	return err
+}
+
+func report(samples []sample, elapsed time.Duration) Report {
+	r := Report{Duration: elapsed.Round(time.Millisecond).String(), Operations: len(samples), ByOp: make(map[string]OpReport)}
+	if elapsed > 0 {
+		r.Throughput = float64(len(samples)) / elapsed.Seconds()
+	}
+	latencies := make(map[string][]time.Duration)
+	for _, s := range samples {
+		o := r.ByOp[s.op]
+		o.Count++
+		if s.err != nil {
+			o.Errors++
+			r.Errors++
+		}
+		r.ByOp[s.op] = o
+		latencies[s.op] = append(latencies[s.op], s.latency)
+	}
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	for op, l := range latencies {
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+		at := func(q float64) time.Duration { return l[int(q*float64(len(l)-1))] }
+		o := r.ByOp[op]
+		o.P50, o.P95, o.P99, o.Max = ms(at(0.5)), ms(at(0.95)), ms(at(0.99)), ms(l[len(l)-1])
+		r.ByOp[op] = o
+	}
+	return r
+}
@@ -0,0 +1,398 @@
+// Package loadgen simulates a fleet of devices behind Talaria, Tr1d1um and Blizzard, so the whole
+// devicemgr pipeline (polling, connectivity events, WDMP reads and writes, JSON-RPC calls) can be
+// driven locally for capacity planning and soak tests without hardware. A Fleet serves the three
+// backends from one http.Handler; Drive issues operations against it through a Manager.
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Defaults for the Config fields left zero.
+const (
+	DefaultDevices    = 1000
+	DefaultOnline     = 0.9
+	DefaultChurnEvery = 10 * time.Second
+)
+
+// Backend paths served by Fleet.Handler below its base URL: point Options.TalariaBaseURL at the
+// base URL, Tr1d1umBaseURL at Tr1d1umPath and BlizzardBaseURL at BlizzardPath (as ws://).
+const (
+	Tr1d1umPath  = "/api/v3"
+	BlizzardPath = "/blizzard"
+)
+
+// Config parameterizes a simulated fleet. Rates are fractions from 0 to 1.
+type Config struct {
+	Devices    int           // fleet size (DefaultDevices)
+	Online     float64       // fraction of devices connected at start and, on average, later (DefaultOnline)
+	Churn      float64       // fraction of devices considered for a connection change every ChurnEvery; 0 keeps the fleet still
+	ChurnEvery time.Duration // (DefaultChurnEvery)
+	Latency    time.Duration // added to every WDMP and JSON-RPC answer
+	Jitter     time.Duration // random extra latency, up to
+	ErrorRate  float64       // WDMP requests answered 500 and calls answered with a JSON-RPC error
+	Partners   []string      // assigned to devices round-robin
+	Models     []string      // assigned to devices round-robin ("XB7")
+	Seed       int64         // 0 seeds from the clock
+}
+
+// Counters reports what a Fleet has served.
+type Counters struct {
+	DeviceLists uint64 `json:"deviceLists"`
+	Stats       uint64 `json:"stats"`
+	Gets        uint64 `json:"gets"`
+	Sets        uint64 `json:"sets"`
+	Calls       uint64 `json:"calls"`
+	Errors      uint64 `json:"errors"` // injected by ErrorRate
+	Connects    uint64 `json:"connects"`
+	Disconnects uint64 `json:"disconnects"`
+	Online      int    `json:"online"`
+}
+
+// Fleet is a simulated device fleet.
+type Fleet struct {
+	cfg      Config
+	upgrader websocket.Upgrader
+
+	mu      sync.Mutex
+	rng     *rand.Rand
+	devices []*device
+	byID    map[string]*device
+
+	deviceLists, stats, gets, sets, calls, errors, connects, disconnects atomic.Uint64
+}
+
+type device struct {
+	id, partner, model string
+	online             bool
+	connectedAt        time.Time
+	params             map[string]interface{}
+	conns              map[*websocket.Conn]bool // Blizzard connections, closed on disconnect
+}
+
+// New builds a fleet of cfg.Devices, cfg.Online of them connected.
+func New(cfg Config) *Fleet {
+	if cfg.Devices <= 0 {
+		cfg.Devices = DefaultDevices
+	}
+	if cfg.Online <= 0 || cfg.Online > 1 {
+		cfg.Online = DefaultOnline
+	}
+	if cfg.ChurnEvery <= 0 {
+		cfg.ChurnEvery = DefaultChurnEvery
+	}
+	if len(cfg.Models) == 0 {
+		cfg.Models = []string{"XB7"}
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	f := &Fleet{cfg: cfg, rng: rand.New(rand.NewSource(cfg.Seed)), byID: make(map[string]*device, cfg.Devices)}
+	now := time.Now()
+	for i := 0; i < cfg.Devices; i++ {
+		d := &device{id: fmt.Sprintf("mac:%012x", 0x5a1000000000+i), model: cfg.Models[i%len(cfg.Models)], conns: make(map[*websocket.Conn]bool)}
+		if len(cfg.Partners) > 0 {
+			d.partner = cfg.Partners[i%len(cfg.Partners)]
+		}
+		d.params = map[string]interface{}{
+			"Device.DeviceInfo.ModelName":       d.model,
+			"Device.DeviceInfo.SerialNumber":    strings.ToUpper(strings.TrimPrefix(d.id, "mac:")),
+			"Device.DeviceInfo.SoftwareVersion": d.model + "_loadgen",
+			"Device.WiFi.SSID.1.SSID":           "loadgen",
+			"Device.WiFi.SSID.1.Enable":         true,
+		}
+		if f.rng.Float64() < cfg.Online {
+			d.online, d.connectedAt = true, now
+		}
+		f.devices = append(f.devices, d)
+		f.byID[d.id] = d
+	}
+	return f
+}
+
+// Online returns the IDs of the connected devices, sorted.
+func (f *Fleet) Online() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []string
+	for _, d := range f.devices {
+		if d.online {
+			ids = append(ids, d.id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// pick returns a random connected device, or "" when a few tries find none.
+func (f *Fleet) pick(rng *rand.Rand) dm.DeviceID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := 0; i < 64; i++ {
+		if d := f.devices[rng.Intn(len(f.devices))]; d.online {
+			return dm.DeviceID(d.id)
+		}
+	}
+	return ""
+}
+
+// Counters reports the requests served and connection changes so far.
+func (f *Fleet) Counters() Counters {
+	return Counters{
+		DeviceLists: f.deviceLists.Load(), Stats: f.stats.Load(), Gets: f.gets.Load(), Sets: f.sets.Load(),
+		Calls: f.calls.Load(), Errors: f.errors.Load(), Connects: f.connects.Load(), Disconnects: f.disconnects.Load(),
+		Online: len(f.Online()),
+	}
+}
+
+// Churn applies one round of connection changes: Churn of the devices are picked at random, and a
+// connected one disconnects with probability 1-Online while a disconnected one connects with
+// probability Online, keeping the connected fraction near Online.
+func (f *Fleet) Churn() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	for n := int(f.cfg.Churn * float64(len(f.devices))); n > 0; n-- {
+		d := f.devices[f.rng.Intn(len(f.devices))]
+		switch {
+		case d.online && f.rng.Float64() >= f.cfg.Online:
+			d.online = false
+			f.disconnects.Add(1)
+			for c := range d.conns {
+				c.Close()
+				delete(d.conns, c)
+			}
+		case !d.online && f.rng.Float64() < f.cfg.Online:
+			d.online, d.connectedAt = true, now
+			f.connects.Add(1)
+		}
+	}
+}
+
+// Run churns the fleet every ChurnEvery until done is closed.
+func (f *Fleet) Run(done <-chan struct{}) {
+	if f.cfg.Churn <= 0 {
+		<-done
+		return
+	}
+	t := time.NewTicker(f.cfg.ChurnEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			f.Churn()
+		}
+	}
+}
+
+// Handler serves Talaria's device list and stat endpoints, Tr1d1um's WDMP endpoint below
+// Tr1d1umPath and Blizzard's websocket below BlizzardPath.
+func (f *Fleet) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v2/devices", f.serveDevices)
+	mux.HandleFunc("GET /api/v2/device/{id}/stat", f.serveStat)
+	mux.HandleFunc("GET "+Tr1d1umPath+"/device/{id}/{service}", f.serveGet)
+	mux.HandleFunc("PATCH "+Tr1d1umPath+"/device/{id}/{service}", f.serveSet)
+	mux.HandleFunc("GET "+BlizzardPath+"/{id}/{service}", f.serveBlizzard)
+	return mux
+}
+
+func (f *Fleet) serveDevices(w http.ResponseWriter, _ *http.Request) {
+	f.deviceLists.Add(1)
+	f.mu.Lock()
+	list := make([]map[string]interface{}, 0, len(f.devices))
+	for _, d := range f.devices {
+		if !d.online {
+			continue
+		}
+		obj := map[string]interface{}{"id": d.id, "hw-model": d.model, "fw-name": d.params["Device.DeviceInfo.SoftwareVersion"]}
+		if d.partner != "" {
+			obj["partnerIDs"] = []string{d.partner}
+		}
+		list = append(list, obj)
+	}
+	f.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"devices": list})
+}
+
+func (f *Fleet) serveStat(w http.ResponseWriter, r *http.Request) {
+	f.stats.Add(1)
+	f.mu.Lock()
+	d := f.byID[r.PathValue("id")]
+	var connectedAt time.Time
+	online := d != nil && d.online
+	if online {
+		connectedAt = d.connectedAt
+	}
+	f.mu.Unlock()
+	if !online {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": d.id, "pending": 0, "statistics": map[string]interface{}{
+		"connectedAt": connectedAt, "upTime": time.Since(connectedAt).Round(time.Second).String(),
+	}})
+}
+
+// connected returns the device if it is online, answering 404 for it otherwise.
+func (f *Fleet) connected(w http.ResponseWriter, r *http.Request) *device {
+	f.mu.Lock()
+	d := f.byID[r.PathValue("id")]
+	online := d != nil && d.online
+	f.mu.Unlock()
+	if !online {
+		http.NotFound(w, r)
+		return nil
+	}
+	return d
+}
+
+// answer waits out the configured latency and reports whether the answer should fail.
+func (f *Fleet) answer() (fail bool) {
+	f.mu.Lock()
+	delay := f.cfg.Latency
+	if f.cfg.Jitter > 0 {
+		delay += time.Duration(f.rng.Int63n(int64(f.cfg.Jitter)))
+	}
+	fail = f.rng.Float64() < f.cfg.ErrorRate
+	f.mu.Unlock()
+	time.Sleep(delay)
+	if fail {
+		f.errors.Add(1)
+	}
+	return fail
+}
+
+// serveGet answers a WDMP GET of the comma-separated names; a name ending in "." selects every
+// parameter below it, and unknown names are left out.
+func (f *Fleet) serveGet(w http.ResponseWriter, r *http.Request) {
+	f.gets.Add(1)
+	d := f.connected(w, r)
+	if d == nil {
+		return
+	}
+	if f.answer() {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"statusCode": 520, "message": "loadgen: injected error"})
+		return
+	}
+	ms := time.Now().UnixMilli()
+	params := make(map[string]interface{})
+	f.mu.Lock()
+	for _, name := range strings.Split(r.URL.Query().Get("names"), ",") {
+		for k, v := range d.params {
+			if k == name || strings.HasSuffix(name, ".") && strings.HasPrefix(k, name) {
+				params[k] = map[string]interface{}{"value": v, "timestamp": ms}
+			}
+		}
+	}
+	f.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"statusCode": 200, "parameters": params})
+}
+
+// serveSet applies a WDMP SET to the device's parameters.
+func (f *Fleet) serveSet(w http.ResponseWriter, r *http.Request) {
+	f.sets.Add(1)
+	d := f.connected(w, r)
+	if d == nil {
+		return
+	}
+	var req struct {
+		Command    string `json:"command"`
+		Parameters []struct {
+			Name  string      `json:"name"`
+			Value interface{} `json:"value"`
+		} `json:"parameters"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"statusCode": 400, "message": err.Error()})
+		return
+	}
+	if f.answer() {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"statusCode": 520, "message": "loadgen: injected error"})
+		return
+	}
+	applied := make(map[string]interface{}, len(req.Parameters))
+	f.mu.Lock()
+	for _, p := range req.Parameters {
+		if req.Command == "SET" {
+			d.params[p.Name] = p.Value
+		}
+		applied[p.Name] = "success"
+	}
+	f.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"statusCode": 200, "parameters": applied})
+}
+
+// serveBlizzard upgrades to a JSON-RPC websocket on which every call succeeds with its method and
+// params echoed, unless failed by ErrorRate. The connection closes when the device disconnects.
+func (f *Fleet) serveBlizzard(w http.ResponseWriter, r *http.Request) {
+	d := f.connected(w, r)
+	if d == nil {
+		return
+	}
+	c, err := f.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	f.mu.Lock()
+	if !d.online {
+		f.mu.Unlock()
+		c.Close()
+		return
+	}
+	d.conns[c] = true
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(d.conns, c)
+		f.mu.Unlock()
+		c.Close()
+	}()
+	var writeMu sync.Mutex
+	for {
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if json.Unmarshal(msg, &req) != nil || len(req.ID) == 0 {
+			continue // notifications, such as cancellations, get no answer
+		}
+		f.calls.Add(1)
+		go func() {
+			resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+			if f.answer() {
+				resp["error"] = map[string]interface{}{"code": -32000, "message": "loadgen: injected error"}
+			} else {
+				resp["result"] = map[string]interface{}{"method": req.Method, "params": req.Params}
+			}
+			b, _ := json.Marshal(resp)
+			writeMu.Lock()
+			_ = c.WriteMessage(websocket.TextMessage, b)
+			writeMu.Unlock()
+		}()
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,78 @@
+package loadgen
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+func TestFleetChurnKeepsOnlineFraction(t *testing.T) {
+	f := New(Config{Devices: 2000, Online: 0.8, Churn: 0.2, Seed: 1})
+	for i := 0; i < 50; i++ {
+		f.Churn()
+	}
+	c := f.Counters()
+	if c.Connects == 0 || c.Disconnects == 0 {
+		t.Fatalf("no churn %+v", c)
+	}
+	if frac := float64(c.Online) / 2000; frac < 0.75 || frac > 0.85 {
+		t.Fatalf("online fraction %.2f drifted from 0.8", frac)
+	}
+}
+
+func TestDriveThroughManager(t *testing.T) {
+	f := New(Config{Devices: 50, Online: 0.6, Partners: []string{"sky", "comcast"}, Seed: 7})
+	srv := httptest.NewServer(f.Handler())
+	defer srv.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = srv.URL
+	opts.Tr1d1umBaseURL = srv.URL + Tr1d1umPath
+	opts.BlizzardBaseURL = "ws://" + strings.TrimPrefix(srv.URL, "http://") + BlizzardPath
+	m, err := manager.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	ctx := context.Background()
+	ids, err := m.Poll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != len(f.Online()) {
+		t.Fatalf("polled %d devices, fleet has %d online", len(ids), len(f.Online()))
+	}
+	if sky := m.Stats(dm.WithPartners(ctx, []string{"sky"})); sky.Devices == 0 || sky.Devices == len(ids) {
+		t.Fatalf("sky sees %d of %d devices", sky.Devices, len(ids))
+	}
+
+	rep, err := Drive(ctx, m, f, DriveConfig{Workers: 4, Duration: 300 * time.Millisecond, Mix: map[string]int{OpGet: 1, OpSet: 1, OpCall: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Errors != 0 || len(rep.ByOp) != 3 {
+		t.Fatalf("report %+v", rep)
+	}
+	if c := f.Counters(); c.Sets == 0 || c.Calls == 0 || c.Gets == 0 {
+		t.Fatalf("fleet counters %+v", c)
+	}
+	// a write is visible to later reads
+	id := dm.DeviceID(f.Online()[0])
+	if _, err := m.SetParameters(ctx, id, "", []dm.SetParameter{{Name: "Device.WiFi.SSID.1.SSID", Value: "soak"}}, dm.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	got := f.byID[string(id)].params["Device.WiFi.SSID.1.SSID"]
+	f.mu.Unlock()
+	if got != "soak" {
+		t.Fatalf("SSID %v after SET", got)
+	}
+
+	if _, err := Drive(ctx, m, f, DriveConfig{Duration: time.Millisecond, Mix: map[string]int{"reboot": 1}}); err == nil {
+		t.Fatal("unknown operation accepted")
+	}
+}
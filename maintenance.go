@@ -0,0 +1,177 @@
+package devicemgr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindow is a recurring period during which disruptive operations (reboot, factory
+// reset, firmware updates) may run. It opens at Start on each of Days and stays open for Duration,
+// possibly past midnight.
+type MaintenanceWindow struct {
+	Start    string   `json:"start"`              // "HH:MM" in TimeZone
+	Duration string   `json:"duration"`           // Go duration, at most 24h (e.g. "3h")
+	Days     []string `json:"days,omitempty"`     // days the window opens ("mon".."sun"); empty is every day
+	TimeZone string   `json:"timezone,omitempty"` // IANA name; empty is UTC
+}
+
+// MaintenanceConfig assigns maintenance windows to devices. The most specific window applies:
+// Devices, then Lookup, then Groups, then Default. A device without any window is unrestricted.
+type MaintenanceConfig struct {
+	Default *MaintenanceWindow             `json:"default,omitempty"`
+	Devices map[DeviceID]MaintenanceWindow `json:"devices,omitempty"`
+	// Groups are keyed by the values of the device metadata entry GroupMetadata (comma-separated
+	// lists allowed; the first value with a window wins).
+	Groups        map[string]MaintenanceWindow `json:"groups,omitempty"`
+	GroupMetadata string                       `json:"groupMetadata,omitempty"` // default MetadataPartnerIDs
+	// Lookup supplies windows from elsewhere, such as the device's settings profile
+	// (policy.SettingsProfile.MaintenanceWindow); ok false falls through to Groups and Default.
+	Lookup func(ctx context.Context, d DeviceState) (w MaintenanceWindow, ok bool, err error) `json:"-"`
+}
+
+// Validate checks every configured window.
+func (c MaintenanceConfig) Validate() error {
+	if c.Default != nil {
+		if err := c.Default.Validate(); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+	for id, w := range c.Devices {
+		if err := w.Validate(); err != nil {
+			return fmt.Errorf("device %s: %w", id, err)
+		}
+	}
+	for g, w := range c.Groups {
+		if err := w.Validate(); err != nil {
+			return fmt.Errorf("group %s: %w", g, err)
+		}
+	}
+	return nil
+}
+
+// window is a parsed MaintenanceWindow.
+type window struct {
+	start int // minutes after midnight
+	dur   time.Duration
+	days  map[time.Weekday]bool // nil is every day
+	loc   *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func (w MaintenanceWindow) parse() (window, error) {
+	var out window
+	var h, m int
+	if _, err := fmt.Sscanf(w.Start, "%d:%d", &h, &m); err != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return out, fmt.Errorf("maintenance window start %q: want HH:MM: %w", w.Start, ErrInvalidParameter)
+	}
+	out.start = h*60 + m
+	d, err := time.ParseDuration(w.Duration)
+	if err != nil || d <= 0 || d > 24*time.Hour {
+		return out, fmt.Errorf("maintenance window duration %q: want (0, 24h]: %w", w.Duration, ErrInvalidParameter)
+	}
+	out.dur = d
+	for _, day := range w.Days {
+		wd, ok := weekdays[strings.ToLower(day[:min(3, len(day))])]
+		if !ok {
+			return out, fmt.Errorf("maintenance window day %q: %w", day, ErrInvalidParameter)
+		}
+		if out.days == nil {
+			out.days = make(map[time.Weekday]bool)
+		}
+		out.days[wd] = true
+	}
+	out.loc = time.UTC
+	if w.TimeZone != "" {
+		if out.loc, err = time.LoadLocation(w.TimeZone); err != nil {
+			return out, fmt.Errorf("maintenance window timezone %q: %w", w.TimeZone, ErrInvalidParameter)
+		}
+	}
+	return out, nil
+}
+
+// opening returns the window opening on the calendar day of t (in the window's zone), if any.
+func (w window) opening(t time.Time) (time.Time, bool) {
+	y, mo, d := t.Date()
+	start := time.Date(y, mo, d, w.start/60, w.start%60, 0, 0, w.loc)
+	return start, w.days == nil || w.days[start.Weekday()]
+}
+
+// Validate reports whether the window is well formed.
+func (w MaintenanceWindow) Validate() error {
+	_, err := w.parse()
+	return err
+}
+
+// Contains reports whether the window is open at t. An invalid window is never open.
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	pw, err := w.parse()
+	if err != nil {
+		return false
+	}
+	local := t.In(pw.loc)
+	// an opening yesterday may still be running
+	for _, day := range []time.Time{local, local.AddDate(0, 0, -1)} {
+		if start, ok := pw.opening(day); ok && !t.Before(start) && t.Before(start.Add(pw.dur)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns t when the window is open at t, and otherwise the time it next opens. The zero
+// time means the window is invalid.
+func (w MaintenanceWindow) Next(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+	pw, err := w.parse()
+	if err != nil {
+		return time.Time{}
+	}
+	local := t.In(pw.loc)
+	for i := 0; i <= 7; i++ {
+		if start, ok := pw.opening(local.AddDate(0, 0, i)); ok && start.After(t) {
+			return start
+		}
+	}
+	return time.Time{}
+}
+
+// MaintenanceWindowError is returned for disruptive operations attempted outside the device's
+// maintenance window; it matches ErrOutsideMaintenanceWindow with errors.Is.
+type MaintenanceWindowError struct {
+	DeviceID DeviceID
+	Next     time.Time // when the window next opens
+}
+
+func (e *MaintenanceWindowError) Error() string {
+	return fmt.Sprintf("%s: %s (next opens %s)", e.DeviceID, ErrOutsideMaintenanceWindow, e.Next.Format(time.RFC3339))
+}
+
+func (e *MaintenanceWindowError) Is(target error) bool { return target == ErrOutsideMaintenanceWindow }
+
+type forceKey struct{}
+
+// WithMaintenanceOverride returns a context whose disruptive operations ignore maintenance windows.
+func WithMaintenanceOverride(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceKey{}, true)
+}
+
+// OverrideAllowed reports whether the caller may override maintenance windows: admins may, as may
+// every caller when authorization is not in use (ctx carries no role).
+func OverrideAllowed(ctx context.Context) bool {
+	r, ok := RoleFromContext(ctx)
+	return !ok || r >= RoleAdmin
+}
+
+// MaintenanceOverridden reports whether ctx carries WithMaintenanceOverride.
+func MaintenanceOverridden(ctx context.Context) bool {
+	forced, _ := ctx.Value(forceKey{}).(bool)
+	return forced
+}
@@ -0,0 +1,54 @@
+package devicemgr
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindow(t *testing.T) {
+	// 22:00-02:00 New York time, opening Fridays and Saturdays
+	w := MaintenanceWindow{Start: "22:00", Duration: "4h", Days: []string{"fri", "Saturday"}, TimeZone: "America/New_York"}
+	ny, _ := time.LoadLocation("America/New_York")
+	at := func(day, hour, min int) time.Time { return time.Date(2026, time.May, day, hour, min, 0, 0, ny) } // May 1 2026 is a Friday
+
+	cases := []struct {
+		t    time.Time
+		open bool
+		next time.Time
+	}{
+		{at(1, 21, 59), false, at(1, 22, 0)},
+		{at(1, 22, 0), true, at(1, 22, 0)},
+		{at(2, 1, 59), true, at(2, 1, 59)}, // Friday's window runs past midnight
+		{at(2, 2, 0), false, at(2, 22, 0)},
+		{at(3, 1, 0), true, at(3, 1, 0)},
+		{at(3, 2, 30), false, at(8, 22, 0)}, // Sunday: next Friday
+	}
+	for _, c := range cases {
+		if got := w.Contains(c.t); got != c.open {
+			t.Errorf("Contains(%s) = %v", c.t, got)
+		}
+		if got := w.Next(c.t); !got.Equal(c.next) {
+			t.Errorf("Next(%s) = %s, want %s", c.t, got, c.next)
+		}
+	}
+
+	for _, bad := range []MaintenanceWindow{
+		{Start: "25:00", Duration: "1h"},
+		{Start: "02:00", Duration: "25h"},
+		{Start: "02:00", Duration: "1h", Days: []string{"someday"}},
+		{Start: "02:00", Duration: "1h", TimeZone: "Mars/Olympus"},
+	} {
+		if err := bad.Validate(); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("%+v: expected ErrInvalidParameter, got %v", bad, err)
+		}
+	}
+	if err := (MaintenanceConfig{Groups: map[string]MaintenanceWindow{"comcast": {Start: "x"}}}).Validate(); err == nil {
+		t.Fatal("expected invalid group window to fail validation")
+	}
+
+	var err error = &MaintenanceWindowError{DeviceID: "mac:1", Next: at(1, 22, 0)}
+	if !errors.Is(err, ErrOutsideMaintenanceWindow) {
+		t.Fatal("MaintenanceWindowError should match ErrOutsideMaintenanceWindow")
+	}
+}
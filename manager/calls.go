@@ -0,0 +1,125 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// InFlightCall is an RPC waiting for the device's reply.
+type InFlightCall struct {
+	ID        string      `json:"id"`
+	DeviceID  dm.DeviceID `json:"deviceId"`
+	Service   string      `json:"service"`
+	Method    string      `json:"method"`
+	StartedAt time.Time   `json:"startedAt"`
+}
+
+type callKey struct {
+	device dm.DeviceID
+	id     string
+}
+
+type inflightCall struct {
+	InFlightCall
+	cancel context.CancelCauseFunc
+}
+
+type callIDKey struct{}
+
+// errCallCanceled is the cause CancelCall cancels a call with, telling it apart from the caller
+// going away or the deadline passing.
+var errCallCanceled = errors.New("canceled by request")
+
+// WithCallID names the RPC made with ctx, so CancelCall can find it; calls made without one get
+// a generated ID. IDs are per device.
+func WithCallID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, callIDKey{}, id)
+}
+
+// CallIDFromContext returns the ID WithCallID set.
+func CallIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(callIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// InFlightCalls lists id's RPCs still waiting for a reply, oldest first.
+func (m *Manager) InFlightCalls(ctx context.Context, id dm.DeviceID) ([]InFlightCall, error) {
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		if _, err := m.Device(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	m.callMu.Lock()
+	out := []InFlightCall{}
+	for k, c := range m.calls {
+		if k.device == id {
+			out = append(out, c.InFlightCall)
+		}
+	}
+	m.callMu.Unlock()
+	sort.Slice(out, func(i, k int) bool { return out[i].StartedAt.Before(out[k].StartedAt) })
+	return out, nil
+}
+
+// CancelCall cancels id's RPC with the given call ID. The call returns an error wrapping
+// dm.ErrCanceled and, when Options.RPCCancelMethod is set, the device is sent that notification.
+// An unknown or finished call is ErrCallNotFound.
+func (m *Manager) CancelCall(ctx context.Context, id dm.DeviceID, callID string) error {
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		if _, err := m.Device(ctx, id); err != nil {
+			return err
+		}
+	}
+	m.callMu.Lock()
+	c, ok := m.calls[callKey{id, callID}]
+	m.callMu.Unlock()
+	if !ok {
+		return fmt.Errorf("call %s on %s: %w", callID, id, dm.ErrCallNotFound)
+	}
+	c.cancel(errCallCanceled)
+	rec := dm.NewAuditRecord(ctx, "rpc-cancel", id)
+	rec.Detail = c.Method
+	m.record(rec, nil)
+	return nil
+}
+
+// trackCall registers an RPC under the context's call ID until the returned untrack is called
+// with the call's error; untrack reports a call CancelCall stopped as dm.ErrCanceled.
+func (m *Manager) trackCall(ctx context.Context, id dm.DeviceID, service, method string) (context.Context, func(error) error, error) {
+	callID, ok := CallIDFromContext(ctx)
+	if !ok {
+		callID = uuid.NewString()
+	}
+	key := callKey{id, callID}
+	ctx, cancel := context.WithCancelCause(ctx)
+	c := &inflightCall{InFlightCall: InFlightCall{ID: callID, DeviceID: id, Service: service, Method: method, StartedAt: time.Now().UTC()}, cancel: cancel}
+	m.callMu.Lock()
+	if _, dup := m.calls[key]; dup {
+		m.callMu.Unlock()
+		cancel(nil)
+		return nil, nil, fmt.Errorf("call %s on %s already in flight: %w", callID, id, dm.ErrConflict)
+	}
+	if m.calls == nil {
+		m.calls = make(map[callKey]*inflightCall)
+	}
+	m.calls[key] = c
+	m.callMu.Unlock()
+	return ctx, func(err error) error {
+		m.callMu.Lock()
+		delete(m.calls, key)
+		m.callMu.Unlock()
+		canceled := errors.Is(context.Cause(ctx), errCallCanceled)
+		cancel(nil)
+		if err != nil && canceled {
+			// context.Canceled keeps the breaker and metrics from counting it against the device
+			return fmt.Errorf("rpc %s on %s: %w: %w", method, id, dm.ErrCanceled, context.Canceled)
+		}
+		return err
+	}, nil
+}
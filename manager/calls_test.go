@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+func TestCancelCall(t *testing.T) {
+	talaria := httptest.NewServer(http.NotFoundHandler())
+	defer talaria.Close()
+	requests, cancels := make(chan string, 1), make(chan string, 1)
+	upgrader := websocket.Upgrader{}
+	gw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			var msg struct {
+				ID     string `json:"id"`
+				Method string `json:"method"`
+				Params struct {
+					ID string `json:"id"`
+				} `json:"params"`
+			}
+			if c.ReadJSON(&msg) != nil {
+				return
+			}
+			// the device never replies; it only hears about the cancel
+			if msg.Method == "$/cancelRequest" {
+				cancels <- msg.Params.ID
+			} else {
+				requests <- msg.ID
+			}
+		}
+	}))
+	defer gw.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = talaria.URL
+	opts.BlizzardBaseURL = "ws" + strings.TrimPrefix(gw.URL, "http")
+	opts.RPCCancelMethod = "$/cancelRequest"
+	m := newTestManager(t, opts)
+	ctx := context.Background()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := m.Call(WithCallID(ctx, "scan-1"), "mac:0000000000a1", "", runtime.BlizzardCall{Method: "scan", Timeout: 10 * time.Second})
+		errc <- err
+	}()
+	var rid string
+	select {
+	case rid = <-requests:
+	case <-time.After(2 * time.Second):
+		t.Fatal("call did not reach the device")
+	}
+	calls, err := m.InFlightCalls(ctx, "mac:0000000000a1")
+	if err != nil || len(calls) != 1 || calls[0].ID != "scan-1" || calls[0].Method != "scan" {
+		b, _ := json.Marshal(calls)
+		t.Fatalf("in flight: %s %v", b, err)
+	}
+	if _, err := m.Call(WithCallID(ctx, "scan-1"), "mac:0000000000a1", "", runtime.BlizzardCall{Method: "scan"}); !errors.Is(err, dm.ErrConflict) {
+		t.Fatalf("reused call ID: %v", err)
+	}
+	if err := m.CancelCall(ctx, "mac:0000000000b1", "scan-1"); !errors.Is(err, dm.ErrCallNotFound) {
+		t.Fatalf("cancel on another device: %v", err)
+	}
+	if err := m.CancelCall(ctx, "mac:0000000000a1", "scan-1"); err != nil {
+		t.Fatalf("CancelCall: %v", err)
+	}
+	select {
+	case err := <-errc:
+		if !errors.Is(err, dm.ErrCanceled) {
+			t.Fatalf("canceled call returned %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("call did not return")
+	}
+	select {
+	case got := <-cancels:
+		if got != rid {
+			t.Fatalf("cancel notification for %q, want the request's %q", got, rid)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("device was not sent the cancel notification")
+	}
+	if calls, _ := m.InFlightCalls(ctx, "mac:0000000000a1"); len(calls) != 0 {
+		t.Fatalf("finished call still listed: %+v", calls)
+	}
+	if err := m.CancelCall(ctx, "mac:0000000000a1", "scan-1"); !errors.Is(err, dm.ErrCallNotFound) {
+		t.Fatalf("cancel after finish: %v", err)
+	}
+}
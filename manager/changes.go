@@ -0,0 +1,138 @@
+package manager
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// DefaultChangesLimit is the number of changes Changes returns when given no limit.
+const DefaultChangesLimit = 500
+
+// ChangeType classifies a DeviceChange.
+type ChangeType string
+
+const (
+	ChangeAdded   ChangeType = "added"   // the device came online and joined the device list
+	ChangeRemoved ChangeType = "removed" // the device went offline and left the device list
+	ChangeUpdated ChangeType = "changed" // the device's status changed while it stayed listed
+)
+
+// DeviceChange is an entry of the change feed.
+type DeviceChange struct {
+	Type     ChangeType           `json:"type"`
+	DeviceID dm.DeviceID          `json:"deviceId"`
+	Status   runtime.DeviceStatus `json:"status"`
+	From     runtime.DeviceStatus `json:"from,omitempty"`
+	Reason   string               `json:"reason,omitempty"`
+	At       time.Time            `json:"at"`
+}
+
+// ChangeFeed is a page of the change feed. Cursor resumes after the last change of the page.
+type ChangeFeed struct {
+	Changes []DeviceChange `json:"changes"`
+	Cursor  string         `json:"cursor"`
+	More    bool           `json:"more"` // further changes are ready; call again with Cursor
+}
+
+// startJournal records connectivity events for Changes, acknowledged so none are dropped while
+// the journal keeps up.
+func (m *Manager) startJournal() {
+	m.epoch = uuid.NewString()[:8]
+	m.journal = events.NewJournal(events.JournalConfig{
+		Size:   m.opts.Events.JournalSize,
+		Filter: events.Filter{Kinds: []dm.EventKind{dm.EventOnline, dm.EventSuspect, dm.EventOffline}},
+		Partners: func(id dm.DeviceID) []string {
+			return dm.SplitPartners(m.devices.View().Metadata(string(id))[dm.MetadataPartnerIDs])
+		},
+	})
+	sub := m.SubscribeAcked(1024)
+	m.journalSub = sub
+	go m.journal.Run(sub)
+}
+
+// Changes returns up to limit device additions, removals and status changes after cursor, oldest
+// first, so an integration can keep its device list in sync without diffing full snapshots. An
+// empty cursor returns no changes and the current position: take it, then read the device list,
+// then follow the feed from it. Cursors are opaque and belong to this process; one from another
+// process, or one older than the Options.Events.JournalSize events retained, is ErrCursorExpired
+// and the integration must read the full list again. Partner-scoped callers only see their
+// partners' devices.
+func (m *Manager) Changes(ctx context.Context, cursor string, limit int) (ChangeFeed, error) {
+	if limit <= 0 {
+		limit = DefaultChangesLimit
+	}
+	if cursor == "" {
+		return ChangeFeed{Changes: []DeviceChange{}, Cursor: m.changeCursor(m.journal.Head())}, nil
+	}
+	after, err := m.parseChangeCursor(cursor)
+	if err != nil {
+		return ChangeFeed{}, err
+	}
+	page, ok := m.journal.Since(after, limit)
+	if !ok {
+		return ChangeFeed{}, fmt.Errorf("changes after %s are no longer retained: %w", cursor, dm.ErrCursorExpired)
+	}
+	scope, scoped := dm.PartnersFromContext(ctx)
+	feed := ChangeFeed{Changes: []DeviceChange{}, Cursor: m.changeCursor(page.Next), More: page.More}
+	for _, e := range page.Entries {
+		if scoped && !dm.PartnerAllowed(scope, e.Partners) {
+			continue
+		}
+		feed.Changes = append(feed.Changes, deviceChange(e.Event))
+	}
+	return feed, nil
+}
+
+// deviceChange classifies a connectivity event. Polls list online and suspect devices, so only
+// becoming online or offline adds or removes one.
+func deviceChange(e dm.Event) DeviceChange {
+	c := DeviceChange{DeviceID: e.DeviceID, At: e.OccurredAt}
+	if t, ok := e.Payload.(runtime.Transition); ok {
+		c.Status, c.From, c.Reason = t.To, t.From, t.Reason
+	} else {
+		c.Status = runtime.DeviceStatus(e.Kind)
+		if s, ok := e.Payload.(string); ok {
+			c.Reason = s
+		}
+	}
+	switch {
+	case c.Status == runtime.StatusOffline:
+		c.Type = ChangeRemoved
+	case c.Status == runtime.StatusOnline && c.From == runtime.StatusSuspect:
+		c.Type = ChangeUpdated
+	case c.Status == runtime.StatusOnline:
+		c.Type = ChangeAdded
+	default:
+		c.Type = ChangeUpdated
+	}
+	return c
+}
+
+func (m *Manager) changeCursor(seq uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(m.epoch + ":" + strconv.FormatUint(seq, 10)))
+}
+
+func (m *Manager) parseChangeCursor(cursor string) (uint64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	epoch, n, found := strings.Cut(string(raw), ":")
+	seq, perr := strconv.ParseUint(n, 10, 64)
+	if err != nil || !found || perr != nil {
+		return 0, fmt.Errorf("malformed cursor %q: %w", cursor, dm.ErrInvalidParameter)
+	}
+	if epoch != m.epoch {
+		return 0, fmt.Errorf("cursor %s is from another devicemgr process: %w", cursor, dm.ErrCursorExpired)
+	}
+	if seq > m.journal.Head() {
+		return 0, fmt.Errorf("cursor %s is ahead of the feed: %w", cursor, dm.ErrInvalidParameter)
+	}
+	return seq, nil
+}
@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+func TestChanges(t *testing.T) {
+	var polls atomic.Int32
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Events.JournalSize = 3
+	m := newTestManager(t, opts)
+	ctx := context.Background()
+	waitHead := func(seq uint64) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for m.journal.Head() < seq {
+			if time.Now().After(deadline) {
+				t.Fatalf("journal at %d, want %d", m.journal.Head(), seq)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	start, err := m.Changes(ctx, "", 0)
+	if err != nil || len(start.Changes) != 0 || start.Cursor == "" {
+		t.Fatalf("initial cursor: %+v %v", start, err)
+	}
+	if _, err := m.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitHead(2)
+	feed, err := m.Changes(ctx, start.Cursor, 0)
+	if err != nil || len(feed.Changes) != 2 || feed.More {
+		t.Fatalf("after poll: %+v %v", feed, err)
+	}
+	if c := feed.Changes[0]; c.Type != ChangeAdded || c.Status != runtime.StatusOnline {
+		t.Fatalf("change %+v", c)
+	}
+	scoped, err := m.Changes(dm.WithPartners(ctx, []string{"comcast"}), start.Cursor, 0)
+	if err != nil || len(scoped.Changes) != 1 || scoped.Changes[0].DeviceID != "mac:aa" || scoped.Cursor != feed.Cursor {
+		t.Fatalf("scoped: %+v %v", scoped, err)
+	}
+	page, err := m.Changes(ctx, start.Cursor, 1)
+	if err != nil || len(page.Changes) != 1 || !page.More {
+		t.Fatalf("page: %+v %v", page, err)
+	}
+	if rest, err := m.Changes(ctx, page.Cursor, 1); err != nil || len(rest.Changes) != 1 || rest.More || rest.Changes[0].DeviceID == page.Changes[0].DeviceID {
+		t.Fatalf("next page: %+v %v", rest, err)
+	}
+
+	// the offline device is out of the device list but still scoped by its partners
+	m.bus.Publish(runtime.Transition{DeviceID: "mac:aa", From: runtime.StatusSuspect, To: runtime.StatusOffline, Reason: "missed polls", At: time.Now()}.Event("test"))
+	waitHead(3)
+	feed, err = m.Changes(dm.WithPartners(ctx, []string{"comcast"}), feed.Cursor, 0)
+	if err != nil || len(feed.Changes) != 1 || feed.Changes[0].Type != ChangeRemoved || feed.Changes[0].From != runtime.StatusSuspect {
+		t.Fatalf("removal: %+v %v", feed, err)
+	}
+
+	m.bus.Publish(runtime.Transition{DeviceID: "mac:aa", From: runtime.StatusOffline, To: runtime.StatusOnline, At: time.Now()}.Event("test"))
+	waitHead(4)
+	if _, err := m.Changes(ctx, start.Cursor, 0); !errors.Is(err, dm.ErrCursorExpired) {
+		t.Fatalf("evicted cursor: %v", err)
+	}
+	if _, err := m.Changes(ctx, "not a cursor", 0); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("malformed cursor: %v", err)
+	}
+	foreign := base64.RawURLEncoding.EncodeToString([]byte("deadbeef:1"))
+	if _, err := m.Changes(ctx, foreign, 0); !errors.Is(err, dm.ErrCursorExpired) {
+		t.Fatalf("foreign cursor: %v", err)
+	}
+}
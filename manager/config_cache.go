@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// DefaultConfigCIDParameter holds a WebPA device's configuration ID, which changes with every
+// configuration write.
+const DefaultConfigCIDParameter = "Device.X_RDKCENTRAL-COM_CID"
+
+// ConfigDocument is a subtree read by GetConfig, tagged with the configuration CID it was read at.
+type ConfigDocument struct {
+	CID       string                       `json:"cid"`
+	Values    map[string]dm.ParameterValue `json:"values"`
+	FetchedAt time.Time                    `json:"fetchedAt"`
+	Cached    bool                         `json:"cached"` // served without reading the subtree
+}
+
+// GetConfig reads whole subtrees (e.g. "Device.WiFi.") for periodic configuration audits. It first
+// reads the device's configuration CID (Cache.ConfigCIDParameter) and, while the CID is unchanged,
+// serves the subtrees from the result cached under it for up to Cache.ConfigTTL instead of
+// reading them again. A device reporting no CID is always read in full.
+func (m *Manager) GetConfig(ctx context.Context, id dm.DeviceID, service string, paths []string) (*ConfigDocument, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("paths required: %w", dm.ErrInvalidParameter)
+	}
+	if err := m.paramACL.Check(ctx, dm.ParameterRead, paths...); err != nil {
+		return nil, err
+	}
+	id = id.Canonical()
+	cidParam := m.opts.Cache.ConfigCIDParameter
+	if cidParam == "" {
+		cidParam = DefaultConfigCIDParameter
+	}
+	cidValues, err := m.getParameters(ctx, id, service, []string{cidParam}, false)
+	if err != nil {
+		return nil, err
+	}
+	var cid string
+	if v := cidValues[cidParam].Value; v != nil {
+		cid = fmt.Sprint(v)
+	}
+	keyService := service
+	if s, err := m.ResolveService(service); err == nil {
+		keyService = s // "" and the default service share entries
+	}
+	key := configKey(id, keyService, cid, paths)
+	if cid != "" {
+		if doc, _, ok := m.configs.Get(key); ok {
+			doc.Cached = true
+			doc.Values = m.readable(ctx, maps.Clone(doc.Values))
+			return &doc, nil
+		}
+	}
+	values, err := m.getParameters(ctx, id, service, paths, false)
+	if err != nil {
+		return nil, err
+	}
+	doc := ConfigDocument{CID: cid, Values: values, FetchedAt: time.Now()}
+	if cid != "" {
+		m.configs.Set(key, doc)
+	}
+	// the cached document keeps every value, for callers whose role may read more
+	doc.Values = m.readable(ctx, maps.Clone(values))
+	return &doc, nil
+}
+
+// configKey identifies a subtree read: the same paths in any order share an entry.
+func configKey(id dm.DeviceID, service, cid string, paths []string) string {
+	sorted := slices.Clone(paths)
+	slices.Sort(sorted)
+	return strings.Join([]string{string(id), service, cid, strings.Join(slices.Compact(sorted), ",")}, "|")
+}
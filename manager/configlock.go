@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// AcquireLock takes a configuration lock on the device for owner, lasting ttl, or extends the one
+// owner already holds. While it is held, SETs (including those of reboots, profiles and firmware
+// updates) are refused with a *dm.LockHeldError unless their context names owner
+// (dm.WithLockOwner). A lock of another owner fails the same way.
+func (m *Manager) AcquireLock(ctx context.Context, id dm.DeviceID, owner string, ttl time.Duration) (l dm.ConfigLock, err error) {
+	id = id.Canonical()
+	rec := dm.NewAuditRecord(ctx, "lock", id)
+	rec.Detail = owner
+	defer func() { m.audit(rec, err) }()
+	if err := m.lockRequest(ctx, id, owner, ttl); err != nil {
+		return dm.ConfigLock{}, err
+	}
+	now := time.Now().UTC()
+	held, ok, err := m.locks.Acquire(ctx, dm.ConfigLock{DeviceID: id, Owner: owner, AcquiredAt: now, ExpiresAt: now.Add(ttl)})
+	if err != nil {
+		return dm.ConfigLock{}, fmt.Errorf("lock %s: %w", id, err)
+	}
+	if !ok {
+		return dm.ConfigLock{}, &dm.LockHeldError{DeviceID: id, Holder: held}
+	}
+	return held, nil
+}
+
+// RenewLock extends the lock owner holds on the device to ttl from now. It fails with
+// dm.ErrLockNotFound when owner does not hold it, for instance because it lapsed.
+func (m *Manager) RenewLock(ctx context.Context, id dm.DeviceID, owner string, ttl time.Duration) (dm.ConfigLock, error) {
+	id = id.Canonical()
+	if err := m.lockRequest(ctx, id, owner, ttl); err != nil {
+		return dm.ConfigLock{}, err
+	}
+	l, ok, err := m.locks.Renew(ctx, id, owner, time.Now().UTC().Add(ttl))
+	if err != nil {
+		return dm.ConfigLock{}, fmt.Errorf("lock %s: %w", id, err)
+	}
+	if !ok {
+		return dm.ConfigLock{}, fmt.Errorf("lock on %s held by %s: %w", id, owner, dm.ErrLockNotFound)
+	}
+	return l, nil
+}
+
+// ReleaseLock gives up the lock owner holds on the device, failing with dm.ErrLockNotFound when
+// owner does not hold it.
+func (m *Manager) ReleaseLock(ctx context.Context, id dm.DeviceID, owner string) (err error) {
+	id = id.Canonical()
+	rec := dm.NewAuditRecord(ctx, "unlock", id)
+	rec.Detail = owner
+	defer func() { m.audit(rec, err) }()
+	if strings.TrimSpace(owner) == "" {
+		return fmt.Errorf("lock owner required: %w", dm.ErrInvalidParameter)
+	}
+	return m.release(ctx, id, owner)
+}
+
+// ForceReleaseLock removes the lock on the device whoever holds it, for owners that went away
+// without releasing. Only callers dm.OverrideAllowed permits may force a release.
+func (m *Manager) ForceReleaseLock(ctx context.Context, id dm.DeviceID) (err error) {
+	id = id.Canonical()
+	rec := dm.NewAuditRecord(ctx, "unlock", id)
+	rec.Override = true
+	defer func() { m.audit(rec, err) }()
+	if !dm.OverrideAllowed(ctx) {
+		return fmt.Errorf("forced lock release requires the %s role: %w", dm.RoleAdmin, dm.ErrAccessDenied)
+	}
+	if l, ok, err := m.locks.Get(ctx, id); err == nil && ok {
+		rec.Detail = l.Owner
+	}
+	return m.release(ctx, id, "")
+}
+
+// Lock returns the lock held on the device, or dm.ErrLockNotFound.
+func (m *Manager) Lock(ctx context.Context, id dm.DeviceID) (dm.ConfigLock, error) {
+	id = id.Canonical()
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		if _, err := m.Device(ctx, id); err != nil {
+			return dm.ConfigLock{}, err
+		}
+	}
+	l, ok, err := m.locks.Get(ctx, id)
+	if err != nil {
+		return dm.ConfigLock{}, fmt.Errorf("lock %s: %w", id, err)
+	}
+	if !ok {
+		return dm.ConfigLock{}, fmt.Errorf("lock on %s: %w", id, dm.ErrLockNotFound)
+	}
+	return l, nil
+}
+
+func (m *Manager) release(ctx context.Context, id dm.DeviceID, owner string) error {
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		if _, err := m.Device(ctx, id); err != nil {
+			return err
+		}
+	}
+	ok, err := m.locks.Release(ctx, id, owner)
+	if err != nil {
+		return fmt.Errorf("lock %s: %w", id, err)
+	}
+	if !ok {
+		return fmt.Errorf("lock on %s: %w", id, dm.ErrLockNotFound)
+	}
+	return nil
+}
+
+// lockRequest checks the arguments of a lock or renewal and the caller's partner scope.
+func (m *Manager) lockRequest(ctx context.Context, id dm.DeviceID, owner string, ttl time.Duration) error {
+	if strings.TrimSpace(owner) == "" {
+		return fmt.Errorf("lock owner required: %w", dm.ErrInvalidParameter)
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("lock ttl must be positive: %w", dm.ErrInvalidParameter)
+	}
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		if _, err := m.Device(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkLock refuses a SET on a device locked by an owner other than ctx's.
+func (m *Manager) checkLock(ctx context.Context, id dm.DeviceID) error {
+	l, ok, err := m.locks.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("lock %s: %v: %w", id, err, dm.ErrBackendUnavailable)
+	}
+	if ok && l.Owner != dm.LockOwnerFromContext(ctx) {
+		return &dm.LockHeldError{DeviceID: id, Holder: l}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestConfigLocks(t *testing.T) {
+	var sets atomic.Int32
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sets.Add(1)
+		w.Write([]byte(`{"statusCode":200}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = "http://talaria.invalid"
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	m := newTestManager(t, opts)
+	ctx := context.Background()
+	set := func(ctx context.Context) error {
+		_, err := m.SetParameters(ctx, "mac:112233445566", "", []dm.SetParameter{{Name: "Device.WiFi.SSID.1.SSID", Value: "x"}}, dm.SetOptions{})
+		return err
+	}
+
+	if _, err := m.AcquireLock(ctx, "mac:112233445566", "", time.Minute); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("no owner: %v", err)
+	}
+	l, err := m.AcquireLock(ctx, "MAC:11-22-33-44-55-66", "ci", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.DeviceID != "mac:112233445566" || l.Owner != "ci" || time.Until(l.ExpiresAt) <= 0 {
+		t.Fatalf("lock %+v", l)
+	}
+	var held *dm.LockHeldError
+	if _, err := m.AcquireLock(ctx, "mac:112233445566", "other", time.Minute); !errors.As(err, &held) || held.Holder.Owner != "ci" {
+		t.Fatalf("second owner: %v", err)
+	}
+
+	// SETs of other owners are refused; the owner's go through
+	if err := set(ctx); !errors.Is(err, dm.ErrLockHeld) {
+		t.Fatalf("unowned set: %v", err)
+	}
+	if err := set(dm.WithLockOwner(ctx, "other")); !errors.Is(err, dm.ErrLockHeld) {
+		t.Fatalf("other owner's set: %v", err)
+	}
+	if err := set(dm.WithPartners(ctx, []string{"sky"})); !errors.Is(err, dm.ErrDeviceNotFound) {
+		t.Fatalf("set outside the caller's partners: %v", err)
+	}
+	if sets.Load() != 0 {
+		t.Fatalf("%d refused SETs reached the device", sets.Load())
+	}
+	if err := set(dm.WithLockOwner(ctx, "ci")); err != nil {
+		t.Fatalf("owner's set: %v", err)
+	}
+
+	renewed, err := m.RenewLock(ctx, "mac:112233445566", "ci", time.Hour)
+	if err != nil || !renewed.ExpiresAt.After(l.ExpiresAt) || !renewed.AcquiredAt.Equal(l.AcquiredAt) {
+		t.Fatalf("renew = %+v, %v", renewed, err)
+	}
+	if _, err := m.RenewLock(ctx, "mac:112233445566", "other", time.Hour); !errors.Is(err, dm.ErrLockNotFound) {
+		t.Fatalf("renew by other owner: %v", err)
+	}
+	if err := m.ReleaseLock(ctx, "mac:112233445566", "other"); !errors.Is(err, dm.ErrLockNotFound) {
+		t.Fatalf("release by other owner: %v", err)
+	}
+
+	// only admins may force a release
+	if err := m.ForceReleaseLock(dm.WithRole(ctx, dm.RoleOperator), "mac:112233445566"); !errors.Is(err, dm.ErrAccessDenied) {
+		t.Fatalf("operator force release: %v", err)
+	}
+	if err := m.ForceReleaseLock(dm.WithRole(ctx, dm.RoleAdmin), "mac:112233445566"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Lock(ctx, "mac:112233445566"); !errors.Is(err, dm.ErrLockNotFound) {
+		t.Fatalf("lock after force release: %v", err)
+	}
+	if err := set(ctx); err != nil {
+		t.Fatalf("set after release: %v", err)
+	}
+
+	// a lapsed lease no longer blocks anyone
+	if _, err := m.AcquireLock(ctx, "mac:112233445566", "ci", 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := m.AcquireLock(ctx, "mac:112233445566", "other", time.Minute); err != nil {
+		t.Fatalf("acquire after lapse: %v", err)
+	}
+	if err := m.ReleaseLock(ctx, "mac:112233445566", "other"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,138 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"path"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// probedVersion is a device's data-model version as a probe found it.
+type probedVersion struct {
+	firmware string // the firmware it was probed on
+	version  string
+}
+
+// probingKey marks the context of a version probe's reads, which are sent as named.
+type probingKey struct{}
+
+// DataModelVersion returns a device's data-model version following Options.DataModel, "" when it
+// cannot be learned. Probed versions are kept until the device reports other firmware. Devices
+// outside the caller's partner scope report ErrDeviceNotFound.
+func (m *Manager) DataModelVersion(ctx context.Context, id dm.DeviceID) (string, error) {
+	id = id.Canonical()
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		if _, err := m.Device(ctx, id); err != nil {
+			return "", err
+		}
+	}
+	md := m.devices.Metadata(string(id))
+	if v := md[dm.MetadataDataModel]; v != "" {
+		return v, nil
+	}
+	fw := md[dm.MetadataFirmware]
+	for _, r := range m.opts.DataModel.Firmware {
+		if ok, _ := path.Match(r.Pattern, fw); ok && fw != "" {
+			return r.Version, nil
+		}
+	}
+	m.versionMu.Lock()
+	pv, ok := m.versions[id]
+	m.versionMu.Unlock()
+	if ok && pv.firmware == fw {
+		return pv.version, nil
+	}
+	probes := m.opts.DataModel.Probes
+	if len(probes) == 0 {
+		probes = dm.DefaultDataModelProbes
+	}
+	pv = probedVersion{firmware: fw}
+	ctx = context.WithValue(ctx, probingKey{}, true)
+	for _, name := range probes {
+		// probe one name at a time: a device failing a GET for a name it lacks fails the others too
+		values, err := m.getParameters(ctx, id, "", []string{name}, false)
+		if unreachable(ctx, err) {
+			return "", err
+		}
+		if s, ok := values[name].Value.(string); err == nil && ok && s != "" {
+			pv.version = s
+			break
+		}
+	}
+	m.versionMu.Lock()
+	if m.versions == nil {
+		m.versions = make(map[dm.DeviceID]probedVersion)
+	}
+	m.versions[id] = pv
+	m.versionMu.Unlock()
+	return pv.version, nil
+}
+
+// unreachable reports whether err kept a probe from reaching the device, rather than the device
+// not knowing the probed name.
+func unreachable(ctx context.Context, err error) bool {
+	return err != nil && (ctx.Err() != nil || errors.Is(err, dm.ErrDeviceNotFound) || errors.Is(err, dm.ErrDeviceOffline) ||
+		errors.Is(err, dm.ErrTimeout) || errors.Is(err, dm.ErrAccessDenied))
+}
+
+// pathMap translates between the catalog's current parameter names and those of one device's
+// data-model version; the zero pathMap leaves names alone.
+type pathMap struct {
+	r       dm.ParameterResolver
+	version string
+}
+
+func (p pathMap) device(name string) string {
+	if p.r == nil {
+		return name
+	}
+	return p.r.DevicePath(name, p.version)
+}
+
+func (p pathMap) canonical(path string) string {
+	if p.r == nil {
+		return path
+	}
+	return p.r.CanonicalPath(path, p.version)
+}
+
+// pathsFor returns the pathMap for reading or writing names on id, learning the device's version
+// only when the catalog names one of them differently in some version.
+func (m *Manager) pathsFor(ctx context.Context, id dm.DeviceID, names []string) (pathMap, error) {
+	r, ok := m.catalog.(dm.ParameterResolver)
+	if !ok || ctx.Value(probingKey{}) != nil {
+		return pathMap{}, nil
+	}
+	for _, name := range names {
+		if !r.Versioned(name) {
+			continue
+		}
+		version, err := m.DataModelVersion(ctx, id)
+		if err != nil || version == "" {
+			return pathMap{}, err
+		}
+		return pathMap{r: r, version: version}, nil
+	}
+	return pathMap{}, nil
+}
+
+func setNames(params []dm.SetParameter) []string {
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// canonicalApplied reports res.Applied under the catalog's current names.
+func canonicalApplied(res *runtime.SetResult, paths pathMap) *runtime.SetResult {
+	if res == nil || paths.r == nil {
+		return res
+	}
+	for i, name := range res.Applied {
+		res.Applied[i] = paths.canonical(name)
+	}
+	return res
+}
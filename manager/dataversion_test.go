@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/schema"
+)
+
+func TestDataModelVersionPaths(t *testing.T) {
+	var (
+		polls atomic.Int32
+		mu    sync.Mutex
+		seen  []string // names and SET bodies sent to Tr1d1um
+	)
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method != http.MethodGet {
+			b, _ := io.ReadAll(r.Body)
+			seen = append(seen, string(b))
+			w.Write([]byte(`{"statusCode":200}`))
+			return
+		}
+		name := r.URL.Query().Get("names")
+		seen = append(seen, name)
+		value := "WPA2-Personal"
+		if name == "Device.RootDataModelVersion" {
+			value = "2.9"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"parameters": map[string]any{name: map[string]any{"value": value}}})
+	}))
+	defer tr1d1um.Close()
+	catalog, err := schema.New([]schema.Parameter{
+		{Path: "Device.RootDataModelVersion", Type: "string"},
+		{Path: "Device.WiFi.AccessPoint.{i}.Security.ModeEnabled", Type: "string", Writable: true, Paths: []schema.VersionPath{
+			{Before: "2.12", Path: "Device.WiFi.AccessPoint.{i}.X_RDK_Security.ModeEnabled"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	opts.Catalog = catalog
+	m := newTestManager(t, opts)
+	ctx := context.Background()
+
+	const name = "Device.WiFi.AccessPoint.2.Security.ModeEnabled"
+	for i := 0; i < 2; i++ {
+		values, err := m.RefreshParameters(ctx, "mac:aa", "", []string{name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := values[name]; !ok || v.Name != name || v.Value != "WPA2-Personal" {
+			t.Fatalf("values %+v", values)
+		}
+	}
+	if _, err := m.SetParameters(ctx, "mac:aa", "", []dm.SetParameter{{Name: name, Value: "WPA3-Personal"}}, dm.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := m.DataModelVersion(ctx, "mac:aa"); err != nil || v != "2.9" {
+		t.Fatalf("version %q: %v", v, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	const old = "Device.WiFi.AccessPoint.2.X_RDK_Security.ModeEnabled"
+	if len(seen) != 4 || seen[0] != "Device.RootDataModelVersion" || seen[1] != old || seen[2] != old || !strings.Contains(seen[3], old) {
+		t.Fatalf("sent %q", seen)
+	}
+}
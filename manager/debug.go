@@ -0,0 +1,86 @@
+package manager
+
+import (
+	goruntime "runtime"
+	"sort"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// RuntimeDump is a point-in-time view of the process internals behind the polling loop and the
+// long-lived device connections, for diagnosing a live replica.
+type RuntimeDump struct {
+	At         time.Time `json:"at"`
+	Goroutines int       `json:"goroutines"`
+	Memory     struct {
+		HeapAlloc   uint64 `json:"heapAlloc"`
+		HeapObjects uint64 `json:"heapObjects"`
+		NumGC       uint32 `json:"numGC"`
+	} `json:"memory"`
+	Polling struct {
+		LastPoll  *time.Time `json:"lastPoll,omitempty"`
+		LastError string     `json:"lastError,omitempty"`
+		ResumeAt  *time.Time `json:"resumeAt,omitempty"` // polling deferred by a Retry-After until then
+	} `json:"polling"`
+	// ParamWatches counts open ParamWatch subscriptions by device.
+	ParamWatches     map[dm.DeviceID]int `json:"paramWatches"`
+	EventSubscribers int                 `json:"eventSubscribers"`
+	// USPAgents lists the agents connected to the WebSocket MTP.
+	USPAgents     []string                 `json:"uspAgents,omitempty"`
+	MQTTConnected *bool                    `json:"mqttConnected,omitempty"` // nil without a broker
+	OpenCircuits  []dm.DeviceID            `json:"openCircuits,omitempty"`
+	Instances     []runtime.InstanceHealth `json:"instances,omitempty"`
+	// Faults counts the failures injected by kind, with Options.Faults.
+	Faults map[string]uint64 `json:"faults,omitempty"`
+}
+
+// Dump captures a RuntimeDump. It reports the whole process and is not partner scoped.
+func (m *Manager) Dump() RuntimeDump {
+	var out RuntimeDump
+	out.At = time.Now()
+	out.Goroutines = goruntime.NumGoroutine()
+	var ms goruntime.MemStats
+	goruntime.ReadMemStats(&ms)
+	out.Memory.HeapAlloc, out.Memory.HeapObjects, out.Memory.NumGC = ms.HeapAlloc, ms.HeapObjects, ms.NumGC
+
+	m.pollMu.Lock()
+	if !m.lastPoll.IsZero() {
+		at := m.lastPoll
+		out.Polling.LastPoll = &at
+	}
+	if m.lastPollErr != nil {
+		out.Polling.LastError = m.lastPollErr.Error()
+	}
+	if resume := m.pollResume; resume.After(out.At) {
+		out.Polling.ResumeAt = &resume
+	}
+	m.pollMu.Unlock()
+
+	out.ParamWatches = make(map[dm.DeviceID]int)
+	m.watchMu.Lock()
+	for id, subs := range m.watches {
+		if len(subs) > 0 {
+			out.ParamWatches[id] = len(subs)
+		}
+	}
+	m.watchMu.Unlock()
+	out.EventSubscribers = m.bus.Subscribers()
+	if m.uspWS != nil {
+		out.USPAgents = m.uspWS.Connected()
+		sort.Strings(out.USPAgents)
+	}
+	if m.mqttClient != nil {
+		connected := m.mqttClient.Connected()
+		out.MQTTConnected = &connected
+	}
+	out.OpenCircuits = m.breaker.Open()
+	if m.router != nil {
+		out.Instances = m.router.Instances()
+	}
+	if m.faults != nil {
+		out.Faults = m.faults.Counts()
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+package manager
+
+import (
+	"fmt"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// describe adds the catalog's unit and enum label to each value, when the catalog knows them.
+func (m *Manager) describe(values map[string]dm.ParameterValue) map[string]dm.ParameterValue {
+	d, ok := m.catalog.(dm.ParameterDescriber)
+	if !ok {
+		return values
+	}
+	for name, v := range values {
+		info, ok := d.Describe(name)
+		if !ok {
+			continue
+		}
+		v.Unit, v.Label = info.Unit, info.Label(v.Value)
+		values[name] = v
+	}
+	return values
+}
+
+// checkEnums rejects a SET with a value outside its parameter's catalog enumeration before it
+// reaches the device.
+func (m *Manager) checkEnums(params []dm.SetParameter) error {
+	d, ok := m.catalog.(dm.ParameterDescriber)
+	if !ok {
+		return nil
+	}
+	for _, p := range params {
+		if info, ok := d.Describe(p.Name); ok {
+			if err := info.CheckEnum(p.Value); err != nil {
+				return fmt.Errorf("%s: %w", p.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestCatalogLabelsAndEnums(t *testing.T) {
+	var polls, sets atomic.Int32
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(map[string]any{"parameters": map[string]any{
+				"Device.WiFi.AccessPoint.1.Security.ModeEnabled": map[string]any{"value": "WPA2-Personal"},
+				"Device.DeviceInfo.UpTime":                       map[string]any{"value": "3600"},
+			}})
+			return
+		}
+		sets.Add(1)
+		w.Write([]byte(`{"statusCode":200}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	m := newTestManager(t, opts)
+	ctx := context.Background()
+
+	values, err := m.RefreshParameters(ctx, "mac:aa", "", []string{"Device.WiFi.AccessPoint.1.Security.ModeEnabled", "Device.DeviceInfo.UpTime"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := values["Device.WiFi.AccessPoint.1.Security.ModeEnabled"]; v.Label != "WPA2 Personal" || v.Unit != "" {
+		t.Fatalf("security mode %+v", v)
+	}
+	if v := values["Device.DeviceInfo.UpTime"]; v.Unit != "seconds" || v.Label != "" {
+		t.Fatalf("uptime %+v", v)
+	}
+	if _, err := m.SetParameters(ctx, "mac:aa", "", []dm.SetParameter{{Name: "Device.WiFi.AccessPoint.1.Security.ModeEnabled", Value: "WEP-128"}}, dm.SetOptions{}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("out-of-enum SET: %v", err)
+	}
+	if sets.Load() != 0 {
+		t.Fatal("out-of-enum SET reached Tr1d1um")
+	}
+	if _, err := m.SetParameters(ctx, "mac:aa", "", []dm.SetParameter{{Name: "Device.WiFi.AccessPoint.1.Security.ModeEnabled", Value: "WPA3-Personal"}}, dm.SetOptions{}); err != nil || sets.Load() != 1 {
+		t.Fatalf("enumerated SET: %v", err)
+	}
+}
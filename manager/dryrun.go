@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// dryRunSet answers SetParameters with SetOptions.DryRun: the adapter builds the payload without
+// sending it, each parameter is checked against the catalog for the device's model, and outcomes
+// are predicted from the device's connectivity, its circuit breaker and the parameter cache.
+func (m *Manager) dryRunSet(ctx context.Context, id dm.DeviceID, service string, params []dm.SetParameter, opts dm.SetOptions) (*runtime.SetResult, error) {
+	var res *runtime.SetResult
+	if agent, err := m.uspAgent(ctx, id); err != nil {
+		return nil, err
+	} else if agent {
+		if res, err = m.usp.Set(ctx, id, params, opts); err != nil {
+			return nil, err
+		}
+		service = uspService
+	} else {
+		if _, scoped := dm.PartnersFromContext(ctx); scoped {
+			if _, err := m.Device(ctx, id); err != nil {
+				return nil, err
+			}
+		}
+		if service, err = m.ResolveService(service); err != nil {
+			return nil, err
+		}
+		adapter, ok := m.dataModelFor(ctx, service)
+		if !ok {
+			return nil, dm.ErrInvalidParameter
+		}
+		if res, err = adapter.Set(ctx, id, params, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	report := res.DryRun
+	report.Valid = true
+	report.Device = string(runtime.StatusUnknown)
+	if status, ok := m.devices.Statuses()[id]; ok {
+		report.Device = string(status)
+	}
+	switch {
+	case report.Device == string(runtime.StatusOffline):
+		report.Valid, report.Reason = false, "device is offline"
+	case m.breaker.State(id) == dm.BreakerOpen:
+		report.Valid, report.Reason = false, "device circuit breaker is open"
+	}
+	model := m.devices.View().Metadata(string(id))[dm.MetadataModel]
+	for _, p := range params {
+		o := runtime.PredictedOutcome{Name: p.Name, Value: p.Value, DataType: p.TypeHint, Outcome: runtime.OutcomeSet}
+		typ, err := m.catalog.CheckSet(p, model)
+		if typ != "" {
+			o.DataType = typ
+		}
+		switch cached, _, ok := m.params.Get(paramKey(id, service, p.Name)); {
+		case err != nil:
+			o.Outcome, o.Reason = runtime.OutcomeRejected, err.Error()
+			report.Valid = false
+		case ok && p.Value != nil:
+			o.Current, o.Outcome = cached.Value, runtime.OutcomeChange
+			if fmt.Sprint(cached.Value) == fmt.Sprint(p.Value) {
+				o.Outcome = runtime.OutcomeUnchanged
+			}
+		}
+		report.Parameters = append(report.Parameters, o)
+	}
+	return res, nil
+}
@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// enrichedMetadata is the DeviceAdapter's enrichment lookup: the attributes last loaded from
+// Options.Enrichment.Source for id.
+func (m *Manager) enrichedMetadata(id string) map[string]string {
+	if loaded := m.enrichment.Load(); loaded != nil {
+		return (*loaded)[dm.DeviceID(id)]
+	}
+	return nil
+}
+
+// LoadEnrichment reloads Options.Enrichment.Source; devices show the new attributes from the next
+// poll. After a failed load the previous attributes stay in use.
+func (m *Manager) LoadEnrichment(ctx context.Context) error {
+	src := m.opts.Enrichment.Source
+	if src == nil {
+		return nil
+	}
+	attrs, err := src.Load(ctx)
+	if err != nil {
+		return err
+	}
+	loaded := make(map[dm.DeviceID]map[string]string, len(attrs))
+	for id, a := range attrs {
+		clean := make(map[string]string, len(a))
+		for k, v := range a {
+			if k != dm.MetadataPartnerIDs { // partner scoping trusts Talaria alone
+				clean[k] = v
+			}
+		}
+		loaded[id.Canonical()] = clean
+	}
+	m.enrichment.Store(&loaded)
+	return nil
+}
+
+// RunEnrichment reloads Options.Enrichment.Source every Interval until ctx ends, passing failed
+// loads to report; call LoadEnrichment first for the initial load. It returns at once without a
+// source.
+func (m *Manager) RunEnrichment(ctx context.Context, report func(error)) {
+	if m.opts.Enrichment.Source == nil {
+		return
+	}
+	interval := m.opts.Enrichment.Interval
+	if interval <= 0 {
+		interval = dm.DefaultEnrichmentInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := m.LoadEnrichment(ctx); err != nil && ctx.Err() == nil {
+			report(err)
+		}
+	}
+}
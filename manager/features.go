@@ -0,0 +1,75 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/policy"
+)
+
+// Feature fetches an xconf RFC feature.
+func (m *Manager) Feature(ctx context.Context, id string) (*policy.Feature, error) {
+	fa := m.featuresFor(ctx)
+	if fa == nil {
+		return nil, dm.ErrBackendUnavailable
+	}
+	ctx, cancel := withTimeout(ctx, m.opts.PolicyTimeout, dm.DefaultPolicyTimeout)
+	defer cancel()
+	return fa.GetFeature(ctx, id)
+}
+
+// SetFeatureRollout changes the share of the fleet a feature is rolled out to. Lowering it takes
+// the feature away from devices that have it, so confirm must then repeat the feature ID; raising
+// it needs no confirmation.
+func (m *Manager) SetFeatureRollout(ctx context.Context, id string, percentage float64, confirm string) (ft *policy.Feature, err error) {
+	rec := dm.NewAuditRecord(ctx, "feature-rollout", "")
+	rec.Detail = fmt.Sprintf("feature=%s percentage=%v", id, percentage)
+	defer func() { m.auditFleet(rec, err) }()
+	cur, err := m.Feature(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	rec.Detail += fmt.Sprintf(" (was %v)", cur.Percentage)
+	if percentage < cur.Percentage && confirm != id {
+		return nil, fmt.Errorf("lowering the rollout of %s: confirm must repeat the feature ID: %w", id, dm.ErrConfirmationRequired)
+	}
+	ctx, cancel := withTimeout(ctx, m.opts.PolicyTimeout, dm.DefaultPolicyTimeout)
+	defer cancel()
+	return m.featuresFor(ctx).SetRollout(ctx, id, percentage)
+}
+
+// SetFeatureEnabled switches a feature on or off fleet-wide. Switching it off is the kill switch:
+// it takes effect on every device at once, so confirm must repeat the feature ID.
+func (m *Manager) SetFeatureEnabled(ctx context.Context, id string, enabled bool, confirm string) (ft *policy.Feature, err error) {
+	action := "feature-enable"
+	if !enabled {
+		action = "feature-disable"
+	}
+	rec := dm.NewAuditRecord(ctx, action, "")
+	rec.Detail = "feature=" + id
+	defer func() { m.auditFleet(rec, err) }()
+	if !enabled && confirm != id {
+		return nil, fmt.Errorf("disabling %s: confirm must repeat the feature ID: %w", id, dm.ErrConfirmationRequired)
+	}
+	fa := m.featuresFor(ctx)
+	if fa == nil {
+		return nil, dm.ErrBackendUnavailable
+	}
+	ctx, cancel := withTimeout(ctx, m.opts.PolicyTimeout, dm.DefaultPolicyTimeout)
+	defer cancel()
+	return fa.SetEnabled(ctx, id, enabled)
+}
+
+// auditFleet hands a fleet-wide action to Options.Audit. It concerns no single device, so it is
+// not added to an operation history.
+func (m *Manager) auditFleet(rec dm.AuditRecord, err error) {
+	rec = m.redactor.AuditRecord(rec)
+	rec.Err, rec.Duration = err, time.Since(rec.Time)
+	if m.opts.Audit != nil {
+		m.opts.Audit.Audit(rec)
+		return
+	}
+	dm.LogAudit{}.Audit(rec)
+}
@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+type auditLog struct {
+	mu   sync.Mutex
+	recs []dm.AuditRecord
+}
+
+func (a *auditLog) Audit(r dm.AuditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.recs = append(a.recs, r)
+}
+
+func TestManagerFeatureToggles(t *testing.T) {
+	var polls atomic.Int32
+	var mu sync.Mutex
+	doc := map[string]interface{}{"id": "f1", "enable": true, "percentage": 50.0}
+	xconf := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPut {
+			_ = json.NewDecoder(r.Body).Decode(&doc)
+		}
+		_ = json.NewEncoder(w).Encode(doc)
+	}))
+	defer xconf.Close()
+	audit := &auditLog{}
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.XconfAdminBaseURL = xconf.URL
+	opts.Audit = audit
+	m := newTestManager(t, opts)
+	ctx := dm.WithActor(context.Background(), "alice")
+
+	if ft, err := m.SetFeatureRollout(ctx, "f1", 75, ""); err != nil || ft.Percentage != 75 {
+		t.Fatalf("raise rollout: %+v %v", ft, err)
+	}
+	if _, err := m.SetFeatureRollout(ctx, "f1", 5, ""); !errors.Is(err, dm.ErrConfirmationRequired) {
+		t.Fatalf("lower rollout without confirmation: %v", err)
+	}
+	if _, err := m.SetFeatureEnabled(ctx, "f1", false, "f2"); !errors.Is(err, dm.ErrConfirmationRequired) {
+		t.Fatalf("kill switch with the wrong confirmation: %v", err)
+	}
+	if ft, err := m.SetFeatureEnabled(ctx, "f1", false, "f1"); err != nil || ft.Enabled {
+		t.Fatalf("kill switch: %+v %v", ft, err)
+	}
+	if len(audit.recs) != 4 {
+		t.Fatalf("audited %d actions", len(audit.recs))
+	}
+	if r := audit.recs[0]; r.Action != "feature-rollout" || r.Actor != "alice" || r.Detail != "feature=f1 percentage=75 (was 50)" || r.Err != nil {
+		t.Fatalf("rollout record %+v", r)
+	}
+	if r := audit.recs[3]; r.Action != "feature-disable" || r.Err != nil {
+		t.Fatalf("kill switch record %+v", r)
+	}
+}
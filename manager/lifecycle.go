@@ -0,0 +1,123 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// Lifecycle parameters used when Options.Lifecycle leaves them empty.
+const (
+	DefaultRebootParameter       = "Device.X_CISCO_COM_DeviceControl.RebootDevice"
+	DefaultRebootValue           = "Device"
+	DefaultFactoryResetParameter = "Device.X_CISCO_COM_DeviceControl.FactoryReset"
+	DefaultFactoryResetValue     = "Router,Wifi,VoIP,Dect,MoCA"
+)
+
+// PingParameter is read by Ping when the data model path is available.
+const PingParameter = "Device.DeviceInfo.UpTime"
+
+// PingResult reports a successful round trip to a device.
+type PingResult struct {
+	DeviceID dm.DeviceID
+	Via      string // "wdmp" or "rpc"
+	Latency  time.Duration
+	UpTime   interface{} // PingParameter, when read over WDMP
+}
+
+// Reboot asks the device to restart by writing the reboot parameter. While the device is
+// quarantined it fails with dm.ErrQuarantined (see CheckQuarantine), outside its maintenance
+// window with dm.ErrOutsideMaintenanceWindow (see CheckMaintenance), and while another exclusive
+// operation holds the device with a *dm.OperationConflictError (see Exclusive).
+func (m *Manager) Reboot(ctx context.Context, id dm.DeviceID) (err error) {
+	rec := dm.NewAuditRecord(ctx, "reboot", id)
+	defer func() { m.audit(rec, err) }()
+	if err := m.CheckQuarantine(ctx, id); err != nil {
+		return err
+	}
+	if err := m.CheckMaintenance(ctx, id); err != nil {
+		return err
+	}
+	release, err := m.Exclusive(ctx, id, dm.OperationReboot, "")
+	if err != nil {
+		return err
+	}
+	defer release()
+	name, value := orDefault(m.opts.Lifecycle.RebootParameter, DefaultRebootParameter), orDefault(m.opts.Lifecycle.RebootValue, DefaultRebootValue)
+	rec.Detail = name + "=" + value
+	_, err = m.setParameters(ctx, id, "", []dm.SetParameter{{Name: name, Value: value, TypeHint: "string"}}, dm.SetOptions{})
+	return err
+}
+
+// FactoryReset erases the device's configuration. Because it cannot be undone, confirm must repeat
+// the device ID; anything else fails with ErrConfirmationRequired without contacting the device.
+// Like Reboot it is refused while the device is quarantined, outside its maintenance window or
+// while another exclusive operation holds the device.
+func (m *Manager) FactoryReset(ctx context.Context, id dm.DeviceID, confirm string) (err error) {
+	rec := dm.NewAuditRecord(ctx, "factory-reset", id)
+	defer func() { m.audit(rec, err) }()
+	if confirm != string(id) {
+		return fmt.Errorf("factory reset of %s: confirm must repeat the device ID: %w", id, dm.ErrConfirmationRequired)
+	}
+	if err := m.CheckQuarantine(ctx, id); err != nil {
+		return err
+	}
+	if err := m.CheckMaintenance(ctx, id); err != nil {
+		return err
+	}
+	release, err := m.Exclusive(ctx, id, dm.OperationFactoryReset, "")
+	if err != nil {
+		return err
+	}
+	defer release()
+	name, value := orDefault(m.opts.Lifecycle.FactoryResetParameter, DefaultFactoryResetParameter), orDefault(m.opts.Lifecycle.FactoryResetValue, DefaultFactoryResetValue)
+	rec.Detail = name + "=" + value
+	_, err = m.setParameters(ctx, id, "", []dm.SetParameter{{Name: name, Value: value, TypeHint: "string"}}, dm.SetOptions{})
+	return err
+}
+
+// Ping checks that the device answers: an uncached WDMP GET of PingParameter when Tr1d1um is
+// configured, otherwise a "ping" RPC through Blizzard or MQTT.
+func (m *Manager) Ping(ctx context.Context, id dm.DeviceID) (res *PingResult, err error) {
+	rec := dm.NewAuditRecord(ctx, "ping", id)
+	defer func() { m.audit(rec, err) }()
+	start := time.Now()
+	if _, ok := m.dataModelFor(ctx, m.services()[0]); ok {
+		values, err := m.getParameters(ctx, id, "", []string{PingParameter}, false)
+		if err != nil {
+			return nil, err
+		}
+		rec.Detail = "wdmp"
+		return &PingResult{DeviceID: id, Via: "wdmp", Latency: time.Since(start), UpTime: values[PingParameter].Value}, nil
+	}
+	rec.Detail = "rpc"
+	out, err := m.call(ctx, id, "", runtime.BlizzardCall{Method: "ping"}, nil, nil) // not a mutation, so not quarantined
+	if err != nil {
+		return nil, err
+	}
+	if out.Error != nil {
+		return nil, fmt.Errorf("ping rpc: %s", out.Error.Message)
+	}
+	return &PingResult{DeviceID: id, Via: "rpc", Latency: time.Since(start)}, nil
+}
+
+// audit finishes rec with err, adds it to the device's operation history and hands it to
+// Options.Audit.
+func (m *Manager) audit(rec dm.AuditRecord, err error) {
+	rec = m.record(rec, err)
+	if m.opts.Audit != nil {
+		m.opts.Audit.Audit(rec)
+		return
+	}
+	dm.LogAudit{}.Audit(rec)
+}
+
+func orDefault(v, d string) string {
+	if v == "" {
+		return d
+	}
+	return v
+}
@@ -0,0 +1,142 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// Log upload parameters used when Options.Lifecycle leaves them empty.
+const (
+	DefaultLogUploadParameter         = "Device.DeviceInfo.X_RDKCENTRAL-COM_UploadLogsNow"
+	DefaultLogUploadStatusParameter   = "Device.DeviceInfo.X_RDKCENTRAL-COM_UploadStatus"
+	DefaultLogUploadLocationParameter = "Device.DeviceInfo.X_RDKCENTRAL-COM_LogUploadLocation"
+)
+
+// LogUploadMethod is the RPC issued by UploadLogs when no data model path is configured. The
+// device answers once the upload finished with {"location": "...", "status": "..."}.
+const LogUploadMethod = "logs.upload"
+
+// LogUploadOptions bounds UploadLogs.
+type LogUploadOptions struct {
+	PollInterval time.Duration // status reads; default 10s
+	Timeout      time.Duration // default 10m
+}
+
+// LogUpload reports a finished log upload.
+type LogUpload struct {
+	DeviceID   dm.DeviceID `json:"deviceId"`
+	Via        string      `json:"via"` // "wdmp" or "rpc"
+	Status     string      `json:"status"`
+	Location   string      `json:"location,omitempty"`
+	StartedAt  time.Time   `json:"startedAt"`
+	FinishedAt time.Time   `json:"finishedAt"`
+}
+
+// UploadLogs makes the device upload its logs and waits for the upload to finish. With Tr1d1um
+// configured it writes the log upload trigger and polls the status parameter until it reports
+// completion (the location is read alongside); otherwise it issues LogUploadMethod. A reported
+// failure is an error; no completion within the timeout is ErrTimeout. The upload holds the device
+// exclusively (see Exclusive) until it finishes.
+func (m *Manager) UploadLogs(ctx context.Context, id dm.DeviceID, opts LogUploadOptions) (res *LogUpload, err error) {
+	rec := dm.NewAuditRecord(ctx, "log-upload", id)
+	defer func() { m.audit(rec, err) }()
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 10 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Minute
+	}
+	release, err := m.Exclusive(ctx, id, dm.OperationLogUpload, "")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	res = &LogUpload{DeviceID: id, StartedAt: time.Now()}
+	if _, ok := m.dataModelFor(ctx, m.services()[0]); !ok {
+		rec.Detail, res.Via = "rpc", "rpc"
+		if err := m.uploadLogsRPC(ctx, res, opts.Timeout); err != nil {
+			return nil, err
+		}
+		res.FinishedAt = time.Now()
+		return res, nil
+	}
+	lc := m.opts.Lifecycle
+	trigger := orDefault(lc.LogUploadParameter, DefaultLogUploadParameter)
+	status := orDefault(lc.LogUploadStatusParameter, DefaultLogUploadStatusParameter)
+	location := orDefault(lc.LogUploadLocationParameter, DefaultLogUploadLocationParameter)
+	rec.Detail, res.Via = trigger+"=true", "wdmp"
+	// the status still reads "Complete" from an earlier upload until the device picks up the
+	// trigger, so completion counts once the status changed or a new location appeared
+	previous := ""
+	if values, err := m.getParameters(ctx, id, "", []string{location}, false); err == nil && values[location].Value != nil {
+		previous = fmt.Sprint(values[location].Value)
+	}
+	started := false
+	if _, err := m.setParameters(ctx, id, "", []dm.SetParameter{{Name: trigger, Value: true, TypeHint: "boolean"}}, dm.SetOptions{}); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	tick := time.NewTicker(opts.PollInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("log upload on %s: %w", id, dm.ErrTimeout)
+		case <-tick.C:
+		}
+		values, err := m.getParameters(ctx, id, "", []string{status, location}, false)
+		if err != nil {
+			// the device may be busy uploading; keep polling until the deadline
+			continue
+		}
+		res.Status = fmt.Sprint(values[status].Value)
+		switch s := strings.ToLower(res.Status); {
+		case strings.Contains(s, "fail"):
+			if started {
+				return nil, fmt.Errorf("log upload on %s: %s", id, res.Status)
+			}
+		case strings.Contains(s, "complete"), strings.Contains(s, "success"):
+			if v := values[location].Value; v != nil {
+				res.Location = fmt.Sprint(v)
+			}
+			if started || res.Location != previous {
+				res.FinishedAt = time.Now()
+				return res, nil
+			}
+		default:
+			started = true
+		}
+	}
+}
+
+func (m *Manager) uploadLogsRPC(ctx context.Context, res *LogUpload, timeout time.Duration) error {
+	out, err := m.Call(ctx, res.DeviceID, "", runtime.BlizzardCall{Method: LogUploadMethod, Timeout: timeout})
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("log upload on %s: %w", res.DeviceID, dm.ErrTimeout)
+	case err != nil:
+		return err
+	case out.Error != nil:
+		return fmt.Errorf("log upload rpc: %s", out.Error.Message)
+	}
+	var body struct {
+		Location string `json:"location"`
+		URL      string `json:"url"`
+		Status   string `json:"status"`
+	}
+	if len(out.Result) > 0 {
+		if err := json.Unmarshal(out.Result, &body); err != nil {
+			return fmt.Errorf("log upload rpc result: %w", err)
+		}
+	}
+	res.Location, res.Status = orDefault(body.Location, body.URL), orDefault(body.Status, "Complete")
+	return nil
+}
@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// MaintenanceWindow returns the window that applies to the device under Options.Maintenance, or
+// nil when the device is unrestricted.
+func (m *Manager) MaintenanceWindow(ctx context.Context, id dm.DeviceID) (*dm.MaintenanceWindow, error) {
+	cfg := m.opts.Maintenance
+	if w, ok := cfg.Devices[id]; ok {
+		return &w, nil
+	}
+	if cfg.Lookup == nil && len(cfg.Groups) == 0 {
+		return cfg.Default, nil
+	}
+	d, err := m.Device(ctx, id)
+	switch {
+	case errors.Is(err, dm.ErrDeviceNotFound):
+		// offline devices are still subject to their group's window once known; without
+		// metadata only the default applies
+		d = dm.DeviceState{ID: id}
+	case err != nil:
+		return nil, err
+	}
+	if cfg.Lookup != nil {
+		w, ok, err := cfg.Lookup(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &w, nil
+		}
+	}
+	for _, g := range dm.SplitPartners(d.Metadata[m.groupMetadata()]) {
+		if w, ok := cfg.Groups[g]; ok {
+			return &w, nil
+		}
+	}
+	return cfg.Default, nil
+}
+
+// CheckMaintenance returns nil when a disruptive operation may run on the device now: the device
+// has no window, its window is open, or ctx carries dm.WithMaintenanceOverride from a caller allowed
+// to override (dm.OverrideAllowed; dm.ErrAccessDenied otherwise). Otherwise it returns a
+// *dm.MaintenanceWindowError (matching dm.ErrOutsideMaintenanceWindow) naming the next opening.
+func (m *Manager) CheckMaintenance(ctx context.Context, id dm.DeviceID) error {
+	if dm.MaintenanceOverridden(ctx) {
+		if !dm.OverrideAllowed(ctx) {
+			return fmt.Errorf("maintenance override requires the %s role: %w", dm.RoleAdmin, dm.ErrAccessDenied)
+		}
+		return nil
+	}
+	w, err := m.MaintenanceWindow(ctx, id)
+	if err != nil || w == nil {
+		return err
+	}
+	if now := time.Now(); !w.Contains(now) {
+		return &dm.MaintenanceWindowError{DeviceID: id, Next: w.Next(now)}
+	}
+	return nil
+}
+
+// groupMetadata is the device metadata entry naming a device's groups, for maintenance windows
+// and quarantines.
+func (m *Manager) groupMetadata() string {
+	if key := m.opts.Maintenance.GroupMetadata; key != "" {
+		return key
+	}
+	return dm.MetadataPartnerIDs
+}
@@ -0,0 +1,1238 @@
+package manager
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/cache"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+	"github.com/xmidt-org/talaria/devicemgr/faults"
+	"github.com/xmidt-org/talaria/devicemgr/metrics"
+	"github.com/xmidt-org/talaria/devicemgr/mqtt"
+	"github.com/xmidt-org/talaria/devicemgr/policy"
+	"github.com/xmidt-org/talaria/devicemgr/redisstore"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+	"github.com/xmidt-org/talaria/devicemgr/schema"
+	"github.com/xmidt-org/talaria/devicemgr/translate"
+)
+
+// DefaultService is the translation service used when Options.Services is empty.
+const DefaultService = "config"
+
+// DefaultRPCService is the Blizzard service addressed when Call is given no service.
+const DefaultRPCService = "blizzard"
+
+// ModelParameter is the TR-181 parameter consulted when a caller needs a device model
+// (e.g. firmware resolution) and did not supply one.
+const ModelParameter = "Device.DeviceInfo.ModelName"
+
+// Manager composes the runtime and policy adapters behind a single facade and fronts
+// parameter / policy reads with the TTL caches configured in Options.Cache.
+type Manager struct {
+	opts dm.Options
+	auth map[string]*dm.ReloadableAuth // every credential in opts, rotated by Reload
+
+	mu sync.RWMutex // guards opts.Services and the data model adapters, which Reload replaces
+
+	transport *http.Transport  // Options.HTTP; shared by every backend client
+	faults    *faults.Injector // Options.Faults; nil unless enabled
+
+	devices   *runtime.DeviceAdapter
+	dataModel map[string]*runtime.DataModelAdapter // keyed by translation service
+	xconf     *xconfAdapters                       // nil without XconfAdminBaseURL
+
+	// per-partner adapters built from Options.Partners credentials
+	partnerDataModel map[string]map[string]*runtime.DataModelAdapter
+	partnerXconf     map[string]*xconfAdapters
+
+	breaker *dm.Breaker // Options.Breaker, per device
+
+	catalog    dm.ParameterCatalog // Options.Catalog, checking dry-run SETs
+	operations dm.OperationLog     // Options.Operations, for Operations
+	locks      dm.LockStore        // Options.Locks, for AcquireLock
+
+	enrichment atomic.Pointer[map[dm.DeviceID]map[string]string] // last LoadEnrichment result
+
+	params   cache.Cache[dm.ParameterValue]
+	policies cache.Cache[*policy.FirmwarePolicy]
+	configs  cache.Cache[ConfigDocument] // GetConfig, by configuration CID
+
+	// shared state (Cache.RedisURL); nil when running standalone
+	rdb     *redis.Client
+	elector dm.Elector
+
+	mqtt       *runtime.MQTTAdapter // Options.MQTT; nil when no broker is configured
+	mqttClient *mqtt.Client
+
+	usp   *runtime.USPAdapter   // Options.USP; nil when no controller endpoint ID is configured
+	uspWS *runtime.WebSocketMTP // agent-facing WebSocket MTP, when USP does not use MQTT
+
+	traps    *runtime.TrapAdapter     // Options.Traps; nil unless enabled
+	caduceus *runtime.CaduceusAdapter // Options.Caduceus; nil when no URL is configured
+
+	router *runtime.TalariaRouter // Options.Routing; nil unless enabled
+
+	metrics     *metrics.Registry
+	opDuration  *metrics.HistogramVec
+	partnerTags *metrics.Limiter // Options.Metrics bounds on the partner and model labels
+	modelTags   *metrics.Limiter
+
+	bus       *events.Bus           // every device source, sequenced and deduplicated
+	redactor  *dm.Redactor          // Options.Redaction, applied to bus events and audit records
+	pipeline  *events.Pipeline      // Options.Events.Pipeline, applied to bus events
+	paramACL  *dm.ParameterACL      // Options.ParameterACL
+	codex     *runtime.CodexAdapter // Options.CodexBaseURL; nil when unset
+	recent    *events.Ring          // events seen by this process, for History
+	recentSub dm.EventSubscription
+
+	journal    *events.Journal // connectivity events in bus order, for Changes
+	journalSub dm.EventSubscription
+	epoch      string // tells this process's change cursors apart from another's
+
+	statsHistory   statsHistory   // fleet samples per poll, for StatsHistory
+	talariaHistory talariaHistory // per-instance device counts, for TalariaStats
+
+	pollMu      sync.Mutex // guards the outcome of the latest Poll, for Stats
+	lastPoll    time.Time
+	lastPollErr error
+	pollResume  time.Time // set from a Retry-After in a poll failure; Poll skips Talaria until then
+
+	watchMu    sync.Mutex
+	watches    map[dm.DeviceID][]*ParamSubscription // ParamWatch, by device
+	watchSub   dm.EventSubscription
+	durable    map[string]*durableWatch // RegisterWatch, by registration ID
+	watchStore dm.SubscriptionStore     // SetWatchStore
+
+	quarantineMu    sync.Mutex
+	quarantines     map[string]dm.Quarantine // by dm.QuarantineID
+	quarantineStore dm.SubscriptionStore     // SetQuarantineStore
+
+	sessionMu sync.Mutex
+	sessions  map[string]*rpcSession // OpenSession, by token
+
+	callMu sync.Mutex
+	calls  map[callKey]*inflightCall // RPCs in flight, for CancelCall
+
+	opMu sync.Mutex
+	ops  map[dm.DeviceID]*heldOperation // exclusive operations, for Exclusive
+
+	versionMu sync.Mutex
+	versions  map[dm.DeviceID]probedVersion // DataModelVersion probe results
+}
+
+// New builds a Manager from Options. TalariaBaseURL is required; the data model and
+// policy adapters are only created when their base URLs are configured.
+func New(opts dm.Options) (*Manager, error) {
+	if opts.TalariaBaseURL == "" {
+		return nil, errors.New("TalariaBaseURL required")
+	}
+	if err := opts.Maintenance.Validate(); err != nil {
+		return nil, fmt.Errorf("maintenance: %w", err)
+	}
+	injector, err := faults.New(opts.Faults)
+	if err != nil {
+		return nil, fmt.Errorf("faults: %w", err)
+	}
+	auth := wrapAuth(&opts)
+	m := &Manager{
+		opts:             opts,
+		auth:             auth,
+		transport:        runtime.NewTransport(opts.HTTP),
+		faults:           injector,
+		breaker:          dm.NewBreaker(opts.Breaker),
+		catalog:          opts.Catalog,
+		operations:       opts.Operations,
+		locks:            opts.Locks,
+		devices:          runtime.NewDeviceAdapter(opts.TalariaBaseURL, opts.Auth.Talaria),
+		partnerDataModel: make(map[string]map[string]*runtime.DataModelAdapter),
+		partnerXconf:     make(map[string]*xconfAdapters),
+		params:           cache.NewTTL[dm.ParameterValue](opts.Cache.ParamTTL),
+		policies:         cache.NewTTL[*policy.FirmwarePolicy](opts.Cache.PolicyTTL),
+		configs:          cache.NewTTL[ConfigDocument](opts.Cache.ConfigTTL),
+		watches:          make(map[dm.DeviceID][]*ParamSubscription),
+		metrics:          metrics.NewRegistry(),
+		partnerTags:      metrics.NewLimiter(opts.Metrics.LabelLimit),
+		modelTags:        metrics.NewLimiter(opts.Metrics.LabelLimit),
+	}
+	if m.catalog == nil {
+		m.catalog = schema.Default()
+	}
+	m.opDuration = m.metrics.Histogram("devicemgr_device_operation_duration_seconds",
+		"Duration of device parameter reads, writes and RPCs.", metrics.DefBuckets, "operation", "partner", "model", "outcome")
+	m.devices.SetHTTPClient(m.client(10 * time.Second))
+	m.devices.SetRetryPolicy(opts.Retry)
+	m.devices.SetStateConfig(runtime.StateMachineConfig{OfflineAfter: opts.Polling.OfflineAfter}, opts.Polling.StatSuspects)
+	hasher := opts.Sharding
+	if hasher == nil {
+		hasher = dm.ConsistentHasher{}
+	}
+	if len(opts.Polling.Instances) > 0 {
+		m.devices.SetInstances(opts.Polling.Instances)
+		m.devices.SetShardHasher(hasher)
+	}
+	if opts.Enrichment.Source != nil {
+		m.devices.SetEnrichment(m.enrichedMetadata)
+	}
+	if opts.Elector != nil && opts.Cache.RedisURL == "" {
+		return nil, errors.New("Elector requires Cache.RedisURL for followers to read shared state")
+	}
+	if opts.Cache.RedisURL != "" {
+		if err = m.useRedis(); err != nil {
+			return nil, err
+		}
+	}
+	if m.operations == nil {
+		m.operations = dm.NewMemoryOperationLog(0)
+	}
+	if m.locks == nil {
+		m.locks = dm.NewMemoryLockStore()
+	}
+	if m.dataModel, err = m.buildDataModel(opts.Auth.Tr1d1um, m.services()); err != nil {
+		return nil, err
+	}
+	m.xconf = m.buildXconf(opts.Auth.XconfAdmin)
+	if opts.MQTT.Broker != "" {
+		if err = m.useMQTT(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.USP.EndpointID != "" {
+		if err = m.useUSP(); err != nil {
+			return nil, err
+		}
+	}
+	for partner, po := range m.opts.Partners {
+		if po.Auth.Tr1d1um != nil {
+			if m.partnerDataModel[partner], err = m.buildDataModel(po.Auth.Tr1d1um, m.services()); err != nil {
+				return nil, err
+			}
+		}
+		if x := m.buildXconf(po.Auth.XconfAdmin); po.Auth.XconfAdmin != nil && x != nil {
+			m.partnerXconf[partner] = x
+		}
+	}
+	if opts.Traps.Enabled {
+		m.traps = runtime.NewTrapAdapter(opts.Traps)
+	}
+	if c := opts.Caduceus; c.URL != "" {
+		m.caduceus, err = runtime.NewCaduceusAdapter(runtime.CaduceusOptions{
+			BaseURL: c.URL, CallbackURL: c.CallbackURL, Secret: c.Secret, Events: c.Events, Duration: c.Duration,
+			Auth: opts.Auth.Caduceus, Client: m.client(10 * time.Second), Retry: opts.Retry,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rc := opts.Routing; rc.Enabled {
+		ro := runtime.RouterOptions{
+			TalariaURL: opts.TalariaBaseURL, PetasosURL: rc.PetasosURL, Auth: opts.Auth.Talaria,
+			Client: m.client(10 * time.Second), Retry: opts.Retry,
+			TTL: rc.TTL, Failures: rc.Failures, Cooldown: rc.Cooldown,
+		}
+		if rc.Predict {
+			if len(opts.Polling.Instances) == 0 {
+				return nil, errors.New("Routing.Predict requires Polling.Instances")
+			}
+			instances := make([]string, len(opts.Polling.Instances))
+			for i, u := range opts.Polling.Instances {
+				instances[i] = strings.TrimRight(u, "/")
+			}
+			ro.Placement = hasher.Ring(instances)
+		}
+		m.router, err = runtime.NewTalariaRouter(ro)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.CodexBaseURL != "" {
+		m.codex = runtime.NewCodexAdapter(opts.CodexBaseURL, opts.Auth.Codex)
+		m.codex.SetHTTPClient(m.client(10 * time.Second))
+		m.codex.SetRetryPolicy(opts.Retry)
+	}
+	m.redactor = dm.NewRedactor(opts.Redaction)
+	m.paramACL = dm.NewParameterACL(opts.ParameterACL)
+	if m.pipeline, err = events.NewPipeline(opts.Events.Pipeline, func(id dm.DeviceID) map[string]string { return m.devices.Metadata(string(id)) }); err != nil {
+		return nil, err
+	}
+	m.startBus()
+	m.recent = events.NewRing(events.DefaultRingSize)
+	m.recentSub = m.Subscribe(256)
+	go m.recent.Run(m.recentSub)
+	m.startJournal()
+	m.statsHistory.retention = opts.StatsRetention
+	m.watchSub = m.Subscribe(256)
+	go m.runParamWatches(m.watchSub)
+	return m, nil
+}
+
+// useRedis switches caches and the device snapshot to Redis and enables leader election, using a
+// Redis lock unless Options.Elector is set.
+func (m *Manager) useRedis() error {
+	rdb, err := redisstore.Open(m.opts.Cache.RedisURL)
+	if err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+	prefix := m.opts.Cache.RedisPrefix
+	m.rdb = rdb
+	m.params = redisstore.NewCache[dm.ParameterValue](rdb, prefix, "params", m.opts.Cache.ParamTTL)
+	m.policies = redisstore.NewCache[*policy.FirmwarePolicy](rdb, prefix, "policies", m.opts.Cache.PolicyTTL)
+	m.configs = redisstore.NewCache[ConfigDocument](rdb, prefix, "configs", m.opts.Cache.ConfigTTL)
+	m.devices.SetSnapshotStore(redisstore.NewSnapshotStore(rdb, prefix))
+	if m.operations == nil {
+		m.operations = redisstore.NewOperationLog(rdb, prefix, 0)
+	}
+	if m.locks == nil {
+		m.locks = redisstore.NewLockStore(rdb, prefix)
+	}
+	if m.opts.Elector != nil {
+		m.elector = m.opts.Elector
+		return nil
+	}
+	host, _ := os.Hostname()
+	m.elector = redisstore.NewLock(rdb, prefix, "poll", host+"-"+uuid.NewString(), m.opts.Polling.Lease())
+	return nil
+}
+
+// useMQTT connects to the MQTT broker and subscribes to device event and RPC response topics.
+func (m *Manager) useMQTT() error {
+	c := m.opts.MQTT
+	if c.ClientID == "" {
+		host, _ := os.Hostname()
+		c.ClientID = "devicemgr-" + host
+	}
+	tc, err := mqttTLS(c)
+	if err != nil {
+		return fmt.Errorf("mqtt tls: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mqtt.Dial(ctx, mqtt.Config{Broker: c.Broker, ClientID: c.ClientID, Username: c.Username, Password: c.Password, TLS: tc})
+	if err != nil {
+		return fmt.Errorf("mqtt: %w", err)
+	}
+	m.mqtt, err = runtime.NewMQTTAdapter(ctx, runtime.MQTTOptions{Client: client, EventTopic: c.EventTopic, RPCTopic: c.RPCTopic, ResponseTopic: c.ResponseTopic, QoS: c.QoS})
+	if err != nil {
+		client.Close()
+		return fmt.Errorf("mqtt: %w", err)
+	}
+	m.mqttClient = client
+	return nil
+}
+
+func mqttTLS(c dm.MQTTConfig) (*tls.Config, error) {
+	tc := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates", c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// RunPolling polls every interval (Options.Polling.DeviceList when not positive) until ctx is
+// done, reporting failed polls. A positive duration received on intervals, as after a config
+// reload, becomes the new interval. A poll may not outlast its interval.
+func (m *Manager) RunPolling(ctx context.Context, interval time.Duration, intervals <-chan time.Duration, report func(error)) {
+	if interval <= 0 {
+		interval = m.opts.Polling.DeviceList
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case d := <-intervals:
+			if d > 0 && d != interval {
+				interval = d
+				ticker.Reset(d)
+			}
+		case <-ticker.C:
+			pollCtx, cancel := context.WithTimeout(ctx, interval)
+			if _, err := m.Poll(pollCtx); err != nil && report != nil {
+				report(err)
+			}
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Poll refreshes the device snapshot. With an elector only the leader queries Talaria; other
+// replicas load the snapshot it publishes. If the election cannot be checked the replica polls
+// directly, trading duplicate backend load for freshness while the coordinator is unavailable.
+// After a failure carrying a Retry-After, Poll returns ErrBackendUnavailable without contacting
+// Talaria until the requested wait has passed.
+func (m *Manager) Poll(ctx context.Context) (ids []string, err error) {
+	m.pollMu.Lock()
+	resume := m.pollResume
+	m.pollMu.Unlock()
+	if wait := time.Until(resume); wait > 0 {
+		return nil, fmt.Errorf("poll deferred for %s by Retry-After: %w", wait.Round(time.Millisecond), dm.ErrBackendUnavailable)
+	}
+	defer func() {
+		m.pollMu.Lock()
+		m.lastPoll, m.lastPollErr = time.Now(), err
+		if after, ok := dm.RetryAfter(err); ok {
+			m.pollResume = m.lastPoll.Add(after)
+		}
+		m.pollMu.Unlock()
+		if err == nil {
+			m.recordStats()
+			m.recordTalaria()
+		}
+	}()
+	if m.elector == nil {
+		return m.devices.PollOnce(ctx)
+	}
+	leader, err := m.elector.Campaign(ctx)
+	if err != nil || leader {
+		return m.devices.PollOnce(ctx)
+	}
+	return m.devices.RefreshFromStore(ctx)
+}
+
+// Redis returns the shared-state client so other stores can reuse it; nil when running standalone.
+func (m *Manager) Redis() *redis.Client { return m.rdb }
+
+// Subscribe returns events from every device source: Talaria polling plus, when configured, the
+// MQTT event topics and USP agent notifications. Events are sequenced and deduplicated across
+// sources as described on events.Bus.
+func (m *Manager) Subscribe(buffer int) dm.EventSubscription {
+	return m.bus.Subscribe(buffer)
+}
+
+// SubscribeAcked is Subscribe for consumers that must not lose events: up to buffer events are
+// held until acknowledged (see events.Bus.SubscribeAcked).
+func (m *Manager) SubscribeAcked(buffer int) *events.AckedSubscription {
+	return m.bus.SubscribeAcked(buffer)
+}
+
+// startBus subscribes the event bus to each configured device source.
+func (m *Manager) startBus() {
+	const buffer = 1024
+	subs := []dm.EventSubscription{m.devices.Subscribe(buffer)}
+	if m.mqtt != nil {
+		subs = append(subs, m.mqtt.Subscribe(buffer))
+	}
+	if m.usp != nil {
+		subs = append(subs, m.usp.Subscribe(buffer))
+	}
+	if m.traps != nil {
+		subs = append(subs, m.traps.Subscribe(buffer))
+	}
+	if m.caduceus != nil {
+		subs = append(subs, m.caduceus.Subscribe(buffer))
+	}
+	m.bus = events.NewBus(events.BusConfig{DedupWindow: m.opts.Events.DedupWindow, Redactor: m.redactor, Pipeline: m.pipeline}, subs...)
+}
+
+// Emit publishes an event raised by devicemgr itself (e.g. a drift event) to every subscriber.
+func (m *Manager) Emit(e dm.Event) { m.bus.Publish(e) }
+
+// TrapHandler accepts trap posts from a forwarder (see runtime.TrapAdapter); nil unless
+// Options.Traps is enabled. Like USPHandler it is served on a listener of its own.
+func (m *Manager) TrapHandler() http.Handler {
+	if m.traps == nil {
+		return nil
+	}
+	return m.traps
+}
+
+// CaduceusHandler accepts Caduceus webhook deliveries; nil unless Options.Caduceus is configured.
+// Serve it at Options.Caduceus.CallbackURL.
+func (m *Manager) CaduceusHandler() http.Handler {
+	if m.caduceus == nil {
+		return nil
+	}
+	return m.caduceus
+}
+
+// RunCaduceus keeps the Caduceus webhook registered until ctx ends, passing failed registrations
+// to report. It returns at once when Caduceus is not configured.
+func (m *Manager) RunCaduceus(ctx context.Context, report func(error)) {
+	if m.caduceus != nil {
+		m.caduceus.Run(ctx, report)
+	}
+}
+
+// Close resigns leadership and releases shared-state and broker connections.
+func (m *Manager) Close() error {
+	_ = m.recentSub.Close()
+	_ = m.journalSub.Close()
+	_ = m.watchSub.Close()
+	m.closeSessions()
+	_ = m.bus.Close()
+	if m.usp != nil {
+		_ = m.usp.Close()
+	}
+	if m.mqtt != nil {
+		_ = m.mqtt.Close()
+	}
+	if m.rdb == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = m.elector.Resign(ctx)
+	return m.rdb.Close()
+}
+
+func (m *Manager) buildDataModel(auth dm.AuthStrategy, services []string) (map[string]*runtime.DataModelAdapter, error) {
+	out := make(map[string]*runtime.DataModelAdapter)
+	if m.opts.Tr1d1umBaseURL == "" {
+		return out, nil
+	}
+	for _, svc := range services {
+		a, err := runtime.NewDataModelAdapter(runtime.DataModelOptions{BaseURL: m.opts.Tr1d1umBaseURL, Service: svc, Auth: auth, Client: m.client(0), Retry: m.opts.Retry, MaxGetNames: m.opts.MaxGetNames})
+		if err != nil {
+			return nil, err
+		}
+		out[svc] = a
+	}
+	return out, nil
+}
+
+// client returns a client on the shared transport, through the fault injector when one is enabled
+// and logging requests with Options.Verbose.
+func (m *Manager) client(timeout time.Duration) *http.Client {
+	c := runtime.NewClient(m.transport, timeout)
+	c.Transport = m.faults.Transport(c.Transport)
+	if m.opts.Verbose {
+		c.Transport = runtime.LogRequests(c.Transport, log.Printf)
+	}
+	return c
+}
+
+// blizzard returns an unconnected Blizzard adapter for a device service behind the gateway at
+// base, dialing through the shared TLS session cache.
+func (m *Manager) blizzard(base string, id dm.DeviceID, service string) *runtime.BlizzardAdapter {
+	b := runtime.NewBlizzardAdapter(base, string(id), service, m.opts.Auth.Blizzard)
+	b.SetDialer(runtime.NewDialer(m.transport))
+	if m.faults != nil {
+		b.SetFrameFilter(m.faults.Frame)
+	}
+	b.SetRetryPolicy(m.opts.Retry)
+	return b
+}
+
+// dialBlizzard connects a Blizzard adapter for a device service. With Options.Routing it first
+// dials the gateway on the Talaria instance holding the device, recording the outcome for that
+// instance, and falls back to BlizzardBaseURL when the device cannot be routed or the dial fails.
+func (m *Manager) dialBlizzard(ctx context.Context, id dm.DeviceID, service string) (*runtime.BlizzardAdapter, error) {
+	base := strings.TrimRight(m.opts.BlizzardBaseURL, "/")
+	if m.router != nil {
+		if target, instance := m.router.Route(ctx, id, base); instance != "" {
+			b := m.blizzard(target, id, service)
+			err := b.Connect(ctx)
+			m.router.Record(id, instance, err)
+			if err == nil {
+				return b, nil
+			}
+			if ctx.Err() != nil {
+				return nil, err
+			}
+		}
+	}
+	b := m.blizzard(base, id, service)
+	if err := b.Connect(ctx); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// dataModelFor picks the adapter for service using the credentials of the first partner in the
+// caller's scope that has overrides configured, falling back to the default credentials.
+func (m *Manager) dataModelFor(ctx context.Context, service string) (*runtime.DataModelAdapter, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if scope, ok := dm.PartnersFromContext(ctx); ok {
+		for _, p := range scope {
+			if byService, ok := m.partnerDataModel[p]; ok {
+				a, ok := byService[service]
+				return a, ok
+			}
+		}
+	}
+	a, ok := m.dataModel[service]
+	return a, ok
+}
+
+func (m *Manager) services() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.opts.Services) == 0 {
+		return []string{DefaultService}
+	}
+	return m.opts.Services
+}
+
+// Services returns the translation services requests may name: Options.Services, or
+// DefaultService alone when none are configured. The first is used when a request names none.
+func (m *Manager) Services() []string { return slices.Clone(m.services()) }
+
+// ResolveService returns service, or the default service when it is empty, failing with
+// ErrInvalidParameter (listing the allowed services) when it is not in Options.Services.
+func (m *Manager) ResolveService(service string) (string, error) {
+	allowed := m.services()
+	if service == "" {
+		return allowed[0], nil
+	}
+	if !slices.Contains(allowed, service) {
+		return "", fmt.Errorf("service %q is not one of %s: %w", service, strings.Join(allowed, ", "), dm.ErrInvalidParameter)
+	}
+	return service, nil
+}
+
+// DeviceAdapter exposes the underlying Talaria poller (used by the discovery server and polling loop).
+func (m *Manager) DeviceAdapter() *runtime.DeviceAdapter { return m.devices }
+
+// ListDevices returns the devices in the latest poll snapshot visible to the caller's partner scope, sorted by ID.
+func (m *Manager) ListDevices(ctx context.Context) []dm.DeviceState {
+	view := m.devices.View()
+	out := make([]dm.DeviceState, 0, view.Len())
+	for _, id := range view.IDs() {
+		if st := m.deviceState(id); visible(ctx, st) {
+			out = append(out, st)
+		}
+	}
+	return out
+}
+
+// QueryDevices lists the devices visible to the caller that match query, in the syntax of
+// runtime.ParseDeviceQuery; an empty query matches every device.
+func (m *Manager) QueryDevices(ctx context.Context, query string) ([]dm.DeviceState, error) {
+	if strings.TrimSpace(query) == "" {
+		return m.ListDevices(ctx), nil
+	}
+	q, err := runtime.ParseDeviceQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := m.devices.Search(q)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]dm.DeviceState, 0, len(ids))
+	for _, id := range ids {
+		if st := m.deviceState(id); visible(ctx, st) {
+			out = append(out, st)
+		}
+	}
+	return out, nil
+}
+
+// Device returns the state of a single device from the latest snapshot. Devices outside the
+// caller's partner scope report ErrDeviceNotFound so their existence is not disclosed.
+func (m *Manager) Device(ctx context.Context, id dm.DeviceID) (dm.DeviceState, error) {
+	id = id.Canonical()
+	if m.devices.View().Has(string(id)) {
+		if st := m.deviceState(string(id)); visible(ctx, st) {
+			return st, nil
+		}
+	}
+	return dm.DeviceState{}, dm.ErrDeviceNotFound
+}
+
+// ConnectionStats reads a device's connection statistics from Talaria. Devices outside the
+// caller's partner scope report ErrDeviceNotFound.
+func (m *Manager) ConnectionStats(ctx context.Context, id dm.DeviceID) (runtime.DeviceStatistics, error) {
+	id = id.Canonical()
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		if _, err := m.Device(ctx, id); err != nil {
+			return runtime.DeviceStatistics{}, err
+		}
+	}
+	return m.devices.Statistics(ctx, string(id))
+}
+
+// deviceState maps a polled ID to DeviceState; presence in the Talaria list implies online.
+func (m *Manager) deviceState(id string) dm.DeviceState {
+	return dm.DeviceState{ID: dm.DeviceID(id), Online: true, Metadata: m.devices.Metadata(id), Freshness: dm.FreshRecentCache, Source: "synthetic-poll"}
+}
+
+func visible(ctx context.Context, st dm.DeviceState) bool {
+	scope, ok := dm.PartnersFromContext(ctx)
+	if !ok {
+		return true
+	}
+	return dm.PartnerAllowed(scope, dm.SplitPartners(st.Metadata[dm.MetadataPartnerIDs]))
+}
+
+// GetParameters reads names from a device through the translation service (empty selects the default),
+// serving entries from the parameter cache when still within Cache.ParamTTL. Names the caller's
+// role may not read under Options.ParameterACL fail with ErrAccessDenied before the device is
+// contacted. Values carry the catalog's unit and enum label (see dm.ParameterDescriber).
+func (m *Manager) GetParameters(ctx context.Context, id dm.DeviceID, service string, names []string) (map[string]dm.ParameterValue, error) {
+	return m.readParameters(ctx, id, service, names, true)
+}
+
+// RefreshParameters is GetParameters without cache reads: every name (including partial paths such as
+// "Device.WiFi.") is fetched from the device, and the cache is updated with the results.
+func (m *Manager) RefreshParameters(ctx context.Context, id dm.DeviceID, service string, names []string) (map[string]dm.ParameterValue, error) {
+	return m.readParameters(ctx, id, service, names, false)
+}
+
+// readParameters is getParameters for the caller's own reads, checked against Options.ParameterACL
+// and labeled from the catalog.
+func (m *Manager) readParameters(ctx context.Context, id dm.DeviceID, service string, names []string, cached bool) (map[string]dm.ParameterValue, error) {
+	if err := m.paramACL.Check(ctx, dm.ParameterRead, names...); err != nil {
+		return nil, err
+	}
+	values, err := m.getParameters(ctx, id, service, names, cached)
+	if err != nil {
+		return nil, err
+	}
+	return m.describe(m.readable(ctx, values)), nil
+}
+
+// readable drops the values of a partial-path read that the caller's role may not see.
+func (m *Manager) readable(ctx context.Context, values map[string]dm.ParameterValue) map[string]dm.ParameterValue {
+	for name := range values {
+		if !m.paramACL.Allowed(ctx, dm.ParameterRead, name) {
+			delete(values, name)
+		}
+	}
+	return values
+}
+
+func (m *Manager) getParameters(ctx context.Context, id dm.DeviceID, service string, names []string, cached bool) (map[string]dm.ParameterValue, error) {
+	id = id.Canonical()
+	var adapter interface {
+		Get(ctx context.Context, id dm.DeviceID, names []string, opts dm.GetOptions) (*runtime.GetResult, error)
+	}
+	if agent, err := m.uspAgent(ctx, id); err != nil {
+		return nil, err
+	} else if agent {
+		service, adapter = uspService, uspGetter{m.usp}
+	} else {
+		if _, scoped := dm.PartnersFromContext(ctx); scoped {
+			if _, err := m.Device(ctx, id); err != nil {
+				return nil, err
+			}
+		}
+		if service, err = m.ResolveService(service); err != nil {
+			return nil, err
+		}
+		a, ok := m.dataModelFor(ctx, service)
+		if !ok {
+			return nil, dm.ErrInvalidParameter
+		}
+		adapter = a
+	}
+	out := make(map[string]dm.ParameterValue, len(names))
+	var missing []string
+	for _, name := range names {
+		if cached {
+			if v, _, ok := m.params.Get(paramKey(id, service, name)); ok {
+				out[name] = v
+				continue
+			}
+		}
+		missing = append(missing, name)
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+	paths, err := m.pathsFor(ctx, id, missing)
+	if err != nil {
+		return nil, err
+	}
+	sent := make([]string, len(missing))
+	for i, name := range missing {
+		sent[i] = paths.device(name)
+	}
+	rec := dm.NewAuditRecord(ctx, "get", id)
+	rec.Detail = strings.Join(missing, ",")
+	done, err := m.guard(ctx, id, "get")
+	if err != nil {
+		m.record(rec, err)
+		return nil, err
+	}
+	ctx, cancel := withTimeout(ctx, m.opts.GetTimeout, dm.DefaultGetTimeout)
+	defer cancel()
+	res, err := adapter.Get(ctx, id, sent, dm.GetOptions{Names: sent})
+	done(err)
+	m.record(rec, err)
+	if err != nil {
+		return nil, err
+	}
+	for name, v := range res.Values {
+		if c := paths.canonical(name); c != name {
+			name, v.Name = c, c
+		}
+		m.params.Set(paramKey(id, service, name), v)
+		out[name] = v
+	}
+	return out, nil
+}
+
+// SetParameters applies params to a device through the translation service (empty selects the default)
+// and evicts the written names from the parameter cache. Names the caller's role may not write
+// under Options.ParameterACL fail with ErrAccessDenied, and values outside their parameter's
+// catalog enumeration with ErrInvalidParameter, before the request is built. Writes to a
+// quarantined device, other than dry runs, fail with dm.ErrQuarantined (see CheckQuarantine),
+// and writes to a device another owner locked with a *dm.LockHeldError (see AcquireLock).
+func (m *Manager) SetParameters(ctx context.Context, id dm.DeviceID, service string, params []dm.SetParameter, opts dm.SetOptions) (*runtime.SetResult, error) {
+	for _, p := range params {
+		if err := m.paramACL.Check(ctx, dm.ParameterWrite, p.Name); err != nil {
+			return nil, err
+		}
+	}
+	return m.setParameters(ctx, id, service, params, opts)
+}
+
+// setParameters is SetParameters without the ACL, for writes that are part of an operation with
+// its own authorization, such as a reboot.
+func (m *Manager) setParameters(ctx context.Context, id dm.DeviceID, service string, params []dm.SetParameter, opts dm.SetOptions) (*runtime.SetResult, error) {
+	id = id.Canonical()
+	caller := ctx // the breaker tells the caller's deadline from SetTimeout
+	ctx, cancel := withTimeout(ctx, m.opts.SetTimeout, dm.DefaultSetTimeout)
+	defer cancel()
+	if opts.DryRun {
+		return m.dryRunSet(ctx, id, service, params, opts)
+	}
+	// devices outside the caller's partners are not found, whatever quarantines or locks hold them
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		if _, err := m.Device(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.CheckQuarantine(caller, id); err != nil {
+		return nil, err
+	}
+	if err := m.checkLock(caller, id); err != nil {
+		return nil, err
+	}
+	if err := m.checkEnums(params); err != nil {
+		return nil, err
+	}
+	paths, err := m.pathsFor(ctx, id, setNames(params))
+	if err != nil {
+		return nil, err
+	}
+	sent := params
+	if paths.r != nil {
+		sent = make([]dm.SetParameter, len(params))
+		for i, p := range params {
+			sent[i] = p
+			sent[i].Name = paths.device(p.Name)
+		}
+	}
+	if agent, err := m.uspAgent(ctx, id); err != nil {
+		return nil, err
+	} else if agent {
+		rec := setRecord(caller, id, params)
+		done, err := m.guard(caller, id, "set")
+		if err != nil {
+			m.record(rec, err)
+			return nil, err
+		}
+		res, err := m.usp.Set(ctx, id, sent, opts)
+		done(err)
+		m.record(rec, err)
+		res = canonicalApplied(res, paths)
+		for _, p := range params {
+			m.params.Delete(paramKey(id, uspService, p.Name))
+		}
+		return res, err
+	}
+	service, err = m.ResolveService(service)
+	if err != nil {
+		return nil, err
+	}
+	adapter, ok := m.dataModelFor(ctx, service)
+	if !ok {
+		return nil, dm.ErrInvalidParameter
+	}
+	rec := setRecord(caller, id, params)
+	done, err := m.guard(caller, id, "set")
+	if err != nil {
+		m.record(rec, err)
+		return nil, err
+	}
+	res, err := adapter.Set(ctx, id, sent, opts)
+	done(err)
+	m.record(rec, err)
+	res = canonicalApplied(res, paths)
+	for _, p := range params {
+		m.params.Delete(paramKey(id, service, p.Name))
+	}
+	return res, err
+}
+
+// SetAttributes writes parameter attributes (notify, access) without values, keyed by parameter
+// name, as a SET_ATTRIBUTES through SetParameters. Unknown attribute keys and invalid values fail
+// with ErrInvalidParameter before the device is contacted.
+func (m *Manager) SetAttributes(ctx context.Context, id dm.DeviceID, service string, attrs map[string]map[string]interface{}) (*runtime.SetResult, error) {
+	params, err := translate.AttributeParams(attrs)
+	if err != nil {
+		return nil, err
+	}
+	return m.SetParameters(ctx, id, service, params, dm.SetOptions{})
+}
+
+// ResolveFirmware returns the firmware policy for a model, cached for Cache.PolicyTTL per
+// xconfadmin credential set.
+func (m *Manager) ResolveFirmware(ctx context.Context, model string) (*policy.FirmwarePolicy, error) {
+	fa, partner := m.firmwareFor(ctx)
+	if fa == nil {
+		return nil, dm.ErrBackendUnavailable
+	}
+	key := firmwareKey(partner, model)
+	if fp, _, ok := m.policies.Get(key); ok {
+		return fp, nil
+	}
+	ctx, cancel := withTimeout(ctx, m.opts.PolicyTimeout, dm.DefaultPolicyTimeout)
+	defer cancel()
+	fp, err := fa.ResolveForModel(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	m.policies.Set(key, fp)
+	return fp, nil
+}
+
+// ResolveFirmwareForDevices evaluates xconf's firmware rules locally for many devices, downloading
+// the rule set once. Devices no rule matches are left out of the result.
+func (m *Manager) ResolveFirmwareForDevices(ctx context.Context, devices []policy.DeviceContext) (map[dm.DeviceID]*policy.FirmwarePolicy, error) {
+	fa, _ := m.firmwareFor(ctx)
+	if fa == nil {
+		return nil, dm.ErrBackendUnavailable
+	}
+	ctx, cancel := withTimeout(ctx, m.opts.PolicyTimeout, dm.DefaultPolicyTimeout)
+	defer cancel()
+	return fa.ResolveForDevices(ctx, devices)
+}
+
+// FirmwareRuleSet downloads the firmware rules and configs in effect for the caller.
+func (m *Manager) FirmwareRuleSet(ctx context.Context) (*policy.FirmwareRuleSet, error) {
+	fa, _ := m.firmwareFor(ctx)
+	if fa == nil {
+		return nil, dm.ErrBackendUnavailable
+	}
+	ctx, cancel := withTimeout(ctx, m.opts.PolicyTimeout, dm.DefaultPolicyTimeout)
+	defer cancel()
+	return fa.RuleSet(ctx)
+}
+
+// LintFirmwareRules downloads the firmware rules and reports conflicts between them.
+func (m *Manager) LintFirmwareRules(ctx context.Context) (*policy.LintReport, error) {
+	fa, _ := m.firmwareFor(ctx)
+	if fa == nil {
+		return nil, dm.ErrBackendUnavailable
+	}
+	ctx, cancel := withTimeout(ctx, m.opts.PolicyTimeout, dm.DefaultPolicyTimeout)
+	defer cancel()
+	return fa.Lint(ctx)
+}
+
+// CheckFirmwareRule reports the conflicts saving rule would introduce. The report is returned
+// with an error wrapping dm.ErrRuleConflict when any of them is an error finding.
+func (m *Manager) CheckFirmwareRule(ctx context.Context, rule policy.FirmwareRule) (*policy.LintReport, error) {
+	if rule.ID == "" {
+		return nil, fmt.Errorf("firmware rule without an ID: %w", dm.ErrInvalidParameter)
+	}
+	fa, _ := m.firmwareFor(ctx)
+	if fa == nil {
+		return nil, dm.ErrBackendUnavailable
+	}
+	ctx, cancel := withTimeout(ctx, m.opts.PolicyTimeout, dm.DefaultPolicyTimeout)
+	defer cancel()
+	rs, err := fa.RuleSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rep := rs.Check(rule)
+	return rep, rep.Err()
+}
+
+// SettingsProfile fetches an xconfadmin settings profile by ID.
+func (m *Manager) SettingsProfile(ctx context.Context, id string) (*policy.SettingsProfile, error) {
+	sa := m.settingsFor(ctx)
+	if sa == nil {
+		return nil, dm.ErrBackendUnavailable
+	}
+	ctx, cancel := withTimeout(ctx, m.opts.PolicyTimeout, dm.DefaultPolicyTimeout)
+	defer cancel()
+	return sa.GetProfileByID(ctx, id)
+}
+
+// firmwareKey keys cached firmware policies by the partner whose credentials resolved them.
+func firmwareKey(partner, model string) string {
+	return "firmware|" + partner + "|" + model
+}
+
+// DeviceFirmware resolves the firmware policy for a device using its reported ModelParameter.
+func (m *Manager) DeviceFirmware(ctx context.Context, id dm.DeviceID) (*policy.FirmwarePolicy, error) {
+	values, err := m.getParameters(ctx, id, "", []string{ModelParameter}, true)
+	if err != nil {
+		return nil, err
+	}
+	model, _ := values[ModelParameter].Value.(string)
+	if model == "" {
+		return nil, fmt.Errorf("device model unknown: %w", dm.ErrInvalidParameter)
+	}
+	return m.ResolveFirmware(ctx, model)
+}
+
+// Call issues a single JSON-RPC call to a device service (empty service selects DefaultRPCService),
+// over MQTT when Options.MQTT.RPC is set and otherwise through the Blizzard gateway, whose
+// connection lives only for the call. Calls to a quarantined device fail with dm.ErrQuarantined.
+func (m *Manager) Call(ctx context.Context, id dm.DeviceID, service string, call runtime.BlizzardCall) (*runtime.BlizzardResult, error) {
+	return m.CallWithProgress(ctx, id, service, call, nil)
+}
+
+// CallWithProgress is Call that also hands the JSON-RPC notifications the device sends while the
+// call is pending to progress (when non-nil), in arrival order; long-running device operations such
+// as diagnostics report progress this way.
+func (m *Manager) CallWithProgress(ctx context.Context, id dm.DeviceID, service string, call runtime.BlizzardCall, progress func(runtime.RPCNotification)) (*runtime.BlizzardResult, error) {
+	if err := m.CheckQuarantine(ctx, id); err != nil {
+		return nil, err
+	}
+	return m.call(ctx, id, service, call, progress, nil)
+}
+
+// call is CallWithProgress, through the connection of s when it is not nil.
+func (m *Manager) call(ctx context.Context, id dm.DeviceID, service string, call runtime.BlizzardCall, progress func(runtime.RPCNotification), s *rpcSession) (res *runtime.BlizzardResult, err error) {
+	useMQTT := s == nil && m.mqtt != nil && m.opts.MQTT.RPC
+	if m.opts.BlizzardBaseURL == "" && !useMQTT {
+		return nil, dm.ErrBackendUnavailable
+	}
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		if _, err := m.Device(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	if service == "" {
+		service = DefaultRPCService
+	}
+	if call.Timeout <= 0 {
+		call.Timeout = m.opts.RPCTimeout
+		if call.Timeout <= 0 {
+			call.Timeout = dm.DefaultRPCTimeout
+		}
+	}
+	rec := dm.NewAuditRecord(ctx, "rpc", id)
+	rec.Detail = call.Method
+	defer func() { m.record(rec, err) }()
+	done, err := m.guard(ctx, id, "rpc")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { done(err) }()
+	if call.CancelMethod == "" {
+		call.CancelMethod = m.opts.RPCCancelMethod
+	}
+	ctx, untrack, err := m.trackCall(ctx, id, service, call.Method)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = untrack(err) }()
+	// the deadline also bounds connecting to Blizzard
+	ctx, cancel := context.WithTimeout(ctx, call.Timeout)
+	defer cancel()
+	if s != nil {
+		return s.b.Call(ctx, call)
+	}
+	if useMQTT {
+		if progress != nil {
+			sub := m.mqtt.Subscribe(16)
+			defer forwardNotifications(sub, id, progress)()
+			defer sub.Close()
+		}
+		return m.mqtt.Call(ctx, id, service, call)
+	}
+	b, err := m.dialBlizzard(ctx, id, service)
+	if err != nil {
+		return nil, fmt.Errorf("blizzard connect: %w", err)
+	}
+	defer b.Close()
+	if progress != nil {
+		// the adapter drops its listeners on Close, so the subscription is left to the collector
+		defer forwardNotifications(b.Subscribe(16), id, progress)()
+	}
+	return b.Call(ctx, call)
+}
+
+// forwardNotifications passes id's notifications from sub to progress until the returned stop
+// function is called; stop delivers what is already buffered before returning.
+func forwardNotifications(sub dm.EventSubscription, id dm.DeviceID, progress func(runtime.RPCNotification)) (stop func()) {
+	done, finished := make(chan struct{}), make(chan struct{})
+	deliver := func(evt dm.Event) {
+		if evt.DeviceID != id || evt.Kind != dm.EventNotification {
+			return
+		}
+		if note, ok := runtime.ParseRPCNotification(evt.Payload); ok {
+			progress(note)
+		}
+	}
+	go func() {
+		defer close(finished)
+		for {
+			select {
+			case evt, ok := <-sub.C():
+				if !ok {
+					return
+				}
+				deliver(evt)
+			case <-done:
+				for {
+					select {
+					case evt, ok := <-sub.C():
+						if !ok {
+							return
+						}
+						deliver(evt)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// DefaultHistoryWindow is the History window used when none is given.
+const DefaultHistoryWindow = 24 * time.Hour
+
+// History returns a device's events from the last window (DefaultHistoryWindow when zero), oldest
+// first. Codex supplies the stored online/offline/crash events when Options.CodexBaseURL is set; the
+// in-memory ring adds events seen by this process after the newest Codex event. Partner-scoped
+// callers see a device that is not currently connected only through Codex events carrying one of
+// their partner IDs.
+func (m *Manager) History(ctx context.Context, id dm.DeviceID, window time.Duration) ([]dm.Event, error) {
+	if window <= 0 {
+		window = DefaultHistoryWindow
+	}
+	since := time.Now().Add(-window)
+	scope, scoped := dm.PartnersFromContext(ctx)
+	_, err := m.Device(ctx, id)
+	visible := err == nil
+	var out []dm.Event
+	if m.codex != nil {
+		stored, err := m.codex.History(ctx, id, since)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range stored {
+			if scoped && !visible && !dm.PartnerAllowed(scope, e.Payload.(runtime.CodexEvent).PartnerIDs) {
+				continue
+			}
+			out = append(out, e)
+		}
+	}
+	if scoped && !visible {
+		if len(out) == 0 {
+			return nil, dm.ErrDeviceNotFound
+		}
+		return out, nil
+	}
+	if len(out) > 0 {
+		if newest := out[len(out)-1].OccurredAt; newest.After(since) {
+			since = newest.Add(time.Nanosecond)
+		}
+	}
+	return append(out, m.recent.Since(id, since)...), nil
+}
+
+func paramKey(id dm.DeviceID, service, name string) string {
+	return strings.Join([]string{string(id), service, name}, "|")
+}
+
+// withTimeout bounds ctx by the configured per-operation timeout d, or def when d is unset.
+func withTimeout(ctx context.Context, d, def time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		d = def
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// guard fails fast with ErrCircuitOpen when id's circuit breaker is open; otherwise done records
+// the outcome of the call it guards, and its duration under operation ("get", "set", "rpc",
+// "operate"). Failures after the caller's own context ended are not held against the device.
+func (m *Manager) guard(ctx context.Context, id dm.DeviceID, operation string) (done func(error), err error) {
+	if err := m.breaker.Allow(id); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	return func(err error) {
+		if err != nil && ctx.Err() != nil {
+			err = context.Canceled
+		}
+		m.breaker.Record(id, err)
+		partner, model := m.deviceTags(id)
+		m.opDuration.Observe(ctx, time.Since(start).Seconds(), operation, partner, model, outcome(err))
+	}, nil
+}
+
+// deviceTags returns id's first partner and model as bounded metric label values.
+func (m *Manager) deviceTags(id dm.DeviceID) (partner, model string) {
+	meta := m.devices.View().Metadata(string(id))
+	partner, model = "none", "unknown"
+	if p := dm.SplitPartners(meta[dm.MetadataPartnerIDs]); len(p) > 0 {
+		partner = p[0]
+	}
+	if v := meta[dm.MetadataModel]; v != "" {
+		model = v
+	}
+	return m.partnerTags.Value(partner), m.modelTags.Value(model)
+}
+
+// outcome classifies a guarded call's error for metric labels.
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, dm.ErrTimeout):
+		return "timeout"
+	case errors.Is(err, dm.ErrDeviceOffline):
+		return "offline"
+	case errors.Is(err, dm.ErrDeviceNotFound):
+		return "not_found"
+	}
+	return "error"
+}
+
+// Metrics serves the Manager's metrics in the Prometheus text format, or as OpenMetrics with
+// trace exemplars when asked for it.
+func (m *Manager) Metrics() http.Handler { return m.metrics }
+
+// Registry is the registry Metrics serves, for components that add their own series.
+func (m *Manager) Registry() *metrics.Registry { return m.metrics }
+
+// CircuitState returns the state of id's circuit breaker (Options.Breaker).
+func (m *Manager) CircuitState(id dm.DeviceID) dm.BreakerState {
+	return m.breaker.State(id.Canonical())
+}
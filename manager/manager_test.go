@@ -0,0 +1,839 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/websocket"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/faults"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// fakeTalaria serves a fixed device list and counts polls.
+func fakeTalaria(t *testing.T, polls *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{"devices": []map[string]any{
+			{"id": "mac:aa", "partnerIDs": []string{"comcast"}},
+			{"id": "mac:bb", "partnerIDs": []string{"sky"}},
+		}})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestManager(t *testing.T, opts dm.Options) *Manager {
+	t.Helper()
+	m, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestManagerParameterCache(t *testing.T) {
+	var polls, gets atomic.Int32
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+			name := r.URL.Query().Get("names")
+			_ = json.NewEncoder(w).Encode(map[string]any{"parameters": map[string]any{name: map[string]any{"value": r.URL.Path}}})
+			return
+		}
+		w.Write([]byte(`{"statusCode":200}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	m := newTestManager(t, opts)
+	ctx := context.Background()
+	const name = "Device.DeviceInfo.SoftwareVersion"
+	get := func(f func(context.Context, dm.DeviceID, string, []string) (map[string]dm.ParameterValue, error), id dm.DeviceID) dm.ParameterValue {
+		t.Helper()
+		values, err := f(ctx, id, "", []string{name})
+		if err != nil {
+			t.Fatalf("get %s: %v", id, err)
+		}
+		return values[name]
+	}
+
+	get(m.GetParameters, "mac:aa")
+	get(m.GetParameters, "mac:aa")
+	if n := gets.Load(); n != 1 {
+		t.Fatalf("cached read reached Tr1d1um: %d gets", n)
+	}
+	// entries are keyed per device
+	if a, b := get(m.GetParameters, "mac:aa"), get(m.GetParameters, "mac:bb"); a.Value == b.Value {
+		t.Fatalf("devices share a cache entry: %v", a.Value)
+	}
+	if n := gets.Load(); n != 2 {
+		t.Fatalf("expected 2 gets, got %d", n)
+	}
+	get(m.RefreshParameters, "mac:aa")
+	if n := gets.Load(); n != 3 {
+		t.Fatalf("refresh served from cache: %d gets", n)
+	}
+	if _, err := m.SetParameters(ctx, "mac:aa", "", []dm.SetParameter{{Name: name, Value: "2.0"}}, dm.SetOptions{}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	get(m.GetParameters, "mac:aa")
+	if n := gets.Load(); n != 4 {
+		t.Fatalf("set did not evict the cached value: %d gets", n)
+	}
+}
+
+func TestManagerFirmwareCachePerPartner(t *testing.T) {
+	var polls, lookups atomic.Int32
+	xconf := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		version := "default-1.0"
+		if r.Header.Get("Authorization") == "comcast-key" {
+			version = "comcast-2.0"
+		}
+		_ = json.NewEncoder(w).Encode([]map[string]string{{"id": "fw1", "firmwareVersion": version, "model": "TG1682"}})
+	}))
+	defer xconf.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.XconfAdminBaseURL = xconf.URL
+	opts.Auth.XconfAdmin = dm.StaticAuth{Value: "default-key"}
+	var comcast dm.PartnerOptions
+	comcast.Auth.XconfAdmin = dm.StaticAuth{Value: "comcast-key"}
+	opts.Partners = map[string]dm.PartnerOptions{"comcast": comcast}
+	m := newTestManager(t, opts)
+
+	resolve := func(ctx context.Context) string {
+		t.Helper()
+		fp, err := m.ResolveFirmware(ctx, "TG1682")
+		if err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+		return fp.Version
+	}
+	scoped := dm.WithPartners(context.Background(), []string{"comcast"})
+	for i := 0; i < 2; i++ {
+		if v := resolve(scoped); v != "comcast-2.0" {
+			t.Fatalf("comcast resolved %s", v)
+		}
+		// the default credentials do not see the policy cached for comcast
+		if v := resolve(context.Background()); v != "default-1.0" {
+			t.Fatalf("default resolved %s", v)
+		}
+	}
+	if n := lookups.Load(); n != 2 {
+		t.Fatalf("expected one lookup per credential set, got %d", n)
+	}
+}
+
+func TestManagerScopedLookups(t *testing.T) {
+	var polls, gets atomic.Int32
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets.Add(1)
+		w.Write([]byte(`{"parameters":{}}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	m := newTestManager(t, opts)
+	if _, err := m.Poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	sky := dm.WithPartners(context.Background(), []string{"sky"})
+
+	if got := m.ListDevices(sky); len(got) != 1 || got[0].ID != "mac:bb" {
+		t.Fatalf("sky lists %+v", got)
+	}
+	if got := m.ListDevices(context.Background()); len(got) != 2 {
+		t.Fatalf("unscoped lists %+v", got)
+	}
+	if _, err := m.Device(sky, "mac:bb"); err != nil {
+		t.Fatalf("own device: %v", err)
+	}
+	for _, id := range []dm.DeviceID{"mac:aa", "mac:unknown"} {
+		if _, err := m.Device(sky, id); !errors.Is(err, dm.ErrDeviceNotFound) {
+			t.Fatalf("device %s: %v", id, err)
+		}
+		if _, err := m.GetParameters(sky, id, "", []string{"Device.X"}); !errors.Is(err, dm.ErrDeviceNotFound) {
+			t.Fatalf("get %s: %v", id, err)
+		}
+		if _, err := m.SetParameters(sky, id, "", []dm.SetParameter{{Name: "Device.X", Value: 1}}, dm.SetOptions{}); !errors.Is(err, dm.ErrDeviceNotFound) {
+			t.Fatalf("set %s: %v", id, err)
+		}
+	}
+	if n := gets.Load(); n != 0 {
+		t.Fatalf("out-of-scope requests reached Tr1d1um %d times", n)
+	}
+}
+
+// staticElector reports a fixed election outcome.
+type staticElector struct {
+	leader bool
+	err    error
+}
+
+func (e staticElector) Campaign(context.Context) (bool, error) { return e.leader, e.err }
+func (e staticElector) Resign(context.Context) error           { return nil }
+
+func TestManagerLeaderGatedPoll(t *testing.T) {
+	mr := miniredis.RunT(t)
+	var polls atomic.Int32
+	talaria := fakeTalaria(t, &polls)
+	replica := func(e dm.Elector) *Manager {
+		opts := dm.DefaultOptions()
+		opts.TalariaBaseURL = talaria.URL
+		opts.Cache.RedisURL = "redis://" + mr.Addr()
+		opts.Elector = e
+		return newTestManager(t, opts)
+	}
+	leader := replica(staticElector{leader: true})
+	follower := replica(staticElector{})
+	ctx := context.Background()
+
+	if _, err := leader.Poll(ctx); err != nil {
+		t.Fatalf("leader poll: %v", err)
+	}
+	if n := polls.Load(); n != 1 {
+		t.Fatalf("leader polled Talaria %d times", n)
+	}
+	ids, err := follower.Poll(ctx)
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("follower poll: %v %v", ids, err)
+	}
+	if n := polls.Load(); n != 1 {
+		t.Fatal("follower queried Talaria")
+	}
+	if _, err := follower.Device(ctx, "mac:aa"); err != nil {
+		t.Fatalf("follower snapshot: %v", err)
+	}
+
+	// an unreachable coordinator falls back to polling directly
+	orphan := replica(staticElector{err: errors.New("coordinator down")})
+	if _, err := orphan.Poll(ctx); err != nil {
+		t.Fatalf("orphan poll: %v", err)
+	}
+	if n := polls.Load(); n != 2 {
+		t.Fatalf("election error did not poll Talaria: %d polls", n)
+	}
+	if _, err := New(dm.Options{TalariaBaseURL: talaria.URL, Elector: staticElector{}}); err == nil {
+		t.Fatal("Elector accepted without Cache.RedisURL")
+	}
+}
+
+func TestManagerOperationTimeouts(t *testing.T) {
+	var polls atomic.Int32
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Tr1d1umBaseURL = slow.URL
+	opts.XconfAdminBaseURL = slow.URL
+	opts.GetTimeout, opts.SetTimeout, opts.PolicyTimeout = 20*time.Millisecond, 30*time.Millisecond, 40*time.Millisecond
+	opts.Retry = dm.RetryPolicy{}
+	m := newTestManager(t, opts)
+	ctx := context.Background()
+	within := func(name string, limit time.Duration, f func() error) {
+		t.Helper()
+		start := time.Now()
+		if err := f(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("%s: expected a deadline error, got %v", name, err)
+		}
+		if d := time.Since(start); d > limit+time.Second {
+			t.Fatalf("%s took %s", name, d)
+		}
+	}
+	within("get", opts.GetTimeout, func() error {
+		_, err := m.GetParameters(ctx, "mac:aa", "", []string{"Device.X"})
+		return err
+	})
+	within("set", opts.SetTimeout, func() error {
+		_, err := m.SetParameters(ctx, "mac:aa", "", []dm.SetParameter{{Name: "Device.X", Value: 1}}, dm.SetOptions{})
+		return err
+	})
+	within("policy", opts.PolicyTimeout, func() error {
+		_, err := m.ResolveFirmware(ctx, "TG1682")
+		return err
+	})
+}
+
+func TestManagerServiceAllowlist(t *testing.T) {
+	var polls, requests atomic.Int32
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"parameters":{},"statusCode":200}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	opts.Services = []string{"config", "wifi"}
+	m := newTestManager(t, opts)
+	ctx := context.Background()
+
+	for _, svc := range []string{"", "wifi"} {
+		if _, err := m.GetParameters(ctx, "mac:aa", svc, []string{"Device.X"}); err != nil {
+			t.Fatalf("service %q: %v", svc, err)
+		}
+	}
+	_, err := m.GetParameters(ctx, "mac:aa", "wfi", []string{"Device.X"})
+	if !errors.Is(err, dm.ErrInvalidParameter) || !strings.Contains(err.Error(), "config, wifi") {
+		t.Fatalf("typo'd service on get: %v", err)
+	}
+	if _, err := m.SetParameters(ctx, "mac:aa", "wfi", []dm.SetParameter{{Name: "Device.X", Value: 1}}, dm.SetOptions{}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("typo'd service on set: %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("expected only the valid requests to reach Tr1d1um, got %d", n)
+	}
+}
+
+func TestManagerReload(t *testing.T) {
+	var polls atomic.Int32
+	var auth atomic.Value
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+		w.Write([]byte(`{"parameters":{"Device.X":{"value":"1"}}}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	opts.Auth.Tr1d1um = dm.StaticAuth{Value: "Bearer old"}
+	m := newTestManager(t, opts)
+	ctx := context.Background()
+	if _, err := m.GetParameters(ctx, "mac:aa", "wifi", []string{"Device.X"}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("unconfigured service: %v", err)
+	}
+
+	opts.Services = []string{"config", "wifi"}
+	opts.Auth.Tr1d1um = dm.StaticAuth{Value: "Bearer new"}
+	opts.Cache.ParamTTL = 0
+	if err := m.Reload(opts); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		auth.Store("")
+		if _, err := m.GetParameters(ctx, "mac:aa", "wifi", []string{"Device.X"}); err != nil {
+			t.Fatalf("reloaded service: %v", err)
+		}
+		// caching is now disabled, so each read reaches Tr1d1um with the rotated credentials
+		if got := auth.Load(); got != "Bearer new" {
+			t.Fatalf("read %d sent %q", i, got)
+		}
+	}
+	if err := m.Reload(dm.Options{Services: []string{""}}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("empty service accepted: %v", err)
+	}
+}
+
+func TestManagerCircuitBreaker(t *testing.T) {
+	var polls, gets atomic.Int32
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets.Add(1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Tr1d1umBaseURL = slow.URL
+	opts.GetTimeout = 10 * time.Millisecond
+	opts.Retry = dm.RetryPolicy{}
+	opts.Breaker = dm.BreakerConfig{Failures: 2}
+	m := newTestManager(t, opts)
+	get := func(ctx context.Context) error {
+		_, err := m.RefreshParameters(ctx, "mac:aa", "", []string{"Device.X"})
+		return err
+	}
+
+	// a caller giving up does not count against the device
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = get(canceled)
+	for i := 0; i < 2; i++ {
+		if err := get(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("get %d: %v", i, err)
+		}
+	}
+	if m.CircuitState("mac:aa") != dm.BreakerOpen {
+		t.Fatalf("circuit %s after repeated timeouts", m.CircuitState("mac:aa"))
+	}
+	n := gets.Load()
+	if err := get(context.Background()); !errors.Is(err, dm.ErrCircuitOpen) {
+		t.Fatalf("open circuit: %v", err)
+	}
+	if gets.Load() != n {
+		t.Fatal("open circuit reached Tr1d1um")
+	}
+	if _, err := m.SetParameters(context.Background(), "mac:aa", "", []dm.SetParameter{{Name: "Device.X", Value: 1}}, dm.SetOptions{}); !errors.Is(err, dm.ErrDeviceOffline) {
+		t.Fatalf("set on an open circuit: %v", err)
+	}
+}
+
+func TestManagerStats(t *testing.T) {
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"devices": []map[string]any{
+			{"id": "mac:aa", "partnerIDs": []string{"comcast"}, "hw-model": "XB7", "fw-name": "7.1"},
+			{"id": "mac:bb", "partnerIDs": []string{"sky"}, "convey": map[string]any{"hw-model": "XB7", "fw-name": "7.2"}},
+			{"id": "mac:cc", "partnerIDs": []string{"sky"}},
+		}})
+	}))
+	defer talaria.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = talaria.URL
+	m := newTestManager(t, opts)
+	if _, err := m.Poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	var st FleetStats
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		// the online events reach the history ring asynchronously
+		if st = m.Stats(context.Background()); st.Churn.Transitions == 3 || time.Now().After(deadline) {
+			break
+		}
+	}
+	if st.Devices != 3 || st.ByStatus["online"] != 3 || st.ByModel["XB7"] != 2 || st.ByFirmware["7.2"] != 1 {
+		t.Fatalf("unscoped stats %+v", st)
+	}
+	if st.Churn.Transitions != 3 || st.Churn.Rate != 1 {
+		t.Fatalf("churn %+v", st.Churn)
+	}
+	if h := st.Backends["talaria"]; !h.Configured || h.LastPoll == nil || h.LastError != "" || st.Backends["tr1d1um"].Configured {
+		t.Fatalf("backends %+v", st.Backends)
+	}
+	sky := m.Stats(dm.WithPartners(context.Background(), []string{"sky"}))
+	if sky.Devices != 2 || sky.ByModel["XB7"] != 1 || sky.Churn.Transitions != 2 {
+		t.Fatalf("sky stats %+v", sky)
+	}
+}
+
+func TestManagerStatsHistory(t *testing.T) {
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"devices": []map[string]any{
+			{"id": "mac:aa", "partnerIDs": []string{"comcast"}},
+			{"id": "mac:bb", "partnerIDs": []string{"sky"}},
+			{"id": "mac:cc", "partnerIDs": []string{"sky", "comcast"}},
+		}})
+	}))
+	defer talaria.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = talaria.URL
+	m := newTestManager(t, opts)
+	ctx := context.Background()
+	if _, err := m.Poll(ctx); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	// the online events reach the journal asynchronously and count toward a later sample
+	for deadline := time.Now().Add(time.Second); m.journal.Head() < 3 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := m.Poll(ctx); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	wentOnline := func(samples []StatsSample) (n int) {
+		for _, s := range samples {
+			n += s.WentOnline
+		}
+		return n
+	}
+	all := m.StatsHistory(ctx, 0, 0)
+	if len(all) != 2 || all[1].Devices != 3 || all[1].Online != 3 || wentOnline(all) != 3 {
+		t.Fatalf("unscoped history %+v", all)
+	}
+	sky := m.StatsHistory(dm.WithPartners(ctx, []string{"sky"}), 0, 0)
+	if sky[1].Online != 2 || wentOnline(sky) != 2 {
+		t.Fatalf("sky history %+v", sky)
+	}
+	if merged := m.StatsHistory(ctx, 0, 24*time.Hour); len(merged) != 1 || merged[0].Online != 3 || merged[0].WentOnline != 3 {
+		t.Fatalf("merged history %+v", merged)
+	}
+	m.statsHistory.points[0].at = time.Now().Add(-2 * time.Hour)
+	if recent := m.StatsHistory(ctx, time.Hour, 0); len(recent) != 1 {
+		t.Fatalf("window: %+v", recent)
+	}
+}
+
+func TestManagerPollHonorsRetryAfter(t *testing.T) {
+	var requests int
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer talaria.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = talaria.URL
+	m := newTestManager(t, opts)
+	_, err := m.Poll(context.Background())
+	if after, ok := dm.RetryAfter(err); !ok || after != time.Minute || requests != 1 {
+		t.Fatalf("poll: %v after %d requests (hint longer than MaxRetryAfter must not be retried)", err, requests)
+	}
+	if _, err := m.Poll(context.Background()); !errors.Is(err, dm.ErrBackendUnavailable) || requests != 1 {
+		t.Fatalf("deferred poll: %v after %d requests", err, requests)
+	}
+}
+
+type staticEnricher map[dm.DeviceID]map[string]string
+
+func (e staticEnricher) Load(context.Context) (map[dm.DeviceID]map[string]string, error) {
+	return e, nil
+}
+
+func TestManagerEnrichment(t *testing.T) {
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"devices": []map[string]any{
+			{"id": "mac:0000000000aa", "partnerIDs": []string{"comcast"}, "hw-model": "XB7"},
+			{"id": "mac:0000000000bb"},
+		}})
+	}))
+	defer talaria.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = talaria.URL
+	opts.Enrichment.Source = staticEnricher{
+		"MAC:00-00-00-00-00-AA": {"account": "A-17", dm.MetadataModel: "XB6"},
+		"mac:0000000000bb":      {"region": "east", dm.MetadataPartnerIDs: "comcast"},
+	}
+	m := newTestManager(t, opts)
+	if err := m.LoadEnrichment(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	aa, err := m.Device(context.Background(), "mac:0000000000aa")
+	if err != nil || aa.Metadata["account"] != "A-17" || aa.Metadata[dm.MetadataModel] != "XB7" {
+		t.Fatalf("mac:0000000000aa metadata %v %v (Talaria keys take precedence)", aa.Metadata, err)
+	}
+	bb, _ := m.Device(context.Background(), "mac:0000000000bb")
+	if bb.Metadata["region"] != "east" || bb.Metadata[dm.MetadataPartnerIDs] != "" {
+		t.Fatalf("mac:0000000000bb metadata %v (partner IDs never come from the inventory)", bb.Metadata)
+	}
+	if _, err := m.Device(dm.WithPartners(context.Background(), []string{"comcast"}), "mac:0000000000bb"); !errors.Is(err, dm.ErrDeviceNotFound) {
+		t.Fatalf("enrichment widened partner scope: %v", err)
+	}
+}
+
+func TestManagerTrapBridge(t *testing.T) {
+	var polls atomic.Int32
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	if newTestManager(t, opts).TrapHandler() != nil {
+		t.Fatal("expected no trap handler while disabled")
+	}
+	opts.Traps = dm.TrapConfig{Enabled: true, DeviceIDs: map[string]string{"SN-1": "mac:112233445566"}}
+	m := newTestManager(t, opts)
+	sub := m.Subscribe(8)
+	defer sub.Close()
+	rr := httptest.NewRecorder()
+	m.TrapHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"agent":"SN-1","oid":"1.3.6.1.6.3.1.1.5.2"}`)))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("post: %d %s", rr.Code, rr.Body)
+	}
+	select {
+	case e := <-sub.C():
+		if e.Kind != dm.EventNotification || e.DeviceID != "mac:112233445566" || e.Seq == 0 {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("trap not delivered")
+	}
+}
+
+func TestManagerTalariaRouting(t *testing.T) {
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/device/mac:aa/stat":
+			w.Header().Set(runtime.TalariaServerHeader, "127.0.0.1")
+		case "/api/v2/device/mac:bb/stat":
+			w.Header().Set(runtime.TalariaServerHeader, "talaria-2.invalid")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer talaria.Close()
+	hosts := make(chan string, 4)
+	upgrader := websocket.Upgrader{}
+	gw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		var req struct {
+			ID string `json:"id"`
+		}
+		if c.ReadJSON(&req) == nil {
+			c.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":"`+req.ID+`","result":"pong"}`))
+		}
+	}))
+	defer gw.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = talaria.URL
+	opts.BlizzardBaseURL = "ws://localhost:" + strings.TrimPrefix(gw.URL, "http://127.0.0.1:")
+	opts.Routing = dm.RoutingConfig{Enabled: true}
+	m := newTestManager(t, opts)
+
+	// mac:aa is dialed on its instance, mac:bb falls back to the gateway when its instance is unreachable
+	for id, want := range map[dm.DeviceID]string{"mac:aa": "127.0.0.1", "mac:bb": "localhost"} {
+		res, err := m.Call(context.Background(), id, "", runtime.BlizzardCall{Method: "ping"})
+		if err != nil || string(res.Result) != `"pong"` {
+			t.Fatalf("%s: %v %+v", id, err, res)
+		}
+		if host := <-hosts; !strings.HasPrefix(host, want+":") {
+			t.Fatalf("%s dialed %s, want %s", id, host, want)
+		}
+	}
+	st := m.Stats(context.Background())
+	if len(st.Instances) != 2 || st.Instances[0].Instance != "127.0.0.1" || st.Instances[0].Successes != 1 ||
+		st.Instances[1].Instance != "talaria-2.invalid" || st.Instances[1].Failures != 1 {
+		t.Fatalf("instances %+v", st.Instances)
+	}
+}
+
+func TestManagerRoutingPredict(t *testing.T) {
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"devices":[]}`))
+	}))
+	defer talaria.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = talaria.URL
+	opts.Routing = dm.RoutingConfig{Enabled: true, Predict: true}
+	if _, err := New(opts); err == nil {
+		t.Fatal("Routing.Predict without Polling.Instances")
+	}
+	opts.Polling.Instances = []string{"http://talaria-0.invalid:6200/", "http://talaria-1.invalid:6200"}
+	m := newTestManager(t, opts)
+	ring := dm.ConsistentHasher{}.Ring([]string{"http://talaria-0.invalid:6200", "http://talaria-1.invalid:6200"})
+	for _, id := range []dm.DeviceID{"mac:112233445566", "mac:aabbccddeeff"} {
+		want, _ := ring.Instance(id)
+		got, err := m.router.Resolve(context.Background(), id)
+		if err != nil || "http://"+got+":6200" != want {
+			t.Fatalf("%s resolved to %q (%v), placed on %q", id, got, err, want)
+		}
+		if host, _ := m.devices.PredictInstance(id); "http://"+host != want {
+			t.Fatalf("%s predicted on %q, placed on %q", id, host, want)
+		}
+	}
+}
+
+func TestManagerGetConfig(t *testing.T) {
+	var polls, subtreeGets atomic.Int32
+	var cid atomic.Value
+	cid.Store("cid-1")
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("names")
+		if name == DefaultConfigCIDParameter {
+			_ = json.NewEncoder(w).Encode(map[string]any{"parameters": map[string]any{name: map[string]any{"value": cid.Load()}}})
+			return
+		}
+		subtreeGets.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{"parameters": map[string]any{"Device.WiFi.SSID.1.SSID": map[string]any{"value": "home"}}})
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	m := newTestManager(t, opts)
+	ctx := context.Background()
+
+	first, err := m.GetConfig(ctx, "mac:aa", "", []string{"Device.WiFi."})
+	if err != nil || first.CID != "cid-1" || first.Cached || first.Values["Device.WiFi.SSID.1.SSID"].Value != "home" {
+		t.Fatalf("first read %+v %v", first, err)
+	}
+	again, err := m.GetConfig(ctx, "mac:aa", "config", []string{"Device.WiFi."})
+	if err != nil || !again.Cached || subtreeGets.Load() != 1 {
+		t.Fatalf("unchanged CID refetched: %+v %v, %d subtree reads", again, err, subtreeGets.Load())
+	}
+	cid.Store("cid-2")
+	changed, err := m.GetConfig(ctx, "mac:aa", "", []string{"Device.WiFi."})
+	if err != nil || changed.Cached || changed.CID != "cid-2" || subtreeGets.Load() != 2 {
+		t.Fatalf("changed CID served from cache: %+v %v", changed, err)
+	}
+}
+
+func TestManagerMetrics(t *testing.T) {
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"devices": []map[string]any{
+			{"id": "mac:aa", "partnerIDs": []string{"comcast"}, "hw-model": "XB7"},
+			{"id": "mac:bb", "partnerIDs": []string{"sky"}, "hw-model": "XB8"},
+		}})
+	}))
+	defer talaria.Close()
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"parameters":{}}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = talaria.URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	opts.Metrics.LabelLimit = 1
+	m := newTestManager(t, opts)
+	if _, err := m.Poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	for _, id := range []dm.DeviceID{"mac:aa", "mac:bb"} {
+		if _, err := m.RefreshParameters(context.Background(), id, "", []string{"Device.X"}); err != nil {
+			t.Fatalf("get %s: %v", id, err)
+		}
+	}
+	rec := httptest.NewRecorder()
+	m.Metrics().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`devicemgr_device_operation_duration_seconds_count{operation="get",partner="comcast",model="XB7",outcome="ok"} 1`,
+		// past the label limit
+		`devicemgr_device_operation_duration_seconds_count{operation="get",partner="other",model="other",outcome="ok"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Fatalf("missing %s:\n%s", want, rec.Body)
+		}
+	}
+}
+
+func TestManagerFaults(t *testing.T) {
+	var calls atomic.Int32
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"parameters":{}}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = tr1d1um.URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	opts.Faults = dm.FaultConfig{Enabled: true, ErrorRate: 1, Hosts: []string{tr1d1um.Listener.Addr().String()}}
+	m := newTestManager(t, opts)
+	if _, err := m.RefreshParameters(context.Background(), "mac:aabbccddeeff", "", []string{"Device.X"}); err == nil {
+		t.Fatal("expected the injected 503 to fail the read")
+	}
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("backend reached %d times", n)
+	}
+	if got := m.Dump().Faults[faults.Error]; got == 0 {
+		t.Fatalf("dump faults: %v", m.Dump().Faults)
+	}
+
+	opts.Faults.DropRate = 2
+	if _, err := New(opts); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("invalid rate: %v", err)
+	}
+}
+
+func TestManagerDryRunSet(t *testing.T) {
+	var polls, patches atomic.Int32
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			patches.Add(1)
+			w.Write([]byte(`{"statusCode":200}`))
+			return
+		}
+		name := r.URL.Query().Get("names")
+		_ = json.NewEncoder(w).Encode(map[string]any{"parameters": map[string]any{name: map[string]any{"value": "true"}}})
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	m := newTestManager(t, opts)
+	ctx := context.Background()
+	const enable = "Device.WiFi.Radio.1.Enable"
+	if _, err := m.GetParameters(ctx, "mac:aa", "", []string{enable}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := m.SetParameters(ctx, "mac:aa", "", []dm.SetParameter{
+		{Name: enable, Value: "true"},
+		{Name: "Device.WiFi.Radio.1.Channel", Value: 36.0},
+	}, dm.SetOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	report := res.DryRun
+	if report == nil || !report.Valid || !strings.Contains(report.Endpoint, "/mac:aa/config") || len(report.Payload) == 0 {
+		t.Fatalf("report: %+v", report)
+	}
+	if got := report.Parameters; got[0].Outcome != runtime.OutcomeUnchanged || got[1].Outcome != runtime.OutcomeSet || got[1].DataType != "unsignedInt" {
+		t.Fatalf("outcomes: %+v", got)
+	}
+
+	res, err = m.SetParameters(ctx, "mac:aa", "", []dm.SetParameter{
+		{Name: "Device.DeviceInfo.ModelName", Value: "XB8"},
+		{Name: "Device.WiFi.Radio.1.Channel", Value: -1},
+	}, dm.SetOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report := res.DryRun; report.Valid || report.Parameters[0].Outcome != runtime.OutcomeRejected || report.Parameters[1].Outcome != runtime.OutcomeRejected {
+		t.Fatalf("invalid report: %+v", report)
+	}
+	if n := patches.Load(); n != 0 {
+		t.Fatalf("dry run reached Tr1d1um: %d patches", n)
+	}
+}
+
+func TestManagerTalariaStats(t *testing.T) {
+	var devicesB atomic.Value
+	devicesB.Store([]string{"mac:03", "mac:04", "mac:05"})
+	a := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"devices": []map[string]any{{"id": "mac:01", "partnerIDs": []string{"sky"}}}})
+	}))
+	defer a.Close()
+	b := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"devices": devicesB.Load()})
+	}))
+	defer b.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = a.URL
+	opts.Polling.Instances = []string{a.URL, b.URL}
+	m := newTestManager(t, opts)
+	ctx := context.Background()
+	if _, err := m.Poll(ctx); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	st := m.TalariaStats(ctx)
+	if st.Source != TalariaSourcePolling || st.Devices != 4 || st.Mean != 2 || st.Skew != 1 || len(st.Instances) != 2 {
+		t.Fatalf("stats %+v", st)
+	}
+	byDevices := map[int]TalariaInstanceStats{}
+	for _, in := range st.Instances {
+		byDevices[in.Devices] = in
+	}
+	if in := byDevices[3]; in.Share != 0.75 || in.Deviation != 0.5 || in.Peak != 3 || in.Draining || in.LastPoll == nil {
+		t.Fatalf("busy instance %+v", in)
+	}
+	if sky := m.TalariaStats(dm.WithPartners(ctx, []string{"sky"})); sky.Devices != 1 {
+		t.Fatalf("sky stats %+v", sky)
+	}
+
+	devicesB.Store([]string{"mac:03"})
+	if _, err := m.Poll(ctx); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	for _, in := range m.TalariaStats(ctx).Instances {
+		if draining := in.Peak == 3; in.Draining != draining || (draining && in.Devices != 1) {
+			t.Fatalf("after draining %+v", in)
+		}
+	}
+}
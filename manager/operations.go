@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// record finishes rec with err and adds it to the device's operation history, returning the
+// finished record.
+func (m *Manager) record(rec dm.AuditRecord, err error) dm.AuditRecord {
+	rec = m.redactor.AuditRecord(rec)
+	rec.Err = err
+	rec.Duration = time.Since(rec.Time)
+	// the history outlives the request, so a canceled caller still gets its record
+	if err := m.operations.Record(context.Background(), rec); err != nil {
+		log.Printf("operation history %s: %v", rec.DeviceID, err)
+	}
+	return rec
+}
+
+// setRecord describes a SET by the parameter names it writes; values may be secrets.
+func setRecord(ctx context.Context, id dm.DeviceID, params []dm.SetParameter) dm.AuditRecord {
+	rec := dm.NewAuditRecord(ctx, "set", id)
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i] = p.Name
+	}
+	rec.Detail = strings.Join(names, ",")
+	return rec
+}
+
+// Operations returns up to limit of the device's most recent operations through this Manager
+// (or, with shared state, any replica), newest first: parameter reads that reached the device,
+// writes, RPCs and the lifecycle operations. Partner-scoped callers only see devices in scope.
+func (m *Manager) Operations(ctx context.Context, id dm.DeviceID, limit int) ([]dm.AuditRecord, error) {
+	id = id.Canonical()
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		if _, err := m.Device(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return m.operations.Recent(ctx, id, limit)
+}
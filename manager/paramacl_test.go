@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestParameterACLEnforced(t *testing.T) {
+	var polls, requests atomic.Int32
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(map[string]any{"parameters": map[string]any{
+				"Device.WiFi.SSID.1.SSID":                          map[string]any{"value": "home"},
+				"Device.WiFi.AccessPoint.1.Security.KeyPassphrase": map[string]any{"value": "hunter22"},
+			}})
+			return
+		}
+		w.Write([]byte(`{"statusCode":200}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	opts.ParameterACL = map[dm.Role]dm.ParameterRule{dm.RoleOperator: {
+		Read:      []string{"Device.WiFi.*"},
+		DenyRead:  []string{"*.KeyPassphrase"},
+		DenyWrite: []string{"Device.WiFi.AccessPoint.*.Security.*"},
+	}}
+	m := newTestManager(t, opts)
+	tier1 := dm.WithRole(context.Background(), dm.RoleOperator)
+
+	values, err := m.RefreshParameters(tier1, "mac:aa", "", []string{"Device.WiFi."})
+	if err != nil {
+		t.Fatalf("partial read: %v", err)
+	}
+	if _, ok := values["Device.WiFi.AccessPoint.1.Security.KeyPassphrase"]; ok || values["Device.WiFi.SSID.1.SSID"].Value != "home" {
+		t.Fatalf("partial read not filtered: %v", values)
+	}
+	before := requests.Load()
+	if _, err := m.GetParameters(tier1, "mac:aa", "", []string{"Device.DeviceInfo.SerialNumber"}); !errors.Is(err, dm.ErrAccessDenied) {
+		t.Fatalf("read outside the rule: %v", err)
+	}
+	if _, err := m.SetParameters(tier1, "mac:aa", "", []dm.SetParameter{{Name: "Device.WiFi.AccessPoint.1.Security.ModeEnabled", Value: "None"}}, dm.SetOptions{DryRun: true}); !errors.Is(err, dm.ErrAccessDenied) {
+		t.Fatalf("denied write: %v", err)
+	}
+	if n := requests.Load(); n != before {
+		t.Fatalf("denied requests reached Tr1d1um %d times", n-before)
+	}
+	if _, err := m.SetParameters(tier1, "mac:aa", "", []dm.SetParameter{{Name: "Device.WiFi.SSID.1.SSID", Value: "cafe"}}, dm.SetOptions{}); err != nil {
+		t.Fatalf("allowed write: %v", err)
+	}
+	// a reboot is authorized by its route, not by the parameter it writes
+	if err := m.Reboot(tier1, "mac:aa"); err != nil {
+		t.Fatalf("reboot: %v", err)
+	}
+	if _, err := m.GetParameters(dm.WithRole(context.Background(), dm.RoleAdmin), "mac:aa", "", []string{"Device.WiFi.AccessPoint.1.Security.KeyPassphrase"}); err != nil {
+		t.Fatalf("a role without a rule is unrestricted: %v", err)
+	}
+}
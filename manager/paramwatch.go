@@ -0,0 +1,182 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+	"github.com/xmidt-org/talaria/devicemgr/translate"
+)
+
+// NotifyAttribute is the WDMP attribute that turns value-change notifications on (1) or off (0).
+const NotifyAttribute = translate.AttributeNotify
+
+// ParamChange is a parameter value change reported by a device.
+type ParamChange struct {
+	DeviceID dm.DeviceID `json:"deviceId"`
+	Name     string      `json:"name"`
+	Value    interface{} `json:"value"`
+	DataType string      `json:"dataType,omitempty"`
+	Source   string      `json:"source,omitempty"` // who changed it, when the device says (e.g. "webpa", "cli")
+	At       time.Time   `json:"at"`
+}
+
+// ParamSubscription delivers the changes of the watched parameters until closed.
+type ParamSubscription struct {
+	m     *Manager
+	id    dm.DeviceID
+	names []string
+	ch    chan ParamChange
+	done  chan struct{}
+	stop  func() // Blizzard notification stream, when one was opened
+
+	closeOnce sync.Once
+}
+
+// C returns the change channel; it is closed by Close. Changes are dropped while the channel is full.
+func (w *ParamSubscription) C() <-chan ParamChange { return w.ch }
+
+// Close ends the watch and turns notifications off for names no other watch on the device covers.
+func (w *ParamSubscription) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		if w.stop != nil {
+			w.stop()
+		}
+		w.m.watchMu.Lock()
+		list := w.m.watches[w.id]
+		for i, o := range list {
+			if o == w {
+				list = append(list[:i:i], list[i+1:]...)
+				break
+			}
+		}
+		if len(list) == 0 {
+			delete(w.m.watches, w.id)
+		} else {
+			w.m.watches[w.id] = list
+		}
+		unused := w.m.uncovered(w.id, w.names)
+		close(w.ch)
+		w.m.watchMu.Unlock()
+		if len(unused) > 0 {
+			_, _ = w.m.setParameters(context.Background(), w.id, "", notifyParams(unused, 0), dm.SetOptions{})
+		}
+	})
+	return nil
+}
+
+// matches reports whether name is watched: an exact name or below a watched partial path ("Device.WiFi.").
+func (w *ParamSubscription) matches(name string) bool { return watched(w.names, name) }
+
+// watched reports whether names covers name, exactly or below one of its partial paths.
+func watched(names []string, name string) bool {
+	for _, n := range names {
+		if n == name || (strings.HasSuffix(n, ".") && strings.HasPrefix(name, n)) {
+			return true
+		}
+	}
+	return false
+}
+
+func notifyParams(names []string, notify int) []dm.SetParameter {
+	params := make([]dm.SetParameter, 0, len(names))
+	for _, n := range names {
+		params = append(params, dm.SetParameter{Name: n, Attributes: map[string]interface{}{NotifyAttribute: notify}})
+	}
+	return params
+}
+
+// ParamWatch turns on value-change notifications for names (SET_ATTRIBUTES notify=1) and
+// returns a watch receiving the device's subsequent changes to them. Changes are correlated from
+// the notification events of every Manager event source and, when Blizzard is configured, from the
+// device's Blizzard notifications. The watch ends when ctx is done or it is closed.
+func (m *Manager) ParamWatch(ctx context.Context, id dm.DeviceID, names []string) (*ParamSubscription, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("names required: %w", dm.ErrInvalidParameter)
+	}
+	// watching needs read access only, though turning notifications on is a write
+	if err := m.paramACL.Check(ctx, dm.ParameterRead, names...); err != nil {
+		return nil, err
+	}
+	if _, err := m.setParameters(ctx, id, "", notifyParams(names, 1), dm.SetOptions{}); err != nil {
+		return nil, err
+	}
+	w := &ParamSubscription{m: m, id: id, names: append([]string(nil), names...), ch: make(chan ParamChange, 64), done: make(chan struct{})}
+	var notes dm.EventSubscription
+	if m.opts.BlizzardBaseURL != "" && !(m.mqtt != nil && m.opts.MQTT.RPC) {
+		// best effort: without the gateway, changes still arrive through the other event sources
+		if b, err := m.dialBlizzard(ctx, id, DefaultRPCService); err == nil {
+			// the adapter drops its listeners on Close, so the subscription is left open
+			notes = b.Subscribe(64)
+			w.stop = func() { _ = b.Close() }
+		}
+	}
+	m.watchMu.Lock()
+	m.watches[id] = append(m.watches[id], w)
+	m.watchMu.Unlock()
+	if notes != nil {
+		go func() {
+			for {
+				select {
+				case evt := <-notes.C():
+					m.dispatchChanges(evt)
+				case <-w.done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.Close()
+		case <-w.done:
+		}
+	}()
+	return w, nil
+}
+
+func (m *Manager) runParamWatches(sub dm.EventSubscription) {
+	for evt := range sub.C() {
+		if evt.Kind == dm.EventOnline {
+			m.rearmWatches(evt.DeviceID)
+		}
+		m.dispatchChanges(evt)
+	}
+}
+
+func (m *Manager) dispatchChanges(evt dm.Event) {
+	if evt.Kind != dm.EventNotification {
+		return
+	}
+	m.watchMu.Lock()
+	defer m.watchMu.Unlock()
+	list := m.watches[evt.DeviceID]
+	if len(list) == 0 {
+		return
+	}
+	for _, c := range parseChanges(evt) {
+		for _, w := range list {
+			if w.matches(c.Name) {
+				select {
+				case w.ch <- c:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// parseChanges extracts the parameter changes reported by a notification event.
+func parseChanges(evt dm.Event) []ParamChange {
+	var out []ParamChange
+	for _, c := range events.ParameterChanges(evt.Payload) {
+		out = append(out, ParamChange{DeviceID: evt.DeviceID, Name: c.Name, Value: c.Value, DataType: c.DataType, Source: c.ChangeSource, At: evt.OccurredAt})
+	}
+	return out
+}
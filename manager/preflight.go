@@ -0,0 +1,190 @@
+package manager
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+const (
+	// preflightTimeout bounds each backend request of a preflight.
+	preflightTimeout = 10 * time.Second
+	// Clock skew beyond which a preflight warns, and fails: signed tokens, leases and event
+	// timestamps assume the clocks agree to within seconds. Date headers have 1s resolution.
+	preflightSkewWarn = 5 * time.Second
+	preflightSkewFail = 30 * time.Second
+	// preflightCertWarn is how close to expiry a backend's certificate makes a preflight warn.
+	preflightCertWarn = 14 * 24 * time.Hour
+	// preflightDevice is the device a Tr1d1um probe asks about; Tr1d1um authorizes the request
+	// before finding the device missing, so a 404 proves connectivity and credentials.
+	preflightDevice = "mac:000000000000"
+)
+
+// probe is the endpoint a preflight requests to check a backend.
+type probe struct {
+	backend string
+	url     string
+	auth    dm.AuthStrategy
+}
+
+// Preflight checks that the configured backends can be used: for Talaria, Tr1d1um and
+// xconfadmin, that they answer (connectivity), accept the configured credentials (auth), present
+// a certificate the process trusts (tls) and keep a clock close to this host's (clock); with
+// shared state, that Redis answers. Checks run concurrently and are reported in that order.
+func (m *Manager) Preflight(ctx context.Context) dm.PreflightReport {
+	m.mu.RLock()
+	opts := m.opts
+	m.mu.RUnlock()
+	probes := []probe{{"talaria", opts.TalariaBaseURL + "/api/v2/devices", opts.Auth.Talaria}}
+	for _, base := range opts.Polling.Instances {
+		probes = append(probes, probe{"talaria", base + "/api/v2/devices", opts.Auth.Talaria})
+	}
+	if opts.Tr1d1umBaseURL != "" {
+		probes = append(probes, probe{"tr1d1um", opts.Tr1d1umBaseURL + "/device/" + preflightDevice + "/stat", opts.Auth.Tr1d1um})
+	}
+	if opts.XconfAdminBaseURL != "" {
+		probes = append(probes, probe{"xconfadmin", opts.XconfAdminBaseURL + "/xconfAdminService/model", opts.Auth.XconfAdmin})
+	}
+
+	results := make([][]dm.PreflightCheck, len(probes)+1)
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = m.probe(ctx, p)
+		}()
+	}
+	if m.rdb != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[len(probes)] = []dm.PreflightCheck{m.probeRedis(ctx)}
+		}()
+	}
+	wg.Wait()
+	report := dm.PreflightReport{CheckedAt: time.Now().UTC()}
+	for _, checks := range results {
+		report.Checks = append(report.Checks, checks...)
+	}
+	return report
+}
+
+// probe requests p once, reporting its connectivity, auth, tls and clock checks.
+func (m *Manager) probe(ctx context.Context, p probe) []dm.PreflightCheck {
+	check := func(name, status, detail string) dm.PreflightCheck {
+		return dm.PreflightCheck{Backend: p.backend, Check: name, Target: p.url, Status: status, Detail: detail}
+	}
+	u, err := url.Parse(p.url)
+	if err != nil || u.Host == "" {
+		return []dm.PreflightCheck{check("connectivity", dm.PreflightFail, fmt.Sprintf("invalid URL %q", p.url))}
+	}
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return []dm.PreflightCheck{check("connectivity", dm.PreflightFail, err.Error())}
+	}
+	if p.auth != nil {
+		h, err := p.auth.AuthorizationValue()
+		if err != nil {
+			return []dm.PreflightCheck{check("auth", dm.PreflightFail, "credentials: "+err.Error())}
+		}
+		if h != "" {
+			req.Header.Set("Authorization", h)
+		}
+	}
+	sent := time.Now()
+	resp, err := m.client(preflightTimeout).Do(req)
+	latency := time.Since(sent)
+	if err != nil {
+		var verr *tls.CertificateVerificationError
+		if errors.As(err, &verr) {
+			return []dm.PreflightCheck{
+				check("connectivity", dm.PreflightPass, "reachable; TLS handshake refused"),
+				check("auth", dm.PreflightSkip, ""),
+				check("tls", dm.PreflightFail, verr.Err.Error()),
+				check("clock", dm.PreflightSkip, ""),
+			}
+		}
+		return []dm.PreflightCheck{
+			check("connectivity", dm.PreflightFail, err.Error()),
+			check("auth", dm.PreflightSkip, ""),
+			check("tls", dm.PreflightSkip, ""),
+			check("clock", dm.PreflightSkip, ""),
+		}
+	}
+	resp.Body.Close()
+
+	conn := check("connectivity", dm.PreflightPass, resp.Status)
+	conn.LatencyMS = latency.Milliseconds()
+	if resp.StatusCode >= 500 {
+		conn.Status = dm.PreflightWarn
+	}
+	return []dm.PreflightCheck{
+		conn,
+		authCheck(check, resp.StatusCode, p.auth != nil),
+		tlsCheck(check, resp, time.Now()),
+		clockCheck(check, resp, sent.Add(latency/2)),
+	}
+}
+
+func authCheck(check func(name, status, detail string) dm.PreflightCheck, status int, configured bool) dm.PreflightCheck {
+	switch {
+	case status != http.StatusUnauthorized && status != http.StatusForbidden:
+		return check("auth", dm.PreflightPass, "")
+	case !configured:
+		return check("auth", dm.PreflightFail, fmt.Sprintf("%d without credentials; configure them", status))
+	}
+	return check("auth", dm.PreflightFail, fmt.Sprintf("credentials refused (%d)", status))
+}
+
+// tlsCheck reports the trusted certificate of an https backend, warning when it expires soon.
+func tlsCheck(check func(name, status, detail string) dm.PreflightCheck, resp *http.Response, now time.Time) dm.PreflightCheck {
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return check("tls", dm.PreflightSkip, "plain HTTP")
+	}
+	leaf := resp.TLS.PeerCertificates[0]
+	detail := fmt.Sprintf("trusted; %s expires %s", leaf.Subject.CommonName, leaf.NotAfter.UTC().Format(time.RFC3339))
+	if leaf.NotAfter.Sub(now) < preflightCertWarn {
+		return check("tls", dm.PreflightWarn, detail)
+	}
+	return check("tls", dm.PreflightPass, detail)
+}
+
+// clockCheck compares the backend's Date header with this host's clock at mid-request.
+func clockCheck(check func(name, status, detail string) dm.PreflightCheck, resp *http.Response, local time.Time) dm.PreflightCheck {
+	remote, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return check("clock", dm.PreflightSkip, "no Date header")
+	}
+	skew := remote.Sub(local.Truncate(time.Second)).Round(time.Second)
+	detail := fmt.Sprintf("skew %s", skew)
+	switch abs := max(skew, -skew); {
+	case abs > preflightSkewFail:
+		return check("clock", dm.PreflightFail, detail)
+	case abs > preflightSkewWarn:
+		return check("clock", dm.PreflightWarn, detail)
+	}
+	return check("clock", dm.PreflightPass, detail)
+}
+
+func (m *Manager) probeRedis(ctx context.Context) dm.PreflightCheck {
+	c := dm.PreflightCheck{Backend: "redis", Check: "connectivity"} // no Target: the URL may hold a password
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	sent := time.Now()
+	if err := m.rdb.Ping(ctx).Err(); err != nil {
+		c.Status, c.Detail = dm.PreflightFail, err.Error()
+		return c
+	}
+	c.Status, c.LatencyMS = dm.PreflightPass, time.Since(sent).Milliseconds()
+	return c
+}
@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestPreflight(t *testing.T) {
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// a clock two minutes ahead
+		w.Header().Set("Date", time.Now().Add(2*time.Minute).UTC().Format(http.TimeFormat))
+		w.Write([]byte(`{"devices":[]}`))
+	}))
+	defer talaria.Close()
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer tr1d1um.Close()
+	xconf := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer xconf.Close()
+
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = talaria.URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL + "/api/v3"
+	opts.XconfAdminBaseURL = xconf.URL
+	opts.Auth.Talaria = dm.StaticAuth{Value: "Bearer t"}
+	opts.Auth.Tr1d1um = dm.StaticAuth{Value: "Bearer wrong"}
+	m := newTestManager(t, opts)
+
+	report := m.Preflight(context.Background())
+	got := map[string]string{}
+	for _, c := range report.Checks {
+		got[c.Backend+" "+c.Check] = c.Status
+	}
+	want := map[string]string{
+		"talaria connectivity":    dm.PreflightPass,
+		"talaria auth":            dm.PreflightPass,
+		"talaria tls":             dm.PreflightSkip,
+		"talaria clock":           dm.PreflightFail,
+		"tr1d1um connectivity":    dm.PreflightPass,
+		"tr1d1um auth":            dm.PreflightFail,
+		"tr1d1um clock":           dm.PreflightPass,
+		"xconfadmin connectivity": dm.PreflightPass,
+		"xconfadmin tls":          dm.PreflightFail, // the test server's certificate is not trusted
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q (%+v)", k, got[k], v, report.Checks)
+		}
+	}
+	if report.OK() || len(report.Failed()) != 3 {
+		t.Fatalf("failed = %+v", report.Failed())
+	}
+	if report.Checks[0].Backend != "talaria" || report.Checks[len(report.Checks)-1].Backend != "xconfadmin" {
+		t.Fatalf("checks out of order: %+v", report.Checks)
+	}
+}
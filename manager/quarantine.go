@@ -0,0 +1,217 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// SetQuarantineStore keeps quarantines in store from then on, so RestoreQuarantines brings them
+// back after a restart; without one they are only kept in memory.
+func (m *Manager) SetQuarantineStore(store dm.SubscriptionStore) {
+	m.quarantineMu.Lock()
+	m.quarantineStore = store
+	m.quarantineMu.Unlock()
+}
+
+// Quarantine places q on its device or group until q.Until, replacing an earlier quarantine of
+// the same target. Partner-scoped callers may only quarantine devices in their scope, not groups.
+func (m *Manager) Quarantine(ctx context.Context, q dm.Quarantine) (out dm.Quarantine, err error) {
+	q.DeviceID = q.DeviceID.Canonical()
+	rec := dm.NewAuditRecord(ctx, "quarantine", q.DeviceID)
+	defer func() {
+		if q.DeviceID != "" {
+			m.audit(rec, err)
+		} else {
+			m.auditFleet(rec, err)
+		}
+	}()
+	switch {
+	case (q.DeviceID == "") == (q.Group == ""):
+		return dm.Quarantine{}, fmt.Errorf("quarantine: exactly one of deviceId and group required: %w", dm.ErrInvalidParameter)
+	case !q.Until.After(time.Now()):
+		return dm.Quarantine{}, fmt.Errorf("quarantine: until must be in the future: %w", dm.ErrInvalidParameter)
+	}
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		if q.Group != "" {
+			return dm.Quarantine{}, fmt.Errorf("quarantine of group %s: partner-scoped callers may only quarantine devices: %w", q.Group, dm.ErrAccessDenied)
+		}
+		if _, err := m.Device(ctx, q.DeviceID); err != nil {
+			return dm.Quarantine{}, err
+		}
+	}
+	q.ID = dm.QuarantineID(q.DeviceID, q.Group)
+	q.Actor = dm.ActorFromContext(ctx)
+	q.CreatedAt = time.Now()
+	rec.Detail = q.ID + " until " + q.Until.Format(time.RFC3339)
+	if err := m.persistQuarantine(ctx, q); err != nil {
+		return dm.Quarantine{}, fmt.Errorf("quarantine: store: %w", err)
+	}
+	m.quarantineMu.Lock()
+	if m.quarantines == nil {
+		m.quarantines = make(map[string]dm.Quarantine)
+	}
+	m.quarantines[q.ID] = q
+	m.quarantineMu.Unlock()
+	return q, nil
+}
+
+// Release lifts a quarantine before it expires. Quarantines the caller cannot see (see
+// Quarantines) are reported as dm.ErrQuarantineNotFound.
+func (m *Manager) Release(ctx context.Context, qid string) (err error) {
+	m.quarantineMu.Lock()
+	q, ok := m.quarantines[qid]
+	m.quarantineMu.Unlock()
+	if !ok || !q.Active(time.Now()) || !m.quarantineVisible(ctx, q) {
+		return fmt.Errorf("quarantine %s: %w", qid, dm.ErrQuarantineNotFound)
+	}
+	rec := dm.NewAuditRecord(ctx, "release-quarantine", q.DeviceID)
+	rec.Detail = qid
+	defer func() {
+		if q.DeviceID != "" {
+			m.audit(rec, err)
+		} else {
+			m.auditFleet(rec, err)
+		}
+	}()
+	m.quarantineMu.Lock()
+	delete(m.quarantines, qid)
+	store := m.quarantineStore
+	m.quarantineMu.Unlock()
+	if store != nil {
+		if err := store.Delete(ctx, dm.SubscriptionQuarantine, qid); err != nil {
+			log.Printf("quarantine %s: delete: %v", qid, err)
+		}
+	}
+	return nil
+}
+
+// Quarantines returns the quarantines in force ordered by creation time. Partner-scoped callers
+// only see those of the devices in their scope.
+func (m *Manager) Quarantines(ctx context.Context) []dm.Quarantine {
+	now := time.Now()
+	m.quarantineMu.Lock()
+	var all []dm.Quarantine
+	for id, q := range m.quarantines {
+		if !q.Active(now) {
+			delete(m.quarantines, id) // the store drops it on the next restore
+			continue
+		}
+		all = append(all, q)
+	}
+	m.quarantineMu.Unlock()
+	out := []dm.Quarantine{}
+	for _, q := range all {
+		if m.quarantineVisible(ctx, q) {
+			out = append(out, q)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// QuarantineOf returns the quarantine in force on the device, its own before its groups', or
+// nil. Group quarantines are matched against the metadata of connected devices.
+func (m *Manager) QuarantineOf(id dm.DeviceID) *dm.Quarantine {
+	id = id.Canonical()
+	now := time.Now()
+	m.quarantineMu.Lock()
+	defer m.quarantineMu.Unlock()
+	if len(m.quarantines) == 0 {
+		return nil
+	}
+	if q, ok := m.quarantines[dm.QuarantineID(id, "")]; ok && q.Active(now) {
+		return &q
+	}
+	for _, g := range dm.SplitPartners(m.devices.View().Metadata(string(id))[m.groupMetadata()]) {
+		if q, ok := m.quarantines[dm.QuarantineID("", g)]; ok && q.Active(now) {
+			return &q
+		}
+	}
+	return nil
+}
+
+// CheckQuarantine returns nil when a mutating operation may run on the device: it is not
+// quarantined, or ctx carries dm.WithQuarantineOverride from a caller allowed to override
+// (dm.OverrideAllowed; dm.ErrAccessDenied otherwise). Otherwise it returns a
+// *dm.QuarantineError (matching dm.ErrQuarantined).
+func (m *Manager) CheckQuarantine(ctx context.Context, id dm.DeviceID) error {
+	if dm.QuarantineOverridden(ctx) {
+		if !dm.OverrideAllowed(ctx) {
+			return fmt.Errorf("quarantine override requires the %s role: %w", dm.RoleAdmin, dm.ErrAccessDenied)
+		}
+		return nil
+	}
+	if q := m.QuarantineOf(id); q != nil {
+		return &dm.QuarantineError{DeviceID: id.Canonical(), Quarantine: *q}
+	}
+	return nil
+}
+
+// RestoreQuarantines brings back the quarantines of the SetQuarantineStore store, as left by an
+// earlier process, deleting those that expired meanwhile.
+func (m *Manager) RestoreQuarantines(ctx context.Context) error {
+	m.quarantineMu.Lock()
+	store := m.quarantineStore
+	m.quarantineMu.Unlock()
+	if store == nil {
+		return nil
+	}
+	subs, err := store.List(ctx, dm.SubscriptionQuarantine)
+	if err != nil {
+		return fmt.Errorf("quarantines: restore: %w", err)
+	}
+	for _, s := range subs {
+		var q dm.Quarantine
+		if err := json.Unmarshal(s.Spec, &q); err != nil {
+			log.Printf("quarantine %s: restore: unreadable quarantine", s.ID)
+			continue
+		}
+		if !q.Active(time.Now()) {
+			_ = store.Delete(ctx, s.Kind, s.ID)
+			continue
+		}
+		q.ID = s.ID
+		m.quarantineMu.Lock()
+		if m.quarantines == nil {
+			m.quarantines = make(map[string]dm.Quarantine)
+		}
+		if _, ok := m.quarantines[q.ID]; !ok {
+			m.quarantines[q.ID] = q
+		}
+		m.quarantineMu.Unlock()
+	}
+	return nil
+}
+
+func (m *Manager) persistQuarantine(ctx context.Context, q dm.Quarantine) error {
+	m.quarantineMu.Lock()
+	store := m.quarantineStore
+	m.quarantineMu.Unlock()
+	if store == nil {
+		return nil
+	}
+	spec, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, dm.Subscription{Kind: dm.SubscriptionQuarantine, ID: q.ID, Until: q.Until, Spec: spec})
+}
+
+// quarantineVisible reports whether q is in the caller's partner scope: group quarantines are
+// only visible to unscoped callers.
+func (m *Manager) quarantineVisible(ctx context.Context, q dm.Quarantine) bool {
+	if _, scoped := dm.PartnersFromContext(ctx); !scoped {
+		return true
+	}
+	if q.DeviceID == "" {
+		return false
+	}
+	_, err := m.Device(ctx, q.DeviceID)
+	return err == nil
+}
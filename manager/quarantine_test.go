@@ -0,0 +1,121 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestQuarantine(t *testing.T) {
+	var polls, sets atomic.Int32
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sets.Add(1)
+		w.Write([]byte(`{"statusCode":200}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	store := dm.NewMemorySubscriptionStore()
+	ctx := context.Background()
+	m := newTestManager(t, opts)
+	m.SetQuarantineStore(store)
+	if _, err := m.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	set := func(ctx context.Context, id dm.DeviceID) error {
+		_, err := m.SetParameters(ctx, id, "", []dm.SetParameter{{Name: "Device.WiFi.SSID.1.SSID", Value: "x"}}, dm.SetOptions{})
+		return err
+	}
+
+	if _, err := m.Quarantine(ctx, dm.Quarantine{DeviceID: "mac:aa", Group: "sky", Until: time.Now().Add(time.Hour)}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("two targets: %v", err)
+	}
+	if _, err := m.Quarantine(ctx, dm.Quarantine{DeviceID: "mac:aa"}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("no expiry: %v", err)
+	}
+	q, err := m.Quarantine(ctx, dm.Quarantine{DeviceID: "mac:aa", Reason: "INC-42", Until: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.ID != "device:mac:aa" {
+		t.Fatalf("quarantine ID %q", q.ID)
+	}
+	var qe *dm.QuarantineError
+	if err := set(ctx, "mac:aa"); !errors.Is(err, dm.ErrQuarantined) || !errors.As(err, &qe) || qe.Quarantine.Reason != "INC-42" {
+		t.Fatalf("set on quarantined device: %v", err)
+	}
+	if err := m.Reboot(ctx, "mac:aa"); !errors.Is(err, dm.ErrQuarantined) {
+		t.Fatalf("reboot on quarantined device: %v", err)
+	}
+	if err := set(dm.WithPartners(ctx, []string{"other-partner"}), "mac:aa"); !errors.Is(err, dm.ErrDeviceNotFound) {
+		t.Fatalf("set on a quarantined device outside the caller's partners: %v", err)
+	}
+	if sets.Load() != 0 {
+		t.Fatalf("%d SETs reached the quarantined device", sets.Load())
+	}
+	if _, err := m.SetParameters(ctx, "mac:aa", "", []dm.SetParameter{{Name: "Device.WiFi.SSID.1.SSID", Value: "x"}}, dm.SetOptions{DryRun: true}); errors.Is(err, dm.ErrQuarantined) {
+		t.Fatalf("dry run refused: %v", err)
+	}
+	if err := set(ctx, "mac:bb"); err != nil {
+		t.Fatalf("set on another device: %v", err)
+	}
+
+	// only admins may override
+	override := dm.WithQuarantineOverride(ctx)
+	if err := set(dm.WithRole(override, dm.RoleOperator), "mac:aa"); !errors.Is(err, dm.ErrAccessDenied) {
+		t.Fatalf("operator override: %v", err)
+	}
+	if err := set(dm.WithRole(override, dm.RoleAdmin), "mac:aa"); err != nil {
+		t.Fatalf("admin override: %v", err)
+	}
+
+	// a group quarantine covers the devices carrying the group's metadata value
+	if _, err := m.Quarantine(ctx, dm.Quarantine{Group: "sky", Until: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.QuarantineOf("mac:bb"); got == nil || got.Group != "sky" {
+		t.Fatalf("QuarantineOf(mac:bb) = %+v", got)
+	}
+	scoped := dm.WithPartners(ctx, []string{"comcast"})
+	if _, err := m.Quarantine(scoped, dm.Quarantine{Group: "comcast", Until: time.Now().Add(time.Hour)}); !errors.Is(err, dm.ErrAccessDenied) {
+		t.Fatalf("scoped group quarantine: %v", err)
+	}
+	if got := m.Quarantines(scoped); len(got) != 1 || got[0].DeviceID != "mac:aa" {
+		t.Fatalf("scoped Quarantines = %+v", got)
+	}
+	if err := m.Release(scoped, "group:sky"); !errors.Is(err, dm.ErrQuarantineNotFound) {
+		t.Fatalf("scoped release of a group: %v", err)
+	}
+
+	// a later process restores the quarantines still in force
+	gone := dm.Quarantine{ID: "group:old", Group: "old", Until: time.Now().Add(-time.Minute)}
+	_ = m.persistQuarantine(ctx, gone)
+	m2 := newTestManager(t, opts)
+	m2.SetQuarantineStore(store)
+	if err := m2.RestoreQuarantines(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := m2.Quarantines(ctx); len(got) != 2 {
+		t.Fatalf("restored %+v", got)
+	}
+	if stored, _ := store.List(ctx, dm.SubscriptionQuarantine); len(stored) != 2 {
+		t.Fatalf("expired quarantine kept: %+v", stored)
+	}
+
+	if err := m.Release(ctx, q.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := set(ctx, "mac:aa"); err != nil {
+		t.Fatalf("set after release: %v", err)
+	}
+	if err := m.Release(ctx, q.ID); !errors.Is(err, dm.ErrQuarantineNotFound) {
+		t.Fatalf("second release: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"fmt"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// Reload applies the reloadable parts of opts to the running Manager: device state tuning
+// (Polling.OfflineAfter, Polling.StatSuspects), cache TTLs, backend credentials (Auth and the
+// credentials of partners configured at New) and the allowed translation Services. Every other
+// field takes effect on restart, except Polling.DeviceList: RunPolling adopts it from the
+// intervals channel its caller feeds.
+func (m *Manager) Reload(opts dm.Options) error {
+	for _, svc := range opts.Services {
+		if svc == "" {
+			return fmt.Errorf("services: empty service name: %w", dm.ErrInvalidParameter)
+		}
+	}
+	eachAuth(&opts, func(key string, a *dm.AuthStrategy) {
+		if r := m.auth[key]; r != nil && *a != nil {
+			r.Set(*a)
+		}
+	})
+	services := opts.Services
+	if len(services) == 0 {
+		services = []string{DefaultService}
+	}
+	dataModel, err := m.buildDataModel(m.opts.Auth.Tr1d1um, services)
+	if err != nil {
+		return err
+	}
+	partnerDataModel := make(map[string]map[string]*runtime.DataModelAdapter)
+	for partner, po := range m.opts.Partners {
+		if po.Auth.Tr1d1um == nil {
+			continue
+		}
+		if partnerDataModel[partner], err = m.buildDataModel(po.Auth.Tr1d1um, services); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	m.opts.Services = opts.Services
+	m.dataModel, m.partnerDataModel = dataModel, partnerDataModel
+	m.mu.Unlock()
+
+	m.params.SetTTL(opts.Cache.ParamTTL)
+	m.policies.SetTTL(opts.Cache.PolicyTTL)
+	for _, x := range m.partnerXconf {
+		x.catalog.SetTTL(opts.Cache.PolicyTTL)
+	}
+	if m.xconf != nil {
+		m.xconf.catalog.SetTTL(opts.Cache.PolicyTTL)
+	}
+	m.configs.SetTTL(opts.Cache.ConfigTTL)
+	m.devices.UpdateStateConfig(runtime.StateMachineConfig{OfflineAfter: opts.Polling.OfflineAfter}, opts.Polling.StatSuspects)
+	return nil
+}
+
+// wrapAuth replaces each configured credential in opts with a ReloadableAuth so Reload can rotate
+// it in the adapters built from opts, returning the wrappers by eachAuth key.
+func wrapAuth(opts *dm.Options) map[string]*dm.ReloadableAuth {
+	out := make(map[string]*dm.ReloadableAuth)
+	eachAuth(opts, func(key string, a *dm.AuthStrategy) {
+		if *a != nil {
+			r := dm.NewReloadableAuth(*a)
+			out[key], *a = r, r
+		}
+	})
+	return out
+}
+
+// eachAuth calls visit with a key and a pointer to every credential in opts; partner entries are
+// written back, so opts.Partners is replaced with a copy.
+func eachAuth(opts *dm.Options, visit func(key string, a *dm.AuthStrategy)) {
+	visit("talaria", &opts.Auth.Talaria)
+	visit("tr1d1um", &opts.Auth.Tr1d1um)
+	visit("xconf", &opts.Auth.XconfAdmin)
+	visit("blizzard", &opts.Auth.Blizzard)
+	visit("codex", &opts.Auth.Codex)
+	visit("caduceus", &opts.Auth.Caduceus)
+	partners := make(map[string]dm.PartnerOptions, len(opts.Partners))
+	for p, po := range opts.Partners {
+		visit("partner "+p+" tr1d1um", &po.Auth.Tr1d1um)
+		visit("partner "+p+" xconf", &po.Auth.XconfAdmin)
+		partners[p] = po
+	}
+	opts.Partners = partners
+}
@@ -0,0 +1,72 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+type heldOperation struct {
+	dm.DeviceOperation
+	released chan struct{}
+}
+
+// Exclusive holds id for an exclusive operation of kind (one of the dm.Operation kinds) until
+// release is called. While another operation holds the device it waits up to
+// Options.Serializer.Wait for it to finish, then fails with a *dm.OperationConflictError naming
+// the holder. A done ctx also ends the wait.
+func (m *Manager) Exclusive(ctx context.Context, id dm.DeviceID, kind, detail string) (release func(), err error) {
+	id = id.Canonical()
+	op := &heldOperation{DeviceOperation: dm.DeviceOperation{Kind: kind, Actor: dm.ActorFromContext(ctx), Detail: detail}, released: make(chan struct{})}
+	var deadline <-chan time.Time
+	if wait := m.opts.Serializer.Wait; wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		deadline = t.C
+	}
+	for {
+		m.opMu.Lock()
+		holder, busy := m.ops[id]
+		if !busy {
+			if m.ops == nil {
+				m.ops = make(map[dm.DeviceID]*heldOperation)
+			}
+			op.StartedAt = time.Now().UTC()
+			m.ops[id] = op
+			m.opMu.Unlock()
+			return func() {
+				m.opMu.Lock()
+				if m.ops[id] == op {
+					delete(m.ops, id)
+					close(op.released)
+				}
+				m.opMu.Unlock()
+			}, nil
+		}
+		m.opMu.Unlock()
+		conflict := &dm.OperationConflictError{DeviceID: id, Requested: kind, Holder: holder.DeviceOperation}
+		if deadline == nil {
+			return nil, conflict
+		}
+		select {
+		case <-holder.released:
+		case <-deadline:
+			return nil, conflict
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// HeldOperation returns the exclusive operation holding id, if any.
+func (m *Manager) HeldOperation(id dm.DeviceID) (dm.DeviceOperation, bool) {
+	id = id.Canonical()
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	op, ok := m.ops[id]
+	if !ok {
+		return dm.DeviceOperation{}, false
+	}
+	return op.DeviceOperation, true
+}
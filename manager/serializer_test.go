@@ -0,0 +1,85 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestExclusiveOperations(t *testing.T) {
+	var polls, sets atomic.Int32
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sets.Add(1)
+		w.Write([]byte(`{"statusCode":200}`))
+	}))
+	defer tr1d1um.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	m := newTestManager(t, opts)
+	ctx := dm.WithActor(context.Background(), "alice")
+
+	release, err := m.Exclusive(ctx, "mac:aa", dm.OperationFirmwareUpdate, "u-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conflict *dm.OperationConflictError
+	err = m.FactoryReset(context.Background(), "mac:aa", "mac:aa")
+	if !errors.Is(err, dm.ErrConflict) || !errors.As(err, &conflict) {
+		t.Fatalf("factory reset during a firmware update: %v", err)
+	}
+	if h := conflict.Holder; h.Kind != dm.OperationFirmwareUpdate || h.Actor != "alice" || h.Detail != "u-1" || conflict.Requested != dm.OperationFactoryReset {
+		t.Fatalf("conflict %+v", conflict)
+	}
+	if sets.Load() != 0 {
+		t.Fatal("refused factory reset reached the device")
+	}
+	if err := m.Reboot(context.Background(), "mac:bb"); err != nil {
+		t.Fatalf("other devices are not held: %v", err)
+	}
+	release()
+	release() // a second release is harmless
+	if _, held := m.HeldOperation("mac:aa"); held {
+		t.Fatal("still held after release")
+	}
+
+	// spellings of one device conflict
+	release, err = m.Exclusive(ctx, "mac:AABBCCDDEEFF", dm.OperationFirmwareUpdate, "u-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reboot(context.Background(), "mac:aa:bb:cc:dd:ee:ff"); !errors.Is(err, dm.ErrConflict) {
+		t.Fatalf("reboot of another spelling during a firmware update: %v", err)
+	}
+	if _, held := m.HeldOperation("mac:aabbccddeeff"); !held {
+		t.Fatal("canonical spelling not held")
+	}
+	release()
+
+	// with a wait, the later operation queues until the holder finishes
+	m.opts.Serializer.Wait = 2 * time.Second
+	release, _ = m.Exclusive(ctx, "mac:aa", dm.OperationLogUpload, "")
+	done := make(chan error, 1)
+	go func() { done <- m.Reboot(context.Background(), "mac:aa") }()
+	time.Sleep(50 * time.Millisecond)
+	if op, _ := m.HeldOperation("mac:aa"); op.Kind != dm.OperationLogUpload {
+		t.Fatalf("reboot overtook the log upload: %+v", op)
+	}
+	release()
+	if err := <-done; err != nil {
+		t.Fatalf("queued reboot: %v", err)
+	}
+	release, _ = m.Exclusive(ctx, "mac:aa", dm.OperationLogUpload, "")
+	defer release()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Exclusive(canceled, "mac:aa", dm.OperationReboot, ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled wait: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package manager
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// Session TTL bounds: the TTL OpenSession applies when given none, and the longest it accepts.
+const (
+	DefaultSessionTTL = 5 * time.Minute
+	MaxSessionTTL     = time.Hour
+)
+
+// maxSessions bounds the sessions open at once, each holding a Blizzard websocket.
+const maxSessions = 256
+
+// RPCSession is a Blizzard connection to a device service held open for a run of RPCs. Each
+// call through it pushes ExpiresAt a TTL further; an idle session is closed when it expires.
+type RPCSession struct {
+	Token     string        `json:"token"` // bearer secret naming the session in CallSession
+	DeviceID  dm.DeviceID   `json:"deviceId"`
+	Service   string        `json:"service"`
+	TTL       time.Duration `json:"-"`
+	CreatedAt time.Time     `json:"createdAt"`
+	ExpiresAt time.Time     `json:"expiresAt"`
+	Calls     int           `json:"calls"`
+}
+
+type rpcSession struct {
+	RPCSession
+	b     *runtime.BlizzardAdapter
+	timer *time.Timer
+}
+
+// OpenSession connects to a device service through Blizzard (empty service selects
+// DefaultRPCService) and keeps the connection for ttl (DefaultSessionTTL when not positive, at
+// most MaxSessionTTL) after the last call made with CallSession.
+func (m *Manager) OpenSession(ctx context.Context, id dm.DeviceID, service string, ttl time.Duration) (RPCSession, error) {
+	if m.opts.BlizzardBaseURL == "" {
+		return RPCSession{}, dm.ErrBackendUnavailable
+	}
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		if _, err := m.Device(ctx, id); err != nil {
+			return RPCSession{}, err
+		}
+	}
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	if ttl > MaxSessionTTL {
+		return RPCSession{}, fmt.Errorf("session ttl %s: at most %s: %w", ttl, MaxSessionTTL, dm.ErrInvalidParameter)
+	}
+	if service == "" {
+		service = DefaultRPCService
+	}
+	m.sessionMu.Lock()
+	full := len(m.sessions) >= maxSessions
+	m.sessionMu.Unlock()
+	if full {
+		return RPCSession{}, fmt.Errorf("%d sessions open: %w", maxSessions, dm.ErrConflict)
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return RPCSession{}, err
+	}
+
+	rec := dm.NewAuditRecord(ctx, "session-open", id)
+	rec.Detail = service
+	dialCtx, cancel := withTimeout(ctx, m.opts.RPCTimeout, dm.DefaultRPCTimeout)
+	defer cancel()
+	b, err := m.dialBlizzard(dialCtx, id, service)
+	m.record(rec, err)
+	if err != nil {
+		return RPCSession{}, fmt.Errorf("blizzard connect: %w", err)
+	}
+	now := time.Now().UTC()
+	s := &rpcSession{RPCSession: RPCSession{Token: hex.EncodeToString(token), DeviceID: id, Service: service, TTL: ttl, CreatedAt: now, ExpiresAt: now.Add(ttl)}, b: b}
+	m.sessionMu.Lock()
+	if m.sessions == nil {
+		m.sessions = make(map[string]*rpcSession)
+	}
+	m.sessions[s.Token] = s
+	s.timer = time.AfterFunc(ttl, func() { m.dropSession(s.Token, s) })
+	m.sessionMu.Unlock()
+	return s.RPCSession, nil
+}
+
+// CallSession issues an RPC through the session named by token, which must have been opened for
+// id. An expired or closed session, or one whose connection could not be restored, is
+// ErrSessionNotFound.
+func (m *Manager) CallSession(ctx context.Context, id dm.DeviceID, token string, call runtime.BlizzardCall) (*runtime.BlizzardResult, error) {
+	s, err := m.session(ctx, id, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.CheckQuarantine(ctx, id); err != nil {
+		return nil, err
+	}
+	if s.b.Closed() {
+		m.dropSession(token, s)
+		return nil, fmt.Errorf("session for %s lost its connection: %w", id, dm.ErrSessionNotFound)
+	}
+	m.sessionMu.Lock()
+	s.Calls++
+	s.ExpiresAt = time.Now().UTC().Add(s.TTL)
+	s.timer.Reset(s.TTL)
+	m.sessionMu.Unlock()
+	return m.call(ctx, id, s.Service, call, nil, s)
+}
+
+// Session returns the state of the session named by token, opened for id.
+func (m *Manager) Session(ctx context.Context, id dm.DeviceID, token string) (RPCSession, error) {
+	s, err := m.session(ctx, id, token)
+	if err != nil {
+		return RPCSession{}, err
+	}
+	m.sessionMu.Lock()
+	defer m.sessionMu.Unlock()
+	return s.RPCSession, nil
+}
+
+// CloseSession closes the session named by token, opened for id.
+func (m *Manager) CloseSession(ctx context.Context, id dm.DeviceID, token string) error {
+	s, err := m.session(ctx, id, token)
+	if err != nil {
+		return err
+	}
+	m.dropSession(token, s)
+	rec := dm.NewAuditRecord(ctx, "session-close", id)
+	rec.Detail = s.Service
+	m.record(rec, nil)
+	return nil
+}
+
+// session looks up the session named by token for id, a device the caller must be able to see.
+func (m *Manager) session(ctx context.Context, id dm.DeviceID, token string) (*rpcSession, error) {
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		if _, err := m.Device(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	m.sessionMu.Lock()
+	defer m.sessionMu.Unlock()
+	s, ok := m.sessions[token]
+	if !ok || s.DeviceID != id {
+		return nil, fmt.Errorf("session for %s: %w", id, dm.ErrSessionNotFound)
+	}
+	return s, nil
+}
+
+// dropSession forgets s and closes its connection, unless token names another session by now.
+func (m *Manager) dropSession(token string, s *rpcSession) {
+	m.sessionMu.Lock()
+	if m.sessions[token] != s {
+		m.sessionMu.Unlock()
+		return
+	}
+	delete(m.sessions, token)
+	s.timer.Stop()
+	m.sessionMu.Unlock()
+	_ = s.b.Close()
+}
+
+func (m *Manager) closeSessions() {
+	m.sessionMu.Lock()
+	open := m.sessions
+	m.sessions = nil
+	m.sessionMu.Unlock()
+	for _, s := range open {
+		s.timer.Stop()
+		_ = s.b.Close()
+	}
+}
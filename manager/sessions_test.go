@@ -0,0 +1,92 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+func TestRPCSession(t *testing.T) {
+	talaria := httptest.NewServer(http.NotFoundHandler())
+	defer talaria.Close()
+	var dials atomic.Int32
+	upgrader := websocket.Upgrader{}
+	gw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dials.Add(1)
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			var req struct {
+				ID string `json:"id"`
+			}
+			if c.ReadJSON(&req) != nil {
+				return
+			}
+			c.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":"`+req.ID+`","result":"pong"}`))
+		}
+	}))
+	defer gw.Close()
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = talaria.URL
+	opts.BlizzardBaseURL = "ws" + strings.TrimPrefix(gw.URL, "http")
+	m := newTestManager(t, opts)
+	ctx := context.Background()
+
+	if _, err := m.OpenSession(ctx, "mac:0000000000a1", "", 2*time.Hour); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("ttl over the maximum: %v", err)
+	}
+	s, err := m.OpenSession(ctx, "mac:0000000000a1", "", 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		res, err := m.CallSession(ctx, "mac:0000000000a1", s.Token, runtime.BlizzardCall{Method: "ping"})
+		if err != nil || string(res.Result) != `"pong"` {
+			t.Fatalf("call %d: %v %+v", i, err, res)
+		}
+	}
+	if n := dials.Load(); n != 1 {
+		t.Fatalf("%d dials for three calls, want the session's one", n)
+	}
+	if got, err := m.Session(ctx, "mac:0000000000a1", s.Token); err != nil || got.Calls != 3 || !got.ExpiresAt.After(s.ExpiresAt) {
+		t.Fatalf("session %+v %v", got, err)
+	}
+	if _, err := m.CallSession(ctx, "mac:0000000000b1", s.Token, runtime.BlizzardCall{Method: "ping"}); !errors.Is(err, dm.ErrSessionNotFound) {
+		t.Fatalf("token used for another device: %v", err)
+	}
+
+	// idle past its TTL, the session is closed
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := m.Session(ctx, "mac:0000000000a1", s.Token); errors.Is(err, dm.ErrSessionNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("session did not expire")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s, err = m.OpenSession(ctx, "mac:0000000000a1", "", 0)
+	if err != nil || s.ExpiresAt.Sub(s.CreatedAt) != DefaultSessionTTL {
+		t.Fatalf("default ttl: %+v %v", s, err)
+	}
+	if err := m.CloseSession(ctx, "mac:0000000000a1", s.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CallSession(ctx, "mac:0000000000a1", s.Token, runtime.BlizzardCall{Method: "ping"}); !errors.Is(err, dm.ErrSessionNotFound) {
+		t.Fatalf("closed session: %v", err)
+	}
+}
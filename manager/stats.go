@@ -0,0 +1,112 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// ChurnWindow is the period FleetStats.Churn covers.
+const ChurnWindow = time.Hour
+
+// FleetStats aggregates the fleet as Stats computes it from the device snapshot, the connectivity
+// state machine and the events this replica has seen.
+type FleetStats struct {
+	Devices    int            `json:"devices"`              // tracked devices, offline ones included
+	ByStatus   map[string]int `json:"byStatus"`             // online, suspect, offline
+	ByModel    map[string]int `json:"byModel,omitempty"`    // of devices reporting dm.MetadataModel
+	ByFirmware map[string]int `json:"byFirmware,omitempty"` // of devices reporting dm.MetadataFirmware
+	Churn      Churn          `json:"churn"`
+	// OpenCircuits counts devices whose circuit breaker is failing calls fast.
+	OpenCircuits int                      `json:"openCircuits"`
+	Backends     map[string]BackendHealth `json:"backends"`
+	// Instances reports the Talaria instances devices were routed to, with Options.Routing; only
+	// unscoped callers see them.
+	Instances []runtime.InstanceHealth `json:"instances,omitempty"`
+}
+
+// Churn counts online and offline transitions over ChurnWindow; Rate is transitions per device.
+type Churn struct {
+	Window      string  `json:"window"`
+	Transitions int     `json:"transitions"`
+	Rate        float64 `json:"rate"`
+}
+
+// BackendHealth summarizes one backend. Talaria reports the outcome of the latest poll; the others
+// report whether they are configured.
+type BackendHealth struct {
+	Configured bool       `json:"configured"`
+	LastPoll   *time.Time `json:"lastPoll,omitempty"`
+	LastError  string     `json:"lastError,omitempty"`
+}
+
+// Stats aggregates the devices visible to the caller. Offline devices no longer in the snapshot
+// carry no partner metadata, so partner-scoped callers only see devices in the latest poll.
+func (m *Manager) Stats(ctx context.Context) FleetStats {
+	_, scoped := dm.PartnersFromContext(ctx)
+	view := m.devices.View()
+	counted := make(map[dm.DeviceID]bool)
+	out := FleetStats{ByStatus: make(map[string]int), ByModel: make(map[string]int), ByFirmware: make(map[string]int)}
+	for id, status := range m.devices.Statuses() {
+		meta := view.Metadata(string(id))
+		if scoped && (meta == nil || !visible(ctx, dm.DeviceState{ID: id, Metadata: meta})) {
+			continue
+		}
+		counted[id] = true
+		out.Devices++
+		out.ByStatus[string(status)]++
+		if v := meta[dm.MetadataModel]; v != "" {
+			out.ByModel[v]++
+		}
+		if v := meta[dm.MetadataFirmware]; v != "" {
+			out.ByFirmware[v]++
+		}
+	}
+	out.Churn = Churn{Window: ChurnWindow.String()}
+	out.Churn.Transitions = m.recent.Count(time.Now().Add(-ChurnWindow), func(e dm.Event) bool {
+		return (e.Kind == dm.EventOnline || e.Kind == dm.EventOffline) && counted[e.DeviceID]
+	})
+	if out.Devices > 0 {
+		out.Churn.Rate = float64(out.Churn.Transitions) / float64(out.Devices)
+	}
+	for _, id := range m.breaker.Open() {
+		if counted[id] || !scoped {
+			out.OpenCircuits++
+		}
+	}
+	out.Backends = m.backendHealth()
+	if m.router != nil && !scoped {
+		out.Instances = m.router.Instances()
+	}
+	return out
+}
+
+// Backends reports the health of every backend, as FleetStats.Backends does, without aggregating
+// the fleet.
+func (m *Manager) Backends() map[string]BackendHealth { return m.backendHealth() }
+
+func (m *Manager) backendHealth() map[string]BackendHealth {
+	m.pollMu.Lock()
+	talaria := BackendHealth{Configured: true}
+	if !m.lastPoll.IsZero() {
+		at := m.lastPoll
+		talaria.LastPoll = &at
+	}
+	if m.lastPollErr != nil {
+		talaria.LastError = m.lastPollErr.Error()
+	}
+	m.pollMu.Unlock()
+	return map[string]BackendHealth{
+		"talaria":  talaria,
+		"tr1d1um":  {Configured: m.opts.Tr1d1umBaseURL != ""},
+		"xconf":    {Configured: m.opts.XconfAdminBaseURL != ""},
+		"blizzard": {Configured: m.opts.BlizzardBaseURL != ""},
+		"codex":    {Configured: m.codex != nil},
+		"caduceus": {Configured: m.caduceus != nil},
+		"petasos":  {Configured: m.router != nil && m.opts.Routing.PetasosURL != ""},
+		"mqtt":     {Configured: m.mqtt != nil},
+		"usp":      {Configured: m.usp != nil},
+	}
+}
@@ -0,0 +1,140 @@
+package manager
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// Stats history defaults.
+const (
+	DefaultStatsRetention     = 24 * time.Hour // Options.StatsRetention when unset
+	DefaultStatsHistoryWindow = 24 * time.Hour // StatsHistory's window when unset
+)
+
+// StatsSample is the fleet at one point of StatsHistory: the device counts after a poll and the
+// connectivity transitions since the previous sample.
+type StatsSample struct {
+	At          time.Time `json:"at"`
+	Devices     int       `json:"devices"` // tracked devices, offline ones included
+	Online      int       `json:"online"`
+	Suspect     int       `json:"suspect"`
+	Offline     int       `json:"offline"`
+	WentOnline  int       `json:"wentOnline"`
+	WentOffline int       `json:"wentOffline"`
+}
+
+func (s *StatsSample) add(o StatsSample) {
+	s.Devices += o.Devices
+	s.Online += o.Online
+	s.Suspect += o.Suspect
+	s.Offline += o.Offline
+	s.WentOnline += o.WentOnline
+	s.WentOffline += o.WentOffline
+}
+
+// statsPoint is a sample broken down by the devices' partner IDs, so it can be summed for any
+// partner scope without counting a device twice.
+type statsPoint struct {
+	at     time.Time
+	groups map[string]StatsSample // by the device's partner IDs, comma-joined
+}
+
+// statsHistory keeps the samples of the last retention period.
+type statsHistory struct {
+	retention time.Duration
+
+	mu      sync.Mutex
+	points  []statsPoint // oldest first
+	journal uint64       // journal position of the latest sample
+}
+
+// recordStats samples the fleet after a successful poll. Transitions come from the change feed's
+// journal, which holds the devices' partners even after they have gone offline.
+func (m *Manager) recordStats() {
+	h := &m.statsHistory
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now().UTC()
+	p := statsPoint{at: now, groups: make(map[string]StatsSample)}
+	view := m.devices.View()
+	for id, status := range m.devices.Statuses() {
+		key := partnerKey(dm.SplitPartners(view.Metadata(string(id))[dm.MetadataPartnerIDs]))
+		g := p.groups[key]
+		g.Devices++
+		switch status {
+		case runtime.StatusOnline:
+			g.Online++
+		case runtime.StatusSuspect:
+			g.Suspect++
+		case runtime.StatusOffline:
+			g.Offline++
+		}
+		p.groups[key] = g
+	}
+	page, _ := m.journal.Since(h.journal, 0)
+	for _, e := range page.Entries {
+		key := partnerKey(e.Partners)
+		g := p.groups[key]
+		switch e.Kind {
+		case dm.EventOnline:
+			g.WentOnline++
+		case dm.EventOffline:
+			g.WentOffline++
+		}
+		p.groups[key] = g
+	}
+	h.journal = page.Next
+	retention := h.retention
+	if retention <= 0 {
+		retention = DefaultStatsRetention
+	}
+	cut := 0
+	for cut < len(h.points) && now.Sub(h.points[cut].at) > retention {
+		cut++
+	}
+	h.points = append(h.points[cut:], p)
+}
+
+func partnerKey(partners []string) string { return strings.Join(partners, ",") }
+
+// StatsHistory returns the fleet samples of the last window (DefaultStatsHistoryWindow when zero),
+// oldest first. A sample is taken after every successful poll and kept for
+// Options.StatsRetention; with step set, the samples within each step are merged into one with
+// the counts of the last and the transitions of all of them. Partner-scoped callers only see
+// their partners' devices.
+func (m *Manager) StatsHistory(ctx context.Context, window, step time.Duration) []StatsSample {
+	if window <= 0 {
+		window = DefaultStatsHistoryWindow
+	}
+	scope, scoped := dm.PartnersFromContext(ctx)
+	since := time.Now().Add(-window)
+	h := &m.statsHistory
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := []StatsSample{}
+	for _, p := range h.points {
+		if p.at.Before(since) {
+			continue
+		}
+		s := StatsSample{At: p.at}
+		for key, g := range p.groups {
+			if scoped && !dm.PartnerAllowed(scope, dm.SplitPartners(key)) {
+				continue
+			}
+			s.add(g)
+		}
+		if n := len(out); step > 0 && n > 0 && p.at.Truncate(step).Equal(out[n-1].At.Truncate(step)) {
+			s.WentOnline += out[n-1].WentOnline
+			s.WentOffline += out[n-1].WentOffline
+			out[n-1] = s
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
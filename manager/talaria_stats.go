@@ -0,0 +1,177 @@
+package manager
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// Draining detection: an instance holding less than DrainRatio of its peak device count over
+// DrainWindow is reported as draining.
+const (
+	DrainWindow = time.Hour
+	DrainRatio  = 0.5
+)
+
+// Sources of TalariaStats counts.
+const (
+	TalariaSourcePolling = "polling" // the device lists of Options.Polling.Instances
+	TalariaSourceRouting = "routing" // devices resolved by the router, with Options.Routing
+)
+
+// TalariaStats is the device connection heatmap by Talaria instance. Skew is (max-min)/mean of the
+// instances' device counts, 0 when perfectly balanced; uneven hashing shows as a lasting skew and
+// a draining instance as a count falling well below its recent peak.
+type TalariaStats struct {
+	Source    string                 `json:"source,omitempty"` // TalariaSourcePolling or TalariaSourceRouting; empty when neither is set up
+	Devices   int                    `json:"devices"`
+	Mean      float64                `json:"mean"`
+	Skew      float64                `json:"skew"`
+	Instances []TalariaInstanceStats `json:"instances"`
+}
+
+// TalariaInstanceStats is one instance of TalariaStats. Deviation is its count's relative
+// distance from the mean, e.g. 0.25 for a quarter above it.
+type TalariaInstanceStats struct {
+	Instance  string     `json:"instance"`
+	Devices   int        `json:"devices"`
+	Share     float64    `json:"share"` // of all devices
+	Deviation float64    `json:"deviation"`
+	Peak      int        `json:"peak"` // highest count over DrainWindow
+	Draining  bool       `json:"draining"`
+	LastPoll  *time.Time `json:"lastPoll,omitempty"`  // last successful device list poll
+	LastError string     `json:"lastError,omitempty"` // of the latest poll
+	Misplaced int        `json:"misplaced,omitempty"` // devices Options.Sharding places elsewhere
+}
+
+// talariaHistory keeps per-instance device counts of the polls of the last DrainWindow, for the
+// instances' peaks.
+type talariaHistory struct {
+	mu     sync.Mutex
+	points []talariaPoint // oldest first
+}
+
+type talariaPoint struct {
+	at     time.Time
+	groups map[string]map[string]int // device count by partner key (see statsPoint), then instance
+}
+
+// recordTalaria samples the online devices of each instance after a successful poll; suspects,
+// missing from their instance's list, are no longer counted.
+func (m *Manager) recordTalaria() {
+	if len(m.opts.Polling.Instances) == 0 {
+		return
+	}
+	now := time.Now()
+	p := talariaPoint{at: now, groups: make(map[string]map[string]int)}
+	view := m.devices.View()
+	for id, status := range m.devices.Statuses() {
+		if status != runtime.StatusOnline {
+			continue
+		}
+		meta := view.Metadata(string(id))
+		instance := meta[dm.MetadataTalariaInstance]
+		if instance == "" {
+			continue
+		}
+		key := partnerKey(dm.SplitPartners(meta[dm.MetadataPartnerIDs]))
+		if p.groups[key] == nil {
+			p.groups[key] = make(map[string]int)
+		}
+		p.groups[key][instance]++
+	}
+	h := &m.talariaHistory
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cut := 0
+	for cut < len(h.points) && now.Sub(h.points[cut].at) > DrainWindow {
+		cut++
+	}
+	h.points = append(h.points[cut:], p)
+}
+
+// TalariaStats reports how the devices visible to the caller spread over the Talaria instances,
+// from the latest poll with Options.Polling.Instances or else, for unscoped callers, from the
+// devices the router currently resolves.
+func (m *Manager) TalariaStats(ctx context.Context) TalariaStats {
+	scope, scoped := dm.PartnersFromContext(ctx)
+	if len(m.opts.Polling.Instances) == 0 {
+		out := TalariaStats{Instances: []TalariaInstanceStats{}}
+		if m.router == nil || scoped {
+			return out
+		}
+		out.Source = TalariaSourceRouting
+		for _, h := range m.router.Instances() {
+			out.Instances = append(out.Instances, TalariaInstanceStats{Instance: h.Instance, Devices: h.Devices, LastError: h.LastError})
+		}
+		out.balance()
+		return out
+	}
+
+	count := func(p talariaPoint) map[string]int {
+		sum := make(map[string]int)
+		for key, g := range p.groups {
+			if scoped && !dm.PartnerAllowed(scope, dm.SplitPartners(key)) {
+				continue
+			}
+			for instance, n := range g {
+				sum[instance] += n
+			}
+		}
+		return sum
+	}
+	current, peak := map[string]int{}, map[string]int{}
+	h := &m.talariaHistory
+	h.mu.Lock()
+	since := time.Now().Add(-DrainWindow)
+	for i, p := range h.points {
+		if p.at.Before(since) {
+			continue
+		}
+		counts := count(p)
+		for instance, n := range counts {
+			peak[instance] = max(peak[instance], n)
+		}
+		if i == len(h.points)-1 {
+			current = counts
+		}
+	}
+	h.mu.Unlock()
+
+	out := TalariaStats{Source: TalariaSourcePolling, Instances: []TalariaInstanceStats{}}
+	for _, p := range m.devices.InstancePolls() {
+		s := TalariaInstanceStats{Instance: p.Instance, Devices: current[p.Instance], Peak: peak[p.Instance], LastPoll: p.LastSuccess, LastError: p.LastError, Misplaced: p.Misplaced}
+		s.Draining = float64(s.Devices) < DrainRatio*float64(s.Peak)
+		out.Instances = append(out.Instances, s)
+	}
+	out.balance()
+	return out
+}
+
+// balance fills in the totals and each instance's share and deviation.
+func (s *TalariaStats) balance() {
+	sort.Slice(s.Instances, func(i, j int) bool { return s.Instances[i].Instance < s.Instances[j].Instance })
+	if len(s.Instances) == 0 {
+		return
+	}
+	lo, hi := math.MaxInt, 0
+	for _, in := range s.Instances {
+		s.Devices += in.Devices
+		lo, hi = min(lo, in.Devices), max(hi, in.Devices)
+	}
+	if s.Devices == 0 {
+		return
+	}
+	s.Mean = float64(s.Devices) / float64(len(s.Instances))
+	s.Skew = float64(hi-lo) / s.Mean
+	for i := range s.Instances {
+		in := &s.Instances[i]
+		in.Share = float64(in.Devices) / float64(s.Devices)
+		in.Deviation = (float64(in.Devices) - s.Mean) / s.Mean
+	}
+}
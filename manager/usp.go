@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// useUSP starts the USP controller on the MQTT MTP when Options.USP.ControllerTopic is set, and on
+// the WebSocket MTP served by USPHandler otherwise.
+func (m *Manager) useUSP() error {
+	c := m.opts.USP
+	var mtp runtime.MTP
+	if c.ControllerTopic != "" {
+		if m.mqttClient == nil {
+			return errors.New("usp: ControllerTopic requires MQTT.Broker")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		mq, err := runtime.NewMQTTMTP(ctx, runtime.MQTTMTPOptions{Client: m.mqttClient, ControllerTopic: c.ControllerTopic, AgentTopic: c.AgentTopic, QoS: m.opts.MQTT.QoS})
+		if err != nil {
+			return fmt.Errorf("usp: %w", err)
+		}
+		mtp = mq
+	} else {
+		m.uspWS = runtime.NewWebSocketMTP()
+		if m.faults != nil {
+			m.uspWS.SetFrameFilter(m.faults.Frame)
+		}
+		mtp = m.uspWS
+	}
+	a, err := runtime.NewUSPAdapter(runtime.USPOptions{EndpointID: c.EndpointID, MTP: mtp, Timeout: c.Timeout, Retry: m.opts.Retry})
+	if err != nil {
+		_ = mtp.Close()
+		return fmt.Errorf("usp: %w", err)
+	}
+	m.usp = a
+	return nil
+}
+
+// USPHandler accepts agent-initiated USP WebSocket connections; nil unless the USP controller runs
+// on the WebSocket MTP. Agents do not carry API credentials, so serve it on a listener secured for
+// agents (e.g. mutual TLS) rather than behind the API's partner and role checks.
+func (m *Manager) USPHandler() http.Handler {
+	if m.uspWS == nil {
+		return nil
+	}
+	return m.uspWS
+}
+
+// uspAgent reports whether id is routed to the USP controller. USP agents carry no partner IDs,
+// so like other devices without partner information they are only visible to wildcard scopes.
+func (m *Manager) uspAgent(ctx context.Context, id dm.DeviceID) (bool, error) {
+	if m.usp == nil || !runtime.IsUSPEndpoint(id) {
+		return false, nil
+	}
+	if scope, ok := dm.PartnersFromContext(ctx); ok && !dm.PartnerAllowed(scope, nil) {
+		return true, dm.ErrDeviceNotFound
+	}
+	return true, nil
+}
+
+// Operate invokes a USP command (e.g. "Device.Reboot()") on an agent.
+func (m *Manager) Operate(ctx context.Context, id dm.DeviceID, command string, args map[string]string) (res *runtime.OperateResult, err error) {
+	agent, err := m.uspAgent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !agent {
+		if m.usp == nil {
+			return nil, dm.ErrBackendUnavailable
+		}
+		return nil, fmt.Errorf("%s is not a USP endpoint ID: %w", id, dm.ErrInvalidParameter)
+	}
+	rec := dm.NewAuditRecord(ctx, "operate", id)
+	rec.Detail = command
+	defer func() { m.audit(rec, err) }()
+	if err := m.CheckQuarantine(ctx, id); err != nil {
+		return nil, err
+	}
+	done, err := m.guard(ctx, id, "operate")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { done(err) }()
+	ctx, cancel := withTimeout(ctx, m.opts.RPCTimeout, dm.DefaultRPCTimeout)
+	defer cancel()
+	return m.usp.Operate(ctx, id, command, args)
+}
+
+// uspService keys cached USP parameter values apart from the Tr1d1um translation services.
+const uspService = "usp"
+
+// uspGetter adapts USPAdapter.Get to the data model adapter's signature for getParameters.
+type uspGetter struct{ a *runtime.USPAdapter }
+
+func (g uspGetter) Get(ctx context.Context, id dm.DeviceID, names []string, _ dm.GetOptions) (*runtime.GetResult, error) {
+	return g.a.Get(ctx, id, names)
+}
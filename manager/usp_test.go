@@ -0,0 +1,164 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+	"github.com/xmidt-org/talaria/devicemgr/usp"
+)
+
+const testAgent dm.DeviceID = "os::001122-SN1"
+
+// dialUSPAgent dials the Manager's USP WebSocket MTP as testAgent and answers each request with
+// respond. It returns a function sending agent messages and the requests the agent saw.
+func dialUSPAgent(t *testing.T, m *Manager, respond func(*usp.Msg) *usp.Msg) (func(to string, msg *usp.Msg), <-chan *usp.Msg) {
+	t.Helper()
+	srv := httptest.NewServer(m.USPHandler())
+	t.Cleanup(srv.Close)
+	d := websocket.Dialer{Subprotocols: []string{runtime.USPWebSocketSubprotocol}}
+	c, _, err := d.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	var writeMu sync.Mutex
+	send := func(to string, msg *usp.Msg) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		writeUSP(t, c, to, msg)
+	}
+	connect := &usp.Record{Version: usp.Version, FromID: string(testAgent), Type: usp.RecordWebSocketConnect}
+	if err := c.WriteMessage(websocket.BinaryMessage, connect.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(chan *usp.Msg, 16)
+	go func() {
+		for {
+			_, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			rec, err := usp.UnmarshalRecord(data)
+			if err != nil {
+				continue
+			}
+			req, err := usp.UnmarshalMsg(rec.Payload)
+			if err != nil {
+				continue
+			}
+			seen <- req
+			if out := respond(req); out != nil {
+				out.ID = req.ID
+				send(rec.FromID, out)
+			}
+		}
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		// the agent is registered once a request stops failing as offline
+		_, err := m.usp.Get(context.Background(), testAgent, []string{"Device.Probe."})
+		if !errors.Is(err, dm.ErrDeviceOffline) {
+			<-seen
+			return send, seen
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("agent never registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func writeUSP(t *testing.T, c *websocket.Conn, to string, msg *usp.Msg) {
+	payload, err := msg.Marshal()
+	if err != nil {
+		t.Errorf("marshal: %v", err)
+		return
+	}
+	rec := &usp.Record{Version: usp.Version, ToID: to, FromID: string(testAgent), Payload: payload}
+	if err := c.WriteMessage(websocket.BinaryMessage, rec.Marshal()); err != nil {
+		t.Errorf("write: %v", err)
+	}
+}
+
+func TestManagerUSPAgent(t *testing.T) {
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = "http://talaria.invalid"
+	opts.USP = dm.USPConfig{EndpointID: "self::devicemgr", Timeout: 2 * time.Second}
+	m, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	sub := m.Subscribe(8)
+	defer sub.Close()
+	send, seen := dialUSPAgent(t, m, func(req *usp.Msg) *usp.Msg {
+		switch {
+		case req.Get != nil:
+			return &usp.Msg{GetResp: &usp.GetResp{Results: []usp.RequestedPathResult{{
+				RequestedPath: req.Get.ParamPaths[0],
+				Resolved:      []usp.ResolvedPathResult{{ResolvedPath: "Device.DeviceInfo.", Params: map[string]string{"SoftwareVersion": "2.0"}}},
+			}}}}
+		case req.Set != nil:
+			o := req.Set.Objects[0]
+			return &usp.Msg{SetResp: &usp.SetResp{Results: []usp.UpdatedObjectResult{{RequestedPath: o.ObjPath, Updated: []usp.UpdatedInstance{{AffectedPath: o.ObjPath, UpdatedParams: map[string]string{o.Params[0].Param: o.Params[0].Value}}}}}}}
+		case req.Operate != nil:
+			return &usp.Msg{OperateResp: &usp.OperateResp{Results: []usp.OperationResult{{ExecutedCommand: req.Operate.Command, OutputArgs: map[string]string{"Status": "ok"}}}}}
+		}
+		return nil
+	})
+	ctx := context.Background()
+	const version = "Device.DeviceInfo.SoftwareVersion"
+
+	// parameter reads route to the agent and are cached like Tr1d1um reads
+	for i := 0; i < 2; i++ {
+		values, err := m.GetParameters(ctx, testAgent, "", []string{version})
+		if err != nil || values[version].Value != "2.0" {
+			t.Fatalf("get %d: %v %+v", i, err, values)
+		}
+	}
+	if (<-seen).Get == nil {
+		t.Fatal("expected one Get")
+	}
+	if _, err := m.SetParameters(ctx, testAgent, "", []dm.SetParameter{{Name: "Device.Time.Enable", Value: true}}, dm.SetOptions{}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if req := <-seen; req.Set == nil || req.Set.Objects[0].Params[0].Value != "true" {
+		t.Fatalf("unexpected set %+v", req)
+	}
+	res, err := m.Operate(ctx, testAgent, "Device.Reboot()", nil)
+	if err != nil || res.Output["Status"] != "ok" {
+		t.Fatalf("operate: %v %+v", err, res)
+	}
+	<-seen
+
+	// agent notifications reach Manager subscribers
+	send("self::devicemgr", &usp.Msg{ID: "n1", Notify: &usp.Notify{SubscriptionID: "vc", ValueChange: &usp.ValueChange{ParamPath: "Device.Time.Enable", ParamValue: "false"}}})
+	select {
+	case evt := <-sub.C():
+		if evt.Kind != dm.EventNotification || evt.DeviceID != testAgent {
+			t.Fatalf("unexpected event %+v", evt)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no notification event")
+	}
+
+	// USP agents carry no partner IDs: only wildcard scopes reach them
+	scoped := dm.WithPartners(ctx, []string{"comcast"})
+	if _, err := m.GetParameters(scoped, testAgent, "", []string{version}); !errors.Is(err, dm.ErrDeviceNotFound) {
+		t.Fatalf("scoped get: %v", err)
+	}
+	if _, err := m.Operate(scoped, testAgent, "Device.Reboot()", nil); !errors.Is(err, dm.ErrDeviceNotFound) {
+		t.Fatalf("scoped operate: %v", err)
+	}
+	if _, err := m.Operate(ctx, "mac:112233445566", "Device.Reboot()", nil); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("operate on a WebPA device: %v", err)
+	}
+}
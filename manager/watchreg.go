@@ -0,0 +1,257 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// WatchRegistration is a durable parameter watch. Unlike a ParamWatch, which lasts as long as
+// its caller's stream, it keeps value-change notifications on for Names until it is unregistered
+// or expires, re-arming them at startup and whenever the device comes online, since devices
+// forget notification attributes when they reboot. The changes reach webhooks, topic bindings
+// and open ParamWatches as the device's notification events.
+type WatchRegistration struct {
+	ID        string      `json:"id"`
+	DeviceID  dm.DeviceID `json:"deviceId"`
+	Names     []string    `json:"names"`
+	Partners  []string    `json:"partners,omitempty"` // registering caller's partner scope; empty is unscoped
+	Until     time.Time   `json:"until,omitempty"`    // registration expiry; zero never expires
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+type durableWatch struct {
+	reg   WatchRegistration
+	timer *time.Timer // expires reg at Until
+}
+
+// SetWatchStore keeps WatchRegistrations in store from then on, so RestoreWatches brings them back
+// after a restart; without one they are only kept in memory.
+func (m *Manager) SetWatchStore(store dm.SubscriptionStore) {
+	m.watchMu.Lock()
+	m.watchStore = store
+	m.watchMu.Unlock()
+}
+
+// RegisterWatch turns notifications on for names and records a WatchRegistration expiring at
+// until (zero never expires). The registration inherits the caller's partner scope.
+func (m *Manager) RegisterWatch(ctx context.Context, id dm.DeviceID, names []string, until time.Time) (WatchRegistration, error) {
+	if len(names) == 0 {
+		return WatchRegistration{}, fmt.Errorf("names required: %w", dm.ErrInvalidParameter)
+	}
+	if err := m.paramACL.Check(ctx, dm.ParameterRead, names...); err != nil {
+		return WatchRegistration{}, err
+	}
+	id = id.Canonical()
+	if _, err := m.setParameters(ctx, id, "", notifyParams(names, 1), dm.SetOptions{}); err != nil {
+		return WatchRegistration{}, err
+	}
+	reg := WatchRegistration{ID: uuid.NewString(), DeviceID: id, Names: append([]string(nil), names...), Until: until, CreatedAt: time.Now()}
+	if scope, ok := dm.PartnersFromContext(ctx); ok {
+		reg.Partners = scope
+	}
+	if err := m.persistWatch(ctx, reg); err != nil {
+		return WatchRegistration{}, fmt.Errorf("param watch: store registration: %w", err)
+	}
+	m.watchMu.Lock()
+	m.addDurable(reg)
+	m.watchMu.Unlock()
+	return reg, nil
+}
+
+// UnregisterWatch removes a registration, turning notifications off for the names no other watch
+// on the device covers. Registrations outside the caller's partner scope are reported as not found.
+func (m *Manager) UnregisterWatch(ctx context.Context, wid string) error {
+	m.watchMu.Lock()
+	d, ok := m.durable[wid]
+	if !ok || !watchVisible(ctx, d.reg) {
+		m.watchMu.Unlock()
+		return fmt.Errorf("param watch %s: %w", wid, dm.ErrSubscriptionNotFound)
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	delete(m.durable, wid)
+	store := m.watchStore
+	unused := m.uncovered(d.reg.DeviceID, d.reg.Names)
+	m.watchMu.Unlock()
+	if store != nil {
+		if err := store.Delete(ctx, dm.SubscriptionParamWatch, wid); err != nil {
+			log.Printf("param watch %s: delete registration: %v", wid, err)
+		}
+	}
+	if len(unused) > 0 {
+		_, _ = m.setParameters(context.Background(), d.reg.DeviceID, "", notifyParams(unused, 0), dm.SetOptions{})
+	}
+	return nil
+}
+
+// Watches returns the registrations visible to the caller's partner scope ordered by creation time.
+func (m *Manager) Watches(ctx context.Context) []WatchRegistration {
+	m.watchMu.Lock()
+	out := make([]WatchRegistration, 0, len(m.durable))
+	for _, d := range m.durable {
+		if watchVisible(ctx, d.reg) {
+			out = append(out, d.reg)
+		}
+	}
+	m.watchMu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// RenewWatch moves a registration's expiry to until; zero never expires.
+func (m *Manager) RenewWatch(ctx context.Context, wid string, until time.Time) (WatchRegistration, error) {
+	m.watchMu.Lock()
+	d, ok := m.durable[wid]
+	if !ok || !watchVisible(ctx, d.reg) {
+		m.watchMu.Unlock()
+		return WatchRegistration{}, fmt.Errorf("param watch %s: %w", wid, dm.ErrSubscriptionNotFound)
+	}
+	reg := d.reg
+	m.watchMu.Unlock()
+	reg.Until = until
+	if err := m.persistWatch(ctx, reg); err != nil {
+		return WatchRegistration{}, fmt.Errorf("param watch: store registration: %w", err)
+	}
+	m.watchMu.Lock()
+	if d, ok := m.durable[wid]; ok {
+		if d.timer != nil {
+			d.timer.Stop()
+		}
+		m.addDurable(reg)
+	}
+	m.watchMu.Unlock()
+	return reg, nil
+}
+
+// RestoreWatches brings back the registrations of the SetWatchStore store, as left by an earlier
+// process, deleting those that expired meanwhile, and re-arms their notifications. Devices that
+// cannot be reached are re-armed when they come online.
+func (m *Manager) RestoreWatches(ctx context.Context) error {
+	m.watchMu.Lock()
+	store := m.watchStore
+	m.watchMu.Unlock()
+	if store == nil {
+		return nil
+	}
+	subs, err := store.List(ctx, dm.SubscriptionParamWatch)
+	if err != nil {
+		return fmt.Errorf("param watches: restore: %w", err)
+	}
+	var restored []WatchRegistration
+	for _, s := range subs {
+		if s.Expired(time.Now()) {
+			_ = store.Delete(ctx, s.Kind, s.ID)
+			continue
+		}
+		var reg WatchRegistration
+		if err := json.Unmarshal(s.Spec, &reg); err != nil || len(reg.Names) == 0 {
+			log.Printf("param watch %s: restore: unreadable registration", s.ID)
+			continue
+		}
+		reg.ID, reg.Until = s.ID, s.Until
+		m.watchMu.Lock()
+		if _, ok := m.durable[reg.ID]; !ok {
+			m.addDurable(reg)
+			restored = append(restored, reg)
+		}
+		m.watchMu.Unlock()
+	}
+	for _, reg := range restored {
+		m.armWatch(ctx, reg.DeviceID, reg.Names)
+	}
+	return nil
+}
+
+// addDurable records reg, scheduling its expiry; callers hold watchMu.
+func (m *Manager) addDurable(reg WatchRegistration) {
+	if m.durable == nil {
+		m.durable = make(map[string]*durableWatch)
+	}
+	d := &durableWatch{reg: reg}
+	if !reg.Until.IsZero() {
+		d.timer = time.AfterFunc(time.Until(reg.Until), func() { m.expireWatch(d) })
+	}
+	m.durable[reg.ID] = d
+}
+
+// expireWatch unregisters d unless it was renewed meanwhile.
+func (m *Manager) expireWatch(d *durableWatch) {
+	m.watchMu.Lock()
+	current := m.durable[d.reg.ID] == d
+	m.watchMu.Unlock()
+	if current {
+		_ = m.UnregisterWatch(context.Background(), d.reg.ID)
+	}
+}
+
+// rearmWatches turns notifications on again for the registrations on a device that came online.
+func (m *Manager) rearmWatches(id dm.DeviceID) {
+	m.watchMu.Lock()
+	var names []string
+	for _, d := range m.durable {
+		if d.reg.DeviceID == id {
+			names = append(names, d.reg.Names...)
+		}
+	}
+	m.watchMu.Unlock()
+	if len(names) > 0 {
+		go m.armWatch(context.Background(), id, names)
+	}
+}
+
+func (m *Manager) armWatch(ctx context.Context, id dm.DeviceID, names []string) {
+	if _, err := m.setParameters(ctx, id, "", notifyParams(names, 1), dm.SetOptions{}); err != nil {
+		log.Printf("param watch %s: arm notifications: %v", id, err)
+	}
+}
+
+func (m *Manager) persistWatch(ctx context.Context, reg WatchRegistration) error {
+	m.watchMu.Lock()
+	store := m.watchStore
+	m.watchMu.Unlock()
+	if store == nil {
+		return nil
+	}
+	spec, err := json.Marshal(reg)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, dm.Subscription{Kind: dm.SubscriptionParamWatch, ID: reg.ID, Until: reg.Until, Spec: spec})
+}
+
+// uncovered returns the names of names that neither a ParamWatch nor a WatchRegistration on id
+// covers; callers hold watchMu.
+func (m *Manager) uncovered(id dm.DeviceID, names []string) []string {
+	var out []string
+	for _, n := range names {
+		covered := false
+		for _, w := range m.watches[id] {
+			covered = covered || watched(w.names, n)
+		}
+		for _, d := range m.durable {
+			covered = covered || (d.reg.DeviceID == id && watched(d.reg.Names, n))
+		}
+		if !covered {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// watchVisible reports whether a registration is in the caller's partner scope. Unscoped
+// registrations are only visible to unscoped callers.
+func watchVisible(ctx context.Context, reg WatchRegistration) bool {
+	scope, ok := dm.PartnersFromContext(ctx)
+	if !ok {
+		return true
+	}
+	return len(reg.Partners) > 0 && dm.PartnerAllowed(scope, reg.Partners)
+}
@@ -0,0 +1,95 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestWatchRegistrationsRestore(t *testing.T) {
+	var (
+		polls atomic.Int32
+		mu    sync.Mutex
+		sets  []string // SET bodies sent to Tr1d1um
+	)
+	tr1d1um := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		sets = append(sets, string(b))
+		mu.Unlock()
+		w.Write([]byte(`{"statusCode":200}`))
+	}))
+	defer tr1d1um.Close()
+	takeSets := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		out := sets
+		sets = nil
+		return out
+	}
+	opts := dm.DefaultOptions()
+	opts.TalariaBaseURL = fakeTalaria(t, &polls).URL
+	opts.Tr1d1umBaseURL = tr1d1um.URL
+	store := dm.NewMemorySubscriptionStore()
+	ctx := context.Background()
+
+	m := newTestManager(t, opts)
+	m.SetWatchStore(store)
+	reg, err := m.RegisterWatch(ctx, "mac:aa", []string{"Device.WiFi.SSID.1.SSID"}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := takeSets(); len(s) != 1 || !strings.Contains(s[0], "Device.WiFi.SSID.1.SSID") || !strings.Contains(s[0], `"notify":1`) {
+		t.Fatalf("arming SET %q", s)
+	}
+	stored, _ := store.List(ctx, dm.SubscriptionParamWatch)
+	gone := stored[0]
+	gone.ID, gone.Until = "expired", time.Now().Add(-time.Minute)
+	_ = store.Put(ctx, gone)
+
+	// a later process restores the registration and arms it again
+	m2 := newTestManager(t, opts)
+	m2.SetWatchStore(store)
+	if err := m2.RestoreWatches(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := m2.Watches(ctx); len(got) != 1 || got[0].ID != reg.ID || got[0].DeviceID != "mac:aa" {
+		t.Fatalf("restored %+v", got)
+	}
+	if s := takeSets(); len(s) != 1 || !strings.Contains(s[0], `"notify":1`) {
+		t.Fatalf("re-arming SET %q", s)
+	}
+	if subs, _ := store.List(ctx, dm.SubscriptionParamWatch); len(subs) != 1 {
+		t.Fatalf("expected the expired registration deleted, got %+v", subs)
+	}
+
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	if renewed, err := m2.RenewWatch(ctx, reg.ID, until); err != nil || !renewed.Until.Equal(until) {
+		t.Fatalf("renew %+v %v", renewed, err)
+	}
+	if subs, _ := store.List(ctx, dm.SubscriptionParamWatch); len(subs) != 1 || !subs[0].Until.Equal(until) {
+		t.Fatalf("stored %+v", subs)
+	}
+	scoped := dm.WithPartners(ctx, []string{"comcast"})
+	if err := m2.UnregisterWatch(scoped, reg.ID); !errors.Is(err, dm.ErrSubscriptionNotFound) {
+		t.Fatalf("expected an unscoped registration hidden from a scoped caller, got %v", err)
+	}
+	if err := m2.UnregisterWatch(ctx, reg.ID); err != nil {
+		t.Fatal(err)
+	}
+	if s := takeSets(); len(s) != 1 || !strings.Contains(s[0], `"notify":0`) {
+		t.Fatalf("disarming SET %q", s)
+	}
+	if subs, _ := store.List(ctx, dm.SubscriptionParamWatch); len(subs) != 0 {
+		t.Fatalf("expected deletion, got %+v", subs)
+	}
+}
@@ -0,0 +1,126 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/policy"
+)
+
+// xconfAdapters are the xconfadmin adapters sharing one set of credentials.
+type xconfAdapters struct {
+	firmware *policy.FirmwareAdapter
+	settings *policy.SettingsAdapter
+	features *policy.FeatureAdapter
+	catalog  *policy.CatalogAdapter // lists cached for Cache.PolicyTTL
+}
+
+// buildXconf returns nil when XconfAdminBaseURL is unset.
+func (m *Manager) buildXconf(auth dm.AuthStrategy) *xconfAdapters {
+	if m.opts.XconfAdminBaseURL == "" {
+		return nil
+	}
+	c := policy.NewClient(m.opts.XconfAdminBaseURL, auth)
+	c.HTTP = m.client(0) // bounded by PolicyTimeout
+	c.Retry = m.opts.Retry
+	return &xconfAdapters{
+		firmware: policy.NewFirmwareAdapter(c),
+		settings: policy.NewSettingsAdapter(c),
+		features: policy.NewFeatureAdapter(c),
+		catalog:  policy.NewCatalogAdapter(c, m.opts.Cache.PolicyTTL),
+	}
+}
+
+// xconfFor picks the xconfadmin adapters like dataModelFor, returning the partner whose
+// credentials they use ("" for the defaults) so results are cached per adapter; nil when
+// xconfadmin is not configured.
+func (m *Manager) xconfFor(ctx context.Context) (*xconfAdapters, string) {
+	if scope, ok := dm.PartnersFromContext(ctx); ok {
+		for _, p := range scope {
+			if x, ok := m.partnerXconf[p]; ok {
+				return x, p
+			}
+		}
+	}
+	return m.xconf, ""
+}
+
+func (m *Manager) firmwareFor(ctx context.Context) (*policy.FirmwareAdapter, string) {
+	x, partner := m.xconfFor(ctx)
+	if x == nil {
+		return nil, ""
+	}
+	return x.firmware, partner
+}
+
+func (m *Manager) settingsFor(ctx context.Context) *policy.SettingsAdapter {
+	if x, _ := m.xconfFor(ctx); x != nil {
+		return x.settings
+	}
+	return nil
+}
+
+func (m *Manager) featuresFor(ctx context.Context) *policy.FeatureAdapter {
+	if x, _ := m.xconfFor(ctx); x != nil {
+		return x.features
+	}
+	return nil
+}
+
+func (m *Manager) catalogFor(ctx context.Context) (*policy.CatalogAdapter, error) {
+	if x, _ := m.xconfFor(ctx); x != nil {
+		return x.catalog, nil
+	}
+	return nil, fmt.Errorf("xconfadmin not configured: %w", dm.ErrBackendUnavailable)
+}
+
+// Catalog lists the xconf environments, models or partners firmware and settings rules refer to.
+func (m *Manager) Catalog(ctx context.Context, kind policy.CatalogKind) ([]policy.CatalogEntry, error) {
+	ca, err := m.catalogFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(ctx, m.opts.PolicyTimeout, dm.DefaultPolicyTimeout)
+	defer cancel()
+	return ca.List(ctx, kind)
+}
+
+// CatalogHas reports whether the catalog holds id, e.g. to validate a rule before it is saved.
+func (m *Manager) CatalogHas(ctx context.Context, kind policy.CatalogKind, id string) (bool, error) {
+	ca, err := m.catalogFor(ctx)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := withTimeout(ctx, m.opts.PolicyTimeout, dm.DefaultPolicyTimeout)
+	defer cancel()
+	return ca.Has(ctx, kind, id)
+}
+
+// CreateCatalogEntry adds an environment, model or partner to xconf.
+func (m *Manager) CreateCatalogEntry(ctx context.Context, kind policy.CatalogKind, e policy.CatalogEntry) (saved policy.CatalogEntry, err error) {
+	rec := dm.NewAuditRecord(ctx, "catalog-create", "")
+	rec.Detail = fmt.Sprintf("%s=%s", kind, e.ID)
+	defer func() { m.auditFleet(rec, err) }()
+	ca, err := m.catalogFor(ctx)
+	if err != nil {
+		return policy.CatalogEntry{}, err
+	}
+	ctx, cancel := withTimeout(ctx, m.opts.PolicyTimeout, dm.DefaultPolicyTimeout)
+	defer cancel()
+	return ca.Create(ctx, kind, e)
+}
+
+// DeleteCatalogEntry removes an environment, model or partner from xconf.
+func (m *Manager) DeleteCatalogEntry(ctx context.Context, kind policy.CatalogKind, id string) (err error) {
+	rec := dm.NewAuditRecord(ctx, "catalog-delete", "")
+	rec.Detail = fmt.Sprintf("%s=%s", kind, id)
+	defer func() { m.auditFleet(rec, err) }()
+	ca, err := m.catalogFor(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx, m.opts.PolicyTimeout, dm.DefaultPolicyTimeout)
+	defer cancel()
+	return ca.Delete(ctx, kind, id)
+}
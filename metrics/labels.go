@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Other replaces label values past a Limiter's limit.
+const Other = "other"
+
+// DefaultLabelLimit is the Limiter size used when none is configured.
+const DefaultLabelLimit = 100
+
+// Limiter bounds the cardinality of one label: the first Max distinct values pass through and
+// later ones are reported as Other, so a fleet with many partners or models cannot grow the
+// series count without bound.
+type Limiter struct {
+	max  int
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+// NewLimiter returns a Limiter keeping max values; zero or less uses DefaultLabelLimit.
+func NewLimiter(max int) *Limiter {
+	if max <= 0 {
+		max = DefaultLabelLimit
+	}
+	return &Limiter{max: max, seen: make(map[string]struct{})}
+}
+
+// Value returns v, or Other once max other values have been seen.
+func (l *Limiter) Value(v string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.seen[v]; ok {
+		return v
+	}
+	if len(l.seen) >= l.max {
+		return Other
+	}
+	l.seen[v] = struct{}{}
+	return v
+}
+
+type traceKey struct{}
+
+// WithTraceID returns ctx carrying a trace ID for histogram exemplars.
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceKey{}, id)
+}
+
+// TraceID returns the trace ID carried by ctx, or "".
+func TraceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceKey{}).(string)
+	return id
+}
+
+// Trace takes the trace ID of each request from its W3C traceparent header
+// ("00-<trace-id>-<parent-id>-<flags>") so metrics observed while serving it carry exemplars.
+func Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := parseTraceparent(r.Header.Get("Traceparent")); ok {
+			r = r.WithContext(WithTraceID(r.Context(), id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func parseTraceparent(h string) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", false
+	}
+	id := strings.ToLower(parts[1])
+	if strings.Trim(id, "0") == "" || strings.Trim(id, "0123456789abcdef") != "" {
+		return "", false
+	}
+	return id, true
+}
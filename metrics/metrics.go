@@ -0,0 +1,290 @@
+// Package metrics is a small Prometheus-compatible registry: labeled counters, gauges and histograms,
+// served in the Prometheus text format or, to scrapers asking for it, OpenMetrics with trace
+// exemplars on histogram buckets.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefBuckets are latency histogram bounds in seconds, as the Prometheus client defines them.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds metrics in registration order and serves them over HTTP.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w *bufio.Writer, openMetrics bool)
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry { return &Registry{} }
+
+// Counter registers a counter; name omits the "_total" suffix, which exposition adds.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{family: family{name: name, help: help, labels: labels}, series: make(map[string]*counterSeries)}
+	r.add(c)
+	return c
+}
+
+// Gauge registers a gauge.
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{family: family{name: name, help: help, labels: labels}, series: make(map[string]*counterSeries)}
+	r.add(g)
+	return g
+}
+
+// Histogram registers a histogram with the given upper bucket bounds (sorted ascending).
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{family: family{name: name, help: help, labels: labels}, buckets: buckets, series: make(map[string]*histogramSeries)}
+	r.add(h)
+	return h
+}
+
+func (r *Registry) add(m metric) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mu.Unlock()
+}
+
+// ServeHTTP writes every metric, as OpenMetrics when the Accept header asks for it.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	openMetrics := strings.Contains(req.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+	bw := bufio.NewWriter(w)
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	for _, m := range metrics {
+		m.write(bw, openMetrics)
+	}
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	_ = bw.Flush()
+}
+
+type family struct {
+	name, help string
+	labels     []string
+}
+
+func (f family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (f family) header(w *bufio.Writer, name, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, kind)
+}
+
+// labelSet renders {a="x",b="y"} with extra appended last; "" without labels.
+func (f family) labelSet(values []string, extra ...string) string {
+	if len(f.labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range f.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, l, escape(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, extra[i], escape(extra[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escape applies the exposition format's label value escapes.
+func escape(v string) string { return labelEscaper.Replace(v) }
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	family
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	values []string
+	v      float64
+}
+
+// Add increases the series for labelValues by v.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	k := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.series[k]
+	if s == nil {
+		s = &counterSeries{values: append([]string(nil), labelValues...)}
+		c.series[k] = s
+	}
+	s.v += v
+}
+
+// Inc adds one.
+func (c *CounterVec) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+func (c *CounterVec) write(w *bufio.Writer, openMetrics bool) {
+	name := c.name
+	if !openMetrics {
+		name += "_total"
+	}
+	c.header(w, name, "counter")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range sortedKeys(c.series) {
+		s := c.series[k]
+		fmt.Fprintf(w, "%s_total%s %s\n", c.name, c.labelSet(s.values), formatFloat(s.v))
+	}
+}
+
+// GaugeVec is a gauge partitioned by label values.
+type GaugeVec struct {
+	family
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+// Set sets the series for labelValues to v.
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	k := g.key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := g.series[k]
+	if s == nil {
+		s = &counterSeries{values: append([]string(nil), labelValues...)}
+		g.series[k] = s
+	}
+	s.v = v
+}
+
+// Delete removes the series for labelValues, so it is no longer exposed.
+func (g *GaugeVec) Delete(labelValues ...string) {
+	k := g.key(labelValues)
+	g.mu.Lock()
+	delete(g.series, k)
+	g.mu.Unlock()
+}
+
+func (g *GaugeVec) write(w *bufio.Writer, openMetrics bool) {
+	g.header(w, g.name, "gauge")
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, k := range sortedKeys(g.series) {
+		s := g.series[k]
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelSet(s.values), formatFloat(s.v))
+	}
+}
+
+// HistogramVec is a histogram partitioned by label values. Each bucket keeps the latest exemplar
+// observed with a trace ID in its context (WithTraceID).
+type HistogramVec struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values    []string
+	counts    []uint64 // per bucket, the last one +Inf; not cumulative
+	exemplars []*exemplar
+	sum       float64
+	count     uint64
+}
+
+type exemplar struct {
+	traceID string
+	value   float64
+	at      time.Time
+}
+
+// Observe records v for labelValues, attaching ctx's trace ID (if any) as the bucket's exemplar.
+func (h *HistogramVec) Observe(ctx context.Context, v float64, labelValues ...string) {
+	k := h.key(labelValues)
+	i := sort.SearchFloat64s(h.buckets, v) // first bound >= v; len(buckets) is +Inf
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[k]
+	if s == nil {
+		s = &histogramSeries{values: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets)+1), exemplars: make([]*exemplar, len(h.buckets)+1)}
+		h.series[k] = s
+	}
+	s.counts[i]++
+	s.sum += v
+	s.count++
+	if id := TraceID(ctx); id != "" {
+		s.exemplars[i] = &exemplar{traceID: id, value: v, at: time.Now()}
+	}
+}
+
+func (h *HistogramVec) write(w *bufio.Writer, openMetrics bool) {
+	h.header(w, h.name, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, k := range sortedKeys(h.series) {
+		s := h.series[k]
+		var cumulative uint64
+		for i, n := range s.counts {
+			cumulative += n
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d", h.name, h.labelSet(s.values, "le", formatFloat(le)), cumulative)
+			if e := s.exemplars[i]; openMetrics && e != nil {
+				fmt.Fprintf(w, ` # {trace_id="%s"} %s %.3f`, e.traceID, formatFloat(e.value), float64(e.at.UnixMilli())/1000)
+			}
+			w.WriteByte('\n')
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelSet(s.values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelSet(s.values), s.count)
+	}
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, r *Registry, accept string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	r.ServeHTTP(rec, req)
+	return rec.Body.String()
+}
+
+func TestRegistryExposition(t *testing.T) {
+	r := NewRegistry()
+	polls := r.Counter("polls", "Talaria polls.", "outcome")
+	latency := r.Histogram("latency_seconds", "Call latency.", []float64{0.1, 1}, "partner")
+	quality := r.Gauge("quality", "Connection quality.", "device")
+	polls.Inc("ok")
+	quality.Set(80, "mac:aa")
+	quality.Set(40, "mac:bb")
+	quality.Set(55, "mac:bb")
+	quality.Set(10, "mac:cc")
+	quality.Delete("mac:cc")
+	polls.Add(2, "ok")
+	ctx := WithTraceID(context.Background(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	latency.Observe(ctx, 0.05, `sky "uk"`)
+	latency.Observe(context.Background(), 0.5, `sky "uk"`)
+	latency.Observe(context.Background(), 3, `sky "uk"`)
+
+	text := scrape(t, r, "")
+	for _, want := range []string{
+		"# TYPE polls_total counter\npolls_total{outcome=\"ok\"} 3\n",
+		"# TYPE quality gauge\nquality{device=\"mac:aa\"} 80\nquality{device=\"mac:bb\"} 55\n",
+		`latency_seconds_bucket{partner="sky \"uk\"",le="0.1"} 1` + "\n",
+		`latency_seconds_bucket{partner="sky \"uk\"",le="1"} 2` + "\n",
+		`latency_seconds_bucket{partner="sky \"uk\"",le="+Inf"} 3` + "\n",
+		`latency_seconds_sum{partner="sky \"uk\""} 3.55` + "\n",
+		`latency_seconds_count{partner="sky \"uk\""} 3` + "\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("text format missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "trace_id") {
+		t.Fatalf("exemplar in the text format:\n%s", text)
+	}
+	if strings.Contains(text, "mac:cc") {
+		t.Fatalf("deleted gauge series exposed:\n%s", text)
+	}
+
+	om := scrape(t, r, "application/openmetrics-text; version=1.0.0")
+	if !strings.Contains(om, "# TYPE polls counter\n") || !strings.HasSuffix(om, "# EOF\n") ||
+		!strings.Contains(om, `le="0.1"} 1 # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 0.05 `) {
+		t.Fatalf("openmetrics:\n%s", om)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(2)
+	for _, v := range []string{"comcast", "sky", "comcast"} {
+		if got := l.Value(v); got != v {
+			t.Fatalf("%s: got %s", v, got)
+		}
+	}
+	if got := l.Value("cox"); got != Other {
+		t.Fatalf("third value: got %s", got)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var got string
+	h := Trace(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = TraceID(r.Context()) }))
+	for header, want := range map[string]string{
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": "",
+		"garbage": "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("traceparent", header)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if got != want {
+			t.Fatalf("%s: trace ID %q, want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+// Package mqtt is a small MQTT 3.1.1 client covering what devicemgr needs from a broker:
+// QoS 0/1 publish and subscribe, keep-alive, TLS and automatic reconnect with resubscription.
+// QoS 2 is not supported; subscriptions request at most QoS 1.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotConnected = errors.New("mqtt: not connected")
+	ErrClosed       = errors.New("mqtt: client closed")
+)
+
+// Config configures a Client.
+type Config struct {
+	// Broker is tcp://host:port (also mqtt://) or, for TLS, ssl://, tls:// or mqtts://.
+	Broker   string
+	ClientID string // required
+	Username string
+	Password string
+	// TLS configures TLS brokers; nil uses the system roots.
+	TLS *tls.Config
+	// KeepAlive is the keep-alive interval negotiated with the broker (default 30s).
+	KeepAlive time.Duration
+	// ConnectTimeout bounds dialing and the CONNACK wait (default 10s).
+	ConnectTimeout time.Duration
+	// ReconnectBackoff is the first delay between reconnect attempts, doubled up to 30s (default 1s).
+	ReconnectBackoff time.Duration
+}
+
+// Handler receives messages for a subscription. Handlers run on the client's read loop: they must
+// not block or wait on a QoS 1 Publish.
+type Handler func(topic string, payload []byte)
+
+type subscription struct {
+	filter  string
+	qos     byte
+	handler Handler
+}
+
+// Client is a connection to one broker that redials and resubscribes after connection loss.
+type Client struct {
+	cfg  Config
+	done chan struct{}
+
+	writeMu sync.Mutex // serializes packet writes
+
+	mu       sync.Mutex
+	conn     net.Conn // nil while reconnecting
+	closed   bool
+	nextID   uint16
+	inflight map[uint16]chan []byte // packet ID -> PUBACK/SUBACK body
+	subs     []subscription
+}
+
+// Dial connects to the broker; later connection losses are retried in the background until Close.
+func Dial(ctx context.Context, cfg Config) (*Client, error) {
+	if cfg.ClientID == "" {
+		return nil, errors.New("mqtt: ClientID required")
+	}
+	if cfg.KeepAlive <= 0 {
+		cfg.KeepAlive = 30 * time.Second
+	}
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = 10 * time.Second
+	}
+	if cfg.ReconnectBackoff <= 0 {
+		cfg.ReconnectBackoff = time.Second
+	}
+	c := &Client{cfg: cfg, done: make(chan struct{}), inflight: make(map[uint16]chan []byte)}
+	conn, r, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	go c.run(conn, r)
+	return c, nil
+}
+
+func (c *Client) connect(ctx context.Context) (net.Conn, *bufio.Reader, error) {
+	u, err := url.Parse(c.cfg.Broker)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mqtt: broker: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.ConnectTimeout)
+	defer cancel()
+	var conn net.Conn
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", hostPort(u, "1883"))
+	case "ssl", "tls", "mqtts":
+		conn, err = (&tls.Dialer{Config: c.cfg.TLS}).DialContext(ctx, "tcp", hostPort(u, "8883"))
+	default:
+		return nil, nil, fmt.Errorf("mqtt: unsupported broker scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	if _, err := conn.Write(connectPacket(c.cfg, uint16(c.cfg.KeepAlive/time.Second))); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	r := bufio.NewReader(conn)
+	h, body, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("mqtt: connack: %w", err)
+	}
+	if h>>4 != packetConnack || len(body) != 2 {
+		conn.Close()
+		return nil, nil, errMalformed
+	}
+	if body[1] != 0 {
+		conn.Close()
+		return nil, nil, fmt.Errorf("mqtt: connection refused: %s", connackReason(body[1]))
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, r, nil
+}
+
+func hostPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
+
+// run serves conn, then reconnects (resubscribing) until Close.
+func (c *Client) run(conn net.Conn, r *bufio.Reader) {
+	for {
+		c.serve(conn, r)
+		c.mu.Lock()
+		c.conn = nil
+		for id, ch := range c.inflight {
+			close(ch)
+			delete(c.inflight, id)
+		}
+		closed := c.closed
+		c.mu.Unlock()
+		if closed {
+			return
+		}
+		var err error
+		for backoff := c.cfg.ReconnectBackoff; ; backoff = min(2*backoff, 30*time.Second) {
+			select {
+			case <-c.done:
+				return
+			case <-time.After(backoff):
+			}
+			if conn, r, err = c.connect(context.Background()); err == nil {
+				break
+			}
+		}
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			conn.Close()
+			return
+		}
+		c.conn = conn
+		subs := append([]subscription(nil), c.subs...)
+		c.mu.Unlock()
+		for _, s := range subs {
+			// SUBACKs for resubscriptions are not awaited; an unknown packet ID is ignored by serve.
+			_ = c.write(conn, subscribePacket(c.packetID(nil), s.filter, s.qos))
+		}
+	}
+}
+
+// serve reads packets until the connection fails, pinging the broker every KeepAlive.
+func (c *Client) serve(conn net.Conn, r *bufio.Reader) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		t := time.NewTicker(c.cfg.KeepAlive)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				_ = c.write(conn, packet(packetPingreq<<4, nil))
+			}
+		}
+	}()
+	defer conn.Close()
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(c.cfg.KeepAlive * 3 / 2))
+		h, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch h >> 4 {
+		case packetPublish:
+			c.deliver(conn, h, body)
+		case packetPuback, packetSuback:
+			if len(body) < 2 {
+				return
+			}
+			id := binary.BigEndian.Uint16(body)
+			c.mu.Lock()
+			ch, ok := c.inflight[id]
+			delete(c.inflight, id)
+			c.mu.Unlock()
+			if ok {
+				ch <- body[2:]
+			}
+		case packetPingresp:
+		default:
+			return // unexpected packet; reconnect
+		}
+	}
+}
+
+func (c *Client) deliver(conn net.Conn, h byte, body []byte) {
+	topic, rest, err := readString(body)
+	if err != nil {
+		return
+	}
+	if qos := (h >> 1) & 3; qos > 0 {
+		if len(rest) < 2 {
+			return
+		}
+		id := binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+		_ = c.write(conn, pubackPacket(id))
+	}
+	c.mu.Lock()
+	var handlers []Handler
+	for _, s := range c.subs {
+		if Match(s.filter, topic) {
+			handlers = append(handlers, s.handler)
+		}
+	}
+	c.mu.Unlock()
+	for _, fn := range handlers {
+		fn(topic, rest)
+	}
+}
+
+func (c *Client) write(conn net.Conn, p []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = conn.SetWriteDeadline(time.Now().Add(c.cfg.ConnectTimeout))
+	_, err := conn.Write(p)
+	return err
+}
+
+// packetID allocates a non-zero packet ID, registering ch for its acknowledgement when non-nil.
+func (c *Client) packetID(ch chan []byte) uint16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		c.nextID++
+		if _, busy := c.inflight[c.nextID]; c.nextID != 0 && !busy {
+			break
+		}
+	}
+	if ch != nil {
+		c.inflight[c.nextID] = ch
+	}
+	return c.nextID
+}
+
+func (c *Client) current() (net.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrClosed
+	}
+	if c.conn == nil {
+		return nil, ErrNotConnected
+	}
+	return c.conn, nil
+}
+
+// Publish sends payload to topic. With QoS 1 it returns once the broker acknowledges.
+func (c *Client) Publish(ctx context.Context, topic string, qos byte, payload []byte) error {
+	if qos > 1 {
+		return errors.New("mqtt: QoS 2 is not supported")
+	}
+	conn, err := c.current()
+	if err != nil {
+		return err
+	}
+	if qos == 0 {
+		return c.write(conn, publishPacket(topic, 0, 0, payload))
+	}
+	ch := make(chan []byte, 1)
+	id := c.packetID(ch)
+	if err := c.write(conn, publishPacket(topic, 1, id, payload)); err != nil {
+		c.forget(id)
+		return err
+	}
+	_, err = c.await(ctx, id, ch)
+	return err
+}
+
+// Subscribe registers handler for filter and waits for the broker's SUBACK. The subscription is
+// renewed automatically after reconnects.
+func (c *Client) Subscribe(ctx context.Context, filter string, qos byte, handler Handler) error {
+	if qos > 1 {
+		qos = 1
+	}
+	conn, err := c.current()
+	if err != nil {
+		return err
+	}
+	ch := make(chan []byte, 1)
+	id := c.packetID(ch)
+	c.mu.Lock()
+	c.subs = append(c.subs, subscription{filter: filter, qos: qos, handler: handler})
+	c.mu.Unlock()
+	err = c.write(conn, subscribePacket(id, filter, qos))
+	var codes []byte
+	if err == nil {
+		codes, err = c.await(ctx, id, ch)
+	}
+	if err == nil && (len(codes) != 1 || codes[0] == 0x80) {
+		err = fmt.Errorf("mqtt: subscription to %q refused", filter)
+	}
+	if err != nil {
+		c.forget(id)
+		c.unsubscribe(filter)
+	}
+	return err
+}
+
+func (c *Client) unsubscribe(filter string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, s := range c.subs {
+		if s.filter == filter {
+			c.subs = append(c.subs[:i:i], c.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *Client) await(ctx context.Context, id uint16, ch chan []byte) ([]byte, error) {
+	select {
+	case body, ok := <-ch:
+		if !ok {
+			return nil, ErrNotConnected
+		}
+		return body, nil
+	case <-ctx.Done():
+		c.forget(id)
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, ErrClosed
+	}
+}
+
+func (c *Client) forget(id uint16) {
+	c.mu.Lock()
+	delete(c.inflight, id)
+	c.mu.Unlock()
+}
+
+// Connected reports whether the client currently has a broker connection.
+func (c *Client) Connected() bool {
+	_, err := c.current()
+	return err == nil
+}
+
+// Close disconnects from the broker and stops reconnecting.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	conn := c.conn
+	c.mu.Unlock()
+	if conn != nil {
+		_ = c.write(conn, packet(packetDisconnect<<4, nil))
+		return conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package mqtt_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/talaria/devicemgr/mqtt"
+	"github.com/xmidt-org/talaria/devicemgr/mqtt/mqtttest"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"devices/+/events", "devices/mac:1122/events", true},
+		{"devices/+/events", "devices/mac:1122/events/x", false},
+		{"devices/#", "devices/a/b/c", true},
+		{"devices/#", "devices", true},
+		{"#", "anything/at/all", true},
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a", "a/b", false},
+		{"a/+", "a", false},
+	}
+	for _, c := range cases {
+		if got := mqtt.Match(c.filter, c.topic); got != c.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", c.filter, c.topic, got, c.want)
+		}
+	}
+}
+
+func startBroker(t *testing.T) *mqtttest.Broker {
+	t.Helper()
+	b, err := mqtttest.NewBroker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func dial(t *testing.T, b *mqtttest.Broker, id string) *mqtt.Client {
+	t.Helper()
+	c, err := mqtt.Dial(context.Background(), mqtt.Config{Broker: b.URL, ClientID: id, KeepAlive: time.Second, ReconnectBackoff: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	b := startBroker(t)
+	sub := dial(t, b, "sub")
+	pub := dial(t, b, "pub")
+	ctx := context.Background()
+
+	got := make(chan []byte, 4)
+	if err := sub.Subscribe(ctx, "devices/+/events", 1, func(topic string, payload []byte) {
+		got <- append([]byte(topic+" "), payload...)
+	}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	big := bytes.Repeat([]byte("x"), 20000) // three-byte remaining length
+	if err := pub.Publish(ctx, "devices/d1/events", 1, big); err != nil {
+		t.Fatalf("publish qos1: %v", err)
+	}
+	if err := pub.Publish(ctx, "devices/d2/events", 0, []byte("hi")); err != nil {
+		t.Fatalf("publish qos0: %v", err)
+	}
+	if err := pub.Publish(ctx, "other/topic", 0, []byte("ignored")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	for _, want := range [][]byte{append([]byte("devices/d1/events "), big...), []byte("devices/d2/events hi")} {
+		select {
+		case m := <-got:
+			if !bytes.Equal(m, want) {
+				t.Fatalf("unexpected message %.40q", m)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("message not delivered")
+		}
+	}
+	if err := pub.Publish(ctx, "t", 2, nil); err == nil {
+		t.Fatal("expected QoS 2 to be rejected")
+	}
+}
+
+func TestReconnectResubscribes(t *testing.T) {
+	b := startBroker(t)
+	c := dial(t, b, "sub")
+	got := make(chan string, 4)
+	if err := c.Subscribe(context.Background(), "a/#", 0, func(topic string, _ []byte) { got <- topic }); err != nil {
+		t.Fatal(err)
+	}
+	b.DropClients()
+	// the dropped session may still be listed briefly, so publish until the renewed one receives
+	deadline := time.After(2 * time.Second)
+	tick := time.NewTicker(20 * time.Millisecond)
+	defer tick.Stop()
+	for received := false; !received; {
+		select {
+		case topic := <-got:
+			if topic != "a/b" {
+				t.Fatalf("got %q", topic)
+			}
+			received = true
+		case <-tick.C:
+			b.Publish("a/b", nil)
+		case <-deadline:
+			t.Fatal("client did not reconnect and resubscribe")
+		}
+	}
+	c.Close()
+	if err := c.Publish(context.Background(), "a/b", 0, nil); err != mqtt.ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestDialErrors(t *testing.T) {
+	if _, err := mqtt.Dial(context.Background(), mqtt.Config{Broker: "tcp://127.0.0.1:1"}); err == nil {
+		t.Fatal("expected ClientID error")
+	}
+	if _, err := mqtt.Dial(context.Background(), mqtt.Config{Broker: "ws://x", ClientID: "c"}); err == nil {
+		t.Fatal("expected scheme error")
+	}
+}
@@ -0,0 +1,257 @@
+// Package mqtttest provides an in-process MQTT 3.1.1 broker for tests. It supports QoS 0/1
+// publish, subscribe with wildcards and keep-alive pings; retained messages and sessions are not kept.
+package mqtttest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/xmidt-org/talaria/devicemgr/mqtt"
+)
+
+// Broker is a minimal broker listening on a loopback port.
+type Broker struct {
+	URL string // tcp://127.0.0.1:port
+
+	ln net.Listener
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	// Published records every PUBLISH received from any client, in order.
+	published []Message
+}
+
+// Message is one published message seen by the broker.
+type Message struct {
+	Topic   string
+	QoS     byte
+	Payload []byte
+}
+
+type client struct {
+	conn    net.Conn
+	id      string
+	writeMu sync.Mutex
+	subs    []string
+}
+
+// NewBroker starts a broker; Close stops it.
+func NewBroker() (*Broker, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	b := &Broker{URL: "tcp://" + ln.Addr().String(), ln: ln, clients: make(map[*client]struct{})}
+	go b.accept()
+	return b, nil
+}
+
+func (b *Broker) accept() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.serve(conn)
+	}
+}
+
+// Close stops listening and drops every client connection.
+func (b *Broker) Close() error {
+	err := b.ln.Close()
+	b.DropClients()
+	return err
+}
+
+// DropClients closes every client connection (to exercise reconnects).
+func (b *Broker) DropClients() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.clients {
+		c.conn.Close()
+	}
+}
+
+// Published returns the messages published so far.
+func (b *Broker) Published() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Message(nil), b.published...)
+}
+
+// Clients returns the IDs of the connected clients.
+func (b *Broker) Clients() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []string
+	for c := range b.clients {
+		out = append(out, c.id)
+	}
+	return out
+}
+
+// Subscribed reports whether any client holds a subscription matching topic.
+func (b *Broker) Subscribed(topic string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.clients {
+		for _, f := range c.subs {
+			if mqtt.Match(f, topic) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Publish delivers a message to matching subscribers at QoS 0, as if another client sent it.
+func (b *Broker) Publish(topic string, payload []byte) {
+	b.route(Message{Topic: topic, Payload: payload})
+}
+
+func (b *Broker) route(m Message) {
+	b.mu.Lock()
+	var targets []*client
+	for c := range b.clients {
+		for _, f := range c.subs {
+			if mqtt.Match(f, m.Topic) {
+				targets = append(targets, c)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+	body := appendString(nil, m.Topic)
+	for _, c := range targets {
+		c.write(frame(3<<4, append(body[:len(body):len(body)], m.Payload...)))
+	}
+}
+
+func (b *Broker) serve(conn net.Conn) {
+	c := &client{conn: conn}
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		b.mu.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	for {
+		h, body, err := read(r)
+		if err != nil {
+			return
+		}
+		switch h >> 4 {
+		case 1: // CONNECT
+			// protocol name, level, flags, keep-alive, then client ID
+			_, rest := readString(body)
+			if len(rest) < 4 {
+				return
+			}
+			c.id, _ = readString(rest[4:])
+			b.mu.Lock()
+			b.clients[c] = struct{}{}
+			b.mu.Unlock()
+			c.write([]byte{2 << 4, 2, 0, 0})
+		case 3: // PUBLISH
+			qos := (h >> 1) & 3
+			topic, rest := readString(body)
+			if qos > 0 && len(rest) >= 2 {
+				c.write(frame(4<<4, rest[:2]))
+				rest = rest[2:]
+			}
+			m := Message{Topic: topic, QoS: qos, Payload: append([]byte(nil), rest...)}
+			b.mu.Lock()
+			b.published = append(b.published, m)
+			b.mu.Unlock()
+			b.route(m)
+		case 8: // SUBSCRIBE
+			if len(body) < 2 {
+				return
+			}
+			id, rest := body[:2], body[2:]
+			var codes []byte
+			for len(rest) > 0 {
+				var f string
+				f, rest = readString(rest)
+				if len(rest) == 0 {
+					return
+				}
+				codes = append(codes, min(rest[0], 1))
+				rest = rest[1:]
+				b.mu.Lock()
+				c.subs = append(c.subs, f)
+				b.mu.Unlock()
+			}
+			c.write(frame(9<<4, append(append([]byte(nil), id...), codes...)))
+		case 12: // PINGREQ
+			c.write([]byte{13 << 4, 0})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func (c *client) write(p []byte) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, _ = c.conn.Write(p)
+}
+
+func read(r *bufio.Reader) (byte, []byte, error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, 0
+	for {
+		d, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(d&0x7f) << shift
+		shift += 7
+		if d&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return h, body, err
+}
+
+func frame(h byte, body []byte) []byte {
+	out := []byte{h}
+	n := len(body)
+	for {
+		d := byte(n & 0x7f)
+		n >>= 7
+		if n > 0 {
+			d |= 0x80
+		}
+		out = append(out, d)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (string, []byte) {
+	if len(b) < 2 {
+		return "", nil
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil
+	}
+	return string(b[2 : 2+n]), b[2+n:]
+}
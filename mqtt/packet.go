@@ -0,0 +1,151 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// MQTT 3.1.1 control packet types.
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+var errMalformed = errors.New("mqtt: malformed packet")
+
+// readPacket reads one control packet, returning its first header byte and body.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var n, shift int
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; i == 3 {
+			return 0, nil, errMalformed
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return h, body, nil
+}
+
+// packet encodes a control packet from its first header byte and body.
+func packet(h byte, body []byte) []byte {
+	out := append(make([]byte, 0, len(body)+5), h)
+	n := len(body)
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// readString consumes a length-prefixed string from b.
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errMalformed
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errMalformed
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+func connectPacket(cfg Config, keepAlive uint16) []byte {
+	flags := byte(0x02) // clean session
+	if cfg.Username != "" {
+		flags |= 0x80
+	}
+	if cfg.Password != "" {
+		flags |= 0x40
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags) // protocol level 4 = 3.1.1
+	body = binary.BigEndian.AppendUint16(body, keepAlive)
+	body = appendString(body, cfg.ClientID)
+	if cfg.Username != "" {
+		body = appendString(body, cfg.Username)
+	}
+	if cfg.Password != "" {
+		body = appendString(body, cfg.Password)
+	}
+	return packet(packetConnect<<4, body)
+}
+
+func publishPacket(topic string, qos byte, id uint16, payload []byte) []byte {
+	body := appendString(nil, topic)
+	if qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	return packet(packetPublish<<4|qos<<1, append(body, payload...))
+}
+
+func subscribePacket(id uint16, filter string, qos byte) []byte {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, filter)
+	return packet(packetSubscribe<<4|0x02, append(body, qos))
+}
+
+func pubackPacket(id uint16) []byte {
+	return packet(packetPuback<<4, binary.BigEndian.AppendUint16(nil, id))
+}
+
+// Match reports whether topic matches filter, honoring the + (one level) and # (remaining levels) wildcards.
+func Match(filter, topic string) bool {
+	for {
+		fl, frest, fmore := cut(filter)
+		tl, trest, tmore := cut(topic)
+		switch {
+		case fl == "#":
+			return true
+		case fl != "+" && fl != tl:
+			return false
+		case !fmore || !tmore:
+			// "a/#" also matches "a"
+			return fmore == tmore || (fmore && frest == "#")
+		}
+		filter, topic = frest, trest
+	}
+}
+
+func cut(s string) (level, rest string, more bool) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '/' {
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
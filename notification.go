@@ -0,0 +1,45 @@
+package devicemgr
+
+import "time"
+
+// Notification defaults.
+const (
+	DefaultOutageAfter        = 5 * time.Minute  // NotificationConfig.OutageAfter when unset
+	DefaultOutageCheckEvery   = 30 * time.Second // NotificationConfig.CheckEvery when unset
+	DefaultPagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+)
+
+// NotificationConfig sends messages about job and rollout outcomes and backend outages to email,
+// Slack and PagerDuty; see package notifications for the event types.
+type NotificationConfig struct {
+	Sinks map[string]NotificationSink `json:"sinks"` // by name, referenced by rules
+	Rules []NotificationRule          `json:"rules"`
+	// OutageAfter is how long a backend must keep failing before backend.outage fires
+	// (DefaultOutageAfter); CheckEvery is how often backends are checked (DefaultOutageCheckEvery).
+	OutageAfter time.Duration `json:"-"`
+	CheckEvery  time.Duration `json:"-"`
+}
+
+// NotificationSink is where messages go: Type "slack" posts to WebhookURL, "pagerduty" triggers
+// (and resolves) incidents with RoutingKey, and "email" mails To through SMTPAddr.
+type NotificationSink struct {
+	Type       string   `json:"type"`
+	WebhookURL string   `json:"webhookUrl,omitempty"` // slack incoming webhook
+	RoutingKey string   `json:"routingKey,omitempty"` // pagerduty integration key
+	Severity   string   `json:"severity,omitempty"`   // pagerduty: critical, error (default), warning or info
+	EventsURL  string   `json:"eventsUrl,omitempty"`  // pagerduty: DefaultPagerDutyEventsURL when empty
+	SMTPAddr   string   `json:"smtpAddr,omitempty"`   // email: host:port
+	Username   string   `json:"username,omitempty"`   // email: PLAIN auth when set
+	Password   string   `json:"password,omitempty"`
+	From       string   `json:"from,omitempty"`
+	To         []string `json:"to,omitempty"`
+}
+
+// NotificationRule sends the events it lists to its sinks. Subject and Message are Go templates
+// over notifications.Event; empty ones use the event's summary.
+type NotificationRule struct {
+	Events  []string `json:"events"`
+	Sinks   []string `json:"sinks"`
+	Subject string   `json:"subject,omitempty"`
+	Message string   `json:"message,omitempty"`
+}
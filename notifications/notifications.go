@@ -0,0 +1,274 @@
+// Package notifications tells people about outcomes that need attention: finished bulk jobs,
+// paused or rolled-back firmware rollouts and backend outages. Rules of a
+// devicemgr.NotificationConfig route each event type to email, Slack or PagerDuty sinks with
+// templated messages.
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/firmware"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// Event types rules can list.
+const (
+	JobSucceeded      = "job.succeeded"
+	JobFailed         = "job.failed" // at least one device failed
+	JobCanceled       = "job.canceled"
+	RolloutPaused     = "rollout.paused"
+	RolloutRolledBack = "rollout.rolled-back" // finished rolling back, successfully or not
+	BackendOutage     = "backend.outage"      // a backend kept failing for NotificationConfig.OutageAfter
+	BackendRecovered  = "backend.recovered"   // a backend in outage answered again
+)
+
+// EventTypes lists every event type.
+var EventTypes = []string{JobSucceeded, JobFailed, JobCanceled, RolloutPaused, RolloutRolledBack, BackendOutage, BackendRecovered}
+
+// Event is what rule templates see.
+type Event struct {
+	Type    string
+	At      time.Time
+	Summary string                 // one line describing the event
+	Job     *jobs.Job              // job events
+	Rollout *firmware.RolloutEvent // rollout events
+	Backend string                 // backend events
+	Error   string                 // backend events: the latest error
+	Since   time.Time              // backend events: when the backend started failing
+}
+
+// key identifies what an event is about, so an incident can be resolved by a later event.
+func (e Event) key() string {
+	switch {
+	case e.Job != nil:
+		return "job:" + e.Job.ID
+	case e.Rollout != nil:
+		return "rollout:" + e.Rollout.Rollout
+	}
+	return "backend:" + e.Backend
+}
+
+// Message is a rendered notification.
+type Message struct {
+	Event   Event
+	Subject string
+	Body    string
+}
+
+// Sink delivers messages.
+type Sink interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Source is the subset of manager.Manager the Notifier watches.
+type Source interface {
+	Subscribe(buffer int) dm.EventSubscription
+	Backends() map[string]manager.BackendHealth
+}
+
+type rule struct {
+	events           map[string]bool
+	sinks            []string
+	subject, message *template.Template
+}
+
+// Notifier renders events with the matching rules and sends them to the rules' sinks.
+type Notifier struct {
+	cfg    dm.NotificationConfig
+	sinks  map[string]Sink
+	rules  []rule
+	report func(error)
+}
+
+// New checks cfg's sinks and rules. Report, which may be nil, receives delivery failures; nil logs
+// them.
+func New(cfg dm.NotificationConfig, report func(error)) (*Notifier, error) {
+	if report == nil {
+		report = func(err error) { log.Printf("notifications: %v", err) }
+	}
+	if cfg.OutageAfter <= 0 {
+		cfg.OutageAfter = dm.DefaultOutageAfter
+	}
+	if cfg.CheckEvery <= 0 {
+		cfg.CheckEvery = dm.DefaultOutageCheckEvery
+	}
+	n := &Notifier{cfg: cfg, sinks: make(map[string]Sink, len(cfg.Sinks)), report: report}
+	client := &http.Client{Timeout: 10 * time.Second}
+	for name, sc := range cfg.Sinks {
+		s, err := newSink(sc, client)
+		if err != nil {
+			return nil, fmt.Errorf("notification sink %s: %w", name, err)
+		}
+		n.sinks[name] = s
+	}
+	known := make(map[string]bool, len(EventTypes))
+	for _, t := range EventTypes {
+		known[t] = true
+	}
+	for i, rc := range cfg.Rules {
+		r := rule{events: make(map[string]bool), sinks: rc.Sinks}
+		for _, t := range rc.Events {
+			if !known[t] {
+				return nil, fmt.Errorf("notification rule %d: unknown event %q: %w", i, t, dm.ErrInvalidParameter)
+			}
+			r.events[t] = true
+		}
+		for _, s := range rc.Sinks {
+			if n.sinks[s] == nil {
+				return nil, fmt.Errorf("notification rule %d: unknown sink %q: %w", i, s, dm.ErrInvalidParameter)
+			}
+		}
+		var err error
+		if r.subject, err = parse(rc.Subject); err != nil {
+			return nil, fmt.Errorf("notification rule %d subject: %v: %w", i, err, dm.ErrInvalidParameter)
+		}
+		if r.message, err = parse(rc.Message); err != nil {
+			return nil, fmt.Errorf("notification rule %d message: %v: %w", i, err, dm.ErrInvalidParameter)
+		}
+		n.rules = append(n.rules, r)
+	}
+	return n, nil
+}
+
+func parse(text string) (*template.Template, error) {
+	if text == "" {
+		text = "{{.Summary}}"
+	}
+	return template.New("").Option("missingkey=error").Parse(text)
+}
+
+// Notify sends e to the sinks of every rule listing its type, reporting the failures.
+func (n *Notifier) Notify(ctx context.Context, e Event) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	for _, r := range n.rules {
+		if !r.events[e.Type] {
+			continue
+		}
+		m := Message{Event: e}
+		var subject, body strings.Builder
+		if err := r.subject.Execute(&subject, e); err != nil {
+			n.report(fmt.Errorf("%s subject: %w", e.Type, err))
+			continue
+		}
+		if err := r.message.Execute(&body, e); err != nil {
+			n.report(fmt.Errorf("%s message: %w", e.Type, err))
+			continue
+		}
+		m.Subject, m.Body = subject.String(), body.String()
+		for _, name := range r.sinks {
+			if err := n.sinks[name].Send(ctx, m); err != nil {
+				n.report(fmt.Errorf("%s to %s: %w", e.Type, name, err))
+			}
+		}
+	}
+}
+
+// JobFinished notifies of a finished job; pass it to jobs.Service.SetOnFinish.
+func (n *Notifier) JobFinished(j jobs.Job) {
+	types := map[jobs.Status]string{jobs.StatusSucceeded: JobSucceeded, jobs.StatusFailed: JobFailed, jobs.StatusCanceled: JobCanceled}
+	t, ok := types[j.Status]
+	if !ok {
+		return
+	}
+	summary := fmt.Sprintf("job %s (%s) %s: %d of %d devices done, %d failed", j.ID, j.Spec.Operation, j.Status, j.Progress.Done, j.Progress.Total, j.Progress.Failed)
+	n.Notify(context.Background(), Event{Type: t, Summary: summary, Job: &j})
+}
+
+// Run notifies of rollout pauses and rollbacks seen on src's events, and of backend outages, until
+// ctx is done. A backend whose health reports an error at every check for OutageAfter is in
+// outage until a check finds it healthy again.
+func (n *Notifier) Run(ctx context.Context, src Source) {
+	sub := src.Subscribe(64)
+	defer sub.Close()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		n.watchBackends(ctx, src)
+	}()
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			if e.Kind == dm.EventRollout {
+				n.rollout(ctx, e)
+			}
+		}
+	}
+}
+
+func (n *Notifier) rollout(ctx context.Context, e dm.Event) {
+	re, ok := e.Payload.(firmware.RolloutEvent)
+	if !ok {
+		// redacted events carry generic JSON values
+		b, err := json.Marshal(e.Payload)
+		if err != nil || json.Unmarshal(b, &re) != nil {
+			return
+		}
+	}
+	var t string
+	switch re.State {
+	case firmware.RolloutPaused:
+		t = RolloutPaused
+	case firmware.RolloutRolledBack:
+		t = RolloutRolledBack
+	default:
+		return
+	}
+	summary := fmt.Sprintf("rollout %s %s: %d of %d devices failed", re.Rollout, re.State, re.Progress.Failed, re.Progress.Total)
+	if re.Detail != "" {
+		summary += " (" + re.Detail + ")"
+	}
+	n.Notify(ctx, Event{Type: t, At: e.OccurredAt, Summary: summary, Rollout: &re})
+}
+
+func (n *Notifier) watchBackends(ctx context.Context, src Source) {
+	failing := make(map[string]time.Time) // by backend: first failed check
+	down := make(map[string]bool)         // backends notified as in outage
+	t := time.NewTicker(n.cfg.CheckEvery)
+	defer t.Stop()
+	for {
+		now := time.Now()
+		for name, h := range src.Backends() {
+			if h.LastError == "" {
+				delete(failing, name)
+				if down[name] {
+					delete(down, name)
+					n.Notify(ctx, Event{Type: BackendRecovered, At: now, Summary: "backend " + name + " recovered", Backend: name})
+				}
+				continue
+			}
+			since, ok := failing[name]
+			if !ok {
+				failing[name], since = now, now
+			}
+			if !down[name] && now.Sub(since) >= n.cfg.OutageAfter {
+				down[name] = true
+				summary := fmt.Sprintf("backend %s failing since %s: %s", name, since.UTC().Format(time.RFC3339), h.LastError)
+				n.Notify(ctx, Event{Type: BackendOutage, At: now, Summary: summary, Backend: name, Error: h.LastError, Since: since})
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
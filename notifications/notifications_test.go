@@ -0,0 +1,184 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/firmware"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/manager"
+)
+
+// recorder is an HTTP endpoint keeping the JSON bodies posted to it.
+type recorder struct {
+	mu     sync.Mutex
+	bodies []map[string]interface{}
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var v map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&v)
+	rec.mu.Lock()
+	rec.bodies = append(rec.bodies, v)
+	rec.mu.Unlock()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (rec *recorder) got() []map[string]interface{} {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]map[string]interface{}(nil), rec.bodies...)
+}
+
+type source struct {
+	events chan dm.Event
+	mu     sync.Mutex
+	health map[string]manager.BackendHealth
+}
+
+type subscription struct{ c chan dm.Event }
+
+func (s subscription) C() <-chan dm.Event { return s.c }
+func (s subscription) Close() error       { return nil }
+
+func (s *source) Subscribe(int) dm.EventSubscription { return subscription{s.events} }
+
+func (s *source) Backends() map[string]manager.BackendHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]manager.BackendHealth, len(s.health))
+	for k, v := range s.health {
+		out[k] = v
+	}
+	return out
+}
+
+func (s *source) set(backend, lastError string) {
+	s.mu.Lock()
+	s.health[backend] = manager.BackendHealth{Configured: true, LastError: lastError}
+	s.mu.Unlock()
+}
+
+func TestNewValidates(t *testing.T) {
+	for name, cfg := range map[string]dm.NotificationConfig{
+		"sink type":  {Sinks: map[string]dm.NotificationSink{"x": {Type: "pager"}}},
+		"slack url":  {Sinks: map[string]dm.NotificationSink{"x": {Type: SinkSlack}}},
+		"email addr": {Sinks: map[string]dm.NotificationSink{"x": {Type: SinkEmail, SMTPAddr: "mail", From: "a@b", To: []string{"c@d"}}}},
+		"event":      {Rules: []dm.NotificationRule{{Events: []string{"job.done"}}}},
+		"rule sink":  {Rules: []dm.NotificationRule{{Events: []string{JobFailed}, Sinks: []string{"missing"}}}},
+		"template":   {Rules: []dm.NotificationRule{{Events: []string{JobFailed}, Message: "{{.Job"}}},
+	} {
+		if _, err := New(cfg, nil); !errors.Is(err, dm.ErrInvalidParameter) {
+			t.Errorf("%s: expected invalid config, got %v", name, err)
+		}
+	}
+}
+
+func TestJobFinishedToSlack(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+	n, err := New(dm.NotificationConfig{
+		Sinks: map[string]dm.NotificationSink{"ops": {Type: SinkSlack, WebhookURL: srv.URL}},
+		Rules: []dm.NotificationRule{{Events: []string{JobFailed}, Sinks: []string{"ops"}, Subject: "Job {{.Job.ID}} failed", Message: "{{.Job.Progress.Failed}} devices failed"}},
+	}, func(err error) { t.Error(err) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.JobFinished(jobs.Job{ID: "j1", Status: jobs.StatusSucceeded})
+	n.JobFinished(jobs.Job{ID: "j2", Status: jobs.StatusFailed, Spec: jobs.Spec{Operation: "reboot"}, Progress: jobs.Progress{Total: 3, Done: 3, Failed: 2}})
+	got := rec.got()
+	if len(got) != 1 || got[0]["text"] != "*Job j2 failed*\n2 devices failed" {
+		t.Fatalf("slack got %v", got)
+	}
+}
+
+func TestRunRolloutsAndOutages(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+	n, err := New(dm.NotificationConfig{
+		Sinks:       map[string]dm.NotificationSink{"pd": {Type: SinkPagerDuty, RoutingKey: "key", EventsURL: srv.URL}},
+		Rules:       []dm.NotificationRule{{Events: []string{RolloutPaused, BackendOutage, BackendRecovered}, Sinks: []string{"pd"}}},
+		OutageAfter: 30 * time.Millisecond,
+		CheckEvery:  5 * time.Millisecond,
+	}, func(err error) { t.Error(err) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &source{events: make(chan dm.Event, 4), health: map[string]manager.BackendHealth{}}
+	src.set("talaria", "connection refused")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { n.Run(ctx, src); close(done) }()
+	defer func() { cancel(); <-done }()
+
+	src.events <- dm.Event{Kind: dm.EventRollout, Payload: firmware.RolloutEvent{Rollout: "r1", State: firmware.RolloutRunning}}
+	src.events <- dm.Event{Kind: dm.EventRollout, Payload: map[string]interface{}{"rollout": "r1", "state": "paused", "progress": map[string]interface{}{"total": 10, "failed": 3}}}
+	waitFor(t, func() bool { return len(rec.got()) >= 2 })
+	src.set("talaria", "")
+	waitFor(t, func() bool { return len(rec.got()) >= 3 })
+
+	got := rec.got()
+	var keys, actions []string
+	for _, b := range got {
+		keys = append(keys, b["dedup_key"].(string))
+		actions = append(actions, b["event_action"].(string))
+	}
+	// the rollout event and the outage race; sort them out by key
+	if !contains(keys, "rollout.paused:rollout:r1") || !contains(keys, "backend:talaria") || actions[2] != "resolve" || keys[2] != "backend:talaria" || len(got) != 3 {
+		t.Fatalf("pagerduty got %v", got)
+	}
+	for _, b := range got {
+		if p := b["payload"].(map[string]interface{}); b["dedup_key"] == "rollout.paused:rollout:r1" && p["summary"] != "rollout r1 paused: 3 of 10 devices failed" {
+			t.Fatalf("rollout summary %v", p["summary"])
+		}
+	}
+}
+
+func TestEmailSink(t *testing.T) {
+	var sent []string
+	s := &EmailSink{Addr: "mail:25", Username: "u", Password: "p", From: "dm@example.com", To: []string{"ops@example.com"},
+		send: func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			if addr != "mail:25" || a == nil || from != "dm@example.com" || len(to) != 1 {
+				return errors.New("unexpected envelope")
+			}
+			sent = append(sent, string(msg))
+			return nil
+		}}
+	if err := s.Send(context.Background(), Message{Subject: "job j1\nfailed", Body: "line 1\nline 2"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || !strings.Contains(sent[0], "Subject: job j1 failed\r\n") || !strings.HasSuffix(sent[0], "\r\n\r\nline 1\r\nline 2") {
+		t.Fatalf("sent %q", sent)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
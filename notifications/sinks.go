@@ -0,0 +1,156 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Sink types of dm.NotificationSink.
+const (
+	SinkEmail     = "email"
+	SinkSlack     = "slack"
+	SinkPagerDuty = "pagerduty"
+)
+
+func newSink(c dm.NotificationSink, client *http.Client) (Sink, error) {
+	switch c.Type {
+	case SinkSlack:
+		if c.WebhookURL == "" {
+			return nil, fmt.Errorf("slack webhookUrl required: %w", dm.ErrInvalidParameter)
+		}
+		return &SlackSink{URL: c.WebhookURL, Client: client}, nil
+	case SinkPagerDuty:
+		if c.RoutingKey == "" {
+			return nil, fmt.Errorf("pagerduty routingKey required: %w", dm.ErrInvalidParameter)
+		}
+		s := &PagerDutySink{URL: c.EventsURL, RoutingKey: c.RoutingKey, Severity: c.Severity, Client: client}
+		if s.URL == "" {
+			s.URL = dm.DefaultPagerDutyEventsURL
+		}
+		if s.Severity == "" {
+			s.Severity = "error"
+		}
+		return s, nil
+	case SinkEmail:
+		if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil || c.From == "" || len(c.To) == 0 {
+			return nil, fmt.Errorf("email smtpAddr (host:port), from and to required: %w", dm.ErrInvalidParameter)
+		}
+		return &EmailSink{Addr: c.SMTPAddr, Username: c.Username, Password: c.Password, From: c.From, To: c.To}, nil
+	}
+	return nil, fmt.Errorf("unknown type %q: %w", c.Type, dm.ErrInvalidParameter)
+}
+
+// SlackSink posts messages to a Slack incoming webhook.
+type SlackSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *SlackSink) Send(ctx context.Context, m Message) error {
+	text := m.Body
+	if m.Subject != "" && m.Subject != m.Body {
+		text = "*" + m.Subject + "*\n" + m.Body
+	}
+	return postJSON(ctx, s.Client, "slack", s.URL, map[string]string{"text": text})
+}
+
+// PagerDutySink triggers PagerDuty incidents through the Events API v2. Incidents are deduplicated
+// by what they are about, so backend.recovered resolves the incident of the backend's outage.
+type PagerDutySink struct {
+	URL        string
+	RoutingKey string
+	Severity   string
+	Client     *http.Client
+}
+
+func (s *PagerDutySink) Send(ctx context.Context, m Message) error {
+	action, key := "trigger", m.Event.Type+":"+m.Event.key()
+	switch m.Event.Type {
+	case BackendOutage:
+		key = m.Event.key() // an outage and its recovery share one incident
+	case BackendRecovered:
+		action, key = "resolve", m.Event.key()
+	}
+	body := map[string]interface{}{
+		"routing_key":  s.RoutingKey,
+		"event_action": action,
+		"dedup_key":    key,
+		"payload": map[string]interface{}{
+			"summary":        m.Subject,
+			"source":         "devicemgr",
+			"severity":       s.Severity,
+			"timestamp":      m.Event.At.UTC().Format("2006-01-02T15:04:05Z"),
+			"class":          m.Event.Type,
+			"custom_details": map[string]string{"message": m.Body},
+		},
+	}
+	return postJSON(ctx, s.Client, "pagerduty", s.URL, body)
+}
+
+// EmailSink mails messages through an SMTP server, with PLAIN authentication when Username is
+// set.
+type EmailSink struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+	To       []string
+
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error // smtp.SendMail
+}
+
+func (s *EmailSink) Send(_ context.Context, m Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n", s.From, strings.Join(s.To, ", "), headerSafe(m.Subject))
+	msg.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	send := s.send
+	if send == nil {
+		send = smtp.SendMail
+	}
+	if err := send(s.Addr, auth, s.From, s.To, msg.Bytes()); err != nil {
+		return fmt.Errorf("email: %w", err)
+	}
+	return nil
+}
+
+// headerSafe keeps a templated subject on one header line.
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+func postJSON(ctx context.Context, client *http.Client, backend, url string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", backend, dm.ErrBackendUnavailable)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return dm.NewBackendError(backend, resp)
+	}
+	return nil
+}
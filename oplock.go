@@ -0,0 +1,49 @@
+package devicemgr
+
+import (
+	"fmt"
+	"time"
+)
+
+// Exclusive operation kinds: at most one of them runs on a device at a time.
+const (
+	OperationReboot         = "reboot"
+	OperationFactoryReset   = "factory-reset"
+	OperationFirmwareUpdate = "firmware-update"
+	OperationLogUpload      = "log-upload"
+)
+
+// SerializerConfig controls how the Manager serializes exclusive operations (reboots, factory
+// resets, firmware updates and log uploads) on one device.
+type SerializerConfig struct {
+	// Wait is how long an operation queues behind the one holding its device before failing with
+	// an *OperationConflictError; zero rejects it at once.
+	Wait time.Duration
+}
+
+// DeviceOperation is an exclusive operation holding a device.
+type DeviceOperation struct {
+	Kind      string    `json:"kind"`             // one of the Operation kinds
+	Actor     string    `json:"actor,omitempty"`  // who started it (see WithActor)
+	Detail    string    `json:"detail,omitempty"` // such as the firmware update's ID
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// OperationConflictError is returned for an exclusive operation refused because another one holds
+// the device; it matches ErrConflict with errors.Is.
+type OperationConflictError struct {
+	DeviceID  DeviceID
+	Requested string // the refused operation's kind
+	Holder    DeviceOperation
+}
+
+func (e *OperationConflictError) Error() string {
+	by := ""
+	if e.Holder.Actor != "" {
+		by = " by " + e.Holder.Actor
+	}
+	return fmt.Sprintf("%s on %s: %s%s running since %s: %s", e.Requested, e.DeviceID, e.Holder.Kind, by,
+		e.Holder.StartedAt.UTC().Format(time.RFC3339), ErrConflict)
+}
+
+func (e *OperationConflictError) Is(target error) bool { return target == ErrConflict }
@@ -1,6 +1,7 @@
 package devicemgr
 
 import (
+	"sync/atomic"
 	"time"
 )
 
@@ -14,32 +15,377 @@ type StaticAuth struct{ Value string }
 
 func (s StaticAuth) AuthorizationValue() (string, error) { return s.Value, nil }
 
+// ReloadableAuth is an AuthStrategy whose underlying strategy can be replaced while adapters hold
+// it, so credentials rotate without rebuilding them. The Manager wraps each configured strategy in
+// one; Manager.Reload swaps them.
+type ReloadableAuth struct{ v atomic.Pointer[AuthStrategy] }
+
+// NewReloadableAuth returns a ReloadableAuth delegating to a.
+func NewReloadableAuth(a AuthStrategy) *ReloadableAuth {
+	r := &ReloadableAuth{}
+	r.Set(a)
+	return r
+}
+
+// Set replaces the underlying strategy; nil makes AuthorizationValue return "".
+func (r *ReloadableAuth) Set(a AuthStrategy) { r.v.Store(&a) }
+
+func (r *ReloadableAuth) AuthorizationValue() (string, error) {
+	if a := *r.v.Load(); a != nil {
+		return a.AuthorizationValue()
+	}
+	return "", nil
+}
+
 // Options configures the Device Management Layer.
 type Options struct {
+	// Profile names the deployment profile whose defaults PresetOptions started from; empty for
+	// DefaultOptions.
+	Profile string
+
 	TalariaBaseURL    string
 	Tr1d1umBaseURL    string // should include /api/v3 prefix
 	XconfAdminBaseURL string
+	BlizzardBaseURL   string // websocket gateway prefix, e.g. wss://host/blizzard
+	CodexBaseURL      string // Gungnir API serving Codex event history
 
 	Auth struct {
 		Talaria    AuthStrategy
 		Tr1d1um    AuthStrategy
 		XconfAdmin AuthStrategy
+		Blizzard   AuthStrategy
+		Codex      AuthStrategy
+		Caduceus   AuthStrategy
 	}
 
+	// Partners overrides backend credentials for calls made on behalf of a partner (keyed by partner ID).
+	Partners map[string]PartnerOptions
+
 	Services []string // valid tr1d1um translation services
 
+	// MaxGetNames caps the parameter names sent to Tr1d1um in one GET; longer reads are split into
+	// concurrent chunks. Zero uses runtime.DefaultMaxGetNames.
+	MaxGetNames int
+
+	// CORSOrigins lists the browser origins allowed to call the API; empty (or "*") allows any.
+	CORSOrigins []string
+
+	// ErrorLanguage is the language API error bodies describe device faults in (see
+	// translate.ErrorCatalog), a tag such as "es"; empty is English.
+	ErrorLanguage string
+
+	// Allowlist restricts the client networks that reach the discovery and debug APIs.
+	Allowlist AllowlistConfig
+
 	Polling PollingConfig
 	Cache   CacheConfig
+
+	// Sharding places devices on Polling.Instances the way Talaria's service discovery does, for
+	// the poller's attribution and Routing.Predict; nil uses ConsistentHasher, the XMiDT hash.
+	Sharding ShardHasher
+
+	// HTTP tunes the connection pool shared by the backend adapters.
+	HTTP HTTPConfig
+
+	// Verbose logs every backend HTTP request with log.Default(): method, URL, status and latency.
+	Verbose bool
+
+	// Per-operation deadlines the Manager applies to each call's context (a sooner caller
+	// deadline wins); zero uses the Default*Timeout constants. Retries run within the deadline.
+	GetTimeout    time.Duration // parameter reads, including USP Gets
+	SetTimeout    time.Duration // parameter writes, including USP Sets
+	RPCTimeout    time.Duration // Blizzard and MQTT JSON-RPC calls without their own Timeout, USP Operate
+	PolicyTimeout time.Duration // xconfadmin policy lookups
+
+	// RPCCancelMethod names the JSON-RPC notification, e.g. "$/cancelRequest", sent to a device
+	// with {"id":...} when one of its Blizzard or MQTT calls is canceled or times out, for devices
+	// that can abandon the work; empty sends none.
+	RPCCancelMethod string
+
+	// Retry is how every adapter retries idempotent backend requests (reads, polls, policy and
+	// history lookups, USP Gets) and Blizzard reconnects; writes are never retried.
+	Retry RetryPolicy
+
+	// Breaker fails parameter reads, writes and RPCs fast for devices that keep timing out.
+	Breaker BreakerConfig
+
+	// JWT holds the keys bearer tokens are verified with before their role and partner claims are
+	// trusted.
+	JWT JWTConfig
+
+	// MQTT bridges devices through an MQTT broker for events and, optionally, RPC.
+	MQTT MQTTConfig
+
+	// USP manages TR-369 agents alongside WebPA devices.
+	USP USPConfig
+
+	// Caduceus delivers device events by webhook instead of polling alone.
+	Caduceus CaduceusConfig
+
+	// Traps bridges trap notifications posted by a legacy forwarder into device events.
+	Traps TrapConfig
+
+	// Metrics bounds the partner and model labels of Manager.Metrics.
+	Metrics MetricsConfig
+
+	// StatsRetention is how long Manager.StatsHistory keeps the fleet sample taken after each
+	// poll (manager.DefaultStatsRetention).
+	StatsRetention time.Duration
+
+	// Quality samples Talaria's per-device connection statistics into quality scores.
+	Quality QualityConfig
+
+	// Routing dials Blizzard on the Talaria instance hosting each device instead of through the
+	// load balancer.
+	Routing RoutingConfig
+
+	// Faults injects failures into backend calls and device websockets for resilience testing;
+	// never enable it in production.
+	Faults FaultConfig
+
+	// Lifecycle selects the parameters used by Manager.Reboot, FactoryReset and UploadLogs.
+	Lifecycle LifecycleConfig
+
+	// Maintenance restricts disruptive operations to each device's maintenance window.
+	Maintenance MaintenanceConfig
+
+	// Approvals holds destructive bulk jobs until a second admin approves them.
+	Approvals ApprovalConfig
+
+	// Serializer keeps exclusive operations on one device (reboot, factory reset, firmware update,
+	// log upload) from overlapping, queuing or rejecting the later one.
+	Serializer SerializerConfig
+
+	// Artifacts selects where bulk job artifacts are kept: an S3-compatible bucket, Redis or
+	// memory.
+	Artifacts ArtifactConfig
+
+	// Notifications sends job and rollout outcomes and backend outages to email, Slack and
+	// PagerDuty.
+	Notifications NotificationConfig
+
+	// Events tunes ordering and deduplication of Manager.Subscribe events.
+	Events EventsConfig
+
+	// ParameterACL limits the parameters each role may read and write through the Manager; roles
+	// without a rule are unrestricted.
+	ParameterACL map[Role]ParameterRule
+
+	// Redaction masks sensitive parameter values in events and audit records; the zero value
+	// masks dm.DefaultRedactedParameters.
+	Redaction RedactionConfig
+
+	// Audit records lifecycle operations; nil logs them with log.Default().
+	Audit AuditSink
+
+	// Operations keeps each device's recent reads, writes, RPCs and lifecycle operations for
+	// Manager.Operations; nil keeps DefaultOperationHistory per device in memory, or in Redis when
+	// Cache.RedisURL is set.
+	Operations OperationLog
+
+	// Locks keeps the ConfigLocks of Manager.AcquireLock; nil keeps them in memory, or in Redis
+	// when Cache.RedisURL is set.
+	Locks LockStore
+
+	// Enrichment adds external inventory attributes to device metadata.
+	Enrichment EnrichmentConfig
+
+	// Catalog checks dry-run SETs (SetOptions.DryRun); nil uses schema.Default().
+	Catalog ParameterCatalog
+
+	// DataModel detects devices' data-model versions for catalogs that translate parameter names
+	// between versions (see ParameterResolver).
+	DataModel DataModelConfig
+
+	// Elector gates backend polling in multi-replica deployments; followers serve reads from the
+	// leader's shared snapshot, so Cache.RedisURL is required. Nil with Cache.RedisURL set uses a
+	// Redis lock; nil without it polls unconditionally.
+	Elector Elector
+}
+
+// MQTTConfig enables the MQTT transport when Broker is set. Topic templates take a {device}
+// level (and {service} for RPC topics); empty templates use the runtime defaults.
+type MQTTConfig struct {
+	Broker   string // tcp://host:1883 or ssl://host:8883
+	ClientID string // defaults to "devicemgr-<hostname>"
+	Username string
+	Password string
+	QoS      byte // 0 or 1
+
+	EventTopic    string
+	RPCTopic      string
+	ResponseTopic string
+	// RPC routes Manager.Call over MQTT instead of the Blizzard gateway.
+	RPC bool
+
+	// TLS for ssl:// brokers: CAFile adds a trust root, CertFile/KeyFile a client certificate.
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// USPConfig enables the USP controller when EndpointID is set. Agents connect over the WebSocket
+// MTP (Manager.USPHandler) or, with ControllerTopic, over the MQTT MTP of the MQTT.Broker.
+// Device IDs of the form "<scheme>::<id>" (e.g. "os::012345-001122334455") are USP endpoint IDs
+// and are routed to it instead of Tr1d1um.
+type USPConfig struct {
+	EndpointID      string        // controller endpoint ID, e.g. "self::devicemgr"
+	ControllerTopic string        // MQTT topic agents publish to; selects the MQTT MTP
+	AgentTopic      string        // MQTT agent topic template; runtime.DefaultUSPAgentTopic
+	Timeout         time.Duration // per request (30s)
+}
+
+// CaduceusConfig enables the Caduceus webhook adapter (Manager.CaduceusHandler) when URL is set.
+// Manager.RunCaduceus keeps the webhook registered.
+type CaduceusConfig struct {
+	URL         string        // Caduceus base URL; the webhook is registered at <URL>/hook
+	CallbackURL string        // where Caduceus delivers: the public URL of Manager.CaduceusHandler
+	Secret      string        // signs deliveries (X-Webpa-Signature); unsigned ones are rejected when set
+	Events      []string      // event type regexps (runtime.DefaultCaduceusEvents)
+	Duration    time.Duration // registration lifetime, renewed halfway through (5m)
+}
+
+// TrapConfig enables the trap ingestion bridge (Manager.TrapHandler) when Enabled. Forwarders POST
+// traps as JSON; DeviceIDs translates the agent identifiers they carry to device IDs.
+type TrapConfig struct {
+	Enabled bool
+	// DeviceIDs maps agent identifiers (address, serial, ...) to device IDs; identifiers missing
+	// from it must parse as device IDs themselves.
+	DeviceIDs map[string]string
+	Kinds     map[string]EventKind // trap OID to event kind; other OIDs are notifications
+	Token     string               // when set, forwarders must send "Authorization: Bearer <Token>"
+}
+
+// MetricsConfig bounds metric label cardinality: up to LabelLimit distinct partners and as many
+// models are labeled individually, later ones as "other" (metrics.DefaultLabelLimit when zero).
+type MetricsConfig struct {
+	LabelLimit int
+}
+
+// QualityConfig drives the connection quality collector (package quality) when Interval is set.
+// Each round samples Devices or, when none are listed, up to Sample online devices at random.
+type QualityConfig struct {
+	Interval time.Duration
+	Devices  []DeviceID
+	Sample   int // quality.DefaultSample when zero
+}
+
+// RoutingConfig enables device routing (runtime.TalariaRouter) when Enabled. Instances are
+// resolved through petasos when PetasosURL is set and otherwise from Talaria's stat endpoint.
+type RoutingConfig struct {
+	Enabled    bool
+	PetasosURL string        // petasos base URL; its redirects name each device's instance
+	TTL        time.Duration // how long a resolved instance is used before resolving again (1m)
+	Failures   int           // consecutive failed dials that take an instance out of rotation (3)
+	Cooldown   time.Duration // how long an instance stays out of rotation (30s)
+	// Predict resolves instances by placing devices on Polling.Instances with Options.Sharding
+	// instead of asking petasos or Talaria.
+	Predict bool
+}
+
+// FaultConfig drives the fault injection layer (package faults) when Enabled. Rates are fractions
+// from 0 to 1, applied independently to each backend HTTP call or inbound websocket frame.
+type FaultConfig struct {
+	Enabled       bool
+	Latency       time.Duration // delay added to a call or frame chosen by LatencyRate
+	LatencyRate   float64
+	ErrorRate     float64  // calls answered with ErrorStatus without reaching the backend
+	ErrorStatus   int      // 503 when zero
+	MalformedRate float64  // responses and frames whose payload is truncated
+	DropRate      float64  // Blizzard and USP websocket frames discarded unread
+	Hosts         []string // backend hosts (host[:port]) calls to which are faulted; empty faults all
+}
+
+// LifecycleConfig names the TR-181 parameters and values written to reboot or factory-reset a
+// device and to trigger and follow log uploads; empty fields use the RDK defaults.
+type LifecycleConfig struct {
+	RebootParameter       string
+	RebootValue           string
+	FactoryResetParameter string
+	FactoryResetValue     string
+
+	LogUploadParameter         string // boolean; true starts an upload
+	LogUploadStatusParameter   string // "Not triggered", "In progress", "Complete", "Failed"
+	LogUploadLocationParameter string // where the last upload was stored
+}
+
+// PartnerOptions holds per-partner backend credentials; nil strategies fall back to Options.Auth.
+type PartnerOptions struct {
+	Auth struct {
+		Tr1d1um    AuthStrategy
+		XconfAdmin AuthStrategy
+	}
+}
+
+// JWTConfig configures bearer token verification. At least one key source is required; without one
+// the API rejects every token.
+type JWTConfig struct {
+	HMACSecret string // shared secret for HS256/384/512 tokens
+	JWKSURL    string // key set for RS*, PS* and ES* tokens, refreshed hourly or on an unknown kid
+	Issuer     string // required iss, when set
+	Audience   string // required aud entry, when set
+}
+
+// HTTPConfig tunes the Transport shared by the Talaria, Tr1d1um, xconfadmin and Codex clients; the
+// Blizzard dialer shares its TLS session cache. Zero fields use the defaults in parentheses.
+type HTTPConfig struct {
+	MaxIdleConns        int           // idle connections kept across all hosts (256)
+	MaxIdleConnsPerHost int           // idle connections kept per backend (64)
+	MaxConnsPerHost     int           // 0 is unlimited
+	IdleConnTimeout     time.Duration // (90s)
+	TLSHandshakeTimeout time.Duration // (10s)
+	TLSSessionCacheSize int           // TLS sessions kept for resumption (256)
+	DisableHTTP2        bool
+	// InsecureSkipVerify accepts any backend certificate, for development stacks with self-signed
+	// ones; never set it in production.
+	InsecureSkipVerify bool
 }
 
 type PollingConfig struct {
-	DeviceList       time.Duration
+	DeviceList time.Duration
+	// OfflineAfter is how many consecutive device list polls a device must be missing from before
+	// it is offline; until then it is suspect (default 2). StatSuspects confirms new suspects with
+	// Talaria's stat endpoint instead of waiting.
+	OfflineAfter int
+	StatSuspects bool
+
 	FirmwarePolicies time.Duration
 	Settings         time.Duration
 	Telemetry        time.Duration
 	Features         time.Duration
 	Rollout          time.Duration
 	Global           time.Duration
+
+	// Instances lists the base URLs of individual Talaria instances. When set their device lists
+	// are polled concurrently and merged instead of TalariaBaseURL's, and every device is tagged
+	// with the instance holding it (MetadataTalariaInstance).
+	Instances []string
+}
+
+// Lease is the poll leadership lease: three device list intervals (45s when unset), so a leader
+// that misses two polls in a row loses its lease before followers serve a stale snapshot.
+func (p PollingConfig) Lease() time.Duration {
+	if p.DeviceList <= 0 {
+		return 45 * time.Second
+	}
+	return 3 * p.DeviceList
+}
+
+// EventsConfig tunes the event bus merging device sources.
+type EventsConfig struct {
+	// DedupWindow drops an event repeating the device's previous event of the same kind within the
+	// window, e.g. a transition seen both by polling and over MQTT (30s; negative disables).
+	DedupWindow time.Duration
+	// SigningKeys are HMAC-SHA256 keys by ID; an SSE stream opened with sign=<ID> is signed with
+	// that key so consumers can verify its events came from devicemgr.
+	SigningKeys map[string]string
+	// JournalSize is how many events Manager.Changes can page through before the oldest are
+	// evicted and cursors from before them expire (events.DefaultJournalSize).
+	JournalSize int
+	// Pipeline enriches, tags, transforms and drops events before they are fanned out (see
+	// EventStage).
+	Pipeline []EventStage
 }
 
 type CacheConfig struct {
@@ -47,8 +393,27 @@ type CacheConfig struct {
 	ParamTTL        time.Duration
 	PolicyTTL       time.Duration
 	StaleAcceptable time.Duration
+
+	// ConfigTTL bounds how long Manager.GetConfig serves a subtree read for an unchanged
+	// configuration CID (1h; zero disables). ConfigCIDParameter names the CID parameter
+	// (manager.DefaultConfigCIDParameter).
+	ConfigTTL          time.Duration
+	ConfigCIDParameter string
+
+	// RedisURL (redis://...) shares the parameter cache, policy cache and device snapshot between
+	// replicas; only the elected leader then polls Talaria. Empty keeps state in memory.
+	RedisURL    string
+	RedisPrefix string // key namespace; defaults to "devicemgr:"
 }
 
+// Per-operation timeouts used when the Options fields are unset.
+const (
+	DefaultGetTimeout    = 15 * time.Second
+	DefaultSetTimeout    = 15 * time.Second
+	DefaultRPCTimeout    = 5 * time.Second
+	DefaultPolicyTimeout = 10 * time.Second
+)
+
 // DefaultOptions gives baseline sensible defaults for local dev.
 func DefaultOptions() Options {
 	opts := Options{}
@@ -66,6 +431,11 @@ func DefaultOptions() Options {
 		ParamTTL:        5 * time.Second,
 		PolicyTTL:       60 * time.Second,
 		StaleAcceptable: 5 * time.Second,
+		ConfigTTL:       time.Hour,
 	}
+	opts.GetTimeout, opts.SetTimeout = DefaultGetTimeout, DefaultSetTimeout
+	opts.RPCTimeout, opts.PolicyTimeout = DefaultRPCTimeout, DefaultPolicyTimeout
+	opts.Retry = DefaultRetryPolicy()
+	opts.Breaker = DefaultBreakerConfig()
 	return opts
 }
@@ -0,0 +1,106 @@
+package devicemgr
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ParameterAccess is what a caller does with a parameter.
+type ParameterAccess int
+
+const (
+	ParameterRead ParameterAccess = iota
+	ParameterWrite
+)
+
+func (a ParameterAccess) String() string {
+	if a == ParameterWrite {
+		return "write"
+	}
+	return "read"
+}
+
+// ParameterRule limits the parameters a role may read and write. Patterns match parameter names
+// the way RedactionConfig.Parameters do: '*' matches any run of characters, dots included, and
+// matching ignores case. A partial path such as "Device.WiFi." is read when it matches itself,
+// and the values read are then filtered by the rule.
+type ParameterRule struct {
+	Read      []string `json:"read"`      // names the role may read; empty allows any
+	Write     []string `json:"write"`     // names the role may write; empty allows any
+	DenyRead  []string `json:"denyRead"`  // refused even when Read allows them
+	DenyWrite []string `json:"denyWrite"` // refused even when Write allows them
+}
+
+// ParameterACL enforces per-role ParameterRules. Roles without a rule, and callers without a role
+// because authorization is not in use, are unrestricted. The nil ParameterACL allows everything.
+type ParameterACL struct {
+	rules map[Role]compiledRule
+}
+
+type compiledRule struct {
+	allow, deny [2]*regexp.Regexp // by ParameterAccess; nil allows any, or denies none
+}
+
+// NewParameterACL compiles rules, returning nil when there are none.
+func NewParameterACL(rules map[Role]ParameterRule) *ParameterACL {
+	if len(rules) == 0 {
+		return nil
+	}
+	acl := &ParameterACL{rules: make(map[Role]compiledRule, len(rules))}
+	for role, r := range rules {
+		acl.rules[role] = compiledRule{
+			allow: [2]*regexp.Regexp{compileGlobs(r.Read), compileGlobs(r.Write)},
+			deny:  [2]*regexp.Regexp{compileGlobs(r.DenyRead), compileGlobs(r.DenyWrite)},
+		}
+	}
+	return acl
+}
+
+// Allowed reports whether the caller's role may access the named parameter.
+func (a *ParameterACL) Allowed(ctx context.Context, access ParameterAccess, name string) bool {
+	if a == nil {
+		return true
+	}
+	role, ok := RoleFromContext(ctx)
+	if !ok {
+		return true
+	}
+	r, ok := a.rules[role]
+	if !ok {
+		return true
+	}
+	if allow := r.allow[access]; allow != nil && !allow.MatchString(name) {
+		return false
+	}
+	deny := r.deny[access]
+	return deny == nil || !deny.MatchString(name)
+}
+
+// Check fails with ErrAccessDenied, naming the parameter, when the caller's role may not access
+// one of names.
+func (a *ParameterACL) Check(ctx context.Context, access ParameterAccess, names ...string) error {
+	for _, name := range names {
+		if !a.Allowed(ctx, access, name) {
+			role, _ := RoleFromContext(ctx)
+			return fmt.Errorf("role %s may not %s %s: %w", role, access, name, ErrAccessDenied)
+		}
+	}
+	return nil
+}
+
+// compileGlobs matches a name against any of the patterns, in which '*' matches any run of
+// characters and case is ignored; nil when there are no patterns.
+func compileGlobs(patterns []string) *regexp.Regexp {
+	var alts []string
+	for _, p := range patterns {
+		if p = strings.TrimSpace(p); p != "" {
+			alts = append(alts, strings.ReplaceAll(regexp.QuoteMeta(p), `\*`, ".*"))
+		}
+	}
+	if len(alts) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(`^(?i:` + strings.Join(alts, "|") + `)$`)
+}
@@ -0,0 +1,47 @@
+package devicemgr
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParameterACL(t *testing.T) {
+	acl := NewParameterACL(map[Role]ParameterRule{
+		RoleViewer: {
+			Read:      []string{"Device.WiFi.*", "Device.DeviceInfo.*"},
+			DenyRead:  []string{"*.Security.KeyPassphrase"},
+			Write:     []string{"Device.WiFi.SSID.*"},
+			DenyWrite: []string{"*.Security.*"},
+		},
+	})
+	viewer := WithRole(context.Background(), RoleViewer)
+	for _, c := range []struct {
+		ctx    context.Context
+		access ParameterAccess
+		name   string
+		want   bool
+	}{
+		{viewer, ParameterRead, "Device.WiFi.Radio.1.Status", true},
+		{viewer, ParameterRead, "device.wifi.radio.1.status", true},
+		{viewer, ParameterRead, "Device.WiFi.", true},
+		{viewer, ParameterRead, "Device.", false},
+		{viewer, ParameterRead, "Device.WiFi.AccessPoint.1.Security.KeyPassphrase", false},
+		{viewer, ParameterRead, "Device.ManagementServer.URL", false},
+		{viewer, ParameterWrite, "Device.WiFi.SSID.1.SSID", true},
+		{viewer, ParameterWrite, "Device.WiFi.AccessPoint.1.Security.ModeEnabled", false},
+		{WithRole(context.Background(), RoleOperator), ParameterWrite, "Device.ManagementServer.URL", true},
+		{context.Background(), ParameterWrite, "Device.ManagementServer.URL", true},
+	} {
+		if got := acl.Allowed(c.ctx, c.access, c.name); got != c.want {
+			t.Errorf("%s %s: got %v, want %v", c.access, c.name, got, c.want)
+		}
+	}
+	if err := acl.Check(viewer, ParameterWrite, "Device.WiFi.SSID.1.SSID", "Device.X_Reboot"); !errors.Is(err, ErrAccessDenied) || err.Error() != "role viewer may not write Device.X_Reboot: access denied" {
+		t.Fatalf("Check: %v", err)
+	}
+	var none *ParameterACL
+	if !none.Allowed(viewer, ParameterWrite, "Device.X_Reboot") || NewParameterACL(nil) != nil {
+		t.Fatal("no rules should allow everything")
+	}
+}
@@ -0,0 +1,125 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/cache"
+)
+
+// CatalogKind names one of the xconf catalogs firmware and settings rules refer to.
+type CatalogKind string
+
+const (
+	CatalogEnvironments CatalogKind = "environments"
+	CatalogModels       CatalogKind = "models"
+	CatalogPartners     CatalogKind = "partners"
+)
+
+// catalogPaths are the xconfadmin collections behind each kind.
+var catalogPaths = map[CatalogKind]string{
+	CatalogEnvironments: "/xconfAdminService/environment",
+	CatalogModels:       "/xconfAdminService/model",
+	CatalogPartners:     "/xconfAdminService/partner",
+}
+
+// ParseCatalogKind validates a kind named by a caller.
+func ParseCatalogKind(s string) (CatalogKind, error) {
+	k := CatalogKind(strings.ToLower(s))
+	if _, ok := catalogPaths[k]; !ok {
+		return "", fmt.Errorf("catalog %q: want environments, models or partners: %w", s, dm.ErrInvalidParameter)
+	}
+	return k, nil
+}
+
+// CatalogEntry is an environment, model or partner. xconf keeps IDs upper case.
+type CatalogEntry struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+}
+
+// CatalogAdapter lists, creates and deletes catalog entries. Lists are cached for the TTL given to
+// NewCatalogAdapter and dropped by every write made through the adapter.
+type CatalogAdapter struct {
+	c     *Client
+	lists *cache.TTL[[]CatalogEntry]
+}
+
+// NewCatalogAdapter caches lists for ttl; a non-positive ttl fetches them every time.
+func NewCatalogAdapter(c *Client, ttl time.Duration) *CatalogAdapter {
+	return &CatalogAdapter{c: c, lists: cache.NewTTL[[]CatalogEntry](ttl)}
+}
+
+// SetTTL changes how long lists are cached.
+func (a *CatalogAdapter) SetTTL(ttl time.Duration) { a.lists.SetTTL(ttl) }
+
+// List returns every entry of the catalog.
+func (a *CatalogAdapter) List(ctx context.Context, kind CatalogKind) ([]CatalogEntry, error) {
+	path, ok := catalogPaths[kind]
+	if !ok {
+		return nil, fmt.Errorf("catalog %q: %w", kind, dm.ErrInvalidParameter)
+	}
+	if list, _, ok := a.lists.Get(string(kind)); ok {
+		return list, nil
+	}
+	var list []CatalogEntry
+	if err := a.c.getJSON(ctx, path, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", kind, err)
+	}
+	a.lists.Set(string(kind), list)
+	return list, nil
+}
+
+// Has reports whether the catalog holds id, compared case-insensitively.
+func (a *CatalogAdapter) Has(ctx context.Context, kind CatalogKind, id string) (bool, error) {
+	list, err := a.List(ctx, kind)
+	if err != nil {
+		return false, err
+	}
+	for _, e := range list {
+		if strings.EqualFold(e.ID, id) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Create adds an entry, upper-casing its ID as xconf does. An ID already present is ErrConflict.
+func (a *CatalogAdapter) Create(ctx context.Context, kind CatalogKind, e CatalogEntry) (CatalogEntry, error) {
+	path, ok := catalogPaths[kind]
+	if !ok {
+		return CatalogEntry{}, fmt.Errorf("catalog %q: %w", kind, dm.ErrInvalidParameter)
+	}
+	e.ID = strings.ToUpper(strings.TrimSpace(e.ID))
+	if e.ID == "" || strings.ContainsAny(e.ID, "/ ") {
+		return CatalogEntry{}, fmt.Errorf("%s entry ID %q: %w", kind, e.ID, dm.ErrInvalidParameter)
+	}
+	defer a.lists.Delete(string(kind))
+	var saved CatalogEntry
+	if err := a.c.sendJSON(ctx, http.MethodPost, path, e, &saved); err != nil {
+		return CatalogEntry{}, fmt.Errorf("%s %s: %w", kind, e.ID, err)
+	}
+	if saved.ID == "" {
+		saved = e
+	}
+	return saved, nil
+}
+
+// Delete removes an entry; an unknown ID is ErrPolicyNotFound. xconf refuses, with ErrConflict,
+// to delete an entry rules still use.
+func (a *CatalogAdapter) Delete(ctx context.Context, kind CatalogKind, id string) error {
+	path, ok := catalogPaths[kind]
+	if !ok {
+		return fmt.Errorf("catalog %q: %w", kind, dm.ErrInvalidParameter)
+	}
+	defer a.lists.Delete(string(kind))
+	if err := a.c.sendJSON(ctx, http.MethodDelete, path+"/"+url.PathEscape(id), nil, nil); err != nil {
+		return fmt.Errorf("%s %s: %w", kind, id, err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestCatalogAdapter(t *testing.T) {
+	var mu sync.Mutex
+	lists := 0
+	models := []CatalogEntry{{ID: "XB7", Description: "Technicolor XB7"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/xconfAdminService/model":
+			lists++
+			_ = json.NewEncoder(w).Encode(models)
+		case r.Method == http.MethodPost && r.URL.Path == "/xconfAdminService/model":
+			var e CatalogEntry
+			_ = json.NewDecoder(r.Body).Decode(&e)
+			models = append(models, e)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(e)
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/xconfAdminService/model/"):
+			if strings.TrimPrefix(r.URL.Path, "/xconfAdminService/model/") == "XB7" {
+				w.WriteHeader(http.StatusConflict) // still used by a rule
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	ca := NewCatalogAdapter(&Client{BaseURL: srv.URL, Auth: staticAuth{""}}, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if ok, err := ca.Has(ctx, CatalogModels, "xb7"); err != nil || !ok {
+			t.Fatalf("has xb7: %v %v", ok, err)
+		}
+	}
+	if lists != 1 {
+		t.Fatalf("cached list fetched %d times", lists)
+	}
+	saved, err := ca.Create(ctx, CatalogModels, CatalogEntry{ID: "cgm4981com"})
+	if err != nil || saved.ID != "CGM4981COM" {
+		t.Fatalf("create: %+v %v", saved, err)
+	}
+	if ok, _ := ca.Has(ctx, CatalogModels, "CGM4981COM"); !ok || lists != 2 {
+		t.Fatalf("create did not drop the cached list (%d lists)", lists)
+	}
+	if err := ca.Delete(ctx, CatalogModels, "XB7"); !errors.Is(err, dm.ErrConflict) {
+		t.Fatalf("delete of a model in use: %v", err)
+	}
+	if err := ca.Delete(ctx, CatalogModels, "CGM4981COM"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseCatalogKind("regions"); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("unknown kind: %v", err)
+	}
+}
@@ -2,12 +2,103 @@ package policy
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
 )
 
+// FeatureAdapter reads xconf RFC features and adjusts their rollout.
 type FeatureAdapter struct{ c *Client }
 
 func NewFeatureAdapter(c *Client) *FeatureAdapter { return &FeatureAdapter{c: c} }
+
+// Feature is an xconf RFC feature as devicemgr manages it. Percentage is the share of the fleet
+// the feature is rolled out to; Enabled false switches it off everywhere whatever the percentage.
+type Feature struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name,omitempty"`
+	FeatureName string    `json:"featureName,omitempty"`
+	Enabled     bool      `json:"enable"`
+	Percentage  float64   `json:"percentage"`
+	RetrievedAt time.Time `json:"retrievedAt"`
+
+	raw map[string]interface{} // the document as xconf returned it, written back with our changes
+}
+
+const featurePath = "/xconfAdminService/rfc/feature"
+
+// GetFeature fetches a feature by ID.
+func (f *FeatureAdapter) GetFeature(ctx context.Context, id string) (*Feature, error) {
+	var raw map[string]interface{}
+	if err := f.c.getJSON(ctx, featurePath+"/"+url.PathEscape(id), &raw); err != nil {
+		return nil, err
+	}
+	return decodeFeature(raw)
+}
+
+func decodeFeature(raw map[string]interface{}) (*Feature, error) {
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var ft Feature
+	if err := json.Unmarshal(b, &ft); err != nil {
+		return nil, fmt.Errorf("decode feature: %w", err)
+	}
+	ft.raw, ft.RetrievedAt = raw, time.Now()
+	return &ft, nil
+}
+
+// GetFlags returns whether each feature is enabled, by ID.
 func (f *FeatureAdapter) GetFlags(ctx context.Context, ids []string) (*FeatureFlags, error) {
-	return nil, errors.New("not implemented")
+	flags := &FeatureFlags{Flags: make(map[string]bool, len(ids)), RetrievedAt: time.Now()}
+	for _, id := range ids {
+		ft, err := f.GetFeature(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("feature %s: %w", id, err)
+		}
+		flags.Flags[id] = ft.Enabled
+	}
+	return flags, nil
+}
+
+// SetRollout sets the feature's rollout percentage (0 to 100), leaving it enabled or not.
+func (f *FeatureAdapter) SetRollout(ctx context.Context, id string, percentage float64) (*Feature, error) {
+	if percentage < 0 || percentage > 100 {
+		return nil, fmt.Errorf("rollout percentage %v: want 0 to 100: %w", percentage, dm.ErrInvalidParameter)
+	}
+	return f.update(ctx, id, map[string]interface{}{"percentage": percentage})
+}
+
+// SetEnabled switches the feature on or off fleet-wide; off is the kill switch.
+func (f *FeatureAdapter) SetEnabled(ctx context.Context, id string, enabled bool) (*Feature, error) {
+	return f.update(ctx, id, map[string]interface{}{"enable": enabled})
+}
+
+// update reads the feature and writes it back with changes, so fields devicemgr does not model
+// are kept.
+func (f *FeatureAdapter) update(ctx context.Context, id string, changes map[string]interface{}) (*Feature, error) {
+	cur, err := f.GetFeature(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	doc := make(map[string]interface{}, len(cur.raw)+len(changes))
+	for k, v := range cur.raw {
+		doc[k] = v
+	}
+	for k, v := range changes {
+		doc[k] = v
+	}
+	var saved map[string]interface{}
+	if err := f.c.sendJSON(ctx, http.MethodPut, featurePath, doc, &saved); err != nil {
+		return nil, err
+	}
+	if saved == nil {
+		saved = doc
+	}
+	return decodeFeature(saved)
 }
@@ -0,0 +1,51 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestFeatureRollout(t *testing.T) {
+	doc := map[string]interface{}{"id": "f1", "name": "mesh", "featureName": "MeshWifi", "enable": true, "percentage": 10.0,
+		"configData": map[string]interface{}{"mode": "auto"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/xconfAdminService/rfc/feature/f1":
+			_ = json.NewEncoder(w).Encode(doc)
+		case r.Method == http.MethodPut && r.URL.Path == "/xconfAdminService/rfc/feature":
+			doc = nil
+			_ = json.NewDecoder(r.Body).Decode(&doc)
+			_ = json.NewEncoder(w).Encode(doc)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	fa := NewFeatureAdapter(&Client{BaseURL: srv.URL, Auth: staticAuth{""}})
+	ctx := context.Background()
+	ft, err := fa.SetRollout(ctx, "f1", 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.Percentage != 40 || !ft.Enabled || doc["configData"] == nil || doc["featureName"] != "MeshWifi" {
+		t.Fatalf("rollout %+v wrote %v", ft, doc)
+	}
+	if ft, err = fa.SetEnabled(ctx, "f1", false); err != nil || ft.Enabled || ft.Percentage != 40 {
+		t.Fatalf("disable %+v %v", ft, err)
+	}
+	if flags, err := fa.GetFlags(ctx, []string{"f1"}); err != nil || flags.Flags["f1"] {
+		t.Fatalf("flags %+v %v", flags, err)
+	}
+	if _, err := fa.SetRollout(ctx, "f1", 120); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("out-of-range rollout: %v", err)
+	}
+	if _, err := fa.GetFeature(ctx, "missing"); !errors.Is(err, dm.ErrPolicyNotFound) {
+		t.Fatalf("missing feature: %v", err)
+	}
+}
@@ -37,3 +37,55 @@ func TestFirmwareGetConfigByID(t *testing.T) {
 		t.Fatalf("expected ErrPolicyNotFound got %v", err)
 	}
 }
+
+func TestFirmwareResolveForDevices(t *testing.T) {
+	rules := `[
+	 {"id":"r-env","name":"XB7 prod","type":"ENV_MODEL_RULE","applicableAction":{"configId":"fw-prod"},
+	  "rule":{"compoundParts":[
+	   {"condition":{"freeArg":{"name":"model"},"operation":"IS","fixedArg":{"bean":{"value":{"java.lang.String":"XB7"}}}}},
+	   {"relation":"AND","condition":{"freeArg":{"name":"env"},"operation":"IN","fixedArg":{"collection":{"value":["PROD","QA"]}}}}]}},
+	 {"id":"r-mac","name":"canary","type":"MAC_RULE","applicableAction":{"configId":"fw-canary"},
+	  "rule":{"condition":{"freeArg":{"name":"eStbMac"},"operation":"LIKE","fixedArg":{"bean":{"value":{"java.lang.String":"^0000000000a"}}}}}},
+	 {"id":"r-other","name":"not XB7","type":"ENV_MODEL_RULE","applicableAction":{"configId":"fw-other"},
+	  "rule":{"negated":true,"condition":{"freeArg":{"name":"model"},"operation":"IS","fixedArg":{"bean":{"value":{"java.lang.String":"XB7"}}}}}}
+	]`
+	configs := `[{"id":"fw-prod","firmwareVersion":"7.1","model":"XB7"},{"id":"fw-canary","firmwareVersion":"7.2-rc","model":"XB7"},{"id":"fw-other","firmwareVersion":"1.0"}]`
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/xconfAdminService/firmwarerule":
+			_, _ = w.Write([]byte(rules))
+		case "/xconfAdminService/firmwareconfig":
+			_, _ = w.Write([]byte(configs))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	fa := NewFirmwareAdapter(&Client{BaseURL: srv.URL, Auth: staticAuth{""}})
+	got, err := fa.ResolveForDevices(context.Background(), []DeviceContext{
+		{ID: "mac:0000000000a1", Model: "XB7", Env: "PROD"},
+		{ID: "mac:0000000000b1", Model: "XB7", Env: "qa"},
+		{ID: "mac:0000000000b2", Model: "XB7", Env: "DEV"},
+		{ID: "mac:0000000000b3", Model: "TG1682"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected one download of rules and configs, got %d calls", calls)
+	}
+	want := map[dm.DeviceID]string{"mac:0000000000a1": "fw-canary", "mac:0000000000b1": "fw-prod", "mac:0000000000b3": "fw-other"}
+	if len(got) != len(want) {
+		t.Fatalf("resolved %d devices: %+v", len(got), got)
+	}
+	for id, cfg := range want {
+		if fp := got[id]; fp == nil || fp.ID != cfg {
+			t.Fatalf("%s resolved to %+v, want %s", id, fp, cfg)
+		}
+	}
+	if fp := got["mac:0000000000a1"]; fp.Version != "7.2-rc" || fp.Metadata["ruleId"] != "r-mac" {
+		t.Fatalf("canary policy %+v", fp)
+	}
+}
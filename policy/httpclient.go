@@ -1,6 +1,7 @@
 package policy
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -17,6 +18,7 @@ type Client struct {
 	BaseURL string
 	Auth    dm.AuthStrategy
 	HTTP    *http.Client
+	Retry   dm.RetryPolicy // retries failed GETs; the zero value makes one attempt
 }
 
 func NewClient(baseURL string, auth dm.AuthStrategy) *Client {
@@ -30,15 +32,43 @@ func trimRightSlash(s string) string {
 	return s
 }
 
-// getJSON performs an HTTP GET and decodes JSON into out; returns sentinel errors from devicemgr where feasible.
+// getJSON performs an HTTP GET and decodes JSON into out, retrying per c.Retry; returns sentinel
+// errors from devicemgr where feasible.
 func (c *Client) getJSON(ctx context.Context, path string, out interface{}) error {
 	if c.HTTP == nil {
 		c.HTTP = &http.Client{Timeout: 10 * time.Second}
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+path, nil)
+	return c.Retry.Do(ctx, func() error { return c.do(ctx, http.MethodGet, path, nil, out) })
+}
+
+// sendJSON sends in (nil for no body) as the JSON body of a write such as PUT, POST or DELETE and
+// decodes the response into out. Writes are made once, never retried.
+func (c *Client) sendJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	if c.HTTP == nil {
+		c.HTTP = &http.Client{Timeout: 10 * time.Second}
+	}
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	return c.do(ctx, method, path, body, out)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, rd)
 	if err != nil {
 		return err
 	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 	if c.Auth != nil {
 		if v, e := c.Auth.AuthorizationValue(); e == nil && v != "" {
 			req.Header.Set("Authorization", v)
@@ -51,8 +81,8 @@ func (c *Client) getJSON(ctx context.Context, path string, out interface{}) erro
 	defer resp.Body.Close()
 	b, _ := io.ReadAll(resp.Body)
 	switch resp.StatusCode {
-	case http.StatusOK:
-		if out != nil {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		if out != nil && len(b) > 0 {
 			if err := json.Unmarshal(b, out); err != nil {
 				return fmt.Errorf("decode: %w", err)
 			}
@@ -65,8 +95,8 @@ func (c *Client) getJSON(ctx context.Context, path string, out interface{}) erro
 	case http.StatusConflict:
 		return dm.ErrConflict
 	default:
-		if resp.StatusCode >= 500 {
-			return dm.ErrBackendUnavailable
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return dm.NewBackendError("xconfadmin", resp)
 		}
 		return errors.New(resp.Status)
 	}
@@ -0,0 +1,276 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Finding kinds reported by Lint.
+const (
+	FindingMACOverlap       = "mac-overlap"       // a MAC listed by rules assigning different configs
+	FindingUnreachable      = "unreachable"       // an earlier rule matches every device this one does
+	FindingPercentOverflow  = "percent-overflow"  // a rule's percentages sum over 100
+	FindingUnknownConfig    = "unknown-config"    // a rule assigns a config that does not exist
+	FindingInvalidCondition = "invalid-condition" // a rule cannot be evaluated
+)
+
+// Finding severities. Errors are conflicts: they make some devices get a config other than the
+// one a rule names.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Finding is one problem Lint found.
+type Finding struct {
+	Kind     string   `json:"kind"`
+	Severity string   `json:"severity"`
+	Rules    []string `json:"rules"` // IDs of the rules involved, the one reported on first
+	Message  string   `json:"message"`
+	MACs     []string `json:"macs,omitempty"` // for mac-overlap
+}
+
+// maxListedMACs bounds the MACs a mac-overlap finding lists.
+const maxListedMACs = 20
+
+// LintReport is the outcome of linting a rule set.
+type LintReport struct {
+	Rules    int       `json:"rules"`
+	Findings []Finding `json:"findings"`
+}
+
+// Err wraps dm.ErrRuleConflict when the report holds an error finding.
+func (r *LintReport) Err() error {
+	n := 0
+	for _, f := range r.Findings {
+		if f.Severity == SeverityError {
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d conflicting firmware rules: %w", n, dm.ErrRuleConflict)
+}
+
+// Lint checks the rule set in evaluation order. It finds rules whose MAC lists overlap with
+// different targets, rules no device can reach because an earlier rule is the same or selects a
+// superset of their MACs, percentage rollouts over 100%, unknown configs and conditions that
+// cannot be evaluated.
+func (rs *FirmwareRuleSet) Lint() *LintReport {
+	rep := &LintReport{Rules: len(rs.Rules), Findings: []Finding{}}
+	add := func(f Finding) { rep.Findings = append(rep.Findings, f) }
+
+	type macOwner struct {
+		rule, config string
+	}
+	owners := make(map[string]macOwner) // first rule listing each MAC
+	seen := make(map[string]string)     // normalized rule tree -> first rule ID
+	var catchAll string                 // first rule matching every device
+	for _, r := range rs.Rules {
+		if err := r.Rule.validate(); err != nil {
+			add(Finding{Kind: FindingInvalidCondition, Severity: SeverityError, Rules: []string{r.ID},
+				Message: fmt.Sprintf("rule %s cannot be evaluated: %v", r.ID, err)})
+		}
+		for _, id := range r.ApplicableAction.configIDs() {
+			if _, ok := rs.Configs[id]; !ok {
+				add(Finding{Kind: FindingUnknownConfig, Severity: SeverityError, Rules: []string{r.ID},
+					Message: fmt.Sprintf("rule %s assigns unknown config %q", r.ID, id)})
+			}
+		}
+		if total := r.ApplicableAction.percentage(); total > 100 {
+			add(Finding{Kind: FindingPercentOverflow, Severity: SeverityError, Rules: []string{r.ID},
+				Message: fmt.Sprintf("rule %s rolls out %v%% of its devices; the entries past 100%% are never used", r.ID, total)})
+		}
+
+		switch key := r.Rule.key(); {
+		case catchAll != "":
+			add(Finding{Kind: FindingUnreachable, Severity: SeverityWarning, Rules: []string{r.ID, catchAll},
+				Message: fmt.Sprintf("rule %s is never reached: rule %s before it matches every device", r.ID, catchAll)})
+			continue
+		case seen[key] != "":
+			add(Finding{Kind: FindingUnreachable, Severity: SeverityWarning, Rules: []string{r.ID, seen[key]},
+				Message: fmt.Sprintf("rule %s is never reached: rule %s before it has the same condition", r.ID, seen[key])})
+			continue
+		default:
+			seen[key] = r.ID
+			if r.Rule.Condition == nil && len(r.Rule.CompoundParts) == 0 && !r.Rule.Negated {
+				catchAll = r.ID
+			}
+		}
+
+		macs, only := r.Rule.macs()
+		if len(macs) == 0 {
+			continue
+		}
+		target := r.ApplicableAction.target()
+		conflicts := make(map[string][]string) // other rule -> MACs it lists for another target
+		shadowed := only
+		for _, mac := range macs {
+			o, ok := owners[mac]
+			if !ok {
+				owners[mac] = macOwner{rule: r.ID, config: target}
+				shadowed = false
+				continue
+			}
+			if o.config != target {
+				conflicts[o.rule] = append(conflicts[o.rule], mac)
+			}
+		}
+		others := make([]string, 0, len(conflicts))
+		for id := range conflicts {
+			others = append(others, id)
+		}
+		sort.Strings(others)
+		for _, other := range others {
+			list := conflicts[other]
+			f := Finding{Kind: FindingMACOverlap, Severity: SeverityError, Rules: []string{r.ID, other}, MACs: list,
+				Message: fmt.Sprintf("rule %s lists %d MACs that rule %s, evaluated first, assigns another config", r.ID, len(list), other)}
+			if len(f.MACs) > maxListedMACs {
+				f.MACs = f.MACs[:maxListedMACs]
+			}
+			add(f)
+		}
+		if shadowed {
+			add(Finding{Kind: FindingUnreachable, Severity: SeverityWarning, Rules: []string{r.ID},
+				Message: fmt.Sprintf("rule %s is never reached: earlier rules list every MAC it matches", r.ID)})
+		}
+	}
+	return rep
+}
+
+// Check lints the rule set with candidate added, as by a create or an update of the rule with
+// its ID, and returns the findings that involve candidate; Err on the result reports whether
+// saving it would conflict.
+func (rs *FirmwareRuleSet) Check(candidate FirmwareRule) *LintReport {
+	return rs.Apply(FirmwareChange{Rules: []FirmwareRule{candidate}}).Lint().Involving(candidate.ID)
+}
+
+// Involving returns the report with only the findings that involve one of the rules named.
+func (r *LintReport) Involving(ids ...string) *LintReport {
+	out := &LintReport{Rules: r.Rules, Findings: []Finding{}}
+	for _, f := range r.Findings {
+	finding:
+		for _, id := range f.Rules {
+			for _, want := range ids {
+				if id == want {
+					out.Findings = append(out.Findings, f)
+					break finding
+				}
+			}
+		}
+	}
+	return out
+}
+
+// Lint downloads the firmware rules and configs and lints them.
+func (f *FirmwareAdapter) Lint(ctx context.Context) (*LintReport, error) {
+	rs, err := f.RuleSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rs.Lint(), nil
+}
+
+// configIDs lists every config the action can assign.
+func (a RuleAction) configIDs() []string {
+	var out []string
+	if a.ConfigID != "" {
+		out = append(out, a.ConfigID)
+	}
+	for _, e := range a.ConfigEntries {
+		out = append(out, e.ConfigID)
+	}
+	return out
+}
+
+func (a RuleAction) percentage() float64 {
+	total := 0.0
+	for _, e := range a.ConfigEntries {
+		total += e.Percentage
+	}
+	return total
+}
+
+// target identifies what the action assigns, to tell rules with the same target apart.
+func (a RuleAction) target() string {
+	b, _ := json.Marshal(a)
+	return string(b)
+}
+
+// validate reports the first condition of the tree that cannot be evaluated.
+func (r Rule) validate() error {
+	_, err := r.match(DeviceContext{})
+	return err
+}
+
+// key normalizes the rule tree so identical conditions compare equal whatever their spelling.
+func (r Rule) key() string {
+	var b strings.Builder
+	r.writeKey(&b)
+	return b.String()
+}
+
+func (r Rule) writeKey(b *strings.Builder) {
+	if r.Negated {
+		b.WriteString("!")
+	}
+	if c := r.Condition; c != nil {
+		vals := c.values()
+		upper := make([]string, len(vals))
+		for i, v := range vals {
+			upper[i] = strings.ToUpper(v)
+		}
+		if strings.EqualFold(c.Operation, "IN") {
+			sort.Strings(upper)
+		}
+		fmt.Fprintf(b, "(%s %s %s)", strings.ToLower(c.FreeArg.Name), strings.ToUpper(c.Operation), strings.Join(upper, ","))
+	}
+	for _, p := range r.CompoundParts {
+		b.WriteString(strings.ToUpper(p.Relation) + "[")
+		p.writeKey(b)
+		b.WriteString("]")
+	}
+}
+
+// macs returns the MACs, upper case, that the rule requires with an IS or IN on eStbMac, and
+// whether that condition is all the rule checks. Rules that only narrow a MAC list further (AND)
+// still report it; rules that negate it or OR it with something else report none.
+func (r Rule) macs() (macs []string, only bool) {
+	if r.Negated {
+		return nil, false
+	}
+	if c := r.Condition; c != nil && len(r.CompoundParts) == 0 {
+		if name := strings.ToLower(c.FreeArg.Name); name != "estbmac" && name != "mac" {
+			return nil, false
+		}
+		switch strings.ToUpper(c.Operation) {
+		case "IS", "IN":
+			for _, v := range c.values() {
+				macs = append(macs, normalizeMAC(v))
+			}
+			return macs, true
+		}
+		return nil, false
+	}
+	for i, p := range r.CompoundParts {
+		if i > 0 && strings.EqualFold(p.Relation, "OR") {
+			return nil, false
+		}
+	}
+	for _, p := range r.CompoundParts {
+		if m, _ := p.macs(); len(m) > 0 {
+			return m, len(r.CompoundParts) == 1
+		}
+	}
+	return nil, false
+}
+
+func normalizeMAC(s string) string {
+	return strings.ToUpper(strings.NewReplacer(":", "", "-", "", ".", "").Replace(s))
+}
@@ -0,0 +1,97 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func lintRuleSet(t *testing.T, rules string) *FirmwareRuleSet {
+	t.Helper()
+	var list []FirmwareRule
+	if err := json.Unmarshal([]byte(rules), &list); err != nil {
+		t.Fatal(err)
+	}
+	return NewFirmwareRuleSet(list, []FirmwarePolicy{{ID: "fw-a"}, {ID: "fw-b"}})
+}
+
+func TestFirmwareRuleLint(t *testing.T) {
+	rs := lintRuleSet(t, `[
+	 {"id":"m1","type":"MAC_RULE","applicableAction":{"configId":"fw-a"},
+	  "rule":{"condition":{"freeArg":{"name":"eStbMac"},"operation":"IN","fixedArg":{"collection":{"value":["00:00:00:00:00:A1","00:00:00:00:00:A2"]}}}}},
+	 {"id":"m2","type":"MAC_RULE","applicableAction":{"configId":"fw-b"},
+	  "rule":{"condition":{"freeArg":{"name":"eStbMac"},"operation":"IN","fixedArg":{"collection":{"value":["0000000000a2","0000000000a3"]}}}}},
+	 {"id":"m3","type":"MAC_RULE","applicableAction":{"configId":"fw-a"},
+	  "rule":{"condition":{"freeArg":{"name":"eStbMac"},"operation":"IS","fixedArg":{"bean":{"value":{"java.lang.String":"00:00:00:00:00:a1"}}}}}},
+	 {"id":"e1","type":"ENV_MODEL_RULE","applicableAction":{"configEntries":[{"configId":"fw-a","percentage":60},{"configId":"fw-b","percentage":50}]},
+	  "rule":{"condition":{"freeArg":{"name":"model"},"operation":"IS","fixedArg":{"bean":{"value":{"java.lang.String":"XB7"}}}}}},
+	 {"id":"e2","type":"ENV_MODEL_RULE","applicableAction":{"configId":"fw-missing"},
+	  "rule":{"condition":{"freeArg":{"name":"model"},"operation":"IS","fixedArg":{"bean":{"value":{"java.lang.String":"xb7"}}}}}},
+	 {"id":"e3","type":"ENV_MODEL_RULE","applicableAction":{"configId":"fw-a"},
+	  "rule":{"condition":{"freeArg":{"name":"model"},"operation":"LIKE","fixedArg":{"bean":{"value":{"java.lang.String":"(XB"}}}}}}
+	]`)
+	rep := rs.Lint()
+	want := map[string]string{ // kind/rule reported on
+		FindingMACOverlap + "/m2":       SeverityError,
+		FindingUnreachable + "/m3":      SeverityWarning,
+		FindingPercentOverflow + "/e1":  SeverityError,
+		FindingUnknownConfig + "/e2":    SeverityError,
+		FindingUnreachable + "/e2":      SeverityWarning,
+		FindingInvalidCondition + "/e3": SeverityError,
+	}
+	got := make(map[string]string)
+	for _, f := range rep.Findings {
+		got[f.Kind+"/"+f.Rules[0]] = f.Severity
+	}
+	if len(got) != len(want) || len(rep.Findings) != len(want) {
+		t.Fatalf("findings %+v", rep.Findings)
+	}
+	for k, sev := range want {
+		if got[k] != sev {
+			t.Fatalf("%s: severity %q, want %q (findings %+v)", k, got[k], sev, rep.Findings)
+		}
+	}
+	for _, f := range rep.Findings {
+		if f.Kind == FindingMACOverlap && (len(f.MACs) != 1 || f.MACs[0] != "0000000000A2" || f.Rules[1] != "m1") {
+			t.Fatalf("overlap %+v", f)
+		}
+	}
+	if err := rep.Err(); !errors.Is(err, dm.ErrRuleConflict) {
+		t.Fatalf("Err() = %v", err)
+	}
+	// the MAC lists match whatever their spelling
+	fp, err := rs.Resolve(DeviceContext{ID: "mac:0000000000a2"})
+	if err != nil || fp.ID != "fw-a" {
+		t.Fatalf("resolved %+v, %v", fp, err)
+	}
+}
+
+func TestFirmwareRuleCheck(t *testing.T) {
+	rs := lintRuleSet(t, `[
+	 {"id":"m1","type":"MAC_RULE","applicableAction":{"configId":"fw-a"},
+	  "rule":{"condition":{"freeArg":{"name":"eStbMac"},"operation":"IN","fixedArg":{"collection":{"value":["0000000000a1","0000000000a2"]}}}}}
+	]`)
+	if rep := rs.Lint(); rep.Err() != nil {
+		t.Fatalf("clean rule set: %+v", rep.Findings)
+	}
+	candidate := func(id, config string, macs ...string) FirmwareRule {
+		c := &Condition{Operation: "IN"}
+		c.FreeArg.Name = "eStbMac"
+		c.FixedArg.Collection.Value = macs
+		return FirmwareRule{ID: id, Type: "MAC_RULE", ApplicableAction: RuleAction{ConfigID: config}, Rule: Rule{Condition: c}}
+	}
+	if rep := rs.Check(candidate("m2", "fw-b", "0000000000b1")); rep.Err() != nil || len(rep.Findings) != 0 {
+		t.Fatalf("disjoint rule: %+v", rep.Findings)
+	}
+	rep := rs.Check(candidate("m2", "fw-b", "0000000000a2"))
+	// m1 takes the MAC first, so m2 both conflicts with it and is never reached
+	if !errors.Is(rep.Err(), dm.ErrRuleConflict) || len(rep.Findings) != 2 || rep.Findings[0].Kind != FindingMACOverlap || rep.Findings[1].Kind != FindingUnreachable {
+		t.Fatalf("overlapping rule: %+v", rep.Findings)
+	}
+	// updating m1 itself does not conflict with its old version
+	if rep := rs.Check(candidate("m1", "fw-b", "0000000000a2")); rep.Err() != nil {
+		t.Fatalf("update: %+v", rep.Findings)
+	}
+}
@@ -0,0 +1,337 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// DeviceContext is what firmware rules are evaluated against, as xconf receives it from a device.
+type DeviceContext struct {
+	ID              dm.DeviceID `json:"id"`
+	Model           string      `json:"model,omitempty"`
+	FirmwareVersion string      `json:"firmwareVersion,omitempty"`
+	Env             string      `json:"env,omitempty"`
+	PartnerID       string      `json:"partnerId,omitempty"`
+	IPAddress       string      `json:"ipAddress,omitempty"`
+}
+
+// DeviceContextOf builds a device's context from the metadata Talaria reports for it.
+func DeviceContextOf(d dm.DeviceState) DeviceContext {
+	c := DeviceContext{ID: d.ID, Model: d.Metadata[dm.MetadataModel], FirmwareVersion: d.Metadata[dm.MetadataFirmware], Env: d.Metadata["env"]}
+	if partners := dm.SplitPartners(d.Metadata[dm.MetadataPartnerIDs]); len(partners) > 0 {
+		c.PartnerID = partners[0]
+	}
+	return c
+}
+
+// arg returns the context value a rule condition names, using xconf's argument names.
+func (d DeviceContext) arg(name string) string {
+	switch strings.ToLower(name) {
+	case "estbmac", "mac":
+		_, mac, _ := strings.Cut(string(d.ID), ":")
+		return mac
+	case "model":
+		return d.Model
+	case "firmwareversion":
+		return d.FirmwareVersion
+	case "env":
+		return d.Env
+	case "partnerid":
+		return d.PartnerID
+	case "ipaddress", "estbip":
+		return d.IPAddress
+	}
+	return ""
+}
+
+// Condition is one xconf rule condition: freeArg <operation> fixedArg.
+type Condition struct {
+	FreeArg struct {
+		Name string `json:"name"`
+	} `json:"freeArg"`
+	Operation string `json:"operation"` // IS, IN, LIKE (a regular expression) or EXISTS
+	FixedArg  struct {
+		Bean struct {
+			Value map[string]interface{} `json:"value"` // {"java.lang.String": "XB7"}
+		} `json:"bean"`
+		Collection struct {
+			Value []string `json:"value"`
+		} `json:"collection"`
+	} `json:"fixedArg"`
+}
+
+// values returns the condition's fixed argument: the bean value, or the collection for IN.
+func (c Condition) values() []string {
+	if len(c.FixedArg.Collection.Value) > 0 {
+		return c.FixedArg.Collection.Value
+	}
+	for _, v := range c.FixedArg.Bean.Value {
+		return []string{fmt.Sprint(v)}
+	}
+	return nil
+}
+
+func (c Condition) match(d DeviceContext) (bool, error) {
+	v := d.arg(c.FreeArg.Name)
+	fixed := c.values()
+	if name := strings.ToLower(c.FreeArg.Name); (name == "estbmac" || name == "mac") && !strings.EqualFold(c.Operation, "LIKE") {
+		v = normalizeMAC(v) // lists spell MACs with or without separators
+		norm := make([]string, len(fixed))
+		for i, f := range fixed {
+			norm[i] = normalizeMAC(f)
+		}
+		fixed = norm
+	}
+	switch strings.ToUpper(c.Operation) {
+	case "IS":
+		return len(fixed) > 0 && strings.EqualFold(v, fixed[0]), nil
+	case "IN":
+		for _, f := range fixed {
+			if strings.EqualFold(v, f) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "LIKE":
+		if len(fixed) == 0 {
+			return false, nil
+		}
+		re, err := regexp.Compile(fixed[0])
+		if err != nil {
+			return false, fmt.Errorf("condition on %s: %w", c.FreeArg.Name, err)
+		}
+		return re.MatchString(v), nil
+	case "EXISTS":
+		return v != "", nil
+	}
+	return false, fmt.Errorf("condition on %s: unsupported operation %q", c.FreeArg.Name, c.Operation)
+}
+
+// Rule is an xconf rule tree: a condition, negated or not, combined left to right with its
+// compound parts.
+type Rule struct {
+	Negated       bool       `json:"negated"`
+	Relation      string     `json:"relation,omitempty"` // AND or OR, joining this part to the ones before it
+	Condition     *Condition `json:"condition,omitempty"`
+	CompoundParts []Rule     `json:"compoundParts,omitempty"`
+}
+
+func (r Rule) match(d DeviceContext) (bool, error) {
+	var ok bool
+	if len(r.CompoundParts) > 0 {
+		for i, part := range r.CompoundParts {
+			m, err := part.match(d)
+			if err != nil {
+				return false, err
+			}
+			switch {
+			case i == 0:
+				ok = m
+			case strings.EqualFold(part.Relation, "OR"):
+				ok = ok || m
+			default:
+				ok = ok && m
+			}
+		}
+	} else if r.Condition != nil {
+		var err error
+		if ok, err = r.Condition.match(d); err != nil {
+			return false, err
+		}
+	}
+	return ok != r.Negated, nil
+}
+
+// FirmwareRule assigns a firmware config to the devices its rule matches.
+type FirmwareRule struct {
+	ID               string     `json:"id"`
+	Name             string     `json:"name"`
+	Type             string     `json:"type"` // MAC_RULE, IP_RULE, ENV_MODEL_RULE, ...
+	Rule             Rule       `json:"rule"`
+	ApplicableAction RuleAction `json:"applicableAction"`
+}
+
+// RuleAction is what a matching rule assigns: ConfigID, or with ConfigEntries a percentage of the
+// matching devices per config, the remainder getting ConfigID (none when empty).
+type RuleAction struct {
+	ConfigID      string        `json:"configId"`
+	ConfigEntries []ConfigEntry `json:"configEntries,omitempty"`
+}
+
+// ConfigEntry is one config of a percentage rollout.
+type ConfigEntry struct {
+	ConfigID   string  `json:"configId"`
+	Percentage float64 `json:"percentage"`
+}
+
+// configFor picks the config for a device. Each device falls in a stable bucket from 0 to 100,
+// hashed from its ID, so it stays with the same config while the percentages do not change.
+func (a RuleAction) configFor(id dm.DeviceID) string {
+	if len(a.ConfigEntries) == 0 {
+		return a.ConfigID
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id.Canonical()))
+	bucket, upto := float64(h.Sum32()%10000)/100, 0.0
+	for _, e := range a.ConfigEntries {
+		if upto += e.Percentage; bucket < upto {
+			return e.ConfigID
+		}
+	}
+	return a.ConfigID
+}
+
+// rulePriority orders rule types as xconf does, most specific first; other types come last.
+var rulePriority = map[string]int{"MAC_RULE": 0, "IP_RULE": 1, "ENV_MODEL_RULE": 2}
+
+func (r FirmwareRule) priority() int {
+	if p, ok := rulePriority[r.Type]; ok {
+		return p
+	}
+	return len(rulePriority)
+}
+
+// FirmwareRuleSet is a snapshot of xconf's firmware rules and the configs they assign, evaluated
+// locally so many devices can be resolved without a call each.
+type FirmwareRuleSet struct {
+	Rules     []FirmwareRule // in evaluation order
+	Configs   map[string]FirmwarePolicy
+	FetchedAt time.Time
+}
+
+// NewFirmwareRuleSet orders rules by type priority, keeping xconf's order within a type.
+func NewFirmwareRuleSet(rules []FirmwareRule, configs []FirmwarePolicy) *FirmwareRuleSet {
+	rs := &FirmwareRuleSet{Rules: append([]FirmwareRule(nil), rules...), Configs: make(map[string]FirmwarePolicy, len(configs)), FetchedAt: time.Now()}
+	sort.SliceStable(rs.Rules, func(i, k int) bool { return rs.Rules[i].priority() < rs.Rules[k].priority() })
+	for _, c := range configs {
+		rs.Configs[c.ID] = c
+	}
+	return rs
+}
+
+// FirmwareChange is a proposed edit of the firmware rules and configs: rules and configs to create
+// or replace, matched by ID, and IDs to delete.
+type FirmwareChange struct {
+	Rules         []FirmwareRule   `json:"rules,omitempty"`
+	Configs       []FirmwarePolicy `json:"configs,omitempty"`
+	DeleteRules   []string         `json:"deleteRules,omitempty"`
+	DeleteConfigs []string         `json:"deleteConfigs,omitempty"`
+}
+
+// Apply returns the rule set as it would be after c; rs is unchanged. Replaced rules keep their
+// place in xconf's order, new ones are evaluated after the others of their type.
+func (rs *FirmwareRuleSet) Apply(c FirmwareChange) *FirmwareRuleSet {
+	drop := make(map[string]bool, len(c.DeleteRules))
+	for _, id := range c.DeleteRules {
+		drop[id] = true
+	}
+	replace := make(map[string]FirmwareRule, len(c.Rules))
+	for _, r := range c.Rules {
+		replace[r.ID] = r
+	}
+	rules := make([]FirmwareRule, 0, len(rs.Rules)+len(c.Rules))
+	for _, r := range rs.Rules {
+		if n, ok := replace[r.ID]; ok {
+			r = n
+			delete(replace, r.ID)
+		}
+		if !drop[r.ID] {
+			rules = append(rules, r)
+		}
+	}
+	for _, r := range c.Rules {
+		if _, ok := replace[r.ID]; ok && !drop[r.ID] {
+			rules = append(rules, r)
+		}
+	}
+	configs := make(map[string]FirmwarePolicy, len(rs.Configs)+len(c.Configs))
+	for id, fp := range rs.Configs {
+		configs[id] = fp
+	}
+	for _, fp := range c.Configs {
+		configs[fp.ID] = fp
+	}
+	for _, id := range c.DeleteConfigs {
+		delete(configs, id)
+	}
+	list := make([]FirmwarePolicy, 0, len(configs))
+	for _, fp := range configs {
+		list = append(list, fp)
+	}
+	out := NewFirmwareRuleSet(rules, list)
+	out.FetchedAt = rs.FetchedAt
+	return out
+}
+
+// Resolve returns the config of the first rule matching d, with the rule's ID and name in its
+// Metadata; ErrPolicyNotFound when none matches. A rule that cannot be evaluated is skipped.
+func (rs *FirmwareRuleSet) Resolve(d DeviceContext) (*FirmwarePolicy, error) {
+	for _, r := range rs.Rules {
+		if ok, err := r.Rule.match(d); err != nil || !ok {
+			continue
+		}
+		id := r.ApplicableAction.configFor(d.ID)
+		if id == "" {
+			return nil, fmt.Errorf("rule %s assigns no config to this device: %w", r.ID, dm.ErrPolicyNotFound)
+		}
+		c, ok := rs.Configs[id]
+		if !ok {
+			return nil, fmt.Errorf("rule %s assigns unknown config %q: %w", r.ID, id, dm.ErrPolicyNotFound)
+		}
+		fp := c
+		fp.Metadata = map[string]string{"ruleId": r.ID, "ruleName": r.Name}
+		for k, v := range c.Metadata {
+			fp.Metadata[k] = v
+		}
+		fp.RetrievedAt = rs.FetchedAt
+		return &fp, nil
+	}
+	return nil, dm.ErrPolicyNotFound
+}
+
+// RuleSet downloads the firmware rules and configs.
+func (f *FirmwareAdapter) RuleSet(ctx context.Context) (*FirmwareRuleSet, error) {
+	var rules []FirmwareRule
+	if err := f.c.getJSON(ctx, "/xconfAdminService/firmwarerule", &rules); err != nil {
+		return nil, fmt.Errorf("firmware rules: %w", err)
+	}
+	var list []struct {
+		ID              string `json:"id"`
+		FirmwareVersion string `json:"firmwareVersion"`
+		Model           string `json:"model"`
+		URL             string `json:"firmwareDownloadProtocol"`
+	}
+	if err := f.c.getJSON(ctx, "/xconfAdminService/firmwareconfig", &list); err != nil {
+		return nil, fmt.Errorf("firmware configs: %w", err)
+	}
+	configs := make([]FirmwarePolicy, len(list))
+	for i, c := range list {
+		configs[i] = FirmwarePolicy{ID: c.ID, Version: c.FirmwareVersion, Model: c.Model, DownloadURL: c.URL}
+	}
+	return NewFirmwareRuleSet(rules, configs), nil
+}
+
+// ResolveForDevices resolves many devices in one pass over a single download of the rule set.
+// Devices no rule matches are left out of the result.
+func (f *FirmwareAdapter) ResolveForDevices(ctx context.Context, devices []DeviceContext) (map[dm.DeviceID]*FirmwarePolicy, error) {
+	rs, err := f.RuleSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[dm.DeviceID]*FirmwarePolicy, len(devices))
+	for _, d := range devices {
+		fp, err := rs.Resolve(d)
+		if err != nil {
+			continue
+		}
+		out[d.ID] = fp
+	}
+	return out, nil
+}
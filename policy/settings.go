@@ -2,12 +2,72 @@ package policy
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
 )
 
+// SettingsAdapter provides read-only access to xconf settings profiles.
 type SettingsAdapter struct{ c *Client }
 
 func NewSettingsAdapter(c *Client) *SettingsAdapter { return &SettingsAdapter{c: c} }
+
+// GetProfileByID fetches a settings profile by its ID; the profile's properties become its Data.
 func (s *SettingsAdapter) GetProfileByID(ctx context.Context, id string) (*SettingsProfile, error) {
-	return nil, errors.New("not implemented")
+	var raw struct {
+		ID         string                 `json:"id"`
+		Name       string                 `json:"settingProfileId"`
+		Type       string                 `json:"settingType"`
+		Properties map[string]interface{} `json:"properties"`
+	}
+	if err := s.c.getJSON(ctx, "/xconfAdminService/setting/profile/"+url.PathEscape(id), &raw); err != nil {
+		return nil, err
+	}
+	return &SettingsProfile{ID: raw.ID, Name: raw.Name, Application: raw.Type, Data: raw.Properties, RetrievedAt: time.Now()}, nil
+}
+
+// Parameters returns the profile's Data entries that name TR-181 parameters ("Device." keys),
+// ordered by name, with their values formatted as text. Other entries, such as the maintenance
+// window, are not device parameters.
+func (p *SettingsProfile) Parameters() []dm.SetParameter {
+	var out []dm.SetParameter
+	for k, v := range p.Data {
+		if !strings.HasPrefix(k, "Device.") || strings.HasSuffix(k, ".") || v == nil {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			s = fmt.Sprint(v)
+		}
+		out = append(out, dm.SetParameter{Name: k, Value: s})
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Name < out[k].Name })
+	return out
+}
+
+// SettingsMaintenanceWindow is the settings profile Data key holding a maintenance window object
+// ({"start":"02:00","duration":"3h","days":["sat"],"timezone":"UTC"}).
+const SettingsMaintenanceWindow = "maintenanceWindow"
+
+// MaintenanceWindow returns the maintenance window carried by the profile, if any; use it from
+// dm.MaintenanceConfig.Lookup to take windows from settings profiles.
+func (p *SettingsProfile) MaintenanceWindow() (dm.MaintenanceWindow, bool, error) {
+	raw, ok := p.Data[SettingsMaintenanceWindow]
+	if !ok {
+		return dm.MaintenanceWindow{}, false, nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return dm.MaintenanceWindow{}, false, err
+	}
+	var w dm.MaintenanceWindow
+	if err := json.Unmarshal(b, &w); err != nil {
+		return dm.MaintenanceWindow{}, false, err
+	}
+	return w, true, w.Validate()
 }
@@ -0,0 +1,34 @@
+package policy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSettingsGetProfileByID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xconfAdminService/setting/profile/p1" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"p1","settingProfileId":"residential","settingType":"PARTNER_SETTINGS",
+			"properties":{"Device.WiFi.SSID.1.SSID":"home","Device.WiFi.Radio.1.Enable":true,"maintenanceWindow":{"start":"02:00","duration":"1h"}}}`))
+	}))
+	defer srv.Close()
+	p, err := NewSettingsAdapter(&Client{BaseURL: srv.URL, Auth: staticAuth{""}}).GetProfileByID(context.Background(), "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "residential" || p.Application != "PARTNER_SETTINGS" {
+		t.Fatalf("profile %+v", p)
+	}
+	params := p.Parameters()
+	if len(params) != 2 || params[0].Name != "Device.WiFi.Radio.1.Enable" || params[0].Value != "true" || params[1].Value != "home" {
+		t.Fatalf("parameters %+v", params)
+	}
+	if w, ok, err := p.MaintenanceWindow(); err != nil || !ok || w.Start != "02:00" {
+		t.Fatalf("maintenance window %+v %v %v", w, ok, err)
+	}
+}
@@ -0,0 +1,41 @@
+package devicemgr
+
+import "time"
+
+// Outcomes of a PreflightCheck.
+const (
+	PreflightPass = "pass"
+	PreflightWarn = "warn" // works, but needs attention (a lagging clock, an expiring certificate)
+	PreflightFail = "fail"
+	PreflightSkip = "skip" // not applicable, or not reached after an earlier failure
+)
+
+// PreflightCheck is one finding of a preflight: a check of one backend.
+type PreflightCheck struct {
+	Backend   string `json:"backend"` // "talaria", "tr1d1um", "xconfadmin", "redis"
+	Check     string `json:"check"`   // "connectivity", "auth", "tls" or "clock"
+	Target    string `json:"target,omitempty"`
+	Status    string `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	LatencyMS int64  `json:"latencyMs,omitempty"`
+}
+
+// PreflightReport is the outcome of Manager.Preflight.
+type PreflightReport struct {
+	CheckedAt time.Time        `json:"checkedAt"`
+	Checks    []PreflightCheck `json:"checks"`
+}
+
+// Failed returns the checks that failed.
+func (r PreflightReport) Failed() []PreflightCheck {
+	var out []PreflightCheck
+	for _, c := range r.Checks {
+		if c.Status == PreflightFail {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// OK reports whether no check failed; warnings do not count.
+func (r PreflightReport) OK() bool { return len(r.Failed()) == 0 }
@@ -0,0 +1,44 @@
+package devicemgr
+
+import (
+	"fmt"
+	"time"
+)
+
+// Deployment profiles selecting the defaults of PresetOptions.
+const (
+	ProfileDev   = "dev"
+	ProfileStage = "stage"
+	ProfileProd  = "prod"
+)
+
+// PresetOptions returns the defaults for a deployment profile; options the caller sets afterwards
+// override them.
+//
+//   - ProfileProd, or "", is DefaultOptions.
+//   - ProfileStage is DefaultOptions with Verbose logging of backend requests.
+//   - ProfileDev suits a laptop running a local Talaria/Tr1d1um stack. Backend certificates are
+//     not verified (HTTP.InsecureSkipVerify), so self-signed stacks work. Requests are logged
+//     (Verbose). Parameter and policy caches are off, so changes show up at once. Devices are
+//     polled every 5s. Operations time out after 5s, and reads are retried once, so a stopped
+//     backend fails fast.
+func PresetOptions(profile string) (Options, error) {
+	opts := DefaultOptions()
+	switch profile {
+	case "", ProfileProd:
+	case ProfileStage:
+		opts.Verbose = true
+	case ProfileDev:
+		opts.Verbose = true
+		opts.HTTP.InsecureSkipVerify = true
+		opts.Polling.DeviceList = 5 * time.Second
+		opts.Cache.ParamTTL, opts.Cache.PolicyTTL = 0, 0
+		opts.GetTimeout, opts.SetTimeout = 5*time.Second, 5*time.Second
+		opts.RPCTimeout, opts.PolicyTimeout = 5*time.Second, 5*time.Second
+		opts.Retry.MaxAttempts = 2
+	default:
+		return Options{}, fmt.Errorf("unknown profile %q (want %s, %s or %s): %w", profile, ProfileDev, ProfileStage, ProfileProd, ErrInvalidParameter)
+	}
+	opts.Profile = profile
+	return opts, nil
+}
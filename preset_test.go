@@ -0,0 +1,25 @@
+package devicemgr
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPresetOptions(t *testing.T) {
+	prod, err := PresetOptions("")
+	if err != nil || prod.Verbose || prod.HTTP.InsecureSkipVerify || prod.Cache.ParamTTL != DefaultOptions().Cache.ParamTTL {
+		t.Fatalf("default preset = %+v, %v", prod, err)
+	}
+	stage, _ := PresetOptions(ProfileStage)
+	if !stage.Verbose || stage.HTTP.InsecureSkipVerify || stage.Profile != ProfileStage {
+		t.Fatalf("stage preset = %+v", stage)
+	}
+	dev, _ := PresetOptions(ProfileDev)
+	if !dev.Verbose || !dev.HTTP.InsecureSkipVerify || dev.Cache.ParamTTL != 0 || dev.GetTimeout != 5*time.Second || dev.Polling.DeviceList != 5*time.Second {
+		t.Fatalf("dev preset = %+v", dev)
+	}
+	if _, err := PresetOptions("qa"); !errors.Is(err, ErrInvalidParameter) {
+		t.Fatalf("unknown profile: %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+// Package profiles applies named configuration templates to devices. A profile's parameter values
+// are Go templates over the device's attributes, so one profile can give every device its own
+// SSID or server name. Profiles are versioned, and each device keeps the history of profiles
+// applied to it so the latest can be rolled back.
+package profiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+var (
+	ErrProfileNotFound = errors.New("profile not found")
+	ErrNothingApplied  = errors.New("no applied profile to roll back")
+)
+
+// Parameter is one templated assignment of a profile.
+type Parameter struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"` // Go template over TemplateData, e.g. "lab-{{.Model}}-{{.Serial}}"
+	DataType string `json:"dataType,omitempty"`
+}
+
+// Profile is one version of a named configuration template.
+type Profile struct {
+	Name        string      `json:"name"`
+	Version     int         `json:"version"` // assigned on save, starting at 1
+	Description string      `json:"description,omitempty"`
+	Service     string      `json:"service,omitempty"` // translation service the parameters are written through
+	Parameters  []Parameter `json:"parameters"`
+	CreatedAt   time.Time   `json:"createdAt"`
+}
+
+// TemplateData is what profile templates see of a device.
+type TemplateData struct {
+	ID       dm.DeviceID
+	Serial   string // the ID without its scheme, e.g. "112233445566" for "mac:112233445566"
+	Partner  string // first partner ID
+	Partners []string
+	Model    string
+	Firmware string
+	Metadata map[string]string
+}
+
+// NewTemplateData describes d to templates.
+func NewTemplateData(d dm.DeviceState) TemplateData {
+	_, serial, _ := strings.Cut(string(d.ID), ":")
+	partners := dm.SplitPartners(d.Metadata[dm.MetadataPartnerIDs])
+	data := TemplateData{ID: d.ID, Serial: serial, Partners: partners, Model: d.Metadata[dm.MetadataModel], Firmware: d.Metadata[dm.MetadataFirmware], Metadata: d.Metadata}
+	if len(partners) > 0 {
+		data.Partner = partners[0]
+	}
+	return data
+}
+
+var funcs = template.FuncMap{"lower": strings.ToLower, "upper": strings.ToUpper}
+
+// Validate checks the profile's name and parameters and that every value parses as a template.
+func (p Profile) Validate() error {
+	if p.Name == "" || strings.ContainsAny(p.Name, "/ ") {
+		return fmt.Errorf("profile name %q: %w", p.Name, dm.ErrInvalidParameter)
+	}
+	if len(p.Parameters) == 0 {
+		return fmt.Errorf("profile %s: parameters required: %w", p.Name, dm.ErrInvalidParameter)
+	}
+	seen := make(map[string]bool, len(p.Parameters))
+	for _, param := range p.Parameters {
+		if param.Name == "" || strings.HasSuffix(param.Name, ".") || seen[param.Name] {
+			return fmt.Errorf("profile %s: parameter %q is empty, partial or repeated: %w", p.Name, param.Name, dm.ErrInvalidParameter)
+		}
+		seen[param.Name] = true
+		if _, err := parse(param); err != nil {
+			return fmt.Errorf("profile %s: %s: %v: %w", p.Name, param.Name, err, dm.ErrInvalidParameter)
+		}
+	}
+	return nil
+}
+
+func parse(param Parameter) (*template.Template, error) {
+	return template.New(param.Name).Funcs(funcs).Option("missingkey=error").Parse(param.Value)
+}
+
+// Render evaluates the profile's templates for one device.
+func (p Profile) Render(data TemplateData) ([]dm.SetParameter, error) {
+	out := make([]dm.SetParameter, 0, len(p.Parameters))
+	for _, param := range p.Parameters {
+		t, err := parse(param)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v: %w", param.Name, err, dm.ErrInvalidParameter)
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("%s: %v: %w", param.Name, err, dm.ErrInvalidParameter)
+		}
+		out = append(out, dm.SetParameter{Name: param.Name, Value: b.String(), TypeHint: param.DataType})
+	}
+	return out, nil
+}
+
+// Value is a parameter value written to, or read from, a device.
+type Value struct {
+	Value    interface{} `json:"value"`
+	DataType string      `json:"dataType,omitempty"`
+}
+
+// ApplicationKind tells an apply from a rollback in a device's history.
+type ApplicationKind string
+
+const (
+	KindApply    ApplicationKind = "apply"
+	KindRollback ApplicationKind = "rollback"
+)
+
+// Application records a profile written to a device. Previous holds what the written parameters
+// read just before, so a rollback can also restore parameters no earlier profile set.
+type Application struct {
+	ID        string           `json:"id"`
+	Kind      ApplicationKind  `json:"kind"`
+	Device    dm.DeviceID      `json:"device"`
+	Profile   string           `json:"profile,omitempty"` // empty after rolling back the first profile
+	Version   int              `json:"version,omitempty"`
+	Service   string           `json:"service,omitempty"`
+	Values    map[string]Value `json:"values"`
+	Previous  map[string]Value `json:"previous,omitempty"`
+	AppliedAt time.Time        `json:"appliedAt"`
+}
+
+// applied returns the device's stack of applications in effect, oldest first: each apply pushes,
+// each rollback pops.
+func applied(history []Application) []Application {
+	var stack []Application
+	for _, a := range history {
+		switch a.Kind {
+		case KindApply:
+			stack = append(stack, a)
+		case KindRollback:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	return stack
+}
+
+// Store persists profile versions and per-device application history.
+type Store interface {
+	// SaveProfile stores p as the next version of its name and returns it with Version set.
+	SaveProfile(ctx context.Context, p Profile) (Profile, error)
+	// Profile returns one version of a profile; version 0 is the latest.
+	Profile(ctx context.Context, name string, version int) (Profile, error)
+	// Profiles returns the latest version of every profile, ordered by name.
+	Profiles(ctx context.Context) ([]Profile, error)
+	// Versions returns every version of a profile, oldest first.
+	Versions(ctx context.Context, name string) ([]Profile, error)
+	Record(ctx context.Context, a Application) error
+	// History returns a device's applications, oldest first.
+	History(ctx context.Context, device dm.DeviceID) ([]Application, error)
+}
+
+// MemoryStore is a process-local Store.
+type MemoryStore struct {
+	mu       sync.Mutex
+	profiles map[string][]Profile
+	history  map[dm.DeviceID][]Application
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{profiles: make(map[string][]Profile), history: make(map[dm.DeviceID][]Application)}
+}
+
+func (m *MemoryStore) SaveProfile(_ context.Context, p Profile) (Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p.Version = len(m.profiles[p.Name]) + 1
+	m.profiles[p.Name] = append(m.profiles[p.Name], p)
+	return p, nil
+}
+
+func (m *MemoryStore) Profile(_ context.Context, name string, version int) (Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	versions := m.profiles[name]
+	if version == 0 {
+		version = len(versions)
+	}
+	if version < 1 || version > len(versions) {
+		return Profile{}, ErrProfileNotFound
+	}
+	return versions[version-1], nil
+}
+
+func (m *MemoryStore) Profiles(_ context.Context) ([]Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Profile, 0, len(m.profiles))
+	for _, versions := range m.profiles {
+		out = append(out, versions[len(versions)-1])
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Name < out[k].Name })
+	return out, nil
+}
+
+func (m *MemoryStore) Versions(_ context.Context, name string) ([]Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	versions, ok := m.profiles[name]
+	if !ok {
+		return nil, ErrProfileNotFound
+	}
+	return append([]Profile(nil), versions...), nil
+}
+
+func (m *MemoryStore) Record(_ context.Context, a Application) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.history[a.Device] = append(m.history[a.Device], a)
+	return nil
+}
+
+func (m *MemoryStore) History(_ context.Context, device dm.DeviceID) ([]Application, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Application(nil), m.history[device]...), nil
+}
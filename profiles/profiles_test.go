@@ -0,0 +1,151 @@
+package profiles
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// fakeDevices keeps one value map per device; SETs update it.
+type fakeDevices struct {
+	mu     sync.Mutex
+	values map[dm.DeviceID]map[string]interface{}
+}
+
+func (f *fakeDevices) Device(_ context.Context, id dm.DeviceID) (dm.DeviceState, error) {
+	if _, ok := f.values[id]; !ok {
+		return dm.DeviceState{}, dm.ErrDeviceNotFound
+	}
+	return dm.DeviceState{ID: id, Metadata: map[string]string{dm.MetadataModel: "XB7", dm.MetadataPartnerIDs: "sky,comcast"}}, nil
+}
+
+func (f *fakeDevices) RefreshParameters(_ context.Context, id dm.DeviceID, _ string, names []string) (map[string]dm.ParameterValue, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make(map[string]dm.ParameterValue)
+	for _, n := range names {
+		if v, ok := f.values[id][n]; ok {
+			out[n] = dm.ParameterValue{Name: n, Value: v, Type: "string"}
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeDevices) SetParameters(_ context.Context, id dm.DeviceID, _ string, params []dm.SetParameter, _ dm.SetOptions) (*runtime.SetResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range params {
+		f.values[id][p.Name] = p.Value
+	}
+	return &runtime.SetResult{}, nil
+}
+
+func (f *fakeDevices) get(id dm.DeviceID, name string) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.values[id][name]
+}
+
+func TestProfileApplyAndRollback(t *testing.T) {
+	ctx := context.Background()
+	dev := &fakeDevices{values: map[dm.DeviceID]map[string]interface{}{
+		"mac:112233445566": {"Device.SSID": "factory", "Device.Server": "old.example.com"},
+	}}
+	svc := NewService(dev, nil)
+	const id = "mac:112233445566"
+
+	v1, err := svc.Save(ctx, Profile{Name: "lab", Parameters: []Parameter{{Name: "Device.SSID", Value: "{{.Partner}}-{{lower .Model}}-{{.Serial}}"}}})
+	if err != nil || v1.Version != 1 {
+		t.Fatalf("save v1: %+v %v", v1, err)
+	}
+	v2, err := svc.Save(ctx, Profile{Name: "lab", Parameters: []Parameter{
+		{Name: "Device.SSID", Value: "lab2"},
+		{Name: "Device.Server", Value: "{{.Partner}}.example.com"},
+	}})
+	if err != nil || v2.Version != 2 {
+		t.Fatalf("save v2: %+v %v", v2, err)
+	}
+
+	if _, err := svc.Apply(ctx, id, "lab", 1); err != nil {
+		t.Fatalf("apply v1: %v", err)
+	}
+	if got := dev.get(id, "Device.SSID"); got != "sky-xb7-112233445566" {
+		t.Fatalf("rendered SSID %v", got)
+	}
+	if _, err := svc.Apply(ctx, id, "lab", 0); err != nil {
+		t.Fatalf("apply latest: %v", err)
+	}
+	if dev.get(id, "Device.SSID") != "lab2" || dev.get(id, "Device.Server") != "sky.example.com" {
+		t.Fatalf("v2 values: %v", dev.values[id])
+	}
+
+	// back to v1: its SSID, and the server only v2 set goes back to what it read before v2
+	rb, err := svc.Rollback(ctx, id)
+	if err != nil || rb.Profile != "lab" || rb.Version != 1 {
+		t.Fatalf("rollback: %+v %v", rb, err)
+	}
+	if dev.get(id, "Device.SSID") != "sky-xb7-112233445566" || dev.get(id, "Device.Server") != "old.example.com" {
+		t.Fatalf("after rollback: %v", dev.values[id])
+	}
+	st, err := svc.Status(ctx, id)
+	if err != nil || st.Current == nil || st.Current.Version != 1 || len(st.History) != 3 {
+		t.Fatalf("status: %+v %v", st, err)
+	}
+
+	// then past v1 to the factory values
+	if _, err := svc.Rollback(ctx, id); err != nil {
+		t.Fatalf("second rollback: %v", err)
+	}
+	if dev.get(id, "Device.SSID") != "factory" {
+		t.Fatalf("after second rollback: %v", dev.values[id])
+	}
+	if _, err := svc.Rollback(ctx, id); !errors.Is(err, ErrNothingApplied) {
+		t.Fatalf("third rollback: %v", err)
+	}
+	if _, err := svc.Apply(ctx, id, "lab", 3); !errors.Is(err, ErrProfileNotFound) {
+		t.Fatalf("missing version: %v", err)
+	}
+}
+
+func TestProfileGroupAndValidation(t *testing.T) {
+	ctx := context.Background()
+	dev := &fakeDevices{values: map[dm.DeviceID]map[string]interface{}{"mac:1": {}, "mac:2": {}}}
+	svc := NewService(dev, nil)
+	if _, err := svc.Save(ctx, Profile{Name: "ntp", Parameters: []Parameter{{Name: "Device.Time.NTPServer1", Value: "ntp.{{.Model}}.example.com"}}}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := svc.ApplyGroup(ctx, []dm.DeviceID{"mac:1", "mac:2", "mac:3"}, "ntp", 0, 2)
+	if err != nil || len(results) != 3 {
+		t.Fatalf("group: %+v %v", results, err)
+	}
+	for _, r := range results {
+		if r.OK != (r.Device != "mac:3") {
+			t.Fatalf("result %+v", r)
+		}
+	}
+	if got := dev.get("mac:2", "Device.Time.NTPServer1"); got != "ntp.XB7.example.com" {
+		t.Fatalf("mac:2 server %v", got)
+	}
+
+	for _, p := range []Profile{
+		{Name: "a/b", Parameters: []Parameter{{Name: "Device.X", Value: "1"}}},
+		{Name: "empty"},
+		{Name: "partial", Parameters: []Parameter{{Name: "Device.", Value: "1"}}},
+		{Name: "syntax", Parameters: []Parameter{{Name: "Device.X", Value: "{{.Model"}}},
+	} {
+		if _, err := svc.Save(ctx, p); !errors.Is(err, dm.ErrInvalidParameter) {
+			t.Fatalf("%s: %v", p.Name, err)
+		}
+	}
+	// unknown fields parse, and fail when rendered
+	if _, err := svc.Save(ctx, Profile{Name: "typo", Parameters: []Parameter{{Name: "Device.X", Value: "{{.Modle}}"}}}); err != nil {
+		t.Fatalf("save typo: %v", err)
+	}
+	if _, err := svc.Render(ctx, "mac:1", "typo", 0); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("render typo: %v", err)
+	}
+}
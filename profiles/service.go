@@ -0,0 +1,220 @@
+package profiles
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// Devices is the subset of manager.Manager used by Service.
+type Devices interface {
+	Device(ctx context.Context, id dm.DeviceID) (dm.DeviceState, error)
+	RefreshParameters(ctx context.Context, id dm.DeviceID, service string, names []string) (map[string]dm.ParameterValue, error)
+	SetParameters(ctx context.Context, id dm.DeviceID, service string, params []dm.SetParameter, opts dm.SetOptions) (*runtime.SetResult, error)
+}
+
+// Service stores profiles and applies them to devices through a Manager.
+type Service struct {
+	m     Devices
+	store Store
+	locks sync.Map // dm.DeviceID -> *sync.Mutex; serializes applies and rollbacks per device
+}
+
+// NewService uses store for persistence; nil selects a MemoryStore.
+func NewService(m Devices, store Store) *Service {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Service{m: m, store: store}
+}
+
+// Save validates p and stores it as the next version of its name.
+func (s *Service) Save(ctx context.Context, p Profile) (Profile, error) {
+	if err := p.Validate(); err != nil {
+		return Profile{}, err
+	}
+	p.CreatedAt = time.Now().UTC()
+	return s.store.SaveProfile(ctx, p)
+}
+
+// Get returns one version of a profile; version 0 is the latest.
+func (s *Service) Get(ctx context.Context, name string, version int) (Profile, error) {
+	return s.store.Profile(ctx, name, version)
+}
+
+// List returns the latest version of every profile.
+func (s *Service) List(ctx context.Context) ([]Profile, error) { return s.store.Profiles(ctx) }
+
+// Versions returns every version of a profile, oldest first.
+func (s *Service) Versions(ctx context.Context, name string) ([]Profile, error) {
+	return s.store.Versions(ctx, name)
+}
+
+// Render evaluates a profile for a device without writing anything.
+func (s *Service) Render(ctx context.Context, device dm.DeviceID, name string, version int) ([]dm.SetParameter, error) {
+	p, err := s.store.Profile(ctx, name, version)
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.m.Device(ctx, device)
+	if err != nil {
+		return nil, err
+	}
+	return p.Render(NewTemplateData(d))
+}
+
+// Apply renders a profile for the device and writes it, recording the values it replaced.
+func (s *Service) Apply(ctx context.Context, device dm.DeviceID, name string, version int) (Application, error) {
+	p, err := s.store.Profile(ctx, name, version)
+	if err != nil {
+		return Application{}, err
+	}
+	return s.apply(ctx, device, p)
+}
+
+// ApplyGroup applies one profile version to every device, concurrency at a time. The version is
+// resolved once, so a profile saved mid-run does not mix versions; each result's detail is the
+// application ID.
+func (s *Service) ApplyGroup(ctx context.Context, devices []dm.DeviceID, name string, version, concurrency int) ([]jobs.DeviceResult, error) {
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("devices required: %w", dm.ErrInvalidParameter)
+	}
+	p, err := s.store.Profile(ctx, name, version)
+	if err != nil {
+		return nil, err
+	}
+	return jobs.Run(ctx, devices, func(ctx context.Context, id dm.DeviceID) error {
+		a, err := s.apply(ctx, id, p)
+		if err != nil {
+			return err
+		}
+		jobs.ReportDetail(ctx, a.ID)
+		return nil
+	}, jobs.RunConfig{Concurrency: concurrency})
+}
+
+func (s *Service) apply(ctx context.Context, device dm.DeviceID, p Profile) (Application, error) {
+	d, err := s.m.Device(ctx, device)
+	if err != nil {
+		return Application{}, err
+	}
+	params, err := p.Render(NewTemplateData(d))
+	if err != nil {
+		return Application{}, err
+	}
+	unlock := s.lock(d.ID)
+	defer unlock()
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.Name
+	}
+	current, err := s.m.RefreshParameters(ctx, d.ID, p.Service, names)
+	if err != nil {
+		return Application{}, fmt.Errorf("read values before apply: %w", err)
+	}
+	if _, err := s.m.SetParameters(ctx, d.ID, p.Service, params, dm.SetOptions{}); err != nil {
+		return Application{}, err
+	}
+	a := Application{ID: uuid.NewString(), Kind: KindApply, Device: d.ID, Profile: p.Name, Version: p.Version, Service: p.Service,
+		Values: make(map[string]Value, len(params)), Previous: make(map[string]Value, len(current)), AppliedAt: time.Now().UTC()}
+	for _, param := range params {
+		a.Values[param.Name] = Value{Value: param.Value, DataType: param.TypeHint}
+	}
+	for name, v := range current {
+		a.Previous[name] = Value{Value: v.Value, DataType: v.Type}
+	}
+	if err := s.store.Record(ctx, a); err != nil {
+		return a, fmt.Errorf("record application: %w", err)
+	}
+	return a, nil
+}
+
+// Rollback undoes the device's latest profile: it rewrites the values of the profile applied before
+// it, and restores the parameters only the latest one set to what they read before it was applied.
+// Rolling back the only applied profile restores every parameter it replaced.
+func (s *Service) Rollback(ctx context.Context, device dm.DeviceID) (Application, error) {
+	d, err := s.m.Device(ctx, device)
+	if err != nil {
+		return Application{}, err
+	}
+	unlock := s.lock(d.ID)
+	defer unlock()
+	history, err := s.store.History(ctx, d.ID)
+	if err != nil {
+		return Application{}, err
+	}
+	stack := applied(history)
+	if len(stack) == 0 {
+		return Application{}, ErrNothingApplied
+	}
+	latest := stack[len(stack)-1]
+	a := Application{ID: uuid.NewString(), Kind: KindRollback, Device: d.ID, Values: make(map[string]Value), AppliedAt: time.Now().UTC()}
+	writes := make(map[string][]dm.SetParameter) // by service
+	if len(stack) > 1 {
+		prev := stack[len(stack)-2]
+		a.Profile, a.Version, a.Service = prev.Profile, prev.Version, prev.Service
+		for name, v := range prev.Values {
+			a.Values[name] = v
+			writes[prev.Service] = append(writes[prev.Service], dm.SetParameter{Name: name, Value: v.Value, TypeHint: v.DataType})
+		}
+	}
+	for name, v := range latest.Previous {
+		if _, ok := a.Values[name]; ok {
+			continue
+		}
+		a.Values[name] = v
+		writes[latest.Service] = append(writes[latest.Service], dm.SetParameter{Name: name, Value: v.Value, TypeHint: v.DataType})
+	}
+	services := make([]string, 0, len(writes))
+	for svc := range writes {
+		services = append(services, svc)
+	}
+	sort.Strings(services)
+	for _, svc := range services {
+		params := writes[svc]
+		sort.Slice(params, func(i, k int) bool { return params[i].Name < params[k].Name })
+		if _, err := s.m.SetParameters(ctx, d.ID, svc, params, dm.SetOptions{}); err != nil {
+			return Application{}, err
+		}
+	}
+	if err := s.store.Record(ctx, a); err != nil {
+		return a, fmt.Errorf("record rollback: %w", err)
+	}
+	return a, nil
+}
+
+// Status is a device's profile history and the profile currently in effect.
+type Status struct {
+	Current *Application  `json:"current,omitempty"`
+	History []Application `json:"history"`
+}
+
+// Status returns the device's applications, oldest first, and the one in effect.
+func (s *Service) Status(ctx context.Context, device dm.DeviceID) (Status, error) {
+	d, err := s.m.Device(ctx, device)
+	if err != nil {
+		return Status{}, err
+	}
+	history, err := s.store.History(ctx, d.ID)
+	if err != nil {
+		return Status{}, err
+	}
+	st := Status{History: history}
+	if stack := applied(history); len(stack) > 0 {
+		st.Current = &stack[len(stack)-1]
+	}
+	return st, nil
+}
+
+func (s *Service) lock(id dm.DeviceID) (unlock func()) {
+	mu, _ := s.locks.LoadOrStore(id, new(sync.Mutex))
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
@@ -0,0 +1,206 @@
+package quality
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/metrics"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// DefaultSample is how many online devices a round samples when QualityConfig.Sample is zero.
+const DefaultSample = 50
+
+// sampleConcurrency bounds the stat requests of a round.
+const sampleConcurrency = 8
+
+// Devices is the subset of manager.Manager used by Collector.
+type Devices interface {
+	ListDevices(ctx context.Context) []dm.DeviceState
+	Device(ctx context.Context, id dm.DeviceID) (dm.DeviceState, error)
+	ConnectionStats(ctx context.Context, id dm.DeviceID) (runtime.DeviceStatistics, error)
+}
+
+// Score is a device's latest connection quality, from 0 (not connected) to 100.
+type Score struct {
+	Device    dm.DeviceID               `json:"device"`
+	Score     int                       `json:"score"`
+	Reasons   []string                  `json:"reasons,omitempty"`
+	Stats     *runtime.DeviceStatistics `json:"stats,omitempty"` // nil when Talaria does not hold the device
+	SampledAt time.Time                 `json:"sampledAt"`
+
+	partners []string
+}
+
+// Collector samples connection statistics and keeps each sampled device's latest Score. Scores
+// not refreshed for three intervals are dropped, so random sampling does not grow without bound.
+type Collector struct {
+	m     Devices
+	cfg   dm.QualityConfig
+	gauge *metrics.GaugeVec
+
+	mu     sync.RWMutex
+	scores map[dm.DeviceID]*Score
+}
+
+// NewCollector scores devices of m. With reg set, scores are exported as the
+// devicemgr_device_connection_quality gauge, labeled by device.
+func NewCollector(m Devices, cfg dm.QualityConfig, reg *metrics.Registry) *Collector {
+	if cfg.Sample <= 0 {
+		cfg.Sample = DefaultSample
+	}
+	c := &Collector{m: m, cfg: cfg, scores: make(map[dm.DeviceID]*Score)}
+	if reg != nil {
+		c.gauge = reg.Gauge("devicemgr_device_connection_quality", "Connection quality score (0-100) of sampled devices.", "device")
+	}
+	return c
+}
+
+// Run collects a round every cfg.Interval until ctx ends.
+func (c *Collector) Run(ctx context.Context) {
+	if c.cfg.Interval <= 0 {
+		return
+	}
+	t := time.NewTicker(c.cfg.Interval)
+	defer t.Stop()
+	for {
+		_ = c.CollectOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// CollectOnce samples one round: the configured devices, or a random sample of online ones. It
+// returns the failed reads joined; the devices read successfully are scored regardless.
+func (c *Collector) CollectOnce(ctx context.Context) error {
+	targets := c.targets(ctx)
+	ids := make([]dm.DeviceID, len(targets))
+	for i, d := range targets {
+		ids[i] = d.ID
+	}
+	partners := make(map[dm.DeviceID][]string, len(targets))
+	for _, d := range targets {
+		partners[d.ID] = dm.SplitPartners(d.Metadata[dm.MetadataPartnerIDs])
+	}
+	results, err := jobs.Run(ctx, ids, func(ctx context.Context, id dm.DeviceID) error {
+		_, err := c.sample(ctx, id, partners[id])
+		return err
+	}, jobs.RunConfig{Concurrency: sampleConcurrency})
+	if err != nil {
+		return err
+	}
+	c.expire(time.Now())
+	var errs []error
+	for _, r := range results {
+		if r.Error != "" {
+			errs = append(errs, errors.New(string(r.Device)+": "+r.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Collector) targets(ctx context.Context) []dm.DeviceState {
+	if len(c.cfg.Devices) > 0 {
+		out := make([]dm.DeviceState, 0, len(c.cfg.Devices))
+		for _, id := range c.cfg.Devices {
+			d, err := c.m.Device(ctx, id)
+			if err != nil {
+				d = dm.DeviceState{ID: id.Canonical()} // not in the poll: sampled, and scored as disconnected
+			}
+			out = append(out, d)
+		}
+		return out
+	}
+	online := c.m.ListDevices(ctx)
+	if len(online) <= c.cfg.Sample {
+		return online
+	}
+	rand.Shuffle(len(online), func(i, k int) { online[i], online[k] = online[k], online[i] })
+	return online[:c.cfg.Sample]
+}
+
+// sample reads and scores one device. A device Talaria does not hold scores 0.
+func (c *Collector) sample(ctx context.Context, id dm.DeviceID, partners []string) (Score, error) {
+	st, err := c.m.ConnectionStats(ctx, id)
+	var cur *runtime.DeviceStatistics
+	switch {
+	case err == nil:
+		cur = &st
+	case !errors.Is(err, dm.ErrDeviceOffline):
+		return Score{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var prev *runtime.DeviceStatistics
+	if old := c.scores[id]; old != nil {
+		prev = old.Stats
+	}
+	s := &Score{Device: id, Stats: cur, SampledAt: time.Now().UTC(), partners: partners}
+	s.Score, s.Reasons = Evaluate(prev, cur)
+	c.scores[id] = s
+	if c.gauge != nil {
+		c.gauge.Set(float64(s.Score), string(id))
+	}
+	return *s, nil
+}
+
+func (c *Collector) expire(now time.Time) {
+	if c.cfg.Interval <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, s := range c.scores {
+		if now.Sub(s.SampledAt) > 3*c.cfg.Interval {
+			delete(c.scores, id)
+			if c.gauge != nil {
+				c.gauge.Delete(string(id))
+			}
+		}
+	}
+}
+
+// Score returns the device's latest score, sampling it now when no round has. Devices outside
+// the caller's partner scope report ErrDeviceNotFound.
+func (c *Collector) Score(ctx context.Context, id dm.DeviceID) (Score, error) {
+	d, err := c.m.Device(ctx, id)
+	if err != nil {
+		return Score{}, err
+	}
+	c.mu.RLock()
+	s := c.scores[d.ID]
+	c.mu.RUnlock()
+	if s != nil {
+		return *s, nil
+	}
+	return c.sample(ctx, d.ID, dm.SplitPartners(d.Metadata[dm.MetadataPartnerIDs]))
+}
+
+// Scores returns the sampled devices visible to the caller, worst first.
+func (c *Collector) Scores(ctx context.Context) []Score {
+	scope, scoped := dm.PartnersFromContext(ctx)
+	c.mu.RLock()
+	out := make([]Score, 0, len(c.scores))
+	for _, s := range c.scores {
+		if !scoped || dm.PartnerAllowed(scope, s.partners) {
+			out = append(out, *s)
+		}
+	}
+	c.mu.RUnlock()
+	sort.Slice(out, func(i, k int) bool {
+		if out[i].Score != out[k].Score {
+			return out[i].Score < out[k].Score
+		}
+		return out[i].Device < out[k].Device
+	})
+	return out
+}
@@ -0,0 +1,61 @@
+// Package quality scores how well devices hold their Talaria connection. A Collector samples
+// Talaria's per-device statistics each round and compares them with the previous sample, so a
+// device that keeps reconnecting, is connected twice or stops sending stands out before its
+// users notice.
+package quality
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// Score penalties; a score starts at 100 and never drops below 0.
+const (
+	reconnectPenalty   = 25 // new connection since the previous sample
+	youngPenalty       = 15 // connected for less than youngConnection
+	duplicationPenalty = 10 // per duplicate connection, up to maxDuplication
+	maxDuplication     = 40
+	pendingPenalty     = 2 // per queued message, up to maxPending
+	maxPending         = 20
+	silentPenalty      = 10 // nothing received since the previous sample
+
+	youngConnection = 10 * time.Minute
+)
+
+// Evaluate scores a device's connection from its current statistics and, when the device was
+// sampled before, the previous ones. A nil cur means Talaria does not hold the device. The
+// reasons explain every penalty.
+func Evaluate(prev, cur *runtime.DeviceStatistics) (score int, reasons []string) {
+	if cur == nil {
+		return 0, []string{"not connected to Talaria"}
+	}
+	score = 100
+	sameConnection := prev != nil && prev.ConnectedAt.Equal(cur.ConnectedAt)
+	switch {
+	case prev != nil && !sameConnection:
+		score -= reconnectPenalty
+		reasons = append(reasons, "reconnected since the last sample")
+	case cur.UpTime < youngConnection:
+		score -= youngPenalty
+		reasons = append(reasons, fmt.Sprintf("connected for %s", cur.UpTime.Round(time.Second)))
+	}
+	dups := cur.Duplications
+	if sameConnection {
+		dups -= prev.Duplications
+	}
+	if dups > 0 {
+		score -= int(min(dups*duplicationPenalty, maxDuplication))
+		reasons = append(reasons, fmt.Sprintf("%d duplicate connections", dups))
+	}
+	if cur.Pending > 0 {
+		score -= min(cur.Pending*pendingPenalty, maxPending)
+		reasons = append(reasons, fmt.Sprintf("%d messages queued", cur.Pending))
+	}
+	if sameConnection && cur.MessagesReceived == prev.MessagesReceived {
+		score -= silentPenalty
+		reasons = append(reasons, "nothing received since the last sample")
+	}
+	return max(score, 0), reasons
+}
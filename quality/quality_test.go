@@ -0,0 +1,123 @@
+package quality
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/metrics"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+var connected = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestEvaluate(t *testing.T) {
+	steady := runtime.DeviceStatistics{ConnectedAt: connected, UpTime: time.Hour, MessagesReceived: 10}
+	if score, reasons := Evaluate(nil, &steady); score != 100 || reasons != nil {
+		t.Fatalf("steady first sample: %d %v", score, reasons)
+	}
+	if score, _ := Evaluate(nil, nil); score != 0 {
+		t.Fatalf("disconnected: %d", score)
+	}
+
+	idle := steady
+	if score, reasons := Evaluate(&steady, &idle); score != 90 || reasons[0] != "nothing received since the last sample" {
+		t.Fatalf("silent: %d %v", score, reasons)
+	}
+	busy := steady
+	busy.MessagesReceived, busy.Duplications, busy.Pending = 20, 2, 3
+	if score, reasons := Evaluate(&steady, &busy); score != 74 || len(reasons) != 2 {
+		t.Fatalf("duplications and queue: %d %v", score, reasons)
+	}
+	reconnected := runtime.DeviceStatistics{ConnectedAt: connected.Add(time.Hour), UpTime: time.Minute, Duplications: 9}
+	if score, reasons := Evaluate(&steady, &reconnected); score != 35 || reasons[0] != "reconnected since the last sample" {
+		t.Fatalf("reconnected: %d %v", score, reasons)
+	}
+}
+
+type fakeDevices struct {
+	mu    sync.Mutex
+	stats map[dm.DeviceID]runtime.DeviceStatistics
+	reads int
+}
+
+func (f *fakeDevices) ListDevices(ctx context.Context) []dm.DeviceState {
+	var out []dm.DeviceState
+	for _, id := range []dm.DeviceID{"mac:aa", "mac:bb"} {
+		if d, err := f.Device(ctx, id); err == nil {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func (f *fakeDevices) Device(ctx context.Context, id dm.DeviceID) (dm.DeviceState, error) {
+	partner := map[dm.DeviceID]string{"mac:aa": "comcast", "mac:bb": "sky"}[id]
+	scope, scoped := dm.PartnersFromContext(ctx)
+	if partner == "" || scoped && !dm.PartnerAllowed(scope, []string{partner}) {
+		return dm.DeviceState{}, dm.ErrDeviceNotFound
+	}
+	return dm.DeviceState{ID: id, Metadata: map[string]string{dm.MetadataPartnerIDs: partner}}, nil
+}
+
+func (f *fakeDevices) ConnectionStats(_ context.Context, id dm.DeviceID) (runtime.DeviceStatistics, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads++
+	st, ok := f.stats[id]
+	if !ok {
+		return st, dm.ErrDeviceOffline
+	}
+	return st, nil
+}
+
+func TestCollector(t *testing.T) {
+	ctx := context.Background()
+	dev := &fakeDevices{stats: map[dm.DeviceID]runtime.DeviceStatistics{
+		"mac:aa": {ConnectedAt: connected, UpTime: time.Hour, MessagesReceived: 5},
+	}}
+	reg := metrics.NewRegistry()
+	c := NewCollector(dev, dm.QualityConfig{Interval: time.Minute}, reg)
+	if err := c.CollectOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	scores := c.Scores(ctx)
+	if len(scores) != 2 || scores[0].Device != "mac:bb" || scores[0].Score != 0 || scores[1].Score != 100 {
+		t.Fatalf("scores %+v", scores)
+	}
+	if sky := c.Scores(dm.WithPartners(ctx, []string{"sky"})); len(sky) != 1 || sky[0].Device != "mac:bb" {
+		t.Fatalf("sky scores %+v", sky)
+	}
+	if _, err := c.Score(dm.WithPartners(ctx, []string{"sky"}), "mac:aa"); !errors.Is(err, dm.ErrDeviceNotFound) {
+		t.Fatalf("out-of-scope score: %v", err)
+	}
+
+	// a second round compares with the first: mac:aa received nothing
+	if err := c.CollectOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := c.Score(ctx, "mac:aa"); err != nil || s.Score != 90 || dev.reads != 4 {
+		t.Fatalf("score %+v %v after %d reads", s, err, dev.reads)
+	}
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `devicemgr_device_connection_quality{device="mac:aa"} 90`) ||
+		!strings.Contains(body, `devicemgr_device_connection_quality{device="mac:bb"} 0`) {
+		t.Fatalf("metrics:\n%s", body)
+	}
+
+	c.expire(time.Now().Add(time.Hour))
+	if len(c.Scores(ctx)) != 0 {
+		t.Fatal("stale scores kept")
+	}
+	if s, err := c.Score(ctx, "mac:aa"); err != nil || s.Score != 100 || dev.reads != 5 {
+		t.Fatalf("on-demand score %+v %v after %d reads", s, err, dev.reads)
+	}
+}
@@ -0,0 +1,69 @@
+package devicemgr
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Quarantine blocks the mutating operations (parameter writes, RPCs, reboots, firmware updates
+// and the like) on one device, or on every device of a group, until it expires or is lifted;
+// useful while an incident is investigated. Only admins overriding it (WithQuarantineOverride)
+// may change a quarantined device. Exactly one of DeviceID and Group is set.
+type Quarantine struct {
+	ID       string   `json:"id"` // QuarantineID of the target
+	DeviceID DeviceID `json:"deviceId,omitempty"`
+	// Group is a value of the device metadata entry MaintenanceConfig.GroupMetadata, so the
+	// groups are those maintenance windows are assigned to.
+	Group     string    `json:"group,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Actor     string    `json:"actor,omitempty"` // who placed it, when known
+	Until     time.Time `json:"until"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// QuarantineID returns the ID of the quarantine of a device or, when id is empty, of a group. A
+// target has at most one quarantine; quarantining it again replaces it.
+func QuarantineID(id DeviceID, group string) string {
+	if id != "" {
+		return "device:" + string(id)
+	}
+	return "group:" + group
+}
+
+// Active reports whether q still applies at now.
+func (q Quarantine) Active(now time.Time) bool { return now.Before(q.Until) }
+
+// QuarantineError is returned for mutating operations on a quarantined device; it matches
+// ErrQuarantined with errors.Is.
+type QuarantineError struct {
+	DeviceID   DeviceID
+	Quarantine Quarantine
+}
+
+func (e *QuarantineError) Error() string {
+	msg := fmt.Sprintf("%s: %s until %s", e.DeviceID, ErrQuarantined, e.Quarantine.Until.Format(time.RFC3339))
+	if e.Quarantine.Group != "" {
+		msg += " (group " + e.Quarantine.Group + ")"
+	}
+	if e.Quarantine.Reason != "" {
+		msg += ": " + e.Quarantine.Reason
+	}
+	return msg
+}
+
+func (e *QuarantineError) Is(target error) bool { return target == ErrQuarantined }
+
+type quarantineOverrideKey struct{}
+
+// WithQuarantineOverride returns a context whose operations ignore quarantines. Like the
+// maintenance override it is only honoured for callers OverrideAllowed permits.
+func WithQuarantineOverride(ctx context.Context) context.Context {
+	return context.WithValue(ctx, quarantineOverrideKey{}, true)
+}
+
+// QuarantineOverridden reports whether ctx carries WithQuarantineOverride.
+func QuarantineOverridden(ctx context.Context) bool {
+	forced, _ := ctx.Value(quarantineOverrideKey{}).(bool)
+	return forced
+}
@@ -0,0 +1,122 @@
+package devicemgr
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultRedactedParameters are the parameter-name patterns masked when RedactionConfig lists
+// none: WiFi passphrases and keys, passwords, secrets and tokens.
+var DefaultRedactedParameters = []string{"*Passphrase*", "*PreSharedKey*", "*WEPKey*", "*Password*", "*Secret*", "*Token*"}
+
+// DefaultRedactionMask replaces masked values when RedactionConfig.Mask is unset.
+const DefaultRedactionMask = "[REDACTED]"
+
+// RedactionConfig masks sensitive parameter values in event payloads and audit records before
+// they reach subscribers: logs, webhooks, SSE streams and the Kafka and NATS publishers.
+type RedactionConfig struct {
+	// Parameters are parameter-name patterns: '*' matches any run of characters, dots included,
+	// and matching ignores case. Nil uses DefaultRedactedParameters; an empty list disables
+	// redaction.
+	Parameters []string
+	Mask       string // DefaultRedactionMask when empty
+	Strip      bool   // drop masked values altogether instead of replacing them
+}
+
+// payload keys naming a parameter, and the keys holding its value
+var (
+	redactNameKeys  = []string{"name", "paramName", "paramPath", "parameter"}
+	redactValueKeys = []string{"value", "paramValue", "expected", "actual"}
+)
+
+// Redactor applies a RedactionConfig. The nil Redactor redacts nothing.
+type Redactor struct {
+	re    *regexp.Regexp
+	mask  string
+	strip bool
+}
+
+// NewRedactor compiles cfg, returning nil when it matches no parameters.
+func NewRedactor(cfg RedactionConfig) *Redactor {
+	patterns := cfg.Parameters
+	if patterns == nil {
+		patterns = DefaultRedactedParameters
+	}
+	re := compileGlobs(patterns)
+	if re == nil {
+		return nil
+	}
+	r := &Redactor{re: re, mask: cfg.Mask, strip: cfg.Strip}
+	if r.mask == "" {
+		r.mask = DefaultRedactionMask
+	}
+	return r
+}
+
+// Sensitive reports whether the named parameter's values are masked.
+func (r *Redactor) Sensitive(name string) bool {
+	return r != nil && name != "" && r.re.MatchString(name)
+}
+
+// JSON masks, in place, the sensitive values within v, a value decoded from JSON into
+// interface{}. A value is sensitive when its object key matches, or when it is the value of an
+// object naming a matching parameter, such as {"name": ..., "value": ...} or a drift's
+// {"parameter": ..., "expected": ..., "actual": ...}. It reports whether anything was masked.
+func (r *Redactor) JSON(v interface{}) bool {
+	if r == nil {
+		return false
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		masked := false
+		for _, k := range redactNameKeys {
+			if name, ok := v[k].(string); ok && r.Sensitive(name) {
+				for _, vk := range redactValueKeys {
+					if _, ok := v[vk]; ok {
+						r.maskKey(v, vk)
+						masked = true
+					}
+				}
+				break
+			}
+		}
+		for k, val := range v {
+			switch {
+			case r.Sensitive(k):
+				r.maskKey(v, k)
+				masked = true
+			case r.JSON(val):
+				masked = true
+			}
+		}
+		return masked
+	case []interface{}:
+		masked := false
+		for _, val := range v {
+			if r.JSON(val) {
+				masked = true
+			}
+		}
+		return masked
+	}
+	return false
+}
+
+func (r *Redactor) maskKey(m map[string]interface{}, k string) {
+	if r.strip {
+		delete(m, k)
+		return
+	}
+	m[k] = r.mask
+}
+
+// AuditRecord masks the value of a record whose Detail is a name=value parameter write.
+func (r *Redactor) AuditRecord(rec AuditRecord) AuditRecord {
+	if name, _, ok := strings.Cut(rec.Detail, "="); ok && r.Sensitive(name) {
+		rec.Detail = name
+		if !r.strip {
+			rec.Detail += "=" + r.mask
+		}
+	}
+	return rec
+}
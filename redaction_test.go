@@ -0,0 +1,59 @@
+package devicemgr
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRedactorJSON(t *testing.T) {
+	r := NewRedactor(RedactionConfig{})
+	var v interface{}
+	json.Unmarshal([]byte(`{
+		"changes": [
+			{"name": "Device.WiFi.AccessPoint.1.Security.KeyPassphrase", "value": "hunter22"},
+			{"name": "Device.DeviceInfo.UpTime", "value": 42}
+		],
+		"notifyPayload": {"paramName": "Device.Users.User.1.password", "paramValue": "pw"},
+		"varbinds": {"X_Auth_Token": "abc", "sysName": "gw"}
+	}`), &v)
+	if !r.JSON(v) {
+		t.Fatal("nothing masked")
+	}
+	b, _ := json.Marshal(v)
+	want := `{"changes":[{"name":"Device.WiFi.AccessPoint.1.Security.KeyPassphrase","value":"[REDACTED]"},{"name":"Device.DeviceInfo.UpTime","value":42}],` +
+		`"notifyPayload":{"paramName":"Device.Users.User.1.password","paramValue":"[REDACTED]"},"varbinds":{"X_Auth_Token":"[REDACTED]","sysName":"gw"}}`
+	if string(b) != want {
+		t.Fatalf("got %s", b)
+	}
+
+	strip := NewRedactor(RedactionConfig{Parameters: []string{"Device.WiFi.*.KeyPassphrase"}, Strip: true})
+	json.Unmarshal([]byte(`{"parameter":"Device.WiFi.AccessPoint.1.Security.KeyPassphrase","expected":"a","actual":"b","profile":"home"}`), &v)
+	if !strip.JSON(v) {
+		t.Fatal("drift not masked")
+	}
+	if b, _ := json.Marshal(v); string(b) != `{"parameter":"Device.WiFi.AccessPoint.1.Security.KeyPassphrase","profile":"home"}` {
+		t.Fatalf("stripped %s", b)
+	}
+	if strip.Sensitive("Device.Users.User.1.Password") {
+		t.Fatal("configured patterns replace the defaults")
+	}
+	if NewRedactor(RedactionConfig{Parameters: []string{}}) != nil {
+		t.Fatal("an empty pattern list should disable redaction")
+	}
+}
+
+func TestRedactorAuditRecord(t *testing.T) {
+	r := NewRedactor(RedactionConfig{Mask: "***"})
+	rec := r.AuditRecord(AuditRecord{Action: "reboot", Detail: "Device.X_CISCO_COM_DeviceControl.RebootDevice=Device"})
+	if rec.Detail != "Device.X_CISCO_COM_DeviceControl.RebootDevice=Device" {
+		t.Fatalf("insensitive detail changed: %s", rec.Detail)
+	}
+	rec = r.AuditRecord(AuditRecord{Action: "set", Detail: "Device.WiFi.AccessPoint.1.Security.PreSharedKey=secret"})
+	if rec.Detail != "Device.WiFi.AccessPoint.1.Security.PreSharedKey=***" {
+		t.Fatalf("detail %s", rec.Detail)
+	}
+	var nilRedactor *Redactor
+	if rec := nilRedactor.AuditRecord(AuditRecord{Detail: "a.Password=x"}); rec.Detail != "a.Password=x" {
+		t.Fatalf("nil redactor changed %s", rec.Detail)
+	}
+}
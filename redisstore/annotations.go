@@ -0,0 +1,69 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+)
+
+// AnnotationStore keeps device annotations in one hash (<prefix>annotations) keyed by device.
+type AnnotationStore struct {
+	rdb redis.UniversalClient
+	key string
+}
+
+var _ annotation.Store = (*AnnotationStore)(nil)
+
+func NewAnnotationStore(rdb redis.UniversalClient, prefix string) *AnnotationStore {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &AnnotationStore{rdb: rdb, key: prefix + "annotations"}
+}
+
+func (s *AnnotationStore) Get(ctx context.Context, device dm.DeviceID) (annotation.Annotations, bool, error) {
+	var a annotation.Annotations
+	b, err := s.rdb.HGet(ctx, s.key, string(device)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return a, false, nil
+	}
+	if err != nil {
+		return a, false, err
+	}
+	if err := json.Unmarshal(b, &a); err != nil {
+		return a, false, err
+	}
+	return a, true, nil
+}
+
+func (s *AnnotationStore) Put(ctx context.Context, a annotation.Annotations) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return s.rdb.HSet(ctx, s.key, string(a.Device), b).Err()
+}
+
+func (s *AnnotationStore) Delete(ctx context.Context, device dm.DeviceID) error {
+	return s.rdb.HDel(ctx, s.key, string(device)).Err()
+}
+
+func (s *AnnotationStore) All(ctx context.Context) (map[dm.DeviceID]annotation.Annotations, error) {
+	all, err := s.rdb.HGetAll(ctx, s.key).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[dm.DeviceID]annotation.Annotations, len(all))
+	for id, v := range all {
+		var a annotation.Annotations
+		if err := json.Unmarshal([]byte(v), &a); err != nil {
+			continue
+		}
+		out[dm.DeviceID(id)] = a
+	}
+	return out, nil
+}
@@ -0,0 +1,43 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// ArtifactStore keeps job artifacts in one key each (<prefix>artifact:<job>/<name>), expiring
+// after a TTL since jobs themselves do not outlive the process.
+type ArtifactStore struct {
+	rdb    redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+var _ dm.ArtifactStore = (*ArtifactStore)(nil)
+
+// NewArtifactStore keeps artifacts for ttl; zero or less uses dm.DefaultArtifactTTL.
+func NewArtifactStore(rdb redis.UniversalClient, prefix string, ttl time.Duration) *ArtifactStore {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	if ttl <= 0 {
+		ttl = dm.DefaultArtifactTTL
+	}
+	return &ArtifactStore{rdb: rdb, prefix: prefix + "artifact:", ttl: ttl}
+}
+
+func (s *ArtifactStore) Put(ctx context.Context, key string, data []byte) error {
+	return s.rdb.Set(ctx, s.prefix+key, data, s.ttl).Err()
+}
+
+func (s *ArtifactStore) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := s.rdb.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, dm.ErrArtifactNotFound
+	}
+	return b, err
+}
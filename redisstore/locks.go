@@ -0,0 +1,120 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// LockStore keeps each device's configuration lock in a hash (<prefix>config-locks:<device>)
+// holding the owner and acquisition time, expiring with the lease, so every replica enforces
+// the same locks.
+type LockStore struct {
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+var _ dm.LockStore = (*LockStore)(nil)
+
+func NewLockStore(rdb redis.UniversalClient, prefix string) *LockStore {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &LockStore{rdb: rdb, prefix: prefix + "config-locks:"}
+}
+
+// leaseScript takes (ARGV[4] == "1") or extends the lease of owner ARGV[1], acquired at
+// ARGV[2] (Unix ms), for ARGV[3] ms. It answers {held, owner, acquired at, ms left}: the new
+// lease, or the lease of another owner (or none) refusing it.
+var leaseScript = redis.NewScript(`
+local owner = redis.call("HGET", KEYS[1], "owner")
+if not owner then
+  if ARGV[4] ~= "1" then return {0, "", "0", 0} end
+  redis.call("HSET", KEYS[1], "owner", ARGV[1], "acquiredAt", ARGV[2])
+elseif owner ~= ARGV[1] then
+  return {0, owner, redis.call("HGET", KEYS[1], "acquiredAt"), redis.call("PTTL", KEYS[1])}
+end
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return {1, ARGV[1], redis.call("HGET", KEYS[1], "acquiredAt"), tonumber(ARGV[3])}`)
+
+// unlockScript deletes the lock when held by ARGV[1], or by anyone for an empty ARGV[1].
+var unlockScript = redis.NewScript(`
+local owner = redis.call("HGET", KEYS[1], "owner")
+if owner and (ARGV[1] == "" or owner == ARGV[1]) then
+  return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+func (s *LockStore) Acquire(ctx context.Context, l dm.ConfigLock) (dm.ConfigLock, bool, error) {
+	return s.lease(ctx, l.DeviceID, l.Owner, l.AcquiredAt, l.ExpiresAt, true)
+}
+
+func (s *LockStore) Renew(ctx context.Context, id dm.DeviceID, owner string, expiresAt time.Time) (dm.ConfigLock, bool, error) {
+	l, ok, err := s.lease(ctx, id, owner, time.Now(), expiresAt, false)
+	if !ok {
+		l = dm.ConfigLock{}
+	}
+	return l, ok, err
+}
+
+func (s *LockStore) lease(ctx context.Context, id dm.DeviceID, owner string, acquiredAt, expiresAt time.Time, create bool) (dm.ConfigLock, bool, error) {
+	ttl := time.Until(expiresAt).Milliseconds()
+	if ttl <= 0 {
+		return dm.ConfigLock{}, false, errors.New("redisstore: lock lease already expired")
+	}
+	flag := "0"
+	if create {
+		flag = "1"
+	}
+	res, err := leaseScript.Run(ctx, s.rdb, []string{s.prefix + string(id)}, owner, acquiredAt.UnixMilli(), ttl, flag).Slice()
+	if err != nil {
+		return dm.ConfigLock{}, false, err
+	}
+	return lockReply(id, res)
+}
+
+func (s *LockStore) Get(ctx context.Context, id dm.DeviceID) (dm.ConfigLock, bool, error) {
+	key := s.prefix + string(id)
+	var fields *redis.MapStringStringCmd
+	var left *redis.DurationCmd
+	_, err := s.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		fields = p.HGetAll(ctx, key)
+		left = p.PTTL(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return dm.ConfigLock{}, false, err
+	}
+	f := fields.Val()
+	if f["owner"] == "" || left.Val() <= 0 {
+		return dm.ConfigLock{}, false, nil
+	}
+	acquired, _ := strconv.ParseInt(f["acquiredAt"], 10, 64)
+	return dm.ConfigLock{DeviceID: id, Owner: f["owner"], AcquiredAt: time.UnixMilli(acquired).UTC(), ExpiresAt: time.Now().Add(left.Val()).UTC()}, true, nil
+}
+
+func (s *LockStore) Release(ctx context.Context, id dm.DeviceID, owner string) (bool, error) {
+	n, err := unlockScript.Run(ctx, s.rdb, []string{s.prefix + string(id)}, owner).Int()
+	return n == 1, err
+}
+
+// lockReply decodes a leaseScript reply.
+func lockReply(id dm.DeviceID, res []interface{}) (dm.ConfigLock, bool, error) {
+	if len(res) != 4 {
+		return dm.ConfigLock{}, false, errors.New("redisstore: unexpected lock reply")
+	}
+	held, _ := res[0].(int64)
+	owner, _ := res[1].(string)
+	if owner == "" {
+		return dm.ConfigLock{}, false, nil
+	}
+	acquiredAt, _ := res[2].(string)
+	left, _ := res[3].(int64)
+	ms, _ := strconv.ParseInt(acquiredAt, 10, 64)
+	l := dm.ConfigLock{DeviceID: id, Owner: owner, AcquiredAt: time.UnixMilli(ms).UTC(), ExpiresAt: time.Now().Add(time.Duration(left) * time.Millisecond).UTC()}
+	return l, held == 1, nil
+}
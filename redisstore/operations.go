@@ -0,0 +1,64 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// OperationLog keeps each device's recent audit records in a capped list (<prefix>ops:<device>),
+// newest first, so every replica serves the same operation history.
+type OperationLog struct {
+	rdb    redis.UniversalClient
+	prefix string
+	max    int64
+}
+
+var _ dm.OperationLog = (*OperationLog)(nil)
+
+// NewOperationLog keeps perDevice records per device; zero or less uses dm.DefaultOperationHistory.
+func NewOperationLog(rdb redis.UniversalClient, prefix string, perDevice int) *OperationLog {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	if perDevice <= 0 {
+		perDevice = dm.DefaultOperationHistory
+	}
+	return &OperationLog{rdb: rdb, prefix: prefix + "ops:", max: int64(perDevice)}
+}
+
+func (l *OperationLog) Record(ctx context.Context, r dm.AuditRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	key := l.prefix + string(r.DeviceID)
+	_, err = l.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.LPush(ctx, key, b)
+		p.LTrim(ctx, key, 0, l.max-1)
+		return nil
+	})
+	return err
+}
+
+func (l *OperationLog) Recent(ctx context.Context, id dm.DeviceID, limit int) ([]dm.AuditRecord, error) {
+	stop := int64(limit) - 1
+	if limit <= 0 {
+		stop = -1
+	}
+	raw, err := l.rdb.LRange(ctx, l.prefix+string(id), 0, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]dm.AuditRecord, 0, len(raw))
+	for _, v := range raw {
+		var r dm.AuditRecord
+		if err := json.Unmarshal([]byte(v), &r); err != nil {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
@@ -0,0 +1,76 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/snapshot"
+)
+
+// ParamSnapshotStore keeps parameter snapshots in one hash per device (<prefix>paramsnap:<device>).
+type ParamSnapshotStore struct {
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+var _ snapshot.Store = (*ParamSnapshotStore)(nil)
+
+func NewParamSnapshotStore(rdb redis.UniversalClient, prefix string) *ParamSnapshotStore {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &ParamSnapshotStore{rdb: rdb, prefix: prefix + "paramsnap:"}
+}
+
+func (s *ParamSnapshotStore) Save(ctx context.Context, snap snapshot.Snapshot) error {
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return s.rdb.HSet(ctx, s.prefix+string(snap.Device), snap.ID, b).Err()
+}
+
+func (s *ParamSnapshotStore) Get(ctx context.Context, device dm.DeviceID, id string) (snapshot.Snapshot, error) {
+	var snap snapshot.Snapshot
+	b, err := s.rdb.HGet(ctx, s.prefix+string(device), id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return snap, snapshot.ErrSnapshotNotFound
+	}
+	if err != nil {
+		return snap, err
+	}
+	err = json.Unmarshal(b, &snap)
+	return snap, err
+}
+
+func (s *ParamSnapshotStore) List(ctx context.Context, device dm.DeviceID) ([]snapshot.Snapshot, error) {
+	all, err := s.rdb.HGetAll(ctx, s.prefix+string(device)).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]snapshot.Snapshot, 0, len(all))
+	for _, v := range all {
+		var snap snapshot.Snapshot
+		if err := json.Unmarshal([]byte(v), &snap); err != nil {
+			continue
+		}
+		snap.Parameters = nil
+		out = append(out, snap)
+	}
+	snapshot.SortNewestFirst(out)
+	return out, nil
+}
+
+func (s *ParamSnapshotStore) Delete(ctx context.Context, device dm.DeviceID, id string) error {
+	n, err := s.rdb.HDel(ctx, s.prefix+string(device), id).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return snapshot.ErrSnapshotNotFound
+	}
+	return nil
+}
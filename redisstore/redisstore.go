@@ -0,0 +1,184 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/cache"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// DefaultPrefix namespaces every key written by this package.
+const DefaultPrefix = "devicemgr:"
+
+// opTimeout bounds cache operations, which have no caller context (cache.Cache is synchronous).
+const opTimeout = 500 * time.Millisecond
+
+// Open parses a redis:// URL and returns a client.
+func Open(rawURL string) (*redis.Client, error) {
+	o, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return redis.NewClient(o), nil
+}
+
+// Cache is a cache.Cache backed by Redis so replicas share entries. Values are JSON encoded and
+// expire server-side after ttl. Redis errors degrade to cache misses.
+type Cache[V any] struct {
+	rdb    redis.UniversalClient
+	prefix string
+	ttl    atomic.Int64 // time.Duration
+}
+
+var _ cache.Cache[int] = (*Cache[int])(nil)
+
+type cacheEntry[V any] struct {
+	Value    V         `json:"v"`
+	StoredAt time.Time `json:"t"`
+}
+
+// NewCache creates a Redis cache; name distinguishes caches sharing one prefix (e.g. "params").
+// A non-positive ttl disables caching, matching cache.TTL.
+func NewCache[V any](rdb redis.UniversalClient, prefix, name string, ttl time.Duration) *Cache[V] {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	c := &Cache[V]{rdb: rdb, prefix: prefix + name + ":"}
+	c.SetTTL(ttl)
+	return c
+}
+
+// SetTTL changes the lifetime of new entries; stored entries older than ttl read as misses
+// until Redis expires them.
+func (c *Cache[V]) SetTTL(ttl time.Duration) { c.ttl.Store(int64(ttl)) }
+
+func (c *Cache[V]) Get(key string) (v V, storedAt time.Time, ok bool) {
+	ttl := time.Duration(c.ttl.Load())
+	if ttl <= 0 {
+		return v, storedAt, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	b, err := c.rdb.Get(ctx, c.prefix+key).Bytes()
+	if err != nil {
+		return v, storedAt, false
+	}
+	var e cacheEntry[V]
+	if err := json.Unmarshal(b, &e); err != nil || time.Since(e.StoredAt) > ttl {
+		return v, storedAt, false
+	}
+	return e.Value, e.StoredAt, true
+}
+
+func (c *Cache[V]) Set(key string, value V) {
+	ttl := time.Duration(c.ttl.Load())
+	if ttl <= 0 {
+		return
+	}
+	b, err := json.Marshal(cacheEntry[V]{Value: value, StoredAt: time.Now()})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	_ = c.rdb.Set(ctx, c.prefix+key, b, ttl).Err()
+}
+
+func (c *Cache[V]) Delete(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	_ = c.rdb.Del(ctx, c.prefix+key).Err()
+}
+
+// SnapshotStore shares the device poll snapshot between replicas.
+type SnapshotStore struct {
+	rdb redis.UniversalClient
+	key string
+}
+
+var _ runtime.SnapshotStore = (*SnapshotStore)(nil)
+
+var _ dm.Elector = (*Lock)(nil)
+
+// NewSnapshotStore stores the snapshot under <prefix>snapshot.
+func NewSnapshotStore(rdb redis.UniversalClient, prefix string) *SnapshotStore {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &SnapshotStore{rdb: rdb, key: prefix + "snapshot"}
+}
+
+func (s *SnapshotStore) SaveSnapshot(ctx context.Context, snap runtime.DeviceSnapshot) error {
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, s.key, b, 0).Err()
+}
+
+func (s *SnapshotStore) LoadSnapshot(ctx context.Context) (*runtime.DeviceSnapshot, error) {
+	b, err := s.rdb.Get(ctx, s.key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snap runtime.DeviceSnapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// renewScript extends the lock only when still held by this owner.
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseScript deletes the lock only when still held by this owner.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Lock is a single-key leader lock (SET NX PX with owner-checked renew/release) implementing
+// devicemgr.Elector. Campaign must run more often than ttl; whichever replica holds the key leads.
+type Lock struct {
+	rdb   redis.UniversalClient
+	key   string
+	owner string
+	ttl   time.Duration
+}
+
+// NewLock creates a lock on <prefix><name> identified by owner (e.g. hostname).
+func NewLock(rdb redis.UniversalClient, prefix, name, owner string, ttl time.Duration) *Lock {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &Lock{rdb: rdb, key: prefix + "lock:" + name, owner: owner, ttl: ttl}
+}
+
+// Campaign takes the lock if free or renews it if already held; it reports whether this owner holds it.
+func (l *Lock) Campaign(ctx context.Context) (bool, error) {
+	ok, err := l.rdb.SetNX(ctx, l.key, l.owner, l.ttl).Result()
+	if err != nil || ok {
+		return ok, err
+	}
+	n, err := renewScript.Run(ctx, l.rdb, []string{l.key}, l.owner, l.ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// Resign gives up the lock if held by this owner.
+func (l *Lock) Resign(ctx context.Context) error {
+	return releaseScript.Run(ctx, l.rdb, []string{l.key}, l.owner).Err()
+}
@@ -0,0 +1,253 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/annotation"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+	"github.com/xmidt-org/talaria/devicemgr/snapshot"
+)
+
+func newClient(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	return mr, redis.NewClient(&redis.Options{Addr: mr.Addr()})
+}
+
+func TestCacheSharedBetweenInstances(t *testing.T) {
+	mr, rdb := newClient(t)
+	a := NewCache[map[string]int](rdb, "", "params", time.Minute)
+	b := NewCache[map[string]int](rdb, "", "params", time.Minute)
+	a.Set("k", map[string]int{"x": 1})
+	v, storedAt, ok := b.Get("k")
+	if !ok || v["x"] != 1 || storedAt.IsZero() {
+		t.Fatalf("expected shared entry, got %v %v %v", v, storedAt, ok)
+	}
+	mr.FastForward(2 * time.Minute)
+	if _, _, ok := b.Get("k"); ok {
+		t.Fatalf("expected entry to expire")
+	}
+	a.Set("k", map[string]int{"x": 2})
+	a.Delete("k")
+	if _, _, ok := b.Get("k"); ok {
+		t.Fatalf("expected entry to be deleted")
+	}
+}
+
+func TestSnapshotStore(t *testing.T) {
+	_, rdb := newClient(t)
+	s := NewSnapshotStore(rdb, "")
+	ctx := context.Background()
+	if snap, err := s.LoadSnapshot(ctx); err != nil || snap != nil {
+		t.Fatalf("expected empty store, got %v %v", snap, err)
+	}
+	want := runtime.DeviceSnapshot{IDs: []string{"mac:aa"}, Metadata: map[string]map[string]string{"mac:aa": {"partner-ids": "p"}}, PolledAt: time.Now().UTC()}
+	if err := s.SaveSnapshot(ctx, want); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	got, err := s.LoadSnapshot(ctx)
+	if err != nil || len(got.IDs) != 1 || got.Metadata["mac:aa"]["partner-ids"] != "p" || !got.PolledAt.Equal(want.PolledAt) {
+		t.Fatalf("unexpected snapshot %+v err %v", got, err)
+	}
+}
+
+func TestLockSingleHolder(t *testing.T) {
+	mr, rdb := newClient(t)
+	ctx := context.Background()
+	a := NewLock(rdb, "", "poll", "a", 10*time.Second)
+	b := NewLock(rdb, "", "poll", "b", 10*time.Second)
+	if ok, err := a.Campaign(ctx); !ok || err != nil {
+		t.Fatalf("a should acquire: %v %v", ok, err)
+	}
+	if ok, _ := b.Campaign(ctx); ok {
+		t.Fatalf("b must not acquire while a holds the lock")
+	}
+	if ok, _ := a.Campaign(ctx); !ok {
+		t.Fatalf("a should renew")
+	}
+	if err := b.Resign(ctx); err != nil {
+		t.Fatalf("release by non-owner: %v", err)
+	}
+	if ok, _ := b.Campaign(ctx); ok {
+		t.Fatalf("non-owner release must not free the lock")
+	}
+	mr.FastForward(11 * time.Second)
+	if ok, _ := b.Campaign(ctx); !ok {
+		t.Fatalf("b should take over after expiry")
+	}
+}
+
+func TestParamSnapshotStore(t *testing.T) {
+	_, rdb := newClient(t)
+	ctx := context.Background()
+	s := NewParamSnapshotStore(rdb, "")
+	older := snapshot.Snapshot{ID: "a", Device: "mac:aa", Parameters: map[string]snapshot.Value{"Device.X": {Value: "1"}}, TakenAt: time.Unix(100, 0)}
+	newer := snapshot.Snapshot{ID: "b", Device: "mac:aa", TakenAt: time.Unix(200, 0)}
+	for _, snap := range []snapshot.Snapshot{older, newer} {
+		if err := s.Save(ctx, snap); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	got, err := s.Get(ctx, "mac:aa", "a")
+	if err != nil || got.Parameters["Device.X"].Value != "1" {
+		t.Fatalf("Get: %+v %v", got, err)
+	}
+	list, err := s.List(ctx, "mac:aa")
+	if err != nil || len(list) != 2 || list[0].ID != "b" || list[1].Parameters != nil {
+		t.Fatalf("List: %+v %v", list, err)
+	}
+	if err := s.Delete(ctx, "mac:aa", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "mac:aa", "a"); err != snapshot.ErrSnapshotNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if err := s.Delete(ctx, "mac:aa", "a"); err != snapshot.ErrSnapshotNotFound {
+		t.Fatalf("expected not found on second delete, got %v", err)
+	}
+}
+
+func TestAnnotationStore(t *testing.T) {
+	_, rdb := newClient(t)
+	ctx := context.Background()
+	s := NewAnnotationStore(rdb, "")
+	if _, ok, err := s.Get(ctx, "mac:aa"); ok || err != nil {
+		t.Fatalf("Get before Put: %v %v", ok, err)
+	}
+	a := annotation.Annotations{Device: "mac:aa", Tickets: []string{"OPS-1"}, Labels: map[string]string{"site": "lab"}}
+	if err := s.Put(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := s.Get(ctx, "mac:aa")
+	if !ok || err != nil || got.Labels["site"] != "lab" || got.Tickets[0] != "OPS-1" {
+		t.Fatalf("Get: %+v %v %v", got, ok, err)
+	}
+	if all, err := s.All(ctx); err != nil || len(all) != 1 || all["mac:aa"].Labels["site"] != "lab" {
+		t.Fatalf("All: %+v %v", all, err)
+	}
+	if err := s.Delete(ctx, "mac:aa"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.Get(ctx, "mac:aa"); ok {
+		t.Fatal("expected no annotations after Delete")
+	}
+}
+
+func TestOperationLog(t *testing.T) {
+	_, rdb := newClient(t)
+	ctx := context.Background()
+	log := NewOperationLog(rdb, "", 2)
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, action := range []string{"get", "set", "reboot"} {
+		r := dm.AuditRecord{Time: at.Add(time.Duration(i) * time.Second), Action: action, DeviceID: "mac:aa", Actor: "alice", Role: dm.RoleOperator, Duration: 1500 * time.Millisecond}
+		if action == "reboot" {
+			r.Err = errors.New("device offline")
+		}
+		if err := log.Record(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recs, err := log.Recent(ctx, "mac:aa", 0)
+	if err != nil || len(recs) != 2 {
+		t.Fatalf("recent: %+v %v", recs, err)
+	}
+	if r := recs[0]; r.Action != "reboot" || r.Err == nil || r.Err.Error() != "device offline" || r.Role != dm.RoleOperator || r.Duration != 1500*time.Millisecond || !r.Time.Equal(at.Add(2*time.Second)) {
+		t.Fatalf("newest: %+v", r)
+	}
+	if recs[1].Action != "set" || recs[1].Err != nil {
+		t.Fatalf("second: %+v", recs[1])
+	}
+	if recs, _ := log.Recent(ctx, "mac:aa", 1); len(recs) != 1 {
+		t.Fatalf("limit: %+v", recs)
+	}
+}
+
+func TestArtifactStore(t *testing.T) {
+	mr, rdb := newClient(t)
+	s := NewArtifactStore(rdb, "", time.Hour)
+	ctx := context.Background()
+	if err := s.Put(ctx, "job/results.jsonl", []byte("{}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := s.Get(ctx, "job/results.jsonl"); err != nil || string(b) != "{}\n" {
+		t.Fatalf("got %q %v", b, err)
+	}
+	mr.FastForward(2 * time.Hour)
+	if _, err := s.Get(ctx, "job/results.jsonl"); !errors.Is(err, dm.ErrArtifactNotFound) {
+		t.Fatalf("expected expired artifact, got %v", err)
+	}
+}
+
+func TestSubscriptionStore(t *testing.T) {
+	_, rdb := newClient(t)
+	a, b := NewSubscriptionStore(rdb, ""), NewSubscriptionStore(rdb, "")
+	ctx := context.Background()
+	until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	if err := a.Put(ctx, dm.Subscription{Kind: dm.SubscriptionWebhook, ID: "w1", Until: until, Spec: []byte(`{"url":"http://x"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Put(ctx, dm.Subscription{Kind: dm.SubscriptionTopic, ID: "t1", Spec: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	subs, err := b.List(ctx, dm.SubscriptionWebhook)
+	if err != nil || len(subs) != 1 || subs[0].ID != "w1" || !subs[0].Until.Equal(until) || string(subs[0].Spec) != `{"url":"http://x"}` {
+		t.Fatalf("got %+v %v", subs, err)
+	}
+	if err := b.Delete(ctx, dm.SubscriptionWebhook, "w1"); err != nil {
+		t.Fatal(err)
+	}
+	if subs, _ := a.List(ctx, dm.SubscriptionWebhook); len(subs) != 0 {
+		t.Fatalf("expected deletion, got %+v", subs)
+	}
+	if subs, _ := a.List(ctx, dm.SubscriptionTopic); len(subs) != 1 {
+		t.Fatalf("expected the topic binding to stay, got %+v", subs)
+	}
+}
+
+func TestLockStore(t *testing.T) {
+	mr, rdb := newClient(t)
+	ctx := context.Background()
+	a, b := NewLockStore(rdb, ""), NewLockStore(rdb, "")
+	now := time.Now().UTC()
+	l, ok, err := a.Acquire(ctx, dm.ConfigLock{DeviceID: "mac:aa", Owner: "ci", AcquiredAt: now, ExpiresAt: now.Add(time.Minute)})
+	if err != nil || !ok || l.Owner != "ci" {
+		t.Fatalf("acquire = %+v %v %v", l, ok, err)
+	}
+	// another replica sees the lock and refuses other owners
+	held, ok, err := b.Acquire(ctx, dm.ConfigLock{DeviceID: "mac:aa", Owner: "other", AcquiredAt: now, ExpiresAt: now.Add(time.Minute)})
+	if err != nil || ok || held.Owner != "ci" || held.AcquiredAt.UnixMilli() != now.UnixMilli() {
+		t.Fatalf("foreign acquire = %+v %v %v", held, ok, err)
+	}
+	if _, ok, _ := b.Renew(ctx, "mac:aa", "other", now.Add(time.Hour)); ok {
+		t.Fatal("renewed another owner's lock")
+	}
+	renewed, ok, err := b.Renew(ctx, "mac:aa", "ci", time.Now().Add(time.Hour))
+	if err != nil || !ok || time.Until(renewed.ExpiresAt) < 59*time.Minute || renewed.AcquiredAt.UnixMilli() != now.UnixMilli() {
+		t.Fatalf("renew = %+v %v %v", renewed, ok, err)
+	}
+	if got, ok, err := b.Get(ctx, "mac:aa"); err != nil || !ok || got.Owner != "ci" {
+		t.Fatalf("get = %+v %v %v", got, ok, err)
+	}
+	if ok, _ := b.Release(ctx, "mac:aa", "other"); ok {
+		t.Fatal("released another owner's lock")
+	}
+	mr.FastForward(61 * time.Minute)
+	if _, ok, _ := a.Get(ctx, "mac:aa"); ok {
+		t.Fatal("lease outlived its ttl")
+	}
+	if _, ok, _ := b.Acquire(ctx, dm.ConfigLock{DeviceID: "mac:aa", Owner: "other", AcquiredAt: now, ExpiresAt: time.Now().Add(time.Minute)}); !ok {
+		t.Fatal("acquire after expiry refused")
+	}
+	if ok, err := a.Release(ctx, "mac:aa", ""); err != nil || !ok {
+		t.Fatalf("forced release = %v %v", ok, err)
+	}
+	if _, ok, _ := a.Renew(ctx, "mac:aa", "other", time.Now().Add(time.Minute)); ok {
+		t.Fatal("renew revived a released lock")
+	}
+}
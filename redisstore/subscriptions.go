@@ -0,0 +1,53 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// SubscriptionStore keeps subscriptions in one hash per kind (<prefix>subscriptions:<kind>) keyed
+// by ID. Expired ones stay until their component deletes them on restore.
+type SubscriptionStore struct {
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+var _ dm.SubscriptionStore = (*SubscriptionStore)(nil)
+
+func NewSubscriptionStore(rdb redis.UniversalClient, prefix string) *SubscriptionStore {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &SubscriptionStore{rdb: rdb, prefix: prefix + "subscriptions:"}
+}
+
+func (s *SubscriptionStore) Put(ctx context.Context, sub dm.Subscription) error {
+	b, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	return s.rdb.HSet(ctx, s.prefix+string(sub.Kind), sub.ID, b).Err()
+}
+
+func (s *SubscriptionStore) Delete(ctx context.Context, kind dm.SubscriptionKind, id string) error {
+	return s.rdb.HDel(ctx, s.prefix+string(kind), id).Err()
+}
+
+func (s *SubscriptionStore) List(ctx context.Context, kind dm.SubscriptionKind) ([]dm.Subscription, error) {
+	all, err := s.rdb.HGetAll(ctx, s.prefix+string(kind)).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]dm.Subscription, 0, len(all))
+	for _, v := range all {
+		var sub dm.Subscription
+		if err := json.Unmarshal([]byte(v), &sub); err != nil {
+			continue
+		}
+		out = append(out, sub)
+	}
+	return out, nil
+}
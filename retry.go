@@ -0,0 +1,163 @@
+package devicemgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy retries idempotent backend requests that fail transiently. The zero value makes a
+// single attempt; DefaultRetryPolicy is what Options uses.
+type RetryPolicy struct {
+	MaxAttempts int           // attempts including the first; values below 2 disable retries
+	Backoff     time.Duration // delay before the first retry, doubled for each further one
+	MaxBackoff  time.Duration // caps the doubled delay; zero leaves it uncapped
+	Jitter      float64       // fraction (0..1) of each delay randomized away, spreading out retries
+	// Retryable reports whether a failed attempt may be retried; nil uses Retryable.
+	Retryable func(error) bool
+	// MaxRetryAfter is the longest Retry-After (see BackendError) a retry waits out; a backend
+	// asking for more fails the request at once. Zero uses DefaultMaxRetryAfter.
+	MaxRetryAfter time.Duration
+}
+
+// DefaultMaxRetryAfter is the longest backend-requested wait RetryPolicy.Do honors by default.
+const DefaultMaxRetryAfter = 10 * time.Second
+
+// DefaultRetryPolicy makes up to three attempts, 200ms then 400ms apart (less up to 20% jitter).
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3, Backoff: 200 * time.Millisecond, MaxBackoff: 5 * time.Second, Jitter: 0.2}
+}
+
+// Retryable is the default classifier: backend unavailability, timeouts and network errors are
+// transient; cancellation of the caller's context and every other error are not.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrBackendUnavailable) || errors.Is(err, ErrTimeout) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// Delay returns the wait before retry n (1 for the first retry).
+func (p RetryPolicy) Delay(n int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < n && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 && d > 0 {
+		d -= time.Duration(float64(d) * min(p.Jitter, 1) * rand.Float64())
+	}
+	return d
+}
+
+// Do calls fn until it succeeds, returns an error the policy does not retry, or MaxAttempts is
+// reached, waiting Delay between attempts. A failure carrying a Retry-After waits at least that
+// long, and is returned without another attempt when the wait exceeds MaxRetryAfter or would
+// outlast ctx. It returns the last error, including when ctx ends during a wait.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = Retryable
+	}
+	maxAfter := p.MaxRetryAfter
+	if maxAfter <= 0 {
+		maxAfter = DefaultMaxRetryAfter
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+		wait := p.Delay(attempt)
+		if after, ok := RetryAfter(err); ok {
+			if after > maxAfter {
+				return err
+			}
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < after {
+				return err
+			}
+			wait = max(wait, after)
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// BackendError is an error status from a backend. 429 and 5xx statuses unwrap to
+// ErrBackendUnavailable, and RetryAfter holds the wait the backend asked for, if any.
+type BackendError struct {
+	Backend    string // "talaria", "tr1d1um", "xconfadmin", ...
+	Status     int
+	RetryAfter time.Duration // zero when the response had no Retry-After
+}
+
+func (e *BackendError) Error() string {
+	msg := fmt.Sprintf("%s: unexpected status %d", e.Backend, e.Status)
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %s)", e.RetryAfter)
+	}
+	if e.Unwrap() != nil {
+		msg += ": " + ErrBackendUnavailable.Error()
+	}
+	return msg
+}
+
+func (e *BackendError) Unwrap() error {
+	if e.Status == http.StatusTooManyRequests || e.Status >= 500 {
+		return ErrBackendUnavailable
+	}
+	return nil
+}
+
+// NewBackendError describes a failed response from backend, reading its Retry-After header.
+func NewBackendError(backend string, resp *http.Response) *BackendError {
+	e := &BackendError{Backend: backend, Status: resp.StatusCode}
+	e.RetryAfter, _ = ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	return e
+}
+
+// ParseRetryAfter reads a Retry-After header value, either delay-seconds or an HTTP date
+// (measured from now). Dates in the past give a zero wait.
+func ParseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	return max(t.Sub(now), 0), true
+}
+
+// RetryAfter returns the wait a backend asked for in err's chain.
+func RetryAfter(err error) (time.Duration, bool) {
+	var be *BackendError
+	if errors.As(err, &be) && be.RetryAfter > 0 {
+		return be.RetryAfter, true
+	}
+	return 0, false
+}
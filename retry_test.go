@@ -0,0 +1,125 @@
+package devicemgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	for n, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond, 10: 300 * time.Millisecond} {
+		if got := p.Delay(n); got != want {
+			t.Errorf("Delay(%d) = %s, want %s", n, got, want)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		if d := p.Delay(1); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("jittered delay %s outside [50ms, 100ms]", d)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	calls := 0
+	err := p.Do(context.Background(), func() error {
+		if calls++; calls < 3 {
+			return fmt.Errorf("tr1d1um: %w", ErrBackendUnavailable)
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("err %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	if err := p.Do(context.Background(), func() error { calls++; return ErrAccessDenied }); !errors.Is(err, ErrAccessDenied) || calls != 1 {
+		t.Fatalf("non-retryable error retried: %v after %d calls", err, calls)
+	}
+	calls = 0
+	if err := p.Do(context.Background(), func() error { calls++; return ErrTimeout }); !errors.Is(err, ErrTimeout) || calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d (%v)", calls, err)
+	}
+	calls = 0
+	if err := (RetryPolicy{}).Do(context.Background(), func() error { calls++; return ErrTimeout }); err == nil || calls != 1 {
+		t.Fatalf("zero policy made %d attempts", calls)
+	}
+
+	// a custom classifier, and a context ending during the wait
+	p = RetryPolicy{MaxAttempts: 5, Backoff: time.Hour, Retryable: func(err error) bool { return errors.Is(err, ErrConflict) }}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	calls = 0
+	if err := p.Do(ctx, func() error { calls++; return ErrConflict }); !errors.Is(err, ErrConflict) || calls != 1 {
+		t.Fatalf("expected to stop waiting when ctx ends: %v after %d calls", err, calls)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	cases := map[error]bool{
+		ErrBackendUnavailable:                                           true,
+		fmt.Errorf("poll: %w", ErrTimeout):                              true,
+		&net.OpError{Op: "dial", Err: errors.New("connection refused")}: true,
+		context.Canceled:                                                false,
+		fmt.Errorf("get: %w", context.DeadlineExceeded):                 false,
+		ErrDeviceNotFound:                                               false,
+		nil:                                                             false,
+	}
+	for err, want := range cases {
+		if got := Retryable(err); got != want {
+			t.Errorf("Retryable(%v) = %v", err, got)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for v, want := range map[string]time.Duration{
+		"120":                           2 * time.Minute,
+		"0":                             0,
+		"Wed, 01 May 2024 12:00:30 GMT": 30 * time.Second,
+		"Wed, 01 May 2024 11:00:00 GMT": 0,
+	} {
+		if got, ok := ParseRetryAfter(v, now); !ok || got != want {
+			t.Errorf("ParseRetryAfter(%q) = %s, %v; want %s", v, got, ok, want)
+		}
+	}
+	for _, v := range []string{"", "-1", "soon"} {
+		if _, ok := ParseRetryAfter(v, now); ok {
+			t.Errorf("ParseRetryAfter(%q) should fail", v)
+		}
+	}
+}
+
+func TestRetryPolicyHonorsRetryAfter(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}
+	hinted := &BackendError{Backend: "tr1d1um", Status: 429, RetryAfter: 50 * time.Millisecond}
+	if !errors.Is(hinted, ErrBackendUnavailable) {
+		t.Fatal("429 should be backend unavailability")
+	}
+	if after, ok := RetryAfter(fmt.Errorf("get: %w", hinted)); !ok || after != 50*time.Millisecond {
+		t.Fatalf("RetryAfter = %s, %v", after, ok)
+	}
+	calls, start := 0, time.Now()
+	if err := p.Do(context.Background(), func() error { calls++; return hinted }); calls != 2 || time.Since(start) < 50*time.Millisecond {
+		t.Fatalf("retried after %s (%d calls, %v)", time.Since(start), calls, err)
+	}
+
+	// a wait beyond MaxRetryAfter, or past the deadline, fails at once
+	calls = 0
+	p.MaxRetryAfter = 10 * time.Millisecond
+	if err := p.Do(context.Background(), func() error { calls++; return hinted }); !errors.Is(err, ErrBackendUnavailable) || calls != 1 {
+		t.Fatalf("hint over MaxRetryAfter retried: %v after %d calls", err, calls)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	calls = 0
+	if err := (RetryPolicy{MaxAttempts: 2}).Do(ctx, func() error { calls++; return hinted }); err == nil || calls != 1 || ctx.Err() != nil {
+		t.Fatalf("hint past the deadline waited: %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,54 @@
+package devicemgr
+
+import (
+	"context"
+	"strings"
+)
+
+// Role is a caller's authorization level. Roles are ordered: each grants everything the lower ones do.
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleOperator
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+// ParseRole maps a role name (case-insensitive) to a Role.
+func ParseRole(s string) (Role, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "viewer":
+		return RoleViewer, true
+	case "operator":
+		return RoleOperator, true
+	case "admin":
+		return RoleAdmin, true
+	}
+	return RoleNone, false
+}
+
+type roleKey struct{}
+
+// WithRole returns a context carrying the caller's role.
+func WithRole(ctx context.Context, r Role) context.Context {
+	return context.WithValue(ctx, roleKey{}, r)
+}
+
+// RoleFromContext returns the caller's role; ok is false when authorization is not in use.
+func RoleFromContext(ctx context.Context) (r Role, ok bool) {
+	r, ok = ctx.Value(roleKey{}).(Role)
+	return r, ok
+}
@@ -0,0 +1,179 @@
+package devicemgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Runner is a long-running component: a poller, publisher, listener or adapter. Start brings it
+// up and returns once it is running; its ctx bounds startup only. Stop shuts it down and waits for
+// it, at most until ctx is done. A Supervisor starts Runners in dependency order and may start
+// one again after it exits.
+type Runner interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// Exiter is implemented by Runners that can exit on their own after Start, such as a loop that
+// fails or a listener whose socket breaks. The channel belongs to the latest Start: it receives
+// the exit error, nil for a clean exit, and is closed. Exiting because of Stop is reported as nil.
+type Exiter interface {
+	Exited() <-chan error
+}
+
+// RunnerFuncs adapts a component with separate start and stop functions, either of which may be
+// nil, such as a client that only needs closing at shutdown.
+type RunnerFuncs struct {
+	StartFunc func(ctx context.Context) error
+	StopFunc  func(ctx context.Context) error
+}
+
+func (f RunnerFuncs) Start(ctx context.Context) error {
+	if f.StartFunc == nil {
+		return nil
+	}
+	return f.StartFunc(ctx)
+}
+
+func (f RunnerFuncs) Stop(ctx context.Context) error {
+	if f.StopFunc == nil {
+		return nil
+	}
+	return f.StopFunc(ctx)
+}
+
+// RunFunc adapts a blocking loop to a Runner. Start runs it in a goroutine with a context that Stop
+// cancels; Stop then waits for it to return. The loop returning, or panicking, before Stop is an
+// exit its Supervisor can restart.
+func RunFunc(run func(ctx context.Context) error) Runner {
+	return &funcRunner{run: run}
+}
+
+type funcRunner struct {
+	run func(ctx context.Context) error
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	exited chan error
+	err    error // of the latest run
+}
+
+func (r *funcRunner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done != nil {
+		select {
+		case <-r.done:
+		default:
+			return fmt.Errorf("already running: %w", ErrConflict)
+		}
+	}
+	// the loop keeps ctx's values but not its cancellation, which only bounds startup
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	done, exited := make(chan struct{}), make(chan error, 1)
+	r.cancel, r.done, r.exited, r.err = cancel, done, exited, nil
+	go func() {
+		err := r.safeRun(runCtx)
+		if runCtx.Err() != nil && (err == nil || errors.Is(err, context.Canceled)) {
+			err = nil // stopped
+		}
+		r.mu.Lock()
+		r.err = err
+		r.mu.Unlock()
+		close(done)
+		exited <- err
+		close(exited)
+	}()
+	return nil
+}
+
+// safeRun turns a panic of the loop into its error.
+func (r *funcRunner) safeRun(ctx context.Context) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return r.run(ctx)
+}
+
+func (r *funcRunner) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil // exited on its own, reported through Exited
+	default:
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("did not stop: %w", ctx.Err())
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *funcRunner) Exited() <-chan error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.exited
+}
+
+// ServerRunner runs srv as a Runner. Start listens on srv.Addr, so a port already in use fails
+// it, then serves in the background; Stop shuts the server down gracefully.
+func ServerRunner(srv *http.Server) Runner {
+	return &serverRunner{srv: srv}
+}
+
+type serverRunner struct {
+	srv *http.Server
+
+	mu     sync.Mutex
+	exited chan error
+}
+
+func (s *serverRunner) Start(ctx context.Context) error {
+	addr := s.srv.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	ln, err := (&net.ListenConfig{}).Listen(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	s.mu.Lock()
+	s.exited = exited
+	s.mu.Unlock()
+	go func() {
+		err := s.srv.Serve(ln)
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		exited <- err
+		close(exited)
+	}()
+	return nil
+}
+
+func (s *serverRunner) Stop(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+func (s *serverRunner) Exited() <-chan error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exited
+}
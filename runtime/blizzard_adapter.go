@@ -10,7 +10,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/xmidt-org/talaria/devicemgr"
 )
@@ -31,12 +30,14 @@ type BlizzardAdapter struct {
 	deviceID string
 	service  string
 
-	dialer *websocket.Dialer
-	connMu sync.RWMutex
-	conn   *websocket.Conn
+	dialer  *websocket.Dialer
+	retry   devicemgr.RetryPolicy // reconnects after a read error
+	connMu  sync.RWMutex
+	conn    *websocket.Conn
+	writeMu sync.Mutex // the websocket allows one writer at a time
 
-	pendingMu sync.Mutex
-	pending   map[string]chan json.RawMessage
+	pending *pendingCalls
+	filter  FrameFilter // optional; applied to every inbound frame
 
 	listenersMu sync.RWMutex
 	listeners   []*blizzardEventSub
@@ -59,6 +60,10 @@ type BlizzardCall struct {
 	Method  string
 	Params  interface{}
 	Timeout time.Duration // optional; default 5s
+	// CancelMethod, when set, names the JSON-RPC notification sent to the device if ctx ends
+	// before the reply arrives, with params {"id":"<request id>"}, so a device that supports it
+	// can abandon the work. Devices that do not simply ignore it.
+	CancelMethod string
 }
 
 // BlizzardResult contains a decoded JSON-RPC result or error struct.
@@ -88,12 +93,35 @@ type jsonrpcResponse struct {
 	Error   *RPCError       `json:"error,omitempty"`
 }
 
-type jsonrpcNotification struct {
+// RPCNotification is a JSON-RPC notification from a device: a message with a method and no id.
+// Blizzard notifications are delivered as EventNotification events carrying one as the payload.
+type RPCNotification struct {
 	JSONRPC string          `json:"jsonrpc"`
 	Method  string          `json:"method"`
 	Params  json.RawMessage `json:"params,omitempty"`
 }
 
+// ParseRPCNotification extracts a notification from an event payload: an RPCNotification from the
+// Blizzard adapter, or the raw JSON text other transports (MQTT) carry.
+func ParseRPCNotification(payload interface{}) (RPCNotification, bool) {
+	var raw []byte
+	switch p := payload.(type) {
+	case RPCNotification:
+		return p, p.Method != ""
+	case string:
+		raw = []byte(p)
+	case []byte:
+		raw = p
+	default:
+		return RPCNotification{}, false
+	}
+	var note RPCNotification
+	if err := json.Unmarshal(raw, &note); err != nil {
+		return RPCNotification{}, false
+	}
+	return note, note.Method != ""
+}
+
 // NewBlizzardAdapter creates a new adapter. baseWS should be a websocket URL prefix
 // without trailing slash. DeviceID and service identify the logical endpoint.
 func NewBlizzardAdapter(baseWS, deviceID, service string, auth devicemgr.AuthStrategy) *BlizzardAdapter {
@@ -102,12 +130,27 @@ func NewBlizzardAdapter(baseWS, deviceID, service string, auth devicemgr.AuthStr
 		auth:     auth,
 		deviceID: deviceID,
 		service:  service,
-		dialer:   &websocket.Dialer{HandshakeTimeout: 10 * time.Second},
-		pending:  make(map[string]chan json.RawMessage),
+		dialer:   NewDialer(nil),
+		retry:    DefaultBlizzardReconnect,
+		pending:  newPendingCalls(),
 		closed:   make(chan struct{}),
 	}
 }
 
+// SetDialer replaces the websocket dialer; call it before Connect.
+func (b *BlizzardAdapter) SetDialer(d *websocket.Dialer) { b.dialer = d }
+
+// SetFrameFilter installs f on inbound frames; call it before Connect.
+func (b *BlizzardAdapter) SetFrameFilter(f FrameFilter) { b.filter = f }
+
+// DefaultBlizzardReconnect reconnects once, 300ms after the connection fails.
+var DefaultBlizzardReconnect = devicemgr.RetryPolicy{MaxAttempts: 2, Backoff: 300 * time.Millisecond}
+
+// SetRetryPolicy sets how the adapter reconnects when reading from the connection fails: up to
+// MaxAttempts-1 dials, Delay apart, before the device is reported offline and the adapter closes.
+// Every read error is treated as retryable. Call it before Connect.
+func (b *BlizzardAdapter) SetRetryPolicy(p devicemgr.RetryPolicy) { b.retry = p }
+
 // Connect establishes the websocket.
 func (b *BlizzardAdapter) Connect(ctx context.Context) error {
 	u, err := url.Parse(b.baseWS)
@@ -175,18 +218,23 @@ func (b *BlizzardAdapter) Close() error {
 	if c != nil {
 		_ = c.Close()
 	}
-	b.pendingMu.Lock()
-	for id, ch := range b.pending {
-		close(ch)
-		delete(b.pending, id)
-	}
-	b.pendingMu.Unlock()
+	b.pending.closeAll()
 	b.listenersMu.Lock()
 	b.listeners = nil
 	b.listenersMu.Unlock()
 	return nil
 }
 
+// Closed reports whether the adapter was closed, by Close or once reconnecting gave up.
+func (b *BlizzardAdapter) Closed() bool {
+	select {
+	case <-b.closed:
+		return true
+	default:
+		return false
+	}
+}
+
 // Call issues a JSON-RPC request and waits for a response.
 func (b *BlizzardAdapter) Call(ctx context.Context, call BlizzardCall) (*BlizzardResult, error) {
 	if call.Method == "" {
@@ -196,28 +244,29 @@ func (b *BlizzardAdapter) Call(ctx context.Context, call BlizzardCall) (*Blizzar
 		call.Timeout = 5 * time.Second
 	}
 
-	id := uuid.NewString()
-	req := jsonrpcRequest{JSONRPC: "2.0", ID: id, Method: call.Method, Params: call.Params}
-	payload, err := json.Marshal(req)
+	ch := make(chan json.RawMessage, 1)
+	n := b.pending.add(ch)
+	buf := requestBuffers.Get().(*[]byte)
+	defer requestBuffers.Put(buf)
+	payload, err := b.pending.appendRequest((*buf)[:0], n, call)
+	*buf = payload[:0]
 	if err != nil {
+		b.pending.take(n)
 		return nil, err
 	}
 
-	ch := make(chan json.RawMessage, 1)
-	b.pendingMu.Lock()
-	b.pending[id] = ch
-	b.pendingMu.Unlock()
-
 	b.connMu.RLock()
 	c := b.conn
 	b.connMu.RUnlock()
 	if c == nil {
+		b.pending.take(n)
 		return nil, errors.New("not connected")
 	}
-	if err = c.WriteMessage(websocket.TextMessage, payload); err != nil {
-		b.pendingMu.Lock()
-		delete(b.pending, id)
-		b.pendingMu.Unlock()
+	b.writeMu.Lock()
+	err = c.WriteMessage(websocket.TextMessage, payload)
+	b.writeMu.Unlock()
+	if err != nil {
+		b.pending.take(n)
 		return nil, err
 	}
 
@@ -226,9 +275,12 @@ func (b *BlizzardAdapter) Call(ctx context.Context, call BlizzardCall) (*Blizzar
 
 	select {
 	case <-ctx.Done():
-		b.pendingMu.Lock()
-		delete(b.pending, id)
-		b.pendingMu.Unlock()
+		if _, waiting := b.pending.take(n); waiting && call.CancelMethod != "" {
+			note := appendCancelNotification(nil, call.CancelMethod, b.pending.appendID(nil, n))
+			b.writeMu.Lock()
+			_ = c.WriteMessage(websocket.TextMessage, note)
+			b.writeMu.Unlock()
+		}
 		return nil, ctx.Err()
 	case respBytes, ok := <-ch:
 		if !ok {
@@ -271,6 +323,31 @@ func (b *BlizzardAdapter) broadcast(evt devicemgr.Event) {
 	}
 }
 
+// redial reconnects after the read error cause per the retry policy, returning the new connection
+// or nil once attempts are exhausted or the adapter is closed.
+func (b *BlizzardAdapter) redial(cause error) *websocket.Conn {
+	if b.retry.MaxAttempts < 2 {
+		return nil
+	}
+	b.broadcast(devicemgr.Event{Kind: devicemgr.EventOffline, DeviceID: devicemgr.DeviceID(b.deviceID), OccurredAt: time.Now(), Source: "blizzard-adapter", Payload: fmt.Sprintf("read error, reconnecting: %v", cause)})
+	for n := 1; n < b.retry.MaxAttempts; n++ {
+		select {
+		case <-time.After(b.retry.Delay(n)):
+		case <-b.closed:
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err := b.reconnect(ctx)
+		cancel()
+		if err == nil {
+			b.connMu.RLock()
+			defer b.connMu.RUnlock()
+			return b.conn
+		}
+	}
+	return nil
+}
+
 func (b *BlizzardAdapter) readLoop() {
 	b.connMu.RLock()
 	c := b.conn
@@ -278,42 +355,30 @@ func (b *BlizzardAdapter) readLoop() {
 	if c == nil {
 		return
 	}
-	retried := false
 	for {
 		_, data, err := c.ReadMessage()
 		if err != nil {
-			if !retried {
-				retried = true
-				b.broadcast(devicemgr.Event{Kind: devicemgr.EventOffline, DeviceID: devicemgr.DeviceID(b.deviceID), OccurredAt: time.Now(), Source: "blizzard-adapter", Payload: fmt.Sprintf("read error, retrying once: %v", err)})
-				// brief delay then attempt reconnect
-				time.Sleep(300 * time.Millisecond)
-				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-				if recErr := b.reconnect(ctx); recErr == nil {
-					cancel()
-					b.connMu.RLock()
-					c = b.conn
-					b.connMu.RUnlock()
-					if c == nil {
-						_ = b.Close()
-						return
-					}
-					continue
-				}
-				cancel()
+			if c = b.redial(err); c == nil {
+				b.broadcast(devicemgr.Event{Kind: devicemgr.EventOffline, DeviceID: devicemgr.DeviceID(b.deviceID), OccurredAt: time.Now(), Source: "blizzard-adapter", Payload: err.Error()})
+				_ = b.Close()
+				return
+			}
+			continue
+		}
+		if b.filter != nil {
+			var ok bool
+			if data, ok = b.filter(data); !ok {
+				continue
 			}
-			b.broadcast(devicemgr.Event{Kind: devicemgr.EventOffline, DeviceID: devicemgr.DeviceID(b.deviceID), OccurredAt: time.Now(), Source: "blizzard-adapter", Payload: err.Error()})
-			_ = b.Close()
-			return
 		}
 		// Attempt to decode as response
 		var resp jsonrpcResponse
 		if err := json.Unmarshal(data, &resp); err == nil && resp.ID != "" && (resp.Result != nil || resp.Error != nil) {
-			b.pendingMu.Lock()
-			ch, found := b.pending[resp.ID]
+			var ch chan json.RawMessage
+			n, found := b.pending.parseID(resp.ID)
 			if found {
-				delete(b.pending, resp.ID)
+				ch, found = b.pending.take(n)
 			}
-			b.pendingMu.Unlock()
 			if found {
 				select {
 				case ch <- data:
@@ -325,7 +390,7 @@ func (b *BlizzardAdapter) readLoop() {
 			continue
 		}
 		// If no ID -> notification
-		var note jsonrpcNotification
+		var note RPCNotification
 		if err := json.Unmarshal(data, &note); err != nil || note.Method == "" {
 			continue
 		}
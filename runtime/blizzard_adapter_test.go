@@ -3,6 +3,7 @@ package runtime
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -26,7 +27,7 @@ func TestBlizzardAdapterCallAndNotify(t *testing.T) {
 		go func() {
 			// send a notification after a short delay
 			time.Sleep(50 * time.Millisecond)
-			n := jsonrpcNotification{JSONRPC: "2.0", Method: "device.event", Params: json.RawMessage(`{"x":1}`)}
+			n := RPCNotification{JSONRPC: "2.0", Method: "device.event", Params: json.RawMessage(`{"x":1}`)}
 			b, _ := json.Marshal(n)
 			_ = c.WriteMessage(websocket.TextMessage, b)
 			notifySent = true
@@ -86,3 +87,74 @@ func TestBlizzardAdapterCallAndNotify(t *testing.T) {
 		}
 	}
 }
+
+func TestBlizzardAdapterConcurrentCalls(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		// a reply for an unknown ID must not disturb pending calls
+		c.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":"elsewhere-1","result":1}`))
+		for {
+			var req struct {
+				ID     string          `json:"id"`
+				Method string          `json:"method"`
+				Params json.RawMessage `json:"params"`
+			}
+			if err := c.ReadJSON(&req); err != nil {
+				return
+			}
+			// echo method and params so callers can check they got their own reply
+			result, _ := json.Marshal(map[string]interface{}{"method": req.Method, "params": req.Params})
+			c.WriteJSON(jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result})
+		}
+	}))
+	defer srv.Close()
+	ad := NewBlizzardAdapter("ws"+srv.URL[len("http"):], "001122334455", "svc", nil)
+	if err := ad.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer ad.Close()
+	errs := make(chan error, 200)
+	for i := 0; i < 200; i++ {
+		go func(i int) {
+			method := fmt.Sprintf("m\"%d\té", i)
+			res, err := ad.Call(context.Background(), BlizzardCall{Method: method, Params: i, Timeout: 2 * time.Second})
+			if err == nil {
+				var got struct {
+					Method string `json:"method"`
+					Params int    `json:"params"`
+				}
+				if err = json.Unmarshal(res.Result, &got); err == nil && (got.Method != method || got.Params != i) {
+					err = fmt.Errorf("call %d got reply %+v", i, got)
+				}
+			}
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < 200; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPendingCalls(b *testing.B) {
+	p := newPendingCalls()
+	call := BlizzardCall{Method: "Device.GetInfo"}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		ch := make(chan json.RawMessage, 1)
+		buf := make([]byte, 0, 128)
+		for pb.Next() {
+			n := p.add(ch)
+			buf, _ = p.appendRequest(buf[:0], n, call)
+			if _, ok := p.take(n); !ok {
+				b.Fatal("lost call")
+			}
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package runtime
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// pendingShards spreads in-flight calls over independently locked maps, so concurrent Calls and
+// the read loop do not serialize on one mutex.
+const pendingShards = 32
+
+// pendingCalls tracks in-flight calls by request ID. IDs are a random per-adapter prefix followed
+// by a base-36 sequence number; the sequence number alone keys the shards, so registering and
+// matching a call allocate nothing beyond its reply channel.
+type pendingCalls struct {
+	prefix string // unique per adapter, so replies meant for another client never match
+	seq    atomic.Uint64
+	shards [pendingShards]struct {
+		mu    sync.Mutex
+		calls map[uint64]chan json.RawMessage
+	}
+}
+
+func newPendingCalls() *pendingCalls {
+	var b [6]byte
+	_, _ = rand.Read(b[:])
+	p := &pendingCalls{prefix: hex.EncodeToString(b[:]) + "-"}
+	for i := range p.shards {
+		p.shards[i].calls = make(map[uint64]chan json.RawMessage)
+	}
+	return p
+}
+
+// add registers ch under a new sequence number.
+func (p *pendingCalls) add(ch chan json.RawMessage) uint64 {
+	n := p.seq.Add(1)
+	s := &p.shards[n%pendingShards]
+	s.mu.Lock()
+	s.calls[n] = ch
+	s.mu.Unlock()
+	return n
+}
+
+// take removes and returns the call registered under n.
+func (p *pendingCalls) take(n uint64) (chan json.RawMessage, bool) {
+	s := &p.shards[n%pendingShards]
+	s.mu.Lock()
+	ch, ok := s.calls[n]
+	if ok {
+		delete(s.calls, n)
+	}
+	s.mu.Unlock()
+	return ch, ok
+}
+
+// closeAll closes and removes every pending call.
+func (p *pendingCalls) closeAll() {
+	for i := range p.shards {
+		s := &p.shards[i]
+		s.mu.Lock()
+		for n, ch := range s.calls {
+			close(ch)
+			delete(s.calls, n)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// appendID appends the request ID for sequence number n.
+func (p *pendingCalls) appendID(dst []byte, n uint64) []byte {
+	return strconv.AppendUint(append(dst, p.prefix...), n, 36)
+}
+
+// parseID returns the sequence number of a request ID issued by this adapter.
+func (p *pendingCalls) parseID(id string) (uint64, bool) {
+	rest, ok := strings.CutPrefix(id, p.prefix)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(rest, 36, 64)
+	return n, err == nil
+}
+
+// requestBuffers holds encoding buffers for outbound requests; the websocket copies a message
+// into its frame before WriteMessage returns, so buffers are reused right after the write.
+var requestBuffers = sync.Pool{New: func() any { b := make([]byte, 0, 512); return &b }}
+
+// appendRequest appends the JSON-RPC request envelope for call under ID n. Only non-nil params go
+// through encoding/json.
+func (p *pendingCalls) appendRequest(dst []byte, n uint64, call BlizzardCall) ([]byte, error) {
+	dst = append(dst, `{"jsonrpc":"2.0","id":"`...)
+	dst = p.appendID(dst, n)
+	dst = append(dst, `","method":`...)
+	dst = appendJSONString(dst, call.Method)
+	if call.Params != nil {
+		params, err := json.Marshal(call.Params)
+		if err != nil {
+			return dst, err
+		}
+		dst = append(append(dst, `,"params":`...), params...)
+	}
+	return append(dst, '}'), nil
+}
+
+// appendCancelNotification appends the JSON-RPC notification asking the device to abandon the
+// request with the given ID.
+func appendCancelNotification(dst []byte, method string, id []byte) []byte {
+	dst = append(dst, `{"jsonrpc":"2.0","method":`...)
+	dst = appendJSONString(dst, method)
+	dst = append(dst, `,"params":{"id":`...)
+	dst = appendJSONString(dst, string(id))
+	return append(dst, `}}`...)
+}
+
+// appendJSONString appends s as a JSON string literal.
+func appendJSONString(dst []byte, s string) []byte {
+	const hexDigits = "0123456789abcdef"
+	dst = append(dst, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			dst = append(dst, '\\', c)
+		case c < 0x20:
+			dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+		case c < utf8.RuneSelf:
+			dst = append(dst, c)
+		default:
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				dst = append(dst, "\ufffd"...)
+			} else {
+				dst = append(dst, s[i:i+size]...)
+			}
+			i += size
+			continue
+		}
+		i++
+	}
+	return append(dst, '"')
+}
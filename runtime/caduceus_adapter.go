@@ -0,0 +1,288 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/wrpmsg"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// DefaultCaduceusEvents are the event types registered for when CaduceusOptions.Events is empty.
+var DefaultCaduceusEvents = []string{"device-status.*", "reboot.*", "crash.*"}
+
+// DefaultCaduceusDuration is the webhook registration lifetime when CaduceusOptions.Duration is unset.
+const DefaultCaduceusDuration = 5 * time.Minute
+
+// maxDelivery bounds a webhook delivery.
+const maxDelivery = 1 << 20
+
+// CaduceusOptions configures a CaduceusAdapter.
+type CaduceusOptions struct {
+	BaseURL     string
+	CallbackURL string
+	Secret      string
+	Events      []string
+	Duration    time.Duration
+	Auth        dm.AuthStrategy
+	Client      *http.Client
+	Retry       dm.RetryPolicy
+}
+
+// CaduceusAdapter registers a webhook with Caduceus and turns the WRP events it delivers into
+// device events: device-status online and offline events keep their kind, crash events become
+// crashes and everything else (reboot reasons, custom events) notifications.
+type CaduceusAdapter struct {
+	o CaduceusOptions
+
+	listenersMu sync.RWMutex
+	listeners   []chan dm.Event
+}
+
+// CaduceusEvent is the Payload of events built from deliveries.
+type CaduceusEvent struct {
+	Destination     string            `json:"destination"`
+	Source          string            `json:"source,omitempty"`
+	TransactionUUID string            `json:"transactionUuid,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	PartnerIDs      []string          `json:"partnerIds,omitempty"`
+	Payload         interface{}       `json:"payload,omitempty"` // decoded JSON, or the payload as text
+}
+
+func NewCaduceusAdapter(o CaduceusOptions) (*CaduceusAdapter, error) {
+	if o.BaseURL == "" || o.CallbackURL == "" {
+		return nil, errors.New("caduceus: BaseURL and CallbackURL required")
+	}
+	o.BaseURL = strings.TrimRight(o.BaseURL, "/")
+	if len(o.Events) == 0 {
+		o.Events = DefaultCaduceusEvents
+	}
+	if o.Duration <= 0 {
+		o.Duration = DefaultCaduceusDuration
+	}
+	if o.Client == nil {
+		o.Client = NewClient(nil, 10*time.Second)
+	}
+	return &CaduceusAdapter{o: o}, nil
+}
+
+// caduceusWebhook is the registration body of POST /hook.
+type caduceusWebhook struct {
+	Config struct {
+		URL         string `json:"url"`
+		ContentType string `json:"content_type"`
+		Secret      string `json:"secret,omitempty"`
+	} `json:"config"`
+	Events  []string `json:"events"`
+	Matcher struct {
+		DeviceID []string `json:"device_id"`
+	} `json:"matcher"`
+	Duration string `json:"duration"`
+}
+
+// Register registers (or renews) the webhook for every device, retrying per Retry.
+func (a *CaduceusAdapter) Register(ctx context.Context) error {
+	var hook caduceusWebhook
+	hook.Config.URL = a.o.CallbackURL
+	hook.Config.ContentType = "wrp"
+	hook.Config.Secret = a.o.Secret
+	hook.Events = a.o.Events
+	hook.Matcher.DeviceID = []string{".*"}
+	hook.Duration = a.o.Duration.String()
+	body, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+	return a.o.Retry.Do(ctx, func() error { return a.register(ctx, body) })
+}
+
+func (a *CaduceusAdapter) register(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.o.BaseURL+"/hook", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.o.Auth != nil {
+		if v, e := a.o.Auth.AuthorizationValue(); e == nil {
+			req.Header.Set("Authorization", v)
+		}
+	}
+	resp, err := a.o.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("caduceus: %w", dm.ErrBackendUnavailable)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("caduceus: %w", dm.ErrAccessDenied)
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("caduceus: unexpected status %d: %w", resp.StatusCode, dm.ErrBackendUnavailable)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("caduceus: registration rejected with %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Run registers the webhook and renews it halfway through each registration until ctx ends.
+// Failed registrations are passed to report (optional) and retried after a tenth of Duration.
+func (a *CaduceusAdapter) Run(ctx context.Context, report func(error)) {
+	for {
+		wait := a.o.Duration / 2
+		if err := a.Register(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if report != nil {
+				report(err)
+			}
+			wait = a.o.Duration / 10
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// ServeHTTP accepts deliveries: WRP messages in msgpack, as registered, or in JSON.
+func (a *CaduceusAdapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxDelivery))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if a.o.Secret != "" && !validSignature(a.o.Secret, body, r.Header.Get("X-Webpa-Signature")) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	var msg *wrp.Message
+	switch ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct {
+	case "application/json":
+		msg = new(wrp.Message)
+		err = wrp.NewDecoderBytes(body, wrp.JSON).Decode(msg)
+	case wrpmsg.ContentType, "application/wrp", "":
+		msg, err = wrpmsg.Decode(body)
+	default:
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if e, ok := CaduceusDeviceEvent(msg, time.Now()); ok {
+		a.broadcast(e)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// validSignature checks sig ("sha1=<hex HMAC-SHA1 of body>") against secret.
+func validSignature(secret string, body []byte, sig string) bool {
+	got, err := hex.DecodeString(strings.TrimPrefix(sig, "sha1="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// CaduceusDeviceEvent converts a delivered WRP event, received at now; ok is false for messages
+// that are not events of an identifiable device. The device comes from the destination
+// (event:<type>/<device>/...) or else the source; device-status payloads supply OccurredAt.
+func CaduceusDeviceEvent(msg *wrp.Message, now time.Time) (dm.Event, bool) {
+	if msg.Type != wrp.SimpleEventMessageType || !strings.HasPrefix(msg.Destination, "event:") {
+		return dm.Event{}, false
+	}
+	id, ok := eventDevice(msg)
+	if !ok {
+		return dm.Event{}, false
+	}
+	kind, ok := codexKind(msg.Destination)
+	if !ok {
+		kind = dm.EventNotification
+	}
+	payload := CaduceusEvent{Destination: msg.Destination, Source: msg.Source, TransactionUUID: msg.TransactionUUID, Metadata: msg.Metadata, PartnerIDs: msg.PartnerIDs}
+	at := now
+	if len(msg.Payload) > 0 {
+		var decoded interface{}
+		if json.Unmarshal(msg.Payload, &decoded) == nil {
+			payload.Payload = decoded
+			if obj, ok := decoded.(map[string]interface{}); ok {
+				if ts, ok := obj["ts"].(string); ok {
+					if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+						at = t
+					}
+				}
+			}
+		} else {
+			payload.Payload = string(msg.Payload)
+		}
+	}
+	return dm.Event{Kind: kind, DeviceID: id, OccurredAt: at, Source: "caduceus", Payload: payload}, true
+}
+
+// eventDevice finds the device of an event in its destination or else its source.
+func eventDevice(msg *wrp.Message) (dm.DeviceID, bool) {
+	segments := strings.Split(strings.TrimPrefix(msg.Destination, "event:"), "/")
+	if len(segments) > 1 {
+		if id, err := dm.ParseDeviceID(segments[1]); err == nil {
+			return id, true
+		}
+	}
+	source, _, _ := strings.Cut(msg.Source, "/")
+	id, err := dm.ParseDeviceID(source)
+	return id, err == nil
+}
+
+func (a *CaduceusAdapter) broadcast(e dm.Event) {
+	a.listenersMu.RLock()
+	defer a.listenersMu.RUnlock()
+	for _, ch := range a.listeners {
+		select {
+		case ch <- e:
+		default: /* drop if slow */
+		}
+	}
+}
+
+// Subscribe returns events converted from deliveries.
+func (a *CaduceusAdapter) Subscribe(buffer int) dm.EventSubscription {
+	ch := make(chan dm.Event, buffer)
+	a.listenersMu.Lock()
+	a.listeners = append(a.listeners, ch)
+	a.listenersMu.Unlock()
+	return &eventSub{ch: ch, closeFn: func() { a.unsubscribe(ch) }}
+}
+
+func (a *CaduceusAdapter) unsubscribe(ch chan dm.Event) {
+	a.listenersMu.Lock()
+	defer a.listenersMu.Unlock()
+	for i, l := range a.listeners {
+		if l == ch {
+			a.listeners = append(a.listeners[:i:i], a.listeners[i+1:]...)
+			break
+		}
+	}
+	close(ch)
+}
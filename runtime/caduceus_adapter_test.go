@@ -0,0 +1,105 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/wrpmsg"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+func TestCaduceusRegister(t *testing.T) {
+	hooks := make(chan caduceusWebhook, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var hook caduceusWebhook
+		if r.URL.Path != "/hook" || r.Header.Get("Authorization") != "Basic x" || json.NewDecoder(r.Body).Decode(&hook) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		hooks <- hook
+	}))
+	defer srv.Close()
+	a, err := NewCaduceusAdapter(CaduceusOptions{BaseURL: srv.URL + "/", CallbackURL: "https://dm/hook", Secret: "s", Auth: dm.StaticAuth{Value: "Basic x"}, Duration: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx, func(err error) { t.Errorf("registration: %v", err) })
+	hook := <-hooks
+	if hook.Config.URL != "https://dm/hook" || hook.Config.ContentType != "wrp" || hook.Config.Secret != "s" ||
+		len(hook.Events) != len(DefaultCaduceusEvents) || hook.Matcher.DeviceID[0] != ".*" || hook.Duration != "200ms" {
+		t.Fatalf("unexpected registration %+v", hook)
+	}
+	select {
+	case <-hooks:
+	case <-time.After(2 * time.Second):
+		t.Fatal("registration not renewed")
+	}
+	if _, err := NewCaduceusAdapter(CaduceusOptions{BaseURL: srv.URL}); err == nil {
+		t.Fatal("expected an error without a callback URL")
+	}
+}
+
+func TestCaduceusDeliveries(t *testing.T) {
+	a, err := NewCaduceusAdapter(CaduceusOptions{BaseURL: "http://caduceus", CallbackURL: "http://dm", Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := a.Subscribe(8)
+	defer sub.Close()
+	deliver := func(msg *wrp.Message, sign bool) int {
+		body, err := wrpmsg.Encode(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		req.Header.Set("Content-Type", wrpmsg.ContentType)
+		if sign {
+			mac := hmac.New(sha1.New, []byte("s3cret"))
+			mac.Write(body)
+			req.Header.Set("X-Webpa-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+		}
+		rr := httptest.NewRecorder()
+		a.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	offline := wrpmsg.Event("dns:talaria", "event:device-status/mac:112233445566/offline", "application/json", []byte(`{"id":"mac:112233445566","ts":"2024-05-01T12:00:00Z","reason-for-closure":"ping miss"}`))
+	if code := deliver(offline, false); code != http.StatusForbidden {
+		t.Fatalf("unsigned delivery: %d", code)
+	}
+	if code := deliver(offline, true); code != http.StatusAccepted {
+		t.Fatalf("signed delivery: %d", code)
+	}
+	e := <-sub.C()
+	if e.Kind != dm.EventOffline || e.DeviceID != "mac:112233445566" || e.Source != "caduceus" || !e.OccurredAt.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("offline event: %+v", e)
+	}
+	if p, ok := e.Payload.(CaduceusEvent); !ok || p.Payload.(map[string]interface{})["reason-for-closure"] != "ping miss" {
+		t.Fatalf("payload: %#v", e.Payload)
+	}
+
+	reboot := wrpmsg.Event("mac:AABBCCDDEEFF/rebootmgr", "event:reboot-pending", "text/plain", []byte("maintenance"))
+	deliver(reboot, true)
+	if e := <-sub.C(); e.Kind != dm.EventNotification || e.DeviceID != "mac:aabbccddeeff" || e.Payload.(CaduceusEvent).Payload != "maintenance" {
+		t.Fatalf("reboot event: %+v", e)
+	}
+	deliver(wrpmsg.Event("dns:x", "event:crash/mac:112233445566", "", nil), true)
+	if e := <-sub.C(); e.Kind != dm.EventCrash {
+		t.Fatalf("crash event: %+v", e)
+	}
+	// requests are not events
+	if code := deliver(wrpmsg.Request("dns:x", "mac:112233445566", "config", "", nil), true); code != http.StatusAccepted || len(sub.C()) != 0 {
+		t.Fatalf("request delivery: %d, %d queued", code, len(sub.C()))
+	}
+}
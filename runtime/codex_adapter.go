@@ -0,0 +1,140 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xmidt-org/talaria/devicemgr"
+)
+
+// CodexAdapter reads the events Codex has stored for a device through the Gungnir API
+// (GET /api/v1/device/{id}/events).
+type CodexAdapter struct {
+	baseURL string
+	client  *http.Client
+	auth    devicemgr.AuthStrategy
+	retry   devicemgr.RetryPolicy
+}
+
+// CodexEvent is the Payload of events returned by History.
+type CodexEvent struct {
+	Destination     string            `json:"destination"`
+	TransactionUUID string            `json:"transactionUuid,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	PartnerIDs      []string          `json:"partnerIds,omitempty"`
+}
+
+// gungnirEvent is one stored WRP event as returned by Gungnir.
+type gungnirEvent struct {
+	Source          string            `json:"source"`
+	Destination     string            `json:"dest"`
+	TransactionUUID string            `json:"transaction_uuid,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	PartnerIDs      []string          `json:"partner_ids,omitempty"`
+	BirthDate       int64             `json:"birth_date"`
+}
+
+func NewCodexAdapter(baseURL string, auth devicemgr.AuthStrategy) *CodexAdapter {
+	return &CodexAdapter{baseURL: strings.TrimRight(baseURL, "/"), client: NewClient(nil, 10*time.Second), auth: auth}
+}
+
+// SetHTTPClient replaces the client used for Gungnir requests; call it before the first request.
+func (c *CodexAdapter) SetHTTPClient(client *http.Client) { c.client = client }
+
+// SetRetryPolicy sets how failed history requests are retried; call it before the first request.
+func (c *CodexAdapter) SetRetryPolicy(p devicemgr.RetryPolicy) { c.retry = p }
+
+// History returns the device's online, offline and crash events received at or after since,
+// oldest first. Other stored events are skipped; a device Codex has no record of has no history.
+func (c *CodexAdapter) History(ctx context.Context, id devicemgr.DeviceID, since time.Time) ([]devicemgr.Event, error) {
+	id = id.Canonical()
+	var stored []gungnirEvent
+	err := c.retry.Do(ctx, func() (err error) {
+		stored, err = c.fetch(ctx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]devicemgr.Event, 0, len(stored))
+	for _, e := range stored {
+		kind, ok := codexKind(e.Destination)
+		if !ok {
+			continue
+		}
+		at := birthTime(e.BirthDate)
+		if at.Before(since) {
+			continue
+		}
+		out = append(out, devicemgr.Event{
+			Kind:       kind,
+			DeviceID:   id,
+			OccurredAt: at,
+			Source:     "codex",
+			Payload:    CodexEvent{Destination: e.Destination, TransactionUUID: e.TransactionUUID, Metadata: e.Metadata, PartnerIDs: e.PartnerIDs},
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].OccurredAt.Before(out[j].OccurredAt) })
+	return out, nil
+}
+
+// fetch requests the device's stored events once; a device Codex does not know has none.
+func (c *CodexAdapter) fetch(ctx context.Context, id devicemgr.DeviceID) ([]gungnirEvent, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/v1/device/%s/events", c.baseURL, url.PathEscape(string(id))), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.auth != nil {
+		if v, e := c.auth.AuthorizationValue(); e == nil {
+			req.Header.Set("Authorization", v)
+		}
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("codex: %w", devicemgr.ErrBackendUnavailable)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("codex: %w", devicemgr.ErrAccessDenied)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("codex: unexpected status %d: %w", resp.StatusCode, devicemgr.ErrBackendUnavailable)
+	}
+	var stored []gungnirEvent
+	if err := json.NewDecoder(resp.Body).Decode(&stored); err != nil {
+		return nil, fmt.Errorf("codex: %w", err)
+	}
+	return stored, nil
+}
+
+// codexKind maps a WRP event destination such as event:device-status/mac:112233445566/offline
+// onto an event kind.
+func codexKind(dest string) (devicemgr.EventKind, bool) {
+	event := strings.TrimPrefix(dest, "event:")
+	switch last := event[strings.LastIndex(event, "/")+1:]; {
+	case last == "online":
+		return devicemgr.EventOnline, true
+	case last == "offline":
+		return devicemgr.EventOffline, true
+	case strings.Contains(strings.ToLower(event), "crash"):
+		return devicemgr.EventCrash, true
+	}
+	return "", false
+}
+
+// birthTime converts a stored birth date, which Codex deployments record either in Unix seconds
+// or in nanoseconds.
+func birthTime(v int64) time.Time {
+	if v > 1e14 {
+		return time.Unix(0, v)
+	}
+	return time.Unix(v, 0)
+}
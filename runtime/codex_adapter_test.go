@@ -0,0 +1,63 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestCodexAdapterHistory(t *testing.T) {
+	now := time.Now()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/device/mac:112233445566/events" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `[
+			{"dest":"event:device-status/mac:112233445566/online","birth_date":%d,"partner_ids":["comcast"]},
+			{"dest":"event:device-status/mac:112233445566/offline","birth_date":%d,"metadata":{"/reason":"ping-miss"}},
+			{"dest":"event:crash-report/mac:112233445566","birth_date":%d},
+			{"dest":"event:device-status/mac:112233445566/offline","birth_date":%d},
+			{"dest":"event:config/mac:112233445566","birth_date":%d}
+		]`, now.Add(-time.Hour).UnixNano(), now.Add(-2*time.Hour).Unix(), now.Add(-30*time.Minute).UnixNano(), now.Add(-48*time.Hour).Unix(), now.UnixNano())
+	}))
+	defer srv.Close()
+
+	c := NewCodexAdapter(srv.URL+"/", dm.StaticAuth{Value: "Bearer t"})
+	got, err := c.History(context.Background(), "mac:112233445566", now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	want := []dm.EventKind{dm.EventOffline, dm.EventOnline, dm.EventCrash}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), got)
+	}
+	for i, e := range got {
+		if e.Kind != want[i] || e.Source != "codex" || e.DeviceID != "mac:112233445566" {
+			t.Fatalf("event %d: %+v", i, e)
+		}
+	}
+	if info := got[0].Payload.(CodexEvent); info.Metadata["/reason"] != "ping-miss" {
+		t.Fatalf("metadata not kept: %+v", info)
+	}
+	if info := got[1].Payload.(CodexEvent); len(info.PartnerIDs) != 1 || info.PartnerIDs[0] != "comcast" {
+		t.Fatalf("partner IDs not kept: %+v", info)
+	}
+
+	if got, err := c.History(context.Background(), "mac:unknown", time.Time{}); err != nil || len(got) != 0 {
+		t.Fatalf("unknown device: %v %v", got, err)
+	}
+	if _, err := NewCodexAdapter(srv.URL, nil).History(context.Background(), "mac:112233445566", time.Time{}); !errors.Is(err, dm.ErrAccessDenied) {
+		t.Fatalf("expected ErrAccessDenied, got %v", err)
+	}
+}
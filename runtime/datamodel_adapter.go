@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	dm "github.com/xmidt-org/talaria/devicemgr"
@@ -30,8 +31,16 @@ type DataModelAdapter struct {
 	baseURL string // e.g. http://tr1d1um:6100/api/v3
 	auth    dm.AuthStrategy
 	service string // translation service name (maps to {service} path component)
+	retry   dm.RetryPolicy
+	chunk   int // names per GET request
 }
 
+// DefaultMaxGetNames is how many names a GET carries when DataModelOptions.MaxGetNames is unset.
+const DefaultMaxGetNames = 100
+
+// getChunkConcurrency bounds the chunk requests of one Get in flight at a time.
+const getChunkConcurrency = 4
+
 // DataModelOptions configures a new adapter.
 type DataModelOptions struct {
 	BaseURL        string
@@ -39,6 +48,11 @@ type DataModelOptions struct {
 	Client         *http.Client
 	Auth           dm.AuthStrategy
 	RequestTimeout time.Duration
+	// Retry retries GETs that fail transiently; SETs are not idempotent and are never retried.
+	Retry dm.RetryPolicy
+	// MaxGetNames caps the names sent in one GET request (DefaultMaxGetNames); Get splits longer
+	// lists into chunks fetched concurrently and merges their results.
+	MaxGetNames int
 }
 
 // NewDataModelAdapter builds a DataModelAdapter.
@@ -51,14 +65,17 @@ func NewDataModelAdapter(o DataModelOptions) (*DataModelAdapter, error) {
 	}
 	c := o.Client
 	if c == nil {
-		c = &http.Client{Timeout: func() time.Duration {
-			if o.RequestTimeout > 0 {
-				return o.RequestTimeout
-			}
-			return 15 * time.Second
-		}()}
+		timeout := 15 * time.Second
+		if o.RequestTimeout > 0 {
+			timeout = o.RequestTimeout
+		}
+		c = NewClient(nil, timeout)
+	}
+	chunk := o.MaxGetNames
+	if chunk <= 0 {
+		chunk = DefaultMaxGetNames
 	}
-	return &DataModelAdapter{client: c, baseURL: strings.TrimRight(o.BaseURL, "/"), auth: o.Auth, service: o.Service}, nil
+	return &DataModelAdapter{client: c, baseURL: strings.TrimRight(o.BaseURL, "/"), auth: o.Auth, service: o.Service, retry: o.Retry, chunk: chunk}, nil
 }
 
 // GetResult models a consolidated response from a GET/GET_ATTRIBUTES call.
@@ -66,6 +83,7 @@ type GetResult struct {
 	// Values maps parameter name -> ParameterValue (value + timestamp + freshness) when present.
 	Values map[string]dm.ParameterValue
 	// RawPayload keeps the raw device JSON payload (opaque to this layer) for callers needing extras.
+	// A Get split into chunks keeps a JSON array of the chunks' payloads, in request order.
 	RawPayload json.RawMessage
 }
 
@@ -75,13 +93,106 @@ type SetResult struct {
 	Applied []string
 	// RawPayload original response.
 	RawPayload json.RawMessage
+	// DryRun describes the SET that was not sent, with dm.SetOptions.DryRun.
+	DryRun *DryRunReport
+}
+
+// Predicted outcomes of a parameter in a DryRunReport.
+const (
+	OutcomeSet       = "set"       // will be written; its current value is not cached
+	OutcomeChange    = "change"    // will replace a different cached value
+	OutcomeUnchanged = "unchanged" // equals the cached value
+	OutcomeRejected  = "rejected"  // fails validation; see Reason
+)
+
+// DryRunReport describes a SET that was validated but not sent.
+type DryRunReport struct {
+	Valid    bool            `json:"valid"`              // no parameter is rejected and the device can take the SET
+	Endpoint string          `json:"endpoint,omitempty"` // where the SET would go: the Tr1d1um URL, or the USP agent
+	Payload  json.RawMessage `json:"payload,omitempty"`  // the WDMP body, or the USP Set message
+	// Device is the device's connectivity (online, suspect, offline or unknown) and Reason why it
+	// cannot take the SET, if so.
+	Device     string             `json:"device,omitempty"`
+	Reason     string             `json:"reason,omitempty"`
+	Parameters []PredictedOutcome `json:"parameters"`
+}
+
+// PredictedOutcome is the expected result of writing one parameter.
+type PredictedOutcome struct {
+	Name     string      `json:"name"`
+	Value    interface{} `json:"value,omitempty"`
+	DataType string      `json:"dataType,omitempty"` // from the catalog, else the type hint
+	Outcome  string      `json:"outcome"`
+	Current  interface{} `json:"current,omitempty"` // the cached value
+	Reason   string      `json:"reason,omitempty"`
 }
 
-// Get issues a multi-name GET or GET_ATTRIBUTES (when opts.Attributes != "").
+// Get issues a multi-name GET or GET_ATTRIBUTES (when opts.Attributes != ""). Names beyond
+// MaxGetNames are fetched in concurrent chunks; the first failing chunk fails the whole Get.
 func (a *DataModelAdapter) Get(ctx context.Context, deviceID dm.DeviceID, names []string, opts dm.GetOptions) (*GetResult, error) {
 	if len(names) == 0 {
 		return nil, errors.New("names required")
 	}
+	deviceID = deviceID.Canonical()
+	if len(names) <= a.chunk {
+		return a.getChunk(ctx, deviceID, names, opts)
+	}
+	var chunks [][]string
+	for len(names) > 0 {
+		n := min(a.chunk, len(names))
+		chunks = append(chunks, names[:n])
+		names = names[n:]
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]*GetResult, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, getChunkConcurrency)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				errs[i] = ctx.Err()
+				return
+			}
+			if results[i], errs[i] = a.getChunk(ctx, deviceID, chunk, opts); errs[i] != nil {
+				cancel() // the others would be discarded anyway
+			}
+		}()
+	}
+	wg.Wait()
+	// report the error that failed the Get, not the cancellations it caused
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	merged := &GetResult{Values: map[string]dm.ParameterValue{}}
+	raw := make([]json.RawMessage, len(results))
+	for i, r := range results {
+		for name, v := range r.Values {
+			merged.Values[name] = v
+		}
+		raw[i] = r.RawPayload
+		if !json.Valid(raw[i]) {
+			raw[i], _ = json.Marshal(string(r.RawPayload))
+		}
+	}
+	merged.RawPayload, _ = json.Marshal(raw)
+	return merged, nil
+}
+
+// getChunk issues a single GET for names.
+func (a *DataModelAdapter) getChunk(ctx context.Context, deviceID dm.DeviceID, names []string, opts dm.GetOptions) (*GetResult, error) {
 	// Build query per translation transport expectations: names=comma,separated; attributes flag when IncludeAttrs
 	q := url.Values{}
 	q.Set("names", strings.Join(names, ","))
@@ -91,6 +202,40 @@ func (a *DataModelAdapter) Get(ctx context.Context, deviceID dm.DeviceID, names
 	}
 	endpoint := fmt.Sprintf("%s/device/%s/%s?%s", a.baseURL, url.PathEscape(string(deviceID)), url.PathEscape(a.service), q.Encode())
 
+	var body []byte
+	err := a.retry.Do(ctx, func() (err error) {
+		body, err = a.get(ctx, endpoint)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Attempt to parse a minimal WDMP-style value map. Different services may vary; we keep it lenient.
+	// Common pattern: { "parameters": { "Device.Param": {"value":X,"timestamp":123} } }
+	var probe struct {
+		Parameters map[string]struct {
+			Value     interface{} `json:"value"`
+			Timestamp int64       `json:"timestamp"`
+		} `json:"parameters"`
+	}
+	_ = json.Unmarshal(body, &probe) // best effort
+
+	result := &GetResult{Values: map[string]dm.ParameterValue{}, RawPayload: json.RawMessage(body)}
+	for name, v := range probe.Parameters {
+		result.Values[name] = dm.ParameterValue{
+			Name:        name,
+			Value:       v.Value,
+			RetrievedAt: time.Unix(0, v.Timestamp*int64(time.Millisecond)),
+			Freshness:   dm.FreshRecentCache, // cannot differentiate precisely; treat as recent cache
+		}
+	}
+	return result, nil
+}
+
+// get fetches endpoint once, mapping error statuses onto devicemgr sentinels wrapped in the
+// *translate.StatusError the reply describes.
+func (a *DataModelAdapter) get(ctx context.Context, endpoint string) ([]byte, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, err
@@ -112,39 +257,26 @@ func (a *DataModelAdapter) Get(ctx context.Context, deviceID dm.DeviceID, names
 		return nil, err
 	}
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, dm.ErrDeviceNotFound
-	}
-	if resp.StatusCode == http.StatusForbidden {
-		return nil, dm.ErrAccessDenied
-	}
-	if resp.StatusCode >= 500 {
-		return nil, dm.ErrBackendUnavailable
-	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		return nil, translate.WrapStatus(body, statusError(resp, false))
 	}
+	return body, nil
+}
 
-	// Attempt to parse a minimal WDMP-style value map. Different services may vary; we keep it lenient.
-	// Common pattern: { "parameters": { "Device.Param": {"value":X,"timestamp":123} } }
-	var probe struct {
-		Parameters map[string]struct {
-			Value     interface{} `json:"value"`
-			Timestamp int64       `json:"timestamp"`
-		} `json:"parameters"`
+// statusError maps the error status of a Tr1d1um response onto devicemgr sentinels; conflict
+// maps 409 to dm.ErrConflict (a failed test-and-set).
+func statusError(resp *http.Response, conflict bool) error {
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return dm.ErrDeviceNotFound
+	case resp.StatusCode == http.StatusForbidden:
+		return dm.ErrAccessDenied
+	case conflict && resp.StatusCode == http.StatusConflict:
+		return dm.ErrConflict
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return dm.NewBackendError("tr1d1um", resp)
 	}
-	_ = json.Unmarshal(body, &probe) // best effort
-
-	result := &GetResult{Values: map[string]dm.ParameterValue{}, RawPayload: json.RawMessage(body)}
-	for name, v := range probe.Parameters {
-		result.Values[name] = dm.ParameterValue{
-			Name:        name,
-			Value:       v.Value,
-			RetrievedAt: time.Unix(0, v.Timestamp*int64(time.Millisecond)),
-			Freshness:   dm.FreshRecentCache, // cannot differentiate precisely; treat as recent cache
-		}
-	}
-	return result, nil
+	return fmt.Errorf("unexpected status %d", resp.StatusCode)
 }
 
 // Set issues a SET or SET_ATTRIBUTES based on supplied parameters.
@@ -152,14 +284,37 @@ func (a *DataModelAdapter) Set(ctx context.Context, deviceID dm.DeviceID, params
 	if len(params) == 0 {
 		return nil, errors.New("params required")
 	}
+	deviceID = deviceID.Canonical()
 	// Build WDMP payload JSON using builders.
 	payload, err := translate.BuildSet(params, opts.TestAndSet)
 	if err != nil {
 		return nil, err
 	}
+	if opts.DryRun {
+		return &SetResult{DryRun: &DryRunReport{Endpoint: a.endpoint(deviceID), Payload: payload}}, nil
+	}
+	return a.patch(ctx, deviceID, payload)
+}
 
-	endpoint := fmt.Sprintf("%s/device/%s/%s", a.baseURL, url.PathEscape(string(deviceID)), url.PathEscape(a.service))
-	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, endpoint, strings.NewReader(string(payload)))
+// SetAttributes issues a SET_ATTRIBUTES for attributes keyed by parameter name, e.g.
+// {"Device.WiFi.SSID.1.SSID": {"notify": 1}}. Attribute keys and values are validated by
+// translate.AttributeParams before anything is sent.
+func (a *DataModelAdapter) SetAttributes(ctx context.Context, deviceID dm.DeviceID, attrs map[string]map[string]interface{}) (*SetResult, error) {
+	payload, err := translate.BuildSetAttributes(attrs)
+	if err != nil {
+		return nil, err
+	}
+	return a.patch(ctx, deviceID.Canonical(), payload)
+}
+
+// endpoint is the Tr1d1um URL of the device's translation service.
+func (a *DataModelAdapter) endpoint(deviceID dm.DeviceID) string {
+	return fmt.Sprintf("%s/device/%s/%s", a.baseURL, url.PathEscape(string(deviceID)), url.PathEscape(a.service))
+}
+
+// patch sends a SET or SET_ATTRIBUTES payload once.
+func (a *DataModelAdapter) patch(ctx context.Context, deviceID dm.DeviceID, payload []byte) (*SetResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, a.endpoint(deviceID), strings.NewReader(string(payload)))
 	if err != nil {
 		return nil, err
 	}
@@ -179,20 +334,8 @@ func (a *DataModelAdapter) Set(ctx context.Context, deviceID dm.DeviceID, params
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, dm.ErrDeviceNotFound
-	}
-	if resp.StatusCode == http.StatusForbidden {
-		return nil, dm.ErrAccessDenied
-	}
-	if resp.StatusCode == http.StatusConflict {
-		return nil, dm.ErrConflict
-	}
-	if resp.StatusCode >= 500 {
-		return nil, dm.ErrBackendUnavailable
-	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		return nil, translate.WrapStatus(body, statusError(resp, true))
 	}
 
 	// Attempt parse applied names: some responses echo parameters or status structures.
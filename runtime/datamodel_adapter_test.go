@@ -3,12 +3,16 @@ package runtime
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/translate"
 )
 
 func TestDataModelAdapterGet(t *testing.T) {
@@ -94,3 +98,123 @@ func TestDeviceAdapterObjectDevices(t *testing.T) {
 		t.Fatalf("expected 3 ids, got %d", len(ids))
 	}
 }
+
+func TestDataModelAdapterRetriesGets(t *testing.T) {
+	var gets, sets int
+	srvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			sets++
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if gets++; gets < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"parameters":{"Device.X.Sample":{"value":42}}}`))
+	}))
+	defer srvr.Close()
+	ad, _ := NewDataModelAdapter(DataModelOptions{BaseURL: srvr.URL, Service: "config", Retry: dm.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}})
+	res, err := ad.Get(context.Background(), "mac:112233445566", []string{"Device.X.Sample"}, dm.GetOptions{})
+	if err != nil || len(res.Values) != 1 || gets != 3 {
+		t.Fatalf("get: %v after %d attempts", err, gets)
+	}
+	if _, err := ad.Set(context.Background(), "mac:112233445566", []dm.SetParameter{{Name: "Device.X.Sample", Value: 1}}, dm.SetOptions{}); err == nil || sets != 1 {
+		t.Fatalf("set: %v after %d attempts", err, sets)
+	}
+}
+
+func TestDataModelAdapterStatusError(t *testing.T) {
+	srvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(520)
+		w.Write([]byte(`{"statusCode":520,"message":"Failure","parameters":[{"name":"Device.X.Bogus","message":"Invalid parameter name"}]}`))
+	}))
+	defer srvr.Close()
+	ad, _ := NewDataModelAdapter(DataModelOptions{BaseURL: srvr.URL, Service: "config"})
+	_, err := ad.Set(context.Background(), "mac:112233445566", []dm.SetParameter{{Name: "Device.X.Bogus", Value: 1}}, dm.SetOptions{})
+	var se *translate.StatusError
+	if !errors.As(err, &se) || se.Status != 520 || se.Fault != 9005 || se.Parameter != "Device.X.Bogus" {
+		t.Fatalf("set: %v", err)
+	}
+	if !errors.Is(err, dm.ErrBackendUnavailable) {
+		t.Fatalf("set error lost its sentinel: %v", err)
+	}
+}
+
+func TestDataModelAdapterGetChunks(t *testing.T) {
+	var requests atomic.Int32
+	srvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		names := strings.Split(r.URL.Query().Get("names"), ",")
+		if len(names) > 2 {
+			t.Errorf("chunk of %d names", len(names))
+		}
+		params := map[string]any{}
+		for _, n := range names {
+			if n == "Device.Fail" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			params[n] = map[string]any{"value": n}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"parameters": params})
+	}))
+	defer srvr.Close()
+	ad, _ := NewDataModelAdapter(DataModelOptions{BaseURL: srvr.URL, Service: "config", MaxGetNames: 2})
+
+	names := []string{"Device.A", "Device.B", "Device.C", "Device.D", "Device.E"}
+	res, err := ad.Get(context.Background(), "mac:112233445566", names, dm.GetOptions{})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if requests.Load() != 3 || len(res.Values) != 5 || res.Values["Device.E"].Value != "Device.E" {
+		t.Fatalf("%d requests, values %+v", requests.Load(), res.Values)
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(res.RawPayload, &raw); err != nil || len(raw) != 3 {
+		t.Fatalf("raw payload %s: %v", res.RawPayload, err)
+	}
+
+	if _, err := ad.Get(context.Background(), "mac:112233445566", append(names, "Device.Fail"), dm.GetOptions{}); !errors.Is(err, dm.ErrAccessDenied) {
+		t.Fatalf("expected the failing chunk's error, got %v", err)
+	}
+}
+
+func TestDataModelAdapterSetAttributes(t *testing.T) {
+	var got map[string]any
+	srvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"statusCode":200}`))
+	}))
+	defer srvr.Close()
+	ad, _ := NewDataModelAdapter(DataModelOptions{BaseURL: srvr.URL, Service: "config"})
+
+	attrs := map[string]map[string]interface{}{
+		"Device.B": {"notify": 1.0},
+		"Device.A": {"notify": 0, "access": []interface{}{"Subscriber"}},
+	}
+	if _, err := ad.SetAttributes(context.Background(), "mac:112233445566", attrs); err != nil {
+		t.Fatalf("set attributes: %v", err)
+	}
+	params, _ := got["parameters"].([]any)
+	if got["command"] != "SET_ATTRIBUTES" || len(params) != 2 {
+		t.Fatalf("payload %+v", got)
+	}
+	if first, _ := params[0].(map[string]any); first["name"] != "Device.A" || first["value"] != nil {
+		t.Fatalf("first parameter %+v", first)
+	}
+
+	for _, bad := range []map[string]map[string]interface{}{
+		nil,
+		{"Device.A": {}},
+		{"Device.A": {"notify": 3}},
+		{"Device.A": {"notify": 0.5}},
+		{"Device.A": {"access": "Subscriber"}},
+		{"Device.A": {"visible": true}},
+	} {
+		got = nil
+		if _, err := ad.SetAttributes(context.Background(), "mac:112233445566", bad); !errors.Is(err, dm.ErrInvalidParameter) || got != nil {
+			t.Fatalf("%v: expected ErrInvalidParameter before sending, got %v", bad, err)
+		}
+	}
+}
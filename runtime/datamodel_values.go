@@ -0,0 +1,153 @@
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+var (
+	// ErrParameterMissing is returned by the GetResult accessors for names the device did not return.
+	ErrParameterMissing = errors.New("parameter missing from result")
+	// ErrParameterType is returned by the GetResult accessors for values of another type.
+	ErrParameterType = errors.New("parameter type mismatch")
+)
+
+// ParameterError reports a GetResult value that is missing or cannot be read as the requested
+// type. It carries the value's freshness, so a mismatch on a stale value can be told from a
+// device that changed the parameter's type. It wraps ErrParameterMissing or ErrParameterType.
+type ParameterError struct {
+	Name  string
+	Want  string // requested type
+	Value dm.ParameterValue
+	Err   error
+}
+
+func (e *ParameterError) Error() string {
+	if errors.Is(e.Err, ErrParameterMissing) {
+		return fmt.Sprintf("parameter %s: %v", e.Name, e.Err)
+	}
+	return fmt.Sprintf("parameter %s (%s, retrieved %s): %v: %#v is not %s", e.Name, e.Value.Freshness,
+		e.Value.RetrievedAt.UTC().Format("2006-01-02T15:04:05Z"), e.Err, e.Value.Value, e.Want)
+}
+
+func (e *ParameterError) Unwrap() error { return e.Err }
+
+// lookup returns the value of name, or a ParameterError when it is missing.
+func (r *GetResult) lookup(name string) (dm.ParameterValue, error) {
+	if r != nil {
+		if v, ok := r.Values[name]; ok {
+			return v, nil
+		}
+	}
+	return dm.ParameterValue{}, &ParameterError{Name: name, Err: ErrParameterMissing}
+}
+
+func mismatch(name, want string, v dm.ParameterValue) error {
+	return &ParameterError{Name: name, Want: want, Value: v, Err: ErrParameterType}
+}
+
+// String returns name's value as text. Numbers and booleans are formatted; other values are a
+// mismatch.
+func (r *GetResult) String(name string) (string, error) {
+	v, err := r.lookup(name)
+	if err != nil {
+		return "", err
+	}
+	switch x := v.Value.(type) {
+	case string:
+		return x, nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), nil
+	case int, int64, json.Number:
+		return fmt.Sprint(x), nil
+	}
+	return "", mismatch(name, "a string", v)
+}
+
+// Int returns name's value as an integer: a whole number, or text holding one (WDMP commonly
+// reports values as strings).
+func (r *GetResult) Int(name string) (int64, error) {
+	v, err := r.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	switch x := v.Value.(type) {
+	case int:
+		return int64(x), nil
+	case int64:
+		return x, nil
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1<<63 {
+			return int64(x), nil
+		}
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return n, nil
+		}
+	case string:
+		if n, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, mismatch(name, "an integer", v)
+}
+
+// Bool returns name's value as a boolean: a bool, 0 or 1, or text strconv.ParseBool accepts.
+func (r *GetResult) Bool(name string) (bool, error) {
+	v, err := r.lookup(name)
+	if err != nil {
+		return false, err
+	}
+	switch x := v.Value.(type) {
+	case bool:
+		return x, nil
+	case float64:
+		if x == 0 || x == 1 {
+			return x == 1, nil
+		}
+	case int:
+		if x == 0 || x == 1 {
+			return x == 1, nil
+		}
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(x)); err == nil {
+			return b, nil
+		}
+	}
+	return false, mismatch(name, "a boolean", v)
+}
+
+// MustUnmarshal decodes name's value into out as encoding/json would, requiring the parameter to
+// be present. Text values holding JSON (as structured parameters usually arrive) are decoded from
+// that text. It returns a ParameterError rather than panicking.
+func (r *GetResult) MustUnmarshal(name string, out interface{}) error {
+	v, err := r.lookup(name)
+	if err != nil {
+		return err
+	}
+	want := fmt.Sprintf("decodable into %T", out)
+	if text, ok := v.Value.(string); ok {
+		if json.Unmarshal([]byte(text), out) == nil {
+			return nil
+		}
+		// plain text: decode it as a JSON string
+		b, _ := json.Marshal(text)
+		if json.Unmarshal(b, out) != nil {
+			return mismatch(name, want, v)
+		}
+		return nil
+	}
+	b, err := json.Marshal(v.Value)
+	if err != nil || json.Unmarshal(b, out) != nil {
+		return mismatch(name, want, v)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package runtime
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestGetResultAccessors(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	res := &GetResult{Values: map[string]dm.ParameterValue{}}
+	for name, v := range map[string]interface{}{
+		"Device.DeviceInfo.UpTime":        "3600",
+		"Device.DeviceInfo.ModelName":     "XB7",
+		"Device.WiFi.Radio.1.Enable":      "true",
+		"Device.WiFi.Radio.1.Channel":     36.0,
+		"Device.X_Config":                 `{"mode":"mesh","nodes":3}`,
+		"Device.X_Stale":                  "n/a",
+		"Device.WiFi.AccessPoint.1.Count": 1.5,
+	} {
+		res.Values[name] = dm.ParameterValue{Name: name, Value: v, RetrievedAt: at, Freshness: dm.FreshRecentCache}
+	}
+	stale := res.Values["Device.X_Stale"]
+	stale.Freshness = dm.FreshStale
+	res.Values["Device.X_Stale"] = stale
+
+	if n, err := res.Int("Device.DeviceInfo.UpTime"); err != nil || n != 3600 {
+		t.Fatalf("uptime %d %v", n, err)
+	}
+	if n, err := res.Int("Device.WiFi.Radio.1.Channel"); err != nil || n != 36 {
+		t.Fatalf("channel %d %v", n, err)
+	}
+	if s, err := res.String("Device.WiFi.Radio.1.Channel"); err != nil || s != "36" {
+		t.Fatalf("channel text %q %v", s, err)
+	}
+	if s, err := res.String("Device.DeviceInfo.ModelName"); err != nil || s != "XB7" {
+		t.Fatalf("model %q %v", s, err)
+	}
+	if b, err := res.Bool("Device.WiFi.Radio.1.Enable"); err != nil || !b {
+		t.Fatalf("enable %v %v", b, err)
+	}
+	var cfg struct {
+		Mode  string `json:"mode"`
+		Nodes int    `json:"nodes"`
+	}
+	if err := res.MustUnmarshal("Device.X_Config", &cfg); err != nil || cfg.Mode != "mesh" || cfg.Nodes != 3 {
+		t.Fatalf("config %+v %v", cfg, err)
+	}
+	var model string
+	if err := res.MustUnmarshal("Device.DeviceInfo.ModelName", &model); err != nil || model != "XB7" {
+		t.Fatalf("model %q %v", model, err)
+	}
+
+	_, err := res.Int("Device.X_Stale")
+	var pe *ParameterError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrParameterType) || pe.Value.Freshness != dm.FreshStale || !strings.Contains(err.Error(), "stale") {
+		t.Fatalf("stale mismatch: %v", err)
+	}
+	if _, err := res.Int("Device.WiFi.AccessPoint.1.Count"); !errors.Is(err, ErrParameterType) {
+		t.Fatalf("fraction: %v", err)
+	}
+	if _, err := res.Bool("Device.Missing"); !errors.Is(err, ErrParameterMissing) {
+		t.Fatalf("missing: %v", err)
+	}
+	if err := res.MustUnmarshal("Device.Missing", &cfg); !errors.Is(err, ErrParameterMissing) {
+		t.Fatalf("missing unmarshal: %v", err)
+	}
+}
@@ -3,24 +3,86 @@ package runtime
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/xmidt-org/talaria/devicemgr"
 )
 
-// DeviceAdapter polls the Talaria /devices endpoint and provides synthetic events.
+// DeviceAdapter polls the Talaria /devices endpoint and provides synthetic events. Devices move
+// through a DeviceStateMachine, so one missing poll makes a device suspect rather than offline.
 type DeviceAdapter struct {
 	baseURL string
 	client  *http.Client
 	auth    devicemgr.AuthStrategy
+	retry   devicemgr.RetryPolicy // device list requests; guarded by mu
 
-	mu        sync.RWMutex
-	lastIDs   map[string]struct{}
+	view      atomic.Pointer[DeviceView] // swapped whole on every poll; readers never lock
+	states    *DeviceStateMachine
+	statCheck bool // confirm new suspects with Talaria's stat endpoint
+
+	mu        sync.RWMutex // serializes polls and guards listeners and store
 	listeners []chan devicemgr.Event
-	lastPoll  time.Time
+
+	store SnapshotStore // optional; shares poll results between replicas
+	index DeviceIndex   // rebuilt from every polled view; guarded by mu
+	// enrich returns extra metadata for a device (SetEnrichment); guarded by mu
+	enrich func(id string) map[string]string
+
+	instances []string                // Talaria instance base URLs polled instead of baseURL; guarded by mu
+	polls     map[string]InstancePoll // outcome of each instance's latest poll, by host; guarded by mu
+	hasher    devicemgr.ShardHasher   // SetShardHasher; guarded by mu
+	placement devicemgr.ShardRing     // hasher's ring over instances; nil without both; guarded by mu
+}
+
+// DeviceView is an immutable poll result: the devices in the poll plus those still suspect. Views
+// are shared between all readers, so neither the IDs slice nor the metadata maps may be modified.
+type DeviceView struct {
+	ids      []string                     // sorted
+	meta     map[string]map[string]string // per-device metadata captured from the poll (or an earlier one, for suspects)
+	polledAt time.Time
+}
+
+var emptyView = &DeviceView{}
+
+// IDs returns the device IDs, sorted. The slice is shared and must not be modified.
+func (v *DeviceView) IDs() []string { return v.ids }
+
+// Len returns the number of devices.
+func (v *DeviceView) Len() int { return len(v.ids) }
+
+// Has reports whether id was in the poll.
+func (v *DeviceView) Has(id string) bool {
+	i := sort.SearchStrings(v.ids, id)
+	return i < len(v.ids) && v.ids[i] == id
+}
+
+// Metadata returns the metadata captured for id (nil when none). The map is shared and must not be modified.
+func (v *DeviceView) Metadata(id string) map[string]string { return v.meta[id] }
+
+// PolledAt returns the time of the poll (zero before the first one).
+func (v *DeviceView) PolledAt() time.Time { return v.polledAt }
+
+// DeviceSnapshot is the serializable result of a poll.
+type DeviceSnapshot struct {
+	IDs      []string                     `json:"ids"`
+	Metadata map[string]map[string]string `json:"metadata,omitempty"`
+	PolledAt time.Time                    `json:"polledAt"`
+}
+
+// SnapshotStore persists the latest DeviceSnapshot so replicas that do not poll Talaria
+// themselves can serve the same device list.
+type SnapshotStore interface {
+	SaveSnapshot(ctx context.Context, s DeviceSnapshot) error
+	// LoadSnapshot returns nil without error when no snapshot has been saved yet.
+	LoadSnapshot(ctx context.Context) (*DeviceSnapshot, error)
 }
 
 type talariaDevicesResponse struct {
@@ -30,15 +92,112 @@ type talariaDevicesResponse struct {
 func NewDeviceAdapter(baseURL string, auth devicemgr.AuthStrategy) *DeviceAdapter {
 	return &DeviceAdapter{
 		baseURL: baseURL,
-		client:  &http.Client{Timeout: 10 * time.Second},
+		client:  NewClient(nil, 10*time.Second),
 		auth:    auth,
-		lastIDs: make(map[string]struct{}),
+		states:  NewDeviceStateMachine(StateMachineConfig{}),
+		index:   NewMemoryIndex(),
 	}
 }
 
-// PollOnce fetches the current devices and emits synthetic online/offline events.
-func (d *DeviceAdapter) PollOnce(ctx context.Context) ([]string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/v2/devices", d.baseURL), nil)
+// SetStateConfig replaces the state machine with one using cfg, forgetting tracked devices; with
+// statCheck, devices turning suspect are confirmed at once with Stat. Call it before the first poll.
+func (d *DeviceAdapter) SetStateConfig(cfg StateMachineConfig, statCheck bool) {
+	d.mu.Lock()
+	d.states = NewDeviceStateMachine(cfg)
+	d.statCheck = statCheck
+	d.mu.Unlock()
+}
+
+// UpdateStateConfig is SetStateConfig for a running adapter: tracked devices keep their status.
+func (d *DeviceAdapter) UpdateStateConfig(cfg StateMachineConfig, statCheck bool) {
+	d.mu.Lock()
+	d.states.SetConfig(cfg)
+	d.statCheck = statCheck
+	d.mu.Unlock()
+}
+
+// Statuses returns the tracked status of every device, including offline devices not yet forgotten.
+func (d *DeviceAdapter) Statuses() map[devicemgr.DeviceID]DeviceStatus {
+	d.mu.RLock()
+	states := d.states
+	d.mu.RUnlock()
+	return states.Statuses()
+}
+
+// Status returns the device's tracked status and when it was entered.
+func (d *DeviceAdapter) Status(id string) (DeviceStatus, time.Time) {
+	d.mu.RLock()
+	states := d.states
+	d.mu.RUnlock()
+	return states.Status(devicemgr.DeviceID(id))
+}
+
+// Stat asks Talaria whether the device is connected (GET /api/v2/device/{id}/stat) and applies
+// the answer to its status: a 404 takes a device offline at once, success brings it online.
+func (d *DeviceAdapter) Stat(ctx context.Context, id string) (bool, error) {
+	resp, err := d.stat(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// DeviceStatistics is Talaria's view of a device's connection, from its stat endpoint.
+type DeviceStatistics struct {
+	ID               string        `json:"id"`
+	Pending          int           `json:"pending"` // messages queued for the device
+	BytesSent        int64         `json:"bytesSent"`
+	MessagesSent     int64         `json:"messagesSent"`
+	BytesReceived    int64         `json:"bytesReceived"`
+	MessagesReceived int64         `json:"messagesReceived"`
+	Duplications     int64         `json:"duplications"` // connections replaced by a newer one from the same device
+	ConnectedAt      time.Time     `json:"connectedAt"`
+	UpTime           time.Duration `json:"upTime"`
+}
+
+// Statistics reads the device's connection statistics from Talaria, applying the answer to its
+// status as Stat does. A device Talaria does not hold reports devicemgr.ErrDeviceOffline.
+func (d *DeviceAdapter) Statistics(ctx context.Context, id string) (DeviceStatistics, error) {
+	resp, err := d.stat(ctx, id)
+	if err != nil {
+		return DeviceStatistics{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return DeviceStatistics{}, fmt.Errorf("talaria: %s: %w", id, devicemgr.ErrDeviceOffline)
+	}
+	var body struct {
+		ID         string `json:"id"`
+		Pending    int    `json:"pending"`
+		Statistics struct {
+			BytesSent        int64     `json:"bytesSent"`
+			MessagesSent     int64     `json:"messagesSent"`
+			BytesReceived    int64     `json:"bytesReceived"`
+			MessagesReceived int64     `json:"messagesReceived"`
+			Duplications     int64     `json:"duplications"`
+			ConnectedAt      time.Time `json:"connectedAt"`
+			UpTime           string    `json:"upTime"` // Go duration
+		} `json:"statistics"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return DeviceStatistics{}, fmt.Errorf("talaria: decode stat: %w", err)
+	}
+	st := body.Statistics
+	out := DeviceStatistics{ID: id, Pending: body.Pending, BytesSent: st.BytesSent, MessagesSent: st.MessagesSent,
+		BytesReceived: st.BytesReceived, MessagesReceived: st.MessagesReceived, Duplications: st.Duplications, ConnectedAt: st.ConnectedAt}
+	if up, err := time.ParseDuration(st.UpTime); err == nil {
+		out.UpTime = up
+	} else if !st.ConnectedAt.IsZero() {
+		out.UpTime = time.Since(st.ConnectedAt)
+	}
+	return out, nil
+}
+
+// stat requests the device's stat once and observes the outcome. The returned response is 200 or
+// 404; other statuses are errors.
+func (d *DeviceAdapter) stat(ctx context.Context, id string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/v2/device/%s/stat", d.baseURL, url.PathEscape(id)), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -47,65 +206,356 @@ func (d *DeviceAdapter) PollOnce(ctx context.Context) ([]string, error) {
 			req.Header.Set("Authorization", v)
 		}
 	}
-	resp, err := d.client.Do(req)
+	d.mu.RLock()
+	client := d.client
+	d.mu.RUnlock()
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		d.Observe(id, ObservedConnected, "stat: connected")
+		return resp, nil
+	case http.StatusNotFound:
+		d.Observe(id, ObservedDisconnected, "stat: not connected")
+		return resp, nil
 	}
-	var parsed talariaDevicesResponse
-	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+	resp.Body.Close()
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, devicemgr.NewBackendError("talaria", resp)
+	}
+	return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+}
+
+// Observe feeds an observation from outside the poll (a stat check, or a connect or disconnect
+// event from another source) to the state machine, emitting the resulting transition. A device
+// going offline leaves the view at once; one coming online joins it with the next poll.
+func (d *DeviceAdapter) Observe(id string, o Observation, reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.states.Observe(devicemgr.DeviceID(id), o, reason, time.Now())
+	if !ok {
+		return
+	}
+	if t.To == StatusOffline {
+		if prev := d.View(); prev.Has(id) {
+			ids := make([]string, 0, len(prev.ids)-1)
+			for _, known := range prev.ids {
+				if known != id {
+					ids = append(ids, known)
+				}
+			}
+			d.view.Store(&DeviceView{ids: ids, meta: prev.meta, polledAt: prev.polledAt})
+		}
+	}
+	d.broadcast(t.Event("synthetic-poll"))
+}
+
+// PollOnce fetches the current devices and emits synthetic online/offline events. With
+// SetInstances it polls every instance instead of the base URL; see pollInstances.
+func (d *DeviceAdapter) PollOnce(ctx context.Context) ([]string, error) {
+	d.mu.RLock()
+	retry, instances := d.retry, d.instances
+	d.mu.RUnlock()
+	var (
+		ids  []string
+		meta map[string]map[string]string
+		err  error
+	)
+	if len(instances) > 0 {
+		ids, meta, err = d.pollInstances(ctx, retry, instances)
+	} else {
+		ids, meta, err = d.pollList(ctx, retry, d.baseURL)
+	}
+	if err != nil {
 		return nil, err
 	}
+	polledAt := time.Now()
+	suspects := d.emitDiff(ids, meta, polledAt)
+	d.mu.RLock()
+	statCheck := d.statCheck
+	d.mu.RUnlock()
+	if statCheck {
+		for _, id := range suspects {
+			// failed checks leave the device suspect until later polls decide
+			_, _ = d.Stat(ctx, id)
+		}
+	}
+	if d.store != nil {
+		if err := d.store.SaveSnapshot(ctx, DeviceSnapshot{IDs: ids, Metadata: meta, PolledAt: polledAt}); err != nil {
+			return ids, fmt.Errorf("save snapshot: %w", err)
+		}
+	}
+	return ids, nil
+}
+
+// pollList fetches and parses the device list of the Talaria at baseURL.
+func (d *DeviceAdapter) pollList(ctx context.Context, retry devicemgr.RetryPolicy, baseURL string) ([]string, map[string]map[string]string, error) {
+	var parsed talariaDevicesResponse
+	err := retry.Do(ctx, func() (err error) {
+		parsed, err = d.fetchDevices(ctx, baseURL)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
 	// attempt to parse devices
 	var rawAny []interface{}
 	if err := json.Unmarshal(parsed.Devices, &rawAny); err != nil {
-		return nil, fmt.Errorf("unexpected devices format: %w", err)
+		return nil, nil, fmt.Errorf("unexpected devices format: %w", err)
 	}
 	ids := make([]string, 0, len(rawAny))
+	meta := make(map[string]map[string]string)
 	for _, elem := range rawAny {
 		switch v := elem.(type) {
 		case string:
-			ids = append(ids, v)
+			ids = append(ids, string(devicemgr.DeviceID(v).Canonical()))
 		case map[string]interface{}:
 			// Accept common keys
 			for _, k := range []string{"id", "deviceId", "deviceID", "mac"} {
 				if val, ok := v[k]; ok {
 					if s, ok := val.(string); ok && s != "" {
+						s = string(devicemgr.DeviceID(s).Canonical())
 						ids = append(ids, s)
+						if m := deviceMetadata(v); m != nil {
+							meta[s] = m
+						}
 						break
 					}
 				}
 			}
 		}
 	}
-	d.emitDiff(ids)
-	return ids, nil
+	return ids, meta, nil
 }
 
-func (d *DeviceAdapter) emitDiff(current []string) {
+// fetchDevices requests the device list once; 429 and 5xx statuses report a *devicemgr.BackendError.
+func (d *DeviceAdapter) fetchDevices(ctx context.Context, baseURL string) (talariaDevicesResponse, error) {
+	var parsed talariaDevicesResponse
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/v2/devices", baseURL), nil)
+	if err != nil {
+		return parsed, err
+	}
+	if d.auth != nil {
+		if v, e := d.auth.AuthorizationValue(); e == nil {
+			req.Header.Set("Authorization", v)
+		}
+	}
+	d.mu.RLock()
+	client := d.client
+	d.mu.RUnlock()
+	resp, err := client.Do(req)
+	if err != nil {
+		return parsed, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return parsed, devicemgr.NewBackendError("talaria", resp)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return parsed, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&parsed)
+	return parsed, err
+}
+
+// SetRetryPolicy sets how failed device list requests are retried (by default they are not).
+func (d *DeviceAdapter) SetRetryPolicy(p devicemgr.RetryPolicy) {
+	d.mu.Lock()
+	d.retry = p
+	d.mu.Unlock()
+}
+
+// SetHTTPClient replaces the client used to poll Talaria.
+func (d *DeviceAdapter) SetHTTPClient(c *http.Client) {
+	d.mu.Lock()
+	d.client = c
+	d.mu.Unlock()
+}
+
+// SetSnapshotStore attaches a store that PollOnce writes to and RefreshFromStore reads from.
+func (d *DeviceAdapter) SetSnapshotStore(s SnapshotStore) {
+	d.mu.Lock()
+	d.store = s
+	d.mu.Unlock()
+}
+
+// RefreshFromStore applies the shared snapshot (written by whichever replica polls) instead of
+// polling Talaria, emitting the same synthetic online/offline events as PollOnce.
+func (d *DeviceAdapter) RefreshFromStore(ctx context.Context) ([]string, error) {
+	d.mu.RLock()
+	store := d.store
+	d.mu.RUnlock()
+	if store == nil {
+		return nil, errors.New("no snapshot store configured")
+	}
+	snap, err := store.LoadSnapshot(ctx)
+	if err != nil || snap == nil {
+		return nil, err
+	}
+	d.emitDiff(snap.IDs, snap.Metadata, snap.PolledAt)
+	return snap.IDs, nil
+}
+
+// SetEnrichment sets a lookup of extra metadata merged into every device's metadata from the next
+// poll on, so views, searches and Metadata include it. Keys the poll reports take precedence.
+func (d *DeviceAdapter) SetEnrichment(enrich func(id string) map[string]string) {
+	d.mu.Lock()
+	d.enrich = enrich
+	d.mu.Unlock()
+}
+
+// SetIndex replaces the search index (a MemoryIndex by default) and builds it from the current
+// view. Rebuild is called with polls serialized, so backends should return promptly.
+func (d *DeviceAdapter) SetIndex(ix DeviceIndex) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	currSet := make(map[string]struct{}, len(current))
-	for _, id := range current {
-		currSet[id] = struct{}{}
+	d.index = ix
+	ix.Rebuild(d.View())
+}
+
+// Search returns the sorted IDs of the devices in the current view matching q. Devices dropped
+// from the view since the last poll (having gone offline) are left out even if still indexed.
+func (d *DeviceAdapter) Search(q DeviceQuery) ([]string, error) {
+	d.mu.RLock()
+	ix := d.index
+	d.mu.RUnlock()
+	ids, err := ix.Search(q)
+	if err != nil {
+		return nil, err
 	}
-	d.lastPoll = time.Now()
-	// online events
-	for id := range currSet {
-		if _, existed := d.lastIDs[id]; !existed {
-			d.broadcast(devicemgr.Event{Kind: devicemgr.EventOnline, DeviceID: devicemgr.DeviceID(id), OccurredAt: time.Now(), Source: "synthetic-poll"})
+	view := d.View()
+	out := ids[:0]
+	for _, id := range ids {
+		if view.Has(id) {
+			out = append(out, id)
 		}
 	}
-	// offline events
-	for id := range d.lastIDs {
-		if _, still := currSet[id]; !still {
-			d.broadcast(devicemgr.Event{Kind: devicemgr.EventOffline, DeviceID: devicemgr.DeviceID(id), OccurredAt: time.Now(), Source: "synthetic-poll"})
+	return out, nil
+}
+
+// deviceMetadata extracts partner ownership (see partnerIDs) and the model and firmware a device
+// object reports at its top level or under "metadata" or "convey"; nil when it has none.
+func deviceMetadata(obj map[string]interface{}) map[string]string {
+	out := make(map[string]string)
+	if partners := partnerIDs(obj); partners != "" {
+		out[devicemgr.MetadataPartnerIDs] = partners
+	}
+	nested := func(k string) map[string]interface{} {
+		m, _ := obj[k].(map[string]interface{})
+		return m
+	}
+	for _, src := range []map[string]interface{}{obj, nested("metadata"), nested("convey")} {
+		for _, k := range []string{devicemgr.MetadataModel, devicemgr.MetadataFirmware} {
+			if v, ok := src[k].(string); ok && v != "" && out[k] == "" {
+				out[k] = v
+			}
 		}
 	}
-	d.lastIDs = currSet
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// partnerIDs extracts partner ownership from a device object; Talaria variants use a
+// string or string array under one of several keys. Returned comma-separated.
+func partnerIDs(obj map[string]interface{}) string {
+	for _, k := range []string{"partnerIDs", "partnerIds", "partner-ids", "partnerId"} {
+		switch v := obj[k].(type) {
+		case string:
+			return v
+		case []interface{}:
+			parts := make([]string, 0, len(v))
+			for _, p := range v {
+				if s, ok := p.(string); ok && s != "" {
+					parts = append(parts, s)
+				}
+			}
+			return strings.Join(parts, ",")
+		}
+	}
+	return ""
+}
+
+// emitDiff applies a poll result to the state machine, swaps in the new view and emits the
+// transitions; it returns the devices that turned suspect.
+func (d *DeviceAdapter) emitDiff(current []string, meta map[string]map[string]string, polledAt time.Time) []string {
+	ids := append([]string(nil), current...)
+	sort.Strings(ids)
+	// drop duplicates so Has and the state machine see each device once
+	uniq := ids[:0]
+	for i, id := range ids {
+		if i == 0 || id != ids[i-1] {
+			uniq = append(uniq, id)
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	prev := d.View()
+	if d.enrich != nil {
+		meta = enrichMetadata(uniq, meta, d.enrich)
+	}
+	transitions := d.states.ApplyPoll(uniq, polledAt)
+	// suspects stay listed, with the metadata of the poll that last saw them
+	var suspects []string
+	for _, t := range transitions {
+		if t.To == StatusSuspect {
+			suspects = append(suspects, string(t.DeviceID))
+		}
+	}
+	var kept []string
+	for _, id := range prev.ids {
+		if st, _ := d.states.Status(devicemgr.DeviceID(id)); st == StatusSuspect {
+			kept = append(kept, id)
+		}
+	}
+	if len(kept) > 0 {
+		uniq = append(uniq, kept...)
+		sort.Strings(uniq)
+		merged := make(map[string]map[string]string, len(meta)+len(kept))
+		for id, m := range meta {
+			merged[id] = m
+		}
+		for _, id := range kept {
+			if m := prev.meta[id]; m != nil {
+				merged[id] = m
+			}
+		}
+		meta = merged
+	}
+	view := &DeviceView{ids: uniq, meta: meta, polledAt: polledAt}
+	d.view.Store(view)
+	d.index.Rebuild(view)
+	for _, t := range transitions {
+		d.broadcast(t.Event("synthetic-poll"))
+	}
+	return suspects
+}
+
+// enrichMetadata returns meta with each device's enrichment added under the keys the poll did not
+// report. The poll's maps are left unmodified.
+func enrichMetadata(ids []string, meta map[string]map[string]string, enrich func(id string) map[string]string) map[string]map[string]string {
+	out := make(map[string]map[string]string, len(meta))
+	for id, m := range meta {
+		out[id] = m
+	}
+	for _, id := range ids {
+		extra := enrich(id)
+		if len(extra) == 0 {
+			continue
+		}
+		m := make(map[string]string, len(meta[id])+len(extra))
+		for k, v := range extra {
+			m[k] = v
+		}
+		for k, v := range meta[id] {
+			m[k] = v
+		}
+		out[id] = m
+	}
+	return out
 }
 
 func (d *DeviceAdapter) broadcast(e devicemgr.Event) {
@@ -117,15 +567,31 @@ func (d *DeviceAdapter) broadcast(e devicemgr.Event) {
 	}
 }
 
-// Snapshot returns current known device IDs plus last poll time.
+// View returns the latest poll result without locking or copying.
+func (d *DeviceAdapter) View() *DeviceView {
+	if v := d.view.Load(); v != nil {
+		return v
+	}
+	return emptyView
+}
+
+// Snapshot returns a copy of the current known device IDs, sorted, plus last poll time.
 func (d *DeviceAdapter) Snapshot() (ids []string, lastPoll time.Time) {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
-	ids = make([]string, 0, len(d.lastIDs))
-	for id := range d.lastIDs {
-		ids = append(ids, id)
+	v := d.View()
+	return append(make([]string, 0, len(v.ids)), v.ids...), v.polledAt
+}
+
+// Metadata returns a copy of the metadata captured for a device on the last poll (nil when none).
+func (d *DeviceAdapter) Metadata(id string) map[string]string {
+	src := d.View().meta[id]
+	if src == nil {
+		return nil
 	}
-	return ids, d.lastPoll
+	out := make(map[string]string, len(src))
+	for k, v := range src {
+		out[k] = v
+	}
+	return out
 }
 
 // Subscribe returns an event subscription channel.
@@ -134,7 +600,20 @@ func (d *DeviceAdapter) Subscribe(buffer int) devicemgr.EventSubscription {
 	d.mu.Lock()
 	d.listeners = append(d.listeners, ch)
 	d.mu.Unlock()
-	return &eventSub{ch: ch, closeFn: func() { close(ch) }}
+	return &eventSub{ch: ch, closeFn: func() { d.unsubscribe(ch) }}
+}
+
+// unsubscribe removes ch from the listeners before closing it so broadcast never sends on a closed channel.
+func (d *DeviceAdapter) unsubscribe(ch chan devicemgr.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, l := range d.listeners {
+		if l == ch {
+			d.listeners = append(d.listeners[:i:i], d.listeners[i+1:]...)
+			break
+		}
+	}
+	close(ch)
 }
 
 type eventSub struct {
@@ -0,0 +1,84 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Budgets for these benchmarks are listed in docs/performance.md.
+
+func benchIDs(n, offset int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("mac:%012x", i+offset)
+	}
+	return ids
+}
+
+// BenchmarkPollDiff measures swapping in a 10k-device poll in which 1% of the devices changed.
+func BenchmarkPollDiff(b *testing.B) {
+	d := NewDeviceAdapter("", nil)
+	polls := [][]string{benchIDs(10000, 0), benchIDs(10000, 100)}
+	d.emitDiff(polls[1], nil, time.Now())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.emitDiff(polls[i%2], nil, time.Now())
+	}
+}
+
+// BenchmarkPollOnce measures a full poll of a 10k-device Talaria response, including decoding.
+func BenchmarkPollOnce(b *testing.B) {
+	body := []byte(`{"devices":[`)
+	for i, id := range benchIDs(10000, 0) {
+		if i > 0 {
+			body = append(body, ',')
+		}
+		body = append(body, fmt.Sprintf(`{"id":%q,"partnerIDs":["comcast"]}`, id)...)
+	}
+	body = append(body, "]}"...)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(body) }))
+	defer srv.Close()
+	d := NewDeviceAdapter(srv.URL, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.PollOnce(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkBroadcastFanout measures delivering one event to 100 subscribers.
+func BenchmarkBroadcastFanout(b *testing.B) {
+	d := NewDeviceAdapter("", nil)
+	for i := 0; i < 100; i++ {
+		sub := d.Subscribe(1)
+		defer sub.Close()
+	}
+	evt := devicemgr.Event{Kind: devicemgr.EventOnline, DeviceID: "mac:112233445566", OccurredAt: time.Now(), Source: "bench"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// full buffers take the drop path after the first round, as with slow consumers
+		d.broadcast(evt)
+	}
+}
+
+// BenchmarkViewHas measures the lock-free device lookup served to API requests.
+func BenchmarkViewHas(b *testing.B) {
+	d := NewDeviceAdapter("", nil)
+	d.emitDiff(benchIDs(50000, 0), nil, time.Now())
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = d.View().Has("mac:00000000c350")
+		}
+	})
+}
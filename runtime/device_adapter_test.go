@@ -0,0 +1,135 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestDeviceAdapterPollView(t *testing.T) {
+	body := `{"devices":["mac:3","mac:1",{"id":"mac:2","partnerIDs":["comcast"]}]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	d := NewDeviceAdapter(srv.URL, nil)
+	if d.View().Len() != 0 || !d.View().PolledAt().IsZero() {
+		t.Fatal("expected an empty view before the first poll")
+	}
+	sub := d.Subscribe(16)
+	defer sub.Close()
+	if _, err := d.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	first := d.View()
+	if ids := first.IDs(); len(ids) != 3 || ids[0] != "mac:1" || ids[2] != "mac:3" {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+	if !first.Has("mac:2") || first.Has("mac:4") || first.Metadata("mac:2")[devicemgr.MetadataPartnerIDs] != "comcast" {
+		t.Fatalf("unexpected view %+v", first)
+	}
+	body = `{"devices":["mac:2","mac:4"]}`
+	if _, err := d.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the earlier view is unchanged by the swap; devices missing once stay listed as suspects
+	if first.Len() != 3 || d.View().Len() != 4 || d.View().Metadata("mac:2") != nil {
+		t.Fatalf("views %v %v", first.IDs(), d.View().IDs())
+	}
+	if st, _ := d.Status("mac:1"); st != StatusSuspect {
+		t.Fatalf("mac:1 is %s", st)
+	}
+	if _, err := d.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ids := d.View().IDs(); len(ids) != 2 || ids[0] != "mac:2" || ids[1] != "mac:4" {
+		t.Fatalf("unexpected ids after the second miss %v", ids)
+	}
+	got := map[string]devicemgr.EventKind{}
+	for len(sub.C()) > 0 {
+		e := <-sub.C()
+		got[string(e.DeviceID)+" "+string(e.Kind)] = e.Kind
+	}
+	for _, want := range []string{"mac:1 online", "mac:2 online", "mac:3 online", "mac:1 suspect", "mac:3 suspect", "mac:4 online", "mac:1 offline", "mac:3 offline"} {
+		if _, ok := got[want]; !ok {
+			t.Errorf("missing event %s in %v", want, got)
+		}
+	}
+	if len(got) != 8 {
+		t.Errorf("unexpected events %v", got)
+	}
+}
+
+func TestDeviceAdapterStatSuspects(t *testing.T) {
+	body := `{"devices":["mac:1","mac:2"]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/devices":
+			w.Write([]byte(body))
+		case "/api/v2/device/mac:1/stat":
+			w.Write([]byte(`{"id":"mac:1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	d := NewDeviceAdapter(srv.URL, nil)
+	d.SetStateConfig(StateMachineConfig{OfflineAfter: 3}, true)
+	if _, err := d.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sub := d.Subscribe(16)
+	defer sub.Close()
+	body = `{"devices":[]}`
+	if _, err := d.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// mac:1 is still connected according to stat, mac:2 is confirmed gone
+	if st, _ := d.Status("mac:1"); st != StatusOnline {
+		t.Fatalf("mac:1 is %s", st)
+	}
+	if st, _ := d.Status("mac:2"); st != StatusOffline {
+		t.Fatalf("mac:2 is %s", st)
+	}
+	if ids := d.View().IDs(); len(ids) != 1 || ids[0] != "mac:1" {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+	var offline Transition
+	for len(sub.C()) > 0 {
+		if e := <-sub.C(); e.Kind == devicemgr.EventOffline {
+			offline = e.Payload.(Transition)
+		}
+	}
+	if offline.DeviceID != "mac:2" || offline.From != StatusSuspect || offline.Reason != "stat: not connected" {
+		t.Fatalf("unexpected offline transition %+v", offline)
+	}
+}
+
+func TestDeviceAdapterStatistics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/device/mac:1/stat" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"id":"mac:1","pending":2,"statistics":{"bytesSent":100,"messagesSent":3,"bytesReceived":2048,` +
+			`"messagesReceived":7,"duplications":1,"connectedAt":"2024-05-01T12:00:00Z","upTime":"1h30m0s"}}`))
+	}))
+	defer srv.Close()
+	d := NewDeviceAdapter(srv.URL, nil)
+	st, err := d.Statistics(context.Background(), "mac:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Pending != 2 || st.BytesReceived != 2048 || st.MessagesReceived != 7 || st.Duplications != 1 ||
+		st.UpTime != 90*time.Minute || st.ConnectedAt.Hour() != 12 {
+		t.Fatalf("statistics %+v", st)
+	}
+	if _, err := d.Statistics(context.Background(), "mac:2"); !errors.Is(err, devicemgr.ErrDeviceOffline) {
+		t.Fatalf("unknown device: %v", err)
+	}
+}
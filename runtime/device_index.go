@@ -0,0 +1,153 @@
+package runtime
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xmidt-org/talaria/devicemgr"
+)
+
+// QueryFields maps the short field names accepted in device queries to metadata keys; other
+// field names are used as metadata keys directly.
+var QueryFields = map[string]string{
+	"model":    devicemgr.MetadataModel,
+	"firmware": devicemgr.MetadataFirmware,
+	"partner":  devicemgr.MetadataPartnerIDs,
+}
+
+// QueryTerm matches devices whose metadata Field equals Value, ignoring case. A Value ending in
+// "*" matches as a prefix.
+type QueryTerm struct {
+	Field string
+	Value string
+}
+
+// DeviceQuery is a list of terms a device must all match.
+type DeviceQuery []QueryTerm
+
+// ParseDeviceQuery parses space-separated field:value terms, e.g. "model:XB7 firmware:1.2*".
+// Field names go through QueryFields.
+func ParseDeviceQuery(s string) (DeviceQuery, error) {
+	var q DeviceQuery
+	for _, term := range strings.Fields(s) {
+		field, value, ok := strings.Cut(term, ":")
+		if !ok || field == "" || value == "" || value == "*" {
+			return nil, fmt.Errorf("query term %q: want field:value: %w", term, devicemgr.ErrInvalidParameter)
+		}
+		if key, ok := QueryFields[strings.ToLower(field)]; ok {
+			field = key
+		}
+		q = append(q, QueryTerm{Field: field, Value: value})
+	}
+	if len(q) == 0 {
+		return nil, fmt.Errorf("empty query: %w", devicemgr.ErrInvalidParameter)
+	}
+	return q, nil
+}
+
+// DeviceIndex answers device queries without scanning the snapshot. DeviceAdapter rebuilds it
+// after each poll; MemoryIndex is the default, and larger deployments can plug in an external
+// search backend with SetIndex.
+type DeviceIndex interface {
+	// Rebuild replaces the indexed devices with those of view.
+	Rebuild(view *DeviceView)
+	// Search returns the IDs of matching devices, sorted.
+	Search(q DeviceQuery) ([]string, error)
+}
+
+// MemoryIndex is an in-memory inverted index from each metadata field and lowercased value to
+// the sorted IDs of the devices holding it. Partner IDs are indexed one partner at a time.
+type MemoryIndex struct {
+	mu     sync.RWMutex
+	fields map[string]map[string][]string
+}
+
+// NewMemoryIndex returns an empty index.
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{fields: make(map[string]map[string][]string)}
+}
+
+func (ix *MemoryIndex) Rebuild(view *DeviceView) {
+	fields := make(map[string]map[string][]string)
+	add := func(field, value, id string) {
+		values := fields[field]
+		if values == nil {
+			values = make(map[string][]string)
+			fields[field] = values
+		}
+		values[strings.ToLower(value)] = append(values[strings.ToLower(value)], id)
+	}
+	// IDs are visited in sorted order, so every posting list is sorted
+	for _, id := range view.IDs() {
+		for field, value := range view.Metadata(id) {
+			if field == devicemgr.MetadataPartnerIDs {
+				for _, p := range devicemgr.SplitPartners(value) {
+					add(field, p, id)
+				}
+				continue
+			}
+			add(field, value, id)
+		}
+	}
+	ix.mu.Lock()
+	ix.fields = fields
+	ix.mu.Unlock()
+}
+
+func (ix *MemoryIndex) Search(q DeviceQuery) ([]string, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	lists := make([][]string, 0, len(q))
+	for _, t := range q {
+		lists = append(lists, ix.lookup(t))
+	}
+	// intersect starting from the shortest list
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	var out []string
+	for i, l := range lists {
+		if i == 0 {
+			out = slices.Clone(l)
+			continue
+		}
+		out = intersectSorted(out, l)
+	}
+	return out, nil
+}
+
+// lookup returns the sorted IDs matching t.
+func (ix *MemoryIndex) lookup(t QueryTerm) []string {
+	values := ix.fields[t.Field]
+	value := strings.ToLower(t.Value)
+	prefix, ok := strings.CutSuffix(value, "*")
+	if !ok {
+		return values[value]
+	}
+	var out []string
+	for v, ids := range values {
+		if strings.HasPrefix(v, prefix) {
+			out = append(out, ids...)
+		}
+	}
+	sort.Strings(out)
+	return slices.Compact(out)
+}
+
+func intersectSorted(a, b []string) []string {
+	out := a[:0]
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, a[i])
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestParseDeviceQuery(t *testing.T) {
+	q, err := ParseDeviceQuery(" model:XB7  firmware:1.2* partner:comcast serial:abc ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DeviceQuery{
+		{Field: devicemgr.MetadataModel, Value: "XB7"},
+		{Field: devicemgr.MetadataFirmware, Value: "1.2*"},
+		{Field: devicemgr.MetadataPartnerIDs, Value: "comcast"},
+		{Field: "serial", Value: "abc"},
+	}
+	if !slices.Equal(q, want) {
+		t.Fatalf("got %v", q)
+	}
+	for _, bad := range []string{"", "  ", "XB7", "model:", ":XB7", "model:*"} {
+		if _, err := ParseDeviceQuery(bad); !errors.Is(err, devicemgr.ErrInvalidParameter) {
+			t.Errorf("%q: got %v", bad, err)
+		}
+	}
+}
+
+func TestDeviceAdapterSearch(t *testing.T) {
+	body := `{"devices":[
+		{"id":"mac:000000000001","hw-model":"XB7","fw-name":"1.2.3","partnerIDs":["comcast","sky"]},
+		{"id":"mac:000000000002","metadata":{"hw-model":"xb7","fw-name":"1.3.0"},"partnerIDs":"comcast"},
+		{"id":"mac:000000000003","hw-model":"XB6","fw-name":"1.2.9"},
+		"mac:000000000004"]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	d := NewDeviceAdapter(srv.URL, nil)
+	if _, err := d.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	search := func(s string) []string {
+		t.Helper()
+		q, err := ParseDeviceQuery(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids, err := d.Search(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+	for query, want := range map[string][]string{
+		"model:XB7":                  {"mac:000000000001", "mac:000000000002"},
+		"model:xb7 firmware:1.2*":    {"mac:000000000001"},
+		"firmware:1.2*":              {"mac:000000000001", "mac:000000000003"},
+		"partner:sky":                {"mac:000000000001"},
+		"partner:comcast model:XB6":  nil,
+		"model:XB9":                  nil,
+		"hw-model:XB6 fw-name:1.2.9": {"mac:000000000003"},
+	} {
+		if got := search(query); !slices.Equal(got, want) {
+			t.Errorf("%q: got %v, want %v", query, got, want)
+		}
+	}
+
+	// the index follows the next poll
+	body = `{"devices":[{"id":"mac:000000000005","hw-model":"XB7"}]}`
+	if _, err := d.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// devices missing from this poll stay suspect with their earlier metadata
+	if got := search("model:XB7"); !slices.Equal(got, []string{"mac:000000000001", "mac:000000000002", "mac:000000000005"}) {
+		t.Fatalf("after poll: %v", got)
+	}
+	d.Observe("mac:000000000001", ObservedDisconnected, "test")
+	if got := search("model:XB7"); !slices.Equal(got, []string{"mac:000000000002", "mac:000000000005"}) {
+		t.Fatalf("after offline: %v", got)
+	}
+
+	d.SetIndex(stubIndex{"mac:000000000005", "mac:999999999999"})
+	if got := search("model:anything"); !slices.Equal(got, []string{"mac:000000000005"}) {
+		t.Fatalf("plugged index: %v", got)
+	}
+}
+
+// stubIndex answers every query with the same IDs.
+type stubIndex []string
+
+func (s stubIndex) Rebuild(*DeviceView) {}
+
+func (s stubIndex) Search(DeviceQuery) ([]string, error) { return slices.Clone(s), nil }
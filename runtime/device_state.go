@@ -0,0 +1,200 @@
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/talaria/devicemgr"
+)
+
+// DeviceStatus is a device's connectivity as tracked by DeviceStateMachine.
+type DeviceStatus string
+
+const (
+	StatusUnknown DeviceStatus = "unknown" // never observed
+	StatusOnline  DeviceStatus = "online"
+	StatusSuspect DeviceStatus = "suspect" // missing from recent polls, not yet confirmed offline
+	StatusOffline DeviceStatus = "offline"
+)
+
+// Observation is one input to DeviceStateMachine.
+type Observation int
+
+const (
+	// ObservedPresent and ObservedAbsent report whether a device was in a poll; absence only counts
+	// towards offline once it repeats (see StateMachineConfig.OfflineAfter).
+	ObservedPresent Observation = iota
+	ObservedAbsent
+	// ObservedConnected and ObservedDisconnected are authoritative, e.g. a stat check or a
+	// connect/disconnect event, and take effect at once.
+	ObservedConnected
+	ObservedDisconnected
+)
+
+// Transition is a change of a device's status; online, suspect and offline events carry one as
+// their payload.
+type Transition struct {
+	DeviceID devicemgr.DeviceID `json:"deviceId"`
+	From     DeviceStatus       `json:"from"`
+	To       DeviceStatus       `json:"to"`
+	Reason   string             `json:"reason"`
+	At       time.Time          `json:"at"`
+}
+
+// Event returns the event announcing t.
+func (t Transition) Event(source string) devicemgr.Event {
+	kind := devicemgr.EventOnline
+	switch t.To {
+	case StatusSuspect:
+		kind = devicemgr.EventSuspect
+	case StatusOffline:
+		kind = devicemgr.EventOffline
+	}
+	return devicemgr.Event{Kind: kind, DeviceID: t.DeviceID, OccurredAt: t.At, Source: source, Payload: t}
+}
+
+// StateMachineConfig tunes DeviceStateMachine; zero fields use the defaults in parentheses.
+type StateMachineConfig struct {
+	OfflineAfter int           // consecutive polls a device must be missing from to be offline (2)
+	ForgetAfter  time.Duration // offline devices are dropped after this long (24h)
+}
+
+// DeviceStateMachine tracks each device through unknown → online → suspect → offline. A device
+// missing from one poll only becomes suspect, so a single incomplete Talaria response does not
+// flap the whole fleet offline and online again.
+type DeviceStateMachine struct {
+	cfg StateMachineConfig
+
+	mu      sync.Mutex
+	devices map[devicemgr.DeviceID]*deviceRecord
+}
+
+type deviceRecord struct {
+	status DeviceStatus
+	misses int // consecutive polls missing from
+	since  time.Time
+}
+
+// NewDeviceStateMachine builds an empty machine.
+func NewDeviceStateMachine(cfg StateMachineConfig) *DeviceStateMachine {
+	return &DeviceStateMachine{cfg: cfg.withDefaults(), devices: make(map[devicemgr.DeviceID]*deviceRecord)}
+}
+
+// SetConfig retunes the machine, keeping every tracked device's status; a lowered OfflineAfter
+// takes effect at the device's next miss.
+func (s *DeviceStateMachine) SetConfig(cfg StateMachineConfig) {
+	s.mu.Lock()
+	s.cfg = cfg.withDefaults()
+	s.mu.Unlock()
+}
+
+func (c StateMachineConfig) withDefaults() StateMachineConfig {
+	if c.OfflineAfter <= 0 {
+		c.OfflineAfter = 2
+	}
+	if c.ForgetAfter <= 0 {
+		c.ForgetAfter = 24 * time.Hour
+	}
+	return c
+}
+
+// Status returns the device's status and when it was entered.
+func (s *DeviceStateMachine) Status(id devicemgr.DeviceID) (DeviceStatus, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r := s.devices[id]; r != nil {
+		return r.status, r.since
+	}
+	return StatusUnknown, time.Time{}
+}
+
+// Statuses returns the status of every tracked device.
+func (s *DeviceStateMachine) Statuses() map[devicemgr.DeviceID]DeviceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[devicemgr.DeviceID]DeviceStatus, len(s.devices))
+	for id, r := range s.devices {
+		out[id] = r.status
+	}
+	return out
+}
+
+// Observe applies one observation and returns the resulting transition, if any.
+func (s *DeviceStateMachine) Observe(id devicemgr.DeviceID, o Observation, reason string, at time.Time) (Transition, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.observe(id, o, reason, at)
+}
+
+// ApplyPoll observes every device of a poll result (sorted) as present, and every tracked device
+// not in it as absent, returning the transitions in that order. It also forgets long-offline devices.
+func (s *DeviceStateMachine) ApplyPoll(present []string, at time.Time) []Transition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Transition
+	for _, id := range present {
+		if t, ok := s.observe(devicemgr.DeviceID(id), ObservedPresent, "present in poll", at); ok {
+			out = append(out, t)
+		}
+	}
+	for id, r := range s.devices {
+		if i := sort.SearchStrings(present, string(id)); i < len(present) && present[i] == string(id) {
+			continue
+		}
+		if r.status == StatusOffline {
+			if at.Sub(r.since) > s.cfg.ForgetAfter {
+				delete(s.devices, id)
+			}
+			continue
+		}
+		if t, ok := s.observe(id, ObservedAbsent, "missing from poll", at); ok {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func (s *DeviceStateMachine) observe(id devicemgr.DeviceID, o Observation, reason string, at time.Time) (Transition, bool) {
+	r := s.devices[id]
+	from := StatusUnknown
+	if r != nil {
+		from = r.status
+	}
+	to := from
+	switch o {
+	case ObservedPresent, ObservedConnected:
+		to = StatusOnline
+		if r != nil {
+			r.misses = 0
+		}
+	case ObservedDisconnected:
+		if from != StatusUnknown {
+			to = StatusOffline
+		}
+	case ObservedAbsent:
+		if from == StatusOnline || from == StatusSuspect {
+			r.misses++
+			to = StatusSuspect
+			if r.misses >= s.cfg.OfflineAfter {
+				to = StatusOffline
+				if r.misses > 1 {
+					reason = fmt.Sprintf("missing from %d consecutive polls", r.misses)
+				}
+			}
+		}
+	}
+	if to == from {
+		return Transition{}, false
+	}
+	if r == nil {
+		r = &deviceRecord{}
+		s.devices[id] = r
+	}
+	if to != StatusSuspect {
+		r.misses = 0
+	}
+	r.status, r.since = to, at
+	return Transition{DeviceID: id, From: from, To: to, Reason: reason, At: at}, true
+}
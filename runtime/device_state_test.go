@@ -0,0 +1,59 @@
+package runtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeviceStateMachine(t *testing.T) {
+	s := NewDeviceStateMachine(StateMachineConfig{OfflineAfter: 3, ForgetAfter: time.Hour})
+	at := time.Unix(0, 0)
+	steps := []struct {
+		present []string
+		want    []string // "id from>to"
+	}{
+		{[]string{"a", "b"}, []string{"a unknown>online", "b unknown>online"}},
+		{[]string{"a"}, []string{"b online>suspect"}},
+		{[]string{"a"}, nil},
+		{[]string{"a", "b"}, []string{"b suspect>online"}},
+		{[]string{"a"}, []string{"b online>suspect"}},
+		{[]string{"a"}, nil},
+		{[]string{"a"}, []string{"b suspect>offline"}},
+		{[]string{"a"}, nil},
+	}
+	for i, step := range steps {
+		at = at.Add(time.Minute)
+		var got []string
+		for _, tr := range s.ApplyPoll(step.present, at) {
+			got = append(got, string(tr.DeviceID)+" "+string(tr.From)+">"+string(tr.To))
+		}
+		if len(got) != len(step.want) {
+			t.Fatalf("poll %d: got %v, want %v", i, got, step.want)
+		}
+		for j := range got {
+			if got[j] != step.want[j] {
+				t.Fatalf("poll %d: got %v, want %v", i, got, step.want)
+			}
+		}
+	}
+	if st, since := s.Status("b"); st != StatusOffline || !since.Equal(at.Add(-time.Minute)) {
+		t.Fatalf("b is %s since %v", st, since)
+	}
+
+	// authoritative observations skip the hysteresis; unknown devices cannot go offline
+	if tr, ok := s.Observe("a", ObservedDisconnected, "event", at); !ok || tr.To != StatusOffline || tr.Reason != "event" {
+		t.Fatalf("disconnect: %+v %v", tr, ok)
+	}
+	if _, ok := s.Observe("zz", ObservedDisconnected, "event", at); ok {
+		t.Fatal("unknown device went offline")
+	}
+	if tr, ok := s.Observe("b", ObservedConnected, "stat", at); !ok || tr.From != StatusOffline || tr.To != StatusOnline {
+		t.Fatalf("connect: %+v %v", tr, ok)
+	}
+
+	// long-offline devices are forgotten
+	s.ApplyPoll(nil, at.Add(2*time.Hour))
+	if st, _ := s.Status("a"); st != StatusUnknown {
+		t.Fatalf("a is %s, want forgotten", st)
+	}
+}
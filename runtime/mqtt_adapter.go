@@ -0,0 +1,266 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+	"github.com/xmidt-org/talaria/devicemgr/mqtt"
+)
+
+// Default MQTT topic templates.
+const (
+	DefaultMQTTEventTopic    = "devices/{device}/events"
+	DefaultMQTTRPCTopic      = "devices/{device}/rpc"
+	DefaultMQTTResponseTopic = "devices/{device}/rpc/response"
+)
+
+// MQTTOptions configures an MQTTAdapter. Topic templates may use {device} and, for the RPC topics,
+// {service}; each placeholder must make up a whole topic level so it can be matched with "+".
+type MQTTOptions struct {
+	Client        *mqtt.Client // required
+	EventTopic    string       // optional; DefaultMQTTEventTopic
+	RPCTopic      string       // optional; DefaultMQTTRPCTopic
+	ResponseTopic string       // optional; DefaultMQTTResponseTopic
+	QoS           byte         // 0 or 1
+}
+
+// MQTTAdapter bridges devices that reach devicemgr through an MQTT broker. Messages on the event
+// topic become events (a JSON object in the devicemgr event shape keeps its kind and payload; anything
+// else is an EventNotification with the raw payload as a string), and Call publishes JSON-RPC
+// requests on the RPC topic and matches responses from the response topic by id.
+type MQTTAdapter struct {
+	client   *mqtt.Client
+	qos      byte
+	events   topicTemplate
+	rpc      topicTemplate
+	response topicTemplate
+
+	pendingMu sync.Mutex
+	pending   map[string]chan jsonrpcResponse // device + "|" + request id
+
+	listenersMu sync.RWMutex
+	listeners   []chan dm.Event
+}
+
+// NewMQTTAdapter subscribes to the event and response topics of every device.
+func NewMQTTAdapter(ctx context.Context, o MQTTOptions) (*MQTTAdapter, error) {
+	if o.Client == nil {
+		return nil, errors.New("Client required")
+	}
+	a := &MQTTAdapter{client: o.Client, qos: o.QoS, pending: make(map[string]chan jsonrpcResponse)}
+	var err error
+	if a.events, err = parseTopicTemplate(orDefault(o.EventTopic, DefaultMQTTEventTopic)); err != nil {
+		return nil, fmt.Errorf("EventTopic: %w", err)
+	}
+	if a.rpc, err = parseTopicTemplate(orDefault(o.RPCTopic, DefaultMQTTRPCTopic)); err != nil {
+		return nil, fmt.Errorf("RPCTopic: %w", err)
+	}
+	if a.response, err = parseTopicTemplate(orDefault(o.ResponseTopic, DefaultMQTTResponseTopic)); err != nil {
+		return nil, fmt.Errorf("ResponseTopic: %w", err)
+	}
+	if err := a.client.Subscribe(ctx, a.events.filter(), a.qos, a.onEvent); err != nil {
+		return nil, err
+	}
+	if err := a.client.Subscribe(ctx, a.response.filter(), a.qos, a.onResponse); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func orDefault(v, d string) string {
+	if v == "" {
+		return d
+	}
+	return v
+}
+
+// Call publishes a JSON-RPC request to the device's RPC topic and waits for the response.
+func (a *MQTTAdapter) Call(ctx context.Context, id dm.DeviceID, service string, call BlizzardCall) (*BlizzardResult, error) {
+	if call.Method == "" {
+		return nil, errors.New("method required")
+	}
+	if call.Timeout <= 0 {
+		call.Timeout = 5 * time.Second
+	}
+	req := jsonrpcRequest{JSONRPC: "2.0", ID: uuid.NewString(), Method: call.Method, Params: call.Params}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	key := string(id) + "|" + req.ID
+	ch := make(chan jsonrpcResponse, 1)
+	a.pendingMu.Lock()
+	a.pending[key] = ch
+	a.pendingMu.Unlock()
+	defer func() {
+		a.pendingMu.Lock()
+		delete(a.pending, key)
+		a.pendingMu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, call.Timeout)
+	defer cancel()
+	if err := a.client.Publish(ctx, a.rpc.format(string(id), service), a.qos, payload); err != nil {
+		return nil, fmt.Errorf("mqtt publish: %w", err)
+	}
+	select {
+	case <-ctx.Done():
+		if call.CancelMethod != "" {
+			// ctx is done, so the notification gets a publish deadline of its own
+			pubCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			_ = a.client.Publish(pubCtx, a.rpc.format(string(id), service), a.qos, appendCancelNotification(nil, call.CancelMethod, []byte(req.ID)))
+			cancel()
+		}
+		return nil, fmt.Errorf("mqtt rpc %s on %s: %w", call.Method, id, dm.ErrTimeout)
+	case resp := <-ch:
+		return &BlizzardResult{Result: resp.Result, Error: resp.Error}, nil
+	}
+}
+
+func (a *MQTTAdapter) onResponse(topic string, payload []byte) {
+	vars, ok := a.response.match(topic)
+	if !ok {
+		return
+	}
+	var resp jsonrpcResponse
+	if err := json.Unmarshal(payload, &resp); err != nil || resp.ID == "" {
+		return
+	}
+	a.pendingMu.Lock()
+	ch, found := a.pending[vars.device+"|"+resp.ID]
+	a.pendingMu.Unlock()
+	if found {
+		select {
+		case ch <- resp:
+		default:
+		}
+	}
+}
+
+func (a *MQTTAdapter) onEvent(topic string, payload []byte) {
+	vars, ok := a.events.match(topic)
+	if !ok {
+		return
+	}
+	evt := dm.Event{Kind: dm.EventNotification, DeviceID: dm.DeviceID(vars.device).Canonical(), OccurredAt: time.Now(), Source: "mqtt-adapter", Payload: string(payload)}
+	if decoded, err := events.DecodeJSON(payload); err == nil && decoded.Kind != "" {
+		evt.Kind, evt.Payload = decoded.Kind, decoded.Payload
+		if !decoded.OccurredAt.IsZero() {
+			evt.OccurredAt = decoded.OccurredAt
+		}
+	}
+	a.listenersMu.RLock()
+	defer a.listenersMu.RUnlock()
+	for _, ch := range a.listeners {
+		select {
+		case ch <- evt:
+		default: /* drop if slow */
+		}
+	}
+}
+
+// Subscribe returns events received on the device event topics.
+func (a *MQTTAdapter) Subscribe(buffer int) dm.EventSubscription {
+	ch := make(chan dm.Event, buffer)
+	a.listenersMu.Lock()
+	a.listeners = append(a.listeners, ch)
+	a.listenersMu.Unlock()
+	return &eventSub{ch: ch, closeFn: func() { a.unsubscribe(ch) }}
+}
+
+func (a *MQTTAdapter) unsubscribe(ch chan dm.Event) {
+	a.listenersMu.Lock()
+	defer a.listenersMu.Unlock()
+	for i, l := range a.listeners {
+		if l == ch {
+			a.listeners = append(a.listeners[:i:i], a.listeners[i+1:]...)
+			break
+		}
+	}
+	close(ch)
+}
+
+// Close disconnects the MQTT client.
+func (a *MQTTAdapter) Close() error { return a.client.Close() }
+
+// topicTemplate is an MQTT topic with {device}/{service} (or, for USP, {endpoint}) levels.
+type topicTemplate struct {
+	levels []string
+}
+
+type topicVars struct{ device, service string }
+
+var topicPlaceholders = map[string]bool{"{device}": true, "{service}": true, "{endpoint}": true}
+
+// parseTopicTemplate validates t, which must have a {device} (or {endpoint}) level.
+func parseTopicTemplate(t string) (topicTemplate, error) {
+	levels := strings.Split(t, "/")
+	found := false
+	for _, l := range levels {
+		switch {
+		case topicPlaceholders[l]:
+			found = found || l != "{service}"
+		case strings.ContainsAny(l, "{}+#"):
+			return topicTemplate{}, fmt.Errorf("%q: placeholders and wildcards must be whole topic levels", t)
+		}
+	}
+	if !found {
+		return topicTemplate{}, fmt.Errorf("%q: missing {device} level", t)
+	}
+	return topicTemplate{levels: levels}, nil
+}
+
+func (t topicTemplate) format(device, service string) string {
+	out := make([]string, len(t.levels))
+	for i, l := range t.levels {
+		switch l {
+		case "{device}", "{endpoint}":
+			l = device
+		case "{service}":
+			l = service
+		}
+		out[i] = l
+	}
+	return strings.Join(out, "/")
+}
+
+// filter is the subscription filter matching every device.
+func (t topicTemplate) filter() string {
+	out := make([]string, len(t.levels))
+	for i, l := range t.levels {
+		if topicPlaceholders[l] {
+			l = "+"
+		}
+		out[i] = l
+	}
+	return strings.Join(out, "/")
+}
+
+func (t topicTemplate) match(topic string) (topicVars, bool) {
+	parts := strings.Split(topic, "/")
+	if len(parts) != len(t.levels) {
+		return topicVars{}, false
+	}
+	var v topicVars
+	for i, l := range t.levels {
+		switch l {
+		case "{device}", "{endpoint}":
+			v.device = parts[i]
+		case "{service}":
+			v.service = parts[i]
+		default:
+			if l != parts[i] {
+				return topicVars{}, false
+			}
+		}
+	}
+	return v, v.device != ""
+}
@@ -0,0 +1,191 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/mqtt"
+	"github.com/xmidt-org/talaria/devicemgr/mqtt/mqtttest"
+	"github.com/xmidt-org/talaria/devicemgr/usp"
+)
+
+func newMQTTTest(t *testing.T) (*mqtttest.Broker, func(id string) *mqtt.Client) {
+	t.Helper()
+	b, err := mqtttest.NewBroker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b, func(id string) *mqtt.Client {
+		c, err := mqtt.Dial(context.Background(), mqtt.Config{Broker: b.URL, ClientID: id})
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+}
+
+func TestParseTopicTemplate(t *testing.T) {
+	for _, bad := range []string{"devices/events", "devices/x{device}/events", "devices/+/{device}", "a/#"} {
+		if _, err := parseTopicTemplate(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+	tt, err := parseTopicTemplate("svc/{service}/{device}/rpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tt.format("mac:1122", "config"); got != "svc/config/mac:1122/rpc" {
+		t.Fatalf("format = %q", got)
+	}
+	if got := tt.filter(); got != "svc/+/+/rpc" {
+		t.Fatalf("filter = %q", got)
+	}
+	if v, ok := tt.match("svc/config/mac:1122/rpc"); !ok || v.device != "mac:1122" || v.service != "config" {
+		t.Fatalf("match = %+v %v", v, ok)
+	}
+	if _, ok := tt.match("svc/config/mac:1122/other"); ok {
+		t.Fatal("unexpected match")
+	}
+}
+
+func TestMQTTAdapterEvents(t *testing.T) {
+	b, dial := newMQTTTest(t)
+	a, err := NewMQTTAdapter(context.Background(), MQTTOptions{Client: dial("devicemgr")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := a.Subscribe(4)
+	defer sub.Close()
+
+	b.Publish("devices/mac:1122/events", []byte(`{"kind":"online","payload":{"reason":"boot"}}`))
+	b.Publish("devices/mac:3344/events", []byte("free text"))
+	b.Publish("devices/mac:3344/other", []byte("ignored"))
+
+	var got []dm.Event
+	for len(got) < 2 {
+		select {
+		case evt := <-sub.C():
+			got = append(got, evt)
+		case <-time.After(time.Second):
+			t.Fatalf("events not delivered, got %d", len(got))
+		}
+	}
+	if got[0].Kind != dm.EventOnline || got[0].DeviceID != "mac:1122" || got[0].Source != "mqtt-adapter" {
+		t.Fatalf("unexpected structured event %+v", got[0])
+	}
+	if got[1].Kind != dm.EventNotification || got[1].DeviceID != "mac:3344" || got[1].Payload != "free text" {
+		t.Fatalf("unexpected raw event %+v", got[1])
+	}
+}
+
+func TestMQTTAdapterCall(t *testing.T) {
+	_, dial := newMQTTTest(t)
+	ctx := context.Background()
+	a, err := NewMQTTAdapter(ctx, MQTTOptions{Client: dial("devicemgr"), RPCTopic: "devices/{device}/rpc/{service}", QoS: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the device answers requests on its RPC topic
+	device := dial("mac:1122")
+	err = device.Subscribe(ctx, "devices/mac:1122/rpc/config", 1, func(topic string, payload []byte) {
+		var req jsonrpcRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			t.Errorf("request: %v", err)
+			return
+		}
+		if topic != "devices/mac:1122/rpc/config" || req.Method != "getUptime" {
+			t.Errorf("unexpected request %s %+v", topic, req)
+		}
+		resp, _ := json.Marshal(jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Result: json.RawMessage(`{"uptime":42}`)})
+		go device.Publish(ctx, "devices/mac:1122/rpc/response", 0, resp)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := a.Call(ctx, "mac:1122", "config", BlizzardCall{Method: "getUptime"})
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if string(res.Result) != `{"uptime":42}` || res.Error != nil {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	_, err = a.Call(ctx, "mac:9999", "config", BlizzardCall{Method: "getUptime", Timeout: 50 * time.Millisecond})
+	if !errors.Is(err, dm.ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+}
+
+func TestUSPAdapterOverMQTT(t *testing.T) {
+	_, dial := newMQTTTest(t)
+	ctx := context.Background()
+	mtp, err := NewMQTTMTP(ctx, MQTTMTPOptions{Client: dial("controller"), ControllerTopic: "usp/controller"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewUSPAdapter(USPOptions{EndpointID: "self::controller", MTP: mtp, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	agent := dial("agent")
+	reply := func(payload []byte) {
+		rec := &usp.Record{Version: usp.Version, ToID: "self::controller", FromID: testAgent, Payload: payload}
+		go agent.Publish(ctx, "usp/controller", 0, rec.Marshal())
+	}
+	err = agent.Subscribe(ctx, "usp/agents/#", 0, func(_ string, data []byte) {
+		rec, err := usp.UnmarshalRecord(data)
+		if err != nil {
+			t.Errorf("record: %v", err)
+			return
+		}
+		req, err := usp.UnmarshalMsg(rec.Payload)
+		if err != nil || req.Get == nil {
+			t.Errorf("unexpected request %+v %v", req, err)
+			return
+		}
+		out, _ := (&usp.Msg{ID: req.ID, GetResp: &usp.GetResp{Results: []usp.RequestedPathResult{{
+			RequestedPath: "Device.DeviceInfo.UpTime",
+			Resolved:      []usp.ResolvedPathResult{{ResolvedPath: "Device.DeviceInfo.", Params: map[string]string{"UpTime": "42"}}},
+		}}}}).Marshal()
+		reply(out)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the agent announces where it listens before any request is sent
+	connect := &usp.Record{Version: usp.Version, FromID: testAgent, Type: usp.RecordMQTTConnect, SubscribedTopic: "usp/agents/" + testAgent}
+	if err := agent.Publish(ctx, "usp/controller", 1, connect.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		mtp.mu.Lock()
+		_, ok := mtp.announced[testAgent]
+		mtp.mu.Unlock()
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connect record not seen")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	res, err := a.Get(ctx, testAgent, []string{"Device.DeviceInfo.UpTime"})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if res.Values["Device.DeviceInfo.UpTime"].Value != "42" {
+		t.Fatalf("unexpected values %+v", res.Values)
+	}
+}
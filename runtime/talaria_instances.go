@@ -0,0 +1,207 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/talaria/devicemgr"
+)
+
+// InstancePoll reports the latest device list poll of one Talaria instance (SetInstances).
+type InstancePoll struct {
+	Instance    string     `json:"instance"` // host[:port]
+	Devices     int        `json:"devices"`  // devices attributed to it by the latest poll
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastError   string     `json:"lastError,omitempty"` // of the latest poll, cleared on success
+	// Misplaced counts its devices the SetShardHasher placement puts on another instance, as
+	// after instances join or leave until the devices reconnect.
+	Misplaced int `json:"misplaced,omitempty"`
+}
+
+// SetInstances makes polls fetch the device list of each Talaria instance at urls instead of the
+// base URL, tagging devices with devicemgr.MetadataTalariaInstance; none restores the base URL.
+func (d *DeviceAdapter) SetInstances(urls []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.instances = nil
+	for _, u := range urls {
+		d.instances = append(d.instances, strings.TrimRight(u, "/"))
+	}
+	d.polls = make(map[string]InstancePoll, len(urls))
+	d.place()
+}
+
+// SetShardHasher places devices on the SetInstances instances with h, so polls attribute a device
+// two instances report to the one h places it on and count the devices found elsewhere
+// (InstancePoll.Misplaced); nil stops predicting placement.
+func (d *DeviceAdapter) SetShardHasher(h devicemgr.ShardHasher) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hasher = h
+	d.place()
+}
+
+// place rebuilds the placement ring; d.mu must be held.
+func (d *DeviceAdapter) place() {
+	d.placement = nil
+	if d.hasher != nil && len(d.instances) > 0 {
+		d.placement = d.hasher.Ring(d.instances)
+	}
+}
+
+// PredictInstance returns the host[:port] of the instance SetShardHasher places id on, false
+// without a hasher or instances.
+func (d *DeviceAdapter) PredictInstance(id devicemgr.DeviceID) (string, bool) {
+	d.mu.RLock()
+	ring := d.placement
+	d.mu.RUnlock()
+	return predictHost(ring, id)
+}
+
+func predictHost(ring devicemgr.ShardRing, id devicemgr.DeviceID) (string, bool) {
+	if ring == nil {
+		return "", false
+	}
+	instance, ok := ring.Instance(id)
+	return instanceHost(instance), ok
+}
+
+// InstancePolls reports every instance set with SetInstances, by host.
+func (d *DeviceAdapter) InstancePolls() []InstancePoll {
+	d.mu.RLock()
+	out := make([]InstancePoll, 0, len(d.instances))
+	for _, base := range d.instances {
+		p := d.polls[instanceHost(base)]
+		p.Instance = instanceHost(base)
+		out = append(out, p)
+	}
+	d.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Instance < out[j].Instance })
+	return out
+}
+
+// pollInstances polls every instance concurrently and merges their lists; a device reported by two
+// instances, as while it reconnects, is attributed to the one placement predicts, or else to the
+// first listed. The devices of an instance
+// whose poll failed are carried over from the previous view, so an unreachable instance does not
+// take its devices offline (suspects are left to turn offline); the poll only fails when every
+// instance does.
+func (d *DeviceAdapter) pollInstances(ctx context.Context, retry devicemgr.RetryPolicy, instances []string) ([]string, map[string]map[string]string, error) {
+	type result struct {
+		ids  []string
+		meta map[string]map[string]string
+		err  error
+	}
+	results := make([]result, len(instances))
+	var wg sync.WaitGroup
+	for i, base := range instances {
+		wg.Add(1)
+		go func(r *result, base string) {
+			defer wg.Done()
+			r.ids, r.meta, r.err = d.pollList(ctx, retry, base)
+		}(&results[i], base)
+	}
+	wg.Wait()
+	d.mu.RLock()
+	ring := d.placement
+	d.mu.RUnlock()
+
+	ids := []string{}
+	meta := make(map[string]map[string]string)
+	counts := make(map[string]int, len(instances))
+	var errs []error
+	for i, r := range results {
+		host := instanceHost(instances[i])
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", host, r.err))
+			continue
+		}
+		for _, id := range r.ids {
+			if prev, dup := meta[id]; dup {
+				if predicted, ok := predictHost(ring, devicemgr.DeviceID(id)); !ok || predicted != host {
+					continue
+				}
+				counts[prev[devicemgr.MetadataTalariaInstance]]--
+				counts[host]++
+				meta[id] = withInstance(r.meta[id], host)
+				continue
+			}
+			meta[id] = withInstance(r.meta[id], host)
+			ids = append(ids, id)
+			counts[host]++
+		}
+	}
+	if len(errs) == len(instances) {
+		return nil, nil, errors.Join(errs...)
+	}
+	failed := make(map[string]bool, len(errs))
+	for i, r := range results {
+		if r.err != nil {
+			failed[instanceHost(instances[i])] = true
+		}
+	}
+	if len(failed) > 0 {
+		prev := d.View()
+		for _, id := range prev.ids {
+			host := prev.meta[id][devicemgr.MetadataTalariaInstance]
+			if _, seen := meta[id]; seen || !failed[host] {
+				continue
+			}
+			if status, _ := d.Status(id); status != StatusOnline {
+				continue // already missing from the instance's last good poll
+			}
+			meta[id] = prev.meta[id]
+			ids = append(ids, id)
+			counts[host]++
+		}
+	}
+
+	misplaced := make(map[string]int, len(instances))
+	for _, id := range ids {
+		host := meta[id][devicemgr.MetadataTalariaInstance]
+		if predicted, ok := predictHost(ring, devicemgr.DeviceID(id)); ok && predicted != host {
+			misplaced[host]++
+		}
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	for i, r := range results {
+		host := instanceHost(instances[i])
+		p := d.polls[host]
+		p.Instance, p.Devices, p.Misplaced = host, counts[host], misplaced[host]
+		if r.err != nil {
+			p.LastError = r.err.Error()
+		} else {
+			at := now
+			p.LastSuccess, p.LastError = &at, ""
+		}
+		d.polls[host] = p
+	}
+	d.mu.Unlock()
+	return ids, meta, nil
+}
+
+// withInstance copies a device's polled metadata, tagging it with the instance host.
+func withInstance(meta map[string]string, host string) map[string]string {
+	m := make(map[string]string, len(meta)+1)
+	for k, v := range meta {
+		m[k] = v
+	}
+	m[devicemgr.MetadataTalariaInstance] = host
+	return m
+}
+
+// instanceHost names an instance by the host[:port] of its base URL.
+func instanceHost(base string) string {
+	if u, err := url.Parse(base); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return base
+}
@@ -0,0 +1,113 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestDeviceAdapterPollInstances(t *testing.T) {
+	var failB atomic.Bool
+	a := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"devices":["mac:1",{"id":"mac:2","partnerIDs":["sky"]}]}`))
+	}))
+	defer a.Close()
+	b := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failB.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"devices":["mac:2","mac:3"]}`))
+	}))
+	defer b.Close()
+	hostA, hostB := strings.TrimPrefix(a.URL, "http://"), strings.TrimPrefix(b.URL, "http://")
+
+	d := NewDeviceAdapter("http://unused.invalid", nil)
+	d.SetInstances([]string{a.URL + "/", b.URL})
+	if _, err := d.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	v := d.View()
+	if v.Len() != 3 || v.Metadata("mac:1")[devicemgr.MetadataTalariaInstance] != hostA || v.Metadata("mac:3")[devicemgr.MetadataTalariaInstance] != hostB {
+		t.Fatalf("view %v", v.meta)
+	}
+	// reported by both; the first instance wins and the poll's metadata is kept
+	if m := v.Metadata("mac:2"); m[devicemgr.MetadataTalariaInstance] != hostA || m[devicemgr.MetadataPartnerIDs] != "sky" {
+		t.Fatalf("mac:2 metadata %v", m)
+	}
+	polls := d.InstancePolls()
+	if len(polls) != 2 || polls[0].Devices+polls[1].Devices != 3 || polls[0].LastSuccess == nil || polls[0].LastError != "" {
+		t.Fatalf("polls %+v", polls)
+	}
+
+	// b's devices are carried over while it is unreachable
+	failB.Store(true)
+	if _, err := d.PollOnce(context.Background()); err != nil {
+		t.Fatalf("partial failure failed the poll: %v", err)
+	}
+	if st, _ := d.Status("mac:3"); st != StatusOnline || d.View().Metadata("mac:3")[devicemgr.MetadataTalariaInstance] != hostB {
+		t.Fatalf("mac:3 is %s", st)
+	}
+	for _, p := range d.InstancePolls() {
+		if p.Instance == hostB && (p.LastError == "" || p.Devices != 1 || p.LastSuccess == nil) {
+			t.Fatalf("failing instance %+v", p)
+		}
+	}
+
+	a.Close()
+	if _, err := d.PollOnce(context.Background()); err == nil {
+		t.Fatal("poll with every instance failing succeeded")
+	}
+}
+
+// fixedRing places devices by a table, on instance URLs.
+type fixedRing map[string]string
+
+func (r fixedRing) Ring([]string) devicemgr.ShardRing { return r }
+
+func (r fixedRing) Instance(id devicemgr.DeviceID) (string, bool) {
+	instance, ok := r[string(id)]
+	return instance, ok
+}
+
+func TestDeviceAdapterPollInstancesPlacement(t *testing.T) {
+	a := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"devices":["mac:1","mac:2"]}`))
+	}))
+	defer a.Close()
+	b := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"devices":["mac:2","mac:3"]}`))
+	}))
+	defer b.Close()
+	hostA, hostB := strings.TrimPrefix(a.URL, "http://"), strings.TrimPrefix(b.URL, "http://")
+
+	d := NewDeviceAdapter("http://unused.invalid", nil)
+	d.SetInstances([]string{a.URL, b.URL})
+	if _, ok := d.PredictInstance("mac:1"); ok {
+		t.Fatal("predicted without a hasher")
+	}
+	d.SetShardHasher(fixedRing{"mac:1": b.URL, "mac:2": b.URL, "mac:3": b.URL})
+	if host, ok := d.PredictInstance("mac:2"); !ok || host != hostB {
+		t.Fatalf("predicted %q, %v", host, ok)
+	}
+	if _, err := d.PollOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// reported by both; attributed to the predicted instance rather than the first listed
+	if got := d.View().Metadata("mac:2")[devicemgr.MetadataTalariaInstance]; got != hostB {
+		t.Fatalf("mac:2 attributed to %s", got)
+	}
+	for _, p := range d.InstancePolls() {
+		switch {
+		case p.Instance == hostA && (p.Devices != 1 || p.Misplaced != 1):
+			t.Fatalf("instance a %+v", p)
+		case p.Instance == hostB && (p.Devices != 2 || p.Misplaced != 0):
+			t.Fatalf("instance b %+v", p)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// TalariaServerHeader names the Talaria host that answered a request; the stat endpoint's copy
+// identifies the instance holding the device's connection.
+const TalariaServerHeader = "X-Talaria-Server"
+
+// Defaults for the RouterOptions left zero.
+const (
+	DefaultRouteTTL         = time.Minute
+	DefaultInstanceFailures = 3
+	DefaultInstanceCooldown = 30 * time.Second
+)
+
+// RouterOptions configures a TalariaRouter. With Placement, instances are predicted from its ring
+// without asking anyone; otherwise PetasosURL, when set, is asked first and TalariaURL's stat
+// endpoint is used otherwise.
+type RouterOptions struct {
+	TalariaURL string
+	PetasosURL string
+	// Placement places devices on the instances' base URLs, as a dm.ShardHasher's Ring of
+	// Options.Polling.Instances does.
+	Placement dm.ShardRing
+	Auth      dm.AuthStrategy
+	Client    *http.Client
+	Retry     dm.RetryPolicy
+	TTL       time.Duration
+	Failures  int
+	Cooldown  time.Duration
+}
+
+// TalariaRouter resolves which Talaria instance currently holds a device's connection, so
+// operations can go straight to it rather than through the load balancer, and tracks the health of
+// every instance it has routed to. Resolved instances are cached for TTL; an instance whose last
+// Failures dials failed is bypassed for Cooldown.
+type TalariaRouter struct {
+	o      RouterOptions
+	client *http.Client // o.Client, not following petasos redirects
+	now    func() time.Time
+
+	mu        sync.Mutex
+	routes    map[dm.DeviceID]route
+	swept     time.Time
+	instances map[string]*instanceState
+}
+
+type route struct {
+	instance string
+	expires  time.Time
+}
+
+type instanceState struct {
+	successes, failures uint64
+	consecutive         int
+	lastError           string
+	lastFailure         time.Time
+	downUntil           time.Time
+}
+
+// InstanceHealth reports one Talaria instance the router has resolved devices to.
+type InstanceHealth struct {
+	Instance    string     `json:"instance"`
+	Healthy     bool       `json:"healthy"`
+	Devices     int        `json:"devices"` // devices currently routed to it
+	Successes   uint64     `json:"successes"`
+	Failures    uint64     `json:"failures"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastFailure *time.Time `json:"lastFailure,omitempty"`
+}
+
+// NewTalariaRouter builds a router; one of TalariaURL and PetasosURL is required.
+func NewTalariaRouter(o RouterOptions) (*TalariaRouter, error) {
+	if o.TalariaURL == "" && o.PetasosURL == "" && o.Placement == nil {
+		return nil, errors.New("router: TalariaURL, PetasosURL or Placement required")
+	}
+	o.TalariaURL = strings.TrimRight(o.TalariaURL, "/")
+	o.PetasosURL = strings.TrimRight(o.PetasosURL, "/")
+	if o.TTL <= 0 {
+		o.TTL = DefaultRouteTTL
+	}
+	if o.Failures <= 0 {
+		o.Failures = DefaultInstanceFailures
+	}
+	if o.Cooldown <= 0 {
+		o.Cooldown = DefaultInstanceCooldown
+	}
+	if o.Client == nil {
+		o.Client = NewClient(nil, 10*time.Second)
+	}
+	client := *o.Client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return &TalariaRouter{
+		o:         o,
+		client:    &client,
+		now:       time.Now,
+		routes:    make(map[dm.DeviceID]route),
+		instances: make(map[string]*instanceState),
+	}, nil
+}
+
+// Resolve returns the hostname of the Talaria instance holding id's connection. A device Talaria
+// does not know fails with ErrDeviceOffline.
+func (r *TalariaRouter) Resolve(ctx context.Context, id dm.DeviceID) (string, error) {
+	now := r.now()
+	r.mu.Lock()
+	rt, ok := r.routes[id]
+	r.mu.Unlock()
+	if ok && now.Before(rt.expires) {
+		return rt.instance, nil
+	}
+	var instance string
+	err := r.o.Retry.Do(ctx, func() (err error) {
+		instance, err = r.lookup(ctx, id)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Sub(r.swept) > r.o.TTL {
+		for dev, rt := range r.routes {
+			if !now.Before(rt.expires) {
+				delete(r.routes, dev)
+			}
+		}
+		r.swept = now
+	}
+	r.routes[id] = route{instance: instance, expires: now.Add(r.o.TTL)}
+	if r.instances[instance] == nil {
+		r.instances[instance] = &instanceState{}
+	}
+	return instance, nil
+}
+
+func (r *TalariaRouter) lookup(ctx context.Context, id dm.DeviceID) (string, error) {
+	if r.o.Placement != nil {
+		instance, ok := r.o.Placement.Instance(id)
+		if !ok {
+			return "", errors.New("router: placement without instances")
+		}
+		if u, err := url.Parse(instance); err == nil && u.Hostname() != "" {
+			return u.Hostname(), nil
+		}
+		return instance, nil
+	}
+	base, backend := r.o.TalariaURL, "talaria"
+	if r.o.PetasosURL != "" {
+		base, backend = r.o.PetasosURL, "petasos"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/v2/device/%s/stat", base, url.PathEscape(string(id))), nil)
+	if err != nil {
+		return "", err
+	}
+	if r.o.Auth != nil {
+		if v, e := r.o.Auth.AuthorizationValue(); e == nil && v != "" {
+			req.Header.Set("Authorization", v)
+		}
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", backend, dm.ErrBackendUnavailable)
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%s: %s: %w", backend, id, dm.ErrDeviceOffline)
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusTooManyRequests:
+		return "", dm.NewBackendError(backend, resp)
+	case backend == "petasos" && resp.StatusCode >= 300 && resp.StatusCode < 400:
+		loc, err := resp.Location()
+		if err != nil || loc.Hostname() == "" {
+			return "", errors.New("petasos: redirect without a location")
+		}
+		return loc.Hostname(), nil
+	case backend == "talaria" && resp.StatusCode == http.StatusOK:
+		host := resp.Header.Get(TalariaServerHeader)
+		if host == "" {
+			return "", fmt.Errorf("talaria: stat response without %s", TalariaServerHeader)
+		}
+		return host, nil
+	}
+	return "", fmt.Errorf("%s: unexpected status %d", backend, resp.StatusCode)
+}
+
+// Route rewrites base (a Talaria, gateway or Blizzard URL) to address the instance holding id,
+// keeping its scheme, port and path, and returns the instance; the instance's services must be
+// reachable by hostname. When the device cannot be resolved or its instance is out of rotation,
+// base is returned unchanged with an empty instance.
+func (r *TalariaRouter) Route(ctx context.Context, id dm.DeviceID, base string) (string, string) {
+	instance, err := r.Resolve(ctx, id)
+	if err != nil || !r.healthy(instance) {
+		return base, ""
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return base, ""
+	}
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(instance, port)
+	} else {
+		u.Host = instance
+	}
+	return u.String(), instance
+}
+
+func (r *TalariaRouter) healthy(instance string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.instances[instance]
+	return s == nil || !r.now().Before(s.downUntil)
+}
+
+// Record reports the outcome of an operation sent to instance (as returned by Route) for id. A
+// failure also forgets id's route, so the next operation resolves it again.
+func (r *TalariaRouter) Record(id dm.DeviceID, instance string, err error) {
+	if instance == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.instances[instance]
+	if s == nil {
+		s = &instanceState{}
+		r.instances[instance] = s
+	}
+	if err == nil {
+		s.successes++
+		s.consecutive = 0
+		return
+	}
+	delete(r.routes, id)
+	now := r.now()
+	s.failures++
+	s.consecutive++
+	s.lastError, s.lastFailure = err.Error(), now
+	if s.consecutive >= r.o.Failures {
+		s.downUntil, s.consecutive = now.Add(r.o.Cooldown), 0
+	}
+}
+
+// Instances reports every instance the router has resolved a device to, by hostname.
+func (r *TalariaRouter) Instances() []InstanceHealth {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	devices := make(map[string]int)
+	for _, rt := range r.routes {
+		if now.Before(rt.expires) {
+			devices[rt.instance]++
+		}
+	}
+	out := make([]InstanceHealth, 0, len(r.instances))
+	for name, s := range r.instances {
+		h := InstanceHealth{Instance: name, Healthy: !now.Before(s.downUntil), Devices: devices[name], Successes: s.successes, Failures: s.failures, LastError: s.lastError}
+		if !s.lastFailure.IsZero() {
+			at := s.lastFailure
+			h.LastFailure = &at
+		}
+		out = append(out, h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Instance < out[j].Instance })
+	return out
+}
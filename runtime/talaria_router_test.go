@@ -0,0 +1,99 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestTalariaRouterPetasos(t *testing.T) {
+	var lookups atomic.Int32
+	petasos := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		if r.URL.Path != "/api/v2/device/mac:112233445566/stat" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, "http://talaria-3.example.net:6200"+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer petasos.Close()
+	r, err := NewTalariaRouter(RouterOptions{PetasosURL: petasos.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	target, instance := r.Route(ctx, "mac:112233445566", "wss://blizzard.example.net:8443/blizzard")
+	if instance != "talaria-3.example.net" || target != "wss://talaria-3.example.net:8443/blizzard" {
+		t.Fatalf("route: %q %q", target, instance)
+	}
+	if _, err := r.Resolve(ctx, "mac:112233445566"); err != nil || lookups.Load() != 1 {
+		t.Fatalf("expected a cached route, got %v after %d lookups", err, lookups.Load())
+	}
+	if _, err := r.Resolve(ctx, "mac:001122334455"); !errors.Is(err, dm.ErrDeviceOffline) {
+		t.Fatalf("unknown device: %v", err)
+	}
+	if target, instance := r.Route(ctx, "mac:001122334455", "wss://blizzard.example.net/blizzard"); instance != "" || target != "wss://blizzard.example.net/blizzard" {
+		t.Fatalf("unroutable device: %q %q", target, instance)
+	}
+}
+
+func TestTalariaRouterStatHealth(t *testing.T) {
+	var lookups atomic.Int32
+	talaria := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		w.Header().Set(TalariaServerHeader, "talaria-1")
+		w.Write([]byte(`{"id":"mac:112233445566"}`))
+	}))
+	defer talaria.Close()
+	r, err := NewTalariaRouter(RouterOptions{TalariaURL: talaria.URL, Failures: 2, Cooldown: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	ctx := context.Background()
+	id := dm.DeviceID("mac:112233445566")
+	if _, instance := r.Route(ctx, id, "ws://gateway/blizzard"); instance != "talaria-1" {
+		t.Fatalf("instance %q", instance)
+	}
+	r.Record(id, "talaria-1", nil)
+	r.Record(id, "talaria-1", errors.New("dial refused"))
+	if lookups.Load() != 1 {
+		t.Fatalf("lookups %d", lookups.Load())
+	}
+	// the failure forgot the route, so the device is resolved again
+	if _, instance := r.Route(ctx, id, "ws://gateway/blizzard"); instance != "talaria-1" || lookups.Load() != 2 {
+		t.Fatalf("instance %q after %d lookups", instance, lookups.Load())
+	}
+	r.Record(id, "talaria-1", errors.New("dial refused"))
+	if target, instance := r.Route(ctx, id, "ws://gateway/blizzard"); instance != "" || target != "ws://gateway/blizzard" {
+		t.Fatalf("expected the unhealthy instance to be bypassed, got %q %q", target, instance)
+	}
+	hs := r.Instances()
+	if len(hs) != 1 || hs[0].Healthy || hs[0].Successes != 1 || hs[0].Failures != 2 || hs[0].LastError != "dial refused" || hs[0].Devices != 1 {
+		t.Fatalf("health %+v", hs)
+	}
+	now = now.Add(time.Minute)
+	if _, instance := r.Route(ctx, id, "ws://gateway/blizzard"); instance != "talaria-1" {
+		t.Fatalf("expected the instance back after the cooldown, got %q", instance)
+	}
+}
+
+func TestTalariaRouterPlacement(t *testing.T) {
+	ring := dm.ConsistentHasher{}.Ring([]string{"http://talaria-0.example.net:6200", "http://talaria-1.example.net:6200"})
+	r, err := NewTalariaRouter(RouterOptions{Placement: ring})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := ring.Instance("mac:112233445566")
+	target, instance := r.Route(context.Background(), "mac:112233445566", "wss://blizzard.example.net:8443/blizzard")
+	if instance == "" || want != "http://"+instance+":6200" || target != "wss://"+instance+":8443/blizzard" {
+		t.Fatalf("route: %q %q, placed on %q", target, instance, want)
+	}
+}
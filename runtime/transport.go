@@ -0,0 +1,107 @@
+package runtime
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xmidt-org/talaria/devicemgr"
+)
+
+// sharedTransport backs the default clients of the adapters, so that even adapters built without
+// NewTransport share one connection pool.
+var sharedTransport = NewTransport(devicemgr.HTTPConfig{})
+
+// NewTransport builds a pooled Transport for backend calls. Unlike http.DefaultTransport it keeps
+// enough idle connections per host for bulk operations against a single backend, and it resumes
+// TLS sessions.
+func NewTransport(cfg devicemgr.HTTPConfig) *http.Transport {
+	orInt := func(v, def int) int {
+		if v > 0 {
+			return v
+		}
+		return def
+	}
+	orDuration := func(v, def time.Duration) time.Duration {
+		if v > 0 {
+			return v
+		}
+		return def
+	}
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     !cfg.DisableHTTP2,
+		MaxIdleConns:          orInt(cfg.MaxIdleConns, 256),
+		MaxIdleConnsPerHost:   orInt(cfg.MaxIdleConnsPerHost, 64),
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       orDuration(cfg.IdleConnTimeout, 90*time.Second),
+		TLSHandshakeTimeout:   orDuration(cfg.TLSHandshakeTimeout, 10*time.Second),
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig: &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			ClientSessionCache: tls.NewLRUClientSessionCache(orInt(cfg.TLSSessionCacheSize, 256)),
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+		},
+	}
+	if cfg.DisableHTTP2 {
+		// a non-nil empty map turns off the transport's built-in HTTP/2 upgrade
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t
+}
+
+// NewClient returns a client using t (the shared default Transport when nil) with the given timeout.
+func NewClient(t *http.Transport, timeout time.Duration) *http.Client {
+	if t == nil {
+		t = sharedTransport
+	}
+	return &http.Client{Transport: t, Timeout: timeout}
+}
+
+// LogRequests returns a RoundTripper logging each request through next with logf: method,
+// URL (without credentials), status or error, and latency.
+func LogRequests(next http.RoundTripper, logf func(format string, args ...interface{})) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return loggingTransport{next: next, logf: logf}
+}
+
+type loggingTransport struct {
+	next http.RoundTripper
+	logf func(format string, args ...interface{})
+}
+
+func (t loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.logf("http %s %s: %v (%s)", req.Method, req.URL.Redacted(), err, time.Since(start).Round(time.Millisecond))
+		return resp, err
+	}
+	t.logf("http %s %s: %d (%s)", req.Method, req.URL.Redacted(), resp.StatusCode, time.Since(start).Round(time.Millisecond))
+	return resp, nil
+}
+
+// NewDialer returns a websocket dialer that shares t's proxy settings and TLS session cache. The
+// TLS config is not shared itself because the Transport adds HTTP/2 to its ALPN protocols.
+func NewDialer(t *http.Transport) *websocket.Dialer {
+	if t == nil {
+		t = sharedTransport
+	}
+	d := &websocket.Dialer{Proxy: t.Proxy, HandshakeTimeout: 10 * time.Second}
+	if c := t.TLSClientConfig; c != nil {
+		d.TLSClientConfig = &tls.Config{MinVersion: c.MinVersion, RootCAs: c.RootCAs, ClientSessionCache: c.ClientSessionCache, InsecureSkipVerify: c.InsecureSkipVerify}
+	}
+	return d
+}
+
+// FrameFilter inspects each inbound websocket frame before an adapter handles it, returning the
+// frame to handle and false to discard it; faults.Injector.Frame is one.
+type FrameFilter func(data []byte) ([]byte, bool)
@@ -0,0 +1,52 @@
+package runtime
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestNewTransport(t *testing.T) {
+	tr := NewTransport(devicemgr.HTTPConfig{})
+	if tr.MaxIdleConnsPerHost != 64 || tr.MaxIdleConns != 256 || tr.IdleConnTimeout != 90*time.Second || !tr.ForceAttemptHTTP2 || tr.TLSNextProto != nil {
+		t.Fatalf("unexpected defaults %+v", tr)
+	}
+	d := NewDialer(tr)
+	if d.TLSClientConfig == tr.TLSClientConfig || d.TLSClientConfig.ClientSessionCache != tr.TLSClientConfig.ClientSessionCache {
+		t.Fatal("dialer should share the session cache but not the TLS config")
+	}
+	tr = NewTransport(devicemgr.HTTPConfig{MaxIdleConnsPerHost: 8, MaxConnsPerHost: 16, DisableHTTP2: true})
+	if tr.MaxIdleConnsPerHost != 8 || tr.MaxConnsPerHost != 16 || tr.ForceAttemptHTTP2 || tr.TLSNextProto == nil {
+		t.Fatalf("unexpected transport %+v", tr)
+	}
+	if c := NewClient(nil, time.Second); c.Transport != sharedTransport || c.Timeout != time.Second {
+		t.Fatal("NewClient(nil) should use the shared transport")
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer srv.Close()
+	var lines []string
+	c := &http.Client{Transport: LogRequests(nil, func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	})}
+	resp, err := c.Get(strings.Replace(srv.URL, "http://", "http://user:secret@", 1) + "/api/v2/devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(lines) != 1 || !strings.Contains(lines[0], "GET http://user:xxxxx@") || !strings.Contains(lines[0], "/api/v2/devices: 418") {
+		t.Fatalf("logged %q", lines)
+	}
+	if tr := NewTransport(devicemgr.HTTPConfig{InsecureSkipVerify: true}); !tr.TLSClientConfig.InsecureSkipVerify || !NewDialer(tr).TLSClientConfig.InsecureSkipVerify {
+		t.Fatal("InsecureSkipVerify not applied")
+	}
+}
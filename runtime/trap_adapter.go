@@ -0,0 +1,150 @@
+package runtime
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// maxTrapBody bounds a trap post.
+const maxTrapBody = 1 << 20
+
+// Trap is one trap or notification as posted by a forwarder.
+type Trap struct {
+	Agent    string                 `json:"agent"`            // the sending agent's identifier, translated through TrapConfig.DeviceIDs
+	Device   string                 `json:"device,omitempty"` // device ID, when the forwarder already knows it
+	OID      string                 `json:"oid"`              // snmpTrapOID
+	Time     time.Time              `json:"time,omitempty"`   // when the trap was sent; receipt time when zero
+	VarBinds map[string]interface{} `json:"varbinds,omitempty"`
+}
+
+// TrapAdapter converts traps posted to it (one Trap object or an array of them) into device
+// events. Traps whose device cannot be identified are rejected and reported in the response.
+type TrapAdapter struct {
+	cfg dm.TrapConfig
+
+	listenersMu sync.RWMutex
+	listeners   []chan dm.Event
+}
+
+func NewTrapAdapter(cfg dm.TrapConfig) *TrapAdapter {
+	return &TrapAdapter{cfg: cfg}
+}
+
+// trapResult is the response to a post.
+type trapResult struct {
+	Accepted int      `json:"accepted"`
+	Rejected []string `json:"rejected,omitempty"` // reasons, by trap
+}
+
+func (a *TrapAdapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.cfg.Token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.cfg.Token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxTrapBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var traps []Trap
+	if body = bytes.TrimSpace(body); len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &traps)
+	} else {
+		traps = make([]Trap, 1)
+		err = json.Unmarshal(body, &traps[0])
+	}
+	if err != nil {
+		http.Error(w, "invalid trap: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var res trapResult
+	now := time.Now()
+	for i, t := range traps {
+		e, err := a.Event(t, now)
+		if err != nil {
+			res.Rejected = append(res.Rejected, fmt.Sprintf("trap %d: %v", i, err))
+			continue
+		}
+		a.broadcast(e)
+		res.Accepted++
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// Event converts t into a device event, received at now.
+func (a *TrapAdapter) Event(t Trap, now time.Time) (dm.Event, error) {
+	raw := t.Device
+	if raw == "" {
+		if t.Agent == "" {
+			return dm.Event{}, fmt.Errorf("no agent or device: %w", dm.ErrInvalidParameter)
+		}
+		raw = t.Agent
+		if mapped, ok := a.cfg.DeviceIDs[t.Agent]; ok {
+			raw = mapped
+		}
+	}
+	id, err := dm.ParseDeviceID(raw)
+	if err != nil {
+		return dm.Event{}, fmt.Errorf("agent %q has no device ID: %w", t.Agent, err)
+	}
+	kind, ok := a.cfg.Kinds[t.OID]
+	if !ok {
+		kind = dm.EventNotification
+	}
+	at := t.Time
+	if at.IsZero() {
+		at = now
+	}
+	return dm.Event{Kind: kind, DeviceID: id, OccurredAt: at, Source: "trap-bridge", Payload: t}, nil
+}
+
+func (a *TrapAdapter) broadcast(e dm.Event) {
+	a.listenersMu.RLock()
+	defer a.listenersMu.RUnlock()
+	for _, ch := range a.listeners {
+		select {
+		case ch <- e:
+		default: /* drop if slow */
+		}
+	}
+}
+
+// Subscribe returns events converted from posted traps.
+func (a *TrapAdapter) Subscribe(buffer int) dm.EventSubscription {
+	ch := make(chan dm.Event, buffer)
+	a.listenersMu.Lock()
+	a.listeners = append(a.listeners, ch)
+	a.listenersMu.Unlock()
+	return &eventSub{ch: ch, closeFn: func() { a.unsubscribe(ch) }}
+}
+
+func (a *TrapAdapter) unsubscribe(ch chan dm.Event) {
+	a.listenersMu.Lock()
+	defer a.listenersMu.Unlock()
+	for i, l := range a.listeners {
+		if l == ch {
+			a.listeners = append(a.listeners[:i:i], a.listeners[i+1:]...)
+			break
+		}
+	}
+	close(ch)
+}
@@ -0,0 +1,60 @@
+package runtime
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestTrapAdapter(t *testing.T) {
+	a := NewTrapAdapter(dm.TrapConfig{
+		Enabled:   true,
+		DeviceIDs: map[string]string{"10.0.0.5": "mac:11:22:33:44:55:66"},
+		Kinds:     map[string]dm.EventKind{"1.3.6.1.4.1.99.0.1": dm.EventOffline},
+		Token:     "s3cret",
+	})
+	sub := a.Subscribe(8)
+	defer sub.Close()
+	post := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		a.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post("wrong", `{}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("bad token: %d", rr.Code)
+	}
+	if rr := post("s3cret", `{`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad body: %d", rr.Code)
+	}
+	rr := post("s3cret", `[
+		{"agent":"10.0.0.5","oid":"1.3.6.1.4.1.99.0.1","time":"2024-05-01T12:00:00Z","varbinds":{"1.3.6.1.2.1.1.3.0":42}},
+		{"agent":"AA-BB-CC-DD-EE-FF","oid":"1.3.6.1.6.3.1.1.5.1"},
+		{"agent":"10.9.9.9","oid":"1.3.6.1.6.3.1.1.5.1"}]`)
+	var res trapResult
+	if rr.Code != http.StatusAccepted || json.Unmarshal(rr.Body.Bytes(), &res) != nil || res.Accepted != 2 || len(res.Rejected) != 1 {
+		t.Fatalf("post: %d %s", rr.Code, rr.Body)
+	}
+
+	offline := <-sub.C()
+	if offline.Kind != dm.EventOffline || offline.DeviceID != "mac:112233445566" || offline.Source != "trap-bridge" ||
+		!offline.OccurredAt.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("mapped trap: %+v", offline)
+	}
+	if trap, ok := offline.Payload.(Trap); !ok || trap.VarBinds["1.3.6.1.2.1.1.3.0"] != float64(42) {
+		t.Fatalf("payload: %#v", offline.Payload)
+	}
+	cold := <-sub.C()
+	if cold.Kind != dm.EventNotification || cold.DeviceID != "mac:aabbccddeeff" || cold.OccurredAt.IsZero() {
+		t.Fatalf("unmapped trap: %+v", cold)
+	}
+}
@@ -0,0 +1,380 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/usp"
+)
+
+// MTP is a USP Message Transfer Protocol binding (WebSocket, MQTT, ...). It carries encoded
+// USP Records between this controller and agents addressed by endpoint ID.
+type MTP interface {
+	// Send delivers an encoded Record to the agent; it fails with dm.ErrDeviceOffline when the
+	// agent is not reachable over this MTP.
+	Send(ctx context.Context, endpointID string, record []byte) error
+	// Records yields every inbound encoded Record and is closed when the MTP is closed.
+	Records() <-chan []byte
+	Close() error
+}
+
+// USPOptions configures a USPAdapter.
+type USPOptions struct {
+	EndpointID string         // controller endpoint ID, e.g. "self::devicemgr"
+	MTP        MTP            // required
+	Timeout    time.Duration  // per request; default 30s
+	Retry      dm.RetryPolicy // retries Gets that time out; Set and Operate are never retried
+}
+
+// USPAdapter manages TR-369 (USP) agents: Get, Set and Operate requests with responses matched by
+// message ID, and agent Notify messages surfaced as events. Agents are addressed by their USP
+// endpoint ID used as the DeviceID (e.g. "os::012345-001122334455").
+//
+// Only no-session-context Records are supported; end-to-end session context and Record-level
+// security are left to the MTP (e.g. TLS).
+type USPAdapter struct {
+	endpointID string
+	mtp        MTP
+	timeout    time.Duration
+	retry      dm.RetryPolicy
+
+	pendingMu sync.Mutex
+	pending   map[string]chan *usp.Msg // agent + "|" + msg ID
+
+	listenersMu sync.RWMutex
+	listeners   []chan dm.Event
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// USPError is a failure reported by an agent for a whole request (Path empty) or for one path.
+type USPError struct {
+	Path    string
+	Code    uint32
+	Message string
+}
+
+func (e *USPError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("usp %s: error %d: %s", e.Path, e.Code, e.Message)
+	}
+	return fmt.Sprintf("usp error %d: %s", e.Code, e.Message)
+}
+
+// Unwrap maps USP error codes (TR-369 section 10.2) onto devicemgr sentinels.
+func (e *USPError) Unwrap() error {
+	switch e.Code {
+	case 7006:
+		return dm.ErrAccessDenied
+	case 7014, 7020:
+		return dm.ErrConflict
+	case 7004, 7008, 7010, 7011, 7012, 7013, 7016, 7026, 7027:
+		return dm.ErrInvalidParameter
+	}
+	return nil
+}
+
+// OperateResult is the agent's answer to an Operate request. Synchronous commands return Output;
+// asynchronous ones return RequestPath (the Device.LocalAgent.Request.{i} object) and report
+// completion later as an OperationComplete notification.
+type OperateResult struct {
+	Command     string
+	Output      map[string]string
+	RequestPath string
+}
+
+// IsUSPEndpoint reports whether id is a USP endpoint ID ("<authority-scheme>::<authority-id>")
+// rather than a WebPA device ID such as "mac:001122334455".
+func IsUSPEndpoint(id dm.DeviceID) bool {
+	i := strings.Index(string(id), "::")
+	return i > 0 && i+2 < len(id)
+}
+
+// NewUSPAdapter starts an adapter reading Records from o.MTP until Close.
+func NewUSPAdapter(o USPOptions) (*USPAdapter, error) {
+	if o.EndpointID == "" {
+		return nil, errors.New("EndpointID required")
+	}
+	if o.MTP == nil {
+		return nil, errors.New("MTP required")
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 30 * time.Second
+	}
+	a := &USPAdapter{
+		endpointID: o.EndpointID,
+		mtp:        o.MTP,
+		timeout:    o.Timeout,
+		retry:      o.Retry,
+		pending:    make(map[string]chan *usp.Msg),
+		done:       make(chan struct{}),
+	}
+	go a.readLoop()
+	return a, nil
+}
+
+// Get reads parameters; paths may be full names or partial paths ending in ".". Values are the
+// agent's string representations (USP Get does not carry types).
+func (a *USPAdapter) Get(ctx context.Context, agent dm.DeviceID, paths []string) (*GetResult, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("paths required")
+	}
+	var resp *usp.Msg
+	err := a.retry.Do(ctx, func() (err error) {
+		resp, err = a.request(ctx, agent, &usp.Msg{Get: &usp.Get{ParamPaths: paths}})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.GetResp == nil {
+		return nil, fmt.Errorf("usp: unexpected response type %d to Get", resp.Type)
+	}
+	now := time.Now()
+	out := &GetResult{Values: make(map[string]dm.ParameterValue)}
+	for _, r := range resp.GetResp.Results {
+		if r.ErrCode != 0 {
+			return nil, &USPError{Path: r.RequestedPath, Code: r.ErrCode, Message: r.ErrMsg}
+		}
+		for _, res := range r.Resolved {
+			for k, v := range res.Params {
+				name := res.ResolvedPath + k
+				out.Values[name] = dm.ParameterValue{Name: name, Value: v, RetrievedAt: now, Freshness: dm.FreshRealTime}
+			}
+		}
+	}
+	return out, nil
+}
+
+// Set writes parameters, grouped by object path, as one all-or-nothing request (allow_partial=false).
+// Compare-and-set conditions are not supported by USP and are rejected.
+func (a *USPAdapter) Set(ctx context.Context, agent dm.DeviceID, params []dm.SetParameter, opts dm.SetOptions) (*SetResult, error) {
+	if len(params) == 0 {
+		return nil, errors.New("params required")
+	}
+	if opts.TestAndSet != nil {
+		return nil, fmt.Errorf("test-and-set is not supported over USP: %w", dm.ErrInvalidParameter)
+	}
+	set := &usp.Set{}
+	objects := make(map[string]int)
+	for _, p := range params {
+		i := strings.LastIndex(p.Name, ".")
+		if i <= 0 || i == len(p.Name)-1 {
+			return nil, fmt.Errorf("%q is not a parameter name: %w", p.Name, dm.ErrInvalidParameter)
+		}
+		obj, name := p.Name[:i+1], p.Name[i+1:]
+		idx, ok := objects[obj]
+		if !ok {
+			idx = len(set.Objects)
+			objects[obj] = idx
+			set.Objects = append(set.Objects, usp.UpdateObject{ObjPath: obj})
+		}
+		set.Objects[idx].Params = append(set.Objects[idx].Params, usp.UpdateParamSetting{Param: name, Value: formatUSPValue(p.Value), Required: true})
+	}
+	if opts.DryRun {
+		payload, err := json.Marshal(set)
+		if err != nil {
+			return nil, err
+		}
+		return &SetResult{DryRun: &DryRunReport{Endpoint: string(agent), Payload: payload}}, nil
+	}
+	resp, err := a.request(ctx, agent, &usp.Msg{Set: set})
+	if err != nil {
+		return nil, err
+	}
+	if resp.SetResp == nil {
+		return nil, fmt.Errorf("usp: unexpected response type %d to Set", resp.Type)
+	}
+	out := &SetResult{}
+	for _, r := range resp.SetResp.Results {
+		if f := r.Failure; f != nil {
+			for _, in := range f.Instances {
+				if len(in.ParamErrs) > 0 {
+					pe := in.ParamErrs[0]
+					return nil, &USPError{Path: in.AffectedPath + pe.Path, Code: pe.ErrCode, Message: pe.ErrMsg}
+				}
+			}
+			return nil, &USPError{Path: r.RequestedPath, Code: f.ErrCode, Message: f.ErrMsg}
+		}
+		for _, in := range r.Updated {
+			for k := range in.UpdatedParams {
+				out.Applied = append(out.Applied, in.AffectedPath+k)
+			}
+		}
+	}
+	sort.Strings(out.Applied)
+	return out, nil
+}
+
+// Operate invokes command (e.g. "Device.Reboot()") with input arguments.
+func (a *USPAdapter) Operate(ctx context.Context, agent dm.DeviceID, command string, args map[string]string) (*OperateResult, error) {
+	if command == "" {
+		return nil, errors.New("command required")
+	}
+	resp, err := a.request(ctx, agent, &usp.Msg{Operate: &usp.Operate{Command: command, CommandKey: uuid.NewString(), SendResp: true, InputArgs: args}})
+	if err != nil {
+		return nil, err
+	}
+	if resp.OperateResp == nil {
+		return nil, fmt.Errorf("usp: unexpected response type %d to Operate", resp.Type)
+	}
+	if len(resp.OperateResp.Results) == 0 {
+		return nil, errors.New("usp: empty OperateResp")
+	}
+	r := resp.OperateResp.Results[0]
+	if r.Failure != nil {
+		return nil, &USPError{Path: command, Code: r.Failure.ErrCode, Message: r.Failure.ErrMsg}
+	}
+	return &OperateResult{Command: r.ExecutedCommand, Output: r.OutputArgs, RequestPath: r.ReqObjPath}, nil
+}
+
+// Subscribe returns agent notifications as EventNotification events. ValueChange notifications
+// carry a dm.ParameterValue payload; every other kind carries the decoded usp.Notify.
+func (a *USPAdapter) Subscribe(buffer int) dm.EventSubscription {
+	ch := make(chan dm.Event, buffer)
+	a.listenersMu.Lock()
+	a.listeners = append(a.listeners, ch)
+	a.listenersMu.Unlock()
+	return &eventSub{ch: ch, closeFn: func() { a.unsubscribe(ch) }}
+}
+
+func (a *USPAdapter) unsubscribe(ch chan dm.Event) {
+	a.listenersMu.Lock()
+	defer a.listenersMu.Unlock()
+	for i, l := range a.listeners {
+		if l == ch {
+			a.listeners = append(a.listeners[:i:i], a.listeners[i+1:]...)
+			break
+		}
+	}
+	close(ch)
+}
+
+// Close closes the MTP and fails outstanding requests.
+func (a *USPAdapter) Close() error {
+	var err error
+	a.closeOnce.Do(func() {
+		close(a.done)
+		err = a.mtp.Close()
+	})
+	return err
+}
+
+func (a *USPAdapter) request(ctx context.Context, agent dm.DeviceID, msg *usp.Msg) (*usp.Msg, error) {
+	msg.ID = uuid.NewString()
+	payload, err := msg.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	rec := (&usp.Record{Version: usp.Version, ToID: string(agent), FromID: a.endpointID, Payload: payload}).Marshal()
+
+	key := string(agent) + "|" + msg.ID
+	ch := make(chan *usp.Msg, 1)
+	a.pendingMu.Lock()
+	a.pending[key] = ch
+	a.pendingMu.Unlock()
+	defer func() {
+		a.pendingMu.Lock()
+		delete(a.pending, key)
+		a.pendingMu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	if err := a.mtp.Send(ctx, string(agent), rec); err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("usp %s %s: %w", agent, msg.ID, dm.ErrTimeout)
+	case <-a.done:
+		return nil, errors.New("usp adapter closed")
+	case resp := <-ch:
+		if resp.Error != nil {
+			return nil, &USPError{Code: resp.Error.ErrCode, Message: resp.Error.ErrMsg}
+		}
+		return resp, nil
+	}
+}
+
+func (a *USPAdapter) readLoop() {
+	defer a.Close()
+	for b := range a.mtp.Records() {
+		rec, err := usp.UnmarshalRecord(b)
+		if err != nil || rec.Type != usp.RecordNoSessionContext || (rec.ToID != "" && rec.ToID != a.endpointID) {
+			continue
+		}
+		msg, err := usp.UnmarshalMsg(rec.Payload)
+		if err != nil {
+			continue
+		}
+		if msg.Notify != nil {
+			a.notify(rec.FromID, msg)
+			continue
+		}
+		a.pendingMu.Lock()
+		ch, ok := a.pending[rec.FromID+"|"+msg.ID]
+		a.pendingMu.Unlock()
+		if ok {
+			select {
+			case ch <- msg:
+			default:
+			}
+		}
+	}
+}
+
+func (a *USPAdapter) notify(from string, msg *usp.Msg) {
+	n := msg.Notify
+	evt := dm.Event{Kind: dm.EventNotification, DeviceID: dm.DeviceID(from), OccurredAt: time.Now(), Source: "usp-adapter", Payload: *n}
+	if vc := n.ValueChange; vc != nil {
+		evt.Payload = dm.ParameterValue{Name: vc.ParamPath, Value: vc.ParamValue, RetrievedAt: evt.OccurredAt, Freshness: dm.FreshRealTime}
+	}
+	a.listenersMu.RLock()
+	for _, ch := range a.listeners {
+		select {
+		case ch <- evt:
+		default: /* drop if slow */
+		}
+	}
+	a.listenersMu.RUnlock()
+	if !n.SendResp {
+		return
+	}
+	// The NotifyResp reuses the Notify's message ID.
+	payload, err := (&usp.Msg{ID: msg.ID, NotifyResp: &usp.NotifyResp{SubscriptionID: n.SubscriptionID}}).Marshal()
+	if err != nil {
+		return
+	}
+	rec := (&usp.Record{Version: usp.Version, ToID: from, FromID: a.endpointID, Payload: payload}).Marshal()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+		defer cancel()
+		_ = a.mtp.Send(ctx, from, rec)
+	}()
+}
+
+// formatUSPValue renders a parameter value the way USP transports them (strings).
+func formatUSPValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case bool:
+		return strconv.FormatBool(t)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
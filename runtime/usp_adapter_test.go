@@ -0,0 +1,221 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/usp"
+)
+
+const testAgent = "os::001122-SN1"
+
+// fakeAgent connects to the controller's WebSocketMTP and answers requests with respond.
+func fakeAgent(t *testing.T, url string, respond func(req *usp.Msg) *usp.Msg) (*websocket.Conn, chan *usp.Msg) {
+	t.Helper()
+	d := websocket.Dialer{Subprotocols: []string{USPWebSocketSubprotocol}}
+	c, resp, err := d.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if resp.Header.Get("Sec-WebSocket-Protocol") != USPWebSocketSubprotocol {
+		t.Fatalf("subprotocol not negotiated")
+	}
+	connect := &usp.Record{Version: usp.Version, FromID: testAgent, Type: usp.RecordWebSocketConnect}
+	if err := c.WriteMessage(websocket.BinaryMessage, connect.Marshal()); err != nil {
+		t.Fatalf("connect record: %v", err)
+	}
+	seen := make(chan *usp.Msg, 16)
+	go func() {
+		for {
+			_, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			rec, err := usp.UnmarshalRecord(data)
+			if err != nil {
+				t.Errorf("record: %v", err)
+				return
+			}
+			req, err := usp.UnmarshalMsg(rec.Payload)
+			if err != nil {
+				t.Errorf("msg: %v", err)
+				return
+			}
+			seen <- req
+			out := respond(req)
+			if out == nil {
+				continue
+			}
+			out.ID = req.ID
+			writeAgentMsg(t, c, rec.FromID, out)
+		}
+	}()
+	return c, seen
+}
+
+func writeAgentMsg(t *testing.T, c *websocket.Conn, to string, m *usp.Msg) {
+	t.Helper()
+	payload, err := m.Marshal()
+	if err != nil {
+		t.Errorf("marshal: %v", err)
+		return
+	}
+	rec := &usp.Record{Version: usp.Version, ToID: to, FromID: testAgent, Payload: payload}
+	if err := c.WriteMessage(websocket.BinaryMessage, rec.Marshal()); err != nil {
+		t.Errorf("write: %v", err)
+	}
+}
+
+func newUSPTest(t *testing.T, respond func(req *usp.Msg) *usp.Msg) (*USPAdapter, *websocket.Conn, chan *usp.Msg) {
+	t.Helper()
+	mtp := NewWebSocketMTP()
+	srv := httptest.NewServer(mtp)
+	t.Cleanup(srv.Close)
+	a, err := NewUSPAdapter(USPOptions{EndpointID: "self::devicemgr", MTP: mtp, Timeout: 2 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	c, seen := fakeAgent(t, srv.URL, respond)
+	t.Cleanup(func() { c.Close() })
+	deadline := time.Now().Add(time.Second)
+	for len(mtp.Connected()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("agent never registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return a, c, seen
+}
+
+func TestEndpointFromExtensions(t *testing.T) {
+	h := http.Header{}
+	h.Add("Sec-WebSocket-Extensions", "permessage-deflate")
+	h.Add("Sec-WebSocket-Extensions", `bbf-usp-protocol; eid="`+testAgent+`"`)
+	if got := endpointFromExtensions(h); got != testAgent {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestUSPAdapterGetSetOperate(t *testing.T) {
+	a, _, seen := newUSPTest(t, func(req *usp.Msg) *usp.Msg {
+		switch {
+		case req.Get != nil:
+			return &usp.Msg{GetResp: &usp.GetResp{Results: []usp.RequestedPathResult{{
+				RequestedPath: "Device.DeviceInfo.",
+				Resolved:      []usp.ResolvedPathResult{{ResolvedPath: "Device.DeviceInfo.", Params: map[string]string{"SoftwareVersion": "2.0", "UpTime": "42"}}},
+			}}}}
+		case req.Set != nil:
+			var rs []usp.UpdatedObjectResult
+			for _, o := range req.Set.Objects {
+				up := map[string]string{}
+				for _, p := range o.Params {
+					up[p.Param] = p.Value
+				}
+				rs = append(rs, usp.UpdatedObjectResult{RequestedPath: o.ObjPath, Updated: []usp.UpdatedInstance{{AffectedPath: o.ObjPath, UpdatedParams: up}}})
+			}
+			return &usp.Msg{SetResp: &usp.SetResp{Results: rs}}
+		case req.Operate != nil:
+			return &usp.Msg{OperateResp: &usp.OperateResp{Results: []usp.OperationResult{{ExecutedCommand: req.Operate.Command, OutputArgs: map[string]string{"Status": "ok"}}}}}
+		}
+		return nil
+	})
+	ctx := context.Background()
+
+	res, err := a.Get(ctx, testAgent, []string{"Device.DeviceInfo."})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if v := res.Values["Device.DeviceInfo.SoftwareVersion"]; v.Value != "2.0" || v.Freshness != dm.FreshRealTime {
+		t.Fatalf("unexpected value %+v", v)
+	}
+	<-seen
+
+	sr, err := a.Set(ctx, testAgent, []dm.SetParameter{
+		{Name: "Device.WiFi.SSID.1.SSID", Value: "home"},
+		{Name: "Device.WiFi.SSID.1.Enable", Value: true},
+		{Name: "Device.Time.Enable", Value: false},
+	}, dm.SetOptions{})
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	req := <-seen
+	if req.Set.AllowPartial || len(req.Set.Objects) != 2 || req.Set.Objects[0].ObjPath != "Device.WiFi.SSID.1." || req.Set.Objects[0].Params[1].Value != "true" {
+		t.Fatalf("unexpected set request %+v", req.Set)
+	}
+	if want := []string{"Device.Time.Enable", "Device.WiFi.SSID.1.Enable", "Device.WiFi.SSID.1.SSID"}; strings.Join(sr.Applied, ",") != strings.Join(want, ",") {
+		t.Fatalf("applied %v", sr.Applied)
+	}
+
+	or, err := a.Operate(ctx, testAgent, "Device.SelfTestDiagnostics()", nil)
+	if err != nil {
+		t.Fatalf("operate: %v", err)
+	}
+	if or.Output["Status"] != "ok" || (<-seen).Operate.CommandKey == "" {
+		t.Fatalf("unexpected operate result %+v", or)
+	}
+}
+
+func TestUSPAdapterErrors(t *testing.T) {
+	a, _, _ := newUSPTest(t, func(req *usp.Msg) *usp.Msg {
+		switch {
+		case req.Get != nil:
+			return &usp.Msg{GetResp: &usp.GetResp{Results: []usp.RequestedPathResult{{RequestedPath: req.Get.ParamPaths[0], ErrCode: 7026, ErrMsg: "invalid path"}}}}
+		case req.Set != nil:
+			return &usp.Msg{Error: &usp.Error{ErrCode: 7006, ErrMsg: "permission denied"}}
+		}
+		return nil // Operate never answers
+	})
+	ctx := context.Background()
+	if _, err := a.Get(ctx, testAgent, []string{"Device.Nope."}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("expected ErrInvalidParameter, got %v", err)
+	}
+	if _, err := a.Set(ctx, testAgent, []dm.SetParameter{{Name: "Device.X.Y", Value: 1}}, dm.SetOptions{}); !errors.Is(err, dm.ErrAccessDenied) {
+		t.Fatalf("expected ErrAccessDenied, got %v", err)
+	}
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := a.Operate(tctx, testAgent, "Device.Reboot()", nil); !errors.Is(err, dm.ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if _, err := a.Get(ctx, "os::unknown", []string{"Device."}); !errors.Is(err, dm.ErrDeviceOffline) {
+		t.Fatalf("expected ErrDeviceOffline, got %v", err)
+	}
+	if _, err := a.Set(ctx, testAgent, []dm.SetParameter{{Name: "Device.X."}}, dm.SetOptions{}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("expected ErrInvalidParameter for object path, got %v", err)
+	}
+}
+
+func TestUSPAdapterNotify(t *testing.T) {
+	a, c, seen := newUSPTest(t, func(*usp.Msg) *usp.Msg { return nil })
+	sub := a.Subscribe(4)
+	defer sub.Close()
+
+	writeAgentMsg(t, c, "self::devicemgr", &usp.Msg{ID: "n1", Notify: &usp.Notify{SubscriptionID: "vc", SendResp: true, ValueChange: &usp.ValueChange{ParamPath: "Device.WiFi.SSID.1.SSID", ParamValue: "guest"}}})
+	writeAgentMsg(t, c, "self::devicemgr", &usp.Msg{ID: "n2", Notify: &usp.Notify{SubscriptionID: "boot", Event: &usp.NotifyEvent{ObjPath: "Device.", EventName: "Boot!"}}})
+
+	evt := <-sub.C()
+	pv, ok := evt.Payload.(dm.ParameterValue)
+	if evt.Kind != dm.EventNotification || evt.DeviceID != testAgent || !ok || pv.Name != "Device.WiFi.SSID.1.SSID" || pv.Value != "guest" {
+		t.Fatalf("unexpected value change event %+v", evt)
+	}
+	evt = <-sub.C()
+	if n, ok := evt.Payload.(usp.Notify); !ok || n.Event == nil || n.Event.EventName != "Boot!" {
+		t.Fatalf("unexpected event %+v", evt)
+	}
+	select {
+	case resp := <-seen:
+		if resp.NotifyResp == nil || resp.ID != "n1" || resp.NotifyResp.SubscriptionID != "vc" {
+			t.Fatalf("unexpected notify response %+v", resp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no NotifyResp for send_resp notification")
+	}
+}
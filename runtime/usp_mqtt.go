@@ -0,0 +1,100 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/xmidt-org/talaria/devicemgr/mqtt"
+	"github.com/xmidt-org/talaria/devicemgr/usp"
+)
+
+// DefaultUSPAgentTopic is where records for an agent are published unless the agent announced its
+// own topic in an MQTT connect record.
+const DefaultUSPAgentTopic = "usp/agent/{endpoint}"
+
+// MQTTMTPOptions configures an MQTTMTP.
+type MQTTMTPOptions struct {
+	Client          *mqtt.Client // required
+	ControllerTopic string       // required; topic agents publish controller-bound records to
+	AgentTopic      string       // optional; DefaultUSPAgentTopic
+	QoS             byte         // 0 or 1
+}
+
+// MQTTMTP is the USP MQTT MTP. It receives records on the controller topic and publishes records to
+// each agent's topic: the subscribed topic from the agent's MQTT connect record when one was seen,
+// otherwise AgentTopic.
+type MQTTMTP struct {
+	client  *mqtt.Client
+	qos     byte
+	agent   topicTemplate
+	records chan []byte
+
+	mu        sync.Mutex
+	closed    bool
+	announced map[string]string // endpoint ID -> topic from its connect record
+}
+
+var _ MTP = (*MQTTMTP)(nil)
+
+// NewMQTTMTP subscribes to the controller topic.
+func NewMQTTMTP(ctx context.Context, o MQTTMTPOptions) (*MQTTMTP, error) {
+	if o.Client == nil {
+		return nil, errors.New("Client required")
+	}
+	if o.ControllerTopic == "" {
+		return nil, errors.New("ControllerTopic required")
+	}
+	agent, err := parseTopicTemplate(orDefault(o.AgentTopic, DefaultUSPAgentTopic))
+	if err != nil {
+		return nil, fmt.Errorf("AgentTopic: %w", err)
+	}
+	m := &MQTTMTP{client: o.Client, qos: o.QoS, agent: agent, records: make(chan []byte, 64), announced: make(map[string]string)}
+	if err := o.Client.Subscribe(ctx, o.ControllerTopic, o.QoS, m.onRecord); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *MQTTMTP) onRecord(_ string, payload []byte) {
+	rec, err := usp.UnmarshalRecord(payload)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	if err == nil && rec.Type == usp.RecordMQTTConnect && rec.FromID != "" && rec.SubscribedTopic != "" {
+		m.announced[rec.FromID] = rec.SubscribedTopic
+	}
+	select {
+	case m.records <- append([]byte(nil), payload...):
+	default: /* drop if the adapter falls behind; USP requests time out and can be retried */
+	}
+}
+
+// Send publishes record to the agent's topic.
+func (m *MQTTMTP) Send(ctx context.Context, endpointID string, record []byte) error {
+	m.mu.Lock()
+	topic, ok := m.announced[endpointID]
+	m.mu.Unlock()
+	if !ok {
+		topic = m.agent.format(endpointID, "")
+	}
+	return m.client.Publish(ctx, topic, m.qos, record)
+}
+
+func (m *MQTTMTP) Records() <-chan []byte { return m.records }
+
+// Close disconnects the MQTT client and closes Records.
+func (m *MQTTMTP) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	close(m.records)
+	m.mu.Unlock()
+	return m.client.Close()
+}
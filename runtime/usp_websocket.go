@@ -0,0 +1,192 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/usp"
+)
+
+// USPWebSocketSubprotocol is the WebSocket subprotocol for the USP WebSocket MTP (TR-369 section 6.4).
+const USPWebSocketSubprotocol = "v1.usp"
+
+var eidExtension = regexp.MustCompile(`bbf-usp-protocol\s*;\s*eid="([^"]+)"`)
+
+// WebSocketMTP is the USP WebSocket MTP. Agents either connect to it (mount it as an http.Handler)
+// or are dialed with Dial. A connection is bound to the agent endpoint ID announced in the
+// bbf-usp-protocol extension header, or otherwise to the from_id of the first Record it carries.
+type WebSocketMTP struct {
+	upgrader websocket.Upgrader
+	dialer   *websocket.Dialer
+	filter   FrameFilter // optional; applied to every inbound frame
+
+	records chan []byte
+	done    chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+	conns  map[string]*uspConn // endpoint ID -> connection
+	all    map[*uspConn]struct{}
+	wg     sync.WaitGroup
+}
+
+type uspConn struct {
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+}
+
+var _ MTP = (*WebSocketMTP)(nil)
+
+func NewWebSocketMTP() *WebSocketMTP {
+	return &WebSocketMTP{
+		upgrader: websocket.Upgrader{Subprotocols: []string{USPWebSocketSubprotocol}},
+		dialer:   &websocket.Dialer{HandshakeTimeout: 10 * time.Second, Subprotocols: []string{USPWebSocketSubprotocol}},
+		records:  make(chan []byte, 64),
+		done:     make(chan struct{}),
+		conns:    make(map[string]*uspConn),
+		all:      make(map[*uspConn]struct{}),
+	}
+}
+
+// SetFrameFilter installs f on inbound frames; call it before agents connect.
+func (w *WebSocketMTP) SetFrameFilter(f FrameFilter) { w.filter = f }
+
+// ServeHTTP accepts an agent-initiated connection.
+func (w *WebSocketMTP) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	ws, err := w.upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		return // Upgrade has already replied
+	}
+	w.serve(ws, endpointFromExtensions(r.Header))
+}
+
+// Dial connects to an agent's WebSocket server; the connection serves until it fails or the MTP closes.
+func (w *WebSocketMTP) Dial(ctx context.Context, endpointID, url string, header http.Header) error {
+	if endpointID == "" {
+		return errors.New("endpointID required")
+	}
+	ws, _, err := w.dialer.DialContext(ctx, url, header)
+	if err != nil {
+		return err
+	}
+	go w.serve(ws, endpointID)
+	return nil
+}
+
+func endpointFromExtensions(h http.Header) string {
+	for _, v := range h.Values("Sec-WebSocket-Extensions") {
+		if m := eidExtension.FindStringSubmatch(v); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+func (w *WebSocketMTP) serve(ws *websocket.Conn, endpointID string) {
+	c := &uspConn{ws: ws}
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		_ = ws.Close()
+		return
+	}
+	w.all[c] = struct{}{}
+	if endpointID != "" {
+		w.conns[endpointID] = c
+	}
+	w.wg.Add(1)
+	w.mu.Unlock()
+
+	bound := map[string]bool{endpointID: endpointID != ""}
+	defer func() {
+		w.mu.Lock()
+		delete(w.all, c)
+		for id := range bound {
+			if w.conns[id] == c {
+				delete(w.conns, id)
+			}
+		}
+		w.mu.Unlock()
+		_ = ws.Close()
+		w.wg.Done()
+	}()
+	for {
+		mt, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if mt != websocket.BinaryMessage {
+			continue
+		}
+		if w.filter != nil {
+			var ok bool
+			if data, ok = w.filter(data); !ok {
+				continue
+			}
+		}
+		if rec, err := usp.UnmarshalRecord(data); err == nil && rec.FromID != "" && !bound[rec.FromID] {
+			bound[rec.FromID] = true
+			w.mu.Lock()
+			w.conns[rec.FromID] = c
+			w.mu.Unlock()
+		}
+		select {
+		case w.records <- data:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Send writes record to the agent's connection.
+func (w *WebSocketMTP) Send(ctx context.Context, endpointID string, record []byte) error {
+	w.mu.Lock()
+	c := w.conns[endpointID]
+	w.mu.Unlock()
+	if c == nil {
+		return fmt.Errorf("usp agent %s not connected: %w", endpointID, dm.ErrDeviceOffline)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	deadline, _ := ctx.Deadline()
+	_ = c.ws.SetWriteDeadline(deadline)
+	return c.ws.WriteMessage(websocket.BinaryMessage, record)
+}
+
+// Connected lists the endpoint IDs of agents with an open connection.
+func (w *WebSocketMTP) Connected() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]string, 0, len(w.conns))
+	for id := range w.conns {
+		out = append(out, id)
+	}
+	return out
+}
+
+func (w *WebSocketMTP) Records() <-chan []byte { return w.records }
+
+// Close drops every connection and closes Records.
+func (w *WebSocketMTP) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.done)
+	for c := range w.all {
+		_ = c.ws.Close()
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+	close(w.records)
+	return nil
+}
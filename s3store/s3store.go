@@ -0,0 +1,167 @@
+// Package s3store keeps bulk job artifacts in an S3-compatible bucket (AWS S3, MinIO, Ceph RGW,
+// ...). Requests are path-style and signed with AWS Signature Version 4, so no SDK is needed.
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// DefaultRegion signs requests when ArtifactConfig.Region is empty.
+const DefaultRegion = "us-east-1"
+
+// Store is a dm.ArtifactStore writing one object per artifact, <prefix><job>/<name>.
+type Store struct {
+	cfg    dm.ArtifactConfig
+	base   *url.URL
+	client *http.Client
+	now    func() time.Time
+}
+
+var _ dm.ArtifactStore = (*Store)(nil)
+
+// New returns a Store for cfg.Bucket at cfg.Endpoint, the regional AWS endpoint when empty. A nil
+// client uses one with a 30s timeout.
+func New(cfg dm.ArtifactConfig, client *http.Client) (*Store, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("artifact bucket required: %w", dm.ErrInvalidParameter)
+	}
+	if cfg.Region == "" {
+		cfg.Region = DefaultRegion
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	base, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("artifact endpoint %q: %w", cfg.Endpoint, dm.ErrInvalidParameter)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Store{cfg: cfg, base: base, client: client, now: time.Now}, nil
+}
+
+func (s *Store) Put(ctx context.Context, key string, data []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	return b, nil
+}
+
+// do sends a signed request for the object holding key, failing unless it succeeds.
+func (s *Store) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	u := *s.base
+	u.Path += "/" + s.cfg.Bucket + "/" + s.cfg.Prefix + key
+	u.RawPath = uriEncode(u.Path) // as signed: device IDs hold colons
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	sum := sha256.Sum256(body)
+	sign(req, hex.EncodeToString(sum[:]), s.cfg, s.now().UTC())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", dm.ErrBackendUnavailable)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, dm.ErrArtifactNotFound
+	case resp.StatusCode/100 != 2:
+		resp.Body.Close()
+		return nil, dm.NewBackendError("s3", resp)
+	}
+	return resp, nil
+}
+
+// sign adds the x-amz-date, x-amz-content-sha256 and Authorization headers of AWS Signature
+// Version 4 to req, signing its host and every header already set.
+func sign(req *http.Request, payloadHash string, cfg dm.ArtifactConfig, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, k := range names {
+		canonical.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	path := uriEncode(req.URL.Path)
+	if path == "" {
+		path = "/"
+	}
+	request := strings.Join([]string{req.Method, path, req.URL.Query().Encode(), canonical.String(), signed, payloadHash}, "\n")
+	scope := day + "/" + cfg.Region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(request))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+cfg.SecretAccessKey), day)
+	for _, part := range []string{cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+cfg.AccessKeyID+"/"+scope+", SignedHeaders="+signed+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode percent-encodes every byte of a path but the unreserved characters and '/', as
+// Signature Version 4 canonicalizes it.
+func uriEncode(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,381 @@
+// Package schema is a catalog of data-model parameters: their WDMP data types, whether they are
+// writable, which device models implement them and the names they had in earlier data-model
+// versions. It checks SETs before they reach a device.
+package schema
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Instance is the path segment that matches any instance number, as in "Device.WiFi.SSID.{i}.SSID".
+const Instance = "{i}"
+
+// Types are the WDMP data type names a Parameter may have.
+var Types = []string{"string", "int", "unsignedInt", "boolean", "dateTime", "base64", "long", "unsignedLong", "float", "double", "byte"}
+
+// Parameter describes one data-model parameter.
+type Parameter struct {
+	Path     string   `json:"path"` // full TR-181 name; Instance segments match instance numbers
+	Type     string   `json:"type"` // one of Types
+	Writable bool     `json:"writable"`
+	Models   []string `json:"models,omitempty"` // device models implementing it; empty means all
+	Unit     string   `json:"unit,omitempty"`   // such as "dBm" or "seconds"
+	// Enum maps the values the parameter may take, in their string form, to human-readable
+	// labels; SETs of other values are rejected. Empty allows any value of Type.
+	Enum map[string]string `json:"enum,omitempty"`
+	// Paths are the names the parameter had in earlier data-model versions.
+	Paths []VersionPath `json:"paths,omitempty"`
+}
+
+// VersionPath is the name a Parameter has on devices whose data-model version is below Before.
+// When several apply, the one with the lowest Before does.
+type VersionPath struct {
+	Before string `json:"before"` // such as "2.12"
+	Path   string `json:"path"`   // with as many Instance segments as the current path, in the same order
+}
+
+// pathFor returns the name p has in version, "" when that is its current Path.
+func (p Parameter) pathFor(version string) string {
+	var best *VersionPath
+	for i, vp := range p.Paths {
+		if dm.CompareVersions(version, vp.Before) < 0 && (best == nil || dm.CompareVersions(vp.Before, best.Before) < 0) {
+			best = &p.Paths[i]
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.Path
+}
+
+// Catalog looks parameters up by name. It is read-only once built and safe for concurrent use.
+type Catalog struct {
+	exact    map[string]Parameter
+	patterns []pattern // paths with Instance segments, in definition order
+	renamed  []pattern // parameters with Paths
+}
+
+type pattern struct {
+	segments []string
+	param    Parameter
+}
+
+var (
+	_ dm.ParameterCatalog   = (*Catalog)(nil)
+	_ dm.ParameterDescriber = (*Catalog)(nil)
+	_ dm.ParameterResolver  = (*Catalog)(nil)
+)
+
+//go:embed tr181.json
+var defaultCatalog []byte
+
+// Default returns the built-in catalog of common TR-181 and RDK parameters.
+func Default() *Catalog {
+	c, err := Parse(defaultCatalog)
+	if err != nil {
+		panic("schema: built-in catalog: " + err.Error())
+	}
+	return c
+}
+
+// Load reads a catalog file: {"parameters":[{"path","type","writable","models","unit","enum",
+// "paths":[{"before","path"}]}]}.
+func Load(path string) (*Catalog, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse decodes a catalog document in the Load format.
+func Parse(b []byte) (*Catalog, error) {
+	var doc struct {
+		Parameters []Parameter `json:"parameters"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	return New(doc.Parameters)
+}
+
+// New builds a catalog, rejecting partial paths, unknown types, duplicate paths, enum values that
+// do not fit their parameter's type and version paths that do not match their parameter's
+// instances.
+func New(params []Parameter) (*Catalog, error) {
+	c := &Catalog{exact: make(map[string]Parameter)}
+	seen := make(map[string]bool)
+	for _, p := range params {
+		if p.Path == "" || strings.HasSuffix(p.Path, ".") {
+			return nil, fmt.Errorf("schema: %q is not a full parameter path", p.Path)
+		}
+		if !slices.Contains(Types, p.Type) {
+			return nil, fmt.Errorf("schema: %s: unknown type %q", p.Path, p.Type)
+		}
+		if seen[p.Path] {
+			return nil, fmt.Errorf("schema: %s defined twice", p.Path)
+		}
+		for v := range p.Enum {
+			if err := checkValue(p.Type, v); err != nil {
+				return nil, fmt.Errorf("schema: %s: enum value %q: %v", p.Path, v, err)
+			}
+		}
+		for _, vp := range p.Paths {
+			if vp.Before == "" || vp.Path == "" || strings.HasSuffix(vp.Path, ".") {
+				return nil, fmt.Errorf("schema: %s: version path %q before %q: need a version and a full path", p.Path, vp.Path, vp.Before)
+			}
+			if strings.Count(vp.Path, Instance) != strings.Count(p.Path, Instance) {
+				return nil, fmt.Errorf("schema: %s: version path %s has a different number of instances", p.Path, vp.Path)
+			}
+		}
+		seen[p.Path] = true
+		if len(p.Paths) > 0 {
+			c.renamed = append(c.renamed, pattern{segments: strings.Split(p.Path, "."), param: p})
+		}
+		if strings.Contains(p.Path, Instance) {
+			c.patterns = append(c.patterns, pattern{segments: strings.Split(p.Path, "."), param: p})
+		} else {
+			c.exact[p.Path] = p
+		}
+	}
+	return c, nil
+}
+
+// Lookup returns the parameter describing name.
+func (c *Catalog) Lookup(name string) (Parameter, bool) {
+	if p, ok := c.exact[name]; ok {
+		return p, true
+	}
+	segments := strings.Split(name, ".")
+	for _, pt := range c.patterns {
+		if matchSegments(pt.segments, segments) {
+			return pt.param, true
+		}
+	}
+	return Parameter{}, false
+}
+
+// Describe implements dm.ParameterDescriber.
+func (c *Catalog) Describe(name string) (dm.ParameterInfo, bool) {
+	p, ok := c.Lookup(name)
+	if !ok {
+		return dm.ParameterInfo{}, false
+	}
+	return dm.ParameterInfo{Type: p.Type, Unit: p.Unit, Enum: p.Enum}, true
+}
+
+// Versioned implements dm.ParameterResolver.
+func (c *Catalog) Versioned(name string) bool {
+	if !strings.HasSuffix(name, ".") {
+		p, ok := c.Lookup(name)
+		return ok && len(p.Paths) > 0
+	}
+	prefix := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for _, pt := range c.renamed {
+		if len(pt.segments) > len(prefix) && matchSegments(pt.segments[:len(prefix)], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// DevicePath implements dm.ParameterResolver. Names the catalog does not describe are returned
+// unchanged.
+func (c *Catalog) DevicePath(name, version string) string {
+	if version == "" {
+		return name
+	}
+	p, ok := c.Lookup(name)
+	if !ok {
+		return name
+	}
+	path := p.pathFor(version)
+	if path == "" {
+		return name
+	}
+	return fill(strings.Split(path, "."), instances(strings.Split(p.Path, "."), strings.Split(name, ".")))
+}
+
+// CanonicalPath implements dm.ParameterResolver.
+func (c *Catalog) CanonicalPath(path, version string) string {
+	if version == "" {
+		return path
+	}
+	segments := strings.Split(path, ".")
+	for _, pt := range c.renamed {
+		old := pt.param.pathFor(version)
+		if old == "" {
+			continue
+		}
+		if from := strings.Split(old, "."); matchSegments(from, segments) {
+			return fill(pt.segments, instances(from, segments))
+		}
+	}
+	return path
+}
+
+// instances returns the instance numbers of name at pattern's Instance segments.
+func instances(pattern, name []string) []string {
+	var out []string
+	for i, s := range pattern {
+		if s == Instance && i < len(name) {
+			out = append(out, name[i])
+		}
+	}
+	return out
+}
+
+// fill substitutes pattern's Instance segments with instance numbers, in order.
+func fill(pattern, numbers []string) string {
+	out := slices.Clone(pattern)
+	for i, s := range out {
+		if s == Instance && len(numbers) > 0 {
+			out[i], numbers = numbers[0], numbers[1:]
+		}
+	}
+	return strings.Join(out, ".")
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) != len(name) {
+		return false
+	}
+	for i, s := range pattern {
+		if s == Instance {
+			if _, err := strconv.ParseUint(name[i], 10, 32); err != nil {
+				return false
+			}
+		} else if s != name[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckSet implements dm.ParameterCatalog. Parameters missing from the catalog pass with an empty
+// type; described ones must be writable, implemented by model and given a value of their type
+// (and of their Enum, when set).
+func (c *Catalog) CheckSet(p dm.SetParameter, model string) (string, error) {
+	if p.Name == "" || strings.HasSuffix(p.Name, ".") {
+		return "", fmt.Errorf("%q is not a full parameter name: %w", p.Name, dm.ErrInvalidParameter)
+	}
+	spec, ok := c.Lookup(p.Name)
+	if !ok {
+		return "", nil
+	}
+	if p.Value == nil && p.Attributes != nil {
+		return spec.Type, nil // attribute-only writes leave the value alone
+	}
+	if !spec.Writable {
+		return spec.Type, fmt.Errorf("%s is read-only: %w", p.Name, dm.ErrInvalidParameter)
+	}
+	if model != "" && len(spec.Models) > 0 && !slices.Contains(spec.Models, model) {
+		return spec.Type, fmt.Errorf("%s is not implemented by model %s: %w", p.Name, model, dm.ErrInvalidParameter)
+	}
+	if p.TypeHint != "" && p.TypeHint != spec.Type {
+		return spec.Type, fmt.Errorf("%s is %s, not %s: %w", p.Name, spec.Type, p.TypeHint, dm.ErrInvalidParameter)
+	}
+	if err := checkValue(spec.Type, p.Value); err != nil {
+		return spec.Type, fmt.Errorf("%s: %v: %w", p.Name, err, dm.ErrInvalidParameter)
+	}
+	if err := (dm.ParameterInfo{Enum: spec.Enum}).CheckEnum(p.Value); err != nil {
+		return spec.Type, fmt.Errorf("%s: %w", p.Name, err)
+	}
+	return spec.Type, nil
+}
+
+// checkValue reports whether v, as a JSON value or its string form, fits typ.
+func checkValue(typ string, v interface{}) error {
+	s, isString := v.(string)
+	switch typ {
+	case "string":
+		switch v.(type) {
+		case string, float64, int, int64, bool:
+			return nil
+		}
+		return fmt.Errorf("want a string, got %T", v)
+	case "boolean":
+		if _, ok := v.(bool); ok {
+			return nil
+		}
+		if isString {
+			if _, err := strconv.ParseBool(s); err == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("want a boolean, got %v", v)
+	case "dateTime":
+		if isString {
+			if _, err := time.Parse(time.RFC3339, s); err == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("want an RFC 3339 time, got %v", v)
+	case "base64":
+		if isString {
+			if _, err := base64.StdEncoding.DecodeString(s); err == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("want base64 text, got %v", v)
+	}
+	n, ok := number(v)
+	if !ok {
+		return fmt.Errorf("want a number, got %v", v)
+	}
+	switch typ {
+	case "float", "double":
+		return nil
+	}
+	if n != math.Trunc(n) {
+		return fmt.Errorf("want an integer, got %v", v)
+	}
+	min, max := math.Inf(-1), math.Inf(1)
+	switch typ {
+	case "int":
+		min, max = math.MinInt32, math.MaxInt32
+	case "unsignedInt":
+		min, max = 0, math.MaxUint32
+	case "unsignedLong":
+		min = 0
+	case "byte":
+		min, max = 0, math.MaxUint8
+	}
+	if n < min || n > max {
+		return fmt.Errorf("%v is out of range for %s", v, typ)
+	}
+	return nil
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,138 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestCatalogLookup(t *testing.T) {
+	c := Default()
+	for name, want := range map[string]string{
+		"Device.DeviceInfo.ModelName":                   "Device.DeviceInfo.ModelName",
+		"Device.WiFi.SSID.10.SSID":                      "Device.WiFi.SSID.{i}.SSID",
+		"Device.IP.Interface.1.IPv4Address.2.IPAddress": "Device.IP.Interface.{i}.IPv4Address.{i}.IPAddress",
+		"Device.WiFi.SSID.x.SSID":                       "",
+		"Device.WiFi.SSID.1.SSID.Extra":                 "",
+		"Device.X_UNKNOWN":                              "",
+	} {
+		p, ok := c.Lookup(name)
+		if ok != (want != "") || p.Path != want {
+			t.Fatalf("%s: got %q %v, want %q", name, p.Path, ok, want)
+		}
+	}
+}
+
+func TestCatalogCheckSet(t *testing.T) {
+	c, err := New([]Parameter{
+		{Path: "Device.A.Enable", Type: "boolean", Writable: true},
+		{Path: "Device.A.Count", Type: "unsignedInt", Writable: true},
+		{Path: "Device.A.Name", Type: "string"},
+		{Path: "Device.A.{i}.Power", Type: "int", Writable: true, Models: []string{"XB7"}},
+		{Path: "Device.A.Mode", Type: "unsignedInt", Writable: true, Enum: map[string]string{"0": "Off", "1": "On"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		p       dm.SetParameter
+		model   string
+		typ     string
+		invalid bool
+	}{
+		{p: dm.SetParameter{Name: "Device.A.Enable", Value: "true"}, typ: "boolean"},
+		{p: dm.SetParameter{Name: "Device.A.Enable", Value: false}, typ: "boolean"},
+		{p: dm.SetParameter{Name: "Device.A.Enable", Value: "on"}, typ: "boolean", invalid: true},
+		{p: dm.SetParameter{Name: "Device.A.Enable", Value: true, TypeHint: "string"}, typ: "boolean", invalid: true},
+		{p: dm.SetParameter{Name: "Device.A.Count", Value: "12"}, typ: "unsignedInt"},
+		{p: dm.SetParameter{Name: "Device.A.Count", Value: -1.0}, typ: "unsignedInt", invalid: true},
+		{p: dm.SetParameter{Name: "Device.A.Count", Value: 1.5}, typ: "unsignedInt", invalid: true},
+		{p: dm.SetParameter{Name: "Device.A.Name", Value: "x"}, typ: "string", invalid: true},
+		{p: dm.SetParameter{Name: "Device.A.Name", Attributes: map[string]interface{}{"notify": 1}}, typ: "string"},
+		{p: dm.SetParameter{Name: "Device.A.3.Power", Value: -20.0}, model: "XB7", typ: "int"},
+		{p: dm.SetParameter{Name: "Device.A.3.Power", Value: -20.0}, model: "XB8", typ: "int", invalid: true},
+		{p: dm.SetParameter{Name: "Device.A.3.Power", Value: -20.0}, typ: "int"},
+		{p: dm.SetParameter{Name: "Device.A.Mode", Value: 1.0}, typ: "unsignedInt"},
+		{p: dm.SetParameter{Name: "Device.A.Mode", Value: "0"}, typ: "unsignedInt"},
+		{p: dm.SetParameter{Name: "Device.A.Mode", Value: 2.0}, typ: "unsignedInt", invalid: true},
+		{p: dm.SetParameter{Name: "Device.Unknown", Value: "x"}},
+		{p: dm.SetParameter{Name: "Device.A.", Value: "x"}, invalid: true},
+	} {
+		typ, err := c.CheckSet(tc.p, tc.model)
+		if typ != tc.typ || (err != nil) != tc.invalid || (err != nil && !errors.Is(err, dm.ErrInvalidParameter)) {
+			t.Fatalf("%+v on %q: got %q %v", tc.p, tc.model, typ, err)
+		}
+	}
+}
+
+func TestCatalogNew(t *testing.T) {
+	for _, params := range [][]Parameter{
+		{{Path: "Device.A.", Type: "string"}},
+		{{Path: "Device.A", Type: "text"}},
+		{{Path: "Device.A", Type: "string"}, {Path: "Device.A", Type: "int"}},
+		{{Path: "Device.A", Type: "boolean", Enum: map[string]string{"yes": "Yes"}}},
+		{{Path: "Device.A.{i}.B", Type: "string", Paths: []VersionPath{{Before: "2.12", Path: "Device.A.B"}}}},
+		{{Path: "Device.A.B", Type: "string", Paths: []VersionPath{{Path: "Device.A.C"}}}},
+	} {
+		if _, err := New(params); err == nil {
+			t.Fatalf("%+v: expected an error", params)
+		}
+	}
+}
+
+func TestCatalogDescribe(t *testing.T) {
+	c := Default()
+	info, ok := c.Describe("Device.WiFi.AccessPoint.2.AssociatedDevice.4.SignalStrength")
+	if !ok || info.Unit != "dBm" || info.Type != "int" {
+		t.Fatalf("signal strength: %+v %v", info, ok)
+	}
+	info, _ = c.Describe("Device.WiFi.AccessPoint.1.Security.ModeEnabled")
+	if got := info.Label("WPA3-Personal-Transition"); got != "WPA2/WPA3 Personal" {
+		t.Fatalf("label %q", got)
+	}
+	if _, err := c.CheckSet(dm.SetParameter{Name: "Device.WiFi.AccessPoint.1.Security.ModeEnabled", Value: "WEP-64"}, ""); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("out-of-enum SET: %v", err)
+	}
+	if _, ok := c.Describe("Device.Unknown"); ok {
+		t.Fatal("described an unknown parameter")
+	}
+}
+
+func TestCatalogVersionPaths(t *testing.T) {
+	c, err := New([]Parameter{
+		{Path: "Device.WiFi.AccessPoint.{i}.Security.SAEPassphrase", Type: "string", Writable: true, Paths: []VersionPath{
+			{Before: "2.15", Path: "Device.WiFi.AccessPoint.{i}.Security.X_RDK_SAEPassphrase"},
+			{Before: "2.12", Path: "Device.WiFi.AccessPoint.{i}.X_RDK_Security.SAEPassphrase"},
+		}},
+		{Path: "Device.WiFi.SSID.{i}.SSID", Type: "string", Writable: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const current = "Device.WiFi.AccessPoint.3.Security.SAEPassphrase"
+	for version, want := range map[string]string{
+		"":     current,
+		"2.15": current,
+		"2.14": "Device.WiFi.AccessPoint.3.Security.X_RDK_SAEPassphrase",
+		"2.9":  "Device.WiFi.AccessPoint.3.X_RDK_Security.SAEPassphrase",
+	} {
+		if got := c.DevicePath(current, version); got != want {
+			t.Errorf("DevicePath(%q) = %s, want %s", version, got, want)
+		}
+		if got := c.CanonicalPath(want, version); got != current {
+			t.Errorf("CanonicalPath(%s, %q) = %s", want, version, got)
+		}
+	}
+	if got := c.DevicePath("Device.WiFi.SSID.1.SSID", "2.9"); got != "Device.WiFi.SSID.1.SSID" {
+		t.Errorf("unversioned parameter resolved to %s", got)
+	}
+	for name, want := range map[string]bool{
+		current: true, "Device.WiFi.": true, "Device.WiFi.AccessPoint.3.": true,
+		"Device.WiFi.SSID.1.SSID": false, "Device.WiFi.SSID.": false, "Device.X_UNKNOWN": false,
+	} {
+		if got := c.Versioned(name); got != want {
+			t.Errorf("Versioned(%s) = %v", name, got)
+		}
+	}
+}
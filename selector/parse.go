@@ -0,0 +1,225 @@
+package selector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Parse parses a selection expression; a malformed one is dm.ErrInvalidParameter naming the
+// offending position.
+func Parse(s string) (Expr, error) {
+	toks, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	if p.peek().kind == tokEOF {
+		return nil, fmt.Errorf("empty selector: %w", dm.ErrInvalidParameter)
+	}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return e, nil
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokWord
+	tokString
+	tokOp   // comparison operator
+	tokAnd  // &&
+	tokOr   // ||
+	tokNot  // !
+	tokOpen // (
+	tokClose
+	tokColon
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int // byte offset in the expression
+}
+
+func lex(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("selector position %d: unterminated string: %w", i+1, dm.ErrInvalidParameter)
+			}
+			v, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("selector position %d: bad string %s: %w", i+1, s[i:j+1], dm.ErrInvalidParameter)
+			}
+			toks = append(toks, token{tokString, v, i})
+			i = j + 1
+		case strings.HasPrefix(s[i:], "&&"):
+			toks = append(toks, token{tokAnd, "&&", i})
+			i += 2
+		case strings.HasPrefix(s[i:], "||"):
+			toks = append(toks, token{tokOr, "||", i})
+			i += 2
+		case strings.HasPrefix(s[i:], "=="), strings.HasPrefix(s[i:], "!="), strings.HasPrefix(s[i:], "<="), strings.HasPrefix(s[i:], ">="):
+			toks = append(toks, token{tokOp, s[i : i+2], i})
+			i += 2
+		case c == '<' || c == '>':
+			toks = append(toks, token{tokOp, s[i : i+1], i})
+			i++
+		case c == '!':
+			toks = append(toks, token{tokNot, "!", i})
+			i++
+		case c == '(':
+			toks = append(toks, token{tokOpen, "(", i})
+			i++
+		case c == ')':
+			toks = append(toks, token{tokClose, ")", i})
+			i++
+		case c == ':':
+			toks = append(toks, token{tokColon, ":", i})
+			i++
+		default:
+			j := i
+			for j < len(s) && isWordByte(s[j]) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("selector position %d: unexpected %q: %w", i+1, s[i:i+1], dm.ErrInvalidParameter)
+			}
+			toks = append(toks, token{tokWord, s[i:j], i})
+			i = j
+		}
+	}
+	return append(toks, token{tokEOF, "end of selector", len(s)}), nil
+}
+
+// isWordByte reports whether c may appear in a field name or bare value: letters, digits and
+// "._-*/+", so versions, MACs and metadata keys need no quotes.
+func isWordByte(c byte) bool {
+	return c < unicode.MaxASCII && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))) || strings.IndexByte("._-*/+", c) >= 0
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return fmt.Errorf("selector position %d: %s: %w", t.pos+1, fmt.Sprintf(format, args...), dm.ErrInvalidParameter)
+}
+
+func (p *parser) or() (Expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = Or{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (Expr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokAnd {
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = And{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (Expr, error) {
+	switch t := p.next(); t.kind {
+	case tokNot:
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{x}, nil
+	case tokOpen:
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokClose {
+			return nil, p.errorf(c, "want ) to close the ( at position %d, got %q", t.pos+1, c.text)
+		}
+		return e, nil
+	case tokWord:
+		if strings.EqualFold(t.text, "tag") && p.peek().kind == tokColon {
+			p.next()
+			name := p.next()
+			if name.kind != tokWord && name.kind != tokString {
+				return nil, p.errorf(name, "want a tag name, got %q", name.text)
+			}
+			return Tag{Name: name.text}, nil
+		}
+		op := p.next()
+		if op.kind != tokOp {
+			return nil, p.errorf(op, "want a comparison after %s, got %q", t.text, op.text)
+		}
+		v := p.next()
+		if v.kind != tokWord && v.kind != tokString {
+			return nil, p.errorf(v, "want a value after %s %s, got %q", t.text, op.text, v.text)
+		}
+		return Compare{Field: fieldName(t.text), Op: Op(op.text), Value: v.text}, nil
+	default:
+		return nil, p.errorf(t, "want a term, got %q", t.text)
+	}
+}
+
+// quote renders v bare when the lexer would read it back as one word.
+func quote(v string) string {
+	if v == "" {
+		return `""`
+	}
+	for i := 0; i < len(v); i++ {
+		if !isWordByte(v[i]) {
+			return strconv.Quote(v)
+		}
+	}
+	return v
+}
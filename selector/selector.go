@@ -0,0 +1,187 @@
+// Package selector parses device selection expressions such as
+//
+//	model == "XB7" && firmware < "3.2" && tag:pilot
+//
+// into an AST and evaluates them against the device inventory to pick the targets of bulk jobs
+// and firmware rollouts.
+//
+// A comparison takes a field, one of ==, !=, <, <=, > and >=, and a value, quoted or bare. Fields
+// are the device query fields of runtime.QueryFields (model, firmware, and partner, which matches
+// any of the device's partners), "id", "status", "label.<key>" for annotation labels, or any other
+// metadata key, enrichment attributes included. Equality ignores case and a value ending in "*"
+// matches a prefix; a device without the field only matches !=. Ordering compares versions: a dotted value such as "3.2" is compared with the
+// first dotted number in the field, so "XB7_3.1p2s1_PROD" < "3.2", and other values compare
+// piecewise, runs of digits by number. tag:<name> matches devices whose comma-separated "tags"
+// attribute lists the name, or that carry an annotation label of that key. Terms combine with !,
+// && and ||, in that order of precedence, and parentheses.
+package selector
+
+import (
+	"context"
+	"strings"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// TagsAttribute is the metadata attribute, typically supplied by enrichment, listing a device's
+// tags.
+const TagsAttribute = "tags"
+
+// LabelPrefix marks fields matched against annotation labels, as in device queries.
+const LabelPrefix = "label."
+
+// Device is what an Expr is evaluated against.
+type Device struct {
+	ID       dm.DeviceID
+	Status   string            // online, suspect or offline
+	Metadata map[string]string // poll metadata merged with enrichment attributes
+	Labels   map[string]string // annotation labels; nil when annotations are not in use
+}
+
+// Expr is a node of a parsed selection expression.
+type Expr interface {
+	Match(d Device) bool
+	String() string
+}
+
+// And matches devices matching both sides.
+type And struct{ Left, Right Expr }
+
+// Or matches devices matching either side.
+type Or struct{ Left, Right Expr }
+
+// Not matches devices X does not.
+type Not struct{ X Expr }
+
+// Op is a comparison operator.
+type Op string
+
+const (
+	OpEq Op = "=="
+	OpNe Op = "!="
+	OpLt Op = "<"
+	OpLe Op = "<="
+	OpGt Op = ">"
+	OpGe Op = ">="
+)
+
+// Compare matches devices whose Field compares to Value as Op says.
+type Compare struct {
+	Field string // metadata key, after QueryFields; or "id", "status", "label.<key>"
+	Op    Op
+	Value string
+}
+
+// Tag matches devices tagged Name.
+type Tag struct{ Name string }
+
+func (e And) Match(d Device) bool { return e.Left.Match(d) && e.Right.Match(d) }
+func (e Or) Match(d Device) bool  { return e.Left.Match(d) || e.Right.Match(d) }
+func (e Not) Match(d Device) bool { return !e.X.Match(d) }
+
+func (e Compare) Match(d Device) bool {
+	v, ok := e.field(d)
+	if !ok {
+		return e.Op == OpNe
+	}
+	switch e.Op {
+	case OpEq, OpNe:
+		eq := equalFold(v, e.Value)
+		if e.Field == dm.MetadataPartnerIDs {
+			eq = false
+			for _, p := range dm.SplitPartners(v) {
+				eq = eq || equalFold(p, e.Value)
+			}
+		}
+		return eq == (e.Op == OpEq)
+	}
+	c := compareVersions(v, e.Value)
+	switch e.Op {
+	case OpLt:
+		return c < 0
+	case OpLe:
+		return c <= 0
+	case OpGt:
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func (e Compare) field(d Device) (string, bool) {
+	switch {
+	case e.Field == "id":
+		return string(d.ID), true
+	case e.Field == "status":
+		return d.Status, d.Status != ""
+	case strings.HasPrefix(e.Field, LabelPrefix):
+		v, ok := d.Labels[strings.TrimPrefix(e.Field, LabelPrefix)]
+		return v, ok
+	}
+	v, ok := d.Metadata[e.Field]
+	return v, ok && v != ""
+}
+
+func (e Tag) Match(d Device) bool {
+	for _, t := range strings.Split(d.Metadata[TagsAttribute], ",") {
+		if strings.EqualFold(strings.TrimSpace(t), e.Name) {
+			return true
+		}
+	}
+	for k := range d.Labels {
+		if strings.EqualFold(k, e.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e And) String() string { return "(" + e.Left.String() + " && " + e.Right.String() + ")" }
+func (e Or) String() string  { return "(" + e.Left.String() + " || " + e.Right.String() + ")" }
+func (e Not) String() string { return "!" + e.X.String() }
+func (e Tag) String() string { return "tag:" + e.Name }
+
+func (e Compare) String() string {
+	return e.Field + " " + string(e.Op) + " " + quote(e.Value)
+}
+
+// fieldName maps the short names of runtime.QueryFields to metadata keys.
+func fieldName(name string) string {
+	if key, ok := runtime.QueryFields[strings.ToLower(name)]; ok {
+		return key
+	}
+	if lower := strings.ToLower(name); lower == "id" || lower == "status" {
+		return lower
+	}
+	return name
+}
+
+// equalFold compares as device queries do: ignoring case, with a trailing "*" matching a prefix.
+func equalFold(v, want string) bool {
+	v, want = strings.ToLower(v), strings.ToLower(want)
+	if prefix, ok := strings.CutSuffix(want, "*"); ok {
+		return strings.HasPrefix(v, prefix)
+	}
+	return v == want
+}
+
+// Select returns, sorted, the devices of adapter's latest poll visible to the caller's partner
+// scope that match expr. Labels, which may be nil, holds the devices' annotation labels.
+func Select(ctx context.Context, adapter *runtime.DeviceAdapter, expr Expr, labels map[dm.DeviceID]map[string]string) []dm.DeviceID {
+	scope, scoped := dm.PartnersFromContext(ctx)
+	view := adapter.View()
+	out := []dm.DeviceID{}
+	for _, id := range view.IDs() {
+		meta := view.Metadata(id)
+		if scoped && !dm.PartnerAllowed(scope, dm.SplitPartners(meta[dm.MetadataPartnerIDs])) {
+			continue
+		}
+		status, _ := adapter.Status(id)
+		d := Device{ID: dm.DeviceID(id), Status: string(status), Metadata: meta, Labels: labels[dm.DeviceID(id)]}
+		if expr.Match(d) {
+			out = append(out, d.ID)
+		}
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package selector
+
+import (
+	"errors"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestParseAndMatch(t *testing.T) {
+	xb7 := Device{ID: "mac:1", Status: "online", Metadata: map[string]string{
+		dm.MetadataModel: "XB7", dm.MetadataFirmware: "CGM4331COM_3.1p2s1_PROD_sey", dm.MetadataPartnerIDs: "*,comcast", "tags": "pilot, lab",
+	}}
+	xb6 := Device{ID: "mac:2", Status: "suspect", Metadata: map[string]string{
+		dm.MetadataModel: "XB6", dm.MetadataFirmware: "XB6_4.10p1_PROD", dm.MetadataPartnerIDs: "sky",
+	}, Labels: map[string]string{"site": "north", "canary": ""}}
+	for _, tc := range []struct {
+		expr     string
+		xb7, xb6 bool
+	}{
+		{`model == "XB7" && firmware < "3.2" && tag:pilot`, true, false},
+		{`model == xb7`, true, false},
+		{`model != XB7`, false, true},
+		{`firmware >= 4.2`, false, true}, // 4.10 > 4.2 by number
+		{`firmware < 3.1`, false, false},
+		{`firmware <= 3.1`, true, false},
+		{`partner == comcast`, true, false},
+		{`model == XB* && !tag:pilot`, false, true},
+		{`tag:canary || status == online`, true, true},
+		{`label.site == north`, false, true},
+		{`enclosure == indoor`, false, false},
+		{`enclosure != indoor`, true, true},
+		{`(model == XB6 || model == XB7) && status != suspect`, true, false},
+		{`id == "mac:2"`, false, true},
+	} {
+		e, err := Parse(tc.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		if got := e.Match(xb7); got != tc.xb7 {
+			t.Errorf("%s on XB7 = %v (parsed %s)", tc.expr, got, e)
+		}
+		if got := e.Match(xb6); got != tc.xb6 {
+			t.Errorf("%s on XB6 = %v (parsed %s)", tc.expr, got, e)
+		}
+	}
+}
+
+func TestParsePrecedence(t *testing.T) {
+	e, err := Parse(`a == 1 || b == 2 && !c == 3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.String(), `(a == 1 || (b == 2 && !c == 3))`; got != want {
+		t.Fatalf("parsed %s, want %s", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, bad := range []string{``, `model`, `model ==`, `model == XB7 &&`, `(model == XB7`, `model == "XB7`, `tag:`, `model = XB7`, `model == XB7 )`} {
+		if _, err := Parse(bad); !errors.Is(err, dm.ErrInvalidParameter) {
+			t.Errorf("%q: %v", bad, err)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		v, want string
+		sign    int
+	}{
+		{"XB7_3.1p2s1_PROD", "3.2", -1},
+		{"XB7_3.10p2s1_PROD", "3.2", 1},
+		{"3.2", "3.2", 0},
+		{"PROD", "3.2", -1},
+		{"rel9", "rel10", -1},
+		{"b", "a", 1},
+	} {
+		if got := compareVersions(tc.v, tc.want); got != tc.sign {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tc.v, tc.want, got, tc.sign)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package selector
+
+import (
+	"regexp"
+	"strings"
+)
+
+var dottedVersion = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// compareVersions orders v against want. When want is a dotted version, v is represented by the
+// first dotted number it contains, so firmware names compare by their embedded version; a v
+// without one sorts first. Otherwise both compare piecewise.
+func compareVersions(v, want string) int {
+	if dottedVersion.FindString(want) == want {
+		found := dottedVersion.FindString(v)
+		if found == "" {
+			return -1
+		}
+		v = found
+	}
+	return naturalCompare(strings.ToLower(v), strings.ToLower(want))
+}
+
+// naturalCompare compares a and b run by run: runs of digits by number, other runs by byte.
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		ra, rb := run(a), run(b)
+		a, b = a[len(ra):], b[len(rb):]
+		if c := compareRun(ra, rb); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+func run(s string) string {
+	digit := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digit {
+		i++
+	}
+	return s[:i]
+}
+
+func compareRun(a, b string) int {
+	if isDigit(a[0]) && isDigit(b[0]) {
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
@@ -0,0 +1,415 @@
+// Package settings binds xconf settings profiles to device groups and keeps the groups' devices
+// in line with them. Each reconciliation reads the profile's parameters from every device of the
+// group, reports the ones that drifted as drift events, and writes back only those.
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+	"github.com/xmidt-org/talaria/devicemgr/jobs"
+	"github.com/xmidt-org/talaria/devicemgr/policy"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// ErrAssignmentNotFound is returned for an unknown (or out-of-scope) assignment name.
+var ErrAssignmentNotFound = errors.New("settings assignment not found")
+
+// DefaultInterval is how often Run reconciles when the interval given is not positive.
+const DefaultInterval = 90 * time.Second
+
+// reconcileConcurrency bounds the devices reconciled at once.
+const reconcileConcurrency = 8
+
+// Device reconciliation states.
+const (
+	StatePending = "pending" // not reconciled yet
+	StateInSync  = "in-sync" // reported the profile's values
+	StateUpdated = "updated" // drifted and was written back
+	StateFailed  = "failed"
+)
+
+// Devices is the subset of manager.Manager used by Service.
+type Devices interface {
+	QueryDevices(ctx context.Context, query string) ([]dm.DeviceState, error)
+	RefreshParameters(ctx context.Context, id dm.DeviceID, service string, names []string) (map[string]dm.ParameterValue, error)
+	SetParameters(ctx context.Context, id dm.DeviceID, service string, params []dm.SetParameter, opts dm.SetOptions) (*runtime.SetResult, error)
+	SettingsProfile(ctx context.Context, id string) (*policy.SettingsProfile, error)
+	Emit(e dm.Event)
+}
+
+// Assignment binds a settings profile to the devices matching Group, a device query such as
+// "model:XB7 partner:comcast" (empty selects every device).
+type Assignment struct {
+	Name      string    `json:"name"`
+	Profile   string    `json:"profile"` // xconf settings profile ID
+	Group     string    `json:"group"`
+	Service   string    `json:"service,omitempty"` // translation service the parameters go through
+	CreatedAt time.Time `json:"createdAt"`
+	// Partners is the partner scope of the caller that made the assignment; reconciliation never
+	// reaches devices outside it.
+	Partners []string `json:"partners,omitempty"`
+}
+
+// DeviceStatus is how far a device of the group is reconciled.
+type DeviceStatus struct {
+	Device    dm.DeviceID `json:"device"`
+	State     string      `json:"state"`
+	Drifted   []string    `json:"drifted,omitempty"` // parameters found drifted in the latest check
+	Error     string      `json:"error,omitempty"`
+	CheckedAt time.Time   `json:"checkedAt,omitempty"`
+	UpdatedAt time.Time   `json:"updatedAt,omitempty"` // last write-back
+}
+
+// Status is an assignment with its devices' reconciliation status.
+type Status struct {
+	Assignment
+	Reconciled time.Time      `json:"reconciledAt,omitempty"`
+	LastError  string         `json:"lastError,omitempty"` // of the latest round as a whole
+	Counts     map[string]int `json:"counts"`              // devices by state
+	Devices    []DeviceStatus `json:"devices"`
+}
+
+type assignment struct {
+	Assignment
+	reconciled time.Time
+	lastErr    string
+	devices    map[dm.DeviceID]*DeviceStatus
+}
+
+// Service keeps process-local assignments and reconciles them through a Manager.
+type Service struct {
+	m Devices
+
+	mu          sync.Mutex
+	assignments map[string]*assignment
+	running     map[string]bool // assignments being reconciled
+}
+
+// NewService returns a Service without assignments.
+func NewService(m Devices) *Service {
+	return &Service{m: m, assignments: make(map[string]*assignment), running: make(map[string]bool)}
+}
+
+// Assign creates or replaces an assignment after checking that its group parses and its profile
+// exists and sets parameters. Devices are reconciled on the next round, or by Reconcile.
+func (s *Service) Assign(ctx context.Context, a Assignment) (Assignment, error) {
+	if a.Name == "" || strings.ContainsAny(a.Name, "/ ") {
+		return Assignment{}, fmt.Errorf("assignment name %q: %w", a.Name, dm.ErrInvalidParameter)
+	}
+	if a.Profile == "" {
+		return Assignment{}, fmt.Errorf("profile required: %w", dm.ErrInvalidParameter)
+	}
+	if strings.TrimSpace(a.Group) != "" {
+		if _, err := runtime.ParseDeviceQuery(a.Group); err != nil {
+			return Assignment{}, err
+		}
+	}
+	p, err := s.m.SettingsProfile(ctx, a.Profile)
+	if err != nil {
+		return Assignment{}, fmt.Errorf("profile %s: %w", a.Profile, err)
+	}
+	if len(p.Parameters()) == 0 {
+		return Assignment{}, fmt.Errorf("profile %s sets no device parameters: %w", a.Profile, dm.ErrInvalidParameter)
+	}
+	a.Partners, _ = dm.PartnersFromContext(ctx)
+	a.CreatedAt = time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.assignments[a.Name]; ok && !s.visible(ctx, old) {
+		return Assignment{}, fmt.Errorf("assignment %s: %w", a.Name, dm.ErrConflict)
+	}
+	s.assignments[a.Name] = &assignment{Assignment: a, devices: make(map[dm.DeviceID]*DeviceStatus)}
+	return a, nil
+}
+
+// Unassign removes an assignment; devices keep the values already written.
+func (s *Service) Unassign(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.assignments[name]
+	if !ok || !s.visible(ctx, a) {
+		return ErrAssignmentNotFound
+	}
+	delete(s.assignments, name)
+	return nil
+}
+
+// List returns the assignments visible to the caller, ordered by name.
+func (s *Service) List(ctx context.Context) []Assignment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Assignment, 0, len(s.assignments))
+	for _, a := range s.assignments {
+		if s.visible(ctx, a) {
+			out = append(out, a.Assignment)
+		}
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Name < out[k].Name })
+	return out
+}
+
+// Status returns an assignment with the status of every device it has reconciled, by device ID.
+func (s *Service) Status(ctx context.Context, name string) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.assignments[name]
+	if !ok || !s.visible(ctx, a) {
+		return Status{}, ErrAssignmentNotFound
+	}
+	st := Status{Assignment: a.Assignment, Reconciled: a.reconciled, LastError: a.lastErr, Counts: make(map[string]int), Devices: make([]DeviceStatus, 0, len(a.devices))}
+	for _, d := range a.devices {
+		st.Devices = append(st.Devices, *d)
+		st.Counts[d.State]++
+	}
+	sort.Slice(st.Devices, func(i, k int) bool { return st.Devices[i].Device < st.Devices[k].Device })
+	return st, nil
+}
+
+// visible reports whether the caller may see a: unscoped callers see every assignment, scoped
+// ones those made within a scope they share.
+func (s *Service) visible(ctx context.Context, a *assignment) bool {
+	scope, scoped := dm.PartnersFromContext(ctx)
+	return !scoped || (a.Partners != nil && dm.PartnerAllowed(scope, a.Partners))
+}
+
+// Run reconciles every assignment each interval until ctx ends.
+func (s *Service) Run(ctx context.Context, interval time.Duration, report func(error)) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		for _, a := range s.List(ctx) {
+			if _, err := s.Reconcile(ctx, a.Name); err != nil && report != nil && ctx.Err() == nil {
+				report(fmt.Errorf("settings %s: %w", a.Name, err))
+			}
+		}
+	}
+}
+
+// Reconcile brings the assignment's group in line with its profile now: the profile is fetched
+// again, parameters that differ are reported as dm.EventDrift events and written back. Devices
+// that left the group are forgotten. A round already in progress for the assignment gets
+// ErrConflict.
+func (s *Service) Reconcile(ctx context.Context, name string) (Status, error) {
+	s.mu.Lock()
+	a, ok := s.assignments[name]
+	if !ok || !s.visible(ctx, a) {
+		s.mu.Unlock()
+		return Status{}, ErrAssignmentNotFound
+	}
+	if s.running[name] {
+		s.mu.Unlock()
+		return Status{}, fmt.Errorf("assignment %s is being reconciled: %w", name, dm.ErrConflict)
+	}
+	s.running[name] = true
+	asg := a.Assignment
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, name)
+		s.mu.Unlock()
+	}()
+
+	if asg.Partners != nil {
+		ctx = dm.WithPartners(ctx, asg.Partners)
+	}
+	err := s.reconcile(ctx, a, asg)
+	s.mu.Lock()
+	a.reconciled, a.lastErr = time.Now().UTC(), ""
+	if err != nil {
+		a.lastErr = err.Error()
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return Status{}, err
+	}
+	return s.Status(ctx, name)
+}
+
+func (s *Service) reconcile(ctx context.Context, a *assignment, asg Assignment) error {
+	p, err := s.m.SettingsProfile(ctx, asg.Profile)
+	if err != nil {
+		return fmt.Errorf("profile %s: %w", asg.Profile, err)
+	}
+	params := p.Parameters()
+	if len(params) == 0 {
+		return fmt.Errorf("profile %s sets no device parameters: %w", asg.Profile, dm.ErrInvalidParameter)
+	}
+	group, err := s.m.QueryDevices(ctx, asg.Group)
+	if err != nil {
+		return err
+	}
+	ids := make([]dm.DeviceID, len(group))
+	s.mu.Lock()
+	members := make(map[dm.DeviceID]bool, len(group))
+	for i, d := range group {
+		ids[i], members[d.ID] = d.ID, true
+		if a.devices[d.ID] == nil {
+			a.devices[d.ID] = &DeviceStatus{Device: d.ID, State: StatePending}
+		}
+	}
+	for id := range a.devices {
+		if !members[id] {
+			delete(a.devices, id)
+		}
+	}
+	s.mu.Unlock()
+	_, err = jobs.Run(ctx, ids, func(ctx context.Context, id dm.DeviceID) error {
+		drifted, updated, err := s.reconcileDevice(ctx, id, asg, params)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		d := a.devices[id]
+		if d == nil {
+			return err // the assignment was replaced meanwhile
+		}
+		d.CheckedAt, d.Drifted, d.Error = time.Now().UTC(), drifted, ""
+		switch {
+		case err != nil:
+			d.State, d.Error = StateFailed, err.Error()
+		case updated:
+			d.State, d.UpdatedAt = StateUpdated, d.CheckedAt
+		default:
+			d.State = StateInSync
+		}
+		return err
+	}, jobs.RunConfig{Concurrency: reconcileConcurrency})
+	return err
+}
+
+// reconcileDevice reads the profile's parameters from the device and writes back the drifted ones.
+func (s *Service) reconcileDevice(ctx context.Context, id dm.DeviceID, asg Assignment, params []dm.SetParameter) (drifted []string, updated bool, err error) {
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i] = p.Name
+	}
+	current, err := s.m.RefreshParameters(ctx, id, asg.Service, names)
+	if err != nil {
+		return nil, false, fmt.Errorf("read: %w", err)
+	}
+	var fix []dm.SetParameter
+	for _, p := range params {
+		v, ok := current[p.Name]
+		if ok && same(p.Value.(string), v.Value) {
+			continue
+		}
+		fix = append(fix, dm.SetParameter{Name: p.Name, Value: p.Value, TypeHint: v.Type})
+		drifted = append(drifted, p.Name)
+		s.m.Emit(dm.Event{Kind: dm.EventDrift, DeviceID: id, OccurredAt: time.Now(), Source: "settings",
+			Payload: events.Drift{Parameter: p.Name, Expected: p.Value, Actual: v.Value, Profile: asg.Name}})
+	}
+	if len(fix) == 0 {
+		return nil, false, nil
+	}
+	if _, err := s.m.SetParameters(ctx, id, asg.Service, fix, dm.SetOptions{}); err != nil {
+		return drifted, false, fmt.Errorf("write: %w", err)
+	}
+	return drifted, true, nil
+}
+
+// ParameterChange is a profile parameter a proposed profile sets differently; From is empty for a
+// parameter the profile did not set before.
+type ParameterChange struct {
+	Name string `json:"name"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+}
+
+// Impact is what a proposed profile would change for one assignment bound to it. The devices of
+// the group are written the changed parameters on their next round unless they already hold
+// them; removed parameters are no longer enforced but keep their values.
+type Impact struct {
+	Assignment string            `json:"assignment"`
+	Profile    string            `json:"profile"`
+	Parameters []ParameterChange `json:"parameters,omitempty"`
+	Removed    []string          `json:"removed,omitempty"`
+	Devices    []dm.DeviceID     `json:"devices"`
+}
+
+// Simulate reports, for every visible assignment bound to the proposed profile's ID, the
+// parameters the profile would change and the devices they would reach, comparing it with the
+// profile xconf holds now. Assignments it would not change are left out; nothing is written.
+func (s *Service) Simulate(ctx context.Context, proposed policy.SettingsProfile) ([]Impact, error) {
+	if proposed.ID == "" {
+		return nil, fmt.Errorf("profile without an ID: %w", dm.ErrInvalidParameter)
+	}
+	var bound []Assignment
+	for _, a := range s.List(ctx) {
+		if a.Profile == proposed.ID {
+			bound = append(bound, a)
+		}
+	}
+	if len(bound) == 0 {
+		return []Impact{}, nil
+	}
+	before := make(map[string]string)
+	cur, err := s.m.SettingsProfile(ctx, proposed.ID)
+	switch {
+	case err == nil:
+		for _, p := range cur.Parameters() {
+			before[p.Name] = p.Value.(string)
+		}
+	case !errors.Is(err, dm.ErrPolicyNotFound):
+		return nil, fmt.Errorf("profile %s: %w", proposed.ID, err)
+	}
+	var changes []ParameterChange
+	for _, p := range proposed.Parameters() {
+		to := p.Value.(string)
+		if from, ok := before[p.Name]; !ok || !same(to, from) {
+			changes = append(changes, ParameterChange{Name: p.Name, From: from, To: to})
+		}
+		delete(before, p.Name)
+	}
+	removed := make([]string, 0, len(before))
+	for name := range before {
+		removed = append(removed, name)
+	}
+	sort.Strings(removed)
+	if len(changes) == 0 && len(removed) == 0 {
+		return []Impact{}, nil
+	}
+	out := make([]Impact, 0, len(bound))
+	for _, a := range bound {
+		gctx := ctx
+		if a.Partners != nil {
+			gctx = dm.WithPartners(ctx, a.Partners)
+		}
+		group, err := s.m.QueryDevices(gctx, a.Group)
+		if err != nil {
+			return nil, fmt.Errorf("assignment %s: %w", a.Name, err)
+		}
+		im := Impact{Assignment: a.Name, Profile: a.Profile, Parameters: changes, Removed: removed, Devices: make([]dm.DeviceID, len(group))}
+		for i, d := range group {
+			im.Devices[i] = d.ID
+		}
+		sort.Slice(im.Devices, func(i, k int) bool { return im.Devices[i] < im.Devices[k] })
+		out = append(out, im)
+	}
+	return out, nil
+}
+
+// same compares a profile value with a reported one as text, booleans in any spelling.
+func same(expected string, actual interface{}) bool {
+	got := fmt.Sprint(actual)
+	if got == expected {
+		return true
+	}
+	a, errA := strconv.ParseBool(got)
+	b, errB := strconv.ParseBool(expected)
+	return errA == nil && errB == nil && a == b
+}
@@ -0,0 +1,162 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/events"
+	"github.com/xmidt-org/talaria/devicemgr/policy"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+type fakeDevices struct {
+	mu     sync.Mutex
+	values map[dm.DeviceID]map[string]interface{}
+	sets   map[dm.DeviceID][]dm.SetParameter
+	events []dm.Event
+}
+
+func (f *fakeDevices) QueryDevices(ctx context.Context, query string) ([]dm.DeviceState, error) {
+	var out []dm.DeviceState
+	for _, d := range []dm.DeviceState{
+		{ID: "mac:0000000000a1", Metadata: map[string]string{dm.MetadataPartnerIDs: "comcast", dm.MetadataModel: "XB7"}},
+		{ID: "mac:0000000000a2", Metadata: map[string]string{dm.MetadataPartnerIDs: "comcast", dm.MetadataModel: "XB7"}},
+		{ID: "mac:0000000000b1", Metadata: map[string]string{dm.MetadataPartnerIDs: "sky", dm.MetadataModel: "XB7"}},
+	} {
+		scope, scoped := dm.PartnersFromContext(ctx)
+		if !scoped || dm.PartnerAllowed(scope, []string{d.Metadata[dm.MetadataPartnerIDs]}) {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeDevices) RefreshParameters(_ context.Context, id dm.DeviceID, _ string, names []string) (map[string]dm.ParameterValue, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.values[id] == nil {
+		return nil, dm.ErrDeviceOffline
+	}
+	out := make(map[string]dm.ParameterValue)
+	for _, n := range names {
+		if v, ok := f.values[id][n]; ok {
+			out[n] = dm.ParameterValue{Name: n, Value: v, Type: "string"}
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeDevices) SetParameters(_ context.Context, id dm.DeviceID, _ string, params []dm.SetParameter, _ dm.SetOptions) (*runtime.SetResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sets[id] = append(f.sets[id], params...)
+	for _, p := range params {
+		f.values[id][p.Name] = p.Value
+	}
+	return &runtime.SetResult{}, nil
+}
+
+func (f *fakeDevices) SettingsProfile(_ context.Context, id string) (*policy.SettingsProfile, error) {
+	if id != "residential" {
+		return nil, dm.ErrPolicyNotFound
+	}
+	return &policy.SettingsProfile{ID: id, Data: map[string]interface{}{
+		"Device.WiFi.SSID.1.SSID":        "home",
+		"Device.WiFi.Radio.1.Enable":     true,
+		policy.SettingsMaintenanceWindow: map[string]interface{}{"start": "02:00"},
+	}}, nil
+}
+
+func (f *fakeDevices) Emit(e dm.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, e)
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	dev := &fakeDevices{
+		values: map[dm.DeviceID]map[string]interface{}{
+			"mac:0000000000a1": {"Device.WiFi.SSID.1.SSID": "home", "Device.WiFi.Radio.1.Enable": "1"},
+			"mac:0000000000a2": {"Device.WiFi.SSID.1.SSID": "guest", "Device.WiFi.Radio.1.Enable": true},
+			"mac:0000000000b1": {"Device.WiFi.SSID.1.SSID": "guest"},
+		},
+		sets: make(map[dm.DeviceID][]dm.SetParameter),
+	}
+	svc := NewService(dev)
+	if _, err := svc.Assign(ctx, Assignment{Name: "wifi", Profile: "missing"}); !errors.Is(err, dm.ErrPolicyNotFound) {
+		t.Fatalf("missing profile: %v", err)
+	}
+	comcast := dm.WithPartners(ctx, []string{"comcast"})
+	if _, err := svc.Assign(comcast, Assignment{Name: "wifi", Profile: "residential", Group: "model:XB7"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Status(dm.WithPartners(ctx, []string{"sky"}), "wifi"); !errors.Is(err, ErrAssignmentNotFound) {
+		t.Fatalf("out-of-scope status: %v", err)
+	}
+
+	st, err := svc.Reconcile(ctx, "wifi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Devices) != 2 || st.Counts[StateInSync] != 1 || st.Counts[StateUpdated] != 1 {
+		t.Fatalf("status %+v", st)
+	}
+	if got := dev.sets["mac:0000000000a2"]; len(got) != 1 || got[0].Name != "Device.WiFi.SSID.1.SSID" || got[0].Value != "home" {
+		t.Fatalf("written %+v", got)
+	}
+	if len(dev.sets["mac:0000000000b1"]) != 0 {
+		t.Fatal("reconciled a device outside the assignment's scope")
+	}
+	if len(dev.events) != 1 || dev.events[0].Kind != dm.EventDrift {
+		t.Fatalf("events %+v", dev.events)
+	}
+	if d := dev.events[0].Payload.(events.Drift); d.Actual != "guest" || d.Expected != "home" || d.Profile != "wifi" {
+		t.Fatalf("drift %+v", d)
+	}
+
+	// the second round finds nothing to fix
+	if st, err = svc.Reconcile(ctx, "wifi"); err != nil || st.Counts[StateInSync] != 2 || len(dev.events) != 1 {
+		t.Fatalf("second round %+v %v", st, err)
+	}
+	if err := svc.Unassign(comcast, "wifi"); err != nil || len(svc.List(ctx)) != 0 {
+		t.Fatalf("unassign: %v", err)
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(&fakeDevices{})
+	if _, err := svc.Assign(dm.WithPartners(ctx, []string{"comcast"}), Assignment{Name: "wifi", Profile: "residential"}); err != nil {
+		t.Fatal(err)
+	}
+	proposed := policy.SettingsProfile{ID: "residential", Data: map[string]interface{}{
+		"Device.WiFi.SSID.1.SSID":    "home-5g",
+		"Device.WiFi.Radio.1.Enable": "true",
+	}}
+	got, err := svc.Simulate(ctx, proposed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || len(got[0].Parameters) != 1 || len(got[0].Removed) != 0 {
+		t.Fatalf("impacts %+v", got)
+	}
+	if p := got[0].Parameters[0]; p.Name != "Device.WiFi.SSID.1.SSID" || p.From != "home" || p.To != "home-5g" {
+		t.Fatalf("change %+v", p)
+	}
+	if d := got[0].Devices; len(d) != 2 || d[0] != "mac:0000000000a1" {
+		t.Fatalf("devices %v, want the assignment's scope only", d)
+	}
+
+	// a profile no assignment uses, or one left as is, changes nothing
+	for _, p := range []policy.SettingsProfile{{ID: "business", Data: proposed.Data}, {ID: "residential", Data: map[string]interface{}{
+		"Device.WiFi.SSID.1.SSID": "home", "Device.WiFi.Radio.1.Enable": "1",
+	}}} {
+		if got, err := svc.Simulate(ctx, p); err != nil || len(got) != 0 {
+			t.Fatalf("%s: %+v %v", p.ID, got, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package devicemgr
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// DefaultVnodeCount is the virtual nodes per instance of the XMiDT service accessor
+// (webpa-common's service.DefaultVnodeCount), which Talaria, petasos and scytale place devices
+// with.
+const DefaultVnodeCount = 211
+
+// ShardHasher places device IDs on Talaria instances the way the deployment's service discovery
+// does, so placement can be predicted without asking Talaria (Options.Sharding).
+type ShardHasher interface {
+	// Ring returns the placement for instances, the Talaria instances exactly as service
+	// discovery registers them (usually their base URLs).
+	Ring(instances []string) ShardRing
+}
+
+// ShardRing is a ShardHasher's placement over one set of instances.
+type ShardRing interface {
+	// Instance returns the instance id is placed on, false when the ring has no instances.
+	Instance(id DeviceID) (string, bool)
+}
+
+// ConsistentHasher is the XMiDT consistent hash: every instance gets Vnodes points on a CRC-32
+// (IEEE) ring, at the checksums of the vnode index followed by the instance, and an ID belongs to
+// the instance owning the first point at or after the checksum of its canonical form.
+type ConsistentHasher struct {
+	Vnodes int // DefaultVnodeCount when zero
+}
+
+var _ ShardHasher = ConsistentHasher{}
+
+func (h ConsistentHasher) Ring(instances []string) ShardRing {
+	vnodes := h.Vnodes
+	if vnodes <= 0 {
+		vnodes = DefaultVnodeCount
+	}
+	r := &consistentRing{owners: make(map[uint32]string, len(instances)*vnodes)}
+	for _, instance := range instances {
+		for i := 0; i < vnodes; i++ {
+			sum := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + instance))
+			if _, taken := r.owners[sum]; taken {
+				continue // the first instance to claim a point keeps it
+			}
+			r.owners[sum] = instance
+			r.points = append(r.points, sum)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+type consistentRing struct {
+	points []uint32
+	owners map[uint32]string
+}
+
+func (r *consistentRing) Instance(id DeviceID) (string, bool) {
+	if len(r.points) == 0 {
+		return "", false
+	}
+	sum := crc32.ChecksumIEEE([]byte(id.Canonical()))
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= sum })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]], true
+}
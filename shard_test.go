@@ -0,0 +1,51 @@
+package devicemgr
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConsistentHasher(t *testing.T) {
+	instances := []string{"http://talaria-0.example.net:6200", "http://talaria-1.example.net:6200", "http://talaria-2.example.net:6200"}
+	ring := ConsistentHasher{}.Ring(instances)
+	again := ConsistentHasher{}.Ring(instances)
+	counts := map[string]int{}
+	placed := map[DeviceID]string{}
+	for i := 0; i < 3000; i++ {
+		id := DeviceID(fmt.Sprintf("mac:%012x", i*7919))
+		instance, ok := ring.Instance(id)
+		if !ok {
+			t.Fatalf("%s not placed", id)
+		}
+		if other, _ := again.Instance(id); other != instance {
+			t.Fatalf("%s placed on %s and %s", id, instance, other)
+		}
+		counts[instance]++
+		placed[id] = instance
+	}
+	for _, instance := range instances {
+		if counts[instance] < 600 {
+			t.Fatalf("uneven placement %v", counts)
+		}
+	}
+
+	// a new instance only takes devices; the rest stay put
+	grown := ConsistentHasher{}.Ring(append(instances, "http://talaria-3.example.net:6200"))
+	moved := 0
+	for id, instance := range placed {
+		now, _ := grown.Instance(id)
+		switch {
+		case now == "http://talaria-3.example.net:6200":
+			moved++
+		case now != instance:
+			t.Fatalf("%s moved from %s to %s", id, instance, now)
+		}
+	}
+	if moved == 0 || moved > 1200 {
+		t.Fatalf("%d of %d devices moved", moved, len(placed))
+	}
+
+	if _, ok := (ConsistentHasher{}).Ring(nil).Instance("mac:112233445566"); ok {
+		t.Fatal("empty ring placed a device")
+	}
+}
@@ -0,0 +1,120 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+// DifferenceKind classifies a Compare entry.
+type DifferenceKind string
+
+const (
+	OnlyA     DifferenceKind = "only-a" // reported by the first side only
+	OnlyB     DifferenceKind = "only-b"
+	Different DifferenceKind = "different"
+)
+
+// Difference is one parameter that is not the same on both sides of a comparison.
+type Difference struct {
+	Name string         `json:"name"`
+	Kind DifferenceKind `json:"kind"`
+	A    interface{}    `json:"a,omitempty"`
+	B    interface{}    `json:"b,omitempty"`
+}
+
+// Side is one party to a comparison: a device's live values, or a stored snapshot of one.
+type Side struct {
+	Device   dm.DeviceID `json:"device"`
+	Snapshot string      `json:"snapshot,omitempty"`
+	TakenAt  time.Time   `json:"takenAt"`
+}
+
+// Comparison is the structured diff of the same parameters on two sides.
+type Comparison struct {
+	A           Side         `json:"a"`
+	B           Side         `json:"b"`
+	Paths       []string     `json:"paths"`
+	Same        int          `json:"same"` // parameters equal on both sides
+	Differences []Difference `json:"differences"`
+}
+
+// Compare lists the parameters that differ between a and b, ordered by name, and counts those that
+// are equal. Names in ignore (or under partial paths in it, such as "Device.DeviceInfo.") are
+// skipped: serial numbers and MAC addresses always differ between devices.
+func Compare(a, b map[string]Value, ignore []string) (diffs []Difference, same int) {
+	diffs = []Difference{}
+	for name, va := range a {
+		if len(ignore) > 0 && selected(name, ignore) {
+			continue
+		}
+		vb, ok := b[name]
+		switch {
+		case !ok:
+			diffs = append(diffs, Difference{Name: name, Kind: OnlyA, A: va.Value})
+		case !reflect.DeepEqual(va.Value, vb.Value):
+			diffs = append(diffs, Difference{Name: name, Kind: Different, A: va.Value, B: vb.Value})
+		default:
+			same++
+		}
+	}
+	for name, vb := range b {
+		if _, ok := a[name]; !ok && !(len(ignore) > 0 && selected(name, ignore)) {
+			diffs = append(diffs, Difference{Name: name, Kind: OnlyB, B: vb.Value})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Name < diffs[j].Name })
+	return diffs, same
+}
+
+// CompareDevices reads paths fresh from devices a and b and compares them.
+func (s *Service) CompareDevices(ctx context.Context, a, b dm.DeviceID, service string, paths, ignore []string) (Comparison, error) {
+	if len(paths) == 0 {
+		return Comparison{}, fmt.Errorf("paths required: %w", dm.ErrInvalidParameter)
+	}
+	if a == b {
+		return Comparison{}, fmt.Errorf("compare %s with another device: %w", a, dm.ErrInvalidParameter)
+	}
+	type read struct {
+		values map[string]Value
+		at     time.Time
+		err    error
+	}
+	ch := make(chan read, 1)
+	go func() {
+		values, err := s.read(ctx, b, service, paths)
+		ch <- read{values, time.Now().UTC(), err}
+	}()
+	va, err := s.read(ctx, a, service, paths)
+	atA := time.Now().UTC()
+	rb := <-ch
+	if err != nil {
+		return Comparison{}, fmt.Errorf("%s: %w", a, err)
+	}
+	if rb.err != nil {
+		return Comparison{}, fmt.Errorf("%s: %w", b, rb.err)
+	}
+	c := Comparison{A: Side{Device: a, TakenAt: atA}, B: Side{Device: b, TakenAt: rb.at}, Paths: paths}
+	c.Differences, c.Same = Compare(va, rb.values, ignore)
+	return c, nil
+}
+
+// CompareSnapshot compares the live values of device with snapshot id of owner (which may be
+// device itself), over the paths the snapshot captured.
+func (s *Service) CompareSnapshot(ctx context.Context, device, owner dm.DeviceID, id string, ignore []string) (Comparison, error) {
+	snap, err := s.Get(ctx, owner, id)
+	if err != nil {
+		return Comparison{}, err
+	}
+	live, err := s.read(ctx, device, snap.Service, snap.Paths)
+	if err != nil {
+		return Comparison{}, err
+	}
+	c := Comparison{A: Side{Device: device, TakenAt: time.Now().UTC()}, B: Side{Device: owner, Snapshot: snap.ID, TakenAt: snap.TakenAt}, Paths: snap.Paths}
+	c.Differences, c.Same = Compare(live, snap.Parameters, ignore)
+	return c, nil
+}
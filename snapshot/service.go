@@ -0,0 +1,154 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+// Current names the live device state in Diff.
+const Current = "current"
+
+// Devices is the subset of manager.Manager used by Service (an interface so storage backends such as
+// redisstore can depend on this package without an import cycle).
+type Devices interface {
+	Device(ctx context.Context, id dm.DeviceID) (dm.DeviceState, error)
+	RefreshParameters(ctx context.Context, id dm.DeviceID, service string, names []string) (map[string]dm.ParameterValue, error)
+	SetParameters(ctx context.Context, id dm.DeviceID, service string, params []dm.SetParameter, opts dm.SetOptions) (*runtime.SetResult, error)
+}
+
+// Service captures, compares and restores parameter snapshots through a Manager.
+type Service struct {
+	m     Devices
+	store Store
+}
+
+// NewService uses store for persistence; nil selects a MemoryStore.
+func NewService(m Devices, store Store) *Service {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Service{m: m, store: store}
+}
+
+// Capture reads paths (full names or partial paths ending in ".") fresh from the device and saves the result.
+func (s *Service) Capture(ctx context.Context, device dm.DeviceID, name, service string, paths []string) (Snapshot, error) {
+	if len(paths) == 0 {
+		return Snapshot{}, fmt.Errorf("paths required: %w", dm.ErrInvalidParameter)
+	}
+	params, err := s.read(ctx, device, service, paths)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snap := Snapshot{ID: uuid.NewString(), Name: name, Device: device, Service: service, Paths: paths, Parameters: params, Count: len(params), TakenAt: time.Now().UTC()}
+	if err := s.store.Save(ctx, snap); err != nil {
+		return Snapshot{}, fmt.Errorf("save snapshot: %w", err)
+	}
+	return snap, nil
+}
+
+func (s *Service) read(ctx context.Context, device dm.DeviceID, service string, paths []string) (map[string]Value, error) {
+	values, err := s.m.RefreshParameters(ctx, device, service, paths)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]Value, len(values))
+	for n, v := range values {
+		out[n] = Value{Value: v.Value, Type: v.Type}
+	}
+	return out, nil
+}
+
+// Get returns a stored snapshot.
+func (s *Service) Get(ctx context.Context, device dm.DeviceID, id string) (Snapshot, error) {
+	if err := s.authorize(ctx, device); err != nil {
+		return Snapshot{}, err
+	}
+	return s.store.Get(ctx, device, id)
+}
+
+// List returns a device's snapshots, newest first, without values.
+func (s *Service) List(ctx context.Context, device dm.DeviceID) ([]Snapshot, error) {
+	if err := s.authorize(ctx, device); err != nil {
+		return nil, err
+	}
+	return s.store.List(ctx, device)
+}
+
+// Delete removes a stored snapshot.
+func (s *Service) Delete(ctx context.Context, device dm.DeviceID, id string) error {
+	if err := s.authorize(ctx, device); err != nil {
+		return err
+	}
+	return s.store.Delete(ctx, device, id)
+}
+
+// Diff compares snapshot "from" with snapshot "to"; to == Current compares against the live values of
+// the paths captured in "from".
+func (s *Service) Diff(ctx context.Context, device dm.DeviceID, from, to string) ([]Change, error) {
+	a, err := s.Get(ctx, device, from)
+	if err != nil {
+		return nil, err
+	}
+	var b map[string]Value
+	if to == Current {
+		if b, err = s.read(ctx, device, a.Service, a.Paths); err != nil {
+			return nil, err
+		}
+	} else {
+		snap, err := s.Get(ctx, device, to)
+		if err != nil {
+			return nil, err
+		}
+		b = snap.Parameters
+	}
+	return Diff(a.Parameters, b), nil
+}
+
+// Restore writes captured values back to the device. names selects parameters (or partial paths) to
+// restore; empty restores everything in the snapshot.
+func (s *Service) Restore(ctx context.Context, device dm.DeviceID, id string, names []string) (*runtime.SetResult, error) {
+	snap, err := s.Get(ctx, device, id)
+	if err != nil {
+		return nil, err
+	}
+	var params []dm.SetParameter
+	for name, v := range snap.Parameters {
+		if !selected(name, names) {
+			continue
+		}
+		params = append(params, dm.SetParameter{Name: name, Value: v.Value, TypeHint: v.Type})
+	}
+	if len(params) == 0 {
+		return nil, fmt.Errorf("no snapshot parameters match %v: %w", names, dm.ErrInvalidParameter)
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	return s.m.SetParameters(ctx, device, snap.Service, params, dm.SetOptions{})
+}
+
+func selected(name string, names []string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for _, n := range names {
+		if n == name || (strings.HasSuffix(n, ".") && strings.HasPrefix(name, n)) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize hides snapshots of devices outside the caller's partner scope.
+func (s *Service) authorize(ctx context.Context, device dm.DeviceID) error {
+	if _, scoped := dm.PartnersFromContext(ctx); scoped {
+		_, err := s.m.Device(ctx, device)
+		return err
+	}
+	return nil
+}
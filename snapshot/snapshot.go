@@ -0,0 +1,138 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Value is one captured parameter.
+type Value struct {
+	Value interface{} `json:"value"`
+	Type  string      `json:"type,omitempty"`
+}
+
+// Snapshot is a named capture of a device's parameter subtree(s).
+type Snapshot struct {
+	ID         string           `json:"id"`
+	Name       string           `json:"name,omitempty"`
+	Device     dm.DeviceID      `json:"device"`
+	Service    string           `json:"service,omitempty"`
+	Paths      []string         `json:"paths"` // requested names or partial paths ("Device.WiFi.")
+	Parameters map[string]Value `json:"parameters,omitempty"`
+	Count      int              `json:"count"`
+	TakenAt    time.Time        `json:"takenAt"`
+}
+
+// ChangeKind classifies a Diff entry.
+type ChangeKind string
+
+const (
+	Added   ChangeKind = "added"
+	Removed ChangeKind = "removed"
+	Changed ChangeKind = "changed"
+)
+
+// Change is one differing parameter between two captures.
+type Change struct {
+	Name string      `json:"name"`
+	Kind ChangeKind  `json:"kind"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// Diff lists parameters that differ from "from" to "to", ordered by name.
+func Diff(from, to map[string]Value) []Change {
+	var out []Change
+	for name, a := range from {
+		b, ok := to[name]
+		switch {
+		case !ok:
+			out = append(out, Change{Name: name, Kind: Removed, From: a.Value})
+		case !reflect.DeepEqual(a.Value, b.Value):
+			out = append(out, Change{Name: name, Kind: Changed, From: a.Value, To: b.Value})
+		}
+	}
+	for name, b := range to {
+		if _, ok := from[name]; !ok {
+			out = append(out, Change{Name: name, Kind: Added, To: b.Value})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Store persists snapshots per device.
+type Store interface {
+	Save(ctx context.Context, s Snapshot) error
+	Get(ctx context.Context, device dm.DeviceID, id string) (Snapshot, error)
+	// List returns a device's snapshots newest first, without parameter values.
+	List(ctx context.Context, device dm.DeviceID) ([]Snapshot, error)
+	Delete(ctx context.Context, device dm.DeviceID, id string) error
+}
+
+// MemoryStore is a process-local Store.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	snap map[dm.DeviceID]map[string]Snapshot
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{snap: make(map[dm.DeviceID]map[string]Snapshot)}
+}
+
+func (m *MemoryStore) Save(_ context.Context, s Snapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.snap[s.Device] == nil {
+		m.snap[s.Device] = make(map[string]Snapshot)
+	}
+	m.snap[s.Device][s.ID] = s
+	return nil
+}
+
+func (m *MemoryStore) Get(_ context.Context, device dm.DeviceID, id string) (Snapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.snap[device][id]
+	if !ok {
+		return Snapshot{}, ErrSnapshotNotFound
+	}
+	return s, nil
+}
+
+func (m *MemoryStore) List(_ context.Context, device dm.DeviceID) ([]Snapshot, error) {
+	m.mu.RLock()
+	out := make([]Snapshot, 0, len(m.snap[device]))
+	for _, s := range m.snap[device] {
+		s.Parameters = nil
+		out = append(out, s)
+	}
+	m.mu.RUnlock()
+	SortNewestFirst(out)
+	return out, nil
+}
+
+func (m *MemoryStore) Delete(_ context.Context, device dm.DeviceID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.snap[device][id]; !ok {
+		return ErrSnapshotNotFound
+	}
+	delete(m.snap[device], id)
+	return nil
+}
+
+// SortNewestFirst orders snapshots by TakenAt descending; Store implementations use it for List.
+func SortNewestFirst(s []Snapshot) {
+	sort.Slice(s, func(i, j int) bool { return s[i].TakenAt.After(s[j].TakenAt) })
+}
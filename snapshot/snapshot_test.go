@@ -0,0 +1,159 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/runtime"
+)
+
+type fakeDevices struct {
+	values map[string]dm.ParameterValue
+	set    []dm.SetParameter
+}
+
+func (f *fakeDevices) Device(_ context.Context, id dm.DeviceID) (dm.DeviceState, error) {
+	if id != "mac:aa" {
+		return dm.DeviceState{}, dm.ErrDeviceNotFound
+	}
+	return dm.DeviceState{ID: id}, nil
+}
+
+func (f *fakeDevices) RefreshParameters(context.Context, dm.DeviceID, string, []string) (map[string]dm.ParameterValue, error) {
+	out := make(map[string]dm.ParameterValue, len(f.values))
+	for k, v := range f.values {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (f *fakeDevices) SetParameters(_ context.Context, _ dm.DeviceID, _ string, params []dm.SetParameter, _ dm.SetOptions) (*runtime.SetResult, error) {
+	f.set = params
+	res := &runtime.SetResult{}
+	for _, p := range params {
+		res.Applied = append(res.Applied, p.Name)
+	}
+	return res, nil
+}
+
+func TestCaptureDiffRestore(t *testing.T) {
+	ctx := context.Background()
+	dev := &fakeDevices{values: map[string]dm.ParameterValue{
+		"Device.WiFi.SSID.1.SSID":   {Value: "home", Type: "0"},
+		"Device.WiFi.SSID.1.Enable": {Value: true, Type: "3"},
+		"Device.WiFi.Radio.1.Chan":  {Value: float64(6)},
+	}}
+	svc := NewService(dev, nil)
+	snap, err := svc.Capture(ctx, "mac:aa", "before", "", []string{"Device.WiFi."})
+	if err != nil || snap.Count != 3 {
+		t.Fatalf("Capture: %+v %v", snap, err)
+	}
+
+	dev.values["Device.WiFi.SSID.1.SSID"] = dm.ParameterValue{Value: "guest"}
+	delete(dev.values, "Device.WiFi.Radio.1.Chan")
+	dev.values["Device.WiFi.SSID.2.SSID"] = dm.ParameterValue{Value: "new"}
+	changes, err := svc.Diff(ctx, "mac:aa", snap.ID, Current)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	want := []Change{
+		{Name: "Device.WiFi.Radio.1.Chan", Kind: Removed, From: float64(6)},
+		{Name: "Device.WiFi.SSID.1.SSID", Kind: Changed, From: "home", To: "guest"},
+		{Name: "Device.WiFi.SSID.2.SSID", Kind: Added, To: "new"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %+v", changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("change %d = %+v, want %+v", i, changes[i], want[i])
+		}
+	}
+
+	res, err := svc.Restore(ctx, "mac:aa", snap.ID, []string{"Device.WiFi.SSID."})
+	if err != nil || len(res.Applied) != 2 {
+		t.Fatalf("Restore: %+v %v", res, err)
+	}
+	if dev.set[0].Name != "Device.WiFi.SSID.1.Enable" || dev.set[1].TypeHint != "0" || dev.set[1].Value != "home" {
+		t.Fatalf("restored params = %+v", dev.set)
+	}
+	if _, err := svc.Restore(ctx, "mac:aa", snap.ID, []string{"Device.X"}); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("unmatched restore should be invalid, got %v", err)
+	}
+
+	list, _ := svc.List(ctx, "mac:aa")
+	if len(list) != 1 || list[0].Parameters != nil {
+		t.Fatalf("List should return metadata only: %+v", list)
+	}
+	if _, err := svc.Get(dm.WithPartners(ctx, []string{"sky"}), "mac:bb", snap.ID); !errors.Is(err, dm.ErrDeviceNotFound) {
+		t.Fatalf("scoped caller should not see other devices, got %v", err)
+	}
+	if err := svc.Delete(ctx, "mac:aa", snap.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Get(ctx, "mac:aa", snap.ID); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Fatalf("deleted snapshot still present: %v", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	a := map[string]Value{
+		"Device.WiFi.SSID.1.SSID":             {Value: "home"},
+		"Device.WiFi.Radio.1.Chan":            {Value: float64(6)},
+		"Device.DeviceInfo.SerialNumber":      {Value: "A1"},
+		"Device.WiFi.SSID.1.Enable":           {Value: true},
+		"Device.WiFi.AccessPoint.1.Isolation": {Value: false},
+	}
+	b := map[string]Value{
+		"Device.WiFi.SSID.1.SSID":        {Value: "guest"},
+		"Device.WiFi.Radio.1.Chan":       {Value: float64(6)},
+		"Device.DeviceInfo.SerialNumber": {Value: "B2"},
+		"Device.WiFi.SSID.1.Enable":      {Value: true},
+		"Device.WiFi.SSID.2.SSID":        {Value: "new"},
+	}
+	diffs, same := Compare(a, b, []string{"Device.DeviceInfo."})
+	want := []Difference{
+		{Name: "Device.WiFi.AccessPoint.1.Isolation", Kind: OnlyA, A: false},
+		{Name: "Device.WiFi.SSID.1.SSID", Kind: Different, A: "home", B: "guest"},
+		{Name: "Device.WiFi.SSID.2.SSID", Kind: OnlyB, B: "new"},
+	}
+	if same != 2 || len(diffs) != len(want) {
+		t.Fatalf("same=%d diffs=%+v", same, diffs)
+	}
+	for i := range want {
+		if diffs[i] != want[i] {
+			t.Fatalf("difference %d = %+v, want %+v", i, diffs[i], want[i])
+		}
+	}
+}
+
+func TestCompareSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dev := &fakeDevices{values: map[string]dm.ParameterValue{
+		"Device.WiFi.SSID.1.SSID":  {Value: "home"},
+		"Device.WiFi.Radio.1.Chan": {Value: float64(6)},
+	}}
+	svc := NewService(dev, nil)
+	snap, err := svc.Capture(ctx, "mac:aa", "golden", "", []string{"Device.WiFi."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev.values["Device.WiFi.Radio.1.Chan"] = dm.ParameterValue{Value: float64(11)}
+	c, err := svc.CompareSnapshot(ctx, "mac:bb", "mac:aa", snap.ID, nil)
+	if err != nil {
+		t.Fatalf("CompareSnapshot: %v", err)
+	}
+	if c.A.Device != "mac:bb" || c.B.Snapshot != snap.ID || c.Same != 1 || len(c.Differences) != 1 ||
+		c.Differences[0] != (Difference{Name: "Device.WiFi.Radio.1.Chan", Kind: Different, A: float64(11), B: float64(6)}) {
+		t.Fatalf("comparison = %+v", c)
+	}
+	if _, err := svc.CompareDevices(ctx, "mac:aa", "mac:aa", "", []string{"Device.WiFi."}, nil); !errors.Is(err, dm.ErrInvalidParameter) {
+		t.Fatalf("comparing a device with itself should be invalid, got %v", err)
+	}
+	c, err = svc.CompareDevices(ctx, "mac:aa", "mac:bb", "", []string{"Device.WiFi."}, nil)
+	if err != nil || c.Same != 2 || len(c.Differences) != 0 {
+		t.Fatalf("CompareDevices: %+v %v", c, err)
+	}
+}
@@ -0,0 +1,82 @@
+package devicemgr
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// SubscriptionKind names what a Subscription registers.
+type SubscriptionKind string
+
+const (
+	SubscriptionWebhook    SubscriptionKind = "webhook"     // an events.Webhook
+	SubscriptionTopic      SubscriptionKind = "topic"       // an events.TopicBinding
+	SubscriptionParamWatch SubscriptionKind = "param-watch" // a manager.WatchRegistration
+	SubscriptionQuarantine SubscriptionKind = "quarantine"  // a Quarantine
+)
+
+// Subscription is a registration kept in a SubscriptionStore so it is restored when the server
+// restarts: its kind, ID and expiry, and the registering component's own description of it.
+type Subscription struct {
+	Kind  SubscriptionKind `json:"kind"`
+	ID    string           `json:"id"`
+	Until time.Time        `json:"until,omitempty"` // zero never expires
+	Spec  json.RawMessage  `json:"spec"`
+}
+
+// Expired reports whether s expired before now.
+func (s Subscription) Expired(now time.Time) bool { return !s.Until.IsZero() && now.After(s.Until) }
+
+// SubscriptionStore persists the registrations of webhooks, event topic bindings, parameter
+// watches and quarantines. Components write through it as registrations change and read it back
+// on startup, dropping those that expired meanwhile.
+type SubscriptionStore interface {
+	Put(ctx context.Context, s Subscription) error
+	// Delete removes a subscription; deleting an unknown one is not an error.
+	Delete(ctx context.Context, kind SubscriptionKind, id string) error
+	// List returns the stored subscriptions of kind in no particular order.
+	List(ctx context.Context, kind SubscriptionKind) ([]Subscription, error)
+}
+
+// MemorySubscriptionStore is a process-local SubscriptionStore, so registrations do not survive
+// a restart.
+type MemorySubscriptionStore struct {
+	mu   sync.RWMutex
+	subs map[SubscriptionKind]map[string]Subscription
+}
+
+var _ SubscriptionStore = (*MemorySubscriptionStore)(nil)
+
+func NewMemorySubscriptionStore() *MemorySubscriptionStore {
+	return &MemorySubscriptionStore{subs: make(map[SubscriptionKind]map[string]Subscription)}
+}
+
+func (m *MemorySubscriptionStore) Put(_ context.Context, s Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.subs[s.Kind] == nil {
+		m.subs[s.Kind] = make(map[string]Subscription)
+	}
+	s.Spec = append(json.RawMessage(nil), s.Spec...)
+	m.subs[s.Kind][s.ID] = s
+	return nil
+}
+
+func (m *MemorySubscriptionStore) Delete(_ context.Context, kind SubscriptionKind, id string) error {
+	m.mu.Lock()
+	delete(m.subs[kind], id)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemorySubscriptionStore) List(_ context.Context, kind SubscriptionKind) ([]Subscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]Subscription, 0, len(m.subs[kind]))
+	for _, s := range m.subs[kind] {
+		out = append(out, s)
+	}
+	return out, nil
+}
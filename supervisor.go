@@ -0,0 +1,343 @@
+package devicemgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RestartMode says when a Supervisor restarts a component that exits on its own.
+type RestartMode int
+
+const (
+	RestartNever     RestartMode = iota // an exit is final; one with an error fails the supervisor
+	RestartOnFailure                    // restart after an exit with an error
+	RestartAlways                       // restart after any exit
+)
+
+// Restart backoff defaults, used when a RestartPolicy leaves them zero.
+const (
+	DefaultRestartBackoff    = time.Second
+	DefaultMaxRestartBackoff = time.Minute
+)
+
+// restartResetAfter is how long a component must run for its next exit to count as a first crash
+// again rather than another consecutive one.
+const restartResetAfter = time.Minute
+
+// RestartPolicy is how a Supervisor treats a component that exits on its own.
+type RestartPolicy struct {
+	Mode        RestartMode
+	MaxRestarts int           // consecutive restarts before giving up and failing; zero is unlimited
+	Backoff     time.Duration // delay before the first restart, doubled for each consecutive one
+	MaxBackoff  time.Duration // caps the doubled delay
+}
+
+func (p RestartPolicy) delay(n int) time.Duration {
+	r := RetryPolicy{Backoff: p.Backoff, MaxBackoff: p.MaxBackoff}
+	if r.Backoff <= 0 {
+		r.Backoff = DefaultRestartBackoff
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = DefaultMaxRestartBackoff
+	}
+	return r.Delay(n)
+}
+
+// Component is a Runner registered with a Supervisor.
+type Component struct {
+	Name      string
+	Runner    Runner
+	DependsOn []string // components started before this one and stopped after it
+	Restart   RestartPolicy
+}
+
+// ComponentState is where a supervised component is in its lifecycle.
+type ComponentState string
+
+const (
+	ComponentPending    ComponentState = "pending"
+	ComponentRunning    ComponentState = "running"
+	ComponentRestarting ComponentState = "restarting" // exited; waiting out the backoff
+	ComponentExited     ComponentState = "exited"     // exited cleanly and not restarted
+	ComponentFailed     ComponentState = "failed"     // exited with an error and not restarted
+	ComponentStopped    ComponentState = "stopped"
+)
+
+// ComponentStatus reports a supervised component.
+type ComponentStatus struct {
+	Name      string         `json:"name"`
+	State     ComponentState `json:"state"`
+	Restarts  int            `json:"restarts"`        // over the supervisor's lifetime
+	Error     string         `json:"error,omitempty"` // of the latest exit or restart attempt
+	StartedAt time.Time      `json:"startedAt,omitempty"`
+}
+
+type supervised struct {
+	Component
+	status      ComponentStatus
+	consecutive int // restarts since the component last ran for restartResetAfter
+}
+
+// Supervisor starts components in dependency order, restarts the ones that exit according to
+// their RestartPolicy, and stops them in reverse order. It is itself a Runner and an Exiter: its
+// Exited channel receives the first failure it cannot recover from, so whoever runs it can shut
+// down instead of limping along without the component.
+type Supervisor struct {
+	report func(component string, err error)
+
+	mu      sync.Mutex
+	comps   []*supervised
+	byName  map[string]*supervised
+	order   []*supervised // start order, set by Start
+	ctx     context.Context
+	cancel  context.CancelFunc
+	exited  chan error
+	pending sync.WaitGroup // restarts in progress
+}
+
+// NewSupervisor creates a Supervisor that passes every component crash and failed restart to
+// report, which may be nil.
+func NewSupervisor(report func(component string, err error)) *Supervisor {
+	return &Supervisor{report: report, byName: make(map[string]*supervised), exited: make(chan error, 1)}
+}
+
+// Add registers c. Names must be unique, and components are added before Start.
+func (s *Supervisor) Add(c Component) error {
+	if c.Name == "" || c.Runner == nil {
+		return fmt.Errorf("component needs a name and a runner: %w", ErrInvalidParameter)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx != nil {
+		return fmt.Errorf("component %s added after start: %w", c.Name, ErrConflict)
+	}
+	if _, dup := s.byName[c.Name]; dup {
+		return fmt.Errorf("component %s added twice: %w", c.Name, ErrConflict)
+	}
+	sc := &supervised{Component: c, status: ComponentStatus{Name: c.Name, State: ComponentPending}}
+	s.comps = append(s.comps, sc)
+	s.byName[c.Name] = sc
+	return nil
+}
+
+// Start starts every component, each after the ones it depends on; components with no order
+// between them start in the order they were added. If one fails to start, those already started
+// are stopped and Start returns the failure together with any errors stopping them.
+func (s *Supervisor) Start(ctx context.Context) error {
+	s.mu.Lock()
+	if s.ctx != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("supervisor already started: %w", ErrConflict)
+	}
+	order, err := s.sort()
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.order = order
+	s.ctx, s.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	s.mu.Unlock()
+
+	for i, c := range order {
+		if err := c.Runner.Start(ctx); err != nil {
+			s.mu.Lock()
+			c.status.State, c.status.Error = ComponentFailed, err.Error()
+			s.mu.Unlock()
+			err = fmt.Errorf("start %s: %w", c.Name, err)
+			s.cancel()
+			return errors.Join(err, s.stop(context.WithoutCancel(ctx), order[:i]))
+		}
+		s.running(c)
+	}
+	return nil
+}
+
+// Stop cancels pending restarts and stops the components in reverse start order, giving all of
+// them until ctx is done. It returns every component's stop error, joined.
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel, order := s.cancel, s.order
+	s.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	s.pending.Wait()
+	return s.stop(ctx, order)
+}
+
+func (s *Supervisor) stop(ctx context.Context, order []*supervised) error {
+	var errs []error
+	for i := len(order) - 1; i >= 0; i-- {
+		c := order[i]
+		s.mu.Lock()
+		state := c.status.State
+		s.mu.Unlock()
+		if state == ComponentPending || state == ComponentStopped {
+			continue
+		}
+		err := c.Runner.Stop(ctx)
+		s.mu.Lock()
+		if c.status.State == ComponentRunning {
+			c.status.State = ComponentStopped
+		}
+		s.mu.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("stop %s: %w", c.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Exited receives the first component failure the supervisor gave up on.
+func (s *Supervisor) Exited() <-chan error { return s.exited }
+
+// Status reports every component, in start order once started.
+func (s *Supervisor) Status() []ComponentStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.order
+	if list == nil {
+		list = s.comps
+	}
+	out := make([]ComponentStatus, len(list))
+	for i, c := range list {
+		out[i] = c.status
+	}
+	return out
+}
+
+// sort orders the components so each follows its dependencies; callers hold s.mu.
+func (s *Supervisor) sort() ([]*supervised, error) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	mark := make(map[*supervised]int, len(s.comps))
+	order := make([]*supervised, 0, len(s.comps))
+	var visit func(c *supervised, path []string) error
+	visit = func(c *supervised, path []string) error {
+		switch mark[c] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("component dependency cycle %v: %w", append(path, c.Name), ErrInvalidParameter)
+		}
+		mark[c] = visiting
+		for _, name := range c.DependsOn {
+			dep, ok := s.byName[name]
+			if !ok {
+				return fmt.Errorf("component %s depends on unknown %s: %w", c.Name, name, ErrInvalidParameter)
+			}
+			if err := visit(dep, append(path, c.Name)); err != nil {
+				return err
+			}
+		}
+		mark[c] = done
+		order = append(order, c)
+		return nil
+	}
+	for _, c := range s.comps {
+		if err := visit(c, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// running records that c started and watches it for an exit.
+func (s *Supervisor) running(c *supervised) {
+	s.mu.Lock()
+	c.status.State, c.status.StartedAt = ComponentRunning, time.Now().UTC()
+	ctx := s.ctx
+	s.mu.Unlock()
+	ex, ok := c.Runner.(Exiter)
+	if !ok {
+		return
+	}
+	exited := ex.Exited()
+	go func() {
+		select {
+		case err := <-exited:
+			s.exit(c, err)
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// exit handles c exiting on its own.
+func (s *Supervisor) exit(c *supervised, err error) {
+	s.mu.Lock()
+	if s.ctx.Err() != nil {
+		s.mu.Unlock()
+		return // stopping
+	}
+	if time.Since(c.status.StartedAt) >= restartResetAfter {
+		c.consecutive = 0
+	}
+	p := c.Restart
+	restart := p.Mode == RestartAlways || (p.Mode == RestartOnFailure && err != nil)
+	switch {
+	case restart && p.MaxRestarts > 0 && c.consecutive >= p.MaxRestarts:
+		if err != nil {
+			err = fmt.Errorf("%w (gave up after %d restarts)", err, c.consecutive)
+		}
+		restart = false
+	case restart:
+		c.consecutive++
+		c.status.Restarts++
+		s.pending.Add(1)
+	}
+	switch {
+	case restart:
+		c.status.State = ComponentRestarting
+	case err != nil:
+		c.status.State = ComponentFailed
+	default:
+		c.status.State = ComponentExited
+	}
+	if err != nil {
+		c.status.Error = err.Error()
+	}
+	n, ctx := c.consecutive, s.ctx
+	s.mu.Unlock()
+
+	if err != nil && s.report != nil {
+		s.report(c.Name, err)
+	}
+	if !restart {
+		if err != nil {
+			s.fail(fmt.Errorf("component %s: %w", c.Name, err))
+		}
+		return
+	}
+	go func() {
+		defer s.pending.Done()
+		select {
+		case <-time.After(p.delay(n)):
+		case <-ctx.Done():
+			return
+		}
+		if err := c.Runner.Start(ctx); err != nil {
+			// a failed restart counts as another crash
+			s.mu.Lock()
+			c.status.StartedAt = time.Now().UTC()
+			s.mu.Unlock()
+			s.exit(c, fmt.Errorf("restart: %w", err))
+			return
+		}
+		s.running(c)
+	}()
+}
+
+// fail delivers err on Exited unless a failure already is.
+func (s *Supervisor) fail(err error) {
+	select {
+	case s.exited <- err:
+	default:
+	}
+}
@@ -0,0 +1,190 @@
+package devicemgr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recorder logs component starts and stops in order.
+type recorder struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (r *recorder) add(s string) {
+	r.mu.Lock()
+	r.log = append(r.log, s)
+	r.mu.Unlock()
+}
+
+func (r *recorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.log, " ")
+}
+
+func (r *recorder) runner(name string, startErr error) Runner {
+	return RunnerFuncs{
+		StartFunc: func(context.Context) error { r.add("start:" + name); return startErr },
+		StopFunc:  func(context.Context) error { r.add("stop:" + name); return nil },
+	}
+}
+
+func TestSupervisorOrdersComponents(t *testing.T) {
+	var rec recorder
+	s := NewSupervisor(nil)
+	for _, c := range []Component{
+		{Name: "api", Runner: rec.runner("api", nil), DependsOn: []string{"poller", "manager"}},
+		{Name: "poller", Runner: rec.runner("poller", nil), DependsOn: []string{"manager"}},
+		{Name: "manager", Runner: rec.runner("manager", nil)},
+	} {
+		if err := s.Add(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Add(Component{Name: "manager", Runner: rec.runner("manager", nil)}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("duplicate name: %v", err)
+	}
+	ctx := context.Background()
+	if err := s.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := "start:manager start:poller start:api stop:api stop:poller stop:manager"
+	if got := rec.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for _, st := range s.Status() {
+		if st.State != ComponentStopped {
+			t.Fatalf("%s is %s after Stop", st.Name, st.State)
+		}
+	}
+}
+
+func TestSupervisorStartFailureStopsStarted(t *testing.T) {
+	var rec recorder
+	s := NewSupervisor(nil)
+	s.Add(Component{Name: "a", Runner: rec.runner("a", nil)})
+	s.Add(Component{Name: "b", Runner: rec.runner("b", errors.New("port in use")), DependsOn: []string{"a"}})
+	s.Add(Component{Name: "c", Runner: rec.runner("c", nil), DependsOn: []string{"b"}})
+	err := s.Start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "start b: port in use") {
+		t.Fatalf("Start: %v", err)
+	}
+	if got, want := rec.String(), "start:a start:b stop:a"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestSupervisorRejectsBadDependencies(t *testing.T) {
+	var rec recorder
+	s := NewSupervisor(nil)
+	s.Add(Component{Name: "a", Runner: rec.runner("a", nil), DependsOn: []string{"b"}})
+	s.Add(Component{Name: "b", Runner: rec.runner("b", nil), DependsOn: []string{"a"}})
+	if err := s.Start(context.Background()); !errors.Is(err, ErrInvalidParameter) {
+		t.Fatalf("cycle: %v", err)
+	}
+	s = NewSupervisor(nil)
+	s.Add(Component{Name: "a", Runner: rec.runner("a", nil), DependsOn: []string{"missing"}})
+	if err := s.Start(context.Background()); !errors.Is(err, ErrInvalidParameter) {
+		t.Fatalf("unknown dependency: %v", err)
+	}
+	if rec.String() != "" {
+		t.Fatalf("components started: %s", rec.String())
+	}
+}
+
+func TestSupervisorRestartsCrashes(t *testing.T) {
+	var runs atomic.Int32
+	var reported atomic.Int32
+	s := NewSupervisor(func(name string, err error) { reported.Add(1) })
+	s.Add(Component{
+		Name: "loop",
+		Runner: RunFunc(func(ctx context.Context) error {
+			if runs.Add(1) < 3 {
+				panic("boom")
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+		Restart: RestartPolicy{Mode: RestartOnFailure, MaxRestarts: 5, Backoff: time.Millisecond},
+	})
+	ctx := context.Background()
+	if err := s.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for runs.Load() < 3 || s.Status()[0].State != ComponentRunning {
+		if time.Now().After(deadline) {
+			t.Fatalf("loop not restarted: %+v", s.Status())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if st := s.Status()[0]; st.Restarts != 2 || !strings.Contains(st.Error, "panic: boom") {
+		t.Fatalf("status %+v", st)
+	}
+	if n := reported.Load(); n != 2 {
+		t.Fatalf("%d crashes reported, want 2", n)
+	}
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	select {
+	case err := <-s.Exited():
+		t.Fatalf("supervisor failed: %v", err)
+	default:
+	}
+}
+
+func TestSupervisorGivesUp(t *testing.T) {
+	s := NewSupervisor(nil)
+	s.Add(Component{
+		Name:    "flaky",
+		Runner:  RunFunc(func(context.Context) error { return errors.New("sink unreachable") }),
+		Restart: RestartPolicy{Mode: RestartOnFailure, MaxRestarts: 2, Backoff: time.Millisecond},
+	})
+	s.Add(Component{Name: "done", Runner: RunFunc(func(context.Context) error { return nil })})
+	ctx := context.Background()
+	if err := s.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop(ctx)
+	select {
+	case err := <-s.Exited():
+		if !strings.Contains(err.Error(), "component flaky: sink unreachable (gave up after 2 restarts)") {
+			t.Fatalf("failure %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("supervisor did not give up")
+	}
+	st := s.Status()
+	if st[0].State != ComponentFailed || st[0].Restarts != 2 {
+		t.Fatalf("flaky %+v", st[0])
+	}
+	if st[1].State != ComponentExited {
+		t.Fatalf("a clean exit without restarts should be exited: %+v", st[1])
+	}
+}
+
+func TestServerRunner(t *testing.T) {
+	srv := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+	r := ServerRunner(srv)
+	ctx := context.Background()
+	if err := r.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if err := <-r.(Exiter).Exited(); err != nil {
+		t.Fatalf("a shutdown is a clean exit, got %v", err)
+	}
+}
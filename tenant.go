@@ -0,0 +1,64 @@
+package devicemgr
+
+import (
+	"context"
+	"strings"
+)
+
+// PartnerWildcard in a caller's partner scope grants access to devices of every partner.
+const PartnerWildcard = "*"
+
+// MetadataPartnerIDs is the DeviceState.Metadata key holding a device's comma-separated partner IDs.
+const MetadataPartnerIDs = "partner-ids"
+
+// DeviceState.Metadata keys for the model and firmware a device reports in its WebPA convey
+// header, captured from Talaria's device list when present.
+const (
+	MetadataModel    = "hw-model"
+	MetadataFirmware = "fw-name"
+)
+
+// MetadataTalariaInstance is the DeviceState.Metadata key naming the Talaria instance (host[:port])
+// whose device list reported the device, with PollingConfig.Instances.
+const MetadataTalariaInstance = "talaria-instance"
+
+type partnersKey struct{}
+
+// WithPartners returns a context scoped to the supplied partner IDs.
+func WithPartners(ctx context.Context, partners []string) context.Context {
+	return context.WithValue(ctx, partnersKey{}, partners)
+}
+
+// PartnersFromContext returns the caller's partner scope; ok is false when the context is unscoped
+// (single-tenant deployments), in which case no filtering applies.
+func PartnersFromContext(ctx context.Context) (partners []string, ok bool) {
+	partners, ok = ctx.Value(partnersKey{}).([]string)
+	return partners, ok
+}
+
+// PartnerAllowed reports whether a caller scope may see a device owned by devicePartners.
+// Devices without partner information are only visible to wildcard scopes.
+func PartnerAllowed(scope []string, devicePartners []string) bool {
+	for _, s := range scope {
+		if s == PartnerWildcard {
+			return true
+		}
+		for _, p := range devicePartners {
+			if s == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SplitPartners parses a comma-separated partner list as stored under MetadataPartnerIDs.
+func SplitPartners(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
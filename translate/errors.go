@@ -0,0 +1,409 @@
+package translate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLanguage is the language descriptions fall back to when an entry has no text in the
+// one asked for.
+const DefaultLanguage = "en"
+
+// ErrorEntry describes a WDMP status (e.g. 520) or a CCSP/TR-069 fault code (e.g. 9005): a
+// stable name, a human message and the suggested remediation, each keyed by language ("en",
+// "es", ...). Match lists lowercase fragments of the device messages reporting the fault
+// without its number.
+type ErrorEntry struct {
+	Code        int               `json:"code"`
+	Name        string            `json:"name"`
+	Messages    map[string]string `json:"messages"`
+	Remediation map[string]string `json:"remediation,omitempty"`
+	Match       []string          `json:"match,omitempty"`
+}
+
+// ErrorDescription is an ErrorEntry in one language, as API error bodies carry it.
+type ErrorDescription struct {
+	Code        int    `json:"code"`
+	Name        string `json:"name"`
+	Message     string `json:"message"`
+	Remediation string `json:"remediation,omitempty"`
+	Language    string `json:"language"`
+	// DeviceMessage is the message the device replied with, untranslated.
+	DeviceMessage string `json:"deviceMessage,omitempty"`
+	// Parameter is the parameter the fault was reported for, if any.
+	Parameter string `json:"parameter,omitempty"`
+}
+
+// ErrorCatalog maps WDMP and CCSP codes to ErrorEntries. It is safe for concurrent use.
+type ErrorCatalog struct {
+	mu      sync.RWMutex
+	entries map[int]ErrorEntry
+}
+
+// NewErrorCatalog returns a catalog of entries.
+func NewErrorCatalog(entries ...ErrorEntry) *ErrorCatalog {
+	c := &ErrorCatalog{entries: map[int]ErrorEntry{}}
+	c.Add(entries...)
+	return c
+}
+
+var (
+	defaultErrorsOnce sync.Once
+	defaultErrors     *ErrorCatalog
+)
+
+// DefaultErrorCatalog returns the shared catalog of the WDMP statuses and TR-069 fault codes
+// devices report through Tr1d1um. Entries added to it are used by every API error and CLI
+// message describing a WDMP fault.
+func DefaultErrorCatalog() *ErrorCatalog {
+	defaultErrorsOnce.Do(func() { defaultErrors = NewErrorCatalog(builtinErrors...) })
+	return defaultErrors
+}
+
+// Add inserts entries, replacing those of the same code; the languages of a replaced entry the
+// new one lacks are kept, so a catalog can be extended one language at a time.
+func (c *ErrorCatalog) Add(entries ...ErrorEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range entries {
+		if old, ok := c.entries[e.Code]; ok {
+			e.Messages = mergeLanguages(old.Messages, e.Messages)
+			e.Remediation = mergeLanguages(old.Remediation, e.Remediation)
+			if e.Name == "" {
+				e.Name = old.Name
+			}
+			if len(e.Match) == 0 {
+				e.Match = old.Match
+			}
+		}
+		c.entries[e.Code] = e
+	}
+}
+
+func mergeLanguages(old, updated map[string]string) map[string]string {
+	merged := make(map[string]string, len(old)+len(updated))
+	for k, v := range old {
+		merged[k] = v
+	}
+	for k, v := range updated {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Lookup returns the entry of code.
+func (c *ErrorCatalog) Lookup(code int) (ErrorEntry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.entries[code]
+	return e, ok
+}
+
+// Entries returns the catalog's entries ordered by code.
+func (c *ErrorCatalog) Entries() []ErrorEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]ErrorEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
+
+// Describe returns code's entry in lang, a language tag such as "es" or "fr-CA" (matched on its
+// primary subtag), falling back to DefaultLanguage for text the entry lacks in lang.
+func (c *ErrorCatalog) Describe(code int, lang string) (ErrorDescription, bool) {
+	e, ok := c.Lookup(code)
+	if !ok {
+		return ErrorDescription{}, false
+	}
+	lang = primaryLanguage(lang)
+	msg, used := localized(e.Messages, lang)
+	remedy, _ := localized(e.Remediation, used)
+	return ErrorDescription{Code: e.Code, Name: e.Name, Message: msg, Remediation: remedy, Language: used}, true
+}
+
+// DescribeError describes the *StatusError in err's chain in lang: its fault code when the
+// catalog knows it, otherwise its WDMP status.
+func (c *ErrorCatalog) DescribeError(err error, lang string) (ErrorDescription, bool) {
+	var se *StatusError
+	if !errors.As(err, &se) {
+		return ErrorDescription{}, false
+	}
+	d, ok := c.Describe(se.Fault, lang)
+	if !ok {
+		if d, ok = c.Describe(se.Status, lang); !ok {
+			return ErrorDescription{}, false
+		}
+	}
+	d.DeviceMessage, d.Parameter = se.Message, se.Parameter
+	return d, true
+}
+
+// Identify returns the fault code a device message reports: a TR-069 fault number quoted in it,
+// or the entry one of whose Match fragments it contains.
+func (c *ErrorCatalog) Identify(message string) (int, bool) {
+	if m := faultNumber.FindString(message); m != "" {
+		code, _ := strconv.Atoi(m)
+		return code, true
+	}
+	lower := strings.ToLower(message)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	best, bestLen := 0, 0
+	for code, e := range c.entries {
+		for _, frag := range e.Match {
+			if len(frag) > bestLen && strings.Contains(lower, frag) {
+				best, bestLen = code, len(frag)
+			}
+		}
+	}
+	return best, bestLen > 0
+}
+
+// faultNumber finds a TR-069 fault code (9000-9899) quoted in a message.
+var faultNumber = regexp.MustCompile(`\b9[0-8]\d\d\b`)
+
+func primaryLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_.@"); i >= 0 {
+		tag = tag[:i]
+	}
+	if tag == "" || tag == "c" || tag == "posix" {
+		return DefaultLanguage
+	}
+	return tag
+}
+
+// localized returns text in lang, or in DefaultLanguage, naming the language used.
+func localized(text map[string]string, lang string) (string, string) {
+	if s, ok := text[lang]; ok {
+		return s, lang
+	}
+	return text[DefaultLanguage], DefaultLanguage
+}
+
+// StatusError is a WDMP reply refusing a request: the reply's statusCode and message, the CCSP
+// fault code the device gave for it (zero when none could be identified) and the parameter
+// concerned. It wraps Err, the error the request otherwise fails with, so sentinel matching is
+// unchanged.
+type StatusError struct {
+	Status    int
+	Fault     int
+	Message   string
+	Parameter string
+	Err       error
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("wdmp: status %d", e.Status)
+	if e.Fault != 0 {
+		msg += fmt.Sprintf(" (fault %d)", e.Fault)
+	}
+	if e.Parameter != "" {
+		msg += " for " + e.Parameter
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *StatusError) Unwrap() error { return e.Err }
+
+// WrapStatus wraps err in the *StatusError body, a WDMP reply, describes, identifying the fault
+// with DefaultErrorCatalog. It returns err unchanged when body is not a WDMP reply or reports
+// success.
+func WrapStatus(body []byte, err error) error {
+	var r Response
+	if json.Unmarshal(body, &r) != nil || r.StatusCode == 0 || r.StatusCode == 200 || r.StatusCode == 201 {
+		return err
+	}
+	se := &StatusError{Status: r.StatusCode, Message: r.Message, Err: err}
+	catalog := DefaultErrorCatalog()
+	if code, ok := catalog.Identify(r.Message); ok {
+		se.Fault = code
+	}
+	for _, p := range r.Parameters {
+		if p.Message == "" {
+			continue
+		}
+		if code, ok := catalog.Identify(p.Message); ok || se.Parameter == "" {
+			se.Parameter, se.Message = p.Name, p.Message
+			if ok {
+				se.Fault = code
+				break
+			}
+		}
+	}
+	if se.Message == "" {
+		se.Message = r.Message
+	}
+	return se
+}
+
+var builtinErrors = []ErrorEntry{
+	{
+		Code: 520, Name: "wdmp_failure",
+		Messages: map[string]string{
+			"en": "The device could not complete the request.",
+			"es": "El dispositivo no pudo completar la solicitud.",
+			"fr": "L'appareil n'a pas pu traiter la requête.",
+		},
+		Remediation: map[string]string{
+			"en": "Check the parameter names and values against the device's data model, then retry; if it persists, check the device's CCSP logs.",
+			"es": "Compruebe los nombres y valores de los parámetros con el modelo de datos del dispositivo y reintente; si persiste, revise los registros CCSP del dispositivo.",
+			"fr": "Vérifiez les noms et valeurs des paramètres par rapport au modèle de données de l'appareil, puis réessayez ; si le problème persiste, consultez les journaux CCSP de l'appareil.",
+		},
+	},
+	{
+		Code: 9000, Name: "method_not_supported",
+		Messages: map[string]string{
+			"en": "The device does not support this method.",
+			"es": "El dispositivo no admite este método.",
+			"fr": "L'appareil ne prend pas en charge cette méthode.",
+		},
+		Remediation: map[string]string{
+			"en": "Use a command the device's firmware supports, or upgrade the firmware.",
+			"es": "Use un comando que admita el firmware del dispositivo o actualice el firmware.",
+			"fr": "Utilisez une commande prise en charge par le micrologiciel de l'appareil, ou mettez-le à jour.",
+		},
+		Match: []string{"method not supported"},
+	},
+	{
+		Code: 9001, Name: "request_denied",
+		Messages: map[string]string{
+			"en": "The device denied the request.",
+			"es": "El dispositivo denegó la solicitud.",
+			"fr": "L'appareil a refusé la requête.",
+		},
+		Remediation: map[string]string{
+			"en": "Check that the parameter may be changed remotely on this device.",
+			"es": "Compruebe que el parámetro pueda modificarse de forma remota en este dispositivo.",
+			"fr": "Vérifiez que le paramètre peut être modifié à distance sur cet appareil.",
+		},
+		Match: []string{"request denied"},
+	},
+	{
+		Code: 9002, Name: "internal_error",
+		Messages: map[string]string{
+			"en": "The device reported an internal error.",
+			"es": "El dispositivo informó de un error interno.",
+			"fr": "L'appareil a signalé une erreur interne.",
+		},
+		Remediation: map[string]string{
+			"en": "Retry later; if it persists, reboot the device and check its CCSP logs.",
+			"es": "Reintente más tarde; si persiste, reinicie el dispositivo y revise sus registros CCSP.",
+			"fr": "Réessayez plus tard ; si le problème persiste, redémarrez l'appareil et consultez ses journaux CCSP.",
+		},
+		Match: []string{"internal error"},
+	},
+	{
+		Code: 9003, Name: "invalid_arguments",
+		Messages: map[string]string{
+			"en": "The request's arguments are invalid.",
+			"es": "Los argumentos de la solicitud no son válidos.",
+			"fr": "Les arguments de la requête sont invalides.",
+		},
+		Remediation: map[string]string{
+			"en": "Check the request's parameters and attributes are well formed.",
+			"es": "Compruebe que los parámetros y atributos de la solicitud estén bien formados.",
+			"fr": "Vérifiez que les paramètres et attributs de la requête sont bien formés.",
+		},
+		Match: []string{"invalid argument"},
+	},
+	{
+		Code: 9004, Name: "resources_exceeded",
+		Messages: map[string]string{
+			"en": "The device ran out of resources handling the request.",
+			"es": "El dispositivo agotó sus recursos al procesar la solicitud.",
+			"fr": "L'appareil a épuisé ses ressources en traitant la requête.",
+		},
+		Remediation: map[string]string{
+			"en": "Request fewer parameters at once (lower maxGetNames) or avoid wide wildcards.",
+			"es": "Solicite menos parámetros a la vez (reduzca maxGetNames) o evite comodines amplios.",
+			"fr": "Demandez moins de paramètres à la fois (réduisez maxGetNames) ou évitez les jokers trop larges.",
+		},
+		Match: []string{"resources exceeded"},
+	},
+	{
+		Code: 9005, Name: "invalid_parameter_name",
+		Messages: map[string]string{
+			"en": "The device does not have a parameter by this name.",
+			"es": "El dispositivo no tiene un parámetro con este nombre.",
+			"fr": "L'appareil n'a pas de paramètre portant ce nom.",
+		},
+		Remediation: map[string]string{
+			"en": "Check the parameter name's spelling and instance numbers against the device's data model.",
+			"es": "Compruebe la ortografía del nombre del parámetro y los números de instancia con el modelo de datos del dispositivo.",
+			"fr": "Vérifiez l'orthographe du nom du paramètre et les numéros d'instance par rapport au modèle de données de l'appareil.",
+		},
+		Match: []string{"invalid parameter name", "unsupported namespace", "parameter name is invalid"},
+	},
+	{
+		Code: 9006, Name: "invalid_parameter_type",
+		Messages: map[string]string{
+			"en": "The value's type does not match the parameter's.",
+			"es": "El tipo del valor no coincide con el del parámetro.",
+			"fr": "Le type de la valeur ne correspond pas à celui du paramètre.",
+		},
+		Remediation: map[string]string{
+			"en": "Send the value with the parameter's data type (dataType).",
+			"es": "Envíe el valor con el tipo de datos del parámetro (dataType).",
+			"fr": "Envoyez la valeur avec le type de données du paramètre (dataType).",
+		},
+		Match: []string{"invalid parameter type", "invalid type"},
+	},
+	{
+		Code: 9007, Name: "invalid_parameter_value",
+		Messages: map[string]string{
+			"en": "The device rejected the parameter's value.",
+			"es": "El dispositivo rechazó el valor del parámetro.",
+			"fr": "L'appareil a rejeté la valeur du paramètre.",
+		},
+		Remediation: map[string]string{
+			"en": "Check the value is within the parameter's allowed range or enumeration.",
+			"es": "Compruebe que el valor esté dentro del rango o de la enumeración permitidos del parámetro.",
+			"fr": "Vérifiez que la valeur respecte la plage ou l'énumération autorisée du paramètre.",
+		},
+		Match: []string{"invalid parameter value", "invalid value"},
+	},
+	{
+		Code: 9008, Name: "parameter_not_writable",
+		Messages: map[string]string{
+			"en": "The parameter is read-only.",
+			"es": "El parámetro es de solo lectura.",
+			"fr": "Le paramètre est en lecture seule.",
+		},
+		Remediation: map[string]string{
+			"en": "Remove the parameter from the SET; read-only parameters cannot be changed remotely.",
+			"es": "Quite el parámetro del SET; los parámetros de solo lectura no se pueden modificar de forma remota.",
+			"fr": "Retirez le paramètre du SET ; les paramètres en lecture seule ne peuvent pas être modifiés à distance.",
+		},
+		Match: []string{"not writable", "non-writable", "read only", "read-only"},
+	},
+	{
+		Code: 9009, Name: "notification_rejected",
+		Messages: map[string]string{
+			"en": "The device rejected the notification request.",
+			"es": "El dispositivo rechazó la solicitud de notificación.",
+			"fr": "L'appareil a rejeté la demande de notification.",
+		},
+		Remediation: map[string]string{
+			"en": "Use a notify attribute the parameter supports; some parameters cannot be watched.",
+			"es": "Use un atributo notify que admita el parámetro; algunos parámetros no se pueden observar.",
+			"fr": "Utilisez un attribut notify pris en charge par le paramètre ; certains paramètres ne peuvent pas être surveillés.",
+		},
+		Match: []string{"notification request rejected", "setattribute rejected"},
+	},
+}
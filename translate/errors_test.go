@@ -0,0 +1,76 @@
+package translate
+
+import (
+	"errors"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+)
+
+func TestErrorCatalogDescribe(t *testing.T) {
+	c := DefaultErrorCatalog()
+	d, ok := c.Describe(9005, "es-MX")
+	if !ok || d.Name != "invalid_parameter_name" || d.Language != "es" || d.Message == "" || d.Remediation == "" {
+		t.Fatalf("9005 in es-MX = %+v, %v", d, ok)
+	}
+	if en, _ := c.Describe(9005, "de_DE.UTF-8"); en.Language != DefaultLanguage || en.Message == d.Message {
+		t.Fatalf("unknown language should fall back to English: %+v", en)
+	}
+	if _, ok := c.Describe(12345, "en"); ok {
+		t.Fatal("unknown code described")
+	}
+
+	// adding a language keeps the entry's others
+	custom := NewErrorCatalog(builtinErrors...)
+	custom.Add(ErrorEntry{Code: 520, Messages: map[string]string{"de": "Das Gerät konnte die Anfrage nicht ausführen."}})
+	if de, _ := custom.Describe(520, "de"); de.Name != "wdmp_failure" || de.Language != "de" || de.Remediation == "" {
+		t.Fatalf("520 in de = %+v", de)
+	}
+	if en, _ := custom.Describe(520, "en"); en.Message != "The device could not complete the request." {
+		t.Fatalf("520 in en = %+v", en)
+	}
+}
+
+func TestErrorCatalogIdentify(t *testing.T) {
+	c := DefaultErrorCatalog()
+	for msg, want := range map[string]int{
+		"Error unsupported namespace": 9005,
+		"Failure: fault 9007":         9007,
+		"Parameter is not writable":   9008,
+		"Invalid Parameter Value":     9007,
+	} {
+		if code, ok := c.Identify(msg); !ok || code != want {
+			t.Errorf("Identify(%q) = %d, %v; want %d", msg, code, ok, want)
+		}
+	}
+	if _, ok := c.Identify("Success"); ok {
+		t.Error("success identified as a fault")
+	}
+}
+
+func TestWrapStatus(t *testing.T) {
+	cause := &dm.BackendError{Backend: "tr1d1um", Status: 520}
+	err := WrapStatus([]byte(`{"statusCode":520,"message":"Failure","parameters":[{"name":"Device.Bogus","message":"Invalid parameter name"}]}`), cause)
+	var se *StatusError
+	if !errors.As(err, &se) || se.Status != 520 || se.Fault != 9005 || se.Parameter != "Device.Bogus" {
+		t.Fatalf("wrapped = %#v", err)
+	}
+	if !errors.Is(err, dm.ErrBackendUnavailable) {
+		t.Fatalf("wrapped error lost its sentinel: %v", err)
+	}
+	d, ok := DefaultErrorCatalog().DescribeError(err, "fr")
+	if !ok || d.Code != 9005 || d.Language != "fr" || d.Parameter != "Device.Bogus" || d.DeviceMessage != "Invalid parameter name" {
+		t.Fatalf("described = %+v, %v", d, ok)
+	}
+
+	// an unidentified fault is described by its status
+	err = WrapStatus([]byte(`{"statusCode":520,"message":"Something odd"}`), cause)
+	if d, ok := DefaultErrorCatalog().DescribeError(err, ""); !ok || d.Code != 520 || d.DeviceMessage != "Something odd" {
+		t.Fatalf("520 described = %+v, %v", d, ok)
+	}
+	for _, body := range []string{`not json`, `{"message":"no status"}`, `{"statusCode":200}`} {
+		if got := WrapStatus([]byte(body), cause); got != error(cause) {
+			t.Errorf("WrapStatus(%s) = %v", body, got)
+		}
+	}
+}
@@ -3,6 +3,9 @@ package translate
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"sort"
 	"strings"
 
 	"github.com/xmidt-org/talaria/devicemgr"
@@ -72,6 +75,100 @@ func BuildSet(params []devicemgr.SetParameter, cas *devicemgr.CASCondition) ([]b
 	return json.Marshal(root)
 }
 
+// SET_ATTRIBUTES attribute keys BuildSetAttributes accepts.
+const (
+	AttributeNotify = "notify" // value-change notifications: 0 off, 1 passive, 2 active
+	AttributeAccess = "access" // entities besides the ACS allowed to write, e.g. ["Subscriber"]
+)
+
+// BuildSetAttributes constructs a SET_ATTRIBUTES payload from attributes keyed by parameter name,
+// validating them with AttributeParams.
+func BuildSetAttributes(attrs map[string]map[string]interface{}) ([]byte, error) {
+	params, err := AttributeParams(attrs)
+	if err != nil {
+		return nil, err
+	}
+	return BuildSet(params, nil)
+}
+
+// AttributeParams turns attributes keyed by parameter name into attribute-only SetParameters,
+// sorted by name. Only AttributeNotify and AttributeAccess are known; notify must be a whole
+// number from 0 to 2 and access a list of strings. Errors wrap ErrInvalidParameter.
+func AttributeParams(attrs map[string]map[string]interface{}) ([]devicemgr.SetParameter, error) {
+	if len(attrs) == 0 {
+		return nil, fmt.Errorf("wdmp: no attributes: %w", devicemgr.ErrInvalidParameter)
+	}
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	params := make([]devicemgr.SetParameter, 0, len(names))
+	for _, name := range names {
+		if name == "" {
+			return nil, fmt.Errorf("wdmp: empty parameter name: %w", devicemgr.ErrInvalidParameter)
+		}
+		if len(attrs[name]) == 0 {
+			return nil, fmt.Errorf("wdmp: %s: no attributes: %w", name, devicemgr.ErrInvalidParameter)
+		}
+		out := make(map[string]interface{}, len(attrs[name]))
+		for key, v := range attrs[name] {
+			norm, err := attributeValue(key, v)
+			if err != nil {
+				return nil, fmt.Errorf("wdmp: %s: %w", name, err)
+			}
+			out[key] = norm
+		}
+		params = append(params, devicemgr.SetParameter{Name: name, Attributes: out})
+	}
+	return params, nil
+}
+
+// attributeValue validates one attribute, normalizing notify to an int and access to []string.
+func attributeValue(key string, v interface{}) (interface{}, error) {
+	switch key {
+	case AttributeNotify:
+		var n float64
+		switch x := v.(type) {
+		case int:
+			n = float64(x)
+		case int64:
+			n = float64(x)
+		case float64:
+			n = x
+		case json.Number:
+			f, err := x.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("notify %v: %w", v, devicemgr.ErrInvalidParameter)
+			}
+			n = f
+		default:
+			return nil, fmt.Errorf("notify %v: want 0, 1 or 2: %w", v, devicemgr.ErrInvalidParameter)
+		}
+		if n != math.Trunc(n) || n < 0 || n > 2 {
+			return nil, fmt.Errorf("notify %v: want 0, 1 or 2: %w", v, devicemgr.ErrInvalidParameter)
+		}
+		return int(n), nil
+	case AttributeAccess:
+		switch x := v.(type) {
+		case []string:
+			return x, nil
+		case []interface{}:
+			out := make([]string, 0, len(x))
+			for _, e := range x {
+				s, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("access %v: want a list of strings: %w", v, devicemgr.ErrInvalidParameter)
+				}
+				out = append(out, s)
+			}
+			return out, nil
+		}
+		return nil, fmt.Errorf("access %v: want a list of strings: %w", v, devicemgr.ErrInvalidParameter)
+	}
+	return nil, fmt.Errorf("unknown attribute %q: %w", key, devicemgr.ErrInvalidParameter)
+}
+
 func BuildAddRow(table string, row map[string]interface{}) ([]byte, error) {
 	if strings.TrimSpace(table) == "" {
 		return nil, errMissingTable
@@ -98,3 +195,36 @@ func BuildDeleteRow(rowRef string) ([]byte, error) {
 	}
 	return json.Marshal(map[string]interface{}{"command": "DELETE_ROW", "row": rowRef})
 }
+
+// Response is a device's WDMP reply.
+type Response struct {
+	StatusCode int             `json:"statusCode"`
+	Message    string          `json:"message,omitempty"`
+	Parameters []ResponseParam `json:"parameters,omitempty"`
+}
+
+// ResponseParam is one parameter of a WDMP reply; GET replies for wildcard names nest the
+// matched parameters in Value.
+type ResponseParam struct {
+	Name           string      `json:"name"`
+	Value          interface{} `json:"value,omitempty"`
+	DataType       int         `json:"dataType,omitempty"`
+	ParameterCount int         `json:"parameterCount,omitempty"`
+	Message        string      `json:"message,omitempty"`
+}
+
+// ParseResponse decodes a WDMP reply payload. Status codes other than 200/201 are returned as an
+// error alongside the decoded response.
+func ParseResponse(payload []byte) (*Response, error) {
+	var r Response
+	if err := json.Unmarshal(payload, &r); err != nil {
+		return nil, fmt.Errorf("wdmp: %w", err)
+	}
+	switch r.StatusCode {
+	case 200, 201:
+		return &r, nil
+	case 0:
+		return nil, errors.New("wdmp: missing statusCode")
+	}
+	return &r, fmt.Errorf("wdmp: status %d: %s", r.StatusCode, r.Message)
+}
@@ -0,0 +1,59 @@
+package translate
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/xmidt-org/talaria/devicemgr"
+)
+
+// Budgets for these benchmarks are listed in docs/performance.md.
+
+var benchNames = func() []string {
+	names := make([]string, 20)
+	for i := range names {
+		names[i] = fmt.Sprintf("Device.WiFi.SSID.%d.SSID", i+1)
+	}
+	return names
+}()
+
+func BenchmarkBuildGet(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := BuildGet(benchNames, false, ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildSet(b *testing.B) {
+	params := make([]devicemgr.SetParameter, len(benchNames))
+	for i, n := range benchNames {
+		params[i] = devicemgr.SetParameter{Name: n, Value: "home", TypeHint: "string"}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := BuildSet(params, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseResponse(b *testing.B) {
+	payload := []byte(`{"statusCode":200,"parameters":[`)
+	for i, n := range benchNames {
+		if i > 0 {
+			payload = append(payload, ',')
+		}
+		payload = append(payload, fmt.Sprintf(`{"name":%q,"value":"home","dataType":0,"message":"Success"}`, n)...)
+	}
+	payload = append(payload, "]}"...)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseResponse(payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
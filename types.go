@@ -1,6 +1,9 @@
 package devicemgr
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 type DeviceID string
 
@@ -12,6 +15,31 @@ const (
 	FreshStale
 )
 
+func (f Freshness) String() string {
+	switch f {
+	case FreshRealTime:
+		return "realtime"
+	case FreshRecentCache:
+		return "recent_cache"
+	case FreshStale:
+		return "stale"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes f by name, so JSON carries "realtime" rather than 0.
+func (f Freshness) MarshalText() ([]byte, error) { return []byte(f.String()), nil }
+
+func (f *Freshness) UnmarshalText(b []byte) error {
+	for _, v := range []Freshness{FreshRealTime, FreshRecentCache, FreshStale} {
+		if v.String() == string(b) {
+			*f = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown freshness %q", b)
+}
+
 type DeviceState struct {
 	ID          DeviceID
 	Online      bool
@@ -22,12 +50,14 @@ type DeviceState struct {
 }
 
 type ParameterValue struct {
-	Name        string
-	Value       interface{}
-	Type        string
-	Attributes  map[string]interface{}
-	RetrievedAt time.Time
-	Freshness   Freshness
+	Name        string                 `json:"name"`
+	Value       interface{}            `json:"value"`
+	Type        string                 `json:"type,omitempty"`
+	Attributes  map[string]interface{} `json:"attributes,omitempty"`
+	RetrievedAt time.Time              `json:"retrievedAt"`
+	Freshness   Freshness              `json:"freshness"`
+	Unit        string                 `json:"unit,omitempty"`  // from the catalog (ParameterDescriber)
+	Label       string                 `json:"label,omitempty"` // the catalog's label for an enumerated value
 }
 
 type SetParameter struct {
@@ -50,6 +80,9 @@ type GetOptions struct {
 type SetOptions struct {
 	TestAndSet *CASCondition
 	Atomic     bool
+	// DryRun validates the SET against Options.Catalog and the device's state and reports what
+	// would be sent, without contacting the device.
+	DryRun bool
 }
 
 type EventKind string
@@ -58,6 +91,10 @@ const (
 	EventOnline       EventKind = "online"
 	EventOffline      EventKind = "offline"
 	EventNotification EventKind = "notification"
+	EventCrash        EventKind = "crash"
+	EventSuspect      EventKind = "suspect" // missing from a poll, not yet confirmed offline
+	EventDrift        EventKind = "drift"   // a parameter differs from the value a profile or policy expects
+	EventRollout      EventKind = "rollout" // a firmware rollout started, paused, resumed, rolled back or finished
 )
 
 type Event struct {
@@ -66,6 +103,10 @@ type Event struct {
 	OccurredAt time.Time
 	Source     string
 	Payload    interface{}
+	// Seq orders events delivered through an events.Bus; zero when read from a source directly.
+	Seq uint64
+	// Tags are the labels the event pipeline (EventsConfig.Pipeline) decorated the event with.
+	Tags map[string]string
 }
 
 type EventSubscription interface {
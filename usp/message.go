@@ -0,0 +1,930 @@
+// Package usp encodes and decodes the TR-369 (USP) Record and Msg protobufs used by the
+// runtime USP adapter: Get, Set, Operate and Notify plus their responses and Error.
+// Field numbers follow usp-record-1-3.proto and usp-msg-1-3.proto.
+package usp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Version is the USP protocol version advertised in outbound Records.
+const Version = "1.3"
+
+// ErrUnsupportedRecord is returned for session-context, STOMP/UDS connect and disconnect records.
+var ErrUnsupportedRecord = errors.New("usp: unsupported record type")
+
+// RecordType is the Record.record_type oneof member. Only no-session-context records carry a
+// Msg; connect records are sent by agents when an MTP connection is established.
+type RecordType int
+
+const (
+	RecordNoSessionContext RecordType = 7
+	RecordWebSocketConnect RecordType = 9
+	RecordMQTTConnect      RecordType = 10
+)
+
+// MsgType is the USP Header.MsgType enum.
+type MsgType int32
+
+const (
+	MsgError       MsgType = 0
+	MsgGet         MsgType = 1
+	MsgGetResp     MsgType = 2
+	MsgNotify      MsgType = 3
+	MsgSet         MsgType = 4
+	MsgSetResp     MsgType = 5
+	MsgOperate     MsgType = 6
+	MsgOperateResp MsgType = 7
+	MsgNotifyResp  MsgType = 16
+)
+
+// Field numbers of the oneof members used below.
+const (
+	bodyRequest             = 1
+	bodyResponse            = 2
+	bodyError               = 3
+	reqGet, respGet         = 1, 1
+	reqSet, respSet         = 4, 4
+	reqOperate, respOperate = 7, 7
+	reqNotify, respNotify   = 8, 8
+)
+
+// Record is a USP Record. Type defaults to RecordNoSessionContext, whose Payload is an encoded Msg.
+type Record struct {
+	Version string
+	ToID    string
+	FromID  string
+	Type    RecordType
+	Payload []byte
+	// SubscribedTopic is the agent's reply topic in an MQTT connect record.
+	SubscribedTopic string
+}
+
+// Marshal encodes r, defaulting Type.
+func (r *Record) Marshal() []byte {
+	if r.Type == 0 {
+		r.Type = RecordNoSessionContext
+	}
+	var e encoder
+	e.string(1, r.Version)
+	e.string(2, r.ToID)
+	e.string(3, r.FromID)
+	e.message(int(r.Type), func(c *encoder) {
+		switch r.Type {
+		case RecordNoSessionContext:
+			c.bytes(2, r.Payload)
+		case RecordMQTTConnect:
+			c.uint(1, 1) // MQTTVersion V5
+			c.string(2, r.SubscribedTopic)
+		}
+	})
+	return e.b
+}
+
+// UnmarshalRecord decodes a Record. Unsupported record types return ErrUnsupportedRecord
+// alongside the decoded addressing fields.
+func UnmarshalRecord(b []byte) (*Record, error) {
+	r := &Record{}
+	err := fields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			r.Version = f.str()
+		case 2:
+			r.ToID = f.str()
+		case 3:
+			r.FromID = f.str()
+		case int(RecordNoSessionContext), int(RecordWebSocketConnect), int(RecordMQTTConnect):
+			r.Type = RecordType(f.num)
+			return fields(f.b, func(p field) error {
+				switch {
+				case r.Type == RecordNoSessionContext && p.num == 2:
+					r.Payload = p.b
+				case r.Type == RecordMQTTConnect && p.num == 2:
+					r.SubscribedTopic = p.str()
+				}
+				return nil
+			})
+		case 4, 5, 6: // payload_security, mac_signature, sender_cert
+		default:
+			r.Type = RecordType(f.num)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch r.Type {
+	case RecordNoSessionContext, RecordWebSocketConnect, RecordMQTTConnect:
+		return r, nil
+	}
+	return r, ErrUnsupportedRecord
+}
+
+// Msg is a USP message. Exactly one body field should be set; Type is derived from it on Marshal.
+type Msg struct {
+	ID   string
+	Type MsgType
+
+	Get     *Get
+	Set     *Set
+	Operate *Operate
+	Notify  *Notify
+
+	GetResp     *GetResp
+	SetResp     *SetResp
+	OperateResp *OperateResp
+	NotifyResp  *NotifyResp
+
+	Error *Error
+}
+
+// Get requests parameter values for paths (full names, partial paths ending in "." or search paths).
+type Get struct {
+	ParamPaths []string
+	MaxDepth   uint32
+}
+
+type GetResp struct {
+	Results []RequestedPathResult
+}
+
+type RequestedPathResult struct {
+	RequestedPath string
+	ErrCode       uint32
+	ErrMsg        string
+	Resolved      []ResolvedPathResult
+}
+
+// ResolvedPathResult holds the values of one object instance; Params keys are relative to ResolvedPath.
+type ResolvedPathResult struct {
+	ResolvedPath string
+	Params       map[string]string
+}
+
+type Set struct {
+	AllowPartial bool
+	Objects      []UpdateObject
+}
+
+type UpdateObject struct {
+	ObjPath string
+	Params  []UpdateParamSetting
+}
+
+type UpdateParamSetting struct {
+	Param    string
+	Value    string
+	Required bool
+}
+
+type SetResp struct {
+	Results []UpdatedObjectResult
+}
+
+// UpdatedObjectResult is the outcome for one UpdateObject: Failure is set on failure, Updated on success.
+type UpdatedObjectResult struct {
+	RequestedPath string
+	Failure       *OperationFailure
+	Updated       []UpdatedInstance
+}
+
+type OperationFailure struct {
+	ErrCode   uint32
+	ErrMsg    string
+	Instances []UpdatedInstance
+}
+
+type UpdatedInstance struct {
+	AffectedPath  string
+	ParamErrs     []ParamError
+	UpdatedParams map[string]string
+}
+
+// ParamError is a per-parameter error in SetResp and Error.
+type ParamError struct {
+	Path    string `json:"path"`
+	ErrCode uint32 `json:"errCode"`
+	ErrMsg  string `json:"errMsg,omitempty"`
+}
+
+// Operate invokes a command such as "Device.Reboot()".
+type Operate struct {
+	Command    string
+	CommandKey string
+	SendResp   bool
+	InputArgs  map[string]string
+}
+
+type OperateResp struct {
+	Results []OperationResult
+}
+
+// OperationResult carries one of: ReqObjPath (asynchronous command; completion arrives as a
+// Notify), Failure, or OutputArgs (synchronous success).
+type OperationResult struct {
+	ExecutedCommand string
+	ReqObjPath      string
+	OutputArgs      map[string]string
+	Failure         *CommandFailure
+}
+
+type CommandFailure struct {
+	ErrCode uint32 `json:"errCode"`
+	ErrMsg  string `json:"errMsg,omitempty"`
+}
+
+// Notify is an agent-originated notification; exactly one of the notification fields is set.
+type Notify struct {
+	SubscriptionID string             `json:"subscriptionId"`
+	SendResp       bool               `json:"sendResp,omitempty"`
+	Event          *NotifyEvent       `json:"event,omitempty"`
+	ValueChange    *ValueChange       `json:"valueChange,omitempty"`
+	ObjCreation    *ObjectCreation    `json:"objCreation,omitempty"`
+	ObjDeletion    *ObjectDeletion    `json:"objDeletion,omitempty"`
+	OperComplete   *OperationComplete `json:"operComplete,omitempty"`
+	OnBoard        *OnBoardRequest    `json:"onBoardReq,omitempty"`
+}
+
+type NotifyEvent struct {
+	ObjPath   string            `json:"objPath"`
+	EventName string            `json:"eventName"`
+	Params    map[string]string `json:"params,omitempty"`
+}
+
+type ValueChange struct {
+	ParamPath  string `json:"paramPath"`
+	ParamValue string `json:"paramValue"`
+}
+
+type ObjectCreation struct {
+	ObjPath    string            `json:"objPath"`
+	UniqueKeys map[string]string `json:"uniqueKeys,omitempty"`
+}
+
+type ObjectDeletion struct {
+	ObjPath string `json:"objPath"`
+}
+
+type OperationComplete struct {
+	ObjPath     string            `json:"objPath"`
+	CommandName string            `json:"commandName"`
+	CommandKey  string            `json:"commandKey,omitempty"`
+	OutputArgs  map[string]string `json:"outputArgs,omitempty"`
+	Failure     *CommandFailure   `json:"failure,omitempty"`
+}
+
+type OnBoardRequest struct {
+	OUI                       string `json:"oui"`
+	ProductClass              string `json:"productClass,omitempty"`
+	SerialNumber              string `json:"serialNumber"`
+	AgentSupportedProtocolVer string `json:"agentSupportedProtocolVersions,omitempty"`
+}
+
+type NotifyResp struct {
+	SubscriptionID string
+}
+
+// Error is a USP Error message, sent in place of a response when a request fails as a whole.
+type Error struct {
+	ErrCode   uint32
+	ErrMsg    string
+	ParamErrs []ParamError
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("usp error %d: %s", e.ErrCode, e.ErrMsg) }
+
+// Marshal encodes m, setting the header type from the populated body.
+func (m *Msg) Marshal() ([]byte, error) {
+	var (
+		kind  int
+		which int
+		body  func(*encoder)
+	)
+	switch {
+	case m.Get != nil:
+		m.Type, kind, which, body = MsgGet, bodyRequest, reqGet, m.Get.encode
+	case m.Set != nil:
+		m.Type, kind, which, body = MsgSet, bodyRequest, reqSet, m.Set.encode
+	case m.Operate != nil:
+		m.Type, kind, which, body = MsgOperate, bodyRequest, reqOperate, m.Operate.encode
+	case m.Notify != nil:
+		m.Type, kind, which, body = MsgNotify, bodyRequest, reqNotify, m.Notify.encode
+	case m.GetResp != nil:
+		m.Type, kind, which, body = MsgGetResp, bodyResponse, respGet, m.GetResp.encode
+	case m.SetResp != nil:
+		m.Type, kind, which, body = MsgSetResp, bodyResponse, respSet, m.SetResp.encode
+	case m.OperateResp != nil:
+		m.Type, kind, which, body = MsgOperateResp, bodyResponse, respOperate, m.OperateResp.encode
+	case m.NotifyResp != nil:
+		m.Type, kind, which, body = MsgNotifyResp, bodyResponse, respNotify, m.NotifyResp.encode
+	case m.Error != nil:
+		m.Type, kind, body = MsgError, bodyError, m.Error.encode
+	default:
+		return nil, errors.New("usp: message has no body")
+	}
+	var e encoder
+	e.message(1, func(h *encoder) {
+		h.string(1, m.ID)
+		h.uint(2, uint64(m.Type))
+	})
+	e.message(2, func(b *encoder) {
+		if kind == bodyError {
+			b.message(bodyError, body)
+			return
+		}
+		b.message(kind, func(r *encoder) { r.message(which, body) })
+	})
+	return e.b, nil
+}
+
+// UnmarshalMsg decodes a Msg. Request and response types other than those listed on Msg are
+// decoded as a header only (all body fields nil).
+func UnmarshalMsg(b []byte) (*Msg, error) {
+	m := &Msg{}
+	err := fields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			return fields(f.b, func(h field) error {
+				switch h.num {
+				case 1:
+					m.ID = h.str()
+				case 2:
+					m.Type = MsgType(h.u)
+				}
+				return nil
+			})
+		case 2:
+			return fields(f.b, func(body field) error {
+				switch body.num {
+				case bodyRequest, bodyResponse:
+					return fields(body.b, func(r field) error { return m.decodeBody(body.num, r) })
+				case bodyError:
+					m.Error = &Error{}
+					return m.Error.decode(body.b)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Msg) decodeBody(kind int, f field) error {
+	if kind == bodyRequest {
+		switch f.num {
+		case reqGet:
+			m.Get = &Get{}
+			return m.Get.decode(f.b)
+		case reqSet:
+			m.Set = &Set{}
+			return m.Set.decode(f.b)
+		case reqOperate:
+			m.Operate = &Operate{}
+			return m.Operate.decode(f.b)
+		case reqNotify:
+			m.Notify = &Notify{}
+			return m.Notify.decode(f.b)
+		}
+		return nil
+	}
+	switch f.num {
+	case respGet:
+		m.GetResp = &GetResp{}
+		return m.GetResp.decode(f.b)
+	case respSet:
+		m.SetResp = &SetResp{}
+		return m.SetResp.decode(f.b)
+	case respOperate:
+		m.OperateResp = &OperateResp{}
+		return m.OperateResp.decode(f.b)
+	case respNotify:
+		m.NotifyResp = &NotifyResp{}
+		return fields(f.b, func(n field) error {
+			if n.num == 1 {
+				m.NotifyResp.SubscriptionID = n.str()
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+func (g *Get) encode(e *encoder) {
+	for _, p := range g.ParamPaths {
+		e.bytes(1, []byte(p))
+	}
+	e.fixed32(2, g.MaxDepth)
+}
+
+func (g *Get) decode(b []byte) error {
+	return fields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			g.ParamPaths = append(g.ParamPaths, f.str())
+		case 2:
+			g.MaxDepth = uint32(f.u)
+		}
+		return nil
+	})
+}
+
+func (g *GetResp) encode(e *encoder) {
+	for _, r := range g.Results {
+		e.message(1, func(c *encoder) {
+			c.string(1, r.RequestedPath)
+			c.fixed32(2, r.ErrCode)
+			c.string(3, r.ErrMsg)
+			for _, res := range r.Resolved {
+				c.message(4, func(d *encoder) {
+					d.string(1, res.ResolvedPath)
+					d.stringMap(2, res.Params)
+				})
+			}
+		})
+	}
+}
+
+func (g *GetResp) decode(b []byte) error {
+	return fields(b, func(f field) error {
+		if f.num != 1 {
+			return nil
+		}
+		var r RequestedPathResult
+		err := fields(f.b, func(c field) error {
+			switch c.num {
+			case 1:
+				r.RequestedPath = c.str()
+			case 2:
+				r.ErrCode = uint32(c.u)
+			case 3:
+				r.ErrMsg = c.str()
+			case 4:
+				res := ResolvedPathResult{Params: map[string]string{}}
+				if err := fields(c.b, func(d field) error {
+					switch d.num {
+					case 1:
+						res.ResolvedPath = d.str()
+					case 2:
+						return mapEntry(d.b, res.Params)
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+				r.Resolved = append(r.Resolved, res)
+			}
+			return nil
+		})
+		g.Results = append(g.Results, r)
+		return err
+	})
+}
+
+func (s *Set) encode(e *encoder) {
+	e.bool(1, s.AllowPartial)
+	for _, o := range s.Objects {
+		e.message(2, func(c *encoder) {
+			c.string(1, o.ObjPath)
+			for _, p := range o.Params {
+				c.message(2, func(d *encoder) {
+					d.string(1, p.Param)
+					d.string(2, p.Value)
+					d.bool(3, p.Required)
+				})
+			}
+		})
+	}
+}
+
+func (s *Set) decode(b []byte) error {
+	return fields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			s.AllowPartial = f.u != 0
+		case 2:
+			var o UpdateObject
+			err := fields(f.b, func(c field) error {
+				switch c.num {
+				case 1:
+					o.ObjPath = c.str()
+				case 2:
+					var p UpdateParamSetting
+					if err := fields(c.b, func(d field) error {
+						switch d.num {
+						case 1:
+							p.Param = d.str()
+						case 2:
+							p.Value = d.str()
+						case 3:
+							p.Required = d.u != 0
+						}
+						return nil
+					}); err != nil {
+						return err
+					}
+					o.Params = append(o.Params, p)
+				}
+				return nil
+			})
+			s.Objects = append(s.Objects, o)
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *SetResp) encode(e *encoder) {
+	for _, r := range s.Results {
+		e.message(1, func(c *encoder) {
+			c.string(1, r.RequestedPath)
+			c.message(2, func(st *encoder) {
+				if r.Failure != nil {
+					st.message(1, func(fl *encoder) {
+						fl.fixed32(1, r.Failure.ErrCode)
+						fl.string(2, r.Failure.ErrMsg)
+						for _, in := range r.Failure.Instances {
+							fl.message(3, in.encode)
+						}
+					})
+					return
+				}
+				st.message(2, func(ok *encoder) {
+					for _, in := range r.Updated {
+						ok.message(1, in.encode)
+					}
+				})
+			})
+		})
+	}
+}
+
+func (s *SetResp) decode(b []byte) error {
+	return fields(b, func(f field) error {
+		if f.num != 1 {
+			return nil
+		}
+		var r UpdatedObjectResult
+		err := fields(f.b, func(c field) error {
+			switch c.num {
+			case 1:
+				r.RequestedPath = c.str()
+			case 2:
+				return fields(c.b, func(st field) error {
+					switch st.num {
+					case 1:
+						r.Failure = &OperationFailure{}
+						return fields(st.b, func(fl field) error {
+							switch fl.num {
+							case 1:
+								r.Failure.ErrCode = uint32(fl.u)
+							case 2:
+								r.Failure.ErrMsg = fl.str()
+							case 3:
+								var in UpdatedInstance
+								if err := in.decode(fl.b); err != nil {
+									return err
+								}
+								r.Failure.Instances = append(r.Failure.Instances, in)
+							}
+							return nil
+						})
+					case 2:
+						return fields(st.b, func(ok field) error {
+							if ok.num != 1 {
+								return nil
+							}
+							var in UpdatedInstance
+							if err := in.decode(ok.b); err != nil {
+								return err
+							}
+							r.Updated = append(r.Updated, in)
+							return nil
+						})
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		s.Results = append(s.Results, r)
+		return err
+	})
+}
+
+// UpdatedInstance shares its layout between UpdatedInstanceResult and UpdatedInstanceFailure
+// (the latter has no updated_params).
+func (u UpdatedInstance) encode(e *encoder) {
+	e.string(1, u.AffectedPath)
+	for _, pe := range u.ParamErrs {
+		e.message(2, pe.encode)
+	}
+	e.stringMap(3, u.UpdatedParams)
+}
+
+func (u *UpdatedInstance) decode(b []byte) error {
+	return fields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			u.AffectedPath = f.str()
+		case 2:
+			var pe ParamError
+			if err := pe.decode(f.b); err != nil {
+				return err
+			}
+			u.ParamErrs = append(u.ParamErrs, pe)
+		case 3:
+			if u.UpdatedParams == nil {
+				u.UpdatedParams = map[string]string{}
+			}
+			return mapEntry(f.b, u.UpdatedParams)
+		}
+		return nil
+	})
+}
+
+func (p ParamError) encode(e *encoder) {
+	e.string(1, p.Path)
+	e.fixed32(2, p.ErrCode)
+	e.string(3, p.ErrMsg)
+}
+
+func (p *ParamError) decode(b []byte) error {
+	return fields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			p.Path = f.str()
+		case 2:
+			p.ErrCode = uint32(f.u)
+		case 3:
+			p.ErrMsg = f.str()
+		}
+		return nil
+	})
+}
+
+func (o *Operate) encode(e *encoder) {
+	e.string(1, o.Command)
+	e.string(2, o.CommandKey)
+	e.bool(3, o.SendResp)
+	e.stringMap(4, o.InputArgs)
+}
+
+func (o *Operate) decode(b []byte) error {
+	return fields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			o.Command = f.str()
+		case 2:
+			o.CommandKey = f.str()
+		case 3:
+			o.SendResp = f.u != 0
+		case 4:
+			if o.InputArgs == nil {
+				o.InputArgs = map[string]string{}
+			}
+			return mapEntry(f.b, o.InputArgs)
+		}
+		return nil
+	})
+}
+
+func (o *OperateResp) encode(e *encoder) {
+	for _, r := range o.Results {
+		e.message(1, func(c *encoder) {
+			c.string(1, r.ExecutedCommand)
+			switch {
+			case r.Failure != nil:
+				c.message(4, r.Failure.encode)
+			case r.ReqObjPath != "":
+				c.string(2, r.ReqObjPath)
+			default:
+				c.message(3, func(a *encoder) { a.stringMap(1, r.OutputArgs) })
+			}
+		})
+	}
+}
+
+func (o *OperateResp) decode(b []byte) error {
+	return fields(b, func(f field) error {
+		if f.num != 1 {
+			return nil
+		}
+		var r OperationResult
+		err := fields(f.b, func(c field) error {
+			switch c.num {
+			case 1:
+				r.ExecutedCommand = c.str()
+			case 2:
+				r.ReqObjPath = c.str()
+			case 3:
+				r.OutputArgs = map[string]string{}
+				return decodeOutputArgs(c.b, r.OutputArgs)
+			case 4:
+				r.Failure = &CommandFailure{}
+				return r.Failure.decode(c.b)
+			}
+			return nil
+		})
+		o.Results = append(o.Results, r)
+		return err
+	})
+}
+
+func decodeOutputArgs(b []byte, m map[string]string) error {
+	return fields(b, func(f field) error {
+		if f.num == 1 {
+			return mapEntry(f.b, m)
+		}
+		return nil
+	})
+}
+
+func (c *CommandFailure) encode(e *encoder) {
+	e.fixed32(1, c.ErrCode)
+	e.string(2, c.ErrMsg)
+}
+
+func (c *CommandFailure) decode(b []byte) error {
+	return fields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			c.ErrCode = uint32(f.u)
+		case 2:
+			c.ErrMsg = f.str()
+		}
+		return nil
+	})
+}
+
+func (n *Notify) encode(e *encoder) {
+	e.string(1, n.SubscriptionID)
+	e.bool(2, n.SendResp)
+	switch {
+	case n.Event != nil:
+		e.message(3, func(c *encoder) {
+			c.string(1, n.Event.ObjPath)
+			c.string(2, n.Event.EventName)
+			c.stringMap(3, n.Event.Params)
+		})
+	case n.ValueChange != nil:
+		e.message(4, func(c *encoder) {
+			c.string(1, n.ValueChange.ParamPath)
+			c.string(2, n.ValueChange.ParamValue)
+		})
+	case n.ObjCreation != nil:
+		e.message(5, func(c *encoder) {
+			c.string(1, n.ObjCreation.ObjPath)
+			c.stringMap(2, n.ObjCreation.UniqueKeys)
+		})
+	case n.ObjDeletion != nil:
+		e.message(6, func(c *encoder) { c.string(1, n.ObjDeletion.ObjPath) })
+	case n.OperComplete != nil:
+		oc := n.OperComplete
+		e.message(7, func(c *encoder) {
+			c.string(1, oc.ObjPath)
+			c.string(2, oc.CommandName)
+			c.string(3, oc.CommandKey)
+			if oc.Failure != nil {
+				c.message(5, oc.Failure.encode)
+			} else {
+				c.message(4, func(a *encoder) { a.stringMap(1, oc.OutputArgs) })
+			}
+		})
+	case n.OnBoard != nil:
+		e.message(8, func(c *encoder) {
+			c.string(1, n.OnBoard.OUI)
+			c.string(2, n.OnBoard.ProductClass)
+			c.string(3, n.OnBoard.SerialNumber)
+			c.string(4, n.OnBoard.AgentSupportedProtocolVer)
+		})
+	}
+}
+
+func (n *Notify) decode(b []byte) error {
+	return fields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			n.SubscriptionID = f.str()
+		case 2:
+			n.SendResp = f.u != 0
+		case 3:
+			n.Event = &NotifyEvent{}
+			return fields(f.b, func(c field) error {
+				switch c.num {
+				case 1:
+					n.Event.ObjPath = c.str()
+				case 2:
+					n.Event.EventName = c.str()
+				case 3:
+					if n.Event.Params == nil {
+						n.Event.Params = map[string]string{}
+					}
+					return mapEntry(c.b, n.Event.Params)
+				}
+				return nil
+			})
+		case 4:
+			n.ValueChange = &ValueChange{}
+			return fields(f.b, func(c field) error {
+				switch c.num {
+				case 1:
+					n.ValueChange.ParamPath = c.str()
+				case 2:
+					n.ValueChange.ParamValue = c.str()
+				}
+				return nil
+			})
+		case 5:
+			n.ObjCreation = &ObjectCreation{}
+			return fields(f.b, func(c field) error {
+				switch c.num {
+				case 1:
+					n.ObjCreation.ObjPath = c.str()
+				case 2:
+					if n.ObjCreation.UniqueKeys == nil {
+						n.ObjCreation.UniqueKeys = map[string]string{}
+					}
+					return mapEntry(c.b, n.ObjCreation.UniqueKeys)
+				}
+				return nil
+			})
+		case 6:
+			n.ObjDeletion = &ObjectDeletion{}
+			return fields(f.b, func(c field) error {
+				if c.num == 1 {
+					n.ObjDeletion.ObjPath = c.str()
+				}
+				return nil
+			})
+		case 7:
+			oc := &OperationComplete{}
+			n.OperComplete = oc
+			return fields(f.b, func(c field) error {
+				switch c.num {
+				case 1:
+					oc.ObjPath = c.str()
+				case 2:
+					oc.CommandName = c.str()
+				case 3:
+					oc.CommandKey = c.str()
+				case 4:
+					oc.OutputArgs = map[string]string{}
+					return decodeOutputArgs(c.b, oc.OutputArgs)
+				case 5:
+					oc.Failure = &CommandFailure{}
+					return oc.Failure.decode(c.b)
+				}
+				return nil
+			})
+		case 8:
+			n.OnBoard = &OnBoardRequest{}
+			return fields(f.b, func(c field) error {
+				switch c.num {
+				case 1:
+					n.OnBoard.OUI = c.str()
+				case 2:
+					n.OnBoard.ProductClass = c.str()
+				case 3:
+					n.OnBoard.SerialNumber = c.str()
+				case 4:
+					n.OnBoard.AgentSupportedProtocolVer = c.str()
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+func (n *NotifyResp) encode(e *encoder) { e.string(1, n.SubscriptionID) }
+
+func (x *Error) encode(e *encoder) {
+	e.fixed32(1, x.ErrCode)
+	e.string(2, x.ErrMsg)
+	for _, pe := range x.ParamErrs {
+		e.message(3, pe.encode)
+	}
+}
+
+func (x *Error) decode(b []byte) error {
+	return fields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			x.ErrCode = uint32(f.u)
+		case 2:
+			x.ErrMsg = f.str()
+		case 3:
+			var pe ParamError
+			if err := pe.decode(f.b); err != nil {
+				return err
+			}
+			x.ParamErrs = append(x.ParamErrs, pe)
+		}
+		return nil
+	})
+}
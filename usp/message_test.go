@@ -0,0 +1,103 @@
+package usp
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHeaderWireFormat(t *testing.T) {
+	b, err := (&Msg{ID: "1", Get: &Get{ParamPaths: []string{"Device."}}}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// header{msg_id:"1", msg_type:GET} body{request{get{param_paths:"Device."}}}
+	want := []byte{
+		0x0a, 0x05, 0x0a, 0x01, '1', 0x10, 0x01,
+		0x12, 0x0d, 0x0a, 0x0b, 0x0a, 0x09, 0x0a, 0x07, 'D', 'e', 'v', 'i', 'c', 'e', '.',
+	}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("encoding\n got %x\nwant %x", b, want)
+	}
+}
+
+func TestMsgRoundTrip(t *testing.T) {
+	msgs := []*Msg{
+		{ID: "g", Get: &Get{ParamPaths: []string{"Device.DeviceInfo.", "Device.WiFi.SSID.1.SSID"}, MaxDepth: 2}},
+		{ID: "gr", GetResp: &GetResp{Results: []RequestedPathResult{
+			{RequestedPath: "Device.DeviceInfo.", Resolved: []ResolvedPathResult{{ResolvedPath: "Device.DeviceInfo.", Params: map[string]string{"SoftwareVersion": "1.2", "UpTime": "30"}}}},
+			{RequestedPath: "Device.Nope.", ErrCode: 7026, ErrMsg: "invalid path"},
+		}}},
+		{ID: "s", Set: &Set{AllowPartial: true, Objects: []UpdateObject{{ObjPath: "Device.WiFi.SSID.1.", Params: []UpdateParamSetting{{Param: "SSID", Value: "home", Required: true}}}}}},
+		{ID: "sr", SetResp: &SetResp{Results: []UpdatedObjectResult{
+			{RequestedPath: "Device.WiFi.SSID.1.", Updated: []UpdatedInstance{{AffectedPath: "Device.WiFi.SSID.1.", UpdatedParams: map[string]string{"SSID": "home"}}}},
+			{RequestedPath: "Device.X.", Failure: &OperationFailure{ErrCode: 7002, ErrMsg: "denied", Instances: []UpdatedInstance{{AffectedPath: "Device.X.", ParamErrs: []ParamError{{Path: "Y", ErrCode: 7013, ErrMsg: "read only"}}}}}},
+		}}},
+		{ID: "o", Operate: &Operate{Command: "Device.Reboot()", CommandKey: "k", SendResp: true, InputArgs: map[string]string{"Cause": "remote"}}},
+		{ID: "or", OperateResp: &OperateResp{Results: []OperationResult{
+			{ExecutedCommand: "Device.Reboot()", OutputArgs: map[string]string{}},
+			{ExecutedCommand: "Device.IP.Diagnostics.IPPing()", ReqObjPath: "Device.LocalAgent.Request.3."},
+			{ExecutedCommand: "Device.Bad()", Failure: &CommandFailure{ErrCode: 7022, ErrMsg: "failed"}},
+		}}},
+		{ID: "n1", Notify: &Notify{SubscriptionID: "sub", SendResp: true, ValueChange: &ValueChange{ParamPath: "Device.X.Y", ParamValue: "1"}}},
+		{ID: "n2", Notify: &Notify{SubscriptionID: "sub", Event: &NotifyEvent{ObjPath: "Device.", EventName: "Boot!", Params: map[string]string{"Cause": "LocalReboot"}}}},
+		{ID: "n3", Notify: &Notify{OperComplete: &OperationComplete{ObjPath: "Device.IP.Diagnostics.", CommandName: "IPPing()", CommandKey: "k", OutputArgs: map[string]string{"SuccessCount": "3"}}}},
+		{ID: "n4", Notify: &Notify{OnBoard: &OnBoardRequest{OUI: "001122", ProductClass: "GW", SerialNumber: "SN1", AgentSupportedProtocolVer: "1.3"}}},
+		{ID: "n5", Notify: &Notify{ObjCreation: &ObjectCreation{ObjPath: "Device.NAT.PortMapping.4.", UniqueKeys: map[string]string{"Alias": "cpe-4"}}}},
+		{ID: "n6", Notify: &Notify{ObjDeletion: &ObjectDeletion{ObjPath: "Device.NAT.PortMapping.4."}}},
+		{ID: "nr", NotifyResp: &NotifyResp{SubscriptionID: "sub"}},
+		{ID: "e", Error: &Error{ErrCode: 7004, ErrMsg: "invalid arguments", ParamErrs: []ParamError{{Path: "Device.X", ErrCode: 7012, ErrMsg: "bad value"}}}},
+	}
+	for _, m := range msgs {
+		b, err := m.Marshal()
+		if err != nil {
+			t.Fatalf("%s: %v", m.ID, err)
+		}
+		got, err := UnmarshalMsg(b)
+		if err != nil {
+			t.Fatalf("%s: %v", m.ID, err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Fatalf("%s: round trip mismatch\n got %+v\nwant %+v", m.ID, got, m)
+		}
+	}
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	r := &Record{Version: Version, ToID: "os::agent", FromID: "self::ctrl", Payload: []byte{1, 2, 3}}
+	got, err := UnmarshalRecord(r.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, r) {
+		t.Fatalf("got %+v want %+v", got, r)
+	}
+
+	for _, r := range []*Record{
+		{Version: Version, FromID: "os::agent", Type: RecordWebSocketConnect},
+		{Version: Version, FromID: "os::agent", Type: RecordMQTTConnect, SubscribedTopic: "usp/agent/reply"},
+	} {
+		got, err := UnmarshalRecord(r.Marshal())
+		if err != nil || !reflect.DeepEqual(got, r) {
+			t.Fatalf("connect record: got %+v, %v want %+v", got, err, r)
+		}
+	}
+
+	// a session_context record (field 8) is not supported
+	var e encoder
+	e.string(1, Version)
+	e.message(8, func(*encoder) {})
+	if _, err := UnmarshalRecord(e.b); !errors.Is(err, ErrUnsupportedRecord) {
+		t.Fatalf("expected ErrUnsupportedRecord, got %v", err)
+	}
+	if _, err := UnmarshalRecord([]byte{0x0a, 0x05, 'x'}); err == nil {
+		t.Fatal("expected truncation error")
+	}
+}
+
+func TestEmptyMsg(t *testing.T) {
+	if _, err := (&Msg{ID: "x"}).Marshal(); err == nil {
+		t.Fatal("expected error for message without body")
+	}
+}
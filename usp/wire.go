@@ -0,0 +1,149 @@
+package usp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Minimal protobuf (proto3) wire encoding for the handful of USP messages devicemgr uses,
+// so the module does not need generated code or a protobuf runtime.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("usp: truncated message")
+
+type encoder struct{ b []byte }
+
+func (e *encoder) varint(v uint64) { e.b = binary.AppendUvarint(e.b, v) }
+
+func (e *encoder) tag(field, wt int) { e.varint(uint64(field)<<3 | uint64(wt)) }
+
+func (e *encoder) bytes(field int, b []byte) {
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// string, bool, uint and fixed32 omit zero values, as proto3 does.
+func (e *encoder) string(field int, s string) {
+	if s != "" {
+		e.bytes(field, []byte(s))
+	}
+}
+
+func (e *encoder) bool(field int, v bool) {
+	if v {
+		e.tag(field, wireVarint)
+		e.varint(1)
+	}
+}
+
+func (e *encoder) uint(field int, v uint64) {
+	if v != 0 {
+		e.tag(field, wireVarint)
+		e.varint(v)
+	}
+}
+
+func (e *encoder) fixed32(field int, v uint32) {
+	if v != 0 {
+		e.tag(field, wireFixed32)
+		e.b = binary.LittleEndian.AppendUint32(e.b, v)
+	}
+}
+
+// message writes a nested message, even when empty (presence matters for oneof members).
+func (e *encoder) message(field int, fn func(*encoder)) {
+	var c encoder
+	fn(&c)
+	e.bytes(field, c.b)
+}
+
+// stringMap writes a map<string,string> with keys in order so encodings are deterministic.
+func (e *encoder) stringMap(field int, m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e.message(field, func(c *encoder) {
+			c.string(1, k)
+			c.string(2, m[k])
+		})
+	}
+}
+
+// field is one decoded key/value; u holds varint and fixed values, b length-delimited ones.
+type field struct {
+	num int
+	wt  int
+	u   uint64
+	b   []byte
+}
+
+func (f field) str() string { return string(f.b) }
+
+// fields calls fn for every field in b; callers ignore numbers they do not know.
+func fields(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+		f := field{num: int(key >> 3), wt: int(key & 7)}
+		switch f.wt {
+		case wireVarint:
+			if f.u, n = binary.Uvarint(b); n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			f.u, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errTruncated
+			}
+			f.u, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errTruncated
+			}
+			f.b, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			return fmt.Errorf("usp: unsupported wire type %d", f.wt)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapEntry decodes one map<string,string> entry into m.
+func mapEntry(b []byte, m map[string]string) error {
+	var k, v string
+	err := fields(b, func(f field) error {
+		switch f.num {
+		case 1:
+			k = f.str()
+		case 2:
+			v = f.str()
+		}
+		return nil
+	})
+	m[k] = v
+	return err
+}
@@ -0,0 +1,110 @@
+// Package whatif simulates a change of xconf policy against the device inventory before it is
+// made: which devices would be assigned other firmware, and which would be written other
+// settings.
+package whatif
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/policy"
+	"github.com/xmidt-org/talaria/devicemgr/settings"
+)
+
+// Devices is the subset of manager.Manager used by Simulate.
+type Devices interface {
+	ListDevices(ctx context.Context) []dm.DeviceState
+	FirmwareRuleSet(ctx context.Context) (*policy.FirmwareRuleSet, error)
+}
+
+// Settings is the subset of settings.Service used by Simulate.
+type Settings interface {
+	Simulate(ctx context.Context, proposed policy.SettingsProfile) ([]settings.Impact, error)
+}
+
+// Change is a proposed policy change: firmware rules and configs to create, replace or delete,
+// and settings profiles as they would be saved.
+type Change struct {
+	Firmware policy.FirmwareChange    `json:"firmware"`
+	Profiles []policy.SettingsProfile `json:"profiles,omitempty"`
+}
+
+func (c Change) firmware() bool {
+	f := c.Firmware
+	return len(f.Rules)+len(f.Configs)+len(f.DeleteRules)+len(f.DeleteConfigs) > 0
+}
+
+// FirmwareChange is a device that would be assigned another firmware. From or To is empty when
+// no rule assigns the device a config before or after the change.
+type FirmwareChange struct {
+	Device     dm.DeviceID `json:"device"`
+	Model      string      `json:"model,omitempty"`
+	From       string      `json:"from,omitempty"` // firmware version
+	To         string      `json:"to,omitempty"`
+	FromPolicy string      `json:"fromPolicy,omitempty"`
+	ToPolicy   string      `json:"toPolicy,omitempty"`
+	FromRule   string      `json:"fromRule,omitempty"`
+	ToRule     string      `json:"toRule,omitempty"`
+}
+
+// Result is what the change would do to the devices visible to the caller.
+type Result struct {
+	GeneratedAt time.Time          `json:"generatedAt"`
+	Devices     int                `json:"devices"` // inventory simulated against
+	Firmware    []FirmwareChange   `json:"firmware"`
+	Settings    []settings.Impact  `json:"settings"`
+	Lint        *policy.LintReport `json:"lint,omitempty"` // findings of the changed firmware rules
+}
+
+// Simulate applies the change to the firmware rule set and settings profiles in memory and
+// reports the devices it would affect; nothing is written to xconf. s may be nil when settings
+// assignments are not managed, in which case profile changes affect no device.
+func Simulate(ctx context.Context, m Devices, s Settings, c Change) (*Result, error) {
+	devices := m.ListDevices(ctx)
+	r := &Result{GeneratedAt: time.Now().UTC(), Devices: len(devices), Firmware: []FirmwareChange{}, Settings: []settings.Impact{}}
+	if c.firmware() {
+		rs, err := m.FirmwareRuleSet(ctx)
+		if err != nil {
+			return nil, err
+		}
+		next := rs.Apply(c.Firmware)
+		for _, d := range devices {
+			dc := policy.DeviceContextOf(d)
+			before, _ := rs.Resolve(dc) // nil when no rule assigns the device a config
+			after, _ := next.Resolve(dc)
+			if fc, changed := compare(dc, before, after); changed {
+				r.Firmware = append(r.Firmware, fc)
+			}
+		}
+		sort.Slice(r.Firmware, func(i, k int) bool { return r.Firmware[i].Device < r.Firmware[k].Device })
+		ids := make([]string, len(c.Firmware.Rules))
+		for i, rule := range c.Firmware.Rules {
+			ids[i] = rule.ID
+		}
+		r.Lint = next.Lint().Involving(ids...)
+	}
+	if s != nil {
+		for _, p := range c.Profiles {
+			impacts, err := s.Simulate(ctx, p)
+			if err != nil {
+				return nil, err
+			}
+			r.Settings = append(r.Settings, impacts...)
+		}
+	}
+	return r, nil
+}
+
+func compare(dc policy.DeviceContext, before, after *policy.FirmwarePolicy) (FirmwareChange, bool) {
+	fc := FirmwareChange{Device: dc.ID, Model: dc.Model}
+	if before != nil {
+		fc.From, fc.FromPolicy, fc.FromRule = before.Version, before.ID, before.Metadata["ruleId"]
+	}
+	if after != nil {
+		fc.To, fc.ToPolicy, fc.ToRule = after.Version, after.ID, after.Metadata["ruleId"]
+	}
+	return fc, !strings.EqualFold(fc.From, fc.To) || fc.FromPolicy != fc.ToPolicy
+}
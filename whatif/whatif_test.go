@@ -0,0 +1,87 @@
+package whatif
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/policy"
+	"github.com/xmidt-org/talaria/devicemgr/settings"
+)
+
+type fakeDevices struct {
+	rules *policy.FirmwareRuleSet
+}
+
+func (f *fakeDevices) ListDevices(context.Context) []dm.DeviceState {
+	return []dm.DeviceState{
+		{ID: "mac:0000000000a1", Metadata: map[string]string{dm.MetadataModel: "XB7"}},
+		{ID: "mac:0000000000a2", Metadata: map[string]string{dm.MetadataModel: "XB7"}},
+		{ID: "mac:0000000000b1", Metadata: map[string]string{dm.MetadataModel: "TG1682"}},
+	}
+}
+
+func (f *fakeDevices) FirmwareRuleSet(context.Context) (*policy.FirmwareRuleSet, error) {
+	return f.rules, nil
+}
+
+type fakeSettings struct{ profiles []string }
+
+func (f *fakeSettings) Simulate(_ context.Context, p policy.SettingsProfile) ([]settings.Impact, error) {
+	f.profiles = append(f.profiles, p.ID)
+	return []settings.Impact{{Assignment: "wifi", Profile: p.ID, Devices: []dm.DeviceID{"mac:0000000000a1"}}}, nil
+}
+
+func rules(t *testing.T, js string) []policy.FirmwareRule {
+	t.Helper()
+	var out []policy.FirmwareRule
+	if err := json.Unmarshal([]byte(js), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestSimulate(t *testing.T) {
+	current := rules(t, `[
+	 {"id":"xb7","type":"ENV_MODEL_RULE","applicableAction":{"configId":"fw-7.0"},
+	  "rule":{"condition":{"freeArg":{"name":"model"},"operation":"IS","fixedArg":{"bean":{"value":{"java.lang.String":"XB7"}}}}}}
+	]`)
+	dev := &fakeDevices{rules: policy.NewFirmwareRuleSet(current, []policy.FirmwarePolicy{{ID: "fw-7.0", Version: "XB7_7.0"}})}
+	canary := rules(t, `[
+	 {"id":"canary","type":"MAC_RULE","applicableAction":{"configId":"fw-7.1"},
+	  "rule":{"condition":{"freeArg":{"name":"eStbMac"},"operation":"IN","fixedArg":{"collection":{"value":["00:00:00:00:00:A2","00:00:00:00:00:B1"]}}}}}
+	]`)
+	sim := &fakeSettings{}
+	r, err := Simulate(context.Background(), dev, sim, Change{
+		Firmware: policy.FirmwareChange{Rules: canary, Configs: []policy.FirmwarePolicy{{ID: "fw-7.1", Version: "XB7_7.1"}}},
+		Profiles: []policy.SettingsProfile{{ID: "residential"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Devices != 3 || len(r.Firmware) != 2 {
+		t.Fatalf("result %+v", r)
+	}
+	if fc := r.Firmware[0]; fc.Device != "mac:0000000000a2" || fc.From != "XB7_7.0" || fc.To != "XB7_7.1" || fc.FromRule != "xb7" || fc.ToRule != "canary" {
+		t.Fatalf("a2 %+v", fc)
+	}
+	if fc := r.Firmware[1]; fc.Device != "mac:0000000000b1" || fc.From != "" || fc.ToPolicy != "fw-7.1" {
+		t.Fatalf("b1 %+v", fc)
+	}
+	if r.Lint == nil || len(r.Lint.Findings) != 0 {
+		t.Fatalf("lint %+v", r.Lint)
+	}
+	if len(r.Settings) != 1 || len(sim.profiles) != 1 {
+		t.Fatalf("settings %+v", r.Settings)
+	}
+	if len(dev.rules.Rules) != 1 || len(dev.rules.Configs) != 1 {
+		t.Fatal("simulation modified the current rule set")
+	}
+
+	// deleting the only rule leaves the XB7s without a policy
+	r, err = Simulate(context.Background(), dev, nil, Change{Firmware: policy.FirmwareChange{DeleteRules: []string{"xb7"}}})
+	if err != nil || len(r.Firmware) != 2 || r.Firmware[0].To != "" || r.Firmware[0].FromPolicy != "fw-7.0" {
+		t.Fatalf("delete %+v %v", r, err)
+	}
+}
@@ -0,0 +1,113 @@
+// Package wrpmsg builds and parses the WRP messages devicemgr exchanges with devices, on top of
+// wrp-go: SimpleRequestResponse requests carrying WDMP (see package translate) or JSON-RPC
+// payloads, SimpleEvents, and their msgpack encoding.
+package wrpmsg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+// DefaultSource is the WRP source used when a builder is given none.
+const DefaultSource = "dns:devicemgr"
+
+// ContentType is the media type of msgpack-encoded WRP messages.
+var ContentType = wrp.Msgpack.ContentType()
+
+// ErrUnexpectedResponse reports a reply that is not the response to the request it was matched with.
+var ErrUnexpectedResponse = errors.New("wrp: unexpected response")
+
+// Destination is the WRP address of a device service, e.g. mac:112233445566/config.
+func Destination(id dm.DeviceID, service string) string {
+	if service == "" {
+		return string(id)
+	}
+	return string(id) + "/" + strings.TrimPrefix(service, "/")
+}
+
+// Request builds a SimpleRequestResponse to a device service with a new transaction UUID.
+func Request(source string, id dm.DeviceID, service, contentType string, payload []byte) *wrp.Message {
+	if source == "" {
+		source = DefaultSource
+	}
+	return &wrp.Message{
+		Type:            wrp.SimpleRequestResponseMessageType,
+		Source:          source,
+		Destination:     Destination(id, service),
+		TransactionUUID: uuid.NewString(),
+		ContentType:     contentType,
+		Payload:         payload,
+	}
+}
+
+// Event builds a SimpleEvent, e.g. to event:device-status/mac:112233445566/online.
+func Event(source, destination, contentType string, payload []byte) *wrp.Message {
+	if source == "" {
+		source = DefaultSource
+	}
+	return &wrp.Message{
+		Type:        wrp.SimpleEventMessageType,
+		Source:      source,
+		Destination: destination,
+		ContentType: contentType,
+		Payload:     payload,
+	}
+}
+
+// Encode serializes msg as msgpack.
+func Encode(msg *wrp.Message) ([]byte, error) {
+	var out []byte
+	if err := wrp.NewEncoderBytes(&out, wrp.Msgpack).Encode(msg); err != nil {
+		return nil, fmt.Errorf("wrp encode: %w", err)
+	}
+	return out, nil
+}
+
+// Decode parses a msgpack WRP message.
+func Decode(b []byte) (*wrp.Message, error) {
+	var msg wrp.Message
+	if err := wrp.NewDecoderBytes(b, wrp.Msgpack).Decode(&msg); err != nil {
+		return nil, fmt.Errorf("wrp decode: %w", err)
+	}
+	return &msg, nil
+}
+
+// ParseResponse decodes a device's reply to req. The reply must be a SimpleRequestResponse with
+// the same transaction UUID; a WRP status outside 2xx is mapped onto the devicemgr sentinels.
+func ParseResponse(req *wrp.Message, b []byte) (*wrp.Message, error) {
+	resp, err := Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Type != wrp.SimpleRequestResponseMessageType || resp.TransactionUUID != req.TransactionUUID {
+		return nil, fmt.Errorf("%w: %s %q", ErrUnexpectedResponse, resp.Type, resp.TransactionUUID)
+	}
+	if resp.Status != nil {
+		if err := StatusError(*resp.Status); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+// StatusError maps a WRP status onto a devicemgr sentinel; 2xx yields nil.
+func StatusError(status int64) error {
+	switch {
+	case status >= 200 && status < 300:
+		return nil
+	case status == 403:
+		return fmt.Errorf("wrp status %d: %w", status, dm.ErrAccessDenied)
+	case status == 404:
+		return fmt.Errorf("wrp status %d: %w", status, dm.ErrDeviceNotFound)
+	case status == 504:
+		return fmt.Errorf("wrp status %d: %w", status, dm.ErrTimeout)
+	case status >= 500:
+		return fmt.Errorf("wrp status %d: %w", status, dm.ErrBackendUnavailable)
+	}
+	return fmt.Errorf("wrp status %d", status)
+}
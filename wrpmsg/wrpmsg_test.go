@@ -0,0 +1,81 @@
+package wrpmsg
+
+import (
+	"errors"
+	"testing"
+
+	dm "github.com/xmidt-org/talaria/devicemgr"
+	"github.com/xmidt-org/talaria/devicemgr/translate"
+	"github.com/xmidt-org/wrp-go/v3"
+)
+
+func TestRequestResponse(t *testing.T) {
+	payload, err := translate.BuildGet([]string{"Device.DeviceInfo.UpTime"}, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := Request("", "mac:112233445566", "config", "application/json", payload)
+	if req.Destination != "mac:112233445566/config" || req.Source != DefaultSource || req.TransactionUUID == "" {
+		t.Fatalf("unexpected request %+v", req)
+	}
+	b, err := Encode(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Type != wrp.SimpleRequestResponseMessageType || string(decoded.Payload) != string(payload) {
+		t.Fatalf("round trip mismatch %+v", decoded)
+	}
+
+	reply := func(m wrp.Message) []byte {
+		m.Type = wrp.SimpleRequestResponseMessageType
+		b, err := Encode(&m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	ok := reply(wrp.Message{TransactionUUID: req.TransactionUUID, Payload: []byte(`{"statusCode":200,"parameters":[{"name":"Device.DeviceInfo.UpTime","value":"42","dataType":2}]}`)})
+	resp, err := ParseResponse(req, ok)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	wdmp, err := translate.ParseResponse(resp.Payload)
+	if err != nil || len(wdmp.Parameters) != 1 || wdmp.Parameters[0].Value != "42" {
+		t.Fatalf("wdmp: %+v %v", wdmp, err)
+	}
+
+	if _, err := ParseResponse(req, reply(wrp.Message{TransactionUUID: "other"})); !errors.Is(err, ErrUnexpectedResponse) {
+		t.Fatalf("expected ErrUnexpectedResponse, got %v", err)
+	}
+	status := int64(404)
+	if _, err := ParseResponse(req, reply(wrp.Message{TransactionUUID: req.TransactionUUID, Status: &status})); !errors.Is(err, dm.ErrDeviceNotFound) {
+		t.Fatalf("expected ErrDeviceNotFound, got %v", err)
+	}
+	if _, err := Decode([]byte{0xc1}); err == nil {
+		t.Fatal("expected decode error")
+	}
+}
+
+func TestWDMPErrorStatus(t *testing.T) {
+	r, err := translate.ParseResponse([]byte(`{"statusCode":520,"message":"Error unsupported namespace"}`))
+	if err == nil || r == nil || r.StatusCode != 520 {
+		t.Fatalf("expected status error with response, got %+v %v", r, err)
+	}
+	if _, err := translate.ParseResponse([]byte(`{}`)); err == nil {
+		t.Fatal("expected missing statusCode error")
+	}
+}
+
+func TestEvent(t *testing.T) {
+	e := Event("dns:x", "event:device-status/mac:1122/online", "application/json", []byte("{}"))
+	if e.Type != wrp.SimpleEventMessageType || e.Source != "dns:x" || e.TransactionUUID != "" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if Destination("mac:1122", "") != "mac:1122" {
+		t.Fatal("destination without service")
+	}
+}